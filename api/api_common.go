@@ -3,10 +3,15 @@ package api
 import (
 	"context"
 	"fmt"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
 
+	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-jsonrpc/auth"
 
 	"github.com/filecoin-project/lotus/build"
@@ -19,6 +24,14 @@ type Common interface {
 	AuthVerify(ctx context.Context, token string) ([]auth.Permission, error)
 	AuthNew(ctx context.Context, perms []auth.Permission) ([]byte, error)
 
+	// AuthNewNamespaced creates a token which can only act on behalf of the
+	// wallets and miners of the namespace. Namespaced tokens can't be granted
+	// the admin permission.
+	AuthNewNamespaced(ctx context.Context, perms []auth.Permission, ns TokenNamespace) ([]byte, error)
+	// AuthVerifyNamespace returns the namespace a token is bound to, or nil if
+	// it isn't bound to any
+	AuthVerifyNamespace(ctx context.Context, token string) (*TokenNamespace, error)
+
 	// MethodGroup: Net
 
 	NetConnectedness(context.Context, peer.ID) (network.Connectedness, error)
@@ -28,6 +41,9 @@ type Common interface {
 	NetDisconnect(context.Context, peer.ID) error
 	NetFindPeer(context.Context, peer.ID) (peer.AddrInfo, error)
 	NetPubsubScores(context.Context) ([]PubsubScore, error)
+	// NetProtocolCensus reports which chain sync and markets protocols, and
+	// which of their versions, the connected peers support
+	NetProtocolCensus(context.Context) (*ProtocolCensus, error)
 
 	// MethodGroup: Common
 
@@ -40,12 +56,60 @@ type Common interface {
 	LogList(context.Context) ([]string, error)
 	LogSetLevel(context.Context, string, string) error
 
+	// JournalQuery returns entries of the journal of significant node events,
+	// e.g. head changes, sync errors, mpool rejections or miner messages,
+	// oldest first
+	JournalQuery(context.Context, JournalQuery) ([]JournalEntry, error)
+
 	// trigger graceful shutdown
 	Shutdown(context.Context) error
 
 	Closing(context.Context) (<-chan struct{}, error)
 }
 
+// TokenNamespace binds an API token to wallets and miners. Bound tokens can
+// only send messages from, and sign with, the wallets of their namespace, and
+// only mine blocks for its miners.
+type TokenNamespace struct {
+	Wallets []address.Address
+	Miners  []address.Address
+}
+
+func (ns *TokenNamespace) HasWallet(a address.Address) bool {
+	for _, w := range ns.Wallets {
+		if w == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (ns *TokenNamespace) HasMiner(a address.Address) bool {
+	for _, m := range ns.Miners {
+		if m == a {
+			return true
+		}
+	}
+	return false
+}
+
+// JournalQuery selects journal entries, empty fields match any entry. Limit
+// returns only the latest matching entries.
+type JournalQuery struct {
+	System string
+	Event  string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+type JournalEntry struct {
+	System    string
+	Event     string
+	Timestamp time.Time
+	Val       interface{}
+}
+
 // Version provides various build-time information
 type Version struct {
 	Version string
@@ -56,12 +120,66 @@ type Version struct {
 	// See APIVersion in build/version.go
 	APIVersion build.Version
 
-	// TODO: git commit / os / genesis cid?
+	// TODO: os / genesis cid?
 
 	// Seconds
 	BlockDelay uint64
+
+	// Commit is the git commit the binary was built from
+	Commit string
+	// BuildType is release, debug or 2k
+	BuildType string
+	GoVersion string
+	// ActorsVersion is the version of the actors the binary was built with
+	ActorsVersion string
+	// ParamsVersion is the version of the proof parameters, e.g. v27
+	ParamsVersion string
+}
+
+// LocalVersion returns the version of the running binary
+func LocalVersion() Version {
+	return Version{
+		Version:    build.UserVersion(),
+		APIVersion: build.APIVersion,
+
+		BlockDelay: build.BlockDelaySecs,
+
+		Commit:        strings.TrimPrefix(build.CurrentCommit, "+git."),
+		BuildType:     build.BuildTypeName(),
+		GoVersion:     runtime.Version(),
+		ActorsVersion: build.ActorsVersion(),
+		ParamsVersion: build.ParamsVersion(),
+	}
 }
 
 func (v Version) String() string {
 	return fmt.Sprintf("%s+api%s", v.Version, v.APIVersion.String())
 }
+
+// Compatible returns an error if the components running the two versions
+// can't work together. Components built from different commits are
+// compatible, as long as they speak the same API, run the same kind of build,
+// and agree on the actors and proof parameters. Fields which are empty, e.g.
+// reported by older builds, aren't compared.
+func (v Version) Compatible(o Version) error {
+	if !v.APIVersion.EqMajorMinor(o.APIVersion) {
+		return xerrors.Errorf("API version %s doesn't match %s", o.APIVersion, v.APIVersion)
+	}
+	if v.BlockDelay != 0 && o.BlockDelay != 0 && v.BlockDelay != o.BlockDelay {
+		return xerrors.Errorf("block delay %ds doesn't match %ds", o.BlockDelay, v.BlockDelay)
+	}
+
+	check := func(what, a, b string) error {
+		if a != "" && b != "" && a != b {
+			return xerrors.Errorf("%s %s doesn't match %s", what, b, a)
+		}
+		return nil
+	}
+	if err := check("build type", v.BuildType, o.BuildType); err != nil {
+		return err
+	}
+	if err := check("actors version", v.ActorsVersion, o.ActorsVersion); err != nil {
+		return err
+	}
+	return check("proof parameters version", v.ParamsVersion, o.ParamsVersion)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/lotus/build"
+)
+
+func TestVersionCompatible(t *testing.T) {
+	local := LocalVersion()
+
+	if err := local.Compatible(local); err != nil {
+		t.Fatal(err)
+	}
+
+	// older builds only report their API version
+	if err := local.Compatible(Version{Version: "unknown", APIVersion: build.APIVersion}); err != nil {
+		t.Fatalf("expected a build without version info to be compatible: %s", err)
+	}
+
+	other := local
+	other.APIVersion += 1 << 8 // next minor version
+	if err := local.Compatible(other); err == nil {
+		t.Fatal("expected a different API version to be incompatible")
+	}
+
+	other = local
+	other.BuildType = "other"
+	if err := local.Compatible(other); err == nil {
+		t.Fatal("expected a different build type to be incompatible")
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/ipfs/go-cid"
@@ -17,8 +18,11 @@ import (
 	"github.com/filecoin-project/specs-actors/actors/builtin/paych"
 	"github.com/filecoin-project/specs-actors/actors/builtin/power"
 	"github.com/filecoin-project/specs-actors/actors/crypto"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
 
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/envelope"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
 
@@ -34,9 +38,51 @@ type FullNode interface {
 	// First message is guaranteed to be of len == 1, and type == 'current'.
 	ChainNotify(context.Context) (<-chan []*HeadChange, error)
 
+	// ChainNotifyReorgs returns a channel of the reorgs of the chain, head
+	// changes which revert tipsets, with the messages they dropped from the
+	// chain.
+	ChainNotifyReorgs(context.Context) (<-chan *ReorgEvent, error)
+
+	// ChainReorgStats returns statistics of the reorgs the node observed since
+	// it started, with a depth histogram and the most recent reorgs. Reorgs are
+	// also recorded in the journal.
+	ChainReorgStats(context.Context) (*ReorgStats, error)
+
+	// ChainChangefeed streams the tipsets applied to and reverted from the
+	// chain, with the CIDs of their blocks, messages and receipts, starting
+	// after the entry with the given sequence number. The feed is persisted,
+	// so consumers can resume from the last entry they processed after a
+	// restart of either side, as long as the entry wasn't pruned.
+	ChainChangefeed(ctx context.Context, after uint64) (<-chan *ChangefeedEntry, error)
+
+	// ChainSubscribeEvents streams the executions of messages matching the
+	// filter, once they reach its confidence, grouped by the tipset they were
+	// executed in. When such a tipset is reverted, a 'revert' event with the
+	// tipset is sent.
+	ChainSubscribeEvents(context.Context, EventFilter) (<-chan *ChainEvent, error)
+
+	// ChainNotifyAt sends an 'apply' event when the chain reaches the given
+	// height plus confidence epochs, with the tipset at the height, or the
+	// first one above it if the height is a null round. When that tipset is
+	// reverted a 'revert' event is sent, and 'apply' is sent again once the
+	// new chain reaches the height. If the chain is already there, 'apply' is
+	// sent right away.
+	ChainNotifyAt(ctx context.Context, height abi.ChainEpoch, confidence uint64) (<-chan *HeightEvent, error)
+
+	// ChainMulticall executes read-only API calls against the same tipset, in
+	// one request. Empty TipSetKey parameters of the calls are replaced by
+	// tsk, or by the head at the time of the call when tsk is empty. Calls run
+	// in order, a failed call doesn't stop the ones after it.
+	ChainMulticall(ctx context.Context, tsk types.TipSetKey, calls []Call) (*MulticallResult, error)
+
 	// ChainHead returns the current head of the chain.
 	ChainHead(context.Context) (*types.TipSet, error)
 
+	// ChainHeadInfo returns the current head of the chain along with its
+	// weight, the last final epoch, and how many epochs the head lags behind
+	// the wall clock.
+	ChainHeadInfo(context.Context) (*HeadInfo, error)
+
 	// ChainGetRandomness is used to sample the chain for randomness.
 	ChainGetRandomness(ctx context.Context, tsk types.TipSetKey, personalization crypto.DomainSeparationTag, randEpoch abi.ChainEpoch, entropy []byte) (abi.Randomness, error)
 
@@ -98,8 +144,46 @@ type FullNode interface {
 	// Would return `[revert(tBA), apply(tAB), apply(tAA)]`
 	ChainGetPath(ctx context.Context, from types.TipSetKey, to types.TipSetKey) ([]*HeadChange, error)
 
-	// ChainExport returns a stream of bytes with CAR dump of chain data.
-	ChainExport(context.Context, types.TipSetKey) (<-chan []byte, error)
+	// ChainExport returns a stream of bytes with CAR dump of chain data,
+	// see ChainExportOptions for what is included. The stream ends with an
+	// empty chunk, if it's closed without one the export failed.
+	ChainExport(ctx context.Context, tsk types.TipSetKey, opts ChainExportOptions) (<-chan []byte, error)
+
+	// ChainImport imports a CAR dump of chain data, e.g. a snapshot created
+	// with ChainExport, from a file on the node. The imported tipset becomes
+	// the head if it's heavier than the current one, and the node syncs the
+	// rest of the chain from it. Unless trusted is set, the state of the
+	// imported chain is recomputed from genesis first, which fails for
+	// snapshots without all of the messages. Trusted imports only check
+	// that the chain links to the genesis and that its state is included.
+	ChainImport(ctx context.Context, path string, trusted bool) (types.TipSetKey, error)
+
+	// ChainFetchSnapshot downloads a recent snapshot from a trusted peer
+	// serving them, resuming an earlier interrupted download of the same
+	// snapshot, and imports it like a trusted ChainImport.
+	ChainFetchSnapshot(ctx context.Context, p peer.AddrInfo) (types.TipSetKey, error)
+
+	// ChainVerify walks the local chain towards genesis and verifies parent
+	// links, block signatures, message roots and, for a sample of tipsets,
+	// state roots by recomputing them. The walk is bounded by the timeout of
+	// the options, the report of a walk which timed out is partial.
+	ChainVerify(context.Context, ChainVerifyOptions) (*ChainVerifyReport, error)
+
+	// ChainPrune removes the objects of the chain blockstore which aren't
+	// reachable from the chain, keeping the state of the last keepStateRoots
+	// tipsets only. Block headers, messages and receipts are kept. With
+	// dryRun nothing is removed, and the report shows the space which would
+	// be reclaimed.
+	ChainPrune(ctx context.Context, keepStateRoots abi.ChainEpoch, dryRun bool) (*ChainPruneReport, error)
+
+	// ChainReorgJournal returns the recent head changes recorded in the
+	// reorg journal, oldest first. Changes interrupted by a crash are rolled
+	// back on the next start.
+	ChainReorgJournal(context.Context) ([]ReorgJournalEntry, error)
+
+	// ChainReplayReorg applies the head change of a reorg journal entry
+	// again, if its target is still heavier than the current head.
+	ChainReplayReorg(ctx context.Context, id uint64) error
 
 	// MethodGroup: Sync
 	// The Sync method group contains methods for interacting with and
@@ -116,6 +200,11 @@ type FullNode interface {
 	// yet synced block headers.
 	SyncIncomingBlocks(ctx context.Context) (<-chan *types.BlockHeader, error)
 
+	// SyncProgress returns a channel streaming incoming candidate blocks and
+	// state changes of the active syncs, including an estimate of the time
+	// left in the current sync stage.
+	SyncProgress(ctx context.Context) (<-chan SyncProgressEvent, error)
+
 	// SyncMarkBad marks a blocks as bad, meaning that it won't ever by synced.
 	// Use with extreme caution.
 	SyncMarkBad(ctx context.Context, bcid cid.Cid) error
@@ -124,6 +213,19 @@ type FullNode interface {
 	// the reason.
 	SyncCheckBad(ctx context.Context, bcid cid.Cid) (string, error)
 
+	// NetBlocksyncPeers returns the reputation scoreboard of blocksync peers,
+	// including banned peers which are no longer connected.
+	NetBlocksyncPeers(context.Context) ([]BlocksyncPeer, error)
+
+	// SyncPeerHealth returns how well sync peers serve the chain the node
+	// follows, measured by periodically probing them for recent tipsets.
+	SyncPeerHealth(context.Context) ([]PeerHealth, error)
+
+	// SyncCheckpoint marks a tipset as a checkpoint. Chains which don't
+	// contain it are refused, and the node switches to the chain containing
+	// it if its current chain conflicts with it. Checkpoints are persisted.
+	SyncCheckpoint(ctx context.Context, tsk types.TipSetKey) error
+
 	// MethodGroup: Mpool
 	// The Mpool methods are for interacting with the message pool. The message pool
 	// manages all incoming and outgoing 'messages' going over the network.
@@ -136,17 +238,61 @@ type FullNode interface {
 
 	// MpoolPushMessage atomically assigns a nonce, signs, and pushes a message
 	// to mempool.
-	MpoolPushMessage(context.Context, *types.Message) (*types.SignedMessage, error)
+	// When spec sets an IdempotencyKey, repeated calls with the same key return
+	// the message pushed by the first call instead of sending it again.
+	MpoolPushMessage(ctx context.Context, msg *types.Message, spec *MessageSendSpec) (*types.SignedMessage, error)
 
 	// MpoolGetNonce gets next nonce for the specified sender.
 	// Note that this method may not be atomic. Use MpoolPushMessage instead.
 	MpoolGetNonce(context.Context, address.Address) (uint64, error)
 	MpoolSub(context.Context) (<-chan MpoolUpdate, error)
 
+	// MpoolReplace replaces the pending message of the sender with the given
+	// nonce by the same message with a higher gas price, signs and pushes it.
+	// The gas price has to be at least ReplaceByFeeRatio times the price of the
+	// replaced message, a zero gas price picks the lowest accepted price.
+	MpoolReplace(ctx context.Context, from address.Address, nonce uint64, gasPrice types.BigInt) (*types.SignedMessage, error)
+	// MpoolCancel replaces the pending message of the sender with the given
+	// nonce by a send of zero to the sender itself, paying the lowest accepted
+	// gas price, so that the original message isn't executed.
+	MpoolCancel(ctx context.Context, from address.Address, nonce uint64) (*types.SignedMessage, error)
+
+	// MpoolLocal lists the messages pushed through this node, which are
+	// persisted and added back to the pool after a restart, with their status.
+	MpoolLocal(context.Context) ([]LocalMessage, error)
+	// MpoolPurgeLocal removes the persisted local messages which aren't
+	// pending anymore, returning how many were removed.
+	MpoolPurgeLocal(context.Context) (int, error)
+
 	// MpoolEstimateGasPrice estimates what gas price should be used for a
 	// message to have high likelihood of inclusion in `nblocksincl` epochs.
+	// It is the same as GasEstimateGasPrice.
 	MpoolEstimateGasPrice(ctx context.Context, nblocksincl uint64, sender address.Address, gaslimit int64, tsk types.TipSetKey) (types.BigInt, error)
 
+	// MpoolAuditExport returns the records of the message audit log made
+	// between since and until, zero times don't limit the range. The log
+	// has to be enabled with MessageAudit.Enable in the node config.
+	MpoolAuditExport(ctx context.Context, since, until time.Time) ([]MessageAuditRecord, error)
+
+	// MethodGroup: Gas
+	// The Gas methods estimate the gas prices messages should pay, from the
+	// messages included in recent tipsets.
+
+	// GasEstimateGasPrice estimates the gas price a message of the sender using
+	// gaslimit gas should pay to be included within `nblocksincl` epochs after
+	// tsk, from the gas prices paid by the messages included in the last
+	// 2*nblocksincl tipsets. An empty tsk means the current head.
+	GasEstimateGasPrice(ctx context.Context, nblocksincl uint64, sender address.Address, gaslimit int64, tsk types.TipSetKey) (types.BigInt, error)
+	// GasPricePercentiles returns the given percentiles, between 0 and 100, of
+	// the gas prices paid by the messages included in the last `lookback`
+	// tipsets up to tsk, weighted by their gas limits.
+	GasPricePercentiles(ctx context.Context, lookback uint64, percentiles []float64, tsk types.TipSetKey) ([]types.BigInt, error)
+	// GasEstimateGasLimit applies the message on the state of tsk and returns
+	// the gas it used, split into compute and storage gas. The message doesn't
+	// need to be signed, its nonce is set from the state. An empty tsk means
+	// the current head.
+	GasEstimateGasLimit(ctx context.Context, msg *types.Message, tsk types.TipSetKey) (*GasEstimate, error)
+
 	// MethodGroup: Miner
 
 	MinerGetBaseInfo(context.Context, address.Address, abi.ChainEpoch, types.TipSetKey) (*MiningBaseInfo, error)
@@ -188,7 +334,9 @@ type FullNode interface {
 	// The Client methods all have to do with interacting with the storage and
 	// retrieval markets as a client
 
-	// ClientImport imports file under the specified path into filestore.
+	// ClientImport imports file under the specified path into filestore. With
+	// ref.Encrypt, the file is encrypted with a key held by the node, and the
+	// encrypted data is stored in the blockstore.
 	ClientImport(ctx context.Context, ref FileRef) (cid.Cid, error)
 	// ClientStartDeal proposes a deal with a miner.
 	ClientStartDeal(ctx context.Context, params *StartDealParams) (*cid.Cid, error)
@@ -210,6 +358,11 @@ type FullNode interface {
 	ClientCalcCommP(ctx context.Context, inpath string, miner address.Address) (*CommPRet, error)
 	// ClientGenCar generates a CAR file for the specified file.
 	ClientGenCar(ctx context.Context, ref FileRef, outpath string) error
+	// ClientExtract rebuilds the UnixFS files of a payload from a retrieved
+	// CAR, or an unsealed piece holding one, into outdir/<payload cid>.
+	// Blocks are checked against their cids. An undefined payload cid uses
+	// the root of the CAR.
+	ClientExtract(ctx context.Context, inpath string, payload cid.Cid, outdir string) (*ExtractResult, error)
 
 	// ClientUnimport removes references to the specified file from filestore
 	//ClientUnimport(path string)
@@ -226,8 +379,16 @@ type FullNode interface {
 
 	// StateCall runs the given message and returns its result without any persisted changes.
 	StateCall(context.Context, *types.Message, types.TipSetKey) (*InvocResult, error)
+	// StateDryRun applies the message the way it would be applied if it was
+	// included in the tipset following the given one, on the state computed
+	// by executing it, and charging gas. The nonce of the message is set to
+	// the one of the sender. Nothing is persisted.
+	StateDryRun(context.Context, *types.Message, types.TipSetKey) (*InvocResult, error)
 	// StateReplay returns the result of executing the indicated message, assuming it was executed in the indicated tipset.
 	StateReplay(context.Context, types.TipSetKey, cid.Cid) (*InvocResult, error)
+	// StateActorMethods describes the methods of built-in actors, with their
+	// names and the types of their parameters and return values.
+	StateActorMethods(context.Context) ([]ActorMethods, error)
 	// StateGetActor returns the indicated actor's nonce and balance.
 	StateGetActor(ctx context.Context, actor address.Address, tsk types.TipSetKey) (*types.Actor, error)
 	// StateReadState returns the indicated actor's state.
@@ -237,6 +398,9 @@ type FullNode interface {
 
 	// StateNetworkName returns the name of the network the node is synced to
 	StateNetworkName(context.Context) (dtypes.NetworkName, error)
+	// StateNetworkParams returns the network parameters the node runs with,
+	// which custom networks can set in the genesis file or the config
+	StateNetworkParams(context.Context) (build.NetworkParams, error)
 	// StateMinerSectors returns info about the given miner's sectors. If the filter bitfield is nil, all sectors are included.
 	// If the filterOut boolean is set to true, any sectors in the filter are excluded.
 	// If false, only those sectors in the filter are included.
@@ -291,13 +455,41 @@ type FullNode interface {
 	// StateChangedActors returns all the actors whose states change between the two given state CIDs
 	// TODO: Should this take tipset keys instead?
 	StateChangedActors(context.Context, cid.Cid, cid.Cid) (map[string]types.Actor, error)
+	// StateWatchActors returns a channel of balance and nonce changes of the
+	// given actors, as tipsets are applied to and reverted from the chain.
+	StateWatchActors(context.Context, []address.Address) (<-chan []*ActorChange, error)
 	// StateGetReceipt returns the message receipt for the given message
 	StateGetReceipt(context.Context, cid.Cid, types.TipSetKey) (*types.MessageReceipt, error)
+	// StateRebuildMsgIndex indexes the messages executed from the head back to
+	// the given epoch, or to genesis when it's zero, and returns how many were
+	// indexed. It's used to index messages executed before the message index
+	// was enabled.
+	StateRebuildMsgIndex(ctx context.Context, to abi.ChainEpoch) (int, error)
 	// StateMinerSectorCount returns the number of sectors in a miner's sector set and proving set
 	StateMinerSectorCount(context.Context, address.Address, types.TipSetKey) (MinerSectors, error)
 	// StateCompute is a flexible command that applies the given messages on the given tipset.
-	// The messages are run as though the VM were at the provided height.
+	// The messages are run as though the VM were at the provided height. The
+	// messages aren't signed nor sent to the network, their receipts and
+	// traces are returned with the resulting state root.
 	StateCompute(context.Context, abi.ChainEpoch, []*types.Message, types.TipSetKey) (*ComputeStateOutput, error)
+	// StateSnapshot returns a stream of bytes with a CAR dump of the state tree
+	// resulting from the execution of the tipset, with the state of all
+	// actors. The dump only depends on the state. The stream ends with an
+	// empty chunk, if it's closed without one the export failed.
+	StateSnapshot(context.Context, types.TipSetKey) (<-chan []byte, error)
+	// StateImportSnapshot imports a state dump created with StateSnapshot from
+	// a file on the node, and returns its state root. Nothing is imported if
+	// the state tree in the dump isn't complete.
+	StateImportSnapshot(ctx context.Context, path string) (cid.Cid, error)
+	// StateGasTrace executes the tipset, and returns where the gas used by
+	// each of its messages went
+	StateGasTrace(context.Context, types.TipSetKey) ([]*GasProfile, error)
+	// StateCronExecution executes the tipset, and returns how the implicit
+	// cron tick at the end of its epoch went, with the cron tasks which failed.
+	StateCronExecution(context.Context, types.TipSetKey) (*CronExecution, error)
+	// StateUpgradeDryRuns returns the dry runs of the scheduled network
+	// upgrades done ahead of their heights.
+	StateUpgradeDryRuns(context.Context) ([]UpgradeDryRun, error)
 
 	// MethodGroup: Msig
 	// The Msig methods are used to interact with multisig wallets on the
@@ -352,11 +544,68 @@ type FullNode interface {
 	PaychVoucherAdd(context.Context, address.Address, *paych.SignedVoucher, []byte, types.BigInt) (types.BigInt, error)
 	PaychVoucherList(context.Context, address.Address) ([]*paych.SignedVoucher, error)
 	PaychVoucherSubmit(context.Context, address.Address, *paych.SignedVoucher) (cid.Cid, error)
+
+	// MethodGroup: Deposit
+	// The Deposit methods expose the transfers to the addresses configured in
+	// the Deposits section of the node config, e.g. exchange deposit wallets
+
+	// DepositList lists tracked deposits. Acknowledged deposits are only
+	// returned when includeAcked is set.
+	DepositList(ctx context.Context, includeAcked bool) ([]Deposit, error)
+	// DepositAck marks the deposits made by the given messages as processed,
+	// which removes them from the default DepositList output.
+	DepositAck(ctx context.Context, msgs []cid.Cid) error
+
+	// MethodGroup: Stats
+	// The Stats methods expose aggregates maintained by the node when
+	// EpochRollups are enabled in the node config
+
+	// StatsEpochRollups returns the per-epoch rollups of the epochs from..to,
+	// inclusive. Null rounds, and epochs without a child tipset yet, are
+	// skipped.
+	StatsEpochRollups(ctx context.Context, from, to abi.ChainEpoch) ([]EpochRollup, error)
+	// ChainGetBaseFeeHistory returns the average gas price and gas utilization
+	// of the epochs from..to, inclusive, downsampled into buckets of
+	// resolution epochs. There is no protocol base fee yet, the average gas
+	// price paid for a unit of gas stands in for it.
+	ChainGetBaseFeeHistory(ctx context.Context, from, to, resolution abi.ChainEpoch) ([]FeeHistoryPoint, error)
+
+	// MethodGroup: Sandbox
+	// The Sandbox methods manage named in-memory forks of the chain state,
+	// where arbitrary messages can be applied without affecting the chain
+
+	// SandboxCreate forks the state resulting from executing the given tipset
+	// into a new sandbox.
+	SandboxCreate(ctx context.Context, name string, tsk types.TipSetKey) (*SandboxInfo, error)
+	// SandboxApply executes messages in the sandbox. Messages don't need to be
+	// signed, and their nonces are assigned from the sandbox state.
+	SandboxApply(ctx context.Context, name string, msgs []*types.Message) ([]*InvocResult, error)
+	// SandboxGetActor returns an actor from the sandbox state.
+	SandboxGetActor(ctx context.Context, name string, addr address.Address) (*types.Actor, error)
+	// SandboxReadState returns the balance and state of an actor in the sandbox.
+	SandboxReadState(ctx context.Context, name string, addr address.Address) (*ActorState, error)
+	// SandboxList lists existing sandboxes. Sandboxes are removed after they
+	// have not been used for a while.
+	SandboxList(ctx context.Context) ([]SandboxInfo, error)
+	SandboxDelete(ctx context.Context, name string) error
+}
+
+// ExtractResult describes the files written by ClientExtract. Blocks is the
+// number of blocks read from the input.
+type ExtractResult struct {
+	Root   cid.Cid
+	Path   string
+	Files  int
+	Bytes  int64
+	Blocks int
 }
 
 type FileRef struct {
 	Path  string
 	IsCAR bool
+	// Encrypt imports the file encrypted with the local payload encryption
+	// key. Retrieved payloads are decrypted when the node holds the key.
+	Encrypt bool
 }
 
 type MinerSectors struct {
@@ -384,6 +633,9 @@ type DealInfo struct {
 	Duration      uint64
 
 	DealID abi.DealID
+
+	// Encryption is set when the payload was encrypted on import
+	Encryption *envelope.Info
 }
 
 type MsgLookup struct {
@@ -393,6 +645,104 @@ type MsgLookup struct {
 	Height    abi.ChainEpoch
 }
 
+// ActorChange describes a change to the balance or nonce of a watched actor.
+type ActorChange struct {
+	Address address.Address
+
+	// TipSet is the tipset whose parent state first reflects the change,
+	// Height is its height.
+	TipSet types.TipSetKey
+	Height abi.ChainEpoch
+	// Reverted is set when TipSet was removed from the chain, which undoes
+	// the change.
+	Reverted bool
+
+	OldBalance types.BigInt
+	NewBalance types.BigInt
+	OldNonce   uint64
+	NewNonce   uint64
+
+	// Messages lists the messages executed in the parent of TipSet which were
+	// sent from or to the actor. It may be empty for changes caused by
+	// internal sends, like multisig transfers or block rewards.
+	Messages []cid.Cid
+}
+
+// EpochRollup aggregates the blocks and messages of one epoch, and their
+// effect on the chain state.
+type EpochRollup struct {
+	Height abi.ChainEpoch
+	TipSet types.TipSetKey
+
+	Blocks   int
+	Messages int
+	GasUsed  int64
+	// GasFees is the gas paid by the messages, FeesBurned the increase of the
+	// burnt funds actor balance
+	GasFees    types.BigInt
+	FeesBurned types.BigInt
+
+	// NewSectors counts successful ProveCommitSector messages
+	NewSectors    int
+	RawPowerDelta types.BigInt
+	QAPowerDelta  types.BigInt
+}
+
+// FeeHistoryPoint summarizes the fees and gas usage of the epochs From..To,
+// inclusive.
+type FeeHistoryPoint struct {
+	From abi.ChainEpoch
+	To   abi.ChainEpoch
+	// Epochs is the number of epochs with blocks which were indexed
+	Epochs int
+
+	// AvgGasPrice is the average gas price, weighted by gas used
+	AvgGasPrice types.BigInt
+	GasUsed     int64
+	// GasUtilization is the gas used over the gas limit of all blocks
+	GasUtilization float64
+}
+
+// Deposit is a successful transfer to a watched address.
+type Deposit struct {
+	Message cid.Cid
+	From    address.Address
+	// To is the watched address, as configured
+	To    address.Address
+	Value types.BigInt
+
+	// TipSet is the tipset whose parent state includes the transfer, Height
+	// is its height.
+	TipSet types.TipSetKey
+	Height abi.ChainEpoch
+
+	// Confirmations is the number of epochs on top of Height in the current
+	// chain. Confirmed is set once that reaches the configured threshold.
+	Confirmations abi.ChainEpoch
+	Confirmed     bool
+
+	// Reverted is set when an acknowledged deposit was removed from the chain
+	// by a reorg, and not yet included again.
+	Reverted bool
+	Acked    bool
+}
+
+type SandboxInfo struct {
+	Name string
+
+	// Base is the tipset the sandbox was forked at, messages are applied at
+	// Height, which follows it.
+	Base   types.TipSetKey
+	Height abi.ChainEpoch
+
+	StateRoot cid.Cid
+	// Applied is the number of messages applied to the sandbox
+	Applied int
+
+	Created  time.Time
+	LastUsed time.Time
+}
+
 type BlockMessages struct {
 	BlsMessages   []*types.Message
 	SecpkMessages []*types.SignedMessage
@@ -504,11 +854,106 @@ type RetrievalOrder struct {
 }
 
 type InvocResult struct {
-	Msg            *types.Message
-	MsgRct         *types.MessageReceipt
+	Msg *types.Message
+	// MethodName is the name of the invoked method, like
+	// miner.SubmitWindowedPoSt
+	MethodName string
+	MsgRct     *types.MessageReceipt
+	// GasBreakdown splits the gas used by the message into compute and
+	// storage gas
+	GasBreakdown   types.GasBreakdown
 	ExecutionTrace types.ExecutionTrace
 	Error          string
 	Duration       time.Duration
+
+	// Calls is the tree of sends made by the message, and StateRootBefore
+	// and StateRootAfter the state it was applied on and the resulting
+	// state. They are only set by StateReplay.
+	Calls           *CallTrace
+	StateRootBefore cid.Cid
+	StateRootAfter  cid.Cid
+}
+
+// GasProfile splits the gas used by a message. Categories sums the charges
+// by kind: message (chain storage of the message and its return value),
+// actor (method invocation and actor execution), ipld_read, ipld_write and
+// syscall. Charges sums them by the name of the charge, and Methods by the
+// actor method running when they were made.
+type GasProfile struct {
+	Msg     cid.Cid
+	GasUsed int64
+
+	Categories map[string]int64
+	Charges    map[string]int64
+	// Methods are sorted by Gas, highest first
+	Methods []MethodGas
+}
+
+// MethodGas is the gas charged while an actor method was running, not
+// counting the methods it called. Calls is the number of invocations.
+type MethodGas struct {
+	Method string
+	Calls  int
+	Gas    int64
+}
+
+// GasEstimate is the gas a message is estimated to use
+type GasEstimate struct {
+	GasLimit int64
+	// ComputeGas and StorageGas split GasLimit into compute gas, and storage
+	// gas paid for state I/O and for storing chain data
+	ComputeGas int64
+	StorageGas int64
+}
+
+// CallTrace is a send executed by the VM, with the sends it made in turn.
+// GasCharged includes the gas charged by the subcalls. HeadBefore and
+// HeadAfter are the state of the receiving actor, a failed send doesn't
+// change it.
+type CallTrace struct {
+	From   address.Address
+	To     address.Address
+	Value  abi.TokenAmount
+	Method abi.MethodNum
+	Params []byte
+
+	GasCharged int64
+	ExitCode   exitcode.ExitCode
+	Return     []byte
+	Error      string
+
+	HeadBefore cid.Cid
+	HeadAfter  cid.Cid
+
+	Subcalls []*CallTrace
+}
+
+// ActorMethods lists the methods of a built-in actor.
+type ActorMethods struct {
+	Name    string
+	Code    cid.Cid
+	Methods []MethodSchema
+}
+
+type MethodSchema struct {
+	Num abi.MethodNum
+	// Name is the name of the method prefixed with the actor name, like
+	// miner.SubmitWindowedPoSt
+	Name   string
+	Params TypeSchema
+	Return TypeSchema
+}
+
+// TypeSchema describes the Go type of method parameters or return values.
+// Fields are listed for struct types.
+type TypeSchema struct {
+	Type   string
+	Fields []FieldSchema `json:",omitempty"`
+}
+
+type FieldSchema struct {
+	Name string
+	Type string
 }
 
 type MethodCall struct {
@@ -525,6 +970,383 @@ type StartDealParams struct {
 	DealStartEpoch    abi.ChainEpoch
 }
 
+// BlocksyncPeer is the reputation of a peer used for blocksync requests
+type BlocksyncPeer struct {
+	ID peer.ID
+
+	// Connected is false for peers only known from their persisted reputation
+	Connected   bool
+	Successes   int
+	Failures    int
+	AverageTime time.Duration
+	GoAways     int
+	// Partials counts graphsync responses with only part of the segment
+	Partials int
+
+	Score       int
+	Offenses    int
+	Demoted     bool
+	BannedUntil time.Time
+}
+
+// MessageAuditEntry records a message pushed through the API
+type MessageAuditEntry struct {
+	Seq  uint64
+	Time time.Time
+
+	// Method is MpoolPush, MpoolPushMessage, MpoolReplace or MpoolCancel
+	Method string
+	// TokenID identifies the API token the message was pushed with, it's a
+	// hash of the token
+	TokenID string
+
+	Message   *types.Message
+	Signature *crypto.Signature `json:",omitempty"`
+	Cid       *cid.Cid          `json:",omitempty"`
+	// Error is set if the push failed. Messages are recorded before they're
+	// pushed, failed pushes are recorded in a second entry.
+	Error string `json:",omitempty"`
+
+	// PrevHash is the MAC of the previous entry
+	PrevHash string
+}
+
+// MessageAuditRecord is an entry of the message audit log, as it's stored.
+// Hash is the hex encoded HMAC-SHA256 of the JSON encoded entry, keyed with
+// the audit key of the node.
+type MessageAuditRecord struct {
+	Entry json.RawMessage
+	Hash  string
+}
+
+// ChainExportOptions select what ChainExport includes. The zero value exports
+// the headers, messages and receipts of the whole chain.
+type ChainExportOptions struct {
+	// RecentStateRoots includes the state of the last epochs, which makes the
+	// export a snapshot other nodes can import with ChainImport
+	RecentStateRoots abi.ChainEpoch
+	// SkipOldMessages leaves out the messages and receipts older than the
+	// recent state roots
+	SkipOldMessages bool
+	// Depth only exports the headers of the last epochs, the chain is
+	// exported from genesis when it's 0
+	Depth abi.ChainEpoch
+}
+
+type ChainVerifyOptions struct {
+	// From is the tipset the walk starts at, the head if empty
+	From types.TipSetKey
+	// Depth limits the number of verified tipsets, zero walks to genesis
+	Depth uint64
+	// StateSample is the share of tipsets, between 0 and 1, whose state is
+	// recomputed
+	StateSample float64
+	// MaxErrors stops the walk after that many errors, zero means no limit
+	MaxErrors int
+	// Timeout stops the walk, the node default is used when zero
+	Timeout time.Duration
+}
+
+type ChainVerifyReport struct {
+	FromHeight abi.ChainEpoch
+	ToHeight   abi.ChainEpoch
+
+	Tipsets       int
+	Blocks        int
+	Messages      int
+	StatesChecked int
+
+	Errors   []ChainVerifyError
+	Duration time.Duration
+	// TimedOut is set when the walk was stopped by the timeout, before
+	// reaching genesis or the requested depth
+	TimedOut bool
+}
+
+// ChainVerifyError is a problem found by ChainVerify. Check is one of
+// parents, signature, messages or state.
+type ChainVerifyError struct {
+	Height abi.ChainEpoch
+	TipSet types.TipSetKey
+	// Block is undefined for problems of the whole tipset
+	Block cid.Cid
+	Check string
+	Error string
+}
+
+// ChainPruneReport is the result of ChainPrune
+type ChainPruneReport struct {
+	DryRun bool
+	// KeptFrom is the lowest height whose state root is kept
+	KeptFrom abi.ChainEpoch
+
+	Kept uint64
+	// Removed and RemovedBytes are the objects removed, or the ones which
+	// would be removed by a dry run
+	Removed      uint64
+	RemovedBytes uint64
+
+	Duration time.Duration
+}
+
+// PeerHealth is the result of the availability probes of a sync peer
+type PeerHealth struct {
+	ID peer.ID
+
+	Probes int
+	// Served counts probed tipsets the peer returned
+	Served int
+	// Missing counts probed tipsets the peer didn't have, it's behind or
+	// follows another fork
+	Missing int
+	// Failed counts probes which errored or timed out
+	Failed int
+
+	// Availability is the share of probed tipsets the peer had
+	Availability float64
+	LastProbe    time.Time
+	// LastMissing is the height of the last probed tipset the peer didn't have
+	LastMissing abi.ChainEpoch
+}
+
+// ReorgJournalEntry is a head change recorded by the chain store. State is
+// one of 'pending', 'done' or 'rolledback'.
+type ReorgJournalEntry struct {
+	ID    uint64
+	From  types.TipSetKey
+	To    types.TipSetKey
+	State string
+	Time  time.Time
+
+	// Revert and Apply are the number of reverted and applied tipsets, set
+	// once the change was delivered
+	Revert int
+	Apply  int
+}
+
+// EventFilter selects the message executions ChainSubscribeEvents sends. A
+// message matches when it matches each of the non-empty lists.
+type EventFilter struct {
+	// Actors are the receivers to match
+	Actors    []address.Address
+	Methods   []abi.MethodNum
+	ExitCodes []exitcode.ExitCode
+
+	// Confidence is the number of epochs executions are sent after, Final
+	// sends them once they are final instead
+	Confidence uint64
+	Final      bool
+}
+
+func (f *EventFilter) Matches(msg *types.Message, rec *types.MessageReceipt) bool {
+	if len(f.Actors) > 0 {
+		var ok bool
+		for _, a := range f.Actors {
+			ok = ok || a == msg.To
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if len(f.Methods) > 0 {
+		var ok bool
+		for _, m := range f.Methods {
+			ok = ok || m == msg.Method
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if len(f.ExitCodes) > 0 {
+		var ok bool
+		for _, c := range f.ExitCodes {
+			ok = ok || c == rec.ExitCode
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ChainEvent is sent by ChainSubscribeEvents. Type is 'apply' when it holds
+// the matched executions of the tipset, or 'revert' when the tipset was
+// reverted.
+type ChainEvent struct {
+	Type   string
+	TipSet types.TipSetKey
+	Height abi.ChainEpoch
+
+	Executions []MsgExecution
+}
+
+// Call is an API call made by ChainMulticall. Method is the name of the API
+// method, e.g. StateGetActor, and Params are its parameters without the
+// context, as they are sent in a JSON-RPC request.
+type Call struct {
+	Method string
+	Params []json.RawMessage
+}
+
+// MulticallResult holds the results of ChainMulticall, in the order of the
+// calls, and the tipset they were executed against.
+type MulticallResult struct {
+	TipSet  types.TipSetKey
+	Height  abi.ChainEpoch
+	Results []CallResult
+}
+
+// CallResult is the result of a call, or its error
+type CallResult struct {
+	Result json.RawMessage `json:",omitempty"`
+	Error  string          `json:",omitempty"`
+}
+
+// HeightEvent is sent by ChainNotifyAt. Type is 'apply' or 'revert', Height
+// is the height of the tipset, and CurrentHeight the height of the chain when
+// the event was triggered.
+type HeightEvent struct {
+	Type          string
+	TipSet        types.TipSetKey
+	Height        abi.ChainEpoch
+	CurrentHeight abi.ChainEpoch
+}
+
+type MsgExecution struct {
+	Cid     cid.Cid
+	Message *types.Message
+	Receipt types.MessageReceipt
+}
+
+// ChangefeedEntry is a tipset applied to or reverted from the chain, with the
+// CIDs of the objects it adds to or removes from the chain. Type is one of
+// 'apply' or 'revert'.
+type ChangefeedEntry struct {
+	Seq    uint64
+	Type   string
+	TipSet types.TipSetKey
+	Height abi.ChainEpoch
+
+	Blocks   []cid.Cid
+	Messages []cid.Cid
+
+	// ParentState and ParentReceipts are the state and the receipts of the
+	// execution of the parent tipset
+	ParentState    cid.Cid
+	ParentReceipts cid.Cid
+}
+
+// ReorgEvent is a head change reverting tipsets. Depth is the number of
+// epochs between the old head and the common ancestor of the old and new
+// head. Reverted starts at the old head, Applied ends at the new head.
+type ReorgEvent struct {
+	Depth          abi.ChainEpoch
+	OldHead        *types.TipSet
+	NewHead        *types.TipSet
+	CommonAncestor types.TipSetKey
+
+	Reverted []types.TipSetKey
+	Applied  []types.TipSetKey
+
+	// DroppedMessages are the messages of the reverted tipsets which aren't
+	// in the applied tipsets. They may be included again later.
+	DroppedMessages []cid.Cid
+}
+
+// ReorgStats summarizes the reorgs observed since Since
+type ReorgStats struct {
+	Since     time.Time
+	Total     uint64
+	MaxDepth  abi.ChainEpoch
+	MeanDepth float64
+
+	// Histogram counts the reorgs by depth, each bucket holds the reorgs
+	// deeper than the previous bucket, up to MaxDepth. The last bucket has no
+	// MaxDepth, it holds the deeper reorgs.
+	Histogram []ReorgDepthBucket
+
+	// Recent are the latest reorgs, oldest first
+	Recent []ReorgRecord
+}
+
+type ReorgDepthBucket struct {
+	MaxDepth abi.ChainEpoch `json:",omitempty"`
+	Count    uint64
+}
+
+// ReorgRecord describes a reorg. Depth is the number of epochs between the
+// old head and the common ancestor. ForkAge is the time from the timestamp of
+// the first tipset of the dropped fork to the reorg, the node may have
+// received the fork later.
+type ReorgRecord struct {
+	Time  time.Time
+	Depth abi.ChainEpoch
+
+	OldHead   types.TipSetKey
+	OldHeight abi.ChainEpoch
+	OldWeight types.BigInt
+	NewHead   types.TipSetKey
+	NewHeight abi.ChainEpoch
+	NewWeight types.BigInt
+
+	Reverted int
+	Applied  int
+	ForkAge  time.Duration
+}
+
+// UpgradeDryRun describes a state migration run ahead of its upgrade, on the
+// state of an earlier tipset
+type UpgradeDryRun struct {
+	// Height is the height of the upgrade
+	Height abi.ChainEpoch
+	TipSet types.TipSetKey
+	Epoch  abi.ChainEpoch
+
+	StateRoot    cid.Cid
+	NewStateRoot cid.Cid
+
+	Started  time.Time
+	Duration time.Duration
+	Error    string
+}
+
+// CronExecution describes the implicit cron tick run at the end of an epoch.
+// GasUsed is the gas charged to the cron calls, which isn't paid by anyone.
+type CronExecution struct {
+	Epoch    abi.ChainEpoch
+	Duration time.Duration
+	GasUsed  int64
+	ExitCode exitcode.ExitCode
+
+	// Failures are the calls made by cron which failed. The cron actor
+	// ignores them, so they don't fail the tick.
+	Failures []CronFailure
+}
+
+type CronFailure struct {
+	Actor    address.Address
+	Method   abi.MethodNum
+	ExitCode exitcode.ExitCode
+	Error    string
+}
+
+type HeadInfo struct {
+	TipSet *types.TipSet
+	Weight types.BigInt
+
+	// FinalizedHeight is the height at and below which the chain can no
+	// longer be reorganized.
+	FinalizedHeight abi.ChainEpoch
+
+	// EpochsBehind is the number of epochs between the head and the current
+	// epoch derived from the wall clock. A synced node is at most a single
+	// epoch behind.
+	EpochsBehind abi.ChainEpoch
+}
+
 type IpldObject struct {
 	Cid cid.Cid
 	Obj interface{}
@@ -557,6 +1379,30 @@ const (
 	StageSyncErrored
 )
 
+type SyncProgressType string
+
+const (
+	// SyncProgressBlock events carry a candidate block that arrived from the
+	// network, and may not be synced yet.
+	SyncProgressBlock SyncProgressType = "block"
+	// SyncProgressState events carry the updated state of a sync worker.
+	SyncProgressState SyncProgressType = "state"
+)
+
+type SyncProgressEvent struct {
+	Type SyncProgressType
+
+	// Set for SyncProgressBlock events
+	Block *types.BlockHeader `json:",omitempty"`
+
+	// Set for SyncProgressState events
+	Worker int
+	Sync   *ActiveSync `json:",omitempty"`
+	// ETA is the estimated time until the current sync stage completes, zero
+	// when unknown.
+	ETA time.Duration
+}
+
 type MpoolChange int
 
 const (
@@ -564,14 +1410,41 @@ const (
 	MpoolRemove
 )
 
+const (
+	LocalPending  = "pending"
+	LocalStale    = "stale"
+	LocalRejected = "rejected"
+)
+
+// LocalMessage is a persisted local message. Status is one of LocalPending,
+// LocalStale when its nonce was used on chain or by another pending message,
+// or LocalRejected when it couldn't be added back to the pool after a restart.
+type LocalMessage struct {
+	Cid     cid.Cid
+	Message *types.SignedMessage
+	Status  string
+	Error   string `json:",omitempty"`
+}
+
+// MessageSendSpec holds optional parameters of MpoolPushMessage.
+type MessageSendSpec struct {
+	// IdempotencyKey identifies a logical send, e.g. a withdrawal request id.
+	// Retrying a push with the same key and sender doesn't send the message
+	// again as long as the node remembers the key.
+	IdempotencyKey string
+}
+
 type MpoolUpdate struct {
 	Type    MpoolChange
 	Message *types.SignedMessage
 }
 
 type ComputeStateOutput struct {
-	Root  cid.Cid
+	Root cid.Cid
+	// Trace is the execution trace of the tipset the messages were applied on
 	Trace []*InvocResult
+	// Applied are the results of the given messages, in order
+	Applied []*InvocResult
 }
 
 type MiningBaseInfo struct {
@@ -3,11 +3,13 @@ package api
 import (
 	"bytes"
 	"context"
+	"time"
 
 	"github.com/ipfs/go-cid"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/sector-storage/stores"
 	"github.com/filecoin-project/sector-storage/storiface"
@@ -22,8 +24,16 @@ type StorageMiner interface {
 
 	ActorSectorSize(context.Context, address.Address) (abi.SectorSize, error)
 
+	// NetworkParams returns the network parameters the miner runs with, which
+	// workers apply as well
+	NetworkParams(context.Context) (build.NetworkParams, error)
+
 	MiningBase(context.Context) (*types.TipSet, error)
 
+	// MiningReport returns stage timings for the blocks recently mined by
+	// this node.
+	MiningReport(context.Context) ([]MinedBlockTimings, error)
+
 	// Temp api for testing
 	PledgeSector(context.Context) error
 
@@ -38,6 +48,23 @@ type StorageMiner interface {
 	SectorsUpdate(context.Context, abi.SectorNumber, SectorState) error
 	SectorRemove(context.Context, abi.SectorNumber) error
 
+	// SectorsStuck returns the sectors the sealing watchdog found to be stuck
+	// in a sealing phase.
+	SectorsStuck(context.Context) ([]StuckSector, error)
+
+	// SectorsCommitDeadlines returns the sectors which aren't proven yet, with
+	// the epochs by which their precommit and ProveCommit have to land.
+	SectorsCommitDeadlines(context.Context) ([]SectorCommitDeadline, error)
+
+	// SectorsPledgePolicy returns the outcome of the last check of the
+	// policy pledging CC sectors.
+	SectorsPledgePolicy(context.Context) (PledgePolicyStatus, error)
+
+	// SectorsEstimates returns the estimated time at which each sector which
+	// is being sealed will be proving, based on how long the sealing phases
+	// took for previous sectors.
+	SectorsEstimates(context.Context) ([]SectorEstimate, error)
+
 	StorageList(ctx context.Context) (map[stores.ID][]stores.Decl, error)
 	StorageLocal(ctx context.Context) (map[stores.ID]string, error)
 	StorageStat(ctx context.Context, id stores.ID) (stores.FsStat, error)
@@ -46,6 +73,11 @@ type StorageMiner interface {
 	WorkerConnect(context.Context, string) error
 	WorkerStats(context.Context) (map[uint64]storiface.WorkerStats, error)
 
+	// VersionCheck reports the versions of the miner, its full node and the
+	// connected workers, and whether they are compatible with the miner.
+	// Workers with incompatible versions are refused when they connect.
+	VersionCheck(context.Context) ([]ComponentVersion, error)
+
 	stores.SectorIndex
 
 	MarketImportDealData(ctx context.Context, propcid cid.Cid, path string) error
@@ -68,6 +100,58 @@ type StorageMiner interface {
 	DealsSetConsiderOfflineRetrievalDeals(context.Context, bool) error
 
 	StorageAddLocal(ctx context.Context, path string) error
+
+	// StorageCheckSectors checks the sealed sectors in a local path for
+	// problems which would fail PoSt, e.g. before the path is attached. It
+	// checks the file sizes, cache files and on-chain CommRs, but doesn't
+	// read the sealed data.
+	StorageCheckSectors(ctx context.Context, path string) ([]SectorFileIssue, error)
+
+	// MaintenanceStart enables maintenance mode: no new sectors are pledged,
+	// storage deals are rejected and new sealing tasks are held, so that
+	// sealing drains before planned downtime.
+	MaintenanceStart(ctx context.Context, reason string) error
+	MaintenanceStop(ctx context.Context) error
+	// MaintenanceCheckpoint aborts the sealing tasks running on workers while
+	// maintenance mode is enabled, except short packing tasks. Their sectors
+	// are held at the start of the phase, which is run again once
+	// maintenance mode is disabled. It returns the sectors of the aborted
+	// tasks.
+	MaintenanceCheckpoint(ctx context.Context) ([]abi.SectorNumber, error)
+	// MaintenanceStatus reports whether workers can be powered off, and when
+	// the next WindowPoSt deadline the miner has to be running for opens.
+	MaintenanceStatus(ctx context.Context) (MaintenanceStatus, error)
+
+	// MinerBackup writes a backup of the miner metadata (sector and deal
+	// states) to a file on the miner machine. The backup can be restored
+	// with 'lotus-storage-miner init restore'. Private keys aren't included.
+	MinerBackup(ctx context.Context, path string) error
+}
+
+// SectorFileIssue is a problem found with a sealed sector file
+type SectorFileIssue struct {
+	File   string
+	Sector abi.SectorNumber
+	Issue  string
+}
+
+// MinedBlockTimings describes how long producing a block took. Stage times are
+// measured from the start of the epoch the block was mined for, and are
+// negative for stages completed before the epoch started.
+type MinedBlockTimings struct {
+	Block      cid.Cid
+	Height     abi.ChainEpoch
+	EpochStart time.Time
+
+	Start     time.Duration
+	Proof     time.Duration
+	Messages  time.Duration
+	Created   time.Duration
+	Published time.Duration
+
+	// Late is set when the block was published after the propagation cutoff,
+	// so other miners were likely to ignore it.
+	Late bool
 }
 
 type SealRes struct {
@@ -102,6 +186,152 @@ type SectorInfo struct {
 	Log []SectorLog
 }
 
+// StuckSector is a sector which spent much longer in a sealing phase than
+// expected.
+type StuckSector struct {
+	SectorID abi.SectorNumber
+	State    SectorState
+	Since    time.Time
+	Expected time.Duration
+
+	// Retries counts how often the watchdog restarted the current phase
+	Retries int
+	// Action is the last action the watchdog took on the sector, if any
+	Action string
+}
+
+// SectorCommitDeadline tracks the ticket of a sector which isn't proven yet,
+// and the epochs by which its commitment messages have to land.
+type SectorCommitDeadline struct {
+	SectorID    abi.SectorNumber
+	State       SectorState
+	TicketEpoch abi.ChainEpoch
+	// Height is the chain height the deadlines were checked at
+	Height abi.ChainEpoch
+
+	// PreCommitDeadline is the last epoch the precommit can land at before
+	// the ticket is too old
+	PreCommitDeadline abi.ChainEpoch
+	// PreCommitEpoch is the epoch the precommit landed at, zero if it didn't
+	PreCommitEpoch abi.ChainEpoch
+	// ProveCommitDeadline is the last epoch the ProveCommit can land at, zero
+	// until the precommit landed
+	ProveCommitDeadline abi.ChainEpoch
+	// Deposit is the precommit deposit lost when the ProveCommit deadline is
+	// missed
+	Deposit types.BigInt
+
+	AtRisk  bool
+	Expired bool
+	// Action is the last action taken on the sector, if any
+	Action string
+}
+
+// Deadline returns the deadline of the next commitment message
+func (s *SectorCommitDeadline) Deadline() abi.ChainEpoch {
+	if s.PreCommitEpoch != 0 {
+		return s.ProveCommitDeadline
+	}
+	return s.PreCommitDeadline
+}
+
+// PledgePolicyStatus describes the last check of the pledge policy
+type PledgePolicyStatus struct {
+	LastCheck time.Time
+	// Pledged is set when the check pledged a CC sector, otherwise Reason
+	// tells why it didn't
+	Pledged bool
+	Reason  string
+
+	SealingCC    int
+	SealingDeals int
+	Proving      int
+	// PendingPledges are CC sectors pledged, which the sealing pipeline
+	// doesn't list yet. They are counted in SealingCC.
+	PendingPledges int
+	// Failed is the number of sectors failed for longer than the grace
+	// period, which aren't counted as sealing
+	Failed int
+
+	MaxSealing   int
+	MaxSealingCC int
+	MaxSectors   int
+
+	// BudgetUsed is the number of CC sectors pledged in the current budget
+	// period
+	BudgetUsed int
+	Budget     int
+}
+
+// MaintenanceStatus describes the progress of draining the miner for planned
+// downtime.
+type MaintenanceStatus struct {
+	Enabled bool
+	Since   time.Time
+	Reason  string
+
+	// Busy lists the sectors with sealing tasks running on workers
+	Busy []MaintenanceSector
+	// Waiting lists the sectors being sealed which wait for the chain or a
+	// retry, e.g. in WaitSeed, before their next task needs a worker
+	Waiting []MaintenanceSector
+	// Held lists the sectors with a sealing task held until maintenance mode
+	// is disabled
+	Held []MaintenanceSector
+	// BusyWorkers lists the workers the scheduler still runs tasks on
+	BusyWorkers []MaintenanceWorker
+	// Drained is set when maintenance mode is enabled, every sector being
+	// sealed is held and no tasks are left on workers; workers can be
+	// powered off
+	Drained bool
+
+	// HasPoSt is false if the miner has no sectors to prove. Otherwise
+	// NextPoStOpen is the epoch the next deadline with sectors opens at, and
+	// PoStIn is the time until then, zero if it's open already.
+	HasPoSt          bool
+	NextPoStDeadline uint64
+	NextPoStOpen     abi.ChainEpoch
+	PoStIn           time.Duration
+}
+
+type MaintenanceSector struct {
+	SectorID abi.SectorNumber
+	State    SectorState
+}
+
+type MaintenanceWorker struct {
+	ID       uint64
+	Hostname string
+}
+
+// SectorEstimate is the estimated completion time of a sector being sealed.
+type SectorEstimate struct {
+	SectorID   abi.SectorNumber
+	State      SectorState
+	PhaseSince time.Time
+
+	// PhaseRemaining is the expected time until the current phase completes
+	PhaseRemaining time.Duration
+	ETA            time.Time
+
+	// FromHistory is false if the durations of some of the remaining phases
+	// weren't observed yet, and defaults were used
+	FromHistory bool
+	// WorkerClass is the class of the remote worker which ran the last task
+	// of the sector, empty if no remote worker ran any
+	WorkerClass string
+}
+
+// ComponentVersion is the version of a component of the miner deployment
+type ComponentVersion struct {
+	Component string
+	Version   Version
+
+	// Incompatible explains why the component can't work with the miner,
+	// it's empty for compatible components
+	Incompatible string
+}
+
 type SealedRef struct {
 	SectorID abi.SectorNumber
 	Offset   uint64
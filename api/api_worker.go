@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 
+	"github.com/google/uuid"
 	"github.com/ipfs/go-cid"
 
 	"github.com/filecoin-project/sector-storage/sealtasks"
@@ -17,6 +18,9 @@ import (
 
 type WorkerAPI interface {
 	Version(context.Context) (build.Version, error)
+	// VersionInfo returns the full version of the worker build, which the
+	// miner checks for compatibility
+	VersionInfo(context.Context) (Version, error)
 	// TODO: Info() (name, ...) ?
 
 	TaskTypes(context.Context) (map[sealtasks.TaskType]struct{}, error) // TaskType -> Weight
@@ -33,4 +37,9 @@ type WorkerAPI interface {
 	Fetch(context.Context, abi.SectorID, stores.SectorFileType, stores.PathType, stores.AcquireMode) error
 
 	Closing(context.Context) (<-chan struct{}, error)
+
+	// Session returns an ID which stays the same across restarts of the
+	// worker, so that a worker reconnecting after a disconnect can be
+	// recognised.
+	Session(context.Context) (uuid.UUID, error)
 }
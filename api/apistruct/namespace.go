@@ -0,0 +1,310 @@
+package apistruct
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type namespaceKey struct{}
+
+type tokenIDKey struct{}
+
+// WithNamespace binds the token namespace to the context of a request
+func WithNamespace(ctx context.Context, ns *api.TokenNamespace) context.Context {
+	return context.WithValue(ctx, namespaceKey{}, ns)
+}
+
+// NamespaceFromContext returns the namespace of the token the request was
+// made with, or nil if the token isn't bound to one.
+func NamespaceFromContext(ctx context.Context) *api.TokenNamespace {
+	ns, _ := ctx.Value(namespaceKey{}).(*api.TokenNamespace)
+	return ns
+}
+
+// TokenID returns the identifier of an API token, which can be logged
+// without disclosing the token
+func TokenID(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:8])
+}
+
+// TokenIDFromContext returns the identifier of the token the request was made
+// with, or an empty string for requests made without a token.
+func TokenIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(tokenIDKey{}).(string)
+	return id
+}
+
+type NamespaceFunc func(ctx context.Context, token string) (*api.TokenNamespace, error)
+
+// NamespaceHandler binds the namespace and the identifier of the request
+// token to the request context. It's meant to run after auth.Handler
+// verified the token.
+func NamespaceHandler(verify NamespaceFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			token = r.FormValue("token")
+		} else {
+			token = strings.TrimPrefix(token, "Bearer ")
+		}
+		if token == "" {
+			next(w, r)
+			return
+		}
+
+		ns, err := verify(r.Context(), token)
+		if err != nil {
+			w.WriteHeader(401)
+			return
+		}
+		ctx := context.WithValue(r.Context(), tokenIDKey{}, TokenID(token))
+		if ns != nil {
+			ctx = WithNamespace(ctx, ns)
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// NamespacedFullAPI restricts calls made with namespaced tokens to the
+// wallets and miners of the namespace. Methods which only read are allowed,
+// admin methods are refused. Methods which write or sign are refused too,
+// unless they're overridden by namespacedFullNode, which checks what they
+// act on.
+//
+// Calls made with tokens which aren't namespaced are passed through.
+func NamespacedFullAPI(a api.FullNode) api.FullNode {
+	var out FullNodeStruct
+	nsa := &namespacedFullNode{FullNode: a}
+	namespacedProxy(nsa, &out.Internal)
+	namespacedProxy(nsa, &out.CommonStruct.Internal)
+	return &out
+}
+
+// namespacedMethods are the write and sign methods namespaced tokens can
+// call, they are checked by namespacedFullNode
+var namespacedMethods = map[string]bool{
+	"MpoolPush":             true,
+	"MpoolPushMessage":      true,
+	"WalletHas":             true,
+	"WalletList":            true,
+	"WalletSign":            true,
+	"WalletSignMessage":     true,
+	"WalletDefaultAddress":  true,
+	"MarketEnsureAvailable": true,
+	"PaychGet":              true,
+	"PaychNewPayment":       true,
+	"MsigCreate":            true,
+	"MsigPropose":           true,
+	"MsigApprove":           true,
+	"MsigCancel":            true,
+	"SyncSubmitBlock":       true,
+	"MinerCreateBlock":      true,
+}
+
+var errorType = reflect.TypeOf(new(error)).Elem()
+
+func namespacedProxy(in interface{}, out interface{}) {
+	rint := reflect.ValueOf(out).Elem()
+	ra := reflect.ValueOf(in)
+
+	for f := 0; f < rint.NumField(); f++ {
+		field := rint.Type().Field(f)
+		fn := ra.MethodByName(field.Name)
+		if !fn.IsValid() {
+			continue
+		}
+
+		perm := field.Tag.Get("perm")
+		restricted := perm != string(PermRead) && !namespacedMethods[field.Name]
+		name := field.Name
+
+		rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) (results []reflect.Value) {
+			ctx := args[0].Interface().(context.Context)
+			if !restricted || NamespaceFromContext(ctx) == nil {
+				return fn.Call(args)
+			}
+
+			err := xerrors.Errorf("method %s can't be called with a namespaced token", name)
+			rerr := reflect.ValueOf(&err).Elem()
+
+			out := make([]reflect.Value, field.Type.NumOut())
+			for i := range out {
+				if field.Type.Out(i) == errorType {
+					out[i] = rerr
+					continue
+				}
+				out[i] = reflect.Zero(field.Type.Out(i))
+			}
+			return out
+		}))
+	}
+}
+
+// namespacedFullNode checks the calls of namespacedMethods made with
+// namespaced tokens
+type namespacedFullNode struct {
+	api.FullNode
+}
+
+func checkWallet(ctx context.Context, a address.Address) error {
+	ns := NamespaceFromContext(ctx)
+	if ns != nil && !ns.HasWallet(a) {
+		return xerrors.Errorf("wallet %s is not in the namespace of the token", a)
+	}
+	return nil
+}
+
+func checkMiner(ctx context.Context, a address.Address) error {
+	ns := NamespaceFromContext(ctx)
+	if ns != nil && !ns.HasMiner(a) {
+		return xerrors.Errorf("miner %s is not in the namespace of the token", a)
+	}
+	return nil
+}
+
+func (n *namespacedFullNode) MpoolPush(ctx context.Context, smsg *types.SignedMessage) (cid.Cid, error) {
+	if err := checkWallet(ctx, smsg.Message.From); err != nil {
+		return cid.Undef, err
+	}
+	return n.FullNode.MpoolPush(ctx, smsg)
+}
+
+func (n *namespacedFullNode) MpoolPushMessage(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (*types.SignedMessage, error) {
+	if err := checkWallet(ctx, msg.From); err != nil {
+		return nil, err
+	}
+	return n.FullNode.MpoolPushMessage(ctx, msg, spec)
+}
+
+func (n *namespacedFullNode) WalletHas(ctx context.Context, a address.Address) (bool, error) {
+	if checkWallet(ctx, a) != nil {
+		return false, nil
+	}
+	return n.FullNode.WalletHas(ctx, a)
+}
+
+// WalletList only lists the wallets of the namespace
+func (n *namespacedFullNode) WalletList(ctx context.Context) ([]address.Address, error) {
+	addrs, err := n.FullNode.WalletList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ns := NamespaceFromContext(ctx)
+	if ns == nil {
+		return addrs, nil
+	}
+
+	out := make([]address.Address, 0, len(ns.Wallets))
+	for _, a := range addrs {
+		if ns.HasWallet(a) {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (n *namespacedFullNode) WalletSign(ctx context.Context, k address.Address, msg []byte) (*crypto.Signature, error) {
+	if err := checkWallet(ctx, k); err != nil {
+		return nil, err
+	}
+	return n.FullNode.WalletSign(ctx, k, msg)
+}
+
+func (n *namespacedFullNode) WalletSignMessage(ctx context.Context, k address.Address, msg *types.Message) (*types.SignedMessage, error) {
+	if err := checkWallet(ctx, k); err != nil {
+		return nil, err
+	}
+	return n.FullNode.WalletSignMessage(ctx, k, msg)
+}
+
+// WalletDefaultAddress returns the first wallet of the namespace, as the
+// default wallet of the node belongs to its operator
+func (n *namespacedFullNode) WalletDefaultAddress(ctx context.Context) (address.Address, error) {
+	ns := NamespaceFromContext(ctx)
+	if ns == nil {
+		return n.FullNode.WalletDefaultAddress(ctx)
+	}
+	if len(ns.Wallets) == 0 {
+		return address.Undef, xerrors.New("the namespace of the token has no wallets")
+	}
+	return ns.Wallets[0], nil
+}
+
+func (n *namespacedFullNode) MarketEnsureAvailable(ctx context.Context, addr, wallet address.Address, amt types.BigInt) (cid.Cid, error) {
+	if err := checkWallet(ctx, wallet); err != nil {
+		return cid.Undef, err
+	}
+	return n.FullNode.MarketEnsureAvailable(ctx, addr, wallet, amt)
+}
+
+func (n *namespacedFullNode) PaychGet(ctx context.Context, from, to address.Address, ensureFunds types.BigInt) (*api.ChannelInfo, error) {
+	if err := checkWallet(ctx, from); err != nil {
+		return nil, err
+	}
+	return n.FullNode.PaychGet(ctx, from, to, ensureFunds)
+}
+
+func (n *namespacedFullNode) PaychNewPayment(ctx context.Context, from, to address.Address, vouchers []api.VoucherSpec) (*api.PaymentInfo, error) {
+	if err := checkWallet(ctx, from); err != nil {
+		return nil, err
+	}
+	return n.FullNode.PaychNewPayment(ctx, from, to, vouchers)
+}
+
+func (n *namespacedFullNode) MsigCreate(ctx context.Context, req int64, addrs []address.Address, duration abi.ChainEpoch, val types.BigInt, src address.Address, gp types.BigInt) (cid.Cid, error) {
+	if err := checkWallet(ctx, src); err != nil {
+		return cid.Undef, err
+	}
+	return n.FullNode.MsigCreate(ctx, req, addrs, duration, val, src, gp)
+}
+
+func (n *namespacedFullNode) MsigPropose(ctx context.Context, msig address.Address, to address.Address, amt types.BigInt, src address.Address, method uint64, params []byte) (cid.Cid, error) {
+	if err := checkWallet(ctx, src); err != nil {
+		return cid.Undef, err
+	}
+	return n.FullNode.MsigPropose(ctx, msig, to, amt, src, method, params)
+}
+
+func (n *namespacedFullNode) MsigApprove(ctx context.Context, msig address.Address, txID uint64, proposer address.Address, to address.Address, amt types.BigInt, src address.Address, method uint64, params []byte) (cid.Cid, error) {
+	if err := checkWallet(ctx, src); err != nil {
+		return cid.Undef, err
+	}
+	return n.FullNode.MsigApprove(ctx, msig, txID, proposer, to, amt, src, method, params)
+}
+
+func (n *namespacedFullNode) MsigCancel(ctx context.Context, msig address.Address, txID uint64, to address.Address, amt types.BigInt, src address.Address, method uint64, params []byte) (cid.Cid, error) {
+	if err := checkWallet(ctx, src); err != nil {
+		return cid.Undef, err
+	}
+	return n.FullNode.MsigCancel(ctx, msig, txID, to, amt, src, method, params)
+}
+
+func (n *namespacedFullNode) SyncSubmitBlock(ctx context.Context, blk *types.BlockMsg) error {
+	if err := checkMiner(ctx, blk.Header.Miner); err != nil {
+		return err
+	}
+	return n.FullNode.SyncSubmitBlock(ctx, blk)
+}
+
+func (n *namespacedFullNode) MinerCreateBlock(ctx context.Context, bt *api.BlockTemplate) (*types.BlockMsg, error) {
+	if err := checkMiner(ctx, bt.Miner); err != nil {
+		return nil, err
+	}
+	return n.FullNode.MinerCreateBlock(ctx, bt)
+}
@@ -0,0 +1,220 @@
+package apistruct
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func testNamespaceNode(wallets []address.Address) api.FullNode {
+	var a FullNodeStruct
+	a.Internal.ChainHead = func(context.Context) (*types.TipSet, error) {
+		return nil, nil
+	}
+	a.Internal.WalletList = func(context.Context) ([]address.Address, error) {
+		return wallets, nil
+	}
+	a.Internal.WalletSign = func(context.Context, address.Address, []byte) (*crypto.Signature, error) {
+		return &crypto.Signature{}, nil
+	}
+	a.Internal.MpoolPush = func(_ context.Context, smsg *types.SignedMessage) (cid.Cid, error) {
+		return smsg.Cid(), nil
+	}
+	a.Internal.SyncSubmitBlock = func(context.Context, *types.BlockMsg) error {
+		return nil
+	}
+	a.CommonStruct.Internal.AuthNew = func(context.Context, []auth.Permission) ([]byte, error) {
+		return []byte("token"), nil
+	}
+	a.CommonStruct.Internal.NetConnect = func(context.Context, peer.AddrInfo) error {
+		return nil
+	}
+	return NamespacedFullAPI(&a)
+}
+
+func TestNamespacedFullAPI(t *testing.T) {
+	w1, err := address.NewIDAddress(1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := address.NewIDAddress(1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, err := address.NewIDAddress(2001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := address.NewIDAddress(2002)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := testNamespaceNode([]address.Address{w1, w2})
+	ctx := context.Background()
+	nsctx := WithNamespace(ctx, &api.TokenNamespace{
+		Wallets: []address.Address{w1},
+		Miners:  []address.Address{m1},
+	})
+
+	// tokens without a namespace are passed through
+	if _, err := a.WalletSign(ctx, w2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.AuthNew(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.NetConnect(ctx, peer.AddrInfo{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// read methods can be called
+	if _, err := a.ChainHead(nsctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// admin and write methods which aren't checked are refused
+	if _, err := a.AuthNew(nsctx, nil); err == nil {
+		t.Fatal("expected an admin method to be refused")
+	}
+	if err := a.NetConnect(nsctx, peer.AddrInfo{}); err == nil {
+		t.Fatal("expected an unchecked write method to be refused")
+	}
+
+	// checked methods only act on the namespace
+	if _, err := a.WalletSign(nsctx, w1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.WalletSign(nsctx, w2, nil); err == nil {
+		t.Fatal("expected signing with a wallet outside of the namespace to be refused")
+	}
+	if _, err := a.MpoolPush(nsctx, &types.SignedMessage{Message: types.Message{From: w2}}); err == nil {
+		t.Fatal("expected pushing a message from a wallet outside of the namespace to be refused")
+	}
+	if err := a.SyncSubmitBlock(nsctx, &types.BlockMsg{Header: &types.BlockHeader{Miner: m1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SyncSubmitBlock(nsctx, &types.BlockMsg{Header: &types.BlockHeader{Miner: m2}}); err == nil {
+		t.Fatal("expected submitting a block of a miner outside of the namespace to be refused")
+	}
+
+	addrs, err := a.WalletList(nsctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != w1 {
+		t.Fatalf("expected only the wallet of the namespace to be listed, got %v", addrs)
+	}
+	def, err := a.WalletDefaultAddress(nsctx)
+	if err != nil || def != w1 {
+		t.Fatalf("expected the default wallet to be %s, got %s (%v)", w1, def, err)
+	}
+}
+
+func TestNamespacedMethods(t *testing.T) {
+	// the methods namespacedFullNode implements itself, the others are
+	// promoted from the wrapped node, and aren't checked
+	f, err := parser.ParseFile(token.NewFileSet(), "namespace.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked := map[string]bool{}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil {
+			continue
+		}
+		if star, ok := fn.Recv.List[0].Type.(*ast.StarExpr); ok {
+			if id, ok := star.X.(*ast.Ident); ok && id.Name == "namespacedFullNode" {
+				checked[fn.Name.Name] = true
+			}
+		}
+	}
+
+	for method := range namespacedMethods {
+		perm, ok := FullNodeMethodPerm(method)
+		if !ok {
+			t.Errorf("%s isn't a full node method", method)
+			continue
+		}
+		if perm == PermRead {
+			t.Errorf("%s can be called by read tokens, it doesn't need to be checked", method)
+		}
+		if !checked[method] {
+			t.Errorf("%s isn't checked by namespacedFullNode", method)
+		}
+	}
+
+	if perm, _ := FullNodeMethodPerm("AuthVerifyNamespace"); perm != PermAdmin {
+		t.Errorf("expected AuthVerifyNamespace to need the admin permission, got %q", perm)
+	}
+}
+
+func TestNamespaceHandler(t *testing.T) {
+	w1, err := address.NewIDAddress(1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := &api.TokenNamespace{Wallets: []address.Address{w1}}
+
+	verify := func(_ context.Context, token string) (*api.TokenNamespace, error) {
+		switch token {
+		case "namespaced":
+			return ns, nil
+		case "plain":
+			return nil, nil
+		default:
+			return nil, xerrors.New("invalid token")
+		}
+	}
+
+	for _, tc := range []struct {
+		token  string
+		status int
+		ns     bool
+	}{
+		{"", http.StatusOK, false},
+		{"plain", http.StatusOK, false},
+		{"namespaced", http.StatusOK, true},
+		{"invalid", http.StatusUnauthorized, false},
+	} {
+		var got *api.TokenNamespace
+		var id string
+		h := NamespaceHandler(verify, func(w http.ResponseWriter, r *http.Request) {
+			got = NamespaceFromContext(r.Context())
+			id = TokenIDFromContext(r.Context())
+		})
+
+		req := httptest.NewRequest("POST", "/rpc/v0", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+
+		if rec.Code != tc.status {
+			t.Errorf("%q: expected status %d, got %d", tc.token, tc.status, rec.Code)
+		}
+		if (got != nil) != tc.ns {
+			t.Errorf("%q: expected a namespace to be bound: %t", tc.token, tc.ns)
+		}
+		if tc.status == http.StatusOK && tc.token != "" && id != TokenID(tc.token) {
+			t.Errorf("%q: expected the token id to be bound", tc.token)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package apistruct
 
 import (
+	"context"
+	"reflect"
+
 	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/filecoin-project/lotus/api"
 )
@@ -17,6 +20,20 @@ const (
 var AllPermissions = []auth.Permission{PermRead, PermWrite, PermSign, PermAdmin}
 var DefaultPerms = []auth.Permission{PermRead}
 
+type VerifyFunc func(ctx context.Context, token string) ([]auth.Permission, error)
+
+// ReadOnlyVerify limits the permissions granted by any token to PermRead, so
+// that no method which changes node state can be called, even with an admin
+// token.
+func ReadOnlyVerify(verify VerifyFunc) VerifyFunc {
+	return func(ctx context.Context, token string) ([]auth.Permission, error) {
+		if _, err := verify(ctx, token); err != nil {
+			return nil, err
+		}
+		return []auth.Permission{PermRead}, nil
+	}
+}
+
 func PermissionedStorMinerAPI(a api.StorageMiner) api.StorageMiner {
 	var out StorageMinerStruct
 	auth.PermissionedProxy(AllPermissions, DefaultPerms, a, &out.Internal)
@@ -36,3 +53,17 @@ func PermissionedWorkerAPI(a api.WorkerAPI) api.WorkerAPI {
 	auth.PermissionedProxy(AllPermissions, DefaultPerms, a, &out.Internal)
 	return &out
 }
+
+// FullNodeMethodPerm returns the permission required to call a FullNode
+// method, false if there is no such method.
+func FullNodeMethodPerm(method string) (auth.Permission, bool) {
+	for _, t := range []reflect.Type{
+		reflect.TypeOf(FullNodeStruct{}.Internal),
+		reflect.TypeOf(CommonStruct{}.Internal),
+	} {
+		if f, ok := t.FieldByName(method); ok {
+			return auth.Permission(f.Tag.Get("perm")), true
+		}
+	}
+	return "", false
+}
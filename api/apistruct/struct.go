@@ -3,7 +3,9 @@ package apistruct
 import (
 	"context"
 	"io"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -36,13 +38,17 @@ type CommonStruct struct {
 		AuthVerify func(ctx context.Context, token string) ([]auth.Permission, error) `perm:"read"`
 		AuthNew    func(ctx context.Context, perms []auth.Permission) ([]byte, error) `perm:"admin"`
 
-		NetConnectedness func(context.Context, peer.ID) (network.Connectedness, error) `perm:"read"`
-		NetPeers         func(context.Context) ([]peer.AddrInfo, error)                `perm:"read"`
-		NetConnect       func(context.Context, peer.AddrInfo) error                    `perm:"write"`
-		NetAddrsListen   func(context.Context) (peer.AddrInfo, error)                  `perm:"read"`
-		NetDisconnect    func(context.Context, peer.ID) error                          `perm:"write"`
-		NetFindPeer      func(context.Context, peer.ID) (peer.AddrInfo, error)         `perm:"read"`
-		NetPubsubScores  func(context.Context) ([]api.PubsubScore, error)              `perm:"read"`
+		AuthNewNamespaced   func(ctx context.Context, perms []auth.Permission, ns api.TokenNamespace) ([]byte, error) `perm:"admin"`
+		AuthVerifyNamespace func(ctx context.Context, token string) (*api.TokenNamespace, error)                      `perm:"admin"`
+
+		NetConnectedness  func(context.Context, peer.ID) (network.Connectedness, error) `perm:"read"`
+		NetPeers          func(context.Context) ([]peer.AddrInfo, error)                `perm:"read"`
+		NetConnect        func(context.Context, peer.AddrInfo) error                    `perm:"write"`
+		NetAddrsListen    func(context.Context) (peer.AddrInfo, error)                  `perm:"read"`
+		NetDisconnect     func(context.Context, peer.ID) error                          `perm:"write"`
+		NetFindPeer       func(context.Context, peer.ID) (peer.AddrInfo, error)         `perm:"read"`
+		NetPubsubScores   func(context.Context) ([]api.PubsubScore, error)              `perm:"read"`
+		NetProtocolCensus func(context.Context) (*api.ProtocolCensus, error)            `perm:"read"`
 
 		ID      func(context.Context) (peer.ID, error)     `perm:"read"`
 		Version func(context.Context) (api.Version, error) `perm:"read"`
@@ -50,6 +56,8 @@ type CommonStruct struct {
 		LogList     func(context.Context) ([]string, error)     `perm:"write"`
 		LogSetLevel func(context.Context, string, string) error `perm:"write"`
 
+		JournalQuery func(context.Context, api.JournalQuery) ([]api.JournalEntry, error) `perm:"read"`
+
 		Shutdown func(context.Context) error                    `perm:"admin"`
 		Closing  func(context.Context) (<-chan struct{}, error) `perm:"read"`
 	}
@@ -61,7 +69,14 @@ type FullNodeStruct struct {
 
 	Internal struct {
 		ChainNotify            func(context.Context) (<-chan []*api.HeadChange, error)                                                            `perm:"read"`
+		ChainNotifyReorgs      func(context.Context) (<-chan *api.ReorgEvent, error)                                                              `perm:"read"`
+		ChainReorgStats        func(context.Context) (*api.ReorgStats, error)                                                                     `perm:"read"`
+		ChainSubscribeEvents   func(context.Context, api.EventFilter) (<-chan *api.ChainEvent, error)                                             `perm:"read"`
+		ChainNotifyAt          func(context.Context, abi.ChainEpoch, uint64) (<-chan *api.HeightEvent, error)                                     `perm:"read"`
+		ChainChangefeed        func(context.Context, uint64) (<-chan *api.ChangefeedEntry, error)                                                 `perm:"read"`
+		ChainMulticall         func(context.Context, types.TipSetKey, []api.Call) (*api.MulticallResult, error)                                   `perm:"read"`
 		ChainHead              func(context.Context) (*types.TipSet, error)                                                                       `perm:"read"`
+		ChainHeadInfo          func(context.Context) (*api.HeadInfo, error)                                                                       `perm:"read"`
 		ChainGetRandomness     func(context.Context, types.TipSetKey, crypto.DomainSeparationTag, abi.ChainEpoch, []byte) (abi.Randomness, error) `perm:"read"`
 		ChainGetBlock          func(context.Context, cid.Cid) (*types.BlockHeader, error)                                                         `perm:"read"`
 		ChainGetTipSet         func(context.Context, types.TipSetKey) (*types.TipSet, error)                                                      `perm:"read"`
@@ -78,20 +93,39 @@ type FullNodeStruct struct {
 		ChainGetNode           func(ctx context.Context, p string) (*api.IpldObject, error)                                                       `perm:"read"`
 		ChainGetMessage        func(context.Context, cid.Cid) (*types.Message, error)                                                             `perm:"read"`
 		ChainGetPath           func(context.Context, types.TipSetKey, types.TipSetKey) ([]*api.HeadChange, error)                                 `perm:"read"`
-		ChainExport            func(context.Context, types.TipSetKey) (<-chan []byte, error)                                                      `perm:"read"`
-
-		SyncState          func(context.Context) (*api.SyncState, error)                `perm:"read"`
-		SyncSubmitBlock    func(ctx context.Context, blk *types.BlockMsg) error         `perm:"write"`
-		SyncIncomingBlocks func(ctx context.Context) (<-chan *types.BlockHeader, error) `perm:"read"`
-		SyncMarkBad        func(ctx context.Context, bcid cid.Cid) error                `perm:"admin"`
-		SyncCheckBad       func(ctx context.Context, bcid cid.Cid) (string, error)      `perm:"read"`
+		ChainExport            func(ctx context.Context, tsk types.TipSetKey, opts api.ChainExportOptions) (<-chan []byte, error)                 `perm:"read"`
+		ChainFetchSnapshot     func(ctx context.Context, p peer.AddrInfo) (types.TipSetKey, error)                                                `perm:"admin"`
+		ChainImport            func(ctx context.Context, path string, trusted bool) (types.TipSetKey, error)                                      `perm:"admin"`
+		ChainVerify            func(context.Context, api.ChainVerifyOptions) (*api.ChainVerifyReport, error)                                      `perm:"admin"`
+		ChainPrune             func(ctx context.Context, keepStateRoots abi.ChainEpoch, dryRun bool) (*api.ChainPruneReport, error)               `perm:"admin"`
+		ChainReorgJournal      func(context.Context) ([]api.ReorgJournalEntry, error)                                                             `perm:"read"`
+		ChainReplayReorg       func(context.Context, uint64) error                                                                                `perm:"admin"`
+
+		SyncState          func(context.Context) (*api.SyncState, error)                   `perm:"read"`
+		SyncSubmitBlock    func(ctx context.Context, blk *types.BlockMsg) error            `perm:"write"`
+		SyncIncomingBlocks func(ctx context.Context) (<-chan *types.BlockHeader, error)    `perm:"read"`
+		SyncProgress       func(ctx context.Context) (<-chan api.SyncProgressEvent, error) `perm:"read"`
+		SyncMarkBad        func(ctx context.Context, bcid cid.Cid) error                   `perm:"admin"`
+		SyncCheckBad       func(ctx context.Context, bcid cid.Cid) (string, error)         `perm:"read"`
+		NetBlocksyncPeers  func(context.Context) ([]api.BlocksyncPeer, error)              `perm:"read"`
+		SyncPeerHealth     func(context.Context) ([]api.PeerHealth, error)                 `perm:"read"`
+		SyncCheckpoint     func(ctx context.Context, tsk types.TipSetKey) error            `perm:"admin"`
 
 		MpoolPending          func(context.Context, types.TipSetKey) ([]*types.SignedMessage, error)                       `perm:"read"`
 		MpoolPush             func(context.Context, *types.SignedMessage) (cid.Cid, error)                                 `perm:"write"`
-		MpoolPushMessage      func(context.Context, *types.Message) (*types.SignedMessage, error)                          `perm:"sign"`
+		MpoolPushMessage      func(context.Context, *types.Message, *api.MessageSendSpec) (*types.SignedMessage, error)    `perm:"sign"`
 		MpoolGetNonce         func(context.Context, address.Address) (uint64, error)                                       `perm:"read"`
 		MpoolSub              func(context.Context) (<-chan api.MpoolUpdate, error)                                        `perm:"read"`
+		MpoolReplace          func(context.Context, address.Address, uint64, types.BigInt) (*types.SignedMessage, error)   `perm:"sign"`
+		MpoolCancel           func(context.Context, address.Address, uint64) (*types.SignedMessage, error)                 `perm:"sign"`
+		MpoolLocal            func(context.Context) ([]api.LocalMessage, error)                                            `perm:"read"`
+		MpoolPurgeLocal       func(context.Context) (int, error)                                                           `perm:"write"`
 		MpoolEstimateGasPrice func(context.Context, uint64, address.Address, int64, types.TipSetKey) (types.BigInt, error) `perm:"read"`
+		MpoolAuditExport      func(context.Context, time.Time, time.Time) ([]api.MessageAuditRecord, error)                `perm:"admin"`
+
+		GasEstimateGasPrice func(context.Context, uint64, address.Address, int64, types.TipSetKey) (types.BigInt, error) `perm:"read"`
+		GasPricePercentiles func(context.Context, uint64, []float64, types.TipSetKey) ([]types.BigInt, error)            `perm:"read"`
+		GasEstimateGasLimit func(context.Context, *types.Message, types.TipSetKey) (*api.GasEstimate, error)             `perm:"read"`
 
 		MinerGetBaseInfo func(context.Context, address.Address, abi.ChainEpoch, types.TipSetKey) (*api.MiningBaseInfo, error) `perm:"read"`
 		MinerCreateBlock func(context.Context, *api.BlockTemplate) (*types.BlockMsg, error)                                   `perm:"write"`
@@ -120,9 +154,11 @@ type FullNodeStruct struct {
 		ClientRetrieve        func(ctx context.Context, order api.RetrievalOrder, ref *api.FileRef) error                          `perm:"admin"`
 		ClientQueryAsk        func(ctx context.Context, p peer.ID, miner address.Address) (*storagemarket.SignedStorageAsk, error) `perm:"read"`
 		ClientCalcCommP       func(ctx context.Context, inpath string, miner address.Address) (*api.CommPRet, error)               `perm:"read"`
+		ClientExtract         func(ctx context.Context, inpath string, payload cid.Cid, outdir string) (*api.ExtractResult, error) `perm:"write"`
 		ClientGenCar          func(ctx context.Context, ref api.FileRef, outpath string) error                                     `perm:"write"`
 
 		StateNetworkName                  func(context.Context) (dtypes.NetworkName, error)                                                                   `perm:"read"`
+		StateNetworkParams                func(context.Context) (build.NetworkParams, error)                                                                  `perm:"read"`
 		StateMinerSectors                 func(context.Context, address.Address, *abi.BitField, bool, types.TipSetKey) ([]*api.ChainSectorInfo, error)        `perm:"read"`
 		StateMinerProvingSet              func(context.Context, address.Address, types.TipSetKey) ([]*api.ChainSectorInfo, error)                             `perm:"read"`
 		StateMinerProvingDeadline         func(context.Context, address.Address, types.TipSetKey) (*miner.DeadlineInfo, error)                                `perm:"read"`
@@ -137,7 +173,9 @@ type FullNodeStruct struct {
 		StateSectorPreCommitInfo          func(context.Context, address.Address, abi.SectorNumber, types.TipSetKey) (miner.SectorPreCommitOnChainInfo, error) `perm:"read"`
 		StateSectorGetInfo                func(context.Context, address.Address, abi.SectorNumber, types.TipSetKey) (*miner.SectorOnChainInfo, error)         `perm:"read"`
 		StateCall                         func(context.Context, *types.Message, types.TipSetKey) (*api.InvocResult, error)                                    `perm:"read"`
+		StateDryRun                       func(context.Context, *types.Message, types.TipSetKey) (*api.InvocResult, error)                                    `perm:"read"`
 		StateReplay                       func(context.Context, types.TipSetKey, cid.Cid) (*api.InvocResult, error)                                           `perm:"read"`
+		StateActorMethods                 func(context.Context) ([]api.ActorMethods, error)                                                                   `perm:"read"`
 		StateGetActor                     func(context.Context, address.Address, types.TipSetKey) (*types.Actor, error)                                       `perm:"read"`
 		StateReadState                    func(context.Context, address.Address, types.TipSetKey) (*api.ActorState, error)                                    `perm:"read"`
 		StatePledgeCollateral             func(context.Context, types.TipSetKey) (types.BigInt, error)                                                        `perm:"read"`
@@ -152,10 +190,17 @@ type FullNodeStruct struct {
 		StateLookupID                     func(ctx context.Context, addr address.Address, tsk types.TipSetKey) (address.Address, error)                       `perm:"read"`
 		StateAccountKey                   func(context.Context, address.Address, types.TipSetKey) (address.Address, error)                                    `perm:"read"`
 		StateChangedActors                func(context.Context, cid.Cid, cid.Cid) (map[string]types.Actor, error)                                             `perm:"read"`
+		StateWatchActors                  func(context.Context, []address.Address) (<-chan []*api.ActorChange, error)                                         `perm:"read"`
 		StateGetReceipt                   func(context.Context, cid.Cid, types.TipSetKey) (*types.MessageReceipt, error)                                      `perm:"read"`
+		StateRebuildMsgIndex              func(context.Context, abi.ChainEpoch) (int, error)                                                                  `perm:"admin"`
 		StateMinerSectorCount             func(context.Context, address.Address, types.TipSetKey) (api.MinerSectors, error)                                   `perm:"read"`
 		StateListMessages                 func(ctx context.Context, match *types.Message, tsk types.TipSetKey, toht abi.ChainEpoch) ([]cid.Cid, error)        `perm:"read"`
 		StateCompute                      func(context.Context, abi.ChainEpoch, []*types.Message, types.TipSetKey) (*api.ComputeStateOutput, error)           `perm:"read"`
+		StateSnapshot                     func(context.Context, types.TipSetKey) (<-chan []byte, error)                                                       `perm:"read"`
+		StateGasTrace                     func(context.Context, types.TipSetKey) ([]*api.GasProfile, error)                                                   `perm:"read"`
+		StateCronExecution                func(context.Context, types.TipSetKey) (*api.CronExecution, error)                                                  `perm:"read"`
+		StateUpgradeDryRuns               func(context.Context) ([]api.UpgradeDryRun, error)                                                                  `perm:"read"`
+		StateImportSnapshot               func(ctx context.Context, path string) (cid.Cid, error)                                                             `perm:"admin"`
 
 		MsigGetAvailableBalance func(context.Context, address.Address, types.TipSetKey) (types.BigInt, error)                                                                    `perm:"read"`
 		MsigCreate              func(context.Context, int64, []address.Address, abi.ChainEpoch, types.BigInt, address.Address, types.BigInt) (cid.Cid, error)                    `perm:"sign"`
@@ -181,6 +226,19 @@ type FullNodeStruct struct {
 		PaychVoucherCreate         func(context.Context, address.Address, big.Int, uint64) (*paych.SignedVoucher, error)                     `perm:"sign"`
 		PaychVoucherList           func(context.Context, address.Address) ([]*paych.SignedVoucher, error)                                    `perm:"write"`
 		PaychVoucherSubmit         func(context.Context, address.Address, *paych.SignedVoucher) (cid.Cid, error)                             `perm:"sign"`
+
+		DepositList func(ctx context.Context, includeAcked bool) ([]api.Deposit, error) `perm:"read"`
+		DepositAck  func(ctx context.Context, msgs []cid.Cid) error                     `perm:"write"`
+
+		StatsEpochRollups      func(ctx context.Context, from, to abi.ChainEpoch) ([]api.EpochRollup, error)                 `perm:"read"`
+		ChainGetBaseFeeHistory func(ctx context.Context, from, to, resolution abi.ChainEpoch) ([]api.FeeHistoryPoint, error) `perm:"read"`
+
+		SandboxCreate    func(ctx context.Context, name string, tsk types.TipSetKey) (*api.SandboxInfo, error)     `perm:"write"`
+		SandboxApply     func(ctx context.Context, name string, msgs []*types.Message) ([]*api.InvocResult, error) `perm:"write"`
+		SandboxGetActor  func(ctx context.Context, name string, addr address.Address) (*types.Actor, error)        `perm:"read"`
+		SandboxReadState func(ctx context.Context, name string, addr address.Address) (*api.ActorState, error)     `perm:"read"`
+		SandboxList      func(ctx context.Context) ([]api.SandboxInfo, error)                                      `perm:"read"`
+		SandboxDelete    func(ctx context.Context, name string) error                                              `perm:"write"`
 	}
 }
 
@@ -194,8 +252,10 @@ type StorageMinerStruct struct {
 	Internal struct {
 		ActorAddress    func(context.Context) (address.Address, error)                 `perm:"read"`
 		ActorSectorSize func(context.Context, address.Address) (abi.SectorSize, error) `perm:"read"`
+		NetworkParams   func(context.Context) (build.NetworkParams, error)             `perm:"read"`
 
-		MiningBase func(context.Context) (*types.TipSet, error) `perm:"read"`
+		MiningBase   func(context.Context) (*types.TipSet, error)           `perm:"read"`
+		MiningReport func(context.Context) ([]api.MinedBlockTimings, error) `perm:"read"`
 
 		MarketImportDealData      func(context.Context, cid.Cid, string) error                                                                                                     `perm:"write"`
 		MarketListDeals           func(ctx context.Context) ([]storagemarket.StorageDeal, error)                                                                                   `perm:"read"`
@@ -205,15 +265,21 @@ type StorageMinerStruct struct {
 
 		PledgeSector func(context.Context) error `perm:"write"`
 
-		SectorsStatus func(context.Context, abi.SectorNumber) (api.SectorInfo, error) `perm:"read"`
-		SectorsList   func(context.Context) ([]abi.SectorNumber, error)               `perm:"read"`
-		SectorsRefs   func(context.Context) (map[string][]api.SealedRef, error)       `perm:"read"`
-		SectorsUpdate func(context.Context, abi.SectorNumber, api.SectorState) error  `perm:"write"`
-		SectorRemove  func(context.Context, abi.SectorNumber) error                   `perm:"admin"`
+		SectorsStatus          func(context.Context, abi.SectorNumber) (api.SectorInfo, error) `perm:"read"`
+		SectorsList            func(context.Context) ([]abi.SectorNumber, error)               `perm:"read"`
+		SectorsRefs            func(context.Context) (map[string][]api.SealedRef, error)       `perm:"read"`
+		SectorsUpdate          func(context.Context, abi.SectorNumber, api.SectorState) error  `perm:"write"`
+		SectorRemove           func(context.Context, abi.SectorNumber) error                   `perm:"admin"`
+		SectorsStuck           func(context.Context) ([]api.StuckSector, error)                `perm:"read"`
+		SectorsCommitDeadlines func(context.Context) ([]api.SectorCommitDeadline, error)       `perm:"read"`
+		SectorsPledgePolicy    func(context.Context) (api.PledgePolicyStatus, error)           `perm:"read"`
+		SectorsEstimates       func(context.Context) ([]api.SectorEstimate, error)             `perm:"read"`
 
 		WorkerConnect func(context.Context, string) error                             `perm:"admin"` // TODO: worker perm
 		WorkerStats   func(context.Context) (map[uint64]storiface.WorkerStats, error) `perm:"admin"`
 
+		VersionCheck func(context.Context) ([]api.ComponentVersion, error) `perm:"read"`
+
 		StorageList          func(context.Context) (map[stores.ID][]stores.Decl, error)                                                                                    `perm:"admin"`
 		StorageLocal         func(context.Context) (map[stores.ID]string, error)                                                                                           `perm:"admin"`
 		StorageStat          func(context.Context, stores.ID) (stores.FsStat, error)                                                                                       `perm:"admin"`
@@ -240,7 +306,15 @@ type StorageMinerStruct struct {
 		DealsPieceCidBlocklist                func(context.Context) ([]cid.Cid, error)                          `perm:"read"`
 		DealsSetPieceCidBlocklist             func(context.Context, []cid.Cid) error                            `perm:"admin"`
 
-		StorageAddLocal func(ctx context.Context, path string) error `perm:"admin"`
+		StorageAddLocal     func(ctx context.Context, path string) error                          `perm:"admin"`
+		StorageCheckSectors func(ctx context.Context, path string) ([]api.SectorFileIssue, error) `perm:"admin"`
+
+		MaintenanceStart      func(context.Context, string) error                  `perm:"admin"`
+		MaintenanceStop       func(context.Context) error                          `perm:"admin"`
+		MaintenanceCheckpoint func(context.Context) ([]abi.SectorNumber, error)    `perm:"admin"`
+		MaintenanceStatus     func(context.Context) (api.MaintenanceStatus, error) `perm:"read"`
+
+		MinerBackup func(ctx context.Context, path string) error `perm:"admin"`
 	}
 }
 
@@ -248,7 +322,8 @@ type WorkerStruct struct {
 	Internal struct {
 		// TODO: lower perms
 
-		Version func(context.Context) (build.Version, error) `perm:"admin"`
+		Version     func(context.Context) (build.Version, error) `perm:"admin"`
+		VersionInfo func(context.Context) (api.Version, error)   `perm:"admin"`
 
 		TaskTypes func(context.Context) (map[sealtasks.TaskType]struct{}, error) `perm:"admin"`
 		Paths     func(context.Context) ([]stores.StoragePath, error)            `perm:"admin"`
@@ -269,6 +344,7 @@ type WorkerStruct struct {
 		Fetch func(context.Context, abi.SectorID, stores.SectorFileType, stores.PathType, stores.AcquireMode) error `perm:"admin"`
 
 		Closing func(context.Context) (<-chan struct{}, error) `perm:"admin"`
+		Session func(context.Context) (uuid.UUID, error)       `perm:"admin"`
 	}
 }
 
@@ -282,9 +358,21 @@ func (c *CommonStruct) AuthNew(ctx context.Context, perms []auth.Permission) ([]
 	return c.Internal.AuthNew(ctx, perms)
 }
 
+func (c *CommonStruct) AuthNewNamespaced(ctx context.Context, perms []auth.Permission, ns api.TokenNamespace) ([]byte, error) {
+	return c.Internal.AuthNewNamespaced(ctx, perms, ns)
+}
+
+func (c *CommonStruct) AuthVerifyNamespace(ctx context.Context, token string) (*api.TokenNamespace, error) {
+	return c.Internal.AuthVerifyNamespace(ctx, token)
+}
+
 func (c *CommonStruct) NetPubsubScores(ctx context.Context) ([]api.PubsubScore, error) {
 	return c.Internal.NetPubsubScores(ctx)
 }
+
+func (c *CommonStruct) NetProtocolCensus(ctx context.Context) (*api.ProtocolCensus, error) {
+	return c.Internal.NetProtocolCensus(ctx)
+}
 func (c *CommonStruct) NetConnectedness(ctx context.Context, pid peer.ID) (network.Connectedness, error) {
 	return c.Internal.NetConnectedness(ctx, pid)
 }
@@ -327,6 +415,10 @@ func (c *CommonStruct) LogSetLevel(ctx context.Context, group, level string) err
 	return c.Internal.LogSetLevel(ctx, group, level)
 }
 
+func (c *CommonStruct) JournalQuery(ctx context.Context, q api.JournalQuery) ([]api.JournalEntry, error) {
+	return c.Internal.JournalQuery(ctx, q)
+}
+
 func (c *CommonStruct) Shutdown(ctx context.Context) error {
 	return c.Internal.Shutdown(ctx)
 }
@@ -379,6 +471,10 @@ func (c *FullNodeStruct) ClientCalcCommP(ctx context.Context, inpath string, min
 	return c.Internal.ClientCalcCommP(ctx, inpath, miner)
 }
 
+func (c *FullNodeStruct) ClientExtract(ctx context.Context, inpath string, payload cid.Cid, outdir string) (*api.ExtractResult, error) {
+	return c.Internal.ClientExtract(ctx, inpath, payload, outdir)
+}
+
 func (c *FullNodeStruct) ClientGenCar(ctx context.Context, ref api.FileRef, outpath string) error {
 	return c.Internal.ClientGenCar(ctx, ref, outpath)
 }
@@ -391,18 +487,50 @@ func (c *FullNodeStruct) MpoolPush(ctx context.Context, smsg *types.SignedMessag
 	return c.Internal.MpoolPush(ctx, smsg)
 }
 
-func (c *FullNodeStruct) MpoolPushMessage(ctx context.Context, msg *types.Message) (*types.SignedMessage, error) {
-	return c.Internal.MpoolPushMessage(ctx, msg)
+func (c *FullNodeStruct) MpoolPushMessage(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (*types.SignedMessage, error) {
+	return c.Internal.MpoolPushMessage(ctx, msg, spec)
 }
 
 func (c *FullNodeStruct) MpoolSub(ctx context.Context) (<-chan api.MpoolUpdate, error) {
 	return c.Internal.MpoolSub(ctx)
 }
 
+func (c *FullNodeStruct) MpoolReplace(ctx context.Context, from address.Address, nonce uint64, gasPrice types.BigInt) (*types.SignedMessage, error) {
+	return c.Internal.MpoolReplace(ctx, from, nonce, gasPrice)
+}
+
+func (c *FullNodeStruct) MpoolCancel(ctx context.Context, from address.Address, nonce uint64) (*types.SignedMessage, error) {
+	return c.Internal.MpoolCancel(ctx, from, nonce)
+}
+
+func (c *FullNodeStruct) MpoolLocal(ctx context.Context) ([]api.LocalMessage, error) {
+	return c.Internal.MpoolLocal(ctx)
+}
+
+func (c *FullNodeStruct) MpoolPurgeLocal(ctx context.Context) (int, error) {
+	return c.Internal.MpoolPurgeLocal(ctx)
+}
+
 func (c *FullNodeStruct) MpoolEstimateGasPrice(ctx context.Context, nblocksincl uint64, sender address.Address, limit int64, tsk types.TipSetKey) (types.BigInt, error) {
 	return c.Internal.MpoolEstimateGasPrice(ctx, nblocksincl, sender, limit, tsk)
 }
 
+func (c *FullNodeStruct) GasEstimateGasPrice(ctx context.Context, nblocksincl uint64, sender address.Address, limit int64, tsk types.TipSetKey) (types.BigInt, error) {
+	return c.Internal.GasEstimateGasPrice(ctx, nblocksincl, sender, limit, tsk)
+}
+
+func (c *FullNodeStruct) GasPricePercentiles(ctx context.Context, lookback uint64, percentiles []float64, tsk types.TipSetKey) ([]types.BigInt, error) {
+	return c.Internal.GasPricePercentiles(ctx, lookback, percentiles, tsk)
+}
+
+func (c *FullNodeStruct) GasEstimateGasLimit(ctx context.Context, msg *types.Message, tsk types.TipSetKey) (*api.GasEstimate, error) {
+	return c.Internal.GasEstimateGasLimit(ctx, msg, tsk)
+}
+
+func (c *FullNodeStruct) MpoolAuditExport(ctx context.Context, since, until time.Time) ([]api.MessageAuditRecord, error) {
+	return c.Internal.MpoolAuditExport(ctx, since, until)
+}
+
 func (c *FullNodeStruct) MinerGetBaseInfo(ctx context.Context, maddr address.Address, epoch abi.ChainEpoch, tsk types.TipSetKey) (*api.MiningBaseInfo, error) {
 	return c.Internal.MinerGetBaseInfo(ctx, maddr, epoch, tsk)
 }
@@ -411,10 +539,18 @@ func (c *FullNodeStruct) MinerCreateBlock(ctx context.Context, bt *api.BlockTemp
 	return c.Internal.MinerCreateBlock(ctx, bt)
 }
 
+func (c *FullNodeStruct) ChainMulticall(ctx context.Context, tsk types.TipSetKey, calls []api.Call) (*api.MulticallResult, error) {
+	return c.Internal.ChainMulticall(ctx, tsk, calls)
+}
+
 func (c *FullNodeStruct) ChainHead(ctx context.Context) (*types.TipSet, error) {
 	return c.Internal.ChainHead(ctx)
 }
 
+func (c *FullNodeStruct) ChainHeadInfo(ctx context.Context) (*api.HeadInfo, error) {
+	return c.Internal.ChainHeadInfo(ctx)
+}
+
 func (c *FullNodeStruct) ChainGetRandomness(ctx context.Context, tsk types.TipSetKey, personalization crypto.DomainSeparationTag, randEpoch abi.ChainEpoch, entropy []byte) (abi.Randomness, error) {
 	return c.Internal.ChainGetRandomness(ctx, tsk, personalization, randEpoch, entropy)
 }
@@ -499,6 +635,26 @@ func (c *FullNodeStruct) ChainNotify(ctx context.Context) (<-chan []*api.HeadCha
 	return c.Internal.ChainNotify(ctx)
 }
 
+func (c *FullNodeStruct) ChainNotifyReorgs(ctx context.Context) (<-chan *api.ReorgEvent, error) {
+	return c.Internal.ChainNotifyReorgs(ctx)
+}
+
+func (c *FullNodeStruct) ChainReorgStats(ctx context.Context) (*api.ReorgStats, error) {
+	return c.Internal.ChainReorgStats(ctx)
+}
+
+func (c *FullNodeStruct) ChainSubscribeEvents(ctx context.Context, filter api.EventFilter) (<-chan *api.ChainEvent, error) {
+	return c.Internal.ChainSubscribeEvents(ctx, filter)
+}
+
+func (c *FullNodeStruct) ChainNotifyAt(ctx context.Context, height abi.ChainEpoch, confidence uint64) (<-chan *api.HeightEvent, error) {
+	return c.Internal.ChainNotifyAt(ctx, height, confidence)
+}
+
+func (c *FullNodeStruct) ChainChangefeed(ctx context.Context, after uint64) (<-chan *api.ChangefeedEntry, error) {
+	return c.Internal.ChainChangefeed(ctx, after)
+}
+
 func (c *FullNodeStruct) ChainReadObj(ctx context.Context, obj cid.Cid) ([]byte, error) {
 	return c.Internal.ChainReadObj(ctx, obj)
 }
@@ -535,8 +691,32 @@ func (c *FullNodeStruct) ChainGetPath(ctx context.Context, from types.TipSetKey,
 	return c.Internal.ChainGetPath(ctx, from, to)
 }
 
-func (c *FullNodeStruct) ChainExport(ctx context.Context, tsk types.TipSetKey) (<-chan []byte, error) {
-	return c.Internal.ChainExport(ctx, tsk)
+func (c *FullNodeStruct) ChainExport(ctx context.Context, tsk types.TipSetKey, opts api.ChainExportOptions) (<-chan []byte, error) {
+	return c.Internal.ChainExport(ctx, tsk, opts)
+}
+
+func (c *FullNodeStruct) ChainImport(ctx context.Context, path string, trusted bool) (types.TipSetKey, error) {
+	return c.Internal.ChainImport(ctx, path, trusted)
+}
+
+func (c *FullNodeStruct) ChainFetchSnapshot(ctx context.Context, p peer.AddrInfo) (types.TipSetKey, error) {
+	return c.Internal.ChainFetchSnapshot(ctx, p)
+}
+
+func (c *FullNodeStruct) ChainVerify(ctx context.Context, opts api.ChainVerifyOptions) (*api.ChainVerifyReport, error) {
+	return c.Internal.ChainVerify(ctx, opts)
+}
+
+func (c *FullNodeStruct) ChainPrune(ctx context.Context, keepStateRoots abi.ChainEpoch, dryRun bool) (*api.ChainPruneReport, error) {
+	return c.Internal.ChainPrune(ctx, keepStateRoots, dryRun)
+}
+
+func (c *FullNodeStruct) ChainReorgJournal(ctx context.Context) ([]api.ReorgJournalEntry, error) {
+	return c.Internal.ChainReorgJournal(ctx)
+}
+
+func (c *FullNodeStruct) ChainReplayReorg(ctx context.Context, id uint64) error {
+	return c.Internal.ChainReplayReorg(ctx, id)
 }
 
 func (c *FullNodeStruct) SyncState(ctx context.Context) (*api.SyncState, error) {
@@ -551,6 +731,10 @@ func (c *FullNodeStruct) SyncIncomingBlocks(ctx context.Context) (<-chan *types.
 	return c.Internal.SyncIncomingBlocks(ctx)
 }
 
+func (c *FullNodeStruct) SyncProgress(ctx context.Context) (<-chan api.SyncProgressEvent, error) {
+	return c.Internal.SyncProgress(ctx)
+}
+
 func (c *FullNodeStruct) SyncMarkBad(ctx context.Context, bcid cid.Cid) error {
 	return c.Internal.SyncMarkBad(ctx, bcid)
 }
@@ -559,10 +743,26 @@ func (c *FullNodeStruct) SyncCheckBad(ctx context.Context, bcid cid.Cid) (string
 	return c.Internal.SyncCheckBad(ctx, bcid)
 }
 
+func (c *FullNodeStruct) NetBlocksyncPeers(ctx context.Context) ([]api.BlocksyncPeer, error) {
+	return c.Internal.NetBlocksyncPeers(ctx)
+}
+
+func (c *FullNodeStruct) SyncPeerHealth(ctx context.Context) ([]api.PeerHealth, error) {
+	return c.Internal.SyncPeerHealth(ctx)
+}
+
+func (c *FullNodeStruct) SyncCheckpoint(ctx context.Context, tsk types.TipSetKey) error {
+	return c.Internal.SyncCheckpoint(ctx, tsk)
+}
+
 func (c *FullNodeStruct) StateNetworkName(ctx context.Context) (dtypes.NetworkName, error) {
 	return c.Internal.StateNetworkName(ctx)
 }
 
+func (c *FullNodeStruct) StateNetworkParams(ctx context.Context) (build.NetworkParams, error) {
+	return c.Internal.StateNetworkParams(ctx)
+}
+
 func (c *FullNodeStruct) StateMinerSectors(ctx context.Context, addr address.Address, filter *abi.BitField, filterOut bool, tsk types.TipSetKey) ([]*api.ChainSectorInfo, error) {
 	return c.Internal.StateMinerSectors(ctx, addr, filter, filterOut, tsk)
 }
@@ -619,10 +819,18 @@ func (c *FullNodeStruct) StateCall(ctx context.Context, msg *types.Message, tsk
 	return c.Internal.StateCall(ctx, msg, tsk)
 }
 
+func (c *FullNodeStruct) StateDryRun(ctx context.Context, msg *types.Message, tsk types.TipSetKey) (*api.InvocResult, error) {
+	return c.Internal.StateDryRun(ctx, msg, tsk)
+}
+
 func (c *FullNodeStruct) StateReplay(ctx context.Context, tsk types.TipSetKey, mc cid.Cid) (*api.InvocResult, error) {
 	return c.Internal.StateReplay(ctx, tsk, mc)
 }
 
+func (c *FullNodeStruct) StateActorMethods(ctx context.Context) ([]api.ActorMethods, error) {
+	return c.Internal.StateActorMethods(ctx)
+}
+
 func (c *FullNodeStruct) StateGetActor(ctx context.Context, actor address.Address, tsk types.TipSetKey) (*types.Actor, error) {
 	return c.Internal.StateGetActor(ctx, actor, tsk)
 }
@@ -683,6 +891,14 @@ func (c *FullNodeStruct) StateGetReceipt(ctx context.Context, msg cid.Cid, tsk t
 	return c.Internal.StateGetReceipt(ctx, msg, tsk)
 }
 
+func (c *FullNodeStruct) StateRebuildMsgIndex(ctx context.Context, to abi.ChainEpoch) (int, error) {
+	return c.Internal.StateRebuildMsgIndex(ctx, to)
+}
+
+func (c *FullNodeStruct) StateWatchActors(ctx context.Context, addrs []address.Address) (<-chan []*api.ActorChange, error) {
+	return c.Internal.StateWatchActors(ctx, addrs)
+}
+
 func (c *FullNodeStruct) StateListMessages(ctx context.Context, match *types.Message, tsk types.TipSetKey, toht abi.ChainEpoch) ([]cid.Cid, error) {
 	return c.Internal.StateListMessages(ctx, match, tsk, toht)
 }
@@ -691,6 +907,26 @@ func (c *FullNodeStruct) StateCompute(ctx context.Context, height abi.ChainEpoch
 	return c.Internal.StateCompute(ctx, height, msgs, tsk)
 }
 
+func (c *FullNodeStruct) StateSnapshot(ctx context.Context, tsk types.TipSetKey) (<-chan []byte, error) {
+	return c.Internal.StateSnapshot(ctx, tsk)
+}
+
+func (c *FullNodeStruct) StateGasTrace(ctx context.Context, tsk types.TipSetKey) ([]*api.GasProfile, error) {
+	return c.Internal.StateGasTrace(ctx, tsk)
+}
+
+func (c *FullNodeStruct) StateCronExecution(ctx context.Context, tsk types.TipSetKey) (*api.CronExecution, error) {
+	return c.Internal.StateCronExecution(ctx, tsk)
+}
+
+func (c *FullNodeStruct) StateUpgradeDryRuns(ctx context.Context) ([]api.UpgradeDryRun, error) {
+	return c.Internal.StateUpgradeDryRuns(ctx)
+}
+
+func (c *FullNodeStruct) StateImportSnapshot(ctx context.Context, path string) (cid.Cid, error) {
+	return c.Internal.StateImportSnapshot(ctx, path)
+}
+
 func (c *FullNodeStruct) MsigGetAvailableBalance(ctx context.Context, a address.Address, tsk types.TipSetKey) (types.BigInt, error) {
 	return c.Internal.MsigGetAvailableBalance(ctx, a, tsk)
 }
@@ -775,6 +1011,46 @@ func (c *FullNodeStruct) PaychVoucherSubmit(ctx context.Context, ch address.Addr
 	return c.Internal.PaychVoucherSubmit(ctx, ch, sv)
 }
 
+func (c *FullNodeStruct) DepositList(ctx context.Context, includeAcked bool) ([]api.Deposit, error) {
+	return c.Internal.DepositList(ctx, includeAcked)
+}
+
+func (c *FullNodeStruct) DepositAck(ctx context.Context, msgs []cid.Cid) error {
+	return c.Internal.DepositAck(ctx, msgs)
+}
+
+func (c *FullNodeStruct) StatsEpochRollups(ctx context.Context, from, to abi.ChainEpoch) ([]api.EpochRollup, error) {
+	return c.Internal.StatsEpochRollups(ctx, from, to)
+}
+
+func (c *FullNodeStruct) ChainGetBaseFeeHistory(ctx context.Context, from, to, resolution abi.ChainEpoch) ([]api.FeeHistoryPoint, error) {
+	return c.Internal.ChainGetBaseFeeHistory(ctx, from, to, resolution)
+}
+
+func (c *FullNodeStruct) SandboxCreate(ctx context.Context, name string, tsk types.TipSetKey) (*api.SandboxInfo, error) {
+	return c.Internal.SandboxCreate(ctx, name, tsk)
+}
+
+func (c *FullNodeStruct) SandboxApply(ctx context.Context, name string, msgs []*types.Message) ([]*api.InvocResult, error) {
+	return c.Internal.SandboxApply(ctx, name, msgs)
+}
+
+func (c *FullNodeStruct) SandboxGetActor(ctx context.Context, name string, addr address.Address) (*types.Actor, error) {
+	return c.Internal.SandboxGetActor(ctx, name, addr)
+}
+
+func (c *FullNodeStruct) SandboxReadState(ctx context.Context, name string, addr address.Address) (*api.ActorState, error) {
+	return c.Internal.SandboxReadState(ctx, name, addr)
+}
+
+func (c *FullNodeStruct) SandboxList(ctx context.Context) ([]api.SandboxInfo, error) {
+	return c.Internal.SandboxList(ctx)
+}
+
+func (c *FullNodeStruct) SandboxDelete(ctx context.Context, name string) error {
+	return c.Internal.SandboxDelete(ctx, name)
+}
+
 // StorageMinerStruct
 
 func (c *StorageMinerStruct) ActorAddress(ctx context.Context) (address.Address, error) {
@@ -785,10 +1061,18 @@ func (c *StorageMinerStruct) MiningBase(ctx context.Context) (*types.TipSet, err
 	return c.Internal.MiningBase(ctx)
 }
 
+func (c *StorageMinerStruct) MiningReport(ctx context.Context) ([]api.MinedBlockTimings, error) {
+	return c.Internal.MiningReport(ctx)
+}
+
 func (c *StorageMinerStruct) ActorSectorSize(ctx context.Context, addr address.Address) (abi.SectorSize, error) {
 	return c.Internal.ActorSectorSize(ctx, addr)
 }
 
+func (c *StorageMinerStruct) NetworkParams(ctx context.Context) (build.NetworkParams, error) {
+	return c.Internal.NetworkParams(ctx)
+}
+
 func (c *StorageMinerStruct) PledgeSector(ctx context.Context) error {
 	return c.Internal.PledgeSector(ctx)
 }
@@ -815,6 +1099,38 @@ func (c *StorageMinerStruct) SectorRemove(ctx context.Context, number abi.Sector
 	return c.Internal.SectorRemove(ctx, number)
 }
 
+func (c *StorageMinerStruct) SectorsStuck(ctx context.Context) ([]api.StuckSector, error) {
+	return c.Internal.SectorsStuck(ctx)
+}
+
+func (c *StorageMinerStruct) SectorsCommitDeadlines(ctx context.Context) ([]api.SectorCommitDeadline, error) {
+	return c.Internal.SectorsCommitDeadlines(ctx)
+}
+
+func (c *StorageMinerStruct) SectorsPledgePolicy(ctx context.Context) (api.PledgePolicyStatus, error) {
+	return c.Internal.SectorsPledgePolicy(ctx)
+}
+
+func (c *StorageMinerStruct) SectorsEstimates(ctx context.Context) ([]api.SectorEstimate, error) {
+	return c.Internal.SectorsEstimates(ctx)
+}
+
+func (c *StorageMinerStruct) MaintenanceStart(ctx context.Context, reason string) error {
+	return c.Internal.MaintenanceStart(ctx, reason)
+}
+
+func (c *StorageMinerStruct) MaintenanceStop(ctx context.Context) error {
+	return c.Internal.MaintenanceStop(ctx)
+}
+
+func (c *StorageMinerStruct) MaintenanceCheckpoint(ctx context.Context) ([]abi.SectorNumber, error) {
+	return c.Internal.MaintenanceCheckpoint(ctx)
+}
+
+func (c *StorageMinerStruct) MaintenanceStatus(ctx context.Context) (api.MaintenanceStatus, error) {
+	return c.Internal.MaintenanceStatus(ctx)
+}
+
 func (c *StorageMinerStruct) WorkerConnect(ctx context.Context, url string) error {
 	return c.Internal.WorkerConnect(ctx, url)
 }
@@ -823,6 +1139,10 @@ func (c *StorageMinerStruct) WorkerStats(ctx context.Context) (map[uint64]storif
 	return c.Internal.WorkerStats(ctx)
 }
 
+func (c *StorageMinerStruct) VersionCheck(ctx context.Context) ([]api.ComponentVersion, error) {
+	return c.Internal.VersionCheck(ctx)
+}
+
 func (c *StorageMinerStruct) StorageAttach(ctx context.Context, si stores.StorageInfo, st stores.FsStat) error {
 	return c.Internal.StorageAttach(ctx, si, st)
 }
@@ -943,12 +1263,24 @@ func (c *StorageMinerStruct) StorageAddLocal(ctx context.Context, path string) e
 	return c.Internal.StorageAddLocal(ctx, path)
 }
 
+func (c *StorageMinerStruct) StorageCheckSectors(ctx context.Context, path string) ([]api.SectorFileIssue, error) {
+	return c.Internal.StorageCheckSectors(ctx, path)
+}
+
+func (c *StorageMinerStruct) MinerBackup(ctx context.Context, path string) error {
+	return c.Internal.MinerBackup(ctx, path)
+}
+
 // WorkerStruct
 
 func (w *WorkerStruct) Version(ctx context.Context) (build.Version, error) {
 	return w.Internal.Version(ctx)
 }
 
+func (w *WorkerStruct) VersionInfo(ctx context.Context) (api.Version, error) {
+	return w.Internal.VersionInfo(ctx)
+}
+
 func (w *WorkerStruct) TaskTypes(ctx context.Context) (map[sealtasks.TaskType]struct{}, error) {
 	return w.Internal.TaskTypes(ctx)
 }
@@ -1009,6 +1341,10 @@ func (w *WorkerStruct) Closing(ctx context.Context) (<-chan struct{}, error) {
 	return w.Internal.Closing(ctx)
 }
 
+func (w *WorkerStruct) Session(ctx context.Context) (uuid.UUID, error) {
+	return w.Internal.Session(ctx)
+}
+
 var _ api.Common = &CommonStruct{}
 var _ api.FullNode = &FullNodeStruct{}
 var _ api.StorageMiner = &StorageMinerStruct{}
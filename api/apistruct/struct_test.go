@@ -7,3 +7,20 @@ func TestPermTags(t *testing.T) {
 	_ = PermissionedStorMinerAPI(&StorageMinerStruct{})
 	_ = PermissionedWorkerAPI(&WorkerStruct{})
 }
+
+func TestFullNodeMethodPerm(t *testing.T) {
+	for method, perm := range map[string]string{
+		"ChainHead":    "read",
+		"MpoolPush":    "write",
+		"AuthNew":      "admin",
+		"NotAMethod":   "",
+		"WalletSign":   "sign",
+		"AuthVerify":   "read",
+		"ChainGetNode": "read",
+	} {
+		p, ok := FullNodeMethodPerm(method)
+		if ok != (perm != "") || string(p) != perm {
+			t.Errorf("%s: expected permission %q, got %q", method, perm, p)
+		}
+	}
+}
@@ -95,6 +95,7 @@ func init() {
 	addExample(network.Connected)
 	addExample(dtypes.NetworkName("lotus"))
 	addExample(api.SyncStateStage(1))
+	addExample(api.SyncProgressState)
 	addExample(build.APIVersion)
 	addExample(api.PCHInbound)
 	addExample(time.Minute)
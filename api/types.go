@@ -43,6 +43,24 @@ type PubsubScore struct {
 	Score float64
 }
 
+// ProtocolCensus counts the connected peers supporting each protocol
+type ProtocolCensus struct {
+	// Peers is the number of connected peers
+	Peers int
+	// Unidentified is the number of peers which support none of the
+	// protocols, usually because they haven't been identified yet
+	Unidentified int
+	// Protocols maps protocol IDs to the number of peers supporting them
+	Protocols map[string]int
+
+	PeerProtocols []PeerProtocols
+}
+
+type PeerProtocols struct {
+	ID        peer.ID
+	Protocols []string
+}
+
 type MinerInfo struct {
 	Owner                      address.Address // Must be an ID-address.
 	Worker                     address.Address // Must be an ID-address.
@@ -0,0 +1,81 @@
+package build
+
+import (
+	"encoding/json"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const actorsModule = "github.com/filecoin-project/specs-actors"
+
+// BuildTypeName returns the kind of build, release, debug or 2k. Debug and 2k
+// builds run with devnet parameters, and can't be mixed with release builds.
+func BuildTypeName() string {
+	switch BuildType {
+	case BuildDefault:
+		return "release"
+	case BuildDebug:
+		return "debug"
+	case Build2k:
+		return "2k"
+	default:
+		return "unknown"
+	}
+}
+
+// ModuleVersion returns the version of a module the binary was built with,
+// or an empty string if the binary carries no module information.
+func ModuleVersion(path string) string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	for _, m := range bi.Deps {
+		if m.Path != path {
+			continue
+		}
+		if m.Replace != nil {
+			return m.Replace.Version
+		}
+		return m.Version
+	}
+	return ""
+}
+
+// ActorsVersion returns the version of the actors the binary was built with
+func ActorsVersion() string {
+	return ModuleVersion(actorsModule)
+}
+
+var (
+	paramsVersionOnce sync.Once
+	paramsVersion     string
+)
+
+// ParamsVersion returns the version of the proof parameters used by the
+// binary, taken from the parameter file names, e.g. v27.
+func ParamsVersion() string {
+	paramsVersionOnce.Do(func() {
+		var params map[string]json.RawMessage
+		if err := json.Unmarshal(ParametersJSON(), &params); err != nil {
+			paramsVersion = "unknown"
+			return
+		}
+
+		versions := map[string]struct{}{}
+		for name := range params {
+			versions[strings.SplitN(name, "-", 2)[0]] = struct{}{}
+		}
+
+		out := make([]string, 0, len(versions))
+		for v := range versions {
+			out = append(out, v)
+		}
+		sort.Strings(out)
+		paramsVersion = strings.Join(out, ",")
+	})
+	return paramsVersion
+}
@@ -0,0 +1,6 @@
+package build
+
+// Checkpoints are tipsets of the network the node trusts to be part of the
+// canonical chain, in the `height:cid[,cid...]` format. The node refuses to
+// sync chains which don't contain them.
+var Checkpoints = []string{}
@@ -1 +1,14 @@
 package build
+
+import (
+	"math"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+// UpgradeSyscallStateHeight is the epoch from which syscalls resolve the
+// addresses they're given in the state of the calling runtime. Before it,
+// VerifySignature only accepts key addresses, and the block signatures of
+// consensus faults can't be verified, as syscalls had no state to resolve
+// worker keys in.
+var UpgradeSyscallStateHeight = abi.ChainEpoch(math.MaxInt64)
@@ -0,0 +1,181 @@
+package build
+
+import (
+	"sort"
+	"sync"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/builtin/power"
+)
+
+// NetworkParams are parameters custom networks, e.g. devnets, can change
+// without recompiling, through the genesis file or the node config. Unset
+// fields keep the values of the build.
+//
+// Only devnet builds, debug and 2k, accept params which differ from the ones
+// they were built with.
+type NetworkParams struct {
+	BlockDelaySecs       uint64 `json:",omitempty"`
+	PropagationDelaySecs uint64 `json:",omitempty"`
+
+	// WPoStChallengeWindow is the length, in epochs, of the window PoSt
+	// deadlines. The proving period is WPoStPeriodDeadlines windows.
+	WPoStChallengeWindow abi.ChainEpoch `json:",omitempty"`
+
+	// SectorSizes are the sizes of the sectors miners can seal
+	SectorSizes []abi.SectorSize `json:",omitempty"`
+
+	// ConsensusMinerMinPower is the power, in bytes, miners need to be
+	// eligible to mine blocks
+	ConsensusMinerMinPower uint64 `json:",omitempty"`
+}
+
+var (
+	// netParamsLk serializes applying and freezing the params. Readers access
+	// the params without locking, which is safe as they can't change once
+	// they're frozen, before the node is constructed.
+	netParamsLk     sync.Mutex
+	netParamsFrozen bool
+)
+
+// ApplyNetworkParams overrides the parameters of the build with the set
+// fields of p. Params which differ from the current ones are only accepted by
+// devnet builds, before FreezeNetworkParams is called.
+func ApplyNetworkParams(p NetworkParams) error {
+	netParamsLk.Lock()
+	defer netParamsLk.Unlock()
+
+	var proofs map[abi.RegisteredSealProof]struct{}
+	if len(p.SectorSizes) > 0 {
+		proofs = map[abi.RegisteredSealProof]struct{}{}
+		for _, ss := range p.SectorSizes {
+			spt, err := sealProofType(ss)
+			if err != nil {
+				return err
+			}
+			proofs[spt] = struct{}{}
+		}
+	}
+
+	if !p.overrides(currentNetworkParams()) {
+		return nil
+	}
+	if BuildType&(BuildDebug|Build2k) == 0 {
+		return xerrors.Errorf("network params can only be overridden by devnet builds, this is a %s build", BuildTypeName())
+	}
+	if netParamsFrozen {
+		return xerrors.Errorf("network params can't be changed once the node is constructed")
+	}
+
+	if p.BlockDelaySecs > 0 {
+		BlockDelaySecs = p.BlockDelaySecs
+	}
+	if p.PropagationDelaySecs > 0 {
+		PropagationDelaySecs = p.PropagationDelaySecs
+	}
+	if PropagationDelaySecs >= BlockDelaySecs {
+		log.Warnf("propagation delay (%ds) isn't shorter than the block delay (%ds)", PropagationDelaySecs, BlockDelaySecs)
+	}
+	if p.WPoStChallengeWindow > 0 {
+		miner.WPoStChallengeWindow = p.WPoStChallengeWindow
+		miner.WPoStProvingPeriod = p.WPoStChallengeWindow * abi.ChainEpoch(miner.WPoStPeriodDeadlines)
+	}
+	if proofs != nil {
+		miner.SupportedProofTypes = proofs
+	}
+	if p.ConsensusMinerMinPower > 0 {
+		power.ConsensusMinerMinPower = big.NewIntUnsigned(p.ConsensusMinerMinPower)
+	}
+
+	return nil
+}
+
+// FreezeNetworkParams makes the params immutable, ApplyNetworkParams fails
+// for params which would change them afterwards. It's called before the
+// components reading the params are constructed.
+func FreezeNetworkParams() {
+	netParamsLk.Lock()
+	netParamsFrozen = true
+	netParamsLk.Unlock()
+}
+
+// overrides returns whether the set fields of p differ from cur
+func (p NetworkParams) overrides(cur NetworkParams) bool {
+	differs := func(v, c uint64) bool {
+		return v > 0 && v != c
+	}
+
+	if differs(p.BlockDelaySecs, cur.BlockDelaySecs) ||
+		differs(p.PropagationDelaySecs, cur.PropagationDelaySecs) ||
+		differs(uint64(p.WPoStChallengeWindow), uint64(cur.WPoStChallengeWindow)) ||
+		differs(p.ConsensusMinerMinPower, cur.ConsensusMinerMinPower) {
+		return true
+	}
+
+	if len(p.SectorSizes) == 0 {
+		return false
+	}
+	sizes := map[abi.SectorSize]struct{}{}
+	for _, ss := range p.SectorSizes {
+		sizes[ss] = struct{}{}
+	}
+	if len(sizes) != len(cur.SectorSizes) {
+		return true
+	}
+	for _, ss := range cur.SectorSizes {
+		if _, ok := sizes[ss]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentNetworkParams returns the parameters the node runs with
+func CurrentNetworkParams() NetworkParams {
+	netParamsLk.Lock()
+	defer netParamsLk.Unlock()
+
+	return currentNetworkParams()
+}
+
+func currentNetworkParams() NetworkParams {
+	p := NetworkParams{
+		BlockDelaySecs:         BlockDelaySecs,
+		PropagationDelaySecs:   PropagationDelaySecs,
+		WPoStChallengeWindow:   miner.WPoStChallengeWindow,
+		ConsensusMinerMinPower: power.ConsensusMinerMinPower.Uint64(),
+	}
+	for spt := range miner.SupportedProofTypes {
+		ss, err := spt.SectorSize()
+		if err != nil {
+			continue
+		}
+		p.SectorSizes = append(p.SectorSizes, ss)
+	}
+	sort.Slice(p.SectorSizes, func(i, j int) bool {
+		return p.SectorSizes[i] < p.SectorSizes[j]
+	})
+
+	return p
+}
+
+func sealProofType(ss abi.SectorSize) (abi.RegisteredSealProof, error) {
+	switch ss {
+	case 2 << 10:
+		return abi.RegisteredSealProof_StackedDrg2KiBV1, nil
+	case 8 << 20:
+		return abi.RegisteredSealProof_StackedDrg8MiBV1, nil
+	case 512 << 20:
+		return abi.RegisteredSealProof_StackedDrg512MiBV1, nil
+	case 32 << 30:
+		return abi.RegisteredSealProof_StackedDrg32GiBV1, nil
+	case 64 << 30:
+		return abi.RegisteredSealProof_StackedDrg64GiBV1, nil
+	default:
+		return 0, xerrors.Errorf("unsupported sector size: %d", ss)
+	}
+}
@@ -0,0 +1,97 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+// withBuildType runs f with the given build type and unfrozen params, and
+// restores the params afterwards
+func withBuildType(t *testing.T, bt int, f func()) {
+	orig := CurrentNetworkParams()
+	origType := BuildType
+	defer func() {
+		BuildType = Build2k
+		netParamsFrozen = false
+		if err := ApplyNetworkParams(orig); err != nil {
+			t.Fatal(err)
+		}
+		BuildType = origType
+	}()
+
+	BuildType = bt
+	netParamsFrozen = false
+	f()
+}
+
+func TestNetworkParamsReleaseBuild(t *testing.T) {
+	withBuildType(t, BuildDefault, func() {
+		cur := CurrentNetworkParams()
+
+		// the params of the build are accepted
+		if err := ApplyNetworkParams(cur); err != nil {
+			t.Fatal(err)
+		}
+		if err := ApplyNetworkParams(NetworkParams{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ApplyNetworkParams(NetworkParams{BlockDelaySecs: cur.BlockDelaySecs + 1}); err == nil {
+			t.Fatal("expected a release build to reject a different block delay")
+		}
+		if BlockDelaySecs != cur.BlockDelaySecs {
+			t.Fatal("the block delay changed")
+		}
+	})
+}
+
+func TestNetworkParamsDevnet(t *testing.T) {
+	withBuildType(t, Build2k, func() {
+		p := NetworkParams{
+			BlockDelaySecs:       BlockDelaySecs + 1,
+			WPoStChallengeWindow: 10,
+			SectorSizes:          []abi.SectorSize{2 << 10, 8 << 20},
+		}
+		if err := ApplyNetworkParams(p); err != nil {
+			t.Fatal(err)
+		}
+
+		cur := CurrentNetworkParams()
+		if cur.BlockDelaySecs != p.BlockDelaySecs || cur.WPoStChallengeWindow != 10 {
+			t.Fatalf("params weren't applied: %+v", cur)
+		}
+		if len(cur.SectorSizes) != 2 {
+			t.Fatalf("expected 2 sector sizes, got %v", cur.SectorSizes)
+		}
+
+		FreezeNetworkParams()
+		if err := ApplyNetworkParams(p); err != nil {
+			t.Fatalf("expected the current params to be accepted once frozen: %s", err)
+		}
+		if err := ApplyNetworkParams(NetworkParams{BlockDelaySecs: p.BlockDelaySecs + 1}); err == nil {
+			t.Fatal("expected frozen params to reject changes")
+		}
+	})
+}
+
+func TestNetworkParamsOverrides(t *testing.T) {
+	cur := NetworkParams{BlockDelaySecs: 30, SectorSizes: []abi.SectorSize{2 << 10, 8 << 20}}
+
+	for i, tc := range []struct {
+		p         NetworkParams
+		overrides bool
+	}{
+		{NetworkParams{}, false},
+		{NetworkParams{BlockDelaySecs: 30}, false},
+		{NetworkParams{BlockDelaySecs: 5}, true},
+		{NetworkParams{SectorSizes: []abi.SectorSize{8 << 20, 2 << 10}}, false},
+		{NetworkParams{SectorSizes: []abi.SectorSize{8 << 20, 2 << 10, 2 << 10}}, false},
+		{NetworkParams{SectorSizes: []abi.SectorSize{2 << 10}}, true},
+		{NetworkParams{SectorSizes: []abi.SectorSize{2 << 10, 32 << 30}}, true},
+	} {
+		if got := tc.p.overrides(cur); got != tc.overrides {
+			t.Errorf("%d: expected overrides to be %t", i, tc.overrides)
+		}
+	}
+}
@@ -20,9 +20,9 @@ func init() {
 	BuildType |= Build2k
 }
 
-const BlockDelaySecs = uint64(2)
+var BlockDelaySecs = uint64(2)
 
-const PropagationDelaySecs = uint64(3)
+var PropagationDelaySecs = uint64(3)
 
 // SlashablePowerDelay is the number of epochs after ElectionPeriodStart, after
 // which the miner is slashed
@@ -20,6 +20,6 @@ func init() {
 	}
 }
 
-const BlockDelaySecs = uint64(builtin.EpochDurationSeconds)
+var BlockDelaySecs = uint64(builtin.EpochDurationSeconds)
 
-const PropagationDelaySecs = uint64(6)
+var PropagationDelaySecs = uint64(6)
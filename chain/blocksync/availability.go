@@ -0,0 +1,227 @@
+package blocksync
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var (
+	// AvailabilityInterval is how often sync peers are probed for tipsets of
+	// the chain the node follows, zero disables probing
+	AvailabilityInterval = 5 * time.Minute
+	// AvailabilityPeers is the number of random peers probed every round
+	AvailabilityPeers = 8
+	// AvailabilityTimeout bounds a single probe
+	AvailabilityTimeout = 30 * time.Second
+
+	// Probed tipsets are sampled between AvailabilityMinDepth and
+	// AvailabilityMaxDepth epochs below the head, so that peers which are
+	// slightly behind aren't counted as missing them
+	AvailabilityMinDepth abi.ChainEpoch = 5
+	AvailabilityMaxDepth abi.ChainEpoch = 200
+)
+
+type probeResult int
+
+const (
+	probeServed probeResult = iota
+	probeMissing
+	probeFailed
+)
+
+// probeStats are the results of availability probes of a peer
+type probeStats struct {
+	probes  int
+	served  int
+	missing int
+	failed  int
+
+	lastProbe   time.Time
+	lastMissing abi.ChainEpoch
+}
+
+// RunAvailabilityChecker periodically probes random sync peers for a random
+// recent tipset of the chain the node follows, with a request for its
+// headers only. Peers which don't have the tipset are either behind or on
+// another fork, and are counted as failures by the peer tracker, so that
+// they're asked later during sync.
+func (bs *BlockSync) RunAvailabilityChecker(ctx context.Context, cs *store.ChainStore) {
+	if AvailabilityInterval <= 0 {
+		return
+	}
+
+	t := time.NewTicker(AvailabilityInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			bs.checkAvailability(ctx, cs)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (bs *BlockSync) checkAvailability(ctx context.Context, cs *store.ChainStore) {
+	head := cs.GetHeaviestTipSet()
+	if head == nil || head.Height() <= AvailabilityMinDepth {
+		return
+	}
+
+	low := head.Height() - AvailabilityMaxDepth
+	if low < 1 {
+		low = 1
+	}
+	high := head.Height() - AvailabilityMinDepth
+	h := low + abi.ChainEpoch(rand.Int63n(int64(high-low+1)))
+
+	ts, err := cs.GetTipsetByHeight(ctx, h, head, true)
+	if err != nil {
+		log.Warnw("loading tipset to probe peers with", "height", h, "error", err)
+		return
+	}
+
+	peers := bs.getPeers()
+	rand.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+	if len(peers) > AvailabilityPeers {
+		peers = peers[:AvailabilityPeers]
+	}
+	if len(peers) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	results := make([]probeResult, len(peers))
+	for i, p := range peers {
+		wg.Add(1)
+		go func(i int, p peer.ID) {
+			defer wg.Done()
+			results[i] = bs.probe(ctx, p, ts)
+		}(i, p)
+	}
+	wg.Wait()
+
+	var served, missing int
+	for _, r := range results {
+		switch r {
+		case probeServed:
+			served++
+		case probeMissing:
+			missing++
+		}
+	}
+
+	if missing > served {
+		log.Warnw("most probed peers don't have a tipset of our chain, we may be on a minority fork",
+			"height", ts.Height(), "tipset", ts.Cids(), "served", served, "missing", missing)
+	} else {
+		log.Debugw("probed peers for chain availability", "height", ts.Height(), "served", served, "missing", missing)
+	}
+}
+
+type probeKey struct{}
+
+// isProbe returns true for the context of availability probes. Their results
+// are only recorded by logProbe, not in the request stats of the peer tracker,
+// nor in the request metrics.
+func isProbe(ctx context.Context) bool {
+	return ctx.Value(probeKey{}) != nil
+}
+
+func (bs *BlockSync) probe(ctx context.Context, p peer.ID, ts *types.TipSet) probeResult {
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, probeKey{}, true), AvailabilityTimeout)
+	defer cancel()
+
+	req := &BlockSyncRequest{
+		Start:         ts.Cids(),
+		RequestLength: 1,
+		Options:       BSOptBlocks,
+	}
+
+	result := probeFailed
+	res, err := bs.sendRequestToPeer(ctx, p, req)
+	switch {
+	case err != nil:
+		log.Debugw("availability probe failed", "peer", p, "error", err)
+	case res.Status == StatusOK:
+		result = probeServed
+	case res.Status == StatusNotFound:
+		result = probeMissing
+	}
+
+	bs.syncPeers.logProbe(p, ts.Height(), result)
+	return result
+}
+
+func (bpt *bsPeerTracker) logProbe(p peer.ID, h abi.ChainEpoch, r probeResult) {
+	bpt.lk.Lock()
+	defer bpt.lk.Unlock()
+
+	pi, ok := bpt.peers[p]
+	if !ok {
+		return
+	}
+
+	pi.probe.probes++
+	pi.probe.lastProbe = time.Now()
+	switch r {
+	case probeServed:
+		pi.probe.served++
+	case probeMissing:
+		pi.probe.missing++
+		pi.probe.lastMissing = h
+		// the peer doesn't serve the chain we follow, ask it later
+		pi.failures++
+		if bpt.pmgr != nil {
+			bpt.pmgr.ReportSyncResult(p, false, pi.averageTime)
+		}
+	case probeFailed:
+		pi.probe.failed++
+	}
+}
+
+func (bpt *bsPeerTracker) health() []api.PeerHealth {
+	bpt.lk.Lock()
+	defer bpt.lk.Unlock()
+
+	out := make([]api.PeerHealth, 0, len(bpt.peers))
+	for p, pi := range bpt.peers {
+		ph := api.PeerHealth{
+			ID:          p,
+			Probes:      pi.probe.probes,
+			Served:      pi.probe.served,
+			Missing:     pi.probe.missing,
+			Failed:      pi.probe.failed,
+			LastProbe:   pi.probe.lastProbe,
+			LastMissing: pi.probe.lastMissing,
+		}
+		if n := pi.probe.served + pi.probe.missing; n > 0 {
+			ph.Availability = float64(pi.probe.served) / float64(n)
+		}
+		out = append(out, ph)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// PeerHealth returns the results of the availability probes of sync peers
+func (bs *BlockSync) PeerHealth() []api.PeerHealth {
+	return bs.syncPeers.health()
+}
@@ -0,0 +1,75 @@
+package blocksync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+	"github.com/filecoin-project/lotus/lib/peermgr"
+)
+
+func TestProbeNotCountedAsRequest(t *testing.T) {
+	ctx := context.TODO()
+
+	mn := mocknet.New(ctx)
+	client, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+
+	chain := testChain(5)
+	cs := store.NewChainStore(blockstore.NewBlockstore(datastore.NewMapDatastore()), datastore.NewMapDatastore(), nil)
+	for _, ts := range chain {
+		if err := cs.PersistBlockHeaders(ts.Blocks()...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server.SetStreamHandler(BlockSyncProtocolID, NewBlockSyncService(cs, DefaultServerLimits).HandleStream)
+	if err := client.Peerstore().AddProtocols(server.ID(), BlockSyncProtocolID); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := NewBlockSyncClient(nil, client, peermgr.MaybePeerMgr{}, nil, datastore.NewMapDatastore(), DefaultClientTimeouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs.AddPeer(server.ID())
+
+	if r := bs.probe(ctx, server.ID(), chain[3]); r != probeServed {
+		t.Fatalf("expected the tipset to be served, got %d", r)
+	}
+	other := mock.TipSet(mock.MkBlock(chain[2], 1, 100))
+	if r := bs.probe(ctx, server.ID(), other); r == probeServed {
+		t.Fatal("expected the unknown tipset not to be served")
+	}
+
+	bs.syncPeers.lk.Lock()
+	pi := bs.syncPeers.peers[server.ID()]
+	successes, failures, probes := pi.successes, pi.failures, pi.probe.probes
+	bs.syncPeers.lk.Unlock()
+
+	if probes != 2 {
+		t.Fatalf("expected 2 probes, got %d", probes)
+	}
+	if successes != 0 {
+		t.Fatalf("expected probes not to count as successful requests, got %d", successes)
+	}
+	if failures > 1 {
+		t.Fatalf("expected the missing tipset to count once at most, got %d failures", failures)
+	}
+}
@@ -3,6 +3,7 @@ package blocksync
 import (
 	"bufio"
 	"context"
+	"io/ioutil"
 	"time"
 
 	"github.com/libp2p/go-libp2p-core/protocol"
@@ -13,6 +14,8 @@ import (
 
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
+	incrt "github.com/filecoin-project/lotus/lib/increadtimeout"
+	"github.com/filecoin-project/lotus/metrics"
 
 	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
@@ -28,6 +31,13 @@ const BlockSyncProtocolID = "/fil/sync/blk/0.0.1"
 
 const BlockSyncMaxRequestLength = 800
 
+// Read timeouts of the protocol messages, see incrt.Config
+var (
+	HandshakeReadConfig = incrt.Config{MinSpeed: 1 << 10, MaxWait: 5 * time.Second, SizeHint: 64}
+	RequestReadConfig   = incrt.Config{MinSpeed: 1 << 10, MaxWait: 10 * time.Second, SizeHint: 1 << 10}
+	ResponseReadConfig  = incrt.Config{MinSpeed: 50 << 10, MaxWait: 5 * time.Second, Jitter: time.Second}
+)
+
 // BlockSyncService is the component that services BlockSync requests from
 // peers.
 //
@@ -38,16 +48,22 @@ const BlockSyncMaxRequestLength = 800
 // amount of blocks requested beyond the anchor (including the anchor itself).
 //
 // A client can also pass options, encoded as a 64-bit bitfield. Lotus supports
-// two options at the moment:
+// three options at the moment:
 //
 //  - include block contents
 //  - include block messages
+//  - compress the response (only on streams which negotiated CapCompression)
 //
 // The response will include a status code, an optional message, and the
 // response payload in case of success. The payload is a slice of serialized
 // tipsets.
+//
+// Newer peers speak BlockSyncProtocolIDv2, which prefixes the exchange with a
+// handshake negotiating optional capabilities (see BSCapabilities).
 type BlockSyncService struct {
 	cs *store.ChainStore
+
+	limiter *serverLimiter
 }
 
 type BlockSyncRequest struct {
@@ -60,18 +76,23 @@ type BlockSyncRequest struct {
 type BSOptions struct {
 	IncludeBlocks   bool
 	IncludeMessages bool
+	Compressed      bool
 }
 
 func ParseBSOptions(optfield uint64) *BSOptions {
 	return &BSOptions{
 		IncludeBlocks:   optfield&(BSOptBlocks) != 0,
 		IncludeMessages: optfield&(BSOptMessages) != 0,
+		Compressed:      optfield&(BSOptCompressed) != 0,
 	}
 }
 
 const (
 	BSOptBlocks = 1 << iota
 	BSOptMessages
+	// BSOptCompressed asks for a compressed response, only valid on streams
+	// which negotiated CapCompression
+	BSOptCompressed
 )
 
 const (
@@ -88,6 +109,10 @@ type BlockSyncResponse struct {
 
 	Status  uint64
 	Message string
+
+	// retryAfter is the retry hint of go away responses, it's sent in a
+	// BSGoAway following the response
+	retryAfter time.Duration
 }
 
 type BSTipSet struct {
@@ -100,39 +125,112 @@ type BSTipSet struct {
 	SecpkMsgIncludes [][]uint64
 }
 
-func NewBlockSyncService(cs *store.ChainStore) *BlockSyncService {
+func NewBlockSyncService(cs *store.ChainStore, limits ServerLimits) *BlockSyncService {
 	return &BlockSyncService{
-		cs: cs,
+		cs:      cs,
+		limiter: newServerLimiter(limits),
 	}
 }
 
+// HandleStream serves a BlockSyncProtocolID (v1) stream.
 func (bss *BlockSyncService) HandleStream(s inet.Stream) {
+	bss.handleStream(s, false)
+}
+
+// HandleStreamV2 serves a BlockSyncProtocolIDv2 stream, which starts with a
+// capability handshake.
+func (bss *BlockSyncService) HandleStreamV2(s inet.Stream) {
+	bss.handleStream(s, true)
+}
+
+func (bss *BlockSyncService) handleStream(s inet.Stream, handshake bool) {
 	ctx, span := trace.StartSpan(context.Background(), "blocksync.HandleStream")
 	defer span.End()
 
 	defer s.Close() //nolint:errcheck
+	defer streamOpened(ctx, metrics.BlocksyncServerStreams, &serverStreams)()
+
+	var caps BSCapabilities
+	if handshake {
+		var err error
+		caps, err = negotiateServer(s)
+		if err != nil {
+			log.Warnf("blocksync handshake failed: %s", err)
+			return
+		}
+	}
+	span.AddAttributes(trace.Int64Attribute("caps", int64(caps)))
 
 	var req BlockSyncRequest
-	if err := cborutil.ReadCborRPC(bufio.NewReader(s), &req); err != nil {
+	if err := cborutil.ReadCborRPC(bufio.NewReader(incrt.NewWithConfig(s, RequestReadConfig)), &req); err != nil {
 		log.Warnf("failed to read block sync request: %s", err)
 		return
 	}
 	log.Infow("block sync request", "start", req.Start, "len", req.RequestLength)
 
-	resp, err := bss.processRequest(ctx, s.Conn().RemotePeer(), &req)
-	if err != nil {
-		log.Warn("failed to process block sync request: ", err)
+	var resp *BlockSyncResponse
+	release, retryAfter, ok := bss.admit(ctx, s, &req)
+	if !ok && retryAfter < 0 {
+		log.Debugw("block sync request abandoned while queued", "peer", s.Conn().RemotePeer())
 		return
 	}
+	if ok {
+		var err error
+		resp, err = bss.processRequest(ctx, s.Conn().RemotePeer(), &req)
+		release()
+		if err != nil {
+			log.Warn("failed to process block sync request: ", err)
+			return
+		}
+	} else {
+		log.Debugw("rate limiting block sync request", "peer", s.Conn().RemotePeer(), "retryAfter", retryAfter)
+		resp = goAwayResponse("request limit exceeded", retryAfter)
+	}
 
 	writeDeadline := 60 * time.Second
 	_ = s.SetDeadline(time.Now().Add(writeDeadline))
-	if err := cborutil.WriteCborRPC(s, resp); err != nil {
+	compress := caps.Has(CapCompression) && ParseBSOptions(req.Options).Compressed
+	cw := &countingWriter{w: s}
+	err := writeResponse(cw, resp, caps, compress)
+	recordServerRequest(ctx, resp, cw.n)
+	if err != nil {
 		log.Warnw("failed to write back response for handle stream", "err", err, "peer", s.Conn().RemotePeer())
 		return
 	}
 }
 
+// admit admits the request with the limiter. The client doesn't send anything
+// after its request, so reads on the stream only return once the client closes
+// or resets it, which stops waiting for a processing slot: the stream isn't held
+// for requests the client gave up on. A negative retry hint is returned for
+// those.
+func (bss *BlockSyncService) admit(ctx context.Context, s inet.Stream, req *BlockSyncRequest) (func(), time.Duration, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		var b [1]byte
+		if _, err := s.Read(b[:]); err != nil {
+			cancel()
+		}
+	}()
+
+	release, retryAfter, ok := bss.limiter.admit(ctx, s.Conn().RemotePeer(), req.RequestLength)
+	abandoned := !ok && ctx.Err() != nil
+
+	// stop watching the stream
+	_ = s.SetReadDeadline(time.Now())
+	<-watched
+	_ = s.SetReadDeadline(time.Time{})
+
+	if abandoned {
+		return nil, -1, false
+	}
+	return release, retryAfter, ok
+}
+
 func (bss *BlockSyncService) processRequest(ctx context.Context, p peer.ID, req *BlockSyncRequest) (*BlockSyncResponse, error) {
 	_, span := trace.StartSpan(ctx, "blocksync.ProcessRequest")
 	defer span.End()
@@ -157,7 +255,8 @@ func (bss *BlockSyncService) processRequest(ctx context.Context, p peer.ID, req
 		reqlen = BlockSyncMaxRequestLength
 	}
 
-	chain, err := collectChainSegment(bss.cs, types.NewTipSetKey(req.Start...), reqlen, opts)
+	budget := bss.limiter.byteBudget(p)
+	chain, size, cut, err := collectChainSegment(bss.cs, types.NewTipSetKey(req.Start...), reqlen, budget, opts)
 	if err != nil {
 		log.Warn("encountered error while responding to block sync request: ", err)
 		return &BlockSyncResponse{
@@ -166,10 +265,16 @@ func (bss *BlockSyncService) processRequest(ctx context.Context, p peer.ID, req
 		}, nil
 	}
 
+	bss.limiter.charge(p, size)
+
 	status := StatusOK
 	if reqlen < req.RequestLength {
 		status = StatusPartial
 	}
+	if cut {
+		log.Debugw("blocksync response cut to the peer byte quota", "peer", p, "requested", reqlen, "sent", len(chain))
+		status = StatusPartial
+	}
 
 	return &BlockSyncResponse{
 		Chain:  chain,
@@ -177,20 +282,24 @@ func (bss *BlockSyncService) processRequest(ctx context.Context, p peer.ID, req
 	}, nil
 }
 
-func collectChainSegment(cs *store.ChainStore, start types.TipSetKey, length uint64, opts *BSOptions) ([]*BSTipSet, error) {
+// collectChainSegment loads up to length tipsets, walking back from start.
+// Once the encoded tipsets take maxBytes, no more are added, but at least one
+// is returned, and cut is set. A negative maxBytes doesn't limit the segment.
+// size is the encoded size of the segment.
+func collectChainSegment(cs *store.ChainStore, start types.TipSetKey, length uint64, maxBytes int64, opts *BSOptions) (_ []*BSTipSet, size int64, cut bool, _ error) {
 	var bstips []*BSTipSet
 	cur := start
 	for {
 		var bst BSTipSet
 		ts, err := cs.LoadTipSet(cur)
 		if err != nil {
-			return nil, xerrors.Errorf("failed loading tipset %s: %w", cur, err)
+			return nil, 0, false, xerrors.Errorf("failed loading tipset %s: %w", cur, err)
 		}
 
 		if opts.IncludeMessages {
 			bmsgs, bmincl, smsgs, smincl, err := gatherMessages(cs, ts)
 			if err != nil {
-				return nil, xerrors.Errorf("gather messages failed: %w", err)
+				return nil, 0, false, xerrors.Errorf("gather messages failed: %w", err)
 			}
 
 			bst.BlsMessages = bmsgs
@@ -203,10 +312,19 @@ func collectChainSegment(cs *store.ChainStore, start types.TipSetKey, length uin
 			bst.Blocks = ts.Blocks()
 		}
 
+		cw := &countingWriter{w: ioutil.Discard}
+		if err := bst.MarshalCBOR(cw); err != nil {
+			return nil, 0, false, xerrors.Errorf("encoding tipset %s: %w", cur, err)
+		}
+		if maxBytes >= 0 && len(bstips) > 0 && size+cw.n > maxBytes {
+			return bstips, size, true, nil
+		}
+
 		bstips = append(bstips, &bst)
+		size += cw.n
 
 		if uint64(len(bstips)) >= length || ts.Height() == 0 {
-			return bstips, nil
+			return bstips, size, false, nil
 		}
 
 		cur = ts.Parents()
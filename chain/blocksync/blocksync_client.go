@@ -1,7 +1,6 @@
 package blocksync
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"math/rand"
@@ -17,17 +16,61 @@ import (
 	host "github.com/libp2p/go-libp2p-core/host"
 	inet "github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 	"go.opencensus.io/trace"
 	"golang.org/x/xerrors"
 
 	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 	incrt "github.com/filecoin-project/lotus/lib/increadtimeout"
 	"github.com/filecoin-project/lotus/lib/peermgr"
+	"github.com/filecoin-project/lotus/metrics"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
 
+// HedgeDelay is how long requests wait for a response from the best peer
+// before sending the same request to the second best one, taking whichever
+// response comes first. Once enough requests were observed the delay is
+// derived from their latencies, see HedgePercentile. Zero disables hedging.
+var HedgeDelay = 3 * time.Second
+
+// BitswapStallTimeout is how long message fetches wait for bitswap to deliver
+// the next message, before fetching the missing ones from sync peers
+var BitswapStallTimeout = 5 * time.Second
+
+// MaxPeerRequests is the number of requests sent to a single peer at the same
+// time. Peers which are busy are tried after the idle ones.
+var MaxPeerRequests = 2
+
+// RequestChunkSize is the largest number of tipsets requested from a single
+// peer. Larger GetBlocks requests are split into chunks, which are sent to
+// different peers.
+var RequestChunkSize = 100
+
+// GoAwayCooldown is how long a peer which answered with StatusGoAway is only
+// asked after all other peers, unless it sent a retry hint. Hints are capped to
+// MaxGoAwayCooldown.
+var (
+	GoAwayCooldown    = 30 * time.Second
+	MaxGoAwayCooldown = 10 * time.Minute
+)
+
+// ErrGoAway is returned for requests the peer refused to serve
+var ErrGoAway = xerrors.New("peer sent go away response")
+
+// Sizes used to compute the byte budget of a response, see responseBudget
+var (
+	MaxResponseSize    = int64(512 << 20)
+	maxBlockHeaderSize = int64(16 << 10)
+	maxMessageSize     = int64(32 << 10) // same as the mpool limit
+	maxTipSetBlocks    = 3 * int64(build.BlocksPerEpoch)
+	responseOverhead   = int64(1 << 10)
+)
+
 type BlockSync struct {
 	bserv bserv.BlockService
 	gsync graphsync.GraphExchange
@@ -35,26 +78,42 @@ type BlockSync struct {
 
 	syncPeers *bsPeerTracker
 	peerMgr   *peermgr.PeerMgr
+
+	timeouts ClientTimeouts
 }
 
-func NewBlockSyncClient(bserv dtypes.ChainBlockService, h host.Host, pmgr peermgr.MaybePeerMgr, gs dtypes.Graphsync) *BlockSync {
+func NewBlockSyncClient(bserv dtypes.ChainBlockService, h host.Host, pmgr peermgr.MaybePeerMgr, gs dtypes.Graphsync, ds dtypes.MetadataDS, timeouts ClientTimeouts) (*BlockSync, error) {
+	rep, err := loadReputations(ds)
+	if err != nil {
+		return nil, xerrors.Errorf("loading blocksync peer reputations: %w", err)
+	}
+
+	ps, err := loadPeerStats(ds, time.Now())
+	if err != nil {
+		return nil, xerrors.Errorf("loading blocksync peer stats: %w", err)
+	}
+
 	return &BlockSync{
 		bserv:     bserv,
 		host:      h,
-		syncPeers: newPeerTracker(pmgr.Mgr),
+		syncPeers: newPeerTracker(pmgr.Mgr, rep, ps),
 		peerMgr:   pmgr.Mgr,
 		gsync:     gs,
-	}
+		timeouts:  timeouts,
+	}, nil
 }
 
+// processStatus returns the error for a response which can't be used. Partial
+// responses are used by the callers, which process the tipsets they include,
+// and go away responses are turned into ErrGoAway errors when they're received.
 func (bs *BlockSync) processStatus(req *BlockSyncRequest, res *BlockSyncResponse) error {
 	switch res.Status {
 	case StatusPartial: // Partial Response
-		return xerrors.Errorf("not handling partial blocksync responses yet")
+		return xerrors.Errorf("partial blocksync response without usable tipsets: %s", res.Message)
 	case StatusNotFound: // req.Start not found
 		return xerrors.Errorf("not found")
 	case StatusGoAway: // Go Away
-		return xerrors.Errorf("not handling 'go away' blocksync responses yet")
+		return xerrors.Errorf("%w: %s", ErrGoAway, res.Message)
 	case StatusInternalError: // Internal Error
 		return xerrors.Errorf("block sync peer errored: %s", res.Message)
 	case StatusBadRequest:
@@ -79,6 +138,49 @@ func (bs *BlockSync) GetBlocks(ctx context.Context, tsk types.TipSetKey, count i
 		)
 	}
 
+	if RequestChunkSize > 0 && count > RequestChunkSize {
+		return bs.getBlocksChunked(ctx, tsk, count)
+	}
+
+	return bs.getBlocks(ctx, tsk, count, 0)
+}
+
+// getBlocksChunked fetches a long chain segment in chunks of RequestChunkSize
+// tipsets, and checks that the chunks link up.
+func (bs *BlockSync) getBlocksChunked(ctx context.Context, tsk types.TipSetKey, count int) ([]*types.TipSet, error) {
+	out := make([]*types.TipSet, 0, count)
+	cur := tsk
+
+	for chunk := 0; len(out) < count; chunk++ {
+		n := count - len(out)
+		if n > RequestChunkSize {
+			n = RequestChunkSize
+		}
+
+		tss, err := bs.getBlocks(ctx, cur, n, chunk)
+		if err != nil {
+			return nil, xerrors.Errorf("fetching chunk %d (%d tipsets from %s): %w", chunk, n, cur, err)
+		}
+
+		// getBlocks returns at least one tipset, starting with the requested one
+		if len(out) > 0 && !types.CidArrsEqual(out[len(out)-1].Parents().Cids(), tss[0].Cids()) {
+			return nil, xerrors.Errorf("chunk %d doesn't link to the previous chunk", chunk)
+		}
+		out = append(out, tss...)
+
+		last := tss[len(tss)-1]
+		if last.Height() == 0 {
+			break
+		}
+		cur = last.Parents()
+	}
+
+	return out, nil
+}
+
+// getBlocks sends a single GetBlocks request. The chunk index is used to
+// spread the chunks of a split request over the best peers.
+func (bs *BlockSync) getBlocks(ctx context.Context, tsk types.TipSetKey, count int, chunk int) ([]*types.TipSet, error) {
 	req := &BlockSyncRequest{
 		Start:         tsk.Cids(),
 		RequestLength: uint64(count),
@@ -91,24 +193,26 @@ func (bs *BlockSync) GetBlocks(ctx context.Context, tsk types.TipSetKey, count i
 	// randomize the first few peers so we don't always pick the same peer
 	shufflePrefix(peers)
 
+	if chunk > 0 && len(peers) > 0 {
+		k := chunk % len(peers)
+		rotated := make([]peer.ID, 0, len(peers))
+		peers = append(append(rotated, peers[k:]...), peers[:k]...)
+	}
+
 	start := time.Now()
 	var oerr error
 
-	for _, p := range peers {
-		// TODO: doing this synchronously isnt great, but fetching in parallel
-		// may not be a good idea either. think about this more
+	for len(peers) > 0 {
 		select {
 		case <-ctx.Done():
 			return nil, xerrors.Errorf("blocksync getblocks failed: %w", ctx.Err())
 		default:
 		}
 
-		res, err := bs.sendRequestToPeer(ctx, p, req)
+		p, res, used, err := bs.sendHedgedRequest(ctx, peers, req)
+		peers = peers[used:]
 		if err != nil {
 			oerr = err
-			if !xerrors.Is(err, inet.ErrNoConn) {
-				log.Warnf("BlockSync request failed for peer %s: %s", p.String(), err)
-			}
 			continue
 		}
 
@@ -130,8 +234,81 @@ func (bs *BlockSync) GetBlocks(ctx context.Context, tsk types.TipSetKey, count i
 	return nil, xerrors.Errorf("GetBlocks failed with all peers: %w", oerr)
 }
 
+type peerResponse struct {
+	p   peer.ID
+	res *BlockSyncResponse
+	err error
+	dur time.Duration
+}
+
+// sendHedgedRequest sends the request to the first peer, and to the second one
+// if there is no response within the hedge deadline. The first response is returned,
+// the other request is cancelled. It also returns the number of peers used.
+func (bs *BlockSync) sendHedgedRequest(ctx context.Context, peers []peer.ID, req *BlockSyncRequest) (peer.ID, *BlockSyncResponse, int, error) {
+	// each request has its own context, the request which loses the race is
+	// cancelled, which resets its stream, as soon as the winner returns
+	var cancels []context.CancelFunc
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	// buffered, so that the request we don't wait for doesn't block
+	results := make(chan peerResponse, 2)
+	send := func(p peer.ID) {
+		rctx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		go func() {
+			start := time.Now()
+			res, err := bs.sendRequestToPeer(rctx, p, req)
+			results <- peerResponse{p: p, res: res, err: err, dur: time.Since(start)}
+		}()
+	}
+
+	send(peers[0])
+	used, pending := 1, 1
+
+	var hedge <-chan time.Time
+	if d := bs.syncPeers.hedgeDelay(req.RequestLength); d > 0 && len(peers) > 1 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		hedge = t.C
+	}
+
+	var last peerResponse
+	for pending > 0 {
+		select {
+		case <-hedge:
+			log.Debugw("no blocksync response in time, hedging request", "slow", peers[0], "peer", peers[1])
+			send(peers[1])
+			used++
+			pending++
+			hedge = nil
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				bs.syncPeers.logLatency(req.RequestLength, r.dur)
+				return r.p, r.res, used, nil
+			}
+			if !xerrors.Is(r.err, inet.ErrNoConn) {
+				log.Warnf("BlockSync request failed for peer %s: %s", r.p.String(), r.err)
+			}
+			last = r
+		case <-ctx.Done():
+			return "", nil, used, ctx.Err()
+		}
+	}
+
+	return last.p, nil, used, last.err
+}
+
+// GetFullTipSet fetches a tipset with its messages. The peer is a hint, e.g.
+// the peer which announced the tipset, and is asked first if set. The other
+// sync peers are tried in order of preference if it fails.
 func (bs *BlockSync) GetFullTipSet(ctx context.Context, p peer.ID, tsk types.TipSetKey) (*store.FullTipSet, error) {
-	// TODO: round robin through these peers on error
+	ctx, span := trace.StartSpan(ctx, "bsync.GetFullTipSet")
+	defer span.End()
 
 	req := &BlockSyncRequest{
 		Start:         tsk.Cids(),
@@ -139,32 +316,65 @@ func (bs *BlockSync) GetFullTipSet(ctx context.Context, p peer.ID, tsk types.Tip
 		Options:       BSOptBlocks | BSOptMessages,
 	}
 
-	res, err := bs.sendRequestToPeer(ctx, p, req)
-	if err != nil {
-		return nil, err
+	peers := bs.getPeers()
+	shufflePrefix(peers)
+	if p != "" {
+		peers = withHint(p, peers)
 	}
 
-	switch res.Status {
-	case 0: // Success
-		if len(res.Chain) == 0 {
-			return nil, fmt.Errorf("got zero length chain response")
-		}
-		bts := res.Chain[0]
-
-		return bstsToFullTipSet(bts)
-	case 101: // Partial Response
-		return nil, xerrors.Errorf("partial responses are not handled for single tipset fetching")
-	case 201: // req.Start not found
-		return nil, fmt.Errorf("not found")
-	case 202: // Go Away
-		return nil, xerrors.Errorf("received 'go away' response peer")
-	case 203: // Internal Error
-		return nil, fmt.Errorf("block sync peer errored: %q", res.Message)
-	case 204: // Invalid Request
-		return nil, fmt.Errorf("block sync request invalid: %q", res.Message)
-	default:
-		return nil, fmt.Errorf("unrecognized response code")
+	start := time.Now()
+	var oerr error
+
+	for len(peers) > 0 {
+		sp, res, used, err := bs.sendHedgedRequest(ctx, peers, req)
+		peers = peers[used:]
+		if err != nil {
+			oerr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		// the single tipset of a partial response is as good as a complete one
+		if res.Status == StatusOK || res.Status == StatusPartial {
+			if len(res.Chain) == 0 {
+				oerr = xerrors.Errorf("got zero length chain response from peer %s", sp)
+				continue
+			}
+
+			fts, err := bstsToFullTipSet(res.Chain[0])
+			if err != nil {
+				oerr = xerrors.Errorf("response from peer %s failed to process: %w", sp, err)
+				log.Warn(oerr)
+				continue
+			}
+
+			bs.syncPeers.logGlobalSuccess(time.Since(start))
+			return fts, nil
+		}
+
+		oerr = bs.processStatus(req, res)
+		log.Warnf("BlockSync peer %s response was an error: %s", sp.String(), oerr)
 	}
+
+	if oerr == nil {
+		return nil, xerrors.Errorf("GetFullTipSet failed, no peers connected")
+	}
+	return nil, xerrors.Errorf("GetFullTipSet failed with all peers: %w", oerr)
+}
+
+// withHint moves the hinted peer to the front of the peer set, adding it if
+// it isn't a sync peer (yet)
+func withHint(hint peer.ID, peers []peer.ID) []peer.ID {
+	out := make([]peer.ID, 0, len(peers)+1)
+	out = append(out, hint)
+	for _, p := range peers {
+		if p != hint {
+			out = append(out, p)
+		}
+	}
+	return out
 }
 
 func shufflePrefix(peers []peer.ID) {
@@ -187,6 +397,7 @@ func (bs *BlockSync) GetChainMessages(ctx context.Context, h *types.TipSet, coun
 	defer span.End()
 
 	peers := bs.getPeers()
+	npeers := len(peers)
 	// randomize the first few peers so we don't always pick the same peer
 	shufflePrefix(peers)
 
@@ -199,11 +410,20 @@ func (bs *BlockSync) GetChainMessages(ctx context.Context, h *types.TipSet, coun
 	var err error
 	start := time.Now()
 
-	for _, p := range peers {
+	for len(peers) > 0 {
+		// message requests aren't hedged, their responses are large, and a
+		// hedge would fetch them twice
+		p := peers[0]
+		peers = peers[1:]
 		res, rerr := bs.sendRequestToPeer(ctx, p, req)
 		if rerr != nil {
+			if !xerrors.Is(rerr, inet.ErrNoConn) {
+				log.Warnf("BlockSync request failed for peer %s: %s", p.String(), rerr)
+			}
 			err = rerr
-			log.Warnf("BlockSync request failed for peer %s: %s", p.String(), err)
+			if ctx.Err() != nil {
+				break
+			}
 			continue
 		}
 
@@ -228,7 +448,7 @@ func (bs *BlockSync) GetChainMessages(ctx context.Context, h *types.TipSet, coun
 	}
 
 	// TODO: What if we have no peers (and err is nil)?
-	return nil, xerrors.Errorf("GetChainMessages failed with all peers(%d): %w", len(peers), err)
+	return nil, xerrors.Errorf("GetChainMessages failed with all peers(%d): %w", npeers, err)
 }
 
 func (bs *BlockSync) sendRequestToPeer(ctx context.Context, p peer.ID, req *BlockSyncRequest) (_ *BlockSyncResponse, err error) {
@@ -252,57 +472,168 @@ func (bs *BlockSync) sendRequestToPeer(ctx context.Context, p peer.ID, req *Bloc
 		)
 	}
 
+	if bs.syncPeers.banned(p) {
+		return nil, xerrors.Errorf("peer %s is banned from blocksync", p)
+	}
+
+	release, err := bs.syncPeers.acquire(ctx, p)
+	if err != nil {
+		return nil, xerrors.Errorf("waiting for a free request slot: %w", err)
+	}
+	defer release()
+
 	gsproto := string(gsnet.ProtocolGraphsync)
-	supp, err := bs.host.Peerstore().SupportsProtocols(p, BlockSyncProtocolID, gsproto)
+	supp, err := bs.host.Peerstore().SupportsProtocols(p, BlockSyncProtocolIDv2, BlockSyncProtocolID, gsproto)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to get protocols for peer: %w", err)
 	}
 
-	if len(supp) == 0 {
+	proto, ok := pickSyncProtocol(supp, gsproto, bs.timeouts.PreferGraphsync)
+	if !ok {
 		return nil, xerrors.Errorf("peer %s supports no known sync protocols", p)
 	}
 
-	switch supp[0] {
-	case BlockSyncProtocolID:
-		res, err := bs.fetchBlocksBlockSync(ctx, p, req)
+	start := time.Now()
+	metricsProto := protoBlockSync
+	var res *BlockSyncResponse
+	defer func() {
+		if !isProbe(ctx) {
+			recordClientRequest(ctx, metricsProto, res, err, time.Since(start))
+		}
+	}()
+
+	switch proto {
+	case BlockSyncProtocolIDv2, BlockSyncProtocolID:
+		res, err = bs.fetchBlocksBlockSync(ctx, p, req)
 		if err != nil {
 			return nil, xerrors.Errorf("blocksync req failed: %w", err)
 		}
-		return res, nil
 	case gsproto:
-		res, err := bs.fetchBlocksGraphSync(ctx, p, req)
+		metricsProto = protoGraphsync
+		res, err = bs.fetchBlocksGraphSync(ctx, p, req)
 		if err != nil {
-			return nil, xerrors.Errorf("graphsync req failed: %w", err)
+			if !supportsBlockSync(supp) {
+				return nil, xerrors.Errorf("graphsync req failed: %w", err)
+			}
+
+			log.Infow("graphsync traversal failed, falling back to blocksync", "peer", p, "error", err)
+			metricsProto = protoBlockSync
+			res, err = bs.fetchBlocksBlockSync(ctx, p, req)
+			if err != nil {
+				return nil, xerrors.Errorf("blocksync req failed after graphsync fallback: %w", err)
+			}
 		}
-		return res, nil
 	default:
 		return nil, xerrors.Errorf("peerstore somehow returned unexpected protocols: %v", supp)
 	}
 
+	if err := validateResponse(req, res); err != nil {
+		bs.syncPeers.logMisbehavior(p, err)
+		return nil, xerrors.Errorf("invalid response from peer %s: %w", p, err)
+	}
+
+	if res.Status == StatusGoAway {
+		// let the caller move on to the next peer right away, this one is
+		// skipped until the cooldown ends
+		return nil, bs.handleGoAway(ctx, p, res)
+	}
+
+	return res, nil
+}
+
+// handleGoAway deprioritizes a peer which refused to serve a request, and
+// returns an ErrGoAway error.
+func (bs *BlockSync) handleGoAway(ctx context.Context, p peer.ID, res *BlockSyncResponse) error {
+	cooldown := bs.syncPeers.logGoAway(p, res)
+
+	ctx, _ = tag.New(ctx, tag.Insert(metrics.PeerID, p.String()))
+	stats.Record(ctx, metrics.BlocksyncGoAway.M(1))
+
+	return xerrors.Errorf("%w: %s (cooling down for %s)", ErrGoAway, res.Message, cooldown)
 }
+
 func (bs *BlockSync) fetchBlocksBlockSync(ctx context.Context, p peer.ID, req *BlockSyncRequest) (*BlockSyncResponse, error) {
 	ctx, span := trace.StartSpan(ctx, "blockSyncFetch")
 	defer span.End()
 
 	start := time.Now()
-	s, err := bs.host.NewStream(inet.WithNoDial(ctx, "should already have connection"), p, BlockSyncProtocolID)
+	s, err := bs.host.NewStream(inet.WithNoDial(ctx, "should already have connection"), p, BlockSyncProtocols...)
 	if err != nil {
 		bs.RemovePeer(p)
 		return nil, xerrors.Errorf("failed to open stream to peer: %w", err)
 	}
-	_ = s.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	defer s.Close() //nolint:errcheck
+	defer streamOpened(ctx, metrics.BlocksyncClientStreams, &clientStreams)()
+	_ = s.SetWriteDeadline(time.Now().Add(bs.timeouts.WriteTimeout))
+
+	// reads and writes only time out, the stream is reset when the request is
+	// cancelled, e.g. when it lost a hedge
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = s.Reset()
+		case <-done:
+		}
+	}()
 
+	// a cancelled request isn't the fault of the peer
+	logFailure := func() {
+		if ctx.Err() == nil && !isProbe(ctx) {
+			bs.syncPeers.logFailure(p, time.Since(start))
+		}
+	}
+
+	var caps BSCapabilities
+	if s.Protocol() == BlockSyncProtocolIDv2 {
+		caps, err = negotiateClient(s)
+		if err != nil {
+			_ = s.SetWriteDeadline(time.Time{})
+			logFailure()
+			if xerrors.Is(err, errProtocolViolation) {
+				bs.syncPeers.logMisbehavior(p, err)
+			}
+			return nil, err
+		}
+		bs.syncPeers.setCapabilities(p, caps)
+
+		if span.IsRecordingEvents() {
+			span.AddAttributes(trace.Int64Attribute("caps", int64(caps)))
+		}
+	}
+
+	req = compressRequest(req, caps)
 	if err := cborutil.WriteCborRPC(s, req); err != nil {
 		_ = s.SetWriteDeadline(time.Time{})
-		bs.syncPeers.logFailure(p, time.Since(start))
+		logFailure()
 		return nil, err
 	}
 	_ = s.SetWriteDeadline(time.Time{})
 
 	var res BlockSyncResponse
-	r := incrt.New(s, 50<<10, 5*time.Second)
-	if err := cborutil.ReadCborRPC(bufio.NewReader(r), &res); err != nil {
-		bs.syncPeers.logFailure(p, time.Since(start))
+	rcfg := bs.timeouts.responseReadConfig(req)
+	cr := &countingReader{r: incrt.NewWithConfig(s, rcfg)}
+	r, verify, err := openResponse(cr, req, rcfg.MaxBytes)
+	if err != nil {
+		logFailure()
+		return nil, err
+	}
+	err = cborutil.ReadCborRPC(r, &res)
+	if err == nil {
+		err = readRetryAfter(r, &res, caps)
+	}
+	if err == nil {
+		err = verify()
+	}
+	stats.Record(ctx, metrics.BlocksyncClientBytesReceived.M(cr.n))
+	if err != nil {
+		logFailure()
+		if xerrors.Is(err, incrt.ErrTooLarge) {
+			log.Warnw("blocksync peer sent oversized response, dropping it", "peer", p, "budget", rcfg.MaxBytes)
+			bs.syncPeers.logMisbehavior(p, err)
+			bs.RemovePeer(p)
+		}
 		return nil, err
 	}
 
@@ -314,10 +645,32 @@ func (bs *BlockSync) fetchBlocksBlockSync(ctx context.Context, p peer.ID, req *B
 		)
 	}
 
-	bs.syncPeers.logSuccess(p, time.Since(start))
+	if !isProbe(ctx) {
+		bs.syncPeers.logSuccess(p, time.Since(start))
+	}
 	return &res, nil
 }
 
+// responseBudget returns the maximum size a valid response to the request can
+// have. Responses which are larger are aborted while they are read.
+func responseBudget(req *BlockSyncRequest) int64 {
+	opts := ParseBSOptions(req.Options)
+
+	var perTipSet int64
+	if opts.IncludeBlocks {
+		perTipSet += maxTipSetBlocks * maxBlockHeaderSize
+	}
+	if opts.IncludeMessages {
+		perTipSet += maxTipSetBlocks * build.BlockMessageLimit * maxMessageSize
+	}
+
+	budget := responseOverhead + int64(req.RequestLength)*perTipSet
+	if budget > MaxResponseSize || budget < 0 {
+		budget = MaxResponseSize
+	}
+	return budget
+}
+
 func (bs *BlockSync) processBlocksResponse(req *BlockSyncRequest, res *BlockSyncResponse) ([]*types.TipSet, error) {
 	if len(res.Chain) == 0 {
 		return nil, xerrors.Errorf("got no blocks in successful blocksync response")
@@ -363,6 +716,12 @@ func (bs *BlockSync) RemovePeer(p peer.ID) {
 	bs.syncPeers.removePeer(p)
 }
 
+// PeerScores returns the reputation of tracked peers, and of peers which are
+// no longer connected but still have a persisted reputation.
+func (bs *BlockSync) PeerScores() []api.BlocksyncPeer {
+	return bs.syncPeers.scoreboard()
+}
+
 // getPeers returns a preference-sorted set of peers to query.
 func (bs *BlockSync) getPeers() []peer.ID {
 	return bs.syncPeers.prefSortedPeers()
@@ -412,37 +771,87 @@ func (bs *BlockSync) FetchSignedMessagesByCids(ctx context.Context, cids []cid.C
 	return out, nil
 }
 
+// fetchCids fetches the blocks with a bitswap session, which routes the wants
+// to the peers that had the first blocks, e.g. the peer which propagated the
+// block header. When bitswap stalls for BitswapStallTimeout, the missing
+// blocks are fetched one by one from sync peers instead.
 func (bs *BlockSync) fetchCids(ctx context.Context, cids []cid.Cid, cb func(int, blocks.Block) error) error {
-	resp := bs.bserv.GetBlocks(context.TODO(), cids)
-
-	m := make(map[cid.Cid]int)
+	m := make(map[cid.Cid]int, len(cids))
 	for i, c := range cids {
 		m[c] = i
 	}
 
-	for i := 0; i < len(cids); i++ {
+	received, err := bs.fetchCidsBitswap(ctx, cids, m, cb)
+	if err != nil {
+		return err
+	}
+	if len(received) == len(m) {
+		return nil
+	}
+
+	log.Warnw("bitswap stalled fetching messages, fetching the rest from sync peers", "missing", len(m)-len(received), "total", len(m))
+
+	for _, c := range cids {
+		if _, ok := received[c]; ok {
+			continue
+		}
+
+		b, err := bs.fetchCidFromPeers(ctx, c)
+		if err != nil {
+			return xerrors.Errorf("failed to fetch message %s: %w", c, err)
+		}
+		if err := cb(m[c], b); err != nil {
+			return err
+		}
+		received[c] = struct{}{}
+	}
+
+	return nil
+}
+
+// fetchCidsBitswap returns the cids received before bitswap gave up or
+// stalled.
+func (bs *BlockSync) fetchCidsBitswap(ctx context.Context, cids []cid.Cid, m map[cid.Cid]int, cb func(int, blocks.Block) error) (map[cid.Cid]struct{}, error) {
+	// cancelled on return, so that the wants of a stalled session don't
+	// linger
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resp := bserv.NewSession(sctx, bs.bserv).GetBlocks(sctx, cids)
+
+	stall := time.NewTimer(BitswapStallTimeout)
+	defer stall.Stop()
+
+	received := make(map[cid.Cid]struct{}, len(m))
+	for len(received) < len(m) {
 		select {
 		case v, ok := <-resp:
 			if !ok {
-				if i == len(cids)-1 {
-					break
-				}
-
-				return fmt.Errorf("failed to fetch all messages")
+				return received, nil
 			}
 
 			ix, ok := m[v.Cid()]
 			if !ok {
-				return fmt.Errorf("received message we didnt ask for")
+				return nil, fmt.Errorf("received message we didnt ask for")
 			}
 
 			if err := cb(ix, v); err != nil {
-				return err
+				return nil, err
+			}
+			received[v.Cid()] = struct{}{}
+
+			if !stall.Stop() {
+				<-stall.C
 			}
+			stall.Reset(BitswapStallTimeout)
+		case <-stall.C:
+			return received, nil
+		case <-ctx.Done():
+			return nil, xerrors.Errorf("fetching messages: %w", ctx.Err())
 		}
 	}
 
-	return nil
+	return received, nil
 }
 
 type peerStats struct {
@@ -450,6 +859,30 @@ type peerStats struct {
 	failures    int
 	firstSeen   time.Time
 	averageTime time.Duration
+
+	// caps are the capabilities negotiated during the last v2 handshake with
+	// this peer
+	caps BSCapabilities
+
+	// slots limits the number of requests in flight to this peer
+	slots chan struct{}
+
+	// misbehaviors counts responses which didn't match their request
+	misbehaviors int
+
+	// goAwayUntil is the end of the cooldown after a go away response
+	goAwayUntil time.Time
+	goAways     int
+
+	// partials counts graphsync traversals which stopped before the end of
+	// the requested segment
+	partials int
+
+	// probe holds the results of availability probes
+	probe probeStats
+
+	// lastSaved is when the stats were last persisted
+	lastSaved time.Time
 }
 
 type bsPeerTracker struct {
@@ -458,13 +891,22 @@ type bsPeerTracker struct {
 	peers         map[peer.ID]*peerStats
 	avgGlobalTime time.Duration
 
-	pmgr *peermgr.PeerMgr
+	// latencies of recent successful hedged requests to any peer, by request
+	// length bucket
+	latencies map[int]*latencyWindow
+
+	pmgr  *peermgr.PeerMgr
+	rep   *reputations
+	stats *peerStatsStore
 }
 
-func newPeerTracker(pmgr *peermgr.PeerMgr) *bsPeerTracker {
+func newPeerTracker(pmgr *peermgr.PeerMgr, rep *reputations, ps *peerStatsStore) *bsPeerTracker {
 	return &bsPeerTracker{
-		peers: make(map[peer.ID]*peerStats),
-		pmgr:  pmgr,
+		peers:         make(map[peer.ID]*peerStats),
+		avgGlobalTime: ps.globalTime,
+		pmgr:          pmgr,
+		rep:           rep,
+		stats:         ps,
 	}
 }
 
@@ -474,10 +916,13 @@ func (bpt *bsPeerTracker) addPeer(p peer.ID) {
 	if _, ok := bpt.peers[p]; ok {
 		return
 	}
-	bpt.peers[p] = &peerStats{
-		firstSeen: time.Now(),
+	now := time.Now()
+	pi := &peerStats{
+		firstSeen: now,
+		slots:     make(chan struct{}, MaxPeerRequests),
 	}
-
+	bpt.stats.restore(p, pi, now)
+	bpt.peers[p] = pi
 }
 
 const (
@@ -490,8 +935,14 @@ func (bpt *bsPeerTracker) prefSortedPeers() []peer.ID {
 	// TODO: this could probably be cached, but as long as its not too many peers, fine for now
 	bpt.lk.Lock()
 	defer bpt.lk.Unlock()
+	now := time.Now()
+	reps := bpt.rep.all()
+
 	out := make([]peer.ID, 0, len(bpt.peers))
 	for p := range bpt.peers {
+		if r := reps[p]; r.banned(now) {
+			continue
+		}
 		out = append(out, p)
 	}
 
@@ -533,9 +984,43 @@ func (bpt *bsPeerTracker) prefSortedPeers() []peer.ID {
 		return costI < costJ
 	})
 
+	// spill requests over to lower ranked peers when the better ones are
+	// already busy
+	sort.SliceStable(out, func(i, j int) bool {
+		return len(bpt.peers[out[i]].slots) < MaxPeerRequests && len(bpt.peers[out[j]].slots) >= MaxPeerRequests
+	})
+
+	// peers which asked us to go away are asked after the others
+	sort.SliceStable(out, func(i, j int) bool {
+		return !now.Before(bpt.peers[out[i]].goAwayUntil) && now.Before(bpt.peers[out[j]].goAwayUntil)
+	})
+
+	// peers with a bad reputation are only asked when all others failed
+	sort.SliceStable(out, func(i, j int) bool {
+		return reps[out[i]].Score > DemoteScore && reps[out[j]].Score <= DemoteScore
+	})
+
 	return out
 }
 
+// acquire waits for a free request slot of the peer. Peers which aren't
+// tracked aren't limited.
+func (bpt *bsPeerTracker) acquire(ctx context.Context, p peer.ID) (func(), error) {
+	bpt.lk.Lock()
+	pi, ok := bpt.peers[p]
+	bpt.lk.Unlock()
+	if !ok {
+		return func() {}, nil
+	}
+
+	select {
+	case pi.slots <- struct{}{}:
+		return func() { <-pi.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 const (
 	// xInvAlpha = (N+1)/2
 
@@ -565,38 +1050,215 @@ func logTime(pi *peerStats, dur time.Duration) {
 
 }
 
+// reportSync passes the result of a request to the peer manager. It must be
+// called without holding bpt.lk, the peer manager takes its own lock and tags
+// the peer in the connection manager.
+func (bpt *bsPeerTracker) reportSync(p peer.ID, success bool, dur time.Duration) {
+	if bpt.pmgr != nil {
+		bpt.pmgr.ReportSyncResult(p, success, dur)
+	}
+}
+
 func (bpt *bsPeerTracker) logSuccess(p peer.ID, dur time.Duration) {
+	defer bpt.saveStats(p)
 	bpt.lk.Lock()
-	defer bpt.lk.Unlock()
 
-	var pi *peerStats
-	var ok bool
-	if pi, ok = bpt.peers[p]; !ok {
+	pi, ok := bpt.peers[p]
+	if !ok {
+		bpt.lk.Unlock()
 		log.Warnw("log success called on peer not in tracker", "peerid", p.String())
 		return
 	}
 
 	pi.successes++
 	logTime(pi, dur)
+	bpt.rep.success(p)
+	bpt.lk.Unlock()
+
+	bpt.reportSync(p, true, dur)
 }
 
 func (bpt *bsPeerTracker) logFailure(p peer.ID, dur time.Duration) {
+	defer bpt.saveStats(p)
 	bpt.lk.Lock()
-	defer bpt.lk.Unlock()
 
-	var pi *peerStats
-	var ok bool
-	if pi, ok = bpt.peers[p]; !ok {
-		log.Warn("log failure called on peer not in tracker", "peerid", p.String())
+	pi, ok := bpt.peers[p]
+	if !ok {
+		bpt.lk.Unlock()
+		log.Warnw("log failure called on peer not in tracker", "peerid", p.String())
 		return
 	}
 
 	pi.failures++
 	logTime(pi, dur)
+	bpt.lk.Unlock()
+
+	bpt.reportSync(p, false, dur)
 }
 
-func (bpt *bsPeerTracker) removePeer(p peer.ID) {
+// logPartial records a request which only returned the start of the
+// requested segment. The peer still made progress, so it doesn't count as a
+// failure, but it isn't rewarded like a success either.
+func (bpt *bsPeerTracker) logPartial(p peer.ID, dur time.Duration) {
+	bpt.lk.Lock()
+
+	pi, ok := bpt.peers[p]
+	if !ok {
+		bpt.lk.Unlock()
+		log.Warnw("log partial called on peer not in tracker", "peerid", p.String())
+		return
+	}
+
+	pi.partials++
+	logTime(pi, dur)
+	bpt.lk.Unlock()
+
+	bpt.reportSync(p, true, dur)
+}
+
+// logMisbehavior records an offense of the peer, e.g. a response which didn't
+// answer the request it was sent for. It counts as a failure as well.
+func (bpt *bsPeerTracker) logMisbehavior(p peer.ID, err error) {
+	var banned bool
+	// bans are persisted right away, once the lock is released
+	defer func() {
+		bpt.rep.flush(time.Now(), banned)
+	}()
+	bpt.lk.Lock()
+
+	log.Warnw("blocksync peer misbehaved", "peer", p, "error", err)
+
+	if bpt.rep.offense(p, classifyOffense(err)) {
+		log.Warnw("banning blocksync peer", "peer", p, "duration", BanDuration)
+		banned = true
+	}
+
+	pi, ok := bpt.peers[p]
+	if !ok {
+		bpt.lk.Unlock()
+		return
+	}
+
+	pi.misbehaviors++
+	pi.failures++
+	dur := pi.averageTime
+	bpt.lk.Unlock()
+
+	bpt.reportSync(p, false, dur)
+}
+
+// logGoAway deprioritizes a peer which refused to serve a request. It returns
+// the length of the cooldown.
+func (bpt *bsPeerTracker) logGoAway(p peer.ID, res *BlockSyncResponse) time.Duration {
+	cooldown := GoAwayCooldown
+	if d, ok := res.RetryAfter(); ok {
+		cooldown = d
+	}
+	if cooldown > MaxGoAwayCooldown {
+		cooldown = MaxGoAwayCooldown
+	}
+
 	bpt.lk.Lock()
 	defer bpt.lk.Unlock()
+
+	if pi, ok := bpt.peers[p]; ok {
+		pi.goAways++
+		pi.goAwayUntil = time.Now().Add(cooldown)
+	}
+
+	return cooldown
+}
+
+func (bpt *bsPeerTracker) scoreboard() []api.BlocksyncPeer {
+	bpt.lk.Lock()
+	defer bpt.lk.Unlock()
+
+	reps := bpt.rep.all()
+	out := make([]api.BlocksyncPeer, 0, len(reps))
+	add := func(p peer.ID) {
+		r := reps[p]
+		bp := api.BlocksyncPeer{
+			ID:          p,
+			Score:       r.Score,
+			Offenses:    r.Offenses,
+			Demoted:     r.Score <= DemoteScore,
+			BannedUntil: r.BannedUntil,
+		}
+		if pi, ok := bpt.peers[p]; ok {
+			bp.Connected = true
+			bp.Successes = pi.successes
+			bp.Failures = pi.failures
+			bp.AverageTime = pi.averageTime
+			bp.GoAways = pi.goAways
+			bp.Partials = pi.partials
+		}
+		out = append(out, bp)
+	}
+
+	for p := range bpt.peers {
+		add(p)
+	}
+	for p := range reps {
+		if _, ok := bpt.peers[p]; !ok {
+			add(p)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Score > out[j].Score
+	})
+	return out
+}
+
+func (bpt *bsPeerTracker) banned(p peer.ID) bool {
+	r := bpt.rep.get(p)
+	return r.banned(time.Now())
+}
+
+func (bpt *bsPeerTracker) setCapabilities(p peer.ID, caps BSCapabilities) {
+	bpt.lk.Lock()
+	defer bpt.lk.Unlock()
+
+	if pi, ok := bpt.peers[p]; ok {
+		pi.caps = caps
+	}
+}
+
+func (bpt *bsPeerTracker) removePeer(p peer.ID) {
+	bpt.lk.Lock()
+	pi, ok := bpt.peers[p]
+	if !ok {
+		bpt.lk.Unlock()
+		return
+	}
+	s, save := bpt.stats.snapshot(pi, time.Now(), true)
+	bpt.stats.keep(p, s)
+	globalTime := bpt.avgGlobalTime
 	delete(bpt.peers, p)
+	bpt.lk.Unlock()
+
+	if save {
+		bpt.stats.write(p, s, globalTime)
+	}
+	bpt.rep.flush(time.Now(), true)
+}
+
+// saveStats persists the stats of the peer and the changed reputations when
+// they are due. The datastore isn't written while holding the lock.
+func (bpt *bsPeerTracker) saveStats(p peer.ID) {
+	defer bpt.rep.flush(time.Now(), false)
+
+	bpt.lk.Lock()
+	pi, ok := bpt.peers[p]
+	if !ok {
+		bpt.lk.Unlock()
+		return
+	}
+	s, save := bpt.stats.snapshot(pi, time.Now(), false)
+	globalTime := bpt.avgGlobalTime
+	bpt.lk.Unlock()
+
+	if save {
+		bpt.stats.write(p, s, globalTime)
+	}
 }
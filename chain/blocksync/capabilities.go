@@ -0,0 +1,139 @@
+package blocksync
+
+import (
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"golang.org/x/xerrors"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+
+	inet "github.com/libp2p/go-libp2p-core/network"
+
+	incrt "github.com/filecoin-project/lotus/lib/increadtimeout"
+)
+
+// BlockSyncProtocolIDv2 is the capability-negotiating revision of the
+// BlockSync protocol. A v2 stream starts with a BSHandshake exchange, after
+// which the regular request/response pair follows exactly like in v1.
+const BlockSyncProtocolIDv2 = "/fil/sync/blk/0.0.2"
+
+// BlockSyncProtocols lists the BlockSync protocol revisions we speak, most
+// preferred first.
+var BlockSyncProtocols = []protocol.ID{BlockSyncProtocolIDv2, BlockSyncProtocolID}
+
+const (
+	// BSVersion1 is the original protocol, without a handshake.
+	BSVersion1 = uint64(1)
+	// BSVersion2 adds the capability handshake.
+	BSVersion2 = uint64(2)
+)
+
+// BSCapabilities is a bitfield of optional protocol features a peer supports.
+// Capabilities are only ever used when both sides of a stream advertise them.
+type BSCapabilities uint64
+
+const (
+	// CapReceipts means the peer can include message receipts in responses.
+	CapReceipts BSCapabilities = 1 << iota
+	// CapCompression means the peer can compress response payloads.
+	CapCompression
+	// CapStreaming means the peer can deliver responses incrementally.
+	CapStreaming
+	// CapRetryAfter means go away responses are followed by a BSGoAway with
+	// a typed retry hint.
+	CapRetryAfter
+)
+
+// LocalCapabilities is the set of capabilities this node advertises.
+var LocalCapabilities = CapCompression | CapRetryAfter
+
+func (c BSCapabilities) Has(o BSCapabilities) bool {
+	return c&o == o
+}
+
+// BSHandshake is exchanged at the start of a BlockSyncProtocolIDv2 stream. The
+// client sends its version and capabilities, and the server answers with its
+// own version and the intersection of both capability sets.
+type BSHandshake struct {
+	Version      uint64
+	Capabilities uint64
+}
+
+// negotiateServer reads the client's handshake from the stream and answers with
+// the mutually supported capabilities.
+func negotiateServer(s inet.Stream) (BSCapabilities, error) {
+	var hs BSHandshake
+	if err := cborutil.ReadCborRPC(incrt.NewWithConfig(s, HandshakeReadConfig), &hs); err != nil {
+		return 0, xerrors.Errorf("reading client handshake: %w", err)
+	}
+	if hs.Version < BSVersion2 {
+		return 0, xerrors.Errorf("client sent unsupported handshake version %d", hs.Version)
+	}
+
+	caps := LocalCapabilities & BSCapabilities(hs.Capabilities)
+	if err := cborutil.WriteCborRPC(s, &BSHandshake{
+		Version:      BSVersion2,
+		Capabilities: uint64(caps),
+	}); err != nil {
+		return 0, xerrors.Errorf("writing server handshake: %w", err)
+	}
+
+	return caps, nil
+}
+
+// negotiateClient sends our handshake to the server and returns the
+// capabilities the server agreed to use on this stream.
+func negotiateClient(s inet.Stream) (BSCapabilities, error) {
+	if err := cborutil.WriteCborRPC(s, &BSHandshake{
+		Version:      BSVersion2,
+		Capabilities: uint64(LocalCapabilities),
+	}); err != nil {
+		return 0, xerrors.Errorf("writing client handshake: %w", err)
+	}
+
+	var hs BSHandshake
+	if err := cborutil.ReadCborRPC(incrt.NewWithConfig(s, HandshakeReadConfig), &hs); err != nil {
+		return 0, xerrors.Errorf("reading server handshake: %w", err)
+	}
+	if hs.Version < BSVersion2 {
+		return 0, xerrors.Errorf("%w: server sent unsupported handshake version %d", errProtocolViolation, hs.Version)
+	}
+
+	// never trust the server to agree to more than we offered
+	return LocalCapabilities & BSCapabilities(hs.Capabilities), nil
+}
+
+// pickSyncProtocol selects the richest protocol out of the ones a peer
+// supports, preferring BlockSync (newest revision first) over graphsync,
+// unless preferGS is set.
+func pickSyncProtocol(supported []string, gsproto string, preferGS bool) (string, bool) {
+	has := make(map[string]bool, len(supported))
+	for _, p := range supported {
+		has[p] = true
+	}
+
+	if preferGS && has[gsproto] {
+		return gsproto, true
+	}
+	for _, p := range BlockSyncProtocols {
+		if has[string(p)] {
+			return string(p), true
+		}
+	}
+	if has[gsproto] {
+		return gsproto, true
+	}
+
+	return "", false
+}
+
+// supportsBlockSync returns true if any BlockSync revision is supported
+func supportsBlockSync(supported []string) bool {
+	for _, s := range supported {
+		for _, p := range BlockSyncProtocols {
+			if s == string(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package blocksync
+
+import (
+	"testing"
+)
+
+func TestPickSyncProtocol(t *testing.T) {
+	const gs = "/ipfs/graphsync/1.0.0"
+	v1, v2 := string(BlockSyncProtocolID), string(BlockSyncProtocolIDv2)
+
+	for i, tc := range []struct {
+		supported []string
+		preferGS  bool
+		proto     string
+	}{
+		{[]string{v1, v2, gs}, false, v2},
+		{[]string{v1, gs}, false, v1},
+		{[]string{v1, v2, gs}, true, gs},
+		{[]string{v2}, true, v2},
+		{[]string{gs}, false, gs},
+	} {
+		proto, ok := pickSyncProtocol(tc.supported, gs, tc.preferGS)
+		if !ok || proto != tc.proto {
+			t.Errorf("%d: expected %s, got %s", i, tc.proto, proto)
+		}
+	}
+
+	if _, ok := pickSyncProtocol([]string{"/other"}, gs, true); ok {
+		t.Error("expected no protocol to be picked")
+	}
+}
@@ -0,0 +1,116 @@
+package blocksync
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/xerrors"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+
+	incrt "github.com/filecoin-project/lotus/lib/increadtimeout"
+)
+
+// CompressionLevel is the gzip level responses are compressed with. Message
+// heavy responses compress well already at the fastest level.
+var CompressionLevel = gzip.BestSpeed
+
+// compressRequest returns the request to send on a stream with the negotiated
+// capabilities. The request is copied, as it may be sent to several peers.
+func compressRequest(req *BlockSyncRequest, caps BSCapabilities) *BlockSyncRequest {
+	if !caps.Has(CapCompression) {
+		return req
+	}
+
+	creq := *req
+	creq.Options |= BSOptCompressed
+	return &creq
+}
+
+// writeResponse writes the response to the stream, compressed if the client
+// asked for it. Clients only ask for compression on streams which negotiated
+// CapCompression, so old peers always get plain responses. Go away responses
+// are followed by their retry hint on streams which negotiated CapRetryAfter.
+//
+// Compressed responses are framed as a single gzip member. Besides saving
+// bandwidth on message heavy responses, the CRC32 and length in the gzip
+// trailer let the client detect payloads corrupted in transit.
+func writeResponse(w io.Writer, resp *BlockSyncResponse, caps BSCapabilities, compress bool) error {
+	write := func(w io.Writer) error {
+		if err := cborutil.WriteCborRPC(w, resp); err != nil {
+			return err
+		}
+		if resp.Status == StatusGoAway && caps.Has(CapRetryAfter) {
+			return writeRetryAfter(w, resp)
+		}
+		return nil
+	}
+
+	if !compress {
+		return write(w)
+	}
+
+	gz, err := gzip.NewWriterLevel(w, CompressionLevel)
+	if err != nil {
+		return xerrors.Errorf("creating compressor: %w", err)
+	}
+	if err := write(gz); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// openResponse returns a reader for the response payload sent for req. For
+// compressed responses, maxBytes limits the decompressed size, and the
+// returned function verifies the checksum, so it must be called after the
+// response was decoded.
+func openResponse(r io.Reader, req *BlockSyncRequest, maxBytes int64) (io.Reader, func() error, error) {
+	if !ParseBSOptions(req.Options).Compressed {
+		return bufio.NewReader(r), func() error { return nil }, nil
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("reading compressed response header: %w", err)
+	}
+	// the server closes the stream after the response, don't wait for it
+	gz.Multistream(false)
+
+	lr := &budgetReader{r: gz, left: maxBytes}
+	verify := func() error {
+		// gzip checks the trailer once the payload was read to the end
+		if _, err := io.Copy(ioutil.Discard, lr); err != nil {
+			return xerrors.Errorf("verifying response checksum: %w", err)
+		}
+		return nil
+	}
+
+	return bufio.NewReader(lr), verify, nil
+}
+
+// budgetReader fails with incrt.ErrTooLarge once more than left bytes were
+// read, so that small compressed payloads can't expand without bound
+type budgetReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (br *budgetReader) Read(p []byte) (int, error) {
+	if br.left <= 0 {
+		// payloads of exactly the budget are fine, only fail when there's more
+		var b [1]byte
+		n, err := br.r.Read(b[:])
+		if n > 0 {
+			return 0, incrt.ErrTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > br.left {
+		p = p[:br.left]
+	}
+	n, err := br.r.Read(p)
+	br.left -= int64(n)
+	return n, err
+}
@@ -0,0 +1,79 @@
+package blocksync
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/xerrors"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+
+	incrt "github.com/filecoin-project/lotus/lib/increadtimeout"
+)
+
+func TestBudgetReader(t *testing.T) {
+	payload := []byte("0123456789")
+
+	// the budget is inclusive
+	b, err := ioutil.ReadAll(&budgetReader{r: bytes.NewReader(payload), left: 10})
+	if err != nil || !bytes.Equal(b, payload) {
+		t.Fatalf("expected the payload of the budget size to be read, got %q (%v)", b, err)
+	}
+
+	if _, err := ioutil.ReadAll(&budgetReader{r: bytes.NewReader(payload), left: 9}); !xerrors.Is(err, incrt.ErrTooLarge) {
+		t.Fatalf("expected the payload over the budget to fail, got %v", err)
+	}
+}
+
+func TestCompressedResponse(t *testing.T) {
+	if !LocalCapabilities.Has(CapCompression) {
+		t.Fatal("expected compression to be advertised")
+	}
+
+	req := &BlockSyncRequest{RequestLength: 1, Options: BSOptBlocks}
+	if creq := compressRequest(req, 0); creq != req {
+		t.Fatal("expected the request not to be compressed without the capability")
+	}
+	creq := compressRequest(req, CapCompression)
+	if !ParseBSOptions(creq.Options).Compressed || ParseBSOptions(req.Options).Compressed {
+		t.Fatal("expected a compressed copy of the request")
+	}
+
+	resp := &BlockSyncResponse{Status: StatusNotFound, Message: "not found"}
+	var plain bytes.Buffer
+	if err := cborutil.WriteCborRPC(&plain, resp); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(maxBytes int64) error {
+		var buf bytes.Buffer
+		if err := writeResponse(&buf, resp, CapCompression, true); err != nil {
+			t.Fatal(err)
+		}
+
+		r, verify, err := openResponse(&buf, creq, maxBytes)
+		if err != nil {
+			return err
+		}
+		var res BlockSyncResponse
+		if err := cborutil.ReadCborRPC(r, &res); err != nil {
+			return err
+		}
+		if err := verify(); err != nil {
+			return err
+		}
+		if res.Status != resp.Status || res.Message != resp.Message {
+			t.Fatalf("expected the response to be decoded, got %+v", res)
+		}
+		return nil
+	}
+
+	// responses of exactly the budget are accepted
+	if err := read(int64(plain.Len())); err != nil {
+		t.Fatal(err)
+	}
+	if err := read(int64(plain.Len()) - 1); !xerrors.Is(err, incrt.ErrTooLarge) {
+		t.Fatalf("expected the response over the budget to fail, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package blocksync
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// fairQueue hands out a fixed number of processing slots. When all slots are
+// taken, requests wait in a queue of their peer, and freed slots go to the
+// waiting peers in turn, so a peer sending many requests at once only gets
+// its share of the slots.
+type fairQueue struct {
+	maxWaiting int
+
+	lk   sync.Mutex
+	free int
+	// turns lists the peers with waiting requests, in the order they get
+	// the next free slots
+	turns   []peer.ID
+	waiting map[peer.ID][]chan struct{}
+}
+
+func newFairQueue(slots, maxWaiting int) *fairQueue {
+	return &fairQueue{
+		maxWaiting: maxWaiting,
+		free:       slots,
+		waiting:    map[peer.ID][]chan struct{}{},
+	}
+}
+
+// acquire waits for a slot for a request of the peer, at most timeout, or until
+// the context is cancelled. It fails right away when the peer already has
+// maxWaiting requests queued. The slot must be returned with release.
+func (fq *fairQueue) acquire(ctx context.Context, p peer.ID, timeout time.Duration) bool {
+	fq.lk.Lock()
+	if fq.free > 0 && len(fq.turns) == 0 {
+		fq.free--
+		fq.lk.Unlock()
+		return true
+	}
+	if len(fq.waiting[p]) >= fq.maxWaiting || timeout <= 0 {
+		fq.lk.Unlock()
+		return false
+	}
+
+	ready := make(chan struct{})
+	if len(fq.waiting[p]) == 0 {
+		fq.turns = append(fq.turns, p)
+	}
+	fq.waiting[p] = append(fq.waiting[p], ready)
+	fq.lk.Unlock()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-ready:
+		return true
+	case <-t.C:
+	case <-ctx.Done():
+	}
+
+	fq.lk.Lock()
+	defer fq.lk.Unlock()
+
+	if !fq.dequeue(p, ready) {
+		if ctx.Err() != nil {
+			// the slot was handed to us, pass it on
+			fq.releaseLocked()
+			return false
+		}
+		// the slot was handed to us while the timer fired
+		return true
+	}
+	return false
+}
+
+// dequeue removes a waiting request, it returns false if the request isn't
+// queued anymore
+func (fq *fairQueue) dequeue(p peer.ID, ready chan struct{}) bool {
+	w := fq.waiting[p]
+	for i, ch := range w {
+		if ch != ready {
+			continue
+		}
+
+		w = append(w[:i], w[i+1:]...)
+		if len(w) > 0 {
+			fq.waiting[p] = w
+			return true
+		}
+
+		delete(fq.waiting, p)
+		for j, tp := range fq.turns {
+			if tp == p {
+				fq.turns = append(fq.turns[:j], fq.turns[j+1:]...)
+				break
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// release hands the slot to the first request of the next peer in turn, or
+// frees it
+func (fq *fairQueue) release() {
+	fq.lk.Lock()
+	defer fq.lk.Unlock()
+
+	fq.releaseLocked()
+}
+
+func (fq *fairQueue) releaseLocked() {
+	if len(fq.turns) == 0 {
+		fq.free++
+		return
+	}
+
+	p := fq.turns[0]
+	fq.turns = fq.turns[1:]
+
+	w := fq.waiting[p]
+	close(w[0])
+	if len(w) > 1 {
+		fq.waiting[p] = w[1:]
+		// the peer goes to the back of the line with its other requests
+		fq.turns = append(fq.turns, p)
+	} else {
+		delete(fq.waiting, p)
+	}
+}
@@ -0,0 +1,128 @@
+package blocksync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// queued waits until the peer has n requests waiting
+func queued(t *testing.T, fq *fairQueue, p peer.ID, n int) {
+	for i := 0; i < 100; i++ {
+		fq.lk.Lock()
+		l := len(fq.waiting[p])
+		fq.lk.Unlock()
+		if l == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d requests of %s to be queued", n, p)
+}
+
+func TestFairQueueTurns(t *testing.T) {
+	ctx := context.TODO()
+	fq := newFairQueue(1, 3)
+
+	if !fq.acquire(ctx, "a", 0) {
+		t.Fatal("expected the free slot to be acquired")
+	}
+	if fq.acquire(ctx, "a", 0) {
+		t.Fatal("expected no slot without waiting")
+	}
+
+	got := make(chan peer.ID)
+	wait := func(p peer.ID) {
+		go func() {
+			if fq.acquire(ctx, p, time.Minute) {
+				got <- p
+			}
+		}()
+	}
+	for i := 1; i <= 3; i++ {
+		wait("a")
+		queued(t, fq, "a", i)
+	}
+	wait("b")
+	queued(t, fq, "b", 1)
+
+	if fq.acquire(ctx, "a", time.Minute) {
+		t.Fatal("expected the request over the queue length of the peer to be refused")
+	}
+
+	// the peer with many waiting requests doesn't starve the other
+	for _, expect := range []peer.ID{"a", "b", "a", "a"} {
+		fq.release()
+		if p := <-got; p != expect {
+			t.Fatalf("expected the slot to go to %s, got %s", expect, p)
+		}
+	}
+
+	fq.release()
+	if fq.free != 1 || len(fq.turns) != 0 || len(fq.waiting) != 0 {
+		t.Fatalf("expected the slot to be freed, free: %d, turns: %v", fq.free, fq.turns)
+	}
+}
+
+func TestFairQueueGiveUp(t *testing.T) {
+	fq := newFairQueue(1, 1)
+	if !fq.acquire(context.TODO(), "a", 0) {
+		t.Fatal("expected the free slot to be acquired")
+	}
+
+	if fq.acquire(context.TODO(), "b", 10*time.Millisecond) {
+		t.Fatal("expected the request to time out")
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := make(chan bool)
+	go func() {
+		done <- fq.acquire(ctx, "b", time.Minute)
+	}()
+	queued(t, fq, "b", 1)
+	cancel()
+	if <-done {
+		t.Fatal("expected the cancelled request not to get a slot")
+	}
+
+	if len(fq.turns) != 0 || len(fq.waiting) != 0 {
+		t.Fatalf("expected requests which gave up to leave the queue, turns: %v", fq.turns)
+	}
+	fq.release()
+	if fq.free != 1 {
+		t.Fatalf("expected the slot to be freed, free: %d", fq.free)
+	}
+}
+
+func TestServerLimiterByteQuota(t *testing.T) {
+	sl := newServerLimiter(ServerLimits{
+		PeerByteQuota: 1 << 20,
+		QuotaWindow:   time.Minute,
+	})
+
+	// responses of the maximum size fit in the quota
+	if b := sl.byteBudget("a"); b != MaxResponseSize {
+		t.Fatalf("expected the quota to be raised to %d, got %d", MaxResponseSize, b)
+	}
+
+	// bytes sent to peers the limiter doesn't know yet are counted
+	sl.charge("b", MaxResponseSize)
+	if b := sl.byteBudget("b"); b != 0 {
+		t.Fatalf("expected the quota of the peer to be used up, got %d left", b)
+	}
+	if wait, ok := sl.admitPeer("b", 1); ok || wait <= 0 || wait > time.Minute {
+		t.Fatalf("expected the peer to be refused until the window ends, got %s (%t)", wait, ok)
+	}
+	if _, ok := sl.admitPeer("a", 1); !ok {
+		t.Fatal("expected the other peer to be admitted")
+	}
+
+	sl.lk.Lock()
+	sl.peers["b"].windowStart = time.Now().Add(-time.Minute)
+	sl.lk.Unlock()
+	if b := sl.byteBudget("b"); b != MaxResponseSize {
+		t.Fatalf("expected the quota to be reset in the next window, got %d", b)
+	}
+}
@@ -2,10 +2,14 @@ package blocksync
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-graphsync"
+	gsnet "github.com/ipfs/go-graphsync/network"
 	"github.com/ipld/go-ipld-prime"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"golang.org/x/xerrors"
@@ -43,8 +47,16 @@ const (
 
 	// maximum depth per traversal
 	maxRequestLength = 50
+
+	// maximum number of sync peers a single block is requested from, when
+	// bitswap failed to fetch it
+	maxCidRetryPeers = 3
 )
 
+// CidRetryTimeout limits the graphsync request fetching a single block from a
+// sync peer
+var CidRetryTimeout = 10 * time.Second
+
 var amtSelector selectorbuilder.SelectorSpec
 
 func init() {
@@ -112,40 +124,162 @@ func (bs *BlockSync) executeGsyncSelector(ctx context.Context, p peer.ID, root c
 	return nil
 }
 
-// Fallback for interacting with other non-lotus nodes
+// fetchCidFromPeers fetches a single block with graphsync from the best sync
+// peers which support it. Graphsync stores the block in the chain blockstore,
+// from where it's returned.
+func (bs *BlockSync) fetchCidFromPeers(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	ssb := selectorbuilder.NewSelectorSpecBuilder(basicnode.Style.Any)
+	sel := ssb.Matcher().Node()
+	gsproto := string(gsnet.ProtocolGraphsync)
+
+	lastErr := xerrors.New("no sync peer supports graphsync")
+	tried := 0
+	for _, p := range bs.getPeers() {
+		if tried >= maxCidRetryPeers {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		supp, err := bs.host.Peerstore().SupportsProtocols(p, gsproto)
+		if err != nil || len(supp) == 0 {
+			continue
+		}
+		tried++
+
+		rctx, cancel := context.WithTimeout(ctx, CidRetryTimeout)
+		err = bs.executeGsyncSelector(rctx, p, c, sel)
+		cancel()
+		if err != nil {
+			lastErr = xerrors.Errorf("peer %s: %w", p, err)
+			continue
+		}
+
+		b, err := bs.bserv.Blockstore().Get(c)
+		if err != nil {
+			lastErr = xerrors.Errorf("peer %s didn't send the block: %w", p, err)
+			continue
+		}
+		return b, nil
+	}
+
+	return nil, lastErr
+}
+
+// fetchBlocksGraphSync walks the requested chain segment with graphsync
+// selectors, in traversals of at most maxRequestLength tipsets. When a
+// traversal fails, the tipsets fetched until then are returned as a partial
+// response; an error is only returned when not even the first tipset could be
+// fetched.
 func (bs *BlockSync) fetchBlocksGraphSync(ctx context.Context, p peer.ID, req *BlockSyncRequest) (*BlockSyncResponse, error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	start := time.Now()
+	opts := ParseBSOptions(req.Options)
 	immediateTsSelector := firstTipsetSelector(req)
 
-	// Do this because we can only request one root at a time
-	for _, r := range req.Start {
-		if err := bs.executeGsyncSelector(ctx, p, r, immediateTsSelector); err != nil {
-			return nil, err
+	// the fetched data is pulled out of the blockstore, where graphsync
+	// persists it
+	tempcs := store.NewChainStore(bs.bserv.Blockstore(), datastore.NewMapDatastore(), nil)
+
+	var chain []*BSTipSet
+	var tail *types.TipSet
+	var walkErr error
+	cur := types.NewTipSetKey(req.Start...)
+	for uint64(len(chain)) < req.RequestLength {
+		left := req.RequestLength - uint64(len(chain))
+
+		// Do this because we can only request one root at a time
+		for _, r := range cur.Cids() {
+			if err := bs.executeGsyncSelector(ctx, p, r, immediateTsSelector); err != nil {
+				walkErr = err
+				break
+			}
+		}
+
+		if walkErr == nil {
+			walk := *req
+			walk.RequestLength = left
+			if walk.RequestLength > maxRequestLength {
+				walk.RequestLength = maxRequestLength
+			}
+
+			// the selector walks the parents of the first block, and
+			// fetches all blocks of every parent tipset on the way
+			walkErr = bs.executeGsyncSelector(ctx, p, cur.Cids()[0], selectorForRequest(&walk))
+		}
+
+		seg, last := collectAvailableSegment(tempcs, cur, left, opts)
+		chain = append(chain, seg...)
+		if last == nil {
+			break
+		}
+		tail = last
+		if walkErr != nil || tail.Height() == 0 {
+			break
+		}
+		cur = tail.Parents()
+		if uint64(len(chain)) < req.RequestLength {
+			recordContinuation(ctx, protoGraphsync)
 		}
 	}
 
-	if req.RequestLength > maxRequestLength {
-		req.RequestLength = maxRequestLength
+	probe := isProbe(ctx)
+	if len(chain) == 0 {
+		if !probe {
+			bs.syncPeers.logFailure(p, time.Since(start))
+		}
+		if walkErr != nil {
+			return nil, walkErr
+		}
+		return nil, xerrors.Errorf("failed to load chain data from chainstore after successful graphsync response (start = %v)", req.Start)
 	}
 
-	sel := selectorForRequest(req)
+	if uint64(len(chain)) < req.RequestLength && tail.Height() > 0 {
+		log.Infow("graphsync traversal fetched a partial chain", "peer", p, "tipsets", len(chain), "requested", req.RequestLength, "error", walkErr)
+		if !probe {
+			bs.syncPeers.logPartial(p, time.Since(start))
+		}
+		return &BlockSyncResponse{
+			Chain:   chain,
+			Status:  StatusPartial,
+			Message: fmt.Sprintf("graphsync traversal stopped after %d tipsets", len(chain)),
+		}, nil
+	}
 
-	// execute the selector forreal
-	if err := bs.executeGsyncSelector(ctx, p, req.Start[0], sel); err != nil {
-		return nil, err
+	if !probe {
+		bs.syncPeers.logSuccess(p, time.Since(start))
 	}
+	return &BlockSyncResponse{Chain: chain}, nil
+}
 
-	// Now pull the data we fetched out of the chainstore (where it should now be persisted)
-	tempcs := store.NewChainStore(bs.bserv.Blockstore(), datastore.NewMapDatastore(), nil)
+// collectAvailableSegment collects the longest prefix of the chain segment
+// which is complete in the chain store. It returns the last collected tipset,
+// or nil if the first one isn't available.
+func collectAvailableSegment(cs *store.ChainStore, start types.TipSetKey, length uint64, opts *BSOptions) ([]*BSTipSet, *types.TipSet) {
+	var out []*BSTipSet
+	var last *types.TipSet
+	cur := start
+	for uint64(len(out)) < length {
+		ts, err := cs.LoadTipSet(cur)
+		if err != nil {
+			break
+		}
 
-	opts := ParseBSOptions(req.Options)
-	tsk := types.NewTipSetKey(req.Start...)
-	chain, err := collectChainSegment(tempcs, tsk, req.RequestLength, opts)
-	if err != nil {
-		return nil, xerrors.Errorf("failed to load chain data from chainstore after successful graphsync response (start = %v): %w", req.Start, err)
+		seg, _, _, err := collectChainSegment(cs, cur, 1, -1, opts)
+		if err != nil {
+			break
+		}
+
+		out = append(out, seg...)
+		last = ts
+		if ts.Height() == 0 {
+			break
+		}
+		cur = ts.Parents()
 	}
 
-	return &BlockSyncResponse{Chain: chain}, nil
+	return out, last
 }
@@ -0,0 +1,117 @@
+package blocksync
+
+import (
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// The hedge deadline follows the latency of recent successful requests of a
+// similar length: a request is hedged once it took longer than HedgePercentile
+// of them. Until minHedgeSamples requests were observed, HedgeDelay is used
+// instead. The deadline is kept between MinHedgeDelay and MaxHedgeDelay, so
+// that a burst of fast or slow responses doesn't hedge every request, or none
+// at all.
+var (
+	HedgePercentile = 0.9
+	MinHedgeDelay   = 500 * time.Millisecond
+	MaxHedgeDelay   = 10 * time.Second
+)
+
+const (
+	// latencyWindowSize is the number of recent request latencies the hedge
+	// deadline is derived from
+	latencyWindowSize = 128
+	minHedgeSamples   = 16
+)
+
+// lengthBucket groups requests by the power of two of their length, longer
+// requests take longer to serve, and are compared with requests of a similar
+// length only.
+func lengthBucket(length uint64) int {
+	return bits.Len64(length)
+}
+
+// latencyWindow keeps the latencies of the most recent successful requests.
+// It isn't safe for concurrent use, the peer tracker guards it.
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (lw *latencyWindow) add(d time.Duration) {
+	if len(lw.samples) < latencyWindowSize {
+		lw.samples = append(lw.samples, d)
+		return
+	}
+	lw.samples[lw.next] = d
+	lw.next = (lw.next + 1) % latencyWindowSize
+}
+
+// percentile returns the q-th percentile of the window, and false if there
+// aren't enough samples yet.
+func (lw *latencyWindow) percentile(q float64) (time.Duration, bool) {
+	if len(lw.samples) < minHedgeSamples {
+		return 0, false
+	}
+
+	sorted := make([]time.Duration, len(lw.samples))
+	copy(sorted, lw.samples)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	i := int(q * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i], true
+}
+
+// logLatency records the latency of a successful hedged request of the given
+// length
+func (bpt *bsPeerTracker) logLatency(length uint64, dur time.Duration) {
+	bpt.lk.Lock()
+	defer bpt.lk.Unlock()
+
+	if bpt.latencies == nil {
+		bpt.latencies = map[int]*latencyWindow{}
+	}
+	lw, ok := bpt.latencies[lengthBucket(length)]
+	if !ok {
+		lw = &latencyWindow{}
+		bpt.latencies[lengthBucket(length)] = lw
+	}
+	lw.add(dur)
+}
+
+// hedgeDelay returns how long to wait for the best peer before also sending
+// a request of the given length to the second best one. Zero disables
+// hedging.
+func (bpt *bsPeerTracker) hedgeDelay(length uint64) time.Duration {
+	if HedgeDelay <= 0 {
+		return 0
+	}
+
+	var d time.Duration
+	var ok bool
+	bpt.lk.Lock()
+	if lw, found := bpt.latencies[lengthBucket(length)]; found {
+		d, ok = lw.percentile(HedgePercentile)
+	}
+	bpt.lk.Unlock()
+	if !ok {
+		return HedgeDelay
+	}
+
+	if d < MinHedgeDelay {
+		d = MinHedgeDelay
+	}
+	if d > MaxHedgeDelay {
+		d = MaxHedgeDelay
+	}
+	return d
+}
@@ -0,0 +1,57 @@
+package blocksync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHedgeDelayByLength(t *testing.T) {
+	bpt := &bsPeerTracker{}
+
+	// not enough samples yet
+	if d := bpt.hedgeDelay(1); d != HedgeDelay {
+		t.Fatalf("expected the default hedge delay, got %s", d)
+	}
+
+	for i := 0; i < minHedgeSamples; i++ {
+		bpt.logLatency(1, time.Second)
+		bpt.logLatency(500, 5*time.Second)
+	}
+
+	if d := bpt.hedgeDelay(1); d != time.Second {
+		t.Fatalf("expected the latency of short requests, got %s", d)
+	}
+	if d := bpt.hedgeDelay(400); d != 5*time.Second {
+		t.Fatalf("expected the latency of long requests, got %s", d)
+	}
+	// no samples of this length
+	if d := bpt.hedgeDelay(50); d != HedgeDelay {
+		t.Fatalf("expected the default hedge delay, got %s", d)
+	}
+
+	bpt.logLatency(1, time.Hour)
+	if d := bpt.hedgeDelay(1); d != time.Second {
+		t.Fatalf("expected a single slow request not to move the percentile, got %s", d)
+	}
+
+	for i := 0; i < minHedgeSamples; i++ {
+		bpt.logLatency(2, time.Millisecond)
+	}
+	if d := bpt.hedgeDelay(3); d != MinHedgeDelay {
+		t.Fatalf("expected the delay to be clamped to %s, got %s", MinHedgeDelay, d)
+	}
+}
+
+func TestLatencyWindowWraps(t *testing.T) {
+	var lw latencyWindow
+	for i := 0; i < latencyWindowSize; i++ {
+		lw.add(time.Hour)
+	}
+	for i := 0; i < latencyWindowSize; i++ {
+		lw.add(time.Second)
+	}
+
+	if d, ok := lw.percentile(1); !ok || d != time.Second {
+		t.Fatalf("expected old samples to be replaced, got %s", d)
+	}
+}
@@ -0,0 +1,115 @@
+package blocksync
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/metrics"
+)
+
+// protocol tags of client metrics
+const (
+	protoBlockSync = "blocksync"
+	protoGraphsync = "graphsync"
+)
+
+var clientStreams, serverStreams int64
+
+// statusName returns the metrics tag of a response status
+func statusName(status uint64) string {
+	switch status {
+	case StatusOK:
+		return "ok"
+	case StatusPartial:
+		return "partial"
+	case StatusNotFound:
+		return "not_found"
+	case StatusGoAway:
+		return "go_away"
+	case StatusInternalError:
+		return "internal_error"
+	case StatusBadRequest:
+		return "bad_request"
+	default:
+		return "unknown"
+	}
+}
+
+// recordClientRequest records the outcome and latency of a request sent to a
+// sync peer
+func recordClientRequest(ctx context.Context, proto string, res *BlockSyncResponse, err error, took time.Duration) {
+	status := "error"
+	switch {
+	case xerrors.Is(err, ErrGoAway):
+		status = statusName(StatusGoAway)
+	case err == nil:
+		status = statusName(res.Status)
+	}
+
+	rctx, _ := tag.New(ctx,
+		tag.Upsert(metrics.BlocksyncStatus, status),
+		tag.Upsert(metrics.BlocksyncProtocol, proto),
+	)
+	stats.Record(rctx, metrics.BlocksyncClientRequests.M(1), metrics.BlocksyncClientRequestMs.M(float64(took)/float64(time.Millisecond)))
+
+	if err == nil && res.Status == StatusPartial {
+		recordPartial(ctx, proto)
+	}
+}
+
+func recordPartial(ctx context.Context, proto string) {
+	ctx, _ = tag.New(ctx, tag.Upsert(metrics.BlocksyncProtocol, proto))
+	stats.Record(ctx, metrics.BlocksyncClientPartials.M(1))
+}
+
+// recordContinuation records a request which continues a chain segment
+// another request only fetched partially
+func recordContinuation(ctx context.Context, proto string) {
+	ctx, _ = tag.New(ctx, tag.Upsert(metrics.BlocksyncProtocol, proto))
+	stats.Record(ctx, metrics.BlocksyncClientContinuations.M(1))
+}
+
+func recordServerRequest(ctx context.Context, res *BlockSyncResponse, sent int64) {
+	rctx, _ := tag.New(ctx, tag.Upsert(metrics.BlocksyncStatus, statusName(res.Status)))
+	stats.Record(rctx, metrics.BlocksyncServerRequests.M(1))
+	stats.Record(ctx, metrics.BlocksyncServerBytesSent.M(sent))
+}
+
+// streamOpened records the stream in the gauge of open streams. The returned
+// function must be called when the stream is closed.
+func streamOpened(ctx context.Context, m *stats.Int64Measure, open *int64) func() {
+	stats.Record(ctx, m.M(atomic.AddInt64(open, 1)))
+	return func() {
+		stats.Record(ctx, m.M(atomic.AddInt64(open, -1)))
+	}
+}
+
+// countingReader counts the bytes read from a response stream
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written to a response stream
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,177 @@
+package blocksync
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	dstore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+)
+
+// Peer stats are persisted, so that a restarted node doesn't have to find out
+// again which peers are fast. Request counts of stats saved a while ago are
+// decayed with PeerStatsHalfLife, stats older than PeerStatsMaxAge are dropped.
+var (
+	PeerStatsSaveInterval = time.Minute
+	PeerStatsHalfLife     = 6 * time.Hour
+	PeerStatsMaxAge       = 7 * 24 * time.Hour
+)
+
+var (
+	peerStatsPrefix = dstore.NewKey("/blocksync/peerstats")
+	globalTimeKey   = dstore.NewKey("/blocksync/globaltime")
+)
+
+// savedPeerStats is the persisted part of peerStats
+type savedPeerStats struct {
+	Successes   int
+	Failures    int
+	AverageTime time.Duration
+	Saved       time.Time
+}
+
+// peerStatsStore persists peer stats in the metadata datastore. Stats loaded
+// at startup, or of peers which disconnected, are kept until the peer connects
+// again.
+type peerStatsStore struct {
+	ds dstore.Datastore
+
+	// loaded holds the stats of peers which aren't connected
+	loaded     map[peer.ID]savedPeerStats
+	globalTime time.Duration
+}
+
+func loadPeerStats(ds dstore.Datastore, now time.Time) (*peerStatsStore, error) {
+	ps := &peerStatsStore{
+		ds:     ds,
+		loaded: map[peer.ID]savedPeerStats{},
+	}
+	if ds == nil {
+		return ps, nil
+	}
+
+	b, err := ds.Get(globalTimeKey)
+	switch {
+	case err == dstore.ErrNotFound:
+	case err != nil:
+		return nil, xerrors.Errorf("getting average request time: %w", err)
+	default:
+		if err := json.Unmarshal(b, &ps.globalTime); err != nil {
+			log.Warnf("bad average request time: %s", err)
+		}
+	}
+
+	res, err := ds.Query(query.Query{Prefix: peerStatsPrefix.String()})
+	if err != nil {
+		return nil, xerrors.Errorf("querying peer stats: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var stale []dstore.Key
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, xerrors.Errorf("iterating peer stats: %w", e.Error)
+		}
+
+		p, err := peer.Decode(dstore.RawKey(e.Key).BaseNamespace())
+		if err != nil {
+			log.Warnf("bad peer stats key %s: %s", e.Key, err)
+			continue
+		}
+
+		var s savedPeerStats
+		if err := json.Unmarshal(e.Value, &s); err != nil {
+			log.Warnf("bad peer stats for %s: %s", p, err)
+			continue
+		}
+
+		if now.Sub(s.Saved) > PeerStatsMaxAge {
+			stale = append(stale, dstore.RawKey(e.Key))
+			continue
+		}
+		ps.loaded[p] = s
+	}
+
+	for _, k := range stale {
+		if err := ds.Delete(k); err != nil {
+			log.Warnf("deleting stale peer stats: %s", err)
+		}
+	}
+
+	return ps, nil
+}
+
+// restore fills the stats of a newly connected peer with its saved stats, if
+// there are any.
+func (ps *peerStatsStore) restore(p peer.ID, pi *peerStats, now time.Time) {
+	s, ok := ps.loaded[p]
+	if !ok {
+		return
+	}
+	delete(ps.loaded, p)
+
+	age := now.Sub(s.Saved)
+	if age > PeerStatsMaxAge {
+		return
+	}
+
+	decay := math.Exp2(-float64(age) / float64(PeerStatsHalfLife))
+	pi.successes = int(math.Round(float64(s.Successes) * decay))
+	pi.failures = int(math.Round(float64(s.Failures) * decay))
+	if pi.successes+pi.failures > 0 {
+		pi.averageTime = s.AverageTime
+	}
+	pi.lastSaved = now
+}
+
+// snapshot returns the stats of the peer to persist, and whether they are due
+// to be saved, at most every PeerStatsSaveInterval unless forced. It's called
+// with the tracker lock held, the stats are written by write once the lock is
+// released.
+func (ps *peerStatsStore) snapshot(pi *peerStats, now time.Time, force bool) (savedPeerStats, bool) {
+	s := savedPeerStats{
+		Successes:   pi.successes,
+		Failures:    pi.failures,
+		AverageTime: pi.averageTime,
+		Saved:       now,
+	}
+	if ps.ds == nil || pi.successes+pi.failures == 0 {
+		return s, false
+	}
+	if !force && now.Sub(pi.lastSaved) < PeerStatsSaveInterval {
+		return s, false
+	}
+	pi.lastSaved = now
+	return s, true
+}
+
+// keep holds on to the stats of a disconnected peer, so that they're restored
+// when it connects again.
+func (ps *peerStatsStore) keep(p peer.ID, s savedPeerStats) {
+	ps.loaded[p] = s
+}
+
+// write persists the stats of the peer
+func (ps *peerStatsStore) write(p peer.ID, s savedPeerStats, globalTime time.Duration) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		log.Errorf("encoding peer stats: %s", err)
+		return
+	}
+	if err := ps.ds.Put(peerStatsPrefix.ChildString(p.String()), b); err != nil {
+		log.Errorf("persisting peer stats: %s", err)
+		return
+	}
+
+	b, err = json.Marshal(globalTime)
+	if err != nil {
+		log.Errorf("encoding average request time: %s", err)
+		return
+	}
+	if err := ps.ds.Put(globalTimeKey, b); err != nil {
+		log.Errorf("persisting average request time: %s", err)
+	}
+}
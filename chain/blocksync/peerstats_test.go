@@ -0,0 +1,77 @@
+package blocksync
+
+import (
+	"testing"
+	"time"
+
+	dstore "github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// lockingDatastore takes the tracker lock on every write, which deadlocks if
+// the tracker writes while holding it
+type lockingDatastore struct {
+	dstore.Datastore
+	bpt *bsPeerTracker
+}
+
+func (ds *lockingDatastore) Put(k dstore.Key, v []byte) error {
+	ds.bpt.lk.Lock()
+	ds.bpt.lk.Unlock() //nolint:staticcheck
+	return ds.Datastore.Put(k, v)
+}
+
+func TestPeerStatsPersist(t *testing.T) {
+	ds := &lockingDatastore{Datastore: dstore.NewMapDatastore()}
+	rep, err := loadReputations(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTracker := func() *bsPeerTracker {
+		ps, err := loadPeerStats(ds, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bpt := newPeerTracker(nil, rep, ps)
+		ds.bpt = bpt
+		return bpt
+	}
+
+	p := peer.ID("peer")
+	bpt := newTracker()
+	bpt.addPeer(p)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bpt.logSuccess(p, time.Second)
+		bpt.logSuccess(p, time.Second)
+		bpt.logFailure(p, time.Second)
+		bpt.removePeer(p)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stats not to be written while holding the tracker lock")
+	}
+
+	expect := func(bpt *bsPeerTracker) {
+		t.Helper()
+		bpt.lk.Lock()
+		defer bpt.lk.Unlock()
+		pi := bpt.peers[p]
+		if pi.successes != 2 || pi.failures != 1 || pi.averageTime != time.Second {
+			t.Fatalf("expected the stats to be restored, got %d successes, %d failures, %s", pi.successes, pi.failures, pi.averageTime)
+		}
+	}
+
+	// the stats are kept when the peer reconnects
+	bpt.addPeer(p)
+	expect(bpt)
+
+	// and when the node restarts
+	bpt = newTracker()
+	bpt.addPeer(p)
+	expect(bpt)
+}
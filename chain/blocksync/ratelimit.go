@@ -0,0 +1,311 @@
+package blocksync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/time/rate"
+	"golang.org/x/xerrors"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+)
+
+// ServerLimits bounds the load peers can put on the blocksync server. Requests
+// over a limit are answered with StatusGoAway, followed by a BSGoAway hint when
+// to retry on streams which negotiated CapRetryAfter.
+// Responses which would go over the byte quota of the peer are cut short, and
+// sent with StatusPartial.
+type ServerLimits struct {
+	// PeerRequestRate is the number of requests per second served to a single
+	// peer, PeerRequestBurst the number of requests allowed in a burst. A zero
+	// rate disables the limit.
+	PeerRequestRate  float64
+	PeerRequestBurst int
+
+	// PeerTipSetRate is the number of tipsets per second served to a single
+	// peer. PeerTipSetBurst should be at least BlockSyncMaxRequestLength,
+	// requests are capped to the burst. A zero rate disables the limit.
+	PeerTipSetRate  float64
+	PeerTipSetBurst int
+
+	// MaxConcurrentRequests is the number of requests processed at the same
+	// time, from all peers. Zero means no limit.
+	MaxConcurrentRequests int
+	// PeerQueueLength is the number of requests of a single peer waiting for
+	// one of the MaxConcurrentRequests slots. Slots are handed to the waiting
+	// peers in turn.
+	PeerQueueLength int
+	// QueueTimeout is how long a request waits for a slot
+	QueueTimeout time.Duration
+	// BusyRetryAfter is the retry hint sent when a request didn't get a slot
+	BusyRetryAfter time.Duration
+
+	// PeerByteQuota is the number of response bytes sent to a single peer in
+	// every QuotaWindow. Zero disables the quota, a quota below
+	// MaxResponseSize is raised to it, so that responses of the maximum size
+	// can be served.
+	PeerByteQuota int64
+	QuotaWindow   time.Duration
+}
+
+var DefaultServerLimits = ServerLimits{
+	PeerRequestRate:  2,
+	PeerRequestBurst: 10,
+
+	PeerTipSetRate:  100,
+	PeerTipSetBurst: 2 * BlockSyncMaxRequestLength,
+
+	MaxConcurrentRequests: 64,
+	PeerQueueLength:       4,
+	QueueTimeout:          5 * time.Second,
+	BusyRetryAfter:        time.Second,
+
+	PeerByteQuota: 1 << 30,
+	QuotaWindow:   time.Minute,
+}
+
+// peerLimitGCInterval is how often limiters of peers which were idle for as
+// long are dropped
+const peerLimitGCInterval = 10 * time.Minute
+
+type peerLimiter struct {
+	requests *rate.Limiter
+	tipsets  *rate.Limiter
+	lastSeen time.Time
+
+	// bytes sent in the quota window starting at windowStart
+	windowStart time.Time
+	windowBytes int64
+}
+
+type serverLimiter struct {
+	cfg ServerLimits
+
+	lk     sync.Mutex
+	peers  map[peer.ID]*peerLimiter
+	lastGC time.Time
+
+	// slots is nil when the number of concurrent requests isn't limited
+	slots *fairQueue
+}
+
+func newServerLimiter(cfg ServerLimits) *serverLimiter {
+	if cfg.PeerByteQuota > 0 && cfg.PeerByteQuota < MaxResponseSize {
+		log.Warnw("raising the blocksync peer byte quota to the maximum response size", "quota", cfg.PeerByteQuota, "size", MaxResponseSize)
+		cfg.PeerByteQuota = MaxResponseSize
+	}
+
+	sl := &serverLimiter{
+		cfg:    cfg,
+		peers:  map[peer.ID]*peerLimiter{},
+		lastGC: time.Now(),
+	}
+	if cfg.MaxConcurrentRequests > 0 {
+		sl.slots = newFairQueue(cfg.MaxConcurrentRequests, cfg.PeerQueueLength)
+	}
+	return sl
+}
+
+// admit checks whether a request for length tipsets from the peer can be
+// served, waiting for a processing slot when all are taken, until the context
+// is cancelled. If it can, the returned function must be called once the
+// request is processed. Otherwise it returns how long the peer should wait
+// before retrying.
+func (sl *serverLimiter) admit(ctx context.Context, p peer.ID, length uint64) (func(), time.Duration, bool) {
+	refund, wait, ok := sl.admitPeer(p, length)
+	if !ok {
+		return nil, wait, false
+	}
+
+	if sl.slots == nil {
+		return func() {}, 0, true
+	}
+
+	if !sl.slots.acquire(ctx, p, sl.cfg.QueueTimeout) {
+		// the request isn't served, don't count it against the rate of the peer
+		refund()
+		return nil, sl.cfg.BusyRetryAfter, false
+	}
+	return sl.slots.release, 0, true
+}
+
+// byteBudget returns the number of response bytes the peer can still be sent
+// in the current quota window, or -1 without a quota
+func (sl *serverLimiter) byteBudget(p peer.ID) int64 {
+	if sl.cfg.PeerByteQuota <= 0 {
+		return -1
+	}
+
+	sl.lk.Lock()
+	defer sl.lk.Unlock()
+
+	now := time.Now()
+	pl := sl.peerLocked(p, now)
+	sl.rollWindow(pl, now)
+
+	if left := sl.cfg.PeerByteQuota - pl.windowBytes; left > 0 {
+		return left
+	}
+	return 0
+}
+
+// charge counts response bytes sent to the peer against its quota
+func (sl *serverLimiter) charge(p peer.ID, n int64) {
+	if sl.cfg.PeerByteQuota <= 0 {
+		return
+	}
+
+	sl.lk.Lock()
+	defer sl.lk.Unlock()
+
+	now := time.Now()
+	pl := sl.peerLocked(p, now)
+	sl.rollWindow(pl, now)
+	pl.windowBytes += n
+}
+
+// peerLocked returns the limiter of the peer, creating it if the peer has none,
+// e.g. because it was idle and its limiter was dropped. Must be called with lk
+// held.
+func (sl *serverLimiter) peerLocked(p peer.ID, now time.Time) *peerLimiter {
+	pl, ok := sl.peers[p]
+	if !ok {
+		pl = &peerLimiter{
+			requests:    newLimiter(sl.cfg.PeerRequestRate, sl.cfg.PeerRequestBurst),
+			tipsets:     newLimiter(sl.cfg.PeerTipSetRate, sl.cfg.PeerTipSetBurst),
+			windowStart: now,
+		}
+		sl.peers[p] = pl
+	}
+	pl.lastSeen = now
+	return pl
+}
+
+func (sl *serverLimiter) rollWindow(pl *peerLimiter, now time.Time) {
+	if now.Sub(pl.windowStart) >= sl.cfg.QuotaWindow {
+		pl.windowStart = now
+		pl.windowBytes = 0
+	}
+}
+
+// admitPeer takes the request and tipset tokens of the request from the
+// limiters of the peer. If they are available, the returned function gives them
+// back.
+func (sl *serverLimiter) admitPeer(p peer.ID, length uint64) (func(), time.Duration, bool) {
+	sl.lk.Lock()
+	defer sl.lk.Unlock()
+
+	now := time.Now()
+	if now.Sub(sl.lastGC) > peerLimitGCInterval {
+		for pid, pl := range sl.peers {
+			if now.Sub(pl.lastSeen) > peerLimitGCInterval {
+				delete(sl.peers, pid)
+			}
+		}
+		sl.lastGC = now
+	}
+
+	pl := sl.peerLocked(p, now)
+
+	if sl.cfg.PeerByteQuota > 0 {
+		sl.rollWindow(pl, now)
+		if pl.windowBytes >= sl.cfg.PeerByteQuota {
+			return nil, pl.windowStart.Add(sl.cfg.QuotaWindow).Sub(now), false
+		}
+	}
+
+	if length > BlockSyncMaxRequestLength {
+		length = BlockSyncMaxRequestLength
+	}
+	n := int(length)
+	if b := pl.tipsets.Burst(); pl.tipsets.Limit() != rate.Inf && n > b {
+		n = b
+	}
+
+	rr := pl.requests.ReserveN(now, 1)
+	tr := pl.tipsets.ReserveN(now, n)
+
+	wait := rr.DelayFrom(now)
+	if d := tr.DelayFrom(now); d > wait {
+		wait = d
+	}
+	if wait > 0 {
+		rr.CancelAt(now)
+		tr.CancelAt(now)
+		return nil, wait, false
+	}
+
+	// reservations are only refunded when cancelled at the time they were
+	// made, later cancellations assume the tokens were used
+	refund := func() {
+		rr.CancelAt(now)
+		tr.CancelAt(now)
+	}
+	return refund, 0, true
+}
+
+func newLimiter(r float64, burst int) *rate.Limiter {
+	if r <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(r), burst)
+}
+
+// BSGoAway follows a StatusGoAway response on streams which negotiated
+// CapRetryAfter. It's a separate message, so that the response stays readable
+// by peers which don't know about it.
+type BSGoAway struct {
+	// RetryAfter is how long the client should wait before retrying, in
+	// milliseconds
+	RetryAfter uint64
+}
+
+func goAwayResponse(reason string, retryAfter time.Duration) *BlockSyncResponse {
+	retryAfter = retryAfter.Round(time.Millisecond)
+	return &BlockSyncResponse{
+		Status:     StatusGoAway,
+		Message:    fmt.Sprintf("%s, retry after %s", reason, retryAfter),
+		retryAfter: retryAfter,
+	}
+}
+
+// writeRetryAfter sends the retry hint of a go away response
+func writeRetryAfter(w io.Writer, res *BlockSyncResponse) error {
+	return cborutil.WriteCborRPC(w, &BSGoAway{
+		RetryAfter: uint64(res.retryAfter / time.Millisecond),
+	})
+}
+
+// readRetryAfter reads the retry hint following a go away response on a
+// stream which negotiated CapRetryAfter
+func readRetryAfter(r io.Reader, res *BlockSyncResponse, caps BSCapabilities) error {
+	if res.Status != StatusGoAway || !caps.Has(CapRetryAfter) {
+		return nil
+	}
+
+	var ga BSGoAway
+	if err := cborutil.ReadCborRPC(r, &ga); err != nil {
+		return xerrors.Errorf("reading go away retry hint: %w", err)
+	}
+	if ga.RetryAfter > uint64(MaxGoAwayCooldown/time.Millisecond) {
+		ga.RetryAfter = uint64(MaxGoAwayCooldown / time.Millisecond)
+	}
+	res.retryAfter = time.Duration(ga.RetryAfter) * time.Millisecond
+	return nil
+}
+
+// RetryAfter returns the retry hint of a go away response, if the server sent
+// one.
+func (res *BlockSyncResponse) RetryAfter() (time.Duration, bool) {
+	if res.Status != StatusGoAway || res.retryAfter <= 0 {
+		return 0, false
+	}
+	return res.retryAfter, true
+}
@@ -0,0 +1,91 @@
+package blocksync
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+)
+
+func TestAdmitRefundsBusy(t *testing.T) {
+	ctx := context.TODO()
+	cfg := DefaultServerLimits
+	cfg.PeerRequestRate = 0.001
+	cfg.PeerRequestBurst = 1
+	cfg.MaxConcurrentRequests = 1
+	cfg.QueueTimeout = 10 * time.Millisecond
+	sl := newServerLimiter(cfg)
+
+	release, _, ok := sl.admit(ctx, "a", 1)
+	if !ok {
+		t.Fatal("expected the first request to be admitted")
+	}
+
+	// all slots are taken
+	_, retryAfter, ok := sl.admit(ctx, "b", 1)
+	if ok || retryAfter != cfg.BusyRetryAfter {
+		t.Fatalf("expected the request to be refused as busy, got %t, %s", ok, retryAfter)
+	}
+
+	// the refused request didn't use the only request token of the peer
+	release()
+	release, _, ok = sl.admit(ctx, "b", 1)
+	if !ok {
+		t.Fatal("expected the retried request to be admitted")
+	}
+	release()
+
+	if _, retryAfter, ok := sl.admit(ctx, "b", 1); ok || retryAfter <= cfg.BusyRetryAfter {
+		t.Fatalf("expected the request over the rate to be refused, got %t, %s", ok, retryAfter)
+	}
+}
+
+func TestGoAwayRetryAfter(t *testing.T) {
+	req := &BlockSyncRequest{RequestLength: 1}
+	creq := &BlockSyncRequest{RequestLength: 1, Options: BSOptCompressed}
+
+	for _, tc := range []struct {
+		name     string
+		req      *BlockSyncRequest
+		caps     BSCapabilities
+		expected time.Duration
+	}{
+		{"plain", req, CapRetryAfter, 1500 * time.Millisecond},
+		{"compressed", creq, CapRetryAfter | CapCompression, 1500 * time.Millisecond},
+		// peers without the capability only get the message
+		{"v1", req, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			compress := ParseBSOptions(tc.req.Options).Compressed
+			if err := writeResponse(&buf, goAwayResponse("busy", 1500*time.Millisecond), tc.caps, compress); err != nil {
+				t.Fatal(err)
+			}
+
+			r, verify, err := openResponse(&buf, tc.req, MaxResponseSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var res BlockSyncResponse
+			if err := cborutil.ReadCborRPC(r, &res); err != nil {
+				t.Fatal(err)
+			}
+			if err := readRetryAfter(r, &res, tc.caps); err != nil {
+				t.Fatal(err)
+			}
+			if err := verify(); err != nil {
+				t.Fatal(err)
+			}
+
+			d, ok := res.RetryAfter()
+			if d != tc.expected || ok != (tc.expected > 0) {
+				t.Fatalf("expected a retry hint of %s, got %s (%t)", tc.expected, d, ok)
+			}
+			if res.Message != "busy, retry after 1.5s" {
+				t.Fatalf("unexpected message %q", res.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package blocksync
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	dstore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	incrt "github.com/filecoin-project/lotus/lib/increadtimeout"
+)
+
+// Reputation scores of blocksync peers. Every successful request raises the
+// score of a peer by RewardSuccess, up to MaxScore, offenses lower it by their
+// penalty. Peers at or below DemoteScore are only used when no better peer is
+// available, peers reaching BanScore aren't used at all for BanDuration.
+var (
+	MaxScore      = 100
+	RewardSuccess = 1
+	DemoteScore   = -20
+	BanScore      = -50
+	BanDuration   = time.Hour
+
+	PenaltyInvalidResponse   = 20
+	PenaltyTruncatedChain    = 5
+	PenaltyProtocolViolation = 10
+)
+
+// ReputationFlushInterval is how often changed scores are persisted at most.
+// Bans are persisted right away.
+var ReputationFlushInterval = time.Minute
+
+type offense int
+
+const (
+	// offenseInvalidResponse is a response which doesn't answer the request
+	offenseInvalidResponse offense = iota
+	// offenseTruncatedChain is a successful response which contains fewer
+	// tipsets than requested without reaching genesis
+	offenseTruncatedChain
+	// offenseProtocolViolation is a malformed or oversized message, or a
+	// failed handshake
+	offenseProtocolViolation
+)
+
+func (o offense) penalty() int {
+	switch o {
+	case offenseInvalidResponse:
+		return PenaltyInvalidResponse
+	case offenseTruncatedChain:
+		return PenaltyTruncatedChain
+	default:
+		return PenaltyProtocolViolation
+	}
+}
+
+// Errors wrapped by errors which are offenses other than invalid responses
+var (
+	errTruncatedChain    = xerrors.New("truncated chain")
+	errProtocolViolation = xerrors.New("protocol violation")
+)
+
+func classifyOffense(err error) offense {
+	switch {
+	case xerrors.Is(err, errTruncatedChain):
+		return offenseTruncatedChain
+	case xerrors.Is(err, errProtocolViolation), xerrors.Is(err, incrt.ErrTooLarge):
+		return offenseProtocolViolation
+	default:
+		return offenseInvalidResponse
+	}
+}
+
+var reputationPrefix = dstore.NewKey("/blocksync/reputation")
+
+// peerReputation is the persisted part of the peer stats
+type peerReputation struct {
+	Score       int
+	Offenses    int
+	BannedUntil time.Time
+}
+
+func (r *peerReputation) banned(now time.Time) bool {
+	return now.Before(r.BannedUntil)
+}
+
+// reputations keeps peer scores in memory, and flushes the changed ones to the
+// metadata datastore so that bans survive restarts.
+type reputations struct {
+	lk        sync.Mutex
+	ds        dstore.Datastore
+	peers     map[peer.ID]*peerReputation
+	dirty     map[peer.ID]struct{}
+	lastFlush time.Time
+
+	// flushLk orders the writes of concurrent flushes
+	flushLk sync.Mutex
+}
+
+func loadReputations(ds dstore.Datastore) (*reputations, error) {
+	r := &reputations{
+		ds:    ds,
+		peers: map[peer.ID]*peerReputation{},
+		dirty: map[peer.ID]struct{}{},
+		// nothing changed yet
+		lastFlush: time.Now(),
+	}
+	if ds == nil {
+		return r, nil
+	}
+
+	res, err := ds.Query(query.Query{Prefix: reputationPrefix.String()})
+	if err != nil {
+		return nil, xerrors.Errorf("querying peer reputations: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, xerrors.Errorf("iterating peer reputations: %w", e.Error)
+		}
+
+		p, err := peer.Decode(dstore.RawKey(e.Key).BaseNamespace())
+		if err != nil {
+			log.Warnf("bad peer reputation key %s: %s", e.Key, err)
+			continue
+		}
+
+		var pr peerReputation
+		if err := json.Unmarshal(e.Value, &pr); err != nil {
+			log.Warnf("bad peer reputation for %s: %s", p, err)
+			continue
+		}
+		r.peers[p] = &pr
+	}
+
+	return r, nil
+}
+
+func (r *reputations) get(p peer.ID) peerReputation {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	if pr, ok := r.peers[p]; ok {
+		return *pr
+	}
+	return peerReputation{}
+}
+
+func (r *reputations) all() map[peer.ID]peerReputation {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	out := make(map[peer.ID]peerReputation, len(r.peers))
+	for p, pr := range r.peers {
+		out[p] = *pr
+	}
+	return out
+}
+
+func (r *reputations) success(p peer.ID) {
+	r.update(p, func(pr *peerReputation) {
+		pr.Score += RewardSuccess
+		if pr.Score > MaxScore {
+			pr.Score = MaxScore
+		}
+	})
+}
+
+// offense lowers the score of the peer, and bans it when the score reaches
+// BanScore. It returns true if the peer got banned.
+func (r *reputations) offense(p peer.ID, o offense) bool {
+	var banned bool
+	r.update(p, func(pr *peerReputation) {
+		pr.Score -= o.penalty()
+		pr.Offenses++
+
+		if pr.Score <= BanScore {
+			pr.BannedUntil = time.Now().Add(BanDuration)
+			// start over at the demotion threshold once the ban expires
+			pr.Score = DemoteScore
+			banned = true
+		}
+	})
+	return banned
+}
+
+func (r *reputations) update(p peer.ID, cb func(*peerReputation)) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	pr, ok := r.peers[p]
+	if !ok {
+		pr = &peerReputation{}
+		r.peers[p] = pr
+	}
+
+	before := *pr
+	cb(pr)
+	if *pr != before {
+		r.dirty[p] = struct{}{}
+	}
+}
+
+// flush persists the changed scores, at most every ReputationFlushInterval
+// unless forced. It must not be called with the tracker lock held.
+func (r *reputations) flush(now time.Time, force bool) {
+	r.flushLk.Lock()
+	defer r.flushLk.Unlock()
+
+	r.lk.Lock()
+	if r.ds == nil || len(r.dirty) == 0 || (!force && now.Sub(r.lastFlush) < ReputationFlushInterval) {
+		r.lk.Unlock()
+		return
+	}
+	changed := make(map[peer.ID]peerReputation, len(r.dirty))
+	for p := range r.dirty {
+		changed[p] = *r.peers[p]
+	}
+	r.dirty = map[peer.ID]struct{}{}
+	r.lastFlush = now
+	r.lk.Unlock()
+
+	for p, pr := range changed {
+		b, err := json.Marshal(pr)
+		if err != nil {
+			log.Errorf("encoding peer reputation: %s", err)
+			continue
+		}
+		if err := r.ds.Put(reputationPrefix.ChildString(p.String()), b); err != nil {
+			log.Errorf("persisting peer reputation: %s", err)
+
+			// retried with the next flush
+			r.lk.Lock()
+			r.dirty[p] = struct{}{}
+			r.lk.Unlock()
+		}
+	}
+}
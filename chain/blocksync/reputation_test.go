@@ -0,0 +1,96 @@
+package blocksync
+
+import (
+	"testing"
+	"time"
+
+	dstore "github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+)
+
+type countingDatastore struct {
+	lockingDatastore
+	puts int
+}
+
+func (ds *countingDatastore) Put(k dstore.Key, v []byte) error {
+	ds.puts++
+	return ds.lockingDatastore.Put(k, v)
+}
+
+func TestReputationFlush(t *testing.T) {
+	ds := &countingDatastore{lockingDatastore: lockingDatastore{Datastore: dstore.NewMapDatastore()}}
+
+	newTracker := func() *bsPeerTracker {
+		rep, err := loadReputations(ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps, err := loadPeerStats(nil, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bpt := newPeerTracker(nil, rep, ps)
+		ds.bpt = bpt
+		return bpt
+	}
+
+	p := peer.ID("peer")
+	bpt := newTracker()
+	bpt.addPeer(p)
+
+	run := func(cb func()) {
+		t.Helper()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cb()
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the reputations not to be written while holding the tracker lock")
+		}
+	}
+
+	// changes wait for the flush interval
+	run(func() {
+		bpt.logSuccess(p, time.Second)
+		bpt.logSuccess(p, time.Second)
+		bpt.logSuccess(p, time.Second)
+	})
+	if ds.puts != 0 {
+		t.Fatalf("expected the scores not to be written yet, got %d writes", ds.puts)
+	}
+
+	// a ban is written right away
+	run(func() {
+		for !bpt.banned(p) {
+			bpt.logMisbehavior(p, xerrors.New("invalid response"))
+		}
+	})
+	if ds.puts != 1 {
+		t.Fatalf("expected the ban to be written, got %d writes", ds.puts)
+	}
+
+	bpt = newTracker()
+	if r := bpt.rep.get(p); !r.banned(time.Now()) || r.Score != DemoteScore {
+		t.Fatalf("expected the ban to survive a restart, got %+v", r)
+	}
+
+	// pending changes are flushed when the peer disconnects
+	bpt.addPeer(p)
+	run(func() {
+		bpt.logMisbehavior(p, errTruncatedChain)
+		bpt.removePeer(p)
+	})
+	if ds.puts != 2 {
+		t.Fatalf("expected the pending change to be written, got %d writes", ds.puts)
+	}
+
+	bpt = newTracker()
+	if r := bpt.rep.get(p); r.Score != DemoteScore-PenaltyTruncatedChain {
+		t.Fatalf("expected the score to be restored, got %+v", r)
+	}
+}
@@ -0,0 +1,366 @@
+package blocksync
+
+import (
+	"context"
+	"io"
+	"time"
+
+	inet "github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"go.opencensus.io/stats"
+	"golang.org/x/xerrors"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	incrt "github.com/filecoin-project/lotus/lib/increadtimeout"
+	"github.com/filecoin-project/lotus/metrics"
+)
+
+// GetBlocksStream fetches count tipsets from the provided tipset backwards,
+// like GetBlocks, but sends every tipset on the returned channel as soon as it
+// was decoded, so that callers can process the start of the segment while the
+// rest is still on the wire.
+//
+// Like GetBlocks, long segments are requested in chunks of RequestChunkSize
+// tipsets, spread over the best peers. A chunk is streamed from a single peer;
+// when the peer fails, or doesn't send the first tipset within the hedge
+// deadline, the rest of the chunk is fetched with a hedged GetBlocks request,
+// which also falls back to graphsync. The channel is closed when the segment
+// is complete, or early if it can't be fetched from any peer; callers detect
+// the latter from the number of tipsets received.
+func (bs *BlockSync) GetBlocksStream(ctx context.Context, tsk types.TipSetKey, count int) (<-chan *types.TipSet, error) {
+	if count <= 0 {
+		return nil, xerrors.Errorf("invalid tipset count %d", count)
+	}
+
+	peers := bs.getPeers()
+	if len(peers) == 0 {
+		return nil, xerrors.Errorf("no blocksync peers")
+	}
+	shufflePrefix(peers)
+
+	out := make(chan *types.TipSet, 16)
+	go func() {
+		defer close(out)
+		streamSegment(ctx, out, tsk, count, peers, bs.streamChunk, bs.getBlocks)
+	}()
+
+	return out, nil
+}
+
+type (
+	// streamFunc streams up to n tipsets from start from a peer, calling cb
+	// with every tipset, and returns the number of tipsets passed to cb
+	streamFunc func(ctx context.Context, p peer.ID, start types.TipSetKey, n int, cb func(*types.TipSet) error) (int, error)
+	// fetchFunc fetches up to n tipsets from start, from any peer
+	fetchFunc func(ctx context.Context, start types.TipSetKey, n int, chunk int) ([]*types.TipSet, error)
+)
+
+// streamSegment sends the count tipsets from tsk backwards to out, chunk by
+// chunk. Chunks are streamed from the peers in turn, and fetched when the
+// stream fails.
+func streamSegment(ctx context.Context, out chan<- *types.TipSet, tsk types.TipSetKey, count int, peers []peer.ID, stream streamFunc, fetch fetchFunc) {
+	var last *types.TipSet
+	send := func(ts *types.TipSet) error {
+		select {
+		case out <- ts:
+			last = ts
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	cur := tsk
+	left := count
+	for chunk := 0; left > 0; chunk++ {
+		n := left
+		if RequestChunkSize > 0 && n > RequestChunkSize {
+			n = RequestChunkSize
+		}
+
+		p := peers[chunk%len(peers)]
+		got, err := stream(ctx, p, cur, n, send)
+		if ctx.Err() != nil {
+			return
+		}
+		if got > 0 && last.Height() == 0 {
+			return
+		}
+
+		if got < n {
+			if err != nil {
+				log.Warnf("streaming blocks from peer %s failed after %d tipsets: %s", p, got, err)
+			}
+			if got > 0 {
+				cur = last.Parents()
+				recordContinuation(ctx, protoBlockSync)
+			}
+
+			tss, err := fetch(ctx, cur, n-got, chunk)
+			if err != nil {
+				log.Errorf("GetBlocksStream failed, %d of %d tipsets missing: %s", left-got, count, err)
+				return
+			}
+			for _, ts := range tss {
+				if send(ts) != nil {
+					return
+				}
+			}
+			got += len(tss)
+		}
+
+		left -= got
+		if last.Height() == 0 {
+			return
+		}
+		cur = last.Parents()
+	}
+}
+
+// streamChunk streams a chunk of n tipsets from the peer. The stream is
+// abandoned when the peer doesn't send the first tipset within the hedge
+// deadline, so that a slow peer doesn't hold up the sync.
+func (bs *BlockSync) streamChunk(ctx context.Context, p peer.ID, start types.TipSetKey, n int, cb func(*types.TipSet) error) (int, error) {
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stall *time.Timer
+	if d := bs.syncPeers.hedgeDelay(uint64(n)); d > 0 {
+		stall = time.AfterFunc(d, cancel)
+		defer stall.Stop()
+	}
+
+	req := &BlockSyncRequest{
+		Start:         start.Cids(),
+		RequestLength: uint64(n),
+		Options:       BSOptBlocks,
+	}
+	return bs.streamBlocksFromPeer(sctx, p, req, func(ts *types.TipSet) error {
+		if stall != nil {
+			stall.Stop()
+		}
+		return cb(ts)
+	})
+}
+
+// streamBlocksFromPeer sends the request to the peer, and calls cb with every
+// tipset of the response as soon as it's decoded and checked to continue the
+// requested chain. It returns the number of tipsets passed to cb.
+func (bs *BlockSync) streamBlocksFromPeer(ctx context.Context, p peer.ID, req *BlockSyncRequest, cb func(*types.TipSet) error) (n int, err error) {
+	if bs.syncPeers.banned(p) {
+		return 0, xerrors.Errorf("peer %s is banned from blocksync", p)
+	}
+
+	// responses can't be streamed over graphsync
+	supp, err := bs.host.Peerstore().SupportsProtocols(p, BlockSyncProtocolIDv2, BlockSyncProtocolID)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to get protocols for peer: %w", err)
+	}
+	if len(supp) == 0 {
+		return 0, xerrors.Errorf("peer %s doesn't support blocksync", p)
+	}
+
+	release, err := bs.syncPeers.acquire(ctx, p)
+	if err != nil {
+		return 0, xerrors.Errorf("waiting for a free request slot: %w", err)
+	}
+	defer release()
+
+	start := time.Now()
+	var res *BlockSyncResponse
+	defer func() {
+		// once the peer answered, the request is recorded with the status of
+		// the response, like requests which aren't streamed
+		rerr := err
+		if res != nil && !xerrors.Is(err, ErrGoAway) {
+			rerr = nil
+		}
+		recordClientRequest(ctx, protoBlockSync, res, rerr, time.Since(start))
+	}()
+
+	s, err := bs.host.NewStream(inet.WithNoDial(ctx, "should already have connection"), p, BlockSyncProtocols...)
+	if err != nil {
+		bs.RemovePeer(p)
+		return 0, xerrors.Errorf("failed to open stream to peer: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+	defer streamOpened(ctx, metrics.BlocksyncClientStreams, &clientStreams)()
+
+	// unblock reads when the caller gives up
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = s.Reset()
+		case <-done:
+		}
+	}()
+
+	// a cancelled request isn't the fault of the peer
+	logFailure := func() {
+		if ctx.Err() == nil {
+			bs.syncPeers.logFailure(p, time.Since(start))
+		}
+	}
+
+	_ = s.SetWriteDeadline(time.Now().Add(bs.timeouts.WriteTimeout))
+	var caps BSCapabilities
+	if s.Protocol() == BlockSyncProtocolIDv2 {
+		caps, err = negotiateClient(s)
+		if err != nil {
+			logFailure()
+			if xerrors.Is(err, errProtocolViolation) {
+				bs.syncPeers.logMisbehavior(p, err)
+			}
+			return 0, err
+		}
+		bs.syncPeers.setCapabilities(p, caps)
+	}
+
+	req = compressRequest(req, caps)
+	if err := cborutil.WriteCborRPC(s, req); err != nil {
+		logFailure()
+		return 0, err
+	}
+	_ = s.SetWriteDeadline(time.Time{})
+
+	rcfg := bs.timeouts.responseReadConfig(req)
+	cr := &countingReader{r: incrt.NewWithConfig(s, rcfg)}
+	defer func() {
+		stats.Record(ctx, metrics.BlocksyncClientBytesReceived.M(cr.n))
+	}()
+	br, verify, err := openResponse(cr, req, rcfg.MaxBytes)
+	if err != nil {
+		logFailure()
+		return 0, err
+	}
+
+	var prev *types.TipSet
+	sres, err := readResponseStream(br, func(bts *BSTipSet) error {
+		if uint64(n) >= req.RequestLength {
+			return xerrors.Errorf("response contains more than the %d requested tipsets", req.RequestLength)
+		}
+
+		ts, err := types.NewTipSet(bts.Blocks)
+		if err != nil {
+			return xerrors.Errorf("tipset %d of the response: %w", n, err)
+		}
+		if prev == nil && !sameCids(ts.Cids(), req.Start) {
+			return xerrors.Errorf("response doesn't start at the requested tipset %s", req.Start)
+		}
+		if prev != nil && !types.CidArrsEqual(prev.Parents().Cids(), ts.Cids()) {
+			return xerrors.Errorf("parents of tipset %d are not tipset %d", n-1, n)
+		}
+
+		if err := cb(ts); err != nil {
+			return err
+		}
+		prev = ts
+		n++
+		return nil
+	})
+	if err == nil {
+		err = readRetryAfter(br, sres, caps)
+	}
+	if err == nil {
+		err = verify()
+	}
+	if err != nil {
+		logFailure()
+		var cbErr callbackError
+		switch {
+		case xerrors.As(err, &cbErr) && ctx.Err() == nil:
+			bs.syncPeers.logMisbehavior(p, cbErr.error)
+		case xerrors.Is(err, incrt.ErrTooLarge):
+			bs.syncPeers.logMisbehavior(p, err)
+		}
+		return n, err
+	}
+	res = sres
+
+	bs.syncPeers.logSuccess(p, time.Since(start))
+
+	switch res.Status {
+	case StatusOK, StatusPartial:
+		if n == 0 {
+			bs.syncPeers.logMisbehavior(p, xerrors.New("successful response contains no tipsets"))
+			return 0, xerrors.Errorf("got no blocks in successful blocksync response")
+		}
+		return n, nil
+	case StatusGoAway:
+		return n, bs.handleGoAway(ctx, p, res)
+	default:
+		return n, bs.processStatus(req, res)
+	}
+}
+
+// callbackError marks errors returned by the tipset callback of
+// readResponseStream
+type callbackError struct {
+	error
+}
+
+func (e callbackError) Unwrap() error {
+	return e.error
+}
+
+// readResponseStream decodes a BlockSyncResponse, calling cb with every tipset
+// of the chain as soon as it's decoded. The chain comes first in the encoding,
+// so the status is only known once all tipsets were read. The returned
+// response doesn't include the chain.
+func readResponseStream(r io.Reader, cb func(*BSTipSet) error) (*BlockSyncResponse, error) {
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return nil, err
+	}
+	if maj != cbg.MajArray || extra != 3 {
+		return nil, xerrors.Errorf("response should be an array of 3 fields")
+	}
+
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return nil, err
+	}
+	if maj != cbg.MajArray {
+		return nil, xerrors.Errorf("response chain should be an array")
+	}
+	if extra > cbg.MaxLength {
+		return nil, xerrors.Errorf("response chain too long (%d)", extra)
+	}
+
+	for i := 0; i < int(extra); i++ {
+		var bts BSTipSet
+		if err := bts.UnmarshalCBOR(br); err != nil {
+			return nil, xerrors.Errorf("decoding tipset %d: %w", i, err)
+		}
+		if err := cb(&bts); err != nil {
+			return nil, callbackError{err}
+		}
+	}
+
+	var res BlockSyncResponse
+
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return nil, err
+	}
+	if maj != cbg.MajUnsignedInt {
+		return nil, xerrors.Errorf("wrong type for response status")
+	}
+	res.Status = extra
+
+	msg, err := cbg.ReadStringBuf(br, scratch)
+	if err != nil {
+		return nil, err
+	}
+	res.Message = msg
+
+	return &res, nil
+}
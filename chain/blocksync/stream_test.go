@@ -0,0 +1,155 @@
+package blocksync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+// testChain returns a chain of n tipsets, from the genesis
+func testChain(n int) []*types.TipSet {
+	chain := []*types.TipSet{mock.TipSet(mock.MkBlock(nil, 1, 0))}
+	for i := 1; i < n; i++ {
+		chain = append(chain, mock.TipSet(mock.MkBlock(chain[i-1], 1, uint64(i))))
+	}
+	return chain
+}
+
+// segment returns up to n tipsets of the chain from start backwards
+func segment(chain []*types.TipSet, start types.TipSetKey, n int) []*types.TipSet {
+	var out []*types.TipSet
+	for i := len(chain) - 1; i >= 0 && len(out) < n; i-- {
+		if len(out) > 0 || chain[i].Key() == start {
+			out = append(out, chain[i])
+		}
+	}
+	return out
+}
+
+func TestStreamSegment(t *testing.T) {
+	orig := RequestChunkSize
+	RequestChunkSize = 3
+	defer func() {
+		RequestChunkSize = orig
+	}()
+
+	chain := testChain(10)
+	head := chain[len(chain)-1].Key()
+	errFailed := errors.New("failed")
+
+	for _, tc := range []struct {
+		name string
+		// failAfter is the number of tipsets peers send before failing,
+		// peers not in the map don't fail
+		failAfter map[peer.ID]int
+		fetchErr  error
+		count     int
+		expected  int
+		fetched   int
+	}{
+		{name: "ok", count: 10, expected: 10},
+		{name: "short", count: 4, expected: 4},
+		{name: "to genesis", count: 20, expected: 10},
+		{name: "peer fails", failAfter: map[peer.ID]int{"b": 1}, count: 10, expected: 10, fetched: 2},
+		{name: "peer stalls", failAfter: map[peer.ID]int{"a": 0}, count: 10, expected: 10, fetched: 6},
+		{name: "fetch fails", failAfter: map[peer.ID]int{"b": 1}, fetchErr: errFailed, count: 10, expected: 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stream := func(ctx context.Context, p peer.ID, start types.TipSetKey, n int, cb func(*types.TipSet) error) (int, error) {
+				var sent int
+				for _, ts := range segment(chain, start, n) {
+					if fa, ok := tc.failAfter[p]; ok && sent == fa {
+						return sent, errFailed
+					}
+					if err := cb(ts); err != nil {
+						return sent, err
+					}
+					sent++
+				}
+				return sent, nil
+			}
+
+			var fetched int
+			fetch := func(ctx context.Context, start types.TipSetKey, n int, chunk int) ([]*types.TipSet, error) {
+				if tc.fetchErr != nil {
+					return nil, tc.fetchErr
+				}
+				tss := segment(chain, start, n)
+				fetched += len(tss)
+				return tss, nil
+			}
+
+			out := make(chan *types.TipSet, 20)
+			streamSegment(context.Background(), out, head, tc.count, []peer.ID{"a", "b"}, stream, fetch)
+			close(out)
+
+			var got []*types.TipSet
+			for ts := range out {
+				got = append(got, ts)
+			}
+			if len(got) != tc.expected {
+				t.Fatalf("expected %d tipsets, got %d", tc.expected, len(got))
+			}
+			for i, ts := range got {
+				if ts != chain[len(chain)-1-i] {
+					t.Fatalf("tipset %d is at height %d", i, ts.Height())
+				}
+			}
+			if fetched != tc.fetched {
+				t.Fatalf("expected %d fetched tipsets, got %d", tc.fetched, fetched)
+			}
+		})
+	}
+}
+
+func TestReadResponseStream(t *testing.T) {
+	chain := testChain(3)
+
+	res := &BlockSyncResponse{Status: StatusPartial, Message: "partial"}
+	for i := len(chain) - 1; i >= 0; i-- {
+		res.Chain = append(res.Chain, &BSTipSet{Blocks: chain[i].Blocks()})
+	}
+
+	var buf bytes.Buffer
+	if err := res.MarshalCBOR(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var heights []uint64
+	out, err := readResponseStream(bytes.NewReader(buf.Bytes()), func(bts *BSTipSet) error {
+		heights = append(heights, uint64(bts.Blocks[0].Height))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 3 || heights[0] != 2 || heights[2] != 0 {
+		t.Fatalf("unexpected tipsets %v", heights)
+	}
+	if out.Status != StatusPartial || out.Message != "partial" {
+		t.Fatalf("unexpected status %d: %s", out.Status, out.Message)
+	}
+
+	// errors of the callback are told apart from decoding errors
+	errStop := errors.New("stop")
+	_, err = readResponseStream(bytes.NewReader(buf.Bytes()), func(*BSTipSet) error {
+		return errStop
+	})
+	var cbErr callbackError
+	if !xerrors.As(err, &cbErr) || !xerrors.Is(err, errStop) {
+		t.Fatalf("expected a callback error, got %v", err)
+	}
+
+	if _, err := readResponseStream(bytes.NewReader(buf.Bytes()[:buf.Len()/2]), func(*BSTipSet) error {
+		return nil
+	}); err == nil || xerrors.As(err, &cbErr) {
+		t.Fatalf("expected a decoding error, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package blocksync
+
+import (
+	"time"
+
+	incrt "github.com/filecoin-project/lotus/lib/increadtimeout"
+)
+
+// ClientTimeouts bounds how long the client waits for a peer on a blocksync
+// stream, and picks the protocol chain segments are fetched over.
+type ClientTimeouts struct {
+	// WriteTimeout is the deadline for sending the handshake and the request
+	WriteTimeout time.Duration
+
+	// MinResponseSpeed is the minimum sustained speed of a response, in bytes
+	// per second
+	MinResponseSpeed int64
+
+	// ReadWait is the longest a single read of a response may block. Servers
+	// load the whole segment before they start sending, so the wait is
+	// extended by ReadWaitPerTipSet for every requested tipset, up to
+	// MaxReadWait.
+	ReadWait          time.Duration
+	ReadWaitPerTipSet time.Duration
+	MaxReadWait       time.Duration
+
+	// PreferGraphsync makes the client fetch chain segments over graphsync
+	// from peers which support both graphsync and BlockSync. BlockSync is used
+	// as a fallback when a graphsync traversal fails.
+	PreferGraphsync bool
+}
+
+var DefaultClientTimeouts = ClientTimeouts{
+	WriteTimeout: 5 * time.Second,
+
+	MinResponseSpeed: 50 << 10,
+
+	ReadWait:          5 * time.Second,
+	ReadWaitPerTipSet: 50 * time.Millisecond,
+	MaxReadWait:       time.Minute,
+}
+
+// responseReadConfig returns the read config for the response to the request
+func (t ClientTimeouts) responseReadConfig(req *BlockSyncRequest) incrt.Config {
+	cfg := ResponseReadConfig
+	if t.MinResponseSpeed > 0 {
+		cfg.MinSpeed = t.MinResponseSpeed
+	}
+
+	wait := t.ReadWait + time.Duration(req.RequestLength)*t.ReadWaitPerTipSet
+	if t.MaxReadWait > 0 && wait > t.MaxReadWait {
+		wait = t.MaxReadWait
+	}
+	if wait > 0 {
+		cfg.MaxWait = wait
+	}
+
+	cfg.MaxBytes = responseBudget(req)
+	return cfg
+}
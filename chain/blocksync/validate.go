@@ -0,0 +1,109 @@
+package blocksync
+
+import (
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// validateResponse checks that a successful response answers the request it
+// was sent for. Responses failing validation are treated as misbehavior of
+// the peer which sent them.
+func validateResponse(req *BlockSyncRequest, res *BlockSyncResponse) error {
+	if res.Status != StatusOK && res.Status != StatusPartial {
+		return nil
+	}
+
+	if len(res.Chain) == 0 {
+		return xerrors.Errorf("successful response contains no tipsets")
+	}
+	if uint64(len(res.Chain)) > req.RequestLength {
+		return xerrors.Errorf("response contains %d tipsets, %d were requested", len(res.Chain), req.RequestLength)
+	}
+
+	opts := ParseBSOptions(req.Options)
+
+	if opts.IncludeBlocks {
+		if !sameCids(tipsetCids(res.Chain[0]), req.Start) {
+			return xerrors.Errorf("response doesn't start at the requested tipset %s", req.Start)
+		}
+
+		for i := 1; i < len(res.Chain); i++ {
+			if len(res.Chain[i-1].Blocks) == 0 || len(res.Chain[i].Blocks) == 0 {
+				return xerrors.Errorf("tipset %d of the response has no blocks", i)
+			}
+			if !sameCids(res.Chain[i-1].Blocks[0].Parents, tipsetCids(res.Chain[i])) {
+				return xerrors.Errorf("parents of tipset %d are not tipset %d", i-1, i)
+			}
+		}
+
+		// only partial responses may stop short of genesis
+		last := res.Chain[len(res.Chain)-1]
+		if res.Status == StatusOK && uint64(len(res.Chain)) < req.RequestLength && len(last.Blocks) > 0 && last.Blocks[0].Height > 0 {
+			return xerrors.Errorf("%w: got %d of %d tipsets", errTruncatedChain, len(res.Chain), req.RequestLength)
+		}
+	}
+
+	if opts.IncludeMessages {
+		for i, bts := range res.Chain {
+			if err := validateMsgIncludes(bts, opts.IncludeBlocks); err != nil {
+				return xerrors.Errorf("messages of tipset %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateMsgIncludes checks that the message includes of a tipset reference
+// messages in the response, and have an entry for every block.
+func validateMsgIncludes(bts *BSTipSet, withBlocks bool) error {
+	if len(bts.BlsMsgIncludes) != len(bts.SecpkMsgIncludes) {
+		return xerrors.Errorf("bls includes for %d blocks, secpk includes for %d", len(bts.BlsMsgIncludes), len(bts.SecpkMsgIncludes))
+	}
+	if withBlocks && len(bts.BlsMsgIncludes) != len(bts.Blocks) {
+		return xerrors.Errorf("includes for %d blocks, tipset has %d", len(bts.BlsMsgIncludes), len(bts.Blocks))
+	}
+
+	for bi, incl := range bts.BlsMsgIncludes {
+		for _, mi := range incl {
+			if mi >= uint64(len(bts.BlsMessages)) {
+				return xerrors.Errorf("block %d includes bls message %d, response has %d", bi, mi, len(bts.BlsMessages))
+			}
+		}
+	}
+	for bi, incl := range bts.SecpkMsgIncludes {
+		for _, mi := range incl {
+			if mi >= uint64(len(bts.SecpkMessages)) {
+				return xerrors.Errorf("block %d includes secpk message %d, response has %d", bi, mi, len(bts.SecpkMessages))
+			}
+		}
+	}
+
+	return nil
+}
+
+func tipsetCids(bts *BSTipSet) []cid.Cid {
+	out := make([]cid.Cid, len(bts.Blocks))
+	for i, b := range bts.Blocks {
+		out[i] = b.Cid()
+	}
+	return out
+}
+
+// sameCids compares sets of cids, ignoring their order
+func sameCids(a, b []cid.Cid) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	set := make(map[cid.Cid]struct{}, len(a))
+	for _, c := range a {
+		set[c] = struct{}{}
+	}
+	for _, c := range b {
+		if _, ok := set[c]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// blockValidations deduplicates validations of the same block. Sync workers
+// validating independent branches in parallel often share the ancestors
+// above our head, which are then validated once, and the other workers
+// wait for the result. The state of the shared ancestors is reused through
+// the state manager cache.
+type blockValidations struct {
+	lk       sync.Mutex
+	inflight map[cid.Cid]*blockValidation
+}
+
+type blockValidation struct {
+	done chan struct{}
+	err  error
+}
+
+func newBlockValidations() *blockValidations {
+	return &blockValidations{inflight: map[cid.Cid]*blockValidation{}}
+}
+
+// validate runs validate for the block, unless another worker is validating
+// it already, in which case its result is returned.
+func (bv *blockValidations) validate(ctx context.Context, b *types.FullBlock, validate func(context.Context, *types.FullBlock) error) error {
+	for {
+		bv.lk.Lock()
+		v, ok := bv.inflight[b.Cid()]
+		if !ok {
+			v = &blockValidation{done: make(chan struct{})}
+			bv.inflight[b.Cid()] = v
+			bv.lk.Unlock()
+
+			v.err = validate(ctx, b)
+
+			bv.lk.Lock()
+			delete(bv.inflight, b.Cid())
+			bv.lk.Unlock()
+			close(v.done)
+			return v.err
+		}
+		bv.lk.Unlock()
+
+		select {
+		case <-v.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// the sync validating the block was cancelled, validate it ourselves
+		if errors.Is(v.err, context.Canceled) || errors.Is(v.err, context.DeadlineExceeded) {
+			continue
+		}
+		return v.err
+	}
+}
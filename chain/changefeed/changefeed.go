@@ -0,0 +1,318 @@
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var log = logging.Logger("changefeed")
+
+var (
+	cursorKey   = datastore.NewKey("/cursor")
+	entryPrefix = datastore.NewKey("/e")
+)
+
+const (
+	EntryApply  = "apply"
+	EntryRevert = "revert"
+)
+
+// cursor is the position of the feed: the last tipset it processed, and the
+// sequence number of the last entry
+type cursor struct {
+	TipSet types.TipSetKey
+	Seq    uint64
+}
+
+// Feed records every tipset applied to and reverted from the chain in a
+// persisted log with sequence numbers, for external indexers which must not
+// miss any change. It follows the chain with a store.Follower, so the cursor
+// only moves past entries which were stored; after a failure or a restart the
+// feed catches up from the last tipset it processed.
+//
+// The feed starts at the head the node had when it was enabled, and keeps the
+// latest Retention entries, all of them when Retention is zero.
+type Feed struct {
+	cs        *store.ChainStore
+	ds        datastore.Batching
+	retention uint64
+
+	lk      sync.Mutex
+	cur     cursor
+	started bool
+	// changed is closed and replaced when entries are added
+	changed chan struct{}
+}
+
+func New(cs *store.ChainStore, ds datastore.Batching, retention uint64) (*Feed, error) {
+	f := &Feed{
+		cs:        cs,
+		ds:        ds,
+		retention: retention,
+		changed:   make(chan struct{}),
+	}
+
+	b, err := ds.Get(cursorKey)
+	switch {
+	case err == datastore.ErrNotFound:
+	case err != nil:
+		return nil, xerrors.Errorf("getting cursor: %w", err)
+	default:
+		if err := json.Unmarshal(b, &f.cur); err != nil {
+			return nil, xerrors.Errorf("unmarshaling cursor: %w", err)
+		}
+		f.started = true
+	}
+
+	// the retention may have been lowered
+	if err := f.prune(); err != nil {
+		return nil, xerrors.Errorf("pruning changefeed: %w", err)
+	}
+
+	return f, nil
+}
+
+// Run follows the chain until the context is cancelled.
+func (f *Feed) Run(ctx context.Context) {
+	f.cs.Follow(ctx, f.follower())
+}
+
+func (f *Feed) follower() *store.Follower {
+	return &store.Follower{
+		Name:   "changefeed",
+		Cursor: f.cursor,
+		Start:  f.start,
+		Apply: func(_ context.Context, ts *types.TipSet) error {
+			return f.record(EntryApply, ts)
+		},
+		Revert: func(_ context.Context, ts *types.TipSet) error {
+			return f.record(EntryRevert, ts)
+		},
+	}
+}
+
+// cursor returns the last tipset processed, and false when the feed didn't
+// start yet
+func (f *Feed) cursor() (types.TipSetKey, bool, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return f.cur.TipSet, f.started, nil
+}
+
+// start moves the cursor of a new feed to the head, without recording it
+func (f *Feed) start(head *types.TipSet) error {
+	log.Infof("starting changefeed at height %d", head.Height())
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	if err := f.putCursor(nil, cursor{TipSet: head.Key()}); err != nil {
+		return err
+	}
+	f.started = true
+	return nil
+}
+
+// record appends the entry of the tipset, and moves the cursor to it, or to
+// its parent when it's reverted.
+func (f *Feed) record(typ string, ts *types.TipSet) error {
+	msgs, err := f.cs.MessagesForTipset(ts)
+	if err != nil {
+		return xerrors.Errorf("loading messages: %w", err)
+	}
+
+	e := &api.ChangefeedEntry{
+		Type:           typ,
+		TipSet:         ts.Key(),
+		Height:         ts.Height(),
+		Blocks:         ts.Cids(),
+		Messages:       make([]cid.Cid, len(msgs)),
+		ParentState:    ts.ParentState(),
+		ParentReceipts: ts.Blocks()[0].ParentMessageReceipts,
+	}
+	for i, m := range msgs {
+		e.Messages[i] = m.Cid()
+	}
+
+	next := ts.Key()
+	if typ == EntryRevert {
+		next = ts.Parents()
+	}
+
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	e.Seq = f.cur.Seq + 1
+	if err := f.putCursor(e, cursor{TipSet: next, Seq: e.Seq}); err != nil {
+		return err
+	}
+
+	if f.retention > 0 && e.Seq > f.retention {
+		if err := f.ds.Delete(entryKey(e.Seq - f.retention)); err != nil && err != datastore.ErrNotFound {
+			log.Warnf("pruning changefeed: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// putCursor writes the entry, if any, together with the new cursor, and wakes
+// up the subscribers. Must be called with lk held.
+func (f *Feed) putCursor(e *api.ChangefeedEntry, c cursor) error {
+	batch, err := f.ds.Batch()
+	if err != nil {
+		return xerrors.Errorf("creating batch: %w", err)
+	}
+
+	if e != nil {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return xerrors.Errorf("marshaling entry: %w", err)
+		}
+		if err := batch.Put(entryKey(e.Seq), b); err != nil {
+			return xerrors.Errorf("storing entry %d: %w", e.Seq, err)
+		}
+	}
+
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return xerrors.Errorf("marshaling cursor: %w", err)
+	}
+	if err := batch.Put(cursorKey, b); err != nil {
+		return xerrors.Errorf("storing cursor: %w", err)
+	}
+
+	if err := batch.Commit(); err != nil {
+		return xerrors.Errorf("committing changefeed entry: %w", err)
+	}
+
+	f.cur = c
+	if e != nil {
+		close(f.changed)
+		f.changed = make(chan struct{})
+	}
+	return nil
+}
+
+// Subscribe streams the entries after the given sequence number, the ones
+// already recorded first, until the context is cancelled. The channel is
+// closed early when an entry can't be read, e.g. because it was pruned while
+// the subscriber fell behind; resuming from the last received entry then
+// returns the error.
+func (f *Feed) Subscribe(ctx context.Context, after uint64) (<-chan *api.ChangefeedEntry, error) {
+	f.lk.Lock()
+	seq := f.cur.Seq
+	f.lk.Unlock()
+
+	if after > seq {
+		return nil, xerrors.Errorf("entry %d is ahead of the feed, the last entry is %d", after, seq)
+	}
+	if f.retention > 0 && seq > f.retention && after < seq-f.retention {
+		return nil, xerrors.Errorf("entries after %d were pruned, the oldest entry is %d", after, seq-f.retention+1)
+	}
+
+	out := make(chan *api.ChangefeedEntry, 16)
+	go func() {
+		defer close(out)
+
+		for {
+			f.lk.Lock()
+			seq, changed := f.cur.Seq, f.changed
+			f.lk.Unlock()
+
+			for after < seq {
+				e, err := f.get(after + 1)
+				if err != nil {
+					log.Warnf("streaming changefeed: %s", err)
+					return
+				}
+
+				select {
+				case out <- e:
+					after = e.Seq
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// prune removes the entries older than the retention
+func (f *Feed) prune() error {
+	if f.retention == 0 || f.cur.Seq <= f.retention {
+		return nil
+	}
+	oldest := f.cur.Seq - f.retention + 1
+
+	res, err := f.ds.Query(query.Query{Prefix: entryPrefix.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close() //nolint:errcheck
+
+	var pruned int
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+
+		k := datastore.NewKey(r.Key)
+		seq, err := strconv.ParseUint(k.BaseNamespace(), 10, 64)
+		if err != nil {
+			log.Warnf("skipping malformed changefeed key %q", r.Key)
+			continue
+		}
+		if seq >= oldest {
+			continue
+		}
+
+		if err := f.ds.Delete(k); err != nil {
+			return xerrors.Errorf("deleting entry %d: %w", seq, err)
+		}
+		pruned++
+	}
+
+	if pruned > 0 {
+		log.Infow("pruned changefeed entries", "entries", pruned, "oldest", oldest)
+	}
+	return nil
+}
+
+func (f *Feed) get(seq uint64) (*api.ChangefeedEntry, error) {
+	b, err := f.ds.Get(entryKey(seq))
+	if err != nil {
+		return nil, xerrors.Errorf("getting entry %d: %w", seq, err)
+	}
+
+	var e api.ChangefeedEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, xerrors.Errorf("unmarshaling entry %d: %w", seq, err)
+	}
+	return &e, nil
+}
+
+// entryKey zero-pads the sequence number, so that keys sort by it
+func entryKey(seq uint64) datastore.Key {
+	return entryPrefix.ChildString(fmt.Sprintf("%020d", seq))
+}
@@ -0,0 +1,154 @@
+package changefeed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/builtin/power"
+	"github.com/filecoin-project/specs-actors/actors/builtin/verifreg"
+
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func init() {
+	miner.SupportedProofTypes = map[abi.RegisteredSealProof]struct{}{
+		abi.RegisteredSealProof_StackedDrg2KiBV1: {},
+	}
+	power.ConsensusMinerMinPower = big.NewInt(2048)
+	verifreg.MinVerifiedDealSize = big.NewInt(256)
+}
+
+// failingDS fails writes while fail is set
+type failingDS struct {
+	datastore.Batching
+	fail bool
+}
+
+func (d *failingDS) Batch() (datastore.Batch, error) {
+	if d.fail {
+		return nil, xerrors.New("datastore failure")
+	}
+	return d.Batching.Batch()
+}
+
+func testChain(t *testing.T, n int) (*gen.ChainGen, []*types.TipSet) {
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out []*types.TipSet
+	for i := 0; i < n; i++ {
+		ts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, ts.TipSet.TipSet())
+	}
+	return cg, out
+}
+
+func TestFeedStopsAtFailedEntry(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, tipsets := testChain(t, 5)
+
+	ds := &failingDS{Batching: datastore.NewMapDatastore()}
+	f, err := New(cg.ChainStore(), ds, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.cs.CatchUp(ctx, f.follower(), tipsets[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	ds.fail = true
+	if err := f.cs.CatchUp(ctx, f.follower(), tipsets[2]); err == nil {
+		t.Fatal("expected recording to fail")
+	}
+	if f.cur.Seq != 0 || f.cur.TipSet != tipsets[0].Key() {
+		t.Fatalf("expected the cursor not to move past the failed entry, got %+v", f.cur)
+	}
+
+	ds.fail = false
+	if err := f.cs.CatchUp(ctx, f.follower(), tipsets[4]); err != nil {
+		t.Fatal(err)
+	}
+	if f.cur.Seq != 4 {
+		t.Fatalf("expected 4 entries, got %d", f.cur.Seq)
+	}
+	for i := uint64(1); i <= 4; i++ {
+		e, err := f.get(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != EntryApply || e.TipSet != tipsets[i].Key() {
+			t.Fatalf("entry %d: expected %s of %s, got %s of %s", i, EntryApply, tipsets[i].Key(), e.Type, e.TipSet)
+		}
+	}
+
+	// a restarted feed continues from the cursor
+	f, err = New(cg.ChainStore(), ds, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.cur.Seq != 4 || f.cur.TipSet != tipsets[4].Key() {
+		t.Fatalf("unexpected cursor after restart %+v", f.cur)
+	}
+}
+
+func TestFeedLowerRetention(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, tipsets := testChain(t, 5)
+
+	ds := datastore.NewMapDatastore()
+	f, err := New(cg.ChainStore(), ds, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.cs.CatchUp(ctx, f.follower(), tipsets[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.cs.CatchUp(ctx, f.follower(), tipsets[4]); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = New(cg.ChainStore(), ds, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seq := uint64(1); seq <= 4; seq++ {
+		has, err := ds.Has(entryKey(seq))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != (seq > 2) {
+			t.Fatalf("entry %d: expected it to be kept: %t, stored: %t", seq, seq > 2, has)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if _, err := f.Subscribe(ctx, 1); err == nil {
+		t.Fatal("expected subscribing to pruned entries to fail")
+	}
+	sub, err := f.Subscribe(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seq := range []uint64{3, 4} {
+		if e := <-sub; e == nil || e.Seq != seq {
+			t.Fatalf("expected entry %d, got %+v", seq, e)
+		}
+	}
+}
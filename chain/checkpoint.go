@@ -0,0 +1,227 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	dstore "github.com/ipfs/go-datastore"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var checkpointsKey = dstore.NewKey("/chain/checkpoints")
+
+var (
+	ErrCheckpointMismatch  = xerrors.New("chain conflicts with a checkpoint")
+	ErrForkBelowCheckpoint = xerrors.New("fork reorgs the chain below a checkpoint")
+)
+
+// Checkpoints are tipsets trusted to be part of the canonical chain. The
+// syncer refuses chains which don't contain them, which protects nodes
+// syncing from scratch against long-range forks.
+//
+// Checkpoints added through Persist are stored in the datastore, and are
+// loaded again when the node restarts.
+type Checkpoints struct {
+	lk sync.RWMutex
+	ds dstore.Datastore
+
+	cps       map[abi.ChainEpoch]types.TipSetKey
+	persisted map[abi.ChainEpoch]types.TipSetKey
+}
+
+// NewCheckpoints loads the checkpoints persisted in the datastore. Without a
+// datastore checkpoints are only kept in memory.
+func NewCheckpoints(ds dstore.Datastore) (*Checkpoints, error) {
+	c := &Checkpoints{
+		ds:        ds,
+		cps:       map[abi.ChainEpoch]types.TipSetKey{},
+		persisted: map[abi.ChainEpoch]types.TipSetKey{},
+	}
+	if ds == nil {
+		return c, nil
+	}
+
+	b, err := ds.Get(checkpointsKey)
+	switch {
+	case err == dstore.ErrNotFound:
+		return c, nil
+	case err != nil:
+		return nil, xerrors.Errorf("loading checkpoints: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &c.persisted); err != nil {
+		return nil, xerrors.Errorf("decoding checkpoints: %w", err)
+	}
+	for h, tsk := range c.persisted {
+		c.cps[h] = tsk
+	}
+	return c, nil
+}
+
+// ParseCheckpoint parses a checkpoint in the `height:cid[,cid...]` format
+func ParseCheckpoint(s string) (abi.ChainEpoch, types.TipSetKey, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return 0, types.EmptyTSK, xerrors.Errorf("expected height:cid[,cid...], got %q", s)
+	}
+
+	h, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil {
+		return 0, types.EmptyTSK, xerrors.Errorf("parsing checkpoint height: %w", err)
+	}
+
+	var cids []cid.Cid
+	for _, cs := range strings.Split(parts[1], ",") {
+		c, err := cid.Parse(strings.TrimSpace(cs))
+		if err != nil {
+			return 0, types.EmptyTSK, xerrors.Errorf("parsing checkpoint cid: %w", err)
+		}
+		cids = append(cids, c)
+	}
+
+	return abi.ChainEpoch(h), types.NewTipSetKey(cids...), nil
+}
+
+// Add adds a checkpoint for the running node only
+func (c *Checkpoints) Add(h abi.ChainEpoch, tsk types.TipSetKey) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	return c.add(h, tsk)
+}
+
+func (c *Checkpoints) add(h abi.ChainEpoch, tsk types.TipSetKey) error {
+	if tsk.IsEmpty() {
+		return xerrors.Errorf("empty checkpoint at height %d", h)
+	}
+	if cur, ok := c.cps[h]; ok && cur != tsk {
+		return xerrors.Errorf("checkpoint %s at height %d conflicts with checkpoint %s", tsk, h, cur)
+	}
+
+	c.cps[h] = tsk
+	return nil
+}
+
+// Persist adds a checkpoint, and stores it in the datastore
+func (c *Checkpoints) Persist(h abi.ChainEpoch, tsk types.TipSetKey) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := c.add(h, tsk); err != nil {
+		return err
+	}
+	if c.ds == nil {
+		return nil
+	}
+
+	c.persisted[h] = tsk
+	b, err := json.Marshal(c.persisted)
+	if err != nil {
+		return xerrors.Errorf("encoding checkpoints: %w", err)
+	}
+	if err := c.ds.Put(checkpointsKey, b); err != nil {
+		return xerrors.Errorf("storing checkpoints: %w", err)
+	}
+	return nil
+}
+
+// Get returns the checkpoint at the given height
+func (c *Checkpoints) Get(h abi.ChainEpoch) (types.TipSetKey, bool) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	tsk, ok := c.cps[h]
+	return tsk, ok
+}
+
+// Between returns the highest checkpoint height strictly between the given
+// heights
+func (c *Checkpoints) Between(low, high abi.ChainEpoch) (abi.ChainEpoch, bool) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	found := false
+	var out abi.ChainEpoch
+	for h := range c.cps {
+		if h > low && h < high && (!found || h > out) {
+			out, found = h, true
+		}
+	}
+	return out, found
+}
+
+// Conflicts returns whether there is a checkpoint at the height of the tipset,
+// which is another tipset
+func (c *Checkpoints) Conflicts(ts *types.TipSet) bool {
+	tsk, ok := c.Get(ts.Height())
+	return ok && tsk != ts.Key()
+}
+
+// CheckLink checks that the tipset matches the checkpoint at its height, and
+// that no checkpoint is skipped between the tipset and its child at the given
+// height, e.g. by null rounds.
+func (c *Checkpoints) CheckLink(ts *types.TipSet, childHeight abi.ChainEpoch) error {
+	if c.Conflicts(ts) {
+		tsk, _ := c.Get(ts.Height())
+		return xerrors.Errorf("tipset %s at height %d, checkpoint is %s: %w", ts.Key(), ts.Height(), tsk, ErrCheckpointMismatch)
+	}
+	if h, ok := c.Between(ts.Height(), childHeight); ok {
+		return xerrors.Errorf("chain skips the checkpoint at height %d: %w", h, ErrCheckpointMismatch)
+	}
+	return nil
+}
+
+// SyncCheckpoint adds a persisted checkpoint, and switches the node to the
+// chain containing it if the current head conflicts with it. The tipset is
+// fetched from the network if it isn't available locally.
+func (syncer *Syncer) SyncCheckpoint(ctx context.Context, tsk types.TipSetKey) error {
+	if tsk.IsEmpty() {
+		return xerrors.Errorf("empty checkpoint tipset key")
+	}
+
+	ts, err := syncer.store.LoadTipSet(tsk)
+	if err != nil {
+		tss, err := syncer.Bsync.GetBlocks(ctx, tsk, 1)
+		if err != nil {
+			return xerrors.Errorf("fetching checkpoint tipset: %w", err)
+		}
+		ts = tss[0]
+	}
+
+	if err := syncer.checkpoints.Persist(ts.Height(), ts.Key()); err != nil {
+		return xerrors.Errorf("adding checkpoint: %w", err)
+	}
+
+	head := syncer.store.GetHeaviestTipSet()
+	if head.Height() < ts.Height() {
+		// chains synced from here on must contain the checkpoint
+		return nil
+	}
+
+	cur, err := syncer.store.GetTipsetByHeight(ctx, ts.Height(), head, false)
+	if err != nil {
+		return xerrors.Errorf("loading tipset at checkpoint height: %w", err)
+	}
+	if cur.Equals(ts) {
+		return nil
+	}
+
+	log.Warnw("current chain conflicts with the checkpoint, switching to it",
+		"height", ts.Height(), "checkpoint", ts.Cids(), "current", cur.Cids())
+
+	if err := syncer.collectChain(ctx, ts); err != nil {
+		return xerrors.Errorf("syncing checkpoint chain: %w", err)
+	}
+	if err := syncer.store.SetHead(ts); err != nil {
+		return xerrors.Errorf("switching to checkpoint chain: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package chain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+// testCheckpointChain returns n tipsets on top of genTs, with the ticket
+// nonce of the chain, so that chains with different nonces fork
+func testCheckpointChain(n int, nonce uint64) []*types.TipSet {
+	out := []*types.TipSet{genTs}
+	for i := 0; i < n; i++ {
+		out = append(out, mock.TipSet(mock.MkBlock(out[len(out)-1], 1, nonce)))
+	}
+	return out
+}
+
+func TestParseCheckpoint(t *testing.T) {
+	chain := testCheckpointChain(2, 1)
+	ts := chain[2]
+
+	h, tsk, err := ParseCheckpoint(fmt.Sprintf("%d:%s", ts.Height(), ts.Cids()[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != ts.Height() || tsk != ts.Key() {
+		t.Fatalf("expected %d:%s, got %d:%s", ts.Height(), ts.Key(), h, tsk)
+	}
+
+	for _, s := range []string{"", "12", "x:" + ts.Cids()[0].String(), "12:notacid"} {
+		if _, _, err := ParseCheckpoint(s); err == nil {
+			t.Errorf("expected %q not to parse", s)
+		}
+	}
+}
+
+func TestCheckpointsPersist(t *testing.T) {
+	chain := testCheckpointChain(3, 1)
+	ds := datastore.NewMapDatastore()
+
+	cps, err := NewCheckpoints(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cps.Persist(chain[2].Height(), chain[2].Key()); err != nil {
+		t.Fatal(err)
+	}
+	if err := cps.Add(chain[3].Height(), chain[3].Key()); err != nil {
+		t.Fatal(err)
+	}
+
+	other := testCheckpointChain(3, 2)
+	if err := cps.Add(other[2].Height(), other[2].Key()); err == nil {
+		t.Fatal("expected a conflicting checkpoint to be refused")
+	}
+
+	// only persisted checkpoints are loaded again
+	cps, err = NewCheckpoints(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tsk, ok := cps.Get(chain[2].Height()); !ok || tsk != chain[2].Key() {
+		t.Fatal("expected the persisted checkpoint to be loaded")
+	}
+	if _, ok := cps.Get(chain[3].Height()); ok {
+		t.Fatal("expected the checkpoint added for the running node only not to be loaded")
+	}
+}
+
+func TestCheckpointsCheckLink(t *testing.T) {
+	chain := testCheckpointChain(5, 1)
+	fork := testCheckpointChain(5, 2)
+
+	cps, err := NewCheckpoints(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cps.Add(chain[3].Height(), chain[3].Key()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cps.CheckLink(chain[3], chain[4].Height()); err != nil {
+		t.Fatalf("expected the checkpoint chain to pass: %s", err)
+	}
+	if err := cps.CheckLink(chain[2], chain[3].Height()); err != nil {
+		t.Fatalf("expected the link below the checkpoint to pass: %s", err)
+	}
+	if err := cps.CheckLink(fork[3], fork[4].Height()); !xerrors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("expected the fork to conflict with the checkpoint, got %v", err)
+	}
+	// null rounds skipping the checkpoint height
+	if err := cps.CheckLink(fork[2], fork[4].Height()); !xerrors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("expected the chain skipping the checkpoint to conflict with it, got %v", err)
+	}
+
+	if h, ok := cps.Between(chain[1].Height(), chain[5].Height()); !ok || h != chain[3].Height() {
+		t.Fatalf("expected the checkpoint at %d between, got %d (%t)", chain[3].Height(), h, ok)
+	}
+	if _, ok := cps.Between(chain[3].Height(), chain[5].Height()); ok {
+		t.Fatal("expected the bounds to be excluded")
+	}
+}
+
+func TestCheckCheckpointDenylist(t *testing.T) {
+	chain := testCheckpointChain(5, 1)
+	fork := testCheckpointChain(5, 2)
+
+	cps, err := NewCheckpoints(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cps.Add(chain[3].Height(), chain[3].Key()); err != nil {
+		t.Fatal(err)
+	}
+
+	newSyncer := func() *Syncer {
+		return &Syncer{bad: NewBadBlockCache(), checkpoints: cps}
+	}
+	isBad := func(s *Syncer, ts *types.TipSet) bool {
+		_, bad := s.bad.Has(ts.Cids()[0])
+		return bad
+	}
+
+	// conflicts in tipsets we have locally aren't marked bad
+	s := newSyncer()
+	if err := s.checkCheckpoint(fork[5], fork[3], fork[4].Height(), false); err == nil {
+		t.Fatal("expected the conflict to be returned")
+	}
+	if isBad(s, fork[3]) || isBad(s, fork[5]) {
+		t.Fatal("expected local tipsets not to be marked bad")
+	}
+
+	// fetched tipsets conflicting with the checkpoint are, with the incoming
+	// tipset
+	s = newSyncer()
+	if err := s.checkCheckpoint(fork[5], fork[3], fork[4].Height(), true); err == nil {
+		t.Fatal("expected the conflict to be returned")
+	}
+	if !isBad(s, fork[3]) || !isBad(s, fork[5]) {
+		t.Fatal("expected the conflicting chain to be marked bad")
+	}
+
+	// a tipset below a skipped checkpoint isn't at fault
+	s = newSyncer()
+	if err := s.checkCheckpoint(fork[5], fork[2], fork[4].Height(), true); err == nil {
+		t.Fatal("expected the conflict to be returned")
+	}
+	if isBad(s, fork[2]) || !isBad(s, fork[5]) {
+		t.Fatal("expected only the incoming tipset to be marked bad")
+	}
+}
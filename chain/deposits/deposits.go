@@ -0,0 +1,459 @@
+package deposits
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var log = logging.Logger("deposits")
+
+var (
+	cursorKey     = datastore.NewKey("/cursor")
+	depositPrefix = datastore.NewKey("/d")
+	// pendingPrefix indexes the acknowledged deposits which are waiting to be
+	// pruned by their height, so that pruning only visits the ones crossing
+	// finality
+	pendingPrefix = datastore.NewKey("/p")
+)
+
+// Scanner tracks successful transfers to a set of watched addresses. It
+// follows the heaviest chain with a store.Follower, un-doing deposits of
+// reverted tipsets. The follower only moves past tipsets which were scanned,
+// so no deposit is missed across failures and restarts.
+//
+// Deposits stay listed until they are acknowledged, which lets integrations
+// credit each deposit exactly once, after it has enough confirmations.
+type Scanner struct {
+	sm *stmgr.StateManager
+	cs *store.ChainStore
+	ds datastore.Batching
+
+	watch         []address.Address
+	confirmations abi.ChainEpoch
+
+	lk sync.Mutex
+}
+
+func New(sm *stmgr.StateManager, ds datastore.Batching, watch []address.Address, confirmations abi.ChainEpoch) *Scanner {
+	return &Scanner{
+		sm: sm,
+		cs: sm.ChainStore(),
+		ds: ds,
+
+		watch:         watch,
+		confirmations: confirmations,
+	}
+}
+
+// Run follows the chain until the context is cancelled.
+func (s *Scanner) Run(ctx context.Context) {
+	s.cs.Follow(ctx, s.follower())
+}
+
+func (s *Scanner) follower() *store.Follower {
+	return &store.Follower{
+		Name:   "deposit scan",
+		Cursor: s.cursor,
+		Start: func(head *types.TipSet) error {
+			log.Infof("starting deposit scan at height %d", head.Height())
+			return s.setCursor(head)
+		},
+		Apply: s.apply,
+		Revert: func(_ context.Context, ts *types.TipSet) error {
+			return s.revert(ts)
+		},
+	}
+}
+
+// apply records the deposits executed in the parent of ts. Their effects are
+// part of the parent state of ts, so ts is where they are counted from.
+func (s *Scanner) apply(ctx context.Context, ts *types.TipSet) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if ts.Height() == 0 {
+		return s.setCursor(ts)
+	}
+
+	pts, err := s.cs.LoadTipSet(ts.Parents())
+	if err != nil {
+		return xerrors.Errorf("loading parent tipset: %w", err)
+	}
+	msgs, err := s.cs.MessagesForTipset(pts)
+	if err != nil {
+		return xerrors.Errorf("loading parent messages: %w", err)
+	}
+
+	// messages may address the watched actors by either of their addresses
+	match := map[address.Address]address.Address{}
+	for _, a := range s.watch {
+		match[a] = a
+		if ida, err := s.sm.LookupID(ctx, a, ts); err == nil {
+			match[ida] = a
+		}
+	}
+
+	for i, m := range msgs {
+		vmm := m.VMMessage()
+		to, ok := match[vmm.To]
+		if !ok || vmm.Value.Sign() <= 0 {
+			continue
+		}
+
+		rec, err := s.cs.GetParentReceipt(ts.Blocks()[0], i)
+		if err != nil {
+			return xerrors.Errorf("getting receipt of %s: %w", m.Cid(), err)
+		}
+		if rec.ExitCode != 0 {
+			continue
+		}
+
+		d := &api.Deposit{
+			Message: m.Cid(),
+			From:    vmm.From,
+			To:      to,
+			Value:   vmm.Value,
+			TipSet:  ts.Key(),
+			Height:  ts.Height(),
+		}
+
+		// a message re-included after a reorg keeps its acknowledgement
+		prev, err := s.get(m.Cid())
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			d.Acked = prev.Acked
+		}
+
+		if err := s.put(d); err != nil {
+			return err
+		}
+	}
+
+	if err := s.prune(ts.Height()); err != nil {
+		return err
+	}
+
+	return s.setCursor(ts)
+}
+
+// prune removes the acknowledged deposits which are past finality at the
+// given height, they can't change anymore. Must be called with lk held.
+func (s *Scanner) prune(h abi.ChainEpoch) error {
+	final, err := s.finalized(h)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range final {
+		height, mc, err := parsePendingKey(k)
+		if err != nil {
+			return err
+		}
+		d, err := s.get(mc)
+		if err != nil {
+			return err
+		}
+
+		// drop index entries which don't match the deposit anymore
+		if d == nil || !pending(d) || d.Height != height {
+			if err := s.ds.Delete(k); err != nil {
+				return xerrors.Errorf("deleting stale pending deposit %s: %w", k, err)
+			}
+			continue
+		}
+
+		if err := s.delete(d); err != nil {
+			return xerrors.Errorf("deleting finalized deposit %s: %w", mc, err)
+		}
+	}
+	return nil
+}
+
+// finalized returns the pending index keys of the acknowledged deposits which
+// are past finality at the given height. The index is ordered by height, so
+// only the deposits past finality are read.
+func (s *Scanner) finalized(h abi.ChainEpoch) ([]datastore.Key, error) {
+	res, err := s.ds.Query(query.Query{
+		Prefix:   pendingPrefix.String(),
+		Orders:   []query.Order{query.OrderByKey{}},
+		KeysOnly: true,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("querying pending deposits: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []datastore.Key
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("iterating pending deposits: %w", r.Error)
+		}
+
+		k := datastore.NewKey(r.Key)
+		height, _, err := parsePendingKey(k)
+		if err != nil {
+			return nil, err
+		}
+		if h-height <= build.Finality {
+			break
+		}
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+// revert un-does deposits recorded for ts. Deposits which were already
+// acknowledged are kept and flagged, so that integrations can act on them.
+func (s *Scanner) revert(ts *types.TipSet) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	pts, err := s.cs.LoadTipSet(ts.Parents())
+	if err != nil {
+		return xerrors.Errorf("loading parent tipset: %w", err)
+	}
+	msgs, err := s.cs.MessagesForTipset(pts)
+	if err != nil {
+		return xerrors.Errorf("loading parent messages: %w", err)
+	}
+
+	for _, m := range msgs {
+		d, err := s.get(m.Cid())
+		if err != nil {
+			return err
+		}
+		if d == nil || d.TipSet != ts.Key() {
+			continue
+		}
+
+		if !d.Acked {
+			if err := s.delete(d); err != nil {
+				return xerrors.Errorf("deleting deposit %s: %w", d.Message, err)
+			}
+			continue
+		}
+
+		d.Reverted = true
+		if err := s.put(d); err != nil {
+			return err
+		}
+	}
+
+	return s.setCursor(pts)
+}
+
+// List returns the tracked deposits, with confirmations counted against the
+// current head. Acknowledged deposits are only included when requested, until
+// they are past finality.
+func (s *Scanner) List(ctx context.Context, includeAcked bool) ([]api.Deposit, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	head := s.cs.GetHeaviestTipSet()
+
+	res, err := s.ds.Query(query.Query{Prefix: depositPrefix.String()})
+	if err != nil {
+		return nil, xerrors.Errorf("querying deposits: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	out := []api.Deposit{}
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("iterating deposits: %w", r.Error)
+		}
+
+		var d api.Deposit
+		if err := json.Unmarshal(r.Value, &d); err != nil {
+			return nil, xerrors.Errorf("unmarshaling deposit %s: %w", r.Key, err)
+		}
+
+		d.Confirmations = head.Height() - d.Height
+		if d.Reverted {
+			d.Confirmations = 0
+		}
+		d.Confirmed = d.Confirmations >= s.confirmations
+
+		if d.Acked && !includeAcked {
+			continue
+		}
+		out = append(out, d)
+	}
+
+	return out, nil
+}
+
+// Ack marks the deposits made with the given messages as processed.
+func (s *Scanner) Ack(ctx context.Context, msgs []cid.Cid) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	for _, mc := range msgs {
+		d, err := s.get(mc)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			return xerrors.Errorf("no deposit with message %s", mc)
+		}
+
+		d.Acked = true
+		if err := s.put(d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Scanner) get(mc cid.Cid) (*api.Deposit, error) {
+	b, err := s.ds.Get(depositKey(mc))
+	switch {
+	case err == datastore.ErrNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, xerrors.Errorf("getting deposit %s: %w", mc, err)
+	}
+
+	var d api.Deposit
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, xerrors.Errorf("unmarshaling deposit %s: %w", mc, err)
+	}
+	return &d, nil
+}
+
+// put stores the deposit, and keeps the pending index in sync with it
+func (s *Scanner) put(d *api.Deposit) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return xerrors.Errorf("marshaling deposit: %w", err)
+	}
+
+	prev, err := s.get(d.Message)
+	if err != nil {
+		return err
+	}
+
+	batch, err := s.ds.Batch()
+	if err != nil {
+		return err
+	}
+	if prev != nil && pending(prev) && (!pending(d) || prev.Height != d.Height) {
+		if err := batch.Delete(pendingKey(prev)); err != nil {
+			return err
+		}
+	}
+	if pending(d) {
+		if err := batch.Put(pendingKey(d), nil); err != nil {
+			return err
+		}
+	}
+	if err := batch.Put(depositKey(d.Message), b); err != nil {
+		return err
+	}
+
+	if err := batch.Commit(); err != nil {
+		return xerrors.Errorf("storing deposit %s: %w", d.Message, err)
+	}
+	return nil
+}
+
+// delete removes the deposit, and its pending index entry
+func (s *Scanner) delete(d *api.Deposit) error {
+	batch, err := s.ds.Batch()
+	if err != nil {
+		return err
+	}
+	if pending(d) {
+		if err := batch.Delete(pendingKey(d)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Delete(depositKey(d.Message)); err != nil {
+		return err
+	}
+	return batch.Commit()
+}
+
+// cursor returns the key of the last tipset processed, and false when the
+// scan didn't start yet
+func (s *Scanner) cursor() (types.TipSetKey, bool, error) {
+	b, err := s.ds.Get(cursorKey)
+	switch {
+	case err == datastore.ErrNotFound:
+		return types.EmptyTSK, false, nil
+	case err != nil:
+		return types.EmptyTSK, false, err
+	}
+
+	var tsk types.TipSetKey
+	if err := json.Unmarshal(b, &tsk); err != nil {
+		return types.EmptyTSK, false, xerrors.Errorf("unmarshaling cursor: %w", err)
+	}
+	return tsk, true, nil
+}
+
+func (s *Scanner) setCursor(ts *types.TipSet) error {
+	b, err := json.Marshal(ts.Key())
+	if err != nil {
+		return xerrors.Errorf("marshaling cursor: %w", err)
+	}
+
+	if err := s.ds.Put(cursorKey, b); err != nil {
+		return xerrors.Errorf("storing cursor: %w", err)
+	}
+	return nil
+}
+
+func depositKey(mc cid.Cid) datastore.Key {
+	return depositPrefix.ChildString(mc.String())
+}
+
+// pending returns whether the deposit is waiting to be pruned once it's past
+// finality
+func pending(d *api.Deposit) bool {
+	return d.Acked && !d.Reverted
+}
+
+// pendingKey returns the index key of a pending deposit. Heights are zero
+// padded, so that keys sort by height.
+func pendingKey(d *api.Deposit) datastore.Key {
+	return pendingPrefix.ChildString(fmt.Sprintf("%020d", d.Height)).ChildString(d.Message.String())
+}
+
+func parsePendingKey(k datastore.Key) (abi.ChainEpoch, cid.Cid, error) {
+	ns := k.Namespaces()
+	if len(ns) != 3 {
+		return 0, cid.Undef, xerrors.Errorf("malformed pending deposit key %s", k)
+	}
+
+	h, err := strconv.ParseInt(ns[1], 10, 64)
+	if err != nil {
+		return 0, cid.Undef, xerrors.Errorf("parsing height of pending deposit key %s: %w", k, err)
+	}
+	mc, err := cid.Decode(ns[2])
+	if err != nil {
+		return 0, cid.Undef, xerrors.Errorf("parsing message of pending deposit key %s: %w", k, err)
+	}
+	return abi.ChainEpoch(h), mc, nil
+}
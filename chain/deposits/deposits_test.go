@@ -0,0 +1,263 @@
+package deposits
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	mh "github.com/multiformats/go-multihash"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/builtin/power"
+	"github.com/filecoin-project/specs-actors/actors/builtin/verifreg"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func init() {
+	miner.SupportedProofTypes = map[abi.RegisteredSealProof]struct{}{
+		abi.RegisteredSealProof_StackedDrg2KiBV1: {},
+	}
+	power.ConsensusMinerMinPower = big.NewInt(2048)
+	verifreg.MinVerifiedDealSize = big.NewInt(256)
+}
+
+// transfers makes every tipset include a transfer from the banker to the
+// address
+func transfers(to address.Address) func(*gen.ChainGen) ([]*types.SignedMessage, error) {
+	var nonce uint64
+	return func(cg *gen.ChainGen) ([]*types.SignedMessage, error) {
+		msg := types.Message{
+			To:       to,
+			From:     cg.Banker(),
+			Nonce:    nonce,
+			Value:    types.NewInt(100 + nonce),
+			GasLimit: 1000000,
+			GasPrice: types.NewInt(0),
+		}
+
+		sig, err := cg.Wallet().Sign(context.TODO(), cg.Banker(), msg.Cid().Bytes())
+		if err != nil {
+			return nil, err
+		}
+		nonce++
+
+		return []*types.SignedMessage{{Message: msg, Signature: *sig}}, nil
+	}
+}
+
+func TestScanner(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := cg.Wallet().GenerateKey(crypto.SigTypeBLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cg.GetMessages = transfers(to)
+
+	// chain[i] includes msgs[i], which are executed in chain[i+1]
+	chain := []*types.TipSet{cg.CurTipset.TipSet()}
+	msgs := []*types.SignedMessage{nil}
+	for i := 0; i < 4; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, mts.TipSet.TipSet())
+		msgs = append(msgs, mts.Messages[0])
+	}
+
+	// a fork without messages on top of chain[2], which executes msgs[2] again
+	cg.GetMessages = func(*gen.ChainGen) ([]*types.SignedMessage, error) {
+		return nil, nil
+	}
+	fork := append([]*types.TipSet{}, chain[:3]...)
+	for i := 0; i < 2; i++ {
+		mts, err := cg.NextTipSetFromMiners(fork[len(fork)-1], cg.Miners)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fork = append(fork, mts.TipSet.TipSet())
+	}
+
+	cs := cg.ChainStore()
+	s := New(stmgr.NewStateManager(cs), datastore.NewMapDatastore(), []address.Address{to}, 2)
+
+	list := func(head *types.TipSet, includeAcked bool) map[cid.Cid]api.Deposit {
+		t.Helper()
+		if err := cs.SetHead(head); err != nil {
+			t.Fatal(err)
+		}
+		ds, err := s.List(ctx, includeAcked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := map[cid.Cid]api.Deposit{}
+		for _, d := range ds {
+			out[d.Message] = d
+		}
+		return out
+	}
+
+	// the scan starts at the first head it sees
+	if err := cs.CatchUp(ctx, s.follower(), chain[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.CatchUp(ctx, s.follower(), chain[4]); err != nil {
+		t.Fatal(err)
+	}
+
+	ds := list(chain[4], false)
+	if len(ds) != 3 {
+		t.Fatalf("expected the 3 executed transfers to be listed, got %d", len(ds))
+	}
+	for i := 1; i <= 3; i++ {
+		d, ok := ds[msgs[i].Cid()]
+		if !ok {
+			t.Fatalf("deposit %d not listed", i)
+		}
+		if d.To != to || !d.Value.Equals(msgs[i].Message.Value) || d.TipSet != chain[i+1].Key() {
+			t.Fatalf("unexpected deposit %d: %+v", i, d)
+		}
+
+		// the threshold is 2 confirmations
+		confirmations := chain[4].Height() - chain[i+1].Height()
+		if d.Confirmations != confirmations || d.Confirmed != (confirmations >= 2) {
+			t.Fatalf("deposit %d: expected %d confirmations, got %d (confirmed: %t)", i, confirmations, d.Confirmations, d.Confirmed)
+		}
+	}
+	if !ds[msgs[1].Cid()].Confirmed || ds[msgs[3].Cid()].Confirmed {
+		t.Fatal("expected only the deeper deposits to be confirmed")
+	}
+
+	// acknowledged deposits are only listed when requested
+	if err := s.Ack(ctx, []cid.Cid{msgs[2].Cid(), msgs[3].Cid()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ack(ctx, []cid.Cid{msgs[4].Cid()}); err == nil {
+		t.Fatal("expected acknowledging a message without deposit to fail")
+	}
+	if ds := list(chain[4], false); len(ds) != 1 {
+		t.Fatalf("expected one deposit to be listed, got %d", len(ds))
+	}
+	if ds := list(chain[4], true); len(ds) != 3 || !ds[msgs[2].Cid()].Acked {
+		t.Fatalf("expected the acknowledged deposits to be listed, got %+v", ds)
+	}
+
+	// switching to the fork reverts chain[4] and chain[3]: msgs[3] isn't
+	// executed anymore, msgs[2] is executed again in fork[3]
+	if err := cs.CatchUp(ctx, s.follower(), fork[4]); err != nil {
+		t.Fatal(err)
+	}
+	ds = list(fork[4], true)
+	if len(ds) != 3 {
+		t.Fatalf("expected 3 deposits after the reorg, got %d", len(ds))
+	}
+	if d := ds[msgs[2].Cid()]; !d.Acked || d.Reverted || d.TipSet != fork[3].Key() {
+		t.Fatalf("expected the re-executed deposit to keep its acknowledgement, got %+v", d)
+	}
+	if d := ds[msgs[3].Cid()]; !d.Acked || !d.Reverted || d.Confirmations != 0 || d.Confirmed {
+		t.Fatalf("expected the acknowledged deposit to be flagged reverted, got %+v", d)
+	}
+
+	// reverting unacknowledged deposits removes them
+	if err := s.revert(chain[2]); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := s.get(msgs[1].Cid()); err != nil || d != nil {
+		t.Fatalf("expected the reverted deposit to be removed, got %+v (%v)", d, err)
+	}
+
+	// acknowledged deposits are removed once they are past finality, unless
+	// they were reverted
+	h := fork[3].Height() + build.Finality + 1
+	if err := s.prune(h); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := s.get(msgs[2].Cid()); err != nil || d != nil {
+		t.Fatalf("expected the finalized deposit to be pruned, got %+v (%v)", d, err)
+	}
+	if d, err := s.get(msgs[3].Cid()); err != nil || d == nil {
+		t.Fatalf("expected the reverted deposit to be kept (%v)", err)
+	}
+}
+
+func TestPendingIndex(t *testing.T) {
+	s := &Scanner{ds: datastore.NewMapDatastore()}
+
+	deposit := func(i int, h abi.ChainEpoch) *api.Deposit {
+		t.Helper()
+		hash, err := mh.Sum([]byte{byte(i)}, mh.SHA2_256, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &api.Deposit{Message: cid.NewCidV1(cid.Raw, hash), Height: h, Acked: true}
+	}
+	expect := func(h abi.ChainEpoch, ds ...*api.Deposit) {
+		t.Helper()
+		final, err := s.finalized(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(final) != len(ds) {
+			t.Fatalf("expected %d deposits past finality at %d, got %v", len(ds), h, final)
+		}
+		for i, d := range ds {
+			if final[i] != pendingKey(d) {
+				t.Fatalf("expected deposit %s at %d, got %s", d.Message, i, final[i])
+			}
+		}
+	}
+
+	// heights sort numerically
+	d9, d10, d100 := deposit(1, 9), deposit(2, 10), deposit(3, 100)
+	unacked := deposit(4, 5)
+	unacked.Acked = false
+	for _, d := range []*api.Deposit{d100, d10, d9, unacked} {
+		if err := s.put(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect(10 + build.Finality)
+	expect(11+build.Finality, d9, d10)
+	expect(101+build.Finality, d9, d10, d100)
+
+	// a deposit executed again at another height moves in the index, reverted
+	// deposits are kept
+	d10.Height = 50
+	d9.Reverted = true
+	for _, d := range []*api.Deposit{d10, d9} {
+		if err := s.put(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect(11 + build.Finality)
+	expect(51+build.Finality, d10)
+
+	if err := s.prune(51 + build.Finality); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := s.get(d10.Message); err != nil || d != nil {
+		t.Fatalf("expected the finalized deposit to be pruned, got %+v (%v)", d, err)
+	}
+	for _, d := range []*api.Deposit{d9, d100, unacked} {
+		if got, err := s.get(d.Message); err != nil || got == nil {
+			t.Fatalf("expected the deposit at %d to be kept (%v)", d.Height, err)
+		}
+	}
+	expect(101+build.Finality, d100)
+}
@@ -91,6 +91,7 @@ type hcEvents struct {
 
 	messageEvents
 	watcherEvents
+	filterEvents
 }
 
 func newHCEvents(ctx context.Context, cs eventAPI, tsc *tipSetCache, gcConfidence uint64) *hcEvents {
@@ -108,6 +109,7 @@ func newHCEvents(ctx context.Context, cs eventAPI, tsc *tipSetCache, gcConfidenc
 
 	e.messageEvents = newMessageEvents(ctx, &e, cs)
 	e.watcherEvents = newWatcherEvents(ctx, &e, cs)
+	e.filterEvents = newFilterEvents(ctx, &e, cs)
 
 	return &e
 }
@@ -146,6 +148,16 @@ func (e *hcEvents) processHeadChangeEvent(rev, app []*types.TipSet) error {
 			e.queueForConfidence(tid, data, nil, ts)
 		}
 
+		// Check if the head change executed any messages matching filters
+		execs, err := e.filterEvents.checkExecutions(ts)
+		if err != nil {
+			return err
+		}
+
+		for tid, data := range execs {
+			e.queueForConfidence(tid, data, nil, ts)
+		}
+
 		for at := e.lastTs.Height(); at <= ts.Height(); at++ {
 			// Apply any queued events and timeouts that were targeted at the
 			// current chain height
@@ -341,10 +353,27 @@ func (e *hcEvents) onHeadChanged(check CheckFunc, hnd EventHandler, rev RevertHa
 	return id, nil
 }
 
+// Stop calling the handlers of a trigger, including its revert handler
+func (e *hcEvents) disable(id triggerID) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	trigger, ok := e.triggers[id]
+	if !ok {
+		return
+	}
+
+	trigger.disabled = true
+	trigger.revert = func(context.Context, *types.TipSet) error {
+		return nil
+	}
+}
+
 // headChangeAPI is used to allow the composed event APIs to call back to hcEvents
 // to listen for changes
 type headChangeAPI interface {
 	onHeadChanged(check CheckFunc, hnd EventHandler, rev RevertHandler, confidence int, timeout abi.ChainEpoch) (triggerID, error)
+	disable(id triggerID)
 }
 
 // watcherEvents watches for a state change
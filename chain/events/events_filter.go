@@ -0,0 +1,141 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// MsgExecution is a message executed on chain, with its receipt
+type MsgExecution struct {
+	Cid     cid.Cid
+	Msg     *types.Message
+	Receipt *types.MessageReceipt
+}
+
+// ExecutionsHandler arguments:
+// `execs` are the matched executions, in execution order
+// `ts` is the tipset the messages were executed in, holding their receipts
+// `curH`-`ts.Height` = `confidence`
+type ExecutionsHandler func(execs []MsgExecution, ts *types.TipSet, curH abi.ChainEpoch) (more bool, err error)
+
+type ExecMatchFunc func(msg *types.Message, rec *types.MessageReceipt) bool
+
+// filterEvents watches for message executions matching filters. Unlike Called
+// handlers, which get one message per tipset, executions handlers get all the
+// executions of a tipset that match.
+type filterEvents struct {
+	ctx   context.Context
+	cs    eventAPI
+	hcAPI headChangeAPI
+
+	lk       sync.RWMutex
+	matchers map[triggerID]ExecMatchFunc
+}
+
+func newFilterEvents(ctx context.Context, hcAPI headChangeAPI, cs eventAPI) filterEvents {
+	return filterEvents{
+		ctx:      ctx,
+		cs:       cs,
+		hcAPI:    hcAPI,
+		matchers: map[triggerID]ExecMatchFunc{},
+	}
+}
+
+// Match the messages executed in the tipset against the filters
+func (fe *filterEvents) checkExecutions(ts *types.TipSet) (map[triggerID]eventData, error) {
+	fe.lk.RLock()
+	defer fe.lk.RUnlock()
+
+	if len(fe.matchers) == 0 {
+		return nil, nil
+	}
+
+	msgs, err := fe.cs.ChainGetParentMessages(fe.ctx, ts.Blocks()[0].Cid())
+	if err != nil {
+		return nil, xerrors.Errorf("getting parent messages: %w", err)
+	}
+	recs, err := fe.cs.ChainGetParentReceipts(fe.ctx, ts.Blocks()[0].Cid())
+	if err != nil {
+		return nil, xerrors.Errorf("getting parent receipts: %w", err)
+	}
+	if len(msgs) != len(recs) {
+		return nil, xerrors.Errorf("got %d parent messages but %d receipts", len(msgs), len(recs))
+	}
+
+	res := make(map[triggerID]eventData)
+	for tid, match := range fe.matchers {
+		var execs []MsgExecution
+		for i, m := range msgs {
+			if match(m.Message, recs[i]) {
+				execs = append(execs, MsgExecution{
+					Cid:     m.Cid,
+					Msg:     m.Message,
+					Receipt: recs[i],
+				})
+			}
+		}
+
+		if len(execs) > 0 {
+			res[tid] = execs
+		}
+	}
+
+	return res, nil
+}
+
+// Executed registers a callback which is triggered with the executions of
+// each tipset matching the filter, once they reach the confidence. It returns
+// an ID which Unsubscribe takes to stop the notifications.
+//
+// * `ExecutionsHandler` is called with the matched executions of a tipset, in
+//    the order they were executed in. It returns whether further notifications
+//    should be sent.
+//
+// * `RevertHandler` is called after the executions handler, when the tipset
+//    the messages were executed in is dropped. The messages may be executed
+//    again in a different tipset in small amount of time.
+//
+// * `ExecMatchFunc` is called against each message executed, with its
+//    receipt.
+func (fe *filterEvents) Executed(hnd ExecutionsHandler, rev RevertHandler, confidence int, mf ExecMatchFunc) (uint64, error) {
+	h := func(data eventData, prevTs, ts *types.TipSet, height abi.ChainEpoch) (bool, error) {
+		execs, ok := data.([]MsgExecution)
+		if !ok {
+			panic("expected executions")
+		}
+
+		return hnd(execs, ts, height)
+	}
+
+	check := func(ts *types.TipSet) (done bool, more bool, err error) {
+		// only executions after the subscription are of interest
+		return true, true, nil
+	}
+
+	id, err := fe.hcAPI.onHeadChanged(check, h, rev, confidence, NoTimeout)
+	if err != nil {
+		return 0, err
+	}
+
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.matchers[id] = mf
+
+	return id, nil
+}
+
+// Unsubscribe stops the notifications of an Executed subscription, including
+// the reverts of the executions it was notified of.
+func (fe *filterEvents) Unsubscribe(id uint64) {
+	fe.lk.Lock()
+	delete(fe.matchers, id)
+	fe.lk.Unlock()
+
+	fe.hcAPI.disable(id)
+}
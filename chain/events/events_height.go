@@ -41,13 +41,18 @@ func (e *heightEvents) headChangeAt(rev, app []*types.TipSet) error {
 
 		revert := func(h abi.ChainEpoch, ts *types.TipSet) {
 			for _, tid := range e.htHeights[h] {
+				hnd, ok := e.heightTriggers[tid]
+				if !ok {
+					continue // canceled
+				}
+
 				ctx, span := trace.StartSpan(ctx, "events.HeightRevert")
 
-				rev := e.heightTriggers[tid].revert
+				rev := hnd.revert
 				e.lk.Unlock()
 				err := rev(ctx, ts)
 				e.lk.Lock()
-				e.heightTriggers[tid].called = false
+				hnd.called = false
 
 				span.End()
 
@@ -89,7 +94,10 @@ func (e *heightEvents) headChangeAt(rev, app []*types.TipSet) error {
 
 		apply := func(h abi.ChainEpoch, ts *types.TipSet) error {
 			for _, tid := range e.htTriggerHeights[h] {
-				hnd := e.heightTriggers[tid]
+				hnd, ok := e.heightTriggers[tid]
+				if !ok {
+					continue // canceled
+				}
 				if hnd.called {
 					return nil
 				}
@@ -149,6 +157,42 @@ func (e *heightEvents) headChangeAt(rev, app []*types.TipSet) error {
 //
 // ts passed to handlers is the tipset at the specified, or above, if lower tipsets were null
 func (e *heightEvents) ChainAt(hnd HeightHandler, rev RevertHandler, confidence int, h abi.ChainEpoch) error {
+	_, err := e.chainAt(hnd, rev, confidence, h)
+	return err
+}
+
+// ChainAtCancelable is like ChainAt, but returns a function which removes the
+// handlers. Handlers already running when it's called may still complete.
+func (e *heightEvents) ChainAtCancelable(hnd HeightHandler, rev RevertHandler, confidence int, h abi.ChainEpoch) (cancel func(), err error) {
+	id, err := e.chainAt(hnd, rev, confidence, h)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		e.lk.Lock()
+		defer e.lk.Unlock()
+
+		delete(e.heightTriggers, id)
+		e.htHeights[h] = removeTrigger(e.htHeights[h], id)
+		e.htTriggerHeights[h+abi.ChainEpoch(confidence)] = removeTrigger(e.htTriggerHeights[h+abi.ChainEpoch(confidence)], id)
+	}, nil
+}
+
+func removeTrigger(ids []triggerID, id triggerID) []triggerID {
+	out := make([]triggerID, 0, len(ids))
+	for _, tid := range ids {
+		if tid != id {
+			out = append(out, tid)
+		}
+	}
+	return out
+}
+
+// chainAt registers the handlers, returning the ID of the trigger. When the
+// chain is already past the height by more than gcConfidence, nothing is
+// registered, and the ID isn't used by any trigger.
+func (e *heightEvents) chainAt(hnd HeightHandler, rev RevertHandler, confidence int, h abi.ChainEpoch) (triggerID, error) {
 
 	e.lk.Lock() // Tricky locking, check your locks if you modify this function!
 
@@ -168,7 +212,7 @@ func (e *heightEvents) ChainAt(hnd HeightHandler, rev RevertHandler, confidence
 		span.End()
 
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		e.lk.Lock()
@@ -177,15 +221,15 @@ func (e *heightEvents) ChainAt(hnd HeightHandler, rev RevertHandler, confidence
 
 	defer e.lk.Unlock()
 
+	id := e.ctr
+	e.ctr++
+
 	if bestH >= h+abi.ChainEpoch(confidence)+e.gcConfidence {
-		return nil
+		return id, nil
 	}
 
 	triggerAt := h + abi.ChainEpoch(confidence)
 
-	id := e.ctr
-	e.ctr++
-
 	e.heightTriggers[id] = &heightHandler{
 		confidence: confidence,
 
@@ -196,5 +240,5 @@ func (e *heightEvents) ChainAt(hnd HeightHandler, rev RevertHandler, confidence
 	e.htHeights[h] = append(e.htHeights[h], id)
 	e.htTriggerHeights[triggerAt] = append(e.htTriggerHeights[triggerAt], id)
 
-	return nil
+	return id, nil
 }
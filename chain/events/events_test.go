@@ -148,6 +148,52 @@ func (fcs *fakeCS) ChainGetBlockMessages(ctx context.Context, blk cid.Cid) (*api
 
 }
 
+func (fcs *fakeCS) ChainGetParentMessages(ctx context.Context, blk cid.Cid) ([]api.Message, error) {
+	var pts *types.TipSet
+	for _, ts := range fcs.tipsets {
+		for _, b := range ts.Blocks() {
+			if b.Cid() == blk {
+				pts = fcs.tipsets[ts.Parents()]
+			}
+		}
+	}
+	if pts == nil {
+		return nil, nil
+	}
+
+	seen := map[cid.Cid]struct{}{}
+	var out []api.Message
+	for _, b := range pts.Blocks() {
+		msgs, err := fcs.ChainGetBlockMessages(ctx, b.Cid())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range msgs.BlsMessages {
+			if _, ok := seen[m.Cid()]; ok {
+				continue
+			}
+			seen[m.Cid()] = struct{}{}
+			out = append(out, api.Message{Cid: m.Cid(), Message: m})
+		}
+	}
+
+	return out, nil
+}
+
+func (fcs *fakeCS) ChainGetParentReceipts(ctx context.Context, blk cid.Cid) ([]*types.MessageReceipt, error) {
+	msgs, err := fcs.ChainGetParentMessages(ctx, blk)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*types.MessageReceipt, len(msgs))
+	for i := range msgs {
+		out[i] = &types.MessageReceipt{}
+	}
+	return out, nil
+}
+
 func (fcs *fakeCS) fakeMsgs(m fakeMsg) cid.Cid {
 	n := len(fcs.msgs)
 	c, err := cid.Prefix{
@@ -327,6 +373,40 @@ func TestAtDoubleTrigger(t *testing.T) {
 	require.True(t, reverted)
 }
 
+func TestAtCancel(t *testing.T) {
+	fcs := &fakeCS{
+		t:   t,
+		h:   1,
+		tsc: newTSCache(2*build.ForkLengthThreshold, nil),
+	}
+	require.NoError(t, fcs.tsc.add(fcs.makeTs(t, nil, 1, dummyCid)))
+
+	events := NewEvents(context.Background(), fcs)
+
+	var applied bool
+	var reverted bool
+
+	cancel, err := events.ChainAtCancelable(func(_ context.Context, ts *types.TipSet, curH abi.ChainEpoch) error {
+		applied = true
+		return nil
+	}, func(_ context.Context, ts *types.TipSet) error {
+		reverted = true
+		return nil
+	}, 3, 5)
+	require.NoError(t, err)
+
+	fcs.advance(0, 7, nil)
+	require.True(t, applied)
+	require.False(t, reverted)
+	applied = false
+
+	cancel()
+
+	fcs.advance(4, 4, nil)
+	require.False(t, applied)
+	require.False(t, reverted)
+}
+
 func TestAtNullTrigger(t *testing.T) {
 	fcs := &fakeCS{
 		t:   t,
@@ -1312,3 +1392,81 @@ func TestStateChangedTimeout(t *testing.T) {
 	fcs.advance(0, 5, nil)
 	require.False(t, called)
 }
+
+func TestExecuted(t *testing.T) {
+	fcs := &fakeCS{
+		t: t,
+		h: 1,
+
+		msgs:    map[cid.Cid]fakeMsg{},
+		blkMsgs: map[cid.Cid]cid.Cid{},
+		tsc:     newTSCache(2*build.ForkLengthThreshold, nil),
+	}
+	require.NoError(t, fcs.tsc.add(fcs.makeTs(t, nil, 1, dummyCid)))
+
+	events := NewEvents(context.Background(), fcs)
+
+	t0123, err := address.NewFromString("t0123")
+	require.NoError(t, err)
+
+	var applied []MsgExecution
+	var appliedTs *types.TipSet
+	var reverted bool
+
+	id, err := events.Executed(func(execs []MsgExecution, ts *types.TipSet, curH abi.ChainEpoch) (bool, error) {
+		applied = append(applied, execs...)
+		appliedTs = ts
+		return true, nil
+	}, func(_ context.Context, ts *types.TipSet) error {
+		reverted = true
+		return nil
+	}, 3, func(msg *types.Message, rec *types.MessageReceipt) bool {
+		return msg.To == t0123 && msg.Method == 5
+	})
+	require.NoError(t, err)
+
+	fcs.advance(0, 4, nil) // H=5
+	require.Empty(t, applied)
+
+	// all the matching messages of the tipset are delivered at once
+	fcs.advance(0, 3, map[int]cid.Cid{ // msgs at H=6, executed at H=7
+		0: fcs.fakeMsgs(fakeMsg{
+			bmsgs: []*types.Message{
+				{To: t0123, From: t0123, Method: 5, Nonce: 1},
+				{To: t0123, From: t0123, Method: 6, Nonce: 2},
+				{To: t0123, From: t0123, Method: 5, Nonce: 3},
+			},
+		}),
+	})
+	require.Empty(t, applied)
+
+	fcs.advance(0, 1, nil) // H=10 (confidence=3, apply)
+	require.Len(t, applied, 2)
+	require.Equal(t, uint64(1), applied[0].Msg.Nonce)
+	require.Equal(t, uint64(3), applied[1].Msg.Nonce)
+	require.NotNil(t, applied[0].Receipt)
+	require.Equal(t, abi.ChainEpoch(7), appliedTs.Height())
+	require.False(t, reverted)
+
+	// revert the execution
+	fcs.advance(4, 1, nil) // H=7
+	require.True(t, reverted)
+	applied = nil
+	reverted = false
+
+	// nothing is delivered after unsubscribing
+	events.Unsubscribe(id)
+
+	fcs.advance(0, 1, map[int]cid.Cid{ // msg at H=8
+		0: fcs.fakeMsgs(fakeMsg{
+			bmsgs: []*types.Message{
+				{To: t0123, From: t0123, Method: 5, Nonce: 4},
+			},
+		}),
+	})
+	fcs.advance(0, 5, nil) // H=13
+	require.Empty(t, applied)
+
+	fcs.advance(5, 1, nil)
+	require.False(t, reverted)
+}
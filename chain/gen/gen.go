@@ -171,7 +171,7 @@ func NewGeneratorWithSectors(numSectors int) (*ChainGen, error) {
 		return nil, err
 	}
 
-	sys := vm.Syscalls(&genFakeVerifier{})
+	sys := vm.DefaultSyscalls(&genFakeVerifier{})
 
 	tpl := genesis.Template{
 		Accounts: []genesis.Actor{
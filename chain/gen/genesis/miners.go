@@ -20,7 +20,6 @@ import (
 	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
 	"github.com/filecoin-project/specs-actors/actors/builtin/power"
 	"github.com/filecoin-project/specs-actors/actors/crypto"
-	"github.com/filecoin-project/specs-actors/actors/runtime"
 
 	"github.com/filecoin-project/lotus/chain/state"
 	"github.com/filecoin-project/lotus/chain/store"
@@ -38,16 +37,17 @@ func MinerAddress(genesisIndex uint64) address.Address {
 	return maddr
 }
 
-type fakedSigSyscalls struct {
-	runtime.Syscalls
-}
-
-func (fss *fakedSigSyscalls) VerifySignature(signature crypto.Signature, signer address.Address, plaintext []byte) error {
-	return nil
+// fakedSigSyscalls accepts all signatures, genesis messages aren't signed
+func fakedSigSyscalls(sys vm.Syscalls) vm.Syscalls {
+	return vm.StubSyscalls(sys, vm.SyscallStubs{
+		VerifySignature: func(crypto.Signature, address.Address, []byte) error {
+			return nil
+		},
+	})
 }
 
 func SetupStorageMiners(ctx context.Context, cs *store.ChainStore, sroot cid.Cid, miners []genesis.Miner) (cid.Cid, error) {
-	vm, err := vm.NewVM(sroot, 0, &fakeRand{}, cs.Blockstore(), &fakedSigSyscalls{cs.VMSys()})
+	vm, err := vm.NewVM(sroot, 0, &fakeRand{}, cs.Blockstore(), fakedSigSyscalls(cs.VMSys()))
 	if err != nil {
 		return cid.Undef, xerrors.Errorf("failed to create NewVM: %w", err)
 	}
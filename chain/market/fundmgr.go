@@ -73,7 +73,7 @@ func (fm *FundMgr) EnsureAvailable(ctx context.Context, addr, wallet address.Add
 		GasLimit: 1000000,
 		Method:   builtin.MethodsMarket.AddBalance,
 		Params:   params,
-	})
+	}, nil)
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -0,0 +1,194 @@
+package messagepool
+
+import (
+	"context"
+	"sort"
+
+	"github.com/filecoin-project/go-address"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+const MinGasPrice = 0
+
+// GasPriceLookbackFactor is how many tipsets are looked back per epoch of the
+// requested inclusion window when estimating gas prices
+var GasPriceLookbackFactor uint64 = 2
+
+// MaxGasPriceLookback limits the number of tipsets gas prices are estimated
+// from
+var MaxGasPriceLookback uint64 = 200
+
+type gasPriceSample struct {
+	price    types.BigInt
+	gasLimit int64
+}
+
+// EstimateGasPrice estimates the gas price a message of the sender using
+// gaslimit gas should pay to be included within nblocksincl epochs, from the
+// messages included in the tipsets before tsk, the current head if empty.
+//
+// It looks back GasPriceLookbackFactor times as many tipsets as the inclusion
+// window, and returns a price just above the one at which the messages paying
+// more, the message itself and the pending messages of the sender fill half
+// of the block space of these tipsets: had the same messages competed for the
+// block space, the message would have been included within the window. When
+// the blocks had space left, MinGasPrice is enough.
+func (mp *MessagePool) EstimateGasPrice(ctx context.Context, nblocksincl uint64, sender address.Address, gaslimit int64, tsk types.TipSetKey) (types.BigInt, error) {
+	if nblocksincl == 0 {
+		nblocksincl = 1
+	}
+
+	lookback := nblocksincl * GasPriceLookbackFactor
+	if lookback > MaxGasPriceLookback {
+		lookback = MaxGasPriceLookback
+	}
+
+	samples, blocks, err := mp.gasPriceSamples(tsk, lookback)
+	if err != nil {
+		return types.EmptyInt, err
+	}
+
+	pendingGas, err := mp.pendingGas(ctx, sender)
+	if err != nil {
+		return types.EmptyInt, err
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return types.BigCmp(samples[i].price, samples[j].price) > 0
+	})
+
+	at := build.BlockGasLimit*int64(blocks)/2 - gaslimit - pendingGas
+	for _, s := range samples {
+		at -= s.gasLimit
+		if at < 0 {
+			return types.BigAdd(s.price, types.NewInt(1)), nil
+		}
+	}
+
+	return types.NewInt(MinGasPrice), nil
+}
+
+// GasPricePercentiles returns the given percentiles, between 0 and 100, of the
+// gas prices of the messages included in the lookback tipsets up to tsk, the
+// current head if empty. Prices are weighted by the gas limit of the messages,
+// so the median is the price half of the used block space was bought at.
+func (mp *MessagePool) GasPricePercentiles(lookback uint64, percentiles []float64, tsk types.TipSetKey) ([]types.BigInt, error) {
+	for _, p := range percentiles {
+		if p < 0 || p > 100 {
+			return nil, xerrors.Errorf("percentile %f is not between 0 and 100", p)
+		}
+	}
+
+	if lookback > MaxGasPriceLookback {
+		lookback = MaxGasPriceLookback
+	}
+
+	samples, _, err := mp.gasPriceSamples(tsk, lookback)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return types.BigCmp(samples[i].price, samples[j].price) < 0
+	})
+
+	var total int64
+	for _, s := range samples {
+		total += s.gasLimit
+	}
+
+	out := make([]types.BigInt, len(percentiles))
+	for i, p := range percentiles {
+		out[i] = types.NewInt(MinGasPrice)
+
+		target := int64(p / 100 * float64(total))
+		var acc int64
+		for _, s := range samples {
+			out[i] = s.price
+			acc += s.gasLimit
+			if acc >= target {
+				break
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// gasPriceSamples returns the gas prices and limits of the messages included
+// in the lookback tipsets up to tsk, and the number of blocks of these tipsets
+func (mp *MessagePool) gasPriceSamples(tsk types.TipSetKey, lookback uint64) ([]gasPriceSample, int, error) {
+	var ts *types.TipSet
+	if tsk.IsEmpty() {
+		mp.curTsLk.Lock()
+		ts = mp.curTs
+		mp.curTsLk.Unlock()
+	} else {
+		var err error
+		ts, err = mp.api.LoadTipSet(tsk)
+		if err != nil {
+			return nil, 0, xerrors.Errorf("loading tipset %s: %w", tsk, err)
+		}
+	}
+
+	var samples []gasPriceSample
+	var blocks int
+	for i := uint64(0); ts != nil && i < lookback; i++ {
+		msgs, err := mp.api.MessagesForTipset(ts)
+		if err != nil {
+			return nil, 0, xerrors.Errorf("loading messages of tipset %s: %w", ts.Key(), err)
+		}
+
+		for _, m := range msgs {
+			vm := m.VMMessage()
+			samples = append(samples, gasPriceSample{
+				price:    vm.GasPrice,
+				gasLimit: vm.GasLimit,
+			})
+		}
+		blocks += len(ts.Blocks())
+
+		if i+1 == lookback || ts.Height() == 0 || len(ts.Parents().Cids()) == 0 {
+			break
+		}
+
+		ts, err = mp.api.LoadTipSet(ts.Parents())
+		if err != nil {
+			return nil, 0, xerrors.Errorf("loading parent tipset: %w", err)
+		}
+	}
+
+	return samples, blocks, nil
+}
+
+// pendingGas returns the gas limit of the pending messages of the sender, which
+// have lower nonces than a new message, so they are included before it
+func (mp *MessagePool) pendingGas(ctx context.Context, sender address.Address) (int64, error) {
+	if sender == address.Undef {
+		return 0, nil
+	}
+
+	if sender.Protocol() == address.ID {
+		mp.curTsLk.Lock()
+		var err error
+		sender, err = mp.api.StateAccountKey(ctx, sender, mp.curTs)
+		mp.curTsLk.Unlock()
+		if err != nil {
+			return 0, xerrors.Errorf("resolving sender key: %w", err)
+		}
+	}
+
+	mp.lk.Lock()
+	defer mp.lk.Unlock()
+
+	var gas int64
+	if mset, ok := mp.pending[sender]; ok {
+		for _, m := range mset.msgs {
+			gas += m.Message.GasLimit
+		}
+	}
+	return gas, nil
+}
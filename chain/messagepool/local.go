@@ -0,0 +1,116 @@
+package messagepool
+
+import (
+	"bytes"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// LocalMessages returns the persisted local messages, which are added back to
+// the pool after a restart, with their status:
+// * pending: the message is in the pool
+// * stale: its nonce was used on chain, or by another pending message
+// * rejected: it couldn't be added back to the pool, Error tells why if it was
+//   rejected when it was loaded
+func (mp *MessagePool) LocalMessages() ([]api.LocalMessage, error) {
+	mp.curTsLk.Lock()
+	defer mp.curTsLk.Unlock()
+
+	msgs, err := mp.localMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	mp.lk.Lock()
+	defer mp.lk.Unlock()
+
+	stateNonces := map[address.Address]uint64{}
+	out := make([]api.LocalMessage, len(msgs))
+	for i, sm := range msgs {
+		out[i] = api.LocalMessage{
+			Cid:     sm.Cid(),
+			Message: sm,
+			Status:  api.LocalRejected,
+			Error:   mp.localErrs[sm.Cid()],
+		}
+
+		if mset, ok := mp.pending[sm.Message.From]; ok {
+			if pm, ok := mset.msgs[sm.Message.Nonce]; ok {
+				out[i].Status = api.LocalStale
+				if pm.Cid() == sm.Cid() {
+					out[i].Status = api.LocalPending
+				}
+				continue
+			}
+		}
+
+		snonce, ok := stateNonces[sm.Message.From]
+		if !ok {
+			snonce, err = mp.getStateNonce(sm.Message.From, mp.curTs)
+			if err != nil {
+				return nil, xerrors.Errorf("getting state nonce of %s: %w", sm.Message.From, err)
+			}
+			stateNonces[sm.Message.From] = snonce
+		}
+		if sm.Message.Nonce < snonce {
+			out[i].Status = api.LocalStale
+		}
+	}
+
+	return out, nil
+}
+
+// PurgeLocal removes the persisted local messages which aren't pending, so
+// that they aren't loaded again, returning the number of removed messages.
+func (mp *MessagePool) PurgeLocal() (int, error) {
+	msgs, err := mp.LocalMessages()
+	if err != nil {
+		return 0, err
+	}
+
+	mp.lk.Lock()
+	defer mp.lk.Unlock()
+
+	var purged int
+	for _, m := range msgs {
+		if m.Status == api.LocalPending {
+			continue
+		}
+
+		if err := mp.localMsgs.Delete(datastore.NewKey(string(m.Cid.Bytes()))); err != nil && err != datastore.ErrNotFound {
+			return purged, xerrors.Errorf("removing local message %s: %w", m.Cid, err)
+		}
+		delete(mp.localErrs, m.Cid)
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (mp *MessagePool) localMessages() ([]*types.SignedMessage, error) {
+	res, err := mp.localMsgs.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("query local messages: %w", err)
+	}
+
+	var out []*types.SignedMessage
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("r.Error: %w", r.Error)
+		}
+
+		var sm types.SignedMessage
+		if err := sm.UnmarshalCBOR(bytes.NewReader(r.Value)); err != nil {
+			return nil, xerrors.Errorf("unmarshaling local message: %w", err)
+		}
+		out = append(out, &sm)
+	}
+
+	return out, nil
+}
@@ -3,6 +3,8 @@ package messagepool
 import (
 	"bytes"
 	"context"
+	"encoding/base32"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
@@ -19,7 +21,6 @@ import (
 	logging "github.com/ipfs/go-log/v2"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	lps "github.com/whyrusleeping/pubsub"
-	"go.uber.org/multierr"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-address"
@@ -27,6 +28,7 @@ import (
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/stmgr"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/journal"
 	"github.com/filecoin-project/lotus/lib/sigs"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
@@ -37,6 +39,10 @@ const futureDebug = false
 
 const ReplaceByFeeRatio = 1.25
 
+// IdempotencyKeyTTL is how long messages pushed with an idempotency key are
+// remembered
+var IdempotencyKeyTTL = 24 * time.Hour
+
 var (
 	rbfNum   = types.NewInt(uint64((ReplaceByFeeRatio - 1) * 256))
 	rbfDenom = types.NewInt(256)
@@ -51,13 +57,18 @@ var (
 
 	ErrNotEnoughFunds = errors.New("not enough funds to execute transaction")
 
+	ErrPendingFundsExceeded = errors.New("pending messages require more funds than the sender has")
+
 	ErrInvalidToAddr = errors.New("message had invalid to address")
 
 	ErrBroadcastAnyway = errors.New("broadcasting message despite validation fail")
+
+	ErrRBFTooLowPrice = errors.New("replace by fee has too low GasPrice")
 )
 
 const (
 	localMsgsDs = "/mpool/local"
+	pushKeysDs  = "/mpool/pushkeys"
 
 	localUpdates = "update"
 )
@@ -65,8 +76,12 @@ const (
 type MessagePool struct {
 	lk sync.Mutex
 
-	closer  chan struct{}
-	repubTk *time.Ticker
+	closer chan struct{}
+
+	repubCfg RepublishConfig
+	// repubs tracks the republishing of local messages, it's only used by
+	// the republishing goroutine
+	repubs map[cid.Cid]*repubState
 
 	localAddrs map[address.Address]struct{}
 
@@ -90,6 +105,38 @@ type MessagePool struct {
 	netName dtypes.NetworkName
 
 	sigValCache *lru.TwoQueueCache
+
+	// pushKeys maps idempotency keys to the messages pushed with them, they
+	// are persisted in pushKeysDs, so that retries after a restart are safe.
+	// pushKeyAges holds the keys from the oldest to the newest, for expiry.
+	pushKeys    map[pushKey]*keyedPush
+	pushKeyAges []pushKey
+	pushKeysDs  datastore.Datastore
+
+	// localErrs holds the errors of the local messages which couldn't be
+	// added back to the pool when they were loaded
+	localErrs map[cid.Cid]string
+
+	// pendingFundsTolerance is the percentage of the balance by which the
+	// funds required by a sender's pending messages may exceed it
+	pendingFundsTolerance uint64
+}
+
+// pushKey is an idempotency key, keys are scoped to the sender
+type pushKey struct {
+	from address.Address
+	key  string
+}
+
+type keyedPush struct {
+	msg   *types.SignedMessage
+	added time.Time
+}
+
+// persistedPush is the stored form of a keyedPush
+type persistedPush struct {
+	Msg   []byte
+	Added time.Time
 }
 
 type msgSet struct {
@@ -111,10 +158,7 @@ func (ms *msgSet) add(m *types.SignedMessage) error {
 	if has {
 		if m.Cid() != exms.Cid() {
 			// check if RBF passes
-			minPrice := exms.Message.GasPrice
-			minPrice = types.BigAdd(minPrice, types.BigDiv(types.BigMul(minPrice, rbfNum), rbfDenom))
-			minPrice = types.BigAdd(minPrice, types.NewInt(1))
-			if types.BigCmp(m.Message.GasPrice, minPrice) > 0 {
+			if types.BigCmp(m.Message.GasPrice, MinRBFPrice(exms.Message.GasPrice)) >= 0 {
 				log.Infow("add with RBF", "oldprice", exms.Message.GasPrice,
 					"newprice", m.Message.GasPrice, "addr", m.Message.From, "nonce", m.Message.Nonce)
 			} else {
@@ -128,6 +172,13 @@ func (ms *msgSet) add(m *types.SignedMessage) error {
 	return nil
 }
 
+// MinRBFPrice returns the lowest gas price a message replacing a pending
+// message with the given gas price can have
+func MinRBFPrice(price types.BigInt) types.BigInt {
+	minPrice := types.BigAdd(price, types.BigDiv(types.BigMul(price, rbfNum), rbfDenom))
+	return types.BigAdd(minPrice, types.NewInt(2))
+}
+
 type Provider interface {
 	SubscribeHeadChanges(func(rev, app []*types.TipSet) error) *types.TipSet
 	PutMessage(m types.ChainMsg) (cid.Cid, error)
@@ -187,7 +238,8 @@ func New(api Provider, ds dtypes.MetadataDS, netName dtypes.NetworkName) (*Messa
 
 	mp := &MessagePool{
 		closer:        make(chan struct{}),
-		repubTk:       time.NewTicker(time.Duration(build.BlockDelaySecs) * 10 * time.Second),
+		repubCfg:      DefaultRepublishConfig(),
+		repubs:        make(map[cid.Cid]*repubState),
 		localAddrs:    make(map[address.Address]struct{}),
 		pending:       make(map[address.Address]*msgSet),
 		minGasPrice:   types.NewInt(0),
@@ -198,14 +250,11 @@ func New(api Provider, ds dtypes.MetadataDS, netName dtypes.NetworkName) (*Messa
 		localMsgs:     namespace.Wrap(ds, datastore.NewKey(localMsgsDs)),
 		api:           api,
 		netName:       netName,
+		pushKeys:      make(map[pushKey]*keyedPush),
+		pushKeysDs:    namespace.Wrap(ds, datastore.NewKey(pushKeysDs)),
+		localErrs:     make(map[cid.Cid]string),
 	}
 
-	if err := mp.loadLocal(); err != nil {
-		log.Errorf("loading local messages: %+v", err)
-	}
-
-	go mp.repubLocal()
-
 	mp.curTs = api.SubscribeHeadChanges(func(rev, app []*types.TipSet) error {
 		err := mp.HeadChange(rev, app)
 		if err != nil {
@@ -214,6 +263,17 @@ func New(api Provider, ds dtypes.MetadataDS, netName dtypes.NetworkName) (*Messa
 		return err
 	})
 
+	if err := mp.loadPushKeys(); err != nil {
+		log.Errorf("loading idempotency keys: %+v", err)
+	}
+
+	// local messages are revalidated against the head
+	if err := mp.loadLocal(); err != nil {
+		log.Errorf("loading local messages: %+v", err)
+	}
+
+	go mp.repubLocal()
+
 	return mp, nil
 }
 
@@ -222,72 +282,6 @@ func (mp *MessagePool) Close() error {
 	return nil
 }
 
-func (mp *MessagePool) repubLocal() {
-	for {
-		select {
-		case <-mp.repubTk.C:
-			mp.lk.Lock()
-
-			msgsForAddr := make(map[address.Address][]*types.SignedMessage)
-			for a := range mp.localAddrs {
-				msgsForAddr[a] = mp.pendingFor(a)
-			}
-
-			mp.lk.Unlock()
-
-			var errout error
-			outputMsgs := []*types.SignedMessage{}
-
-			for a, msgs := range msgsForAddr {
-				a, err := mp.api.StateGetActor(a, nil)
-				if err != nil {
-					errout = multierr.Append(errout, xerrors.Errorf("could not get actor state: %w", err))
-					continue
-				}
-
-				curNonce := a.Nonce
-				for _, m := range msgs {
-					if m.Message.Nonce < curNonce {
-						continue
-					}
-					if m.Message.Nonce != curNonce {
-						break
-					}
-					outputMsgs = append(outputMsgs, m)
-					curNonce++
-				}
-
-			}
-
-			if len(outputMsgs) != 0 {
-				log.Infow("republishing local messages", "n", len(outputMsgs))
-			}
-
-			for _, msg := range outputMsgs {
-				msgb, err := msg.Serialize()
-				if err != nil {
-					errout = multierr.Append(errout, xerrors.Errorf("could not serialize: %w", err))
-					continue
-				}
-
-				err = mp.api.PubSubPublish(build.MessagesTopic(mp.netName), msgb)
-				if err != nil {
-					errout = multierr.Append(errout, xerrors.Errorf("could not publish: %w", err))
-					continue
-				}
-			}
-
-			if errout != nil {
-				log.Errorf("errors while republishing: %+v", errout)
-			}
-		case <-mp.closer:
-			mp.repubTk.Stop()
-			return
-		}
-	}
-
-}
-
 func (mp *MessagePool) addLocal(m *types.SignedMessage, msgb []byte) error {
 	mp.localAddrs[m.Message.From] = struct{}{}
 
@@ -305,6 +299,12 @@ func (mp *MessagePool) Push(m *types.SignedMessage) (cid.Cid, error) {
 	}
 
 	if err := mp.Add(m); err != nil {
+		journal.Record(journal.SysMpool, journal.EvtMpoolReject, map[string]interface{}{
+			"cid":   m.Cid(),
+			"from":  m.Message.From,
+			"nonce": m.Message.Nonce,
+			"error": err.Error(),
+		})
 		return cid.Undef, err
 	}
 
@@ -400,9 +400,42 @@ func (mp *MessagePool) addTs(m *types.SignedMessage, curTs *types.TipSet) error
 	mp.lk.Lock()
 	defer mp.lk.Unlock()
 
+	if err := mp.checkPendingFunds(m, balance); err != nil {
+		return err
+	}
+
 	return mp.addLocked(m)
 }
 
+// SetPendingFundsTolerance sets the percentage of the sender balance by which
+// the funds required by its pending messages may exceed the balance
+func (mp *MessagePool) SetPendingFundsTolerance(percent uint64) {
+	mp.lk.Lock()
+	mp.pendingFundsTolerance = percent
+	mp.lk.Unlock()
+}
+
+// checkPendingFunds checks that the sender can pay for all of its pending
+// messages, including m, so that unfunded chains of messages can't be used to
+// fill the pool. The message m replaces is not counted.
+func (mp *MessagePool) checkPendingFunds(m *types.SignedMessage, balance types.BigInt) error {
+	required := m.Message.RequiredFunds()
+	if mset, ok := mp.pending[m.Message.From]; ok {
+		for nonce, pm := range mset.msgs {
+			if nonce == m.Message.Nonce {
+				continue
+			}
+			required = types.BigAdd(required, pm.Message.RequiredFunds())
+		}
+	}
+
+	allowed := types.BigAdd(balance, types.BigDiv(types.BigMul(balance, types.NewInt(mp.pendingFundsTolerance)), types.NewInt(100)))
+	if required.GreaterThan(allowed) {
+		return xerrors.Errorf("pending messages require %s, balance: %s: %w", types.FIL(required), types.FIL(balance), ErrPendingFundsExceeded)
+	}
+	return nil
+}
+
 func (mp *MessagePool) addSkipChecks(m *types.SignedMessage) error {
 	mp.lk.Lock()
 	defer mp.lk.Unlock()
@@ -528,6 +561,146 @@ func (mp *MessagePool) PushWithNonce(ctx context.Context, addr address.Address,
 	mp.lk.Lock()
 	defer mp.lk.Unlock()
 
+	return mp.pushWithNonceLocked(ctx, addr, cb)
+}
+
+// PushWithNonceKey is like PushWithNonce, but remembers the pushed message
+// under the given idempotency key of the sender for IdempotencyKeyTTL. While
+// the key is remembered, pushing with it returns the originally pushed message
+// instead of creating a new one, so that clients can safely retry pushes.
+func (mp *MessagePool) PushWithNonceKey(ctx context.Context, key string, addr address.Address, cb func(address.Address, uint64) (*types.SignedMessage, error)) (*types.SignedMessage, error) {
+	mp.curTsLk.Lock()
+	defer mp.curTsLk.Unlock()
+
+	mp.lk.Lock()
+	defer mp.lk.Unlock()
+
+	now := time.Now()
+	mp.expirePushKeys(now)
+
+	pk := pushKey{from: addr, key: key}
+	if kp, ok := mp.pushKeys[pk]; ok {
+		return kp.msg, nil
+	}
+
+	msg, err := mp.pushWithNonceLocked(ctx, addr, cb)
+	if msg != nil {
+		// the message is in the pool even if publishing it failed
+		kp := &keyedPush{msg: msg, added: now}
+		mp.pushKeys[pk] = kp
+		mp.pushKeyAges = append(mp.pushKeyAges, pk)
+		if err := mp.persistPushKey(pk, kp); err != nil {
+			log.Errorf("persisting idempotency key of message %s: %+v", msg.Cid(), err)
+		}
+	}
+	return msg, err
+}
+
+// expirePushKeys forgets the idempotency keys older than IdempotencyKeyTTL,
+// mp.lk must be held
+func (mp *MessagePool) expirePushKeys(now time.Time) {
+	for len(mp.pushKeyAges) > 0 {
+		pk := mp.pushKeyAges[0]
+		if now.Sub(mp.pushKeys[pk].added) <= IdempotencyKeyTTL {
+			return
+		}
+
+		mp.pushKeyAges = mp.pushKeyAges[1:]
+		delete(mp.pushKeys, pk)
+		if err := mp.pushKeysDs.Delete(pushKeyDsKey(pk)); err != nil {
+			log.Warnf("deleting expired idempotency key: %s", err)
+		}
+	}
+}
+
+func pushKeyDsKey(pk pushKey) datastore.Key {
+	return datastore.NewKey(pk.from.String()).ChildString(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(pk.key)))
+}
+
+func (mp *MessagePool) persistPushKey(pk pushKey, kp *keyedPush) error {
+	msgb, err := kp.msg.Serialize()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(&persistedPush{Msg: msgb, Added: kp.added})
+	if err != nil {
+		return err
+	}
+	return mp.pushKeysDs.Put(pushKeyDsKey(pk), b)
+}
+
+// loadPushKeys loads the idempotency keys which haven't expired, and deletes
+// the others
+func (mp *MessagePool) loadPushKeys() error {
+	res, err := mp.pushKeysDs.Query(query.Query{})
+	if err != nil {
+		return xerrors.Errorf("query idempotency keys: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	now := time.Now()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return xerrors.Errorf("r.Error: %w", r.Error)
+		}
+
+		dk := datastore.NewKey(r.Key)
+		pk, err := parsePushKey(dk)
+		if err != nil {
+			log.Warnf("skipping malformed idempotency key %q: %s", r.Key, err)
+			continue
+		}
+
+		var pp persistedPush
+		if err := json.Unmarshal(r.Value, &pp); err != nil {
+			return xerrors.Errorf("unmarshaling idempotency key: %w", err)
+		}
+		if now.Sub(pp.Added) > IdempotencyKeyTTL {
+			if err := mp.pushKeysDs.Delete(dk); err != nil {
+				return xerrors.Errorf("deleting expired idempotency key: %w", err)
+			}
+			continue
+		}
+
+		var sm types.SignedMessage
+		if err := sm.UnmarshalCBOR(bytes.NewReader(pp.Msg)); err != nil {
+			return xerrors.Errorf("unmarshaling message of idempotency key: %w", err)
+		}
+
+		mp.lk.Lock()
+		mp.pushKeys[pk] = &keyedPush{msg: &sm, added: pp.Added}
+		mp.pushKeyAges = append(mp.pushKeyAges, pk)
+		mp.lk.Unlock()
+	}
+
+	mp.lk.Lock()
+	sort.Slice(mp.pushKeyAges, func(i, j int) bool {
+		return mp.pushKeys[mp.pushKeyAges[i]].added.Before(mp.pushKeys[mp.pushKeyAges[j]].added)
+	})
+	mp.lk.Unlock()
+
+	return nil
+}
+
+func parsePushKey(dk datastore.Key) (pushKey, error) {
+	ns := dk.Namespaces()
+	if len(ns) != 2 {
+		return pushKey{}, xerrors.Errorf("expected a sender and a key, got %d parts", len(ns))
+	}
+
+	from, err := address.NewFromString(ns[0])
+	if err != nil {
+		return pushKey{}, xerrors.Errorf("parsing sender: %w", err)
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(ns[1])
+	if err != nil {
+		return pushKey{}, xerrors.Errorf("decoding key: %w", err)
+	}
+
+	return pushKey{from: from, key: string(key)}, nil
+}
+
+func (mp *MessagePool) pushWithNonceLocked(ctx context.Context, addr address.Address, cb func(address.Address, uint64) (*types.SignedMessage, error)) (*types.SignedMessage, error) {
 	fromKey := addr
 	if fromKey.Protocol() == address.ID {
 		var err error
@@ -547,6 +720,17 @@ func (mp *MessagePool) PushWithNonce(ctx context.Context, addr address.Address,
 		return nil, err
 	}
 
+	balance, err := mp.getStateBalance(fromKey, mp.curTs)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to check sender balance: %w", err)
+	}
+	if balance.LessThan(msg.Message.RequiredFunds()) {
+		return nil, xerrors.Errorf("not enough funds (required: %s, balance: %s): %w", types.FIL(msg.Message.RequiredFunds()), types.FIL(balance), ErrNotEnoughFunds)
+	}
+	if err := mp.checkPendingFunds(msg, balance); err != nil {
+		return nil, err
+	}
+
 	msgb, err := msg.Serialize()
 	if err != nil {
 		return nil, err
@@ -841,6 +1025,9 @@ func (mp *MessagePool) Updates(ctx context.Context) (<-chan api.MpoolUpdate, err
 	return out, nil
 }
 
+// loadLocal adds the persisted local messages back to the pool, validating
+// them against the current state, and publishes the ones which are still
+// valid.
 func (mp *MessagePool) loadLocal() error {
 	res, err := mp.localMsgs.Query(query.Query{})
 	if err != nil {
@@ -859,26 +1046,25 @@ func (mp *MessagePool) loadLocal() error {
 
 		if err := mp.Add(&sm); err != nil {
 			if xerrors.Is(err, ErrNonceTooLow) {
-				continue // todo: drop the message from local cache (if above certain confidence threshold)
+				continue // stale, PurgeLocal drops it
 			}
 
 			log.Errorf("adding local message: %+v", err)
+			mp.lk.Lock()
+			mp.localErrs[sm.Cid()] = err.Error()
+			mp.lk.Unlock()
+			continue
 		}
-	}
 
-	return nil
-}
-
-const MinGasPrice = 0
+		mp.lk.Lock()
+		mp.localAddrs[sm.Message.From] = struct{}{}
+		mp.lk.Unlock()
 
-func (mp *MessagePool) EstimateGasPrice(ctx context.Context, nblocksincl uint64, sender address.Address, gaslimit int64, tsk types.TipSetKey) (types.BigInt, error) {
-	// TODO: something smarter obviously
-	switch nblocksincl {
-	case 0:
-		return types.NewInt(MinGasPrice + 2), nil
-	case 1:
-		return types.NewInt(MinGasPrice + 1), nil
-	default:
-		return types.NewInt(MinGasPrice), nil
+		// the network may have dropped the message while the node was down
+		if err := mp.api.PubSubPublish(build.MessagesTopic(mp.netName), r.Value); err != nil {
+			log.Warnf("publishing reloaded local message %s: %s", sm.Cid(), err)
+		}
 	}
+
+	return nil
 }
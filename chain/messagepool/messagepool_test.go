@@ -2,122 +2,23 @@ package messagepool
 
 import (
 	"context"
-	"fmt"
 	"testing"
+	"time"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/messagepool/mpooltest"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/chain/types/mock"
 	"github.com/filecoin-project/lotus/chain/wallet"
 	_ "github.com/filecoin-project/lotus/lib/sigs/bls"
 	_ "github.com/filecoin-project/lotus/lib/sigs/secp"
 	"github.com/filecoin-project/specs-actors/actors/crypto"
-	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	"golang.org/x/xerrors"
 )
 
-type testMpoolAPI struct {
-	cb func(rev, app []*types.TipSet) error
-
-	bmsgs      map[cid.Cid][]*types.SignedMessage
-	statenonce map[address.Address]uint64
-
-	tipsets []*types.TipSet
-}
-
-func newTestMpoolAPI() *testMpoolAPI {
-	return &testMpoolAPI{
-		bmsgs:      make(map[cid.Cid][]*types.SignedMessage),
-		statenonce: make(map[address.Address]uint64),
-	}
-}
-
-func (tma *testMpoolAPI) applyBlock(t *testing.T, b *types.BlockHeader) {
-	t.Helper()
-	if err := tma.cb(nil, []*types.TipSet{mock.TipSet(b)}); err != nil {
-		t.Fatal(err)
-	}
-}
-
-func (tma *testMpoolAPI) revertBlock(t *testing.T, b *types.BlockHeader) {
-	t.Helper()
-	if err := tma.cb([]*types.TipSet{mock.TipSet(b)}, nil); err != nil {
-		t.Fatal(err)
-	}
-}
-
-func (tma *testMpoolAPI) setStateNonce(addr address.Address, v uint64) {
-	tma.statenonce[addr] = v
-}
-
-func (tma *testMpoolAPI) setBlockMessages(h *types.BlockHeader, msgs ...*types.SignedMessage) {
-	tma.bmsgs[h.Cid()] = msgs
-	tma.tipsets = append(tma.tipsets, mock.TipSet(h))
-}
-
-func (tma *testMpoolAPI) SubscribeHeadChanges(cb func(rev, app []*types.TipSet) error) *types.TipSet {
-	tma.cb = cb
-	return nil
-}
-
-func (tma *testMpoolAPI) PutMessage(m types.ChainMsg) (cid.Cid, error) {
-	return cid.Undef, nil
-}
-
-func (tma *testMpoolAPI) PubSubPublish(string, []byte) error {
-	return nil
-}
-
-func (tma *testMpoolAPI) StateGetActor(addr address.Address, ts *types.TipSet) (*types.Actor, error) {
-	return &types.Actor{
-		Nonce:   tma.statenonce[addr],
-		Balance: types.NewInt(90000000),
-	}, nil
-}
-
-func (tma *testMpoolAPI) StateAccountKey(ctx context.Context, addr address.Address, ts *types.TipSet) (address.Address, error) {
-	if addr.Protocol() != address.BLS && addr.Protocol() != address.SECP256K1 {
-		return address.Undef, fmt.Errorf("given address was not a key addr")
-	}
-	return addr, nil
-}
-
-func (tma *testMpoolAPI) MessagesForBlock(h *types.BlockHeader) ([]*types.Message, []*types.SignedMessage, error) {
-	return nil, tma.bmsgs[h.Cid()], nil
-}
-
-func (tma *testMpoolAPI) MessagesForTipset(ts *types.TipSet) ([]types.ChainMsg, error) {
-	if len(ts.Blocks()) != 1 {
-		panic("cant deal with multiblock tipsets in this test")
-	}
-
-	bm, sm, err := tma.MessagesForBlock(ts.Blocks()[0])
-	if err != nil {
-		return nil, err
-	}
-
-	var out []types.ChainMsg
-	for _, m := range bm {
-		out = append(out, m)
-	}
-
-	for _, m := range sm {
-		out = append(out, m)
-	}
-
-	return out, nil
-}
-
-func (tma *testMpoolAPI) LoadTipSet(tsk types.TipSetKey) (*types.TipSet, error) {
-	for _, ts := range tma.tipsets {
-		if types.CidArrsEqual(tsk.Cids(), ts.Cids()) {
-			return ts, nil
-		}
-	}
-
-	return nil, fmt.Errorf("tipset not found")
-}
-
 func assertNonce(t *testing.T, mp *MessagePool, addr address.Address, val uint64) {
 	t.Helper()
 	n, err := mp.GetNonce(addr)
@@ -138,7 +39,7 @@ func mustAdd(t *testing.T, mp *MessagePool, msg *types.SignedMessage) {
 }
 
 func TestMessagePool(t *testing.T) {
-	tma := newTestMpoolAPI()
+	tma := mpooltest.NewProvider()
 
 	w, err := wallet.NewWallet(wallet.NewMemKeyStore())
 	if err != nil {
@@ -165,21 +66,21 @@ func TestMessagePool(t *testing.T) {
 		msgs = append(msgs, mock.MkMessage(sender, target, uint64(i), w))
 	}
 
-	tma.setStateNonce(sender, 0)
+	tma.SetStateNonce(sender, 0)
 	assertNonce(t, mp, sender, 0)
 	mustAdd(t, mp, msgs[0])
 	assertNonce(t, mp, sender, 1)
 	mustAdd(t, mp, msgs[1])
 	assertNonce(t, mp, sender, 2)
 
-	tma.setBlockMessages(a, msgs[0], msgs[1])
-	tma.applyBlock(t, a)
+	tma.SetBlockMessages(a, msgs[0], msgs[1])
+	tma.ApplyBlock(t, a)
 
 	assertNonce(t, mp, sender, 2)
 }
 
 func TestRevertMessages(t *testing.T) {
-	tma := newTestMpoolAPI()
+	tma := mpooltest.NewProvider()
 
 	w, err := wallet.NewWallet(wallet.NewMemKeyStore())
 	if err != nil {
@@ -207,23 +108,23 @@ func TestRevertMessages(t *testing.T) {
 		msgs = append(msgs, mock.MkMessage(sender, target, uint64(i), w))
 	}
 
-	tma.setBlockMessages(a, msgs[0])
-	tma.setBlockMessages(b, msgs[1], msgs[2], msgs[3])
+	tma.SetBlockMessages(a, msgs[0])
+	tma.SetBlockMessages(b, msgs[1], msgs[2], msgs[3])
 
 	mustAdd(t, mp, msgs[0])
 	mustAdd(t, mp, msgs[1])
 	mustAdd(t, mp, msgs[2])
 	mustAdd(t, mp, msgs[3])
 
-	tma.setStateNonce(sender, 0)
-	tma.applyBlock(t, a)
+	tma.SetStateNonce(sender, 0)
+	tma.ApplyBlock(t, a)
 	assertNonce(t, mp, sender, 4)
 
-	tma.setStateNonce(sender, 1)
-	tma.applyBlock(t, b)
+	tma.SetStateNonce(sender, 1)
+	tma.ApplyBlock(t, b)
 	assertNonce(t, mp, sender, 4)
-	tma.setStateNonce(sender, 0)
-	tma.revertBlock(t, b)
+	tma.SetStateNonce(sender, 0)
+	tma.RevertBlock(t, b)
 
 	assertNonce(t, mp, sender, 4)
 
@@ -233,3 +134,413 @@ func TestRevertMessages(t *testing.T) {
 	}
 
 }
+
+func TestPushWithNonceKey(t *testing.T) {
+	tma := mpooltest.NewProvider()
+
+	w, err := wallet.NewWallet(wallet.NewMemKeyStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds := datastore.NewMapDatastore()
+	mp, err := New(tma, ds, "mptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := w.GenerateKey(crypto.SigTypeBLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := w.GenerateKey(crypto.SigTypeBLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := mock.Address(1001)
+
+	tma.SetStateNonce(sender, 0)
+	tma.SetStateNonce(other, 0)
+
+	pushFrom := func(sender address.Address, key string) *types.SignedMessage {
+		t.Helper()
+		m, err := mp.PushWithNonceKey(context.TODO(), key, sender, func(from address.Address, nonce uint64) (*types.SignedMessage, error) {
+			return mock.MkMessage(from, target, nonce, w), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	push := func(key string) *types.SignedMessage {
+		t.Helper()
+		return pushFrom(sender, key)
+	}
+
+	first := push("a")
+	if again := push("a"); again.Cid() != first.Cid() {
+		t.Fatalf("expected retried push to return %s, got %s", first.Cid(), again.Cid())
+	}
+	assertNonce(t, mp, sender, 1)
+
+	if other := push("b"); other.Message.Nonce != 1 {
+		t.Fatalf("expected push with a new key to use nonce 1, got %d", other.Message.Nonce)
+	}
+	assertNonce(t, mp, sender, 2)
+
+	// keys are scoped to the sender
+	if m := pushFrom(other, "a"); m.Message.From != other || m.Message.Nonce != 0 {
+		t.Fatalf("expected a push from another sender to create a message, got nonce %d from %s", m.Message.Nonce, m.Message.From)
+	}
+	assertNonce(t, mp, other, 1)
+
+	// keys are remembered across restarts
+	mp, err = New(tma, ds, "mptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again := push("a"); again.Cid() != first.Cid() {
+		t.Fatalf("expected push retried after a restart to return %s, got %s", first.Cid(), again.Cid())
+	}
+
+	// expired keys aren't loaded
+	defer func(ttl time.Duration) {
+		IdempotencyKeyTTL = ttl
+	}(IdempotencyKeyTTL)
+	IdempotencyKeyTTL = 0
+
+	mp, err = New(tma, ds, "mptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again := push("a"); again.Cid() == first.Cid() {
+		t.Fatal("expected an expired key not to return the original message")
+	}
+
+	// keys expire while the pool runs too
+	IdempotencyKeyTTL = time.Hour
+	m := push("c")
+	IdempotencyKeyTTL = 0
+	if again := push("c"); again.Cid() == m.Cid() {
+		t.Fatal("expected an expired key not to return the original message")
+	}
+	if len(mp.pushKeys) != 1 || len(mp.pushKeyAges) != 1 {
+		t.Fatalf("expected only the latest key to be remembered, got %d keys", len(mp.pushKeys))
+	}
+}
+
+func TestPendingFundsLimit(t *testing.T) {
+	tma := mpooltest.NewProvider()
+
+	w, err := wallet.NewWallet(wallet.NewMemKeyStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mp, err := New(tma, datastore.NewMapDatastore(), "mptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := w.GenerateKey(crypto.SigTypeBLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := mock.Address(1001)
+
+	// the test actors have a balance of 90000000
+	mkMsg := func(nonce uint64) *types.SignedMessage {
+		msg := &types.Message{
+			To:       target,
+			From:     sender,
+			Value:    types.NewInt(40000000),
+			Nonce:    nonce,
+			GasLimit: 1,
+			GasPrice: types.NewInt(0),
+		}
+		sig, err := w.Sign(context.TODO(), sender, msg.Cid().Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &types.SignedMessage{Message: *msg, Signature: *sig}
+	}
+
+	tma.SetStateNonce(sender, 0)
+	mustAdd(t, mp, mkMsg(0))
+	mustAdd(t, mp, mkMsg(1))
+
+	if err := mp.Add(mkMsg(2)); !xerrors.Is(err, ErrPendingFundsExceeded) {
+		t.Fatalf("expected pending funds to be exceeded, got: %+v", err)
+	}
+
+	// messages created by the node are checked too
+	pushed, err := mp.PushWithNonce(context.TODO(), sender, func(from address.Address, nonce uint64) (*types.SignedMessage, error) {
+		return mkMsg(nonce), nil
+	})
+	if !xerrors.Is(err, ErrPendingFundsExceeded) {
+		t.Fatalf("expected pending funds of a pushed message to be exceeded, got: %+v", err)
+	}
+	if pushed != nil {
+		t.Fatal("expected the pushed message not to be added")
+	}
+	assertNonce(t, mp, sender, 2)
+
+	mp.SetPendingFundsTolerance(50)
+	mustAdd(t, mp, mkMsg(2))
+	assertNonce(t, mp, sender, 3)
+}
+
+func TestReplace(t *testing.T) {
+	tma := mpooltest.NewProvider()
+
+	w, err := wallet.NewWallet(wallet.NewMemKeyStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mp, err := New(tma, datastore.NewMapDatastore(), "mptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := w.GenerateKey(crypto.SigTypeBLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := mock.Address(1001)
+
+	tma.SetStateNonce(sender, 0)
+	orig := mock.MkMessage(sender, target, 0, w)
+	mustAdd(t, mp, orig)
+
+	replace := func(price uint64) (*types.SignedMessage, error) {
+		return mp.Replace(context.TODO(), sender, 0, func(old *types.SignedMessage) (*types.SignedMessage, error) {
+			msg := old.Message
+			msg.GasPrice = types.NewInt(price)
+			sig, err := w.Sign(context.TODO(), sender, msg.Cid().Bytes())
+			if err != nil {
+				return nil, err
+			}
+			return &types.SignedMessage{Message: msg, Signature: *sig}, nil
+		})
+	}
+
+	if _, err := replace(1); !xerrors.Is(err, ErrRBFTooLowPrice) {
+		t.Fatalf("expected replacement price to be too low, got: %+v", err)
+	}
+
+	repl, err := replace(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, _ := mp.Pending()
+	if len(pending) != 1 || pending[0].Cid() != repl.Cid() {
+		t.Fatalf("expected only the replacement %s to be pending, got %v", repl.Cid(), pending)
+	}
+	if tma.Published != 1 {
+		t.Fatalf("expected the replacement to be published once, got %d publishes", tma.Published)
+	}
+	assertNonce(t, mp, sender, 1)
+
+	if _, err := mp.Replace(context.TODO(), sender, 1, nil); err == nil {
+		t.Fatal("expected replacing a message which isn't pending to fail")
+	}
+}
+
+func TestLocalPersistence(t *testing.T) {
+	w, err := wallet.NewWallet(wallet.NewMemKeyStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := w.GenerateKey(crypto.SigTypeBLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := mock.Address(1001)
+
+	ds := datastore.NewMapDatastore()
+
+	mp, err := New(mpooltest.NewProvider(), ds, "mptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 2; i++ {
+		if _, err := mp.Push(mock.MkMessage(sender, target, i, w)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = mp.Close()
+
+	// restart
+	tma := mpooltest.NewProvider()
+	mp, err = New(tma, ds, "mptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mp.Close() //nolint:errcheck
+
+	assertNonce(t, mp, sender, 2)
+	if tma.Published != 2 {
+		t.Fatalf("expected the reloaded messages to be published, got %d publishes", tma.Published)
+	}
+
+	// the first message lands on chain
+	tma.SetStateNonce(sender, 1)
+	mp.Remove(sender, 0)
+
+	local, err := mp.LocalMessages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[uint64]string{}
+	for _, m := range local {
+		statuses[m.Message.Message.Nonce] = m.Status
+	}
+	if statuses[0] != api.LocalStale || statuses[1] != api.LocalPending {
+		t.Fatalf("unexpected local message statuses: %v", statuses)
+	}
+
+	n, err := mp.PurgeLocal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 message to be purged, got %d", n)
+	}
+
+	local, err = mp.LocalMessages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(local) != 1 || local[0].Message.Message.Nonce != 1 {
+		t.Fatalf("expected only the pending message to be left, got %v", local)
+	}
+}
+
+func TestRepublishBackoff(t *testing.T) {
+	tma := mpooltest.NewProvider()
+
+	w, err := wallet.NewWallet(wallet.NewMemKeyStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mp, err := New(tma, datastore.NewMapDatastore(), "mptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mp.SetRepublishConfig(RepublishConfig{Interval: time.Minute, MaxAttempts: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := w.GenerateKey(crypto.SigTypeBLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := mock.Address(1001)
+
+	tma.SetStateNonce(sender, 0)
+	if _, err := mp.Push(mock.MkMessage(sender, target, 0, w)); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for _, step := range []struct {
+		after     time.Duration
+		published int
+	}{
+		{0, 2},
+		{30 * time.Second, 2},
+		{time.Minute, 3},
+		{2 * time.Minute, 3},
+		{3 * time.Minute, 4},
+		// max attempts reached
+		{time.Hour, 4},
+	} {
+		if err := mp.republish(start.Add(step.after)); err != nil {
+			t.Fatal(err)
+		}
+		if tma.Published != step.published {
+			t.Fatalf("after %s: expected %d publishes, got %d", step.after, step.published, tma.Published)
+		}
+	}
+}
+
+func TestDefaultRepublishConfig(t *testing.T) {
+	orig := build.BlockDelaySecs
+	defer func() {
+		build.BlockDelaySecs = orig
+	}()
+
+	// network params can change the block delay after the package is loaded
+	build.BlockDelaySecs = 4
+	if cfg := DefaultRepublishConfig(); cfg.Interval != 40*time.Second {
+		t.Fatalf("expected the interval to follow the block delay, got %s", cfg.Interval)
+	}
+}
+
+func TestEstimateGasPrice(t *testing.T) {
+	tma := mpooltest.NewProvider()
+
+	mp, err := New(tma, datastore.NewMapDatastore(), "mptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mkMsg := func(nonce, price uint64) *types.SignedMessage {
+		return &types.SignedMessage{Message: types.Message{
+			From:     mock.Address(1000),
+			To:       mock.Address(1001),
+			Nonce:    nonce,
+			Value:    types.NewInt(0),
+			GasPrice: types.NewInt(price),
+			GasLimit: 30_000_000_000,
+		}}
+	}
+
+	// the messages of b and c use 90% of the block gas limit
+	a := mock.MkBlock(nil, 1, 1)
+	tma.SetBlockMessages(a)
+	b := mock.MkBlock(mock.TipSet(a), 1, 1)
+	tma.SetBlockMessages(b, mkMsg(0, 5), mkMsg(1, 15), mkMsg(2, 25))
+	c := mock.MkBlock(mock.TipSet(b), 1, 1)
+	tma.SetBlockMessages(c, mkMsg(3, 10), mkMsg(4, 20), mkMsg(5, 30))
+
+	estimate := func(nblocks uint64, tsk types.TipSetKey) uint64 {
+		t.Helper()
+		p, err := mp.EstimateGasPrice(context.TODO(), nblocks, address.Undef, 0, tsk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.Uint64()
+	}
+
+	// the messages paying 30 to 20 fill half of the space of b and c
+	if p := estimate(1, mock.TipSet(c).Key()); p != 16 {
+		t.Fatalf("expected a gas price of 16, got %d", p)
+	}
+	// the empty block a leaves space for the messages paying 15 and 10
+	if p := estimate(2, mock.TipSet(c).Key()); p != 6 {
+		t.Fatalf("expected a gas price of 6, got %d", p)
+	}
+	if p := estimate(1, mock.TipSet(a).Key()); p != MinGasPrice {
+		t.Fatalf("expected the minimum gas price on empty blocks, got %d", p)
+	}
+
+	ps, err := mp.GasPricePercentiles(2, []float64{0, 50, 100}, mock.TipSet(c).Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, exp := range []uint64{5, 15, 30} {
+		if ps[i].Uint64() != exp {
+			t.Fatalf("expected percentile %d to be %d, got %s", i, exp, ps[i])
+		}
+	}
+
+	if _, err := mp.GasPricePercentiles(2, []float64{101}, mock.TipSet(c).Key()); err == nil {
+		t.Fatal("expected percentiles above 100 to be rejected")
+	}
+}
@@ -0,0 +1,127 @@
+// Package mpooltest provides an in-memory chain for testing the message pool.
+package mpooltest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+// Provider implements messagepool.Provider over blocks set up by the test.
+// Actors have the nonce set with SetStateNonce, and a balance covering the
+// messages of the tests.
+type Provider struct {
+	// Published counts the messages published to pubsub
+	Published int
+
+	cb func(rev, app []*types.TipSet) error
+
+	bmsgs      map[cid.Cid][]*types.SignedMessage
+	statenonce map[address.Address]uint64
+
+	tipsets []*types.TipSet
+}
+
+func NewProvider() *Provider {
+	return &Provider{
+		bmsgs:      make(map[cid.Cid][]*types.SignedMessage),
+		statenonce: make(map[address.Address]uint64),
+	}
+}
+
+// ApplyBlock notifies the message pool of a head change applying the block
+func (p *Provider) ApplyBlock(t *testing.T, b *types.BlockHeader) {
+	t.Helper()
+	if err := p.cb(nil, []*types.TipSet{mock.TipSet(b)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// RevertBlock notifies the message pool of a head change reverting the block
+func (p *Provider) RevertBlock(t *testing.T, b *types.BlockHeader) {
+	t.Helper()
+	if err := p.cb([]*types.TipSet{mock.TipSet(b)}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (p *Provider) SetStateNonce(addr address.Address, v uint64) {
+	p.statenonce[addr] = v
+}
+
+// SetBlockMessages sets the messages of the block, and makes its tipset
+// loadable
+func (p *Provider) SetBlockMessages(h *types.BlockHeader, msgs ...*types.SignedMessage) {
+	p.bmsgs[h.Cid()] = msgs
+	p.tipsets = append(p.tipsets, mock.TipSet(h))
+}
+
+func (p *Provider) SubscribeHeadChanges(cb func(rev, app []*types.TipSet) error) *types.TipSet {
+	p.cb = cb
+	return nil
+}
+
+func (p *Provider) PutMessage(m types.ChainMsg) (cid.Cid, error) {
+	return m.Cid(), nil
+}
+
+func (p *Provider) PubSubPublish(string, []byte) error {
+	p.Published++
+	return nil
+}
+
+func (p *Provider) StateGetActor(addr address.Address, ts *types.TipSet) (*types.Actor, error) {
+	return &types.Actor{
+		Nonce:   p.statenonce[addr],
+		Balance: types.NewInt(90000000),
+	}, nil
+}
+
+func (p *Provider) StateAccountKey(ctx context.Context, addr address.Address, ts *types.TipSet) (address.Address, error) {
+	if addr.Protocol() != address.BLS && addr.Protocol() != address.SECP256K1 {
+		return address.Undef, fmt.Errorf("given address was not a key addr")
+	}
+	return addr, nil
+}
+
+func (p *Provider) MessagesForBlock(h *types.BlockHeader) ([]*types.Message, []*types.SignedMessage, error) {
+	return nil, p.bmsgs[h.Cid()], nil
+}
+
+func (p *Provider) MessagesForTipset(ts *types.TipSet) ([]types.ChainMsg, error) {
+	if len(ts.Blocks()) != 1 {
+		panic("cant deal with multiblock tipsets in this test")
+	}
+
+	bm, sm, err := p.MessagesForBlock(ts.Blocks()[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var out []types.ChainMsg
+	for _, m := range bm {
+		out = append(out, m)
+	}
+
+	for _, m := range sm {
+		out = append(out, m)
+	}
+
+	return out, nil
+}
+
+func (p *Provider) LoadTipSet(tsk types.TipSetKey) (*types.TipSet, error) {
+	for _, ts := range p.tipsets {
+		if types.CidArrsEqual(tsk.Cids(), ts.Cids()) {
+			return ts, nil
+		}
+	}
+
+	return nil, fmt.Errorf("tipset not found")
+}
@@ -0,0 +1,94 @@
+package messagepool
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-datastore"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// Replace replaces the pending message of the sender with the given nonce by
+// the message cb makes from it, which has to keep the sender and nonce, and
+// pay at least MinRBFPrice of the gas price of the replaced message.
+//
+// The replaced message is evicted from the pool and the local messages, and
+// the replacement is stored as a local message and published.
+func (mp *MessagePool) Replace(ctx context.Context, from address.Address, nonce uint64, cb func(old *types.SignedMessage) (*types.SignedMessage, error)) (*types.SignedMessage, error) {
+	mp.curTsLk.Lock()
+	defer mp.curTsLk.Unlock()
+
+	if from.Protocol() == address.ID {
+		var err error
+		from, err = mp.api.StateAccountKey(ctx, from, mp.curTs)
+		if err != nil {
+			return nil, xerrors.Errorf("resolving sender key: %w", err)
+		}
+	}
+
+	balance, err := mp.getStateBalance(from, mp.curTs)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to check sender balance: %w", err)
+	}
+
+	mp.lk.Lock()
+	defer mp.lk.Unlock()
+
+	var old *types.SignedMessage
+	if mset, ok := mp.pending[from]; ok {
+		old = mset.msgs[nonce]
+	}
+	if old == nil {
+		return nil, xerrors.Errorf("no pending message from %s with nonce %d", from, nonce)
+	}
+
+	msg, err := cb(old)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.Message.From != from || msg.Message.Nonce != nonce {
+		return nil, xerrors.Errorf("replacement is from %s with nonce %d, expected %s with nonce %d", msg.Message.From, msg.Message.Nonce, from, nonce)
+	}
+	if msg.Cid() == old.Cid() {
+		return nil, xerrors.Errorf("replacement is the same message as %s", old.Cid())
+	}
+	if minPrice := MinRBFPrice(old.Message.GasPrice); types.BigCmp(msg.Message.GasPrice, minPrice) < 0 {
+		return nil, xerrors.Errorf("gas price %s is lower than %s: %w", msg.Message.GasPrice, minPrice, ErrRBFTooLowPrice)
+	}
+	if balance.LessThan(msg.Message.RequiredFunds()) {
+		return nil, xerrors.Errorf("not enough funds (required: %s, balance: %s): %w", types.FIL(msg.Message.RequiredFunds()), types.FIL(balance), ErrNotEnoughFunds)
+	}
+	if err := mp.checkPendingFunds(msg, balance); err != nil {
+		return nil, err
+	}
+
+	msgb, err := msg.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mp.addLocked(msg); err != nil {
+		return nil, xerrors.Errorf("add locked failed: %w", err)
+	}
+
+	mp.changes.Pub(api.MpoolUpdate{
+		Type:    api.MpoolRemove,
+		Message: old,
+	}, localUpdates)
+
+	if err := mp.localMsgs.Delete(datastore.NewKey(string(old.Cid().Bytes()))); err != nil && err != datastore.ErrNotFound {
+		log.Errorf("removing replaced local message: %+v", err)
+	}
+	if err := mp.addLocal(msg, msgb); err != nil {
+		log.Errorf("addLocal failed: %+v", err)
+	}
+
+	log.Infow("replaced pending message", "from", from, "nonce", nonce, "old", old.Cid(), "new", msg.Cid(), "oldprice", old.Message.GasPrice, "newprice", msg.Message.GasPrice)
+
+	return msg, mp.api.PubSubPublish(build.MessagesTopic(mp.netName), msgb)
+}
@@ -0,0 +1,250 @@
+package messagepool
+
+import (
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-cid"
+	"go.uber.org/multierr"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// RepublishConfig controls how local messages are republished while they
+// are pending
+type RepublishConfig struct {
+	// Interval is the time between republishing rounds, and the time before a
+	// message is republished for the first time
+	Interval time.Duration
+	// MaxAttempts is the number of times a message is republished before
+	// giving up on it, zero means no limit
+	MaxAttempts int
+}
+
+// DefaultRepublishConfig republishes every 10 epochs, without limit. It's
+// computed when called, as the block delay can be changed by network params.
+func DefaultRepublishConfig() RepublishConfig {
+	return RepublishConfig{
+		Interval: time.Duration(build.BlockDelaySecs) * 10 * time.Second,
+	}
+}
+
+// repubMaxBackoff caps the time between the republishing of a message, in
+// intervals
+const repubMaxBackoff = 16
+
+// repubCongestedRatio is the share of the block gas limit the messages of the
+// head blocks must use for the head to gate republishing
+var repubCongestedRatio = 0.9
+
+type repubState struct {
+	attempts int
+	next     time.Time
+	gaveUp   bool
+}
+
+// SetRepublishConfig replaces the republishing config, it's used from the
+// next round on
+func (mp *MessagePool) SetRepublishConfig(cfg RepublishConfig) error {
+	if cfg.Interval <= 0 {
+		return xerrors.Errorf("invalid republish interval %s", cfg.Interval)
+	}
+	if cfg.MaxAttempts < 0 {
+		return xerrors.Errorf("invalid republish attempts %d", cfg.MaxAttempts)
+	}
+
+	mp.lk.Lock()
+	defer mp.lk.Unlock()
+
+	mp.repubCfg = cfg
+	return nil
+}
+
+func (mp *MessagePool) repubLocal() {
+	for {
+		mp.lk.Lock()
+		interval := mp.repubCfg.Interval
+		mp.lk.Unlock()
+
+		tm := time.NewTimer(interval)
+		select {
+		case <-tm.C:
+			if err := mp.republish(time.Now()); err != nil {
+				log.Errorf("errors while republishing: %+v", err)
+			}
+		case <-mp.closer:
+			tm.Stop()
+			return
+		}
+	}
+}
+
+// republish gossips the local messages which can be included next: the
+// pending messages of each local sender, from its state nonce on, up to the
+// first gap. Every message is republished with exponential backoff, starting
+// at the interval, until it's included or MaxAttempts is reached.
+//
+// The chain doesn't have a base fee, the lowest gas price of the messages in
+// the head tipset is used in its place while the head blocks are congested:
+// messages priced lower than it, and the messages of their sender after them,
+// aren't republished, as they aren't likely to be included before the
+// congestion ends. Rounds in which a message is held back or fails to publish
+// don't count as attempts.
+//
+// Only called from the republishing goroutine, which owns mp.repubs.
+func (mp *MessagePool) republish(now time.Time) error {
+	mp.lk.Lock()
+	cfg := mp.repubCfg
+	msgsForAddr := make(map[address.Address][]*types.SignedMessage)
+	for a := range mp.localAddrs {
+		msgsForAddr[a] = mp.pendingFor(a)
+	}
+	mp.lk.Unlock()
+
+	var errout error
+
+	floor, err := mp.repubPriceFloor()
+	if err != nil {
+		errout = multierr.Append(errout, xerrors.Errorf("computing republish price floor: %w", err))
+		floor = types.NewInt(0)
+	}
+
+	pending := map[cid.Cid]struct{}{}
+	var outputMsgs []*types.SignedMessage
+	var gated int
+
+	for a, msgs := range msgsForAddr {
+		for _, m := range msgs {
+			pending[m.Cid()] = struct{}{}
+		}
+
+		act, err := mp.api.StateGetActor(a, nil)
+		if err != nil {
+			errout = multierr.Append(errout, xerrors.Errorf("could not get actor state: %w", err))
+			continue
+		}
+
+		curNonce := act.Nonce
+		for _, m := range msgs {
+			if m.Message.Nonce < curNonce {
+				continue
+			}
+			if m.Message.Nonce != curNonce {
+				break
+			}
+			if types.BigCmp(m.Message.GasPrice, floor) < 0 {
+				gated++
+				break
+			}
+			outputMsgs = append(outputMsgs, m)
+			curNonce++
+		}
+	}
+
+	// forget the messages which aren't pending anymore
+	for c := range mp.repubs {
+		if _, ok := pending[c]; !ok {
+			delete(mp.repubs, c)
+		}
+	}
+
+	var due []*types.SignedMessage
+	for _, m := range outputMsgs {
+		st, ok := mp.repubs[m.Cid()]
+		if !ok {
+			st = &repubState{}
+			mp.repubs[m.Cid()] = st
+		}
+
+		if cfg.MaxAttempts > 0 && st.attempts >= cfg.MaxAttempts {
+			if !st.gaveUp {
+				log.Warnw("giving up republishing local message", "cid", m.Cid(), "from", m.Message.From, "nonce", m.Message.Nonce, "attempts", st.attempts)
+				st.gaveUp = true
+			}
+			continue
+		}
+		if now.Before(st.next) {
+			continue
+		}
+
+		due = append(due, m)
+	}
+
+	if len(due) != 0 || gated != 0 {
+		log.Infow("republishing local messages", "n", len(due), "gated", gated, "priceFloor", floor)
+	}
+
+	for _, msg := range due {
+		msgb, err := msg.Serialize()
+		if err != nil {
+			errout = multierr.Append(errout, xerrors.Errorf("could not serialize: %w", err))
+			continue
+		}
+
+		err = mp.api.PubSubPublish(build.MessagesTopic(mp.netName), msgb)
+		if err != nil {
+			errout = multierr.Append(errout, xerrors.Errorf("could not publish: %w", err))
+			continue
+		}
+
+		st := mp.repubs[msg.Cid()]
+		st.attempts++
+		st.next = now.Add(repubBackoff(cfg.Interval, st.attempts))
+	}
+
+	return errout
+}
+
+// repubBackoff returns the time to wait after the given number of attempts
+func repubBackoff(interval time.Duration, attempts int) time.Duration {
+	d := interval
+	for i := 1; i < attempts && d < repubMaxBackoff*interval; i++ {
+		d *= 2
+	}
+	if d > repubMaxBackoff*interval {
+		d = repubMaxBackoff * interval
+	}
+	return d
+}
+
+// repubPriceFloor returns the lowest gas price of the messages in the head
+// tipset if its blocks are congested, zero otherwise
+func (mp *MessagePool) repubPriceFloor() (types.BigInt, error) {
+	mp.curTsLk.Lock()
+	ts := mp.curTs
+	mp.curTsLk.Unlock()
+
+	if ts == nil {
+		return types.NewInt(0), nil
+	}
+
+	var gasLimit int64
+	var floor types.BigInt
+	for _, b := range ts.Blocks() {
+		bms, sms, err := mp.api.MessagesForBlock(b)
+		if err != nil {
+			return types.EmptyInt, xerrors.Errorf("loading messages of block %s: %w", b.Cid(), err)
+		}
+
+		msgs := make([]*types.Message, 0, len(bms)+len(sms))
+		msgs = append(msgs, bms...)
+		for _, sm := range sms {
+			msgs = append(msgs, &sm.Message)
+		}
+
+		for _, m := range msgs {
+			gasLimit += m.GasLimit
+			if floor.Int == nil || types.BigCmp(m.GasPrice, floor) < 0 {
+				floor = m.GasPrice
+			}
+		}
+	}
+
+	if floor.Int == nil || float64(gasLimit) < repubCongestedRatio*float64(build.BlockGasLimit*int64(len(ts.Blocks()))) {
+		return types.NewInt(0), nil
+	}
+
+	return floor, nil
+}
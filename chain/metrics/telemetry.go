@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/node/impl/full"
+	"github.com/filecoin-project/lotus/node/modules/helpers"
+)
+
+const (
+	// TelemetryPeerHeader carries the ID of the reporting node. The public key
+	// needed to check the signature is derived from it.
+	TelemetryPeerHeader = "X-Lotus-Peer"
+	// TelemetrySignatureHeader carries the base64 encoded signature of the
+	// request body, made with the node's libp2p identity key.
+	TelemetrySignatureHeader = "X-Lotus-Signature"
+
+	telemetryTimeout = 30 * time.Second
+
+	defaultTelemetryInterval = 5 * time.Minute
+)
+
+// TelemetryReport is the periodic status report sent to a telemetry
+// collector.
+type TelemetryReport struct {
+	NodeName string
+	PeerID   peer.ID
+	Version  string
+	Time     int64
+
+	Height       abi.ChainEpoch
+	EpochsBehind abi.ChainEpoch
+	Peers        int
+
+	Goroutines int
+	HeapAlloc  uint64
+	Sys        uint64
+}
+
+// SendTelemetry periodically posts signed status reports to the given
+// collector. It's only enabled when a collector is configured.
+func SendTelemetry(nickname, collector string, interval time.Duration) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host, chain full.ChainAPI) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host, chain full.ChainAPI) {
+		ctx := helpers.LifecycleCtx(mctx, lc)
+
+		if interval <= 0 {
+			interval = defaultTelemetryInterval
+		}
+
+		lc.Append(fx.Hook{
+			OnStart: func(_ context.Context) error {
+				go sendTelemetry(ctx, h, chain, nickname, collector, interval)
+				return nil
+			},
+		})
+	}
+}
+
+func sendTelemetry(ctx context.Context, h host.Host, chain full.ChainAPI, nickname, collector string, interval time.Duration) {
+	client := &http.Client{Timeout: telemetryTimeout}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		r, err := telemetryReport(ctx, h, chain, nickname)
+		if err != nil {
+			log.Warnf("creating telemetry report: %s", err)
+		} else if err := postTelemetry(ctx, client, h, collector, r); err != nil {
+			log.Warnf("sending telemetry report: %s", err)
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func telemetryReport(ctx context.Context, h host.Host, chain full.ChainAPI, nickname string) (*TelemetryReport, error) {
+	hi, err := chain.ChainHeadInfo(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("getting head info: %w", err)
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	return &TelemetryReport{
+		NodeName: nickname,
+		PeerID:   h.ID(),
+		Version:  build.UserVersion(),
+		Time:     time.Now().Unix(),
+
+		Height:       hi.TipSet.Height(),
+		EpochsBehind: hi.EpochsBehind,
+		Peers:        len(h.Network().Peers()),
+
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  ms.HeapAlloc,
+		Sys:        ms.Sys,
+	}, nil
+}
+
+func postTelemetry(ctx context.Context, client *http.Client, h host.Host, collector string, r *TelemetryReport) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	pk := h.Peerstore().PrivKey(h.ID())
+	if pk == nil {
+		return xerrors.Errorf("no private key for own peer ID")
+	}
+	sig, err := pk.Sign(body)
+	if err != nil {
+		return xerrors.Errorf("signing report: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", collector, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TelemetryPeerHeader, h.ID().Pretty())
+	req.Header.Set(TelemetrySignatureHeader, base64.StdEncoding.EncodeToString(sig))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return xerrors.Errorf("collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
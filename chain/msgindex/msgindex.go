@@ -0,0 +1,280 @@
+package msgindex
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var log = logging.Logger("msgindex")
+
+var (
+	cursorKey = datastore.NewKey("/cursor")
+	msgPrefix = datastore.NewKey("/m")
+)
+
+// MsgInfo is where a message was executed
+type MsgInfo struct {
+	// TipSet is the tipset holding the receipt of the message, the child of
+	// the tipset the message was included in
+	TipSet  types.TipSetKey
+	Height  abi.ChainEpoch
+	Receipt types.MessageReceipt
+}
+
+// Index maps message CIDs to the tipsets they were executed in, so that
+// message lookups don't have to walk the chain. It follows the chain with a
+// store.Follower, continuing where it stopped after a restart.
+//
+// Indexing starts at the head the node had when the index was enabled, older
+// messages are only indexed by Rebuild. Lookups check that the tipset of an
+// entry is on the chain they are made against, so entries left behind by
+// reorgs are never returned.
+type Index struct {
+	cs *store.ChainStore
+	ds datastore.Batching
+
+	lk sync.Mutex
+}
+
+func New(cs *store.ChainStore, ds datastore.Batching) *Index {
+	return &Index{
+		cs: cs,
+		ds: ds,
+	}
+}
+
+// Run follows the chain until the context is cancelled.
+func (ix *Index) Run(ctx context.Context) {
+	ix.cs.Follow(ctx, ix.follower())
+}
+
+func (ix *Index) follower() *store.Follower {
+	return &store.Follower{
+		Name:   "message index",
+		Cursor: ix.cursor,
+		Start: func(head *types.TipSet) error {
+			log.Infof("starting message index at height %d", head.Height())
+			return ix.setCursor(head)
+		},
+		Apply: func(_ context.Context, ts *types.TipSet) error {
+			return ix.apply(ts)
+		},
+		Revert: func(_ context.Context, ts *types.TipSet) error {
+			return ix.revert(ts)
+		},
+	}
+}
+
+// apply indexes the messages of the parent of ts, which were executed in ts.
+func (ix *Index) apply(ts *types.TipSet) error {
+	ix.lk.Lock()
+	defer ix.lk.Unlock()
+
+	if _, err := ix.index(ts); err != nil {
+		return err
+	}
+
+	return ix.setCursor(ts)
+}
+
+// revert removes the entries of the messages executed in ts. Entries pointing
+// at other tipsets are kept, the message may have been executed again on the
+// new chain already.
+func (ix *Index) revert(ts *types.TipSet) error {
+	ix.lk.Lock()
+	defer ix.lk.Unlock()
+
+	pts, err := ix.cs.LoadTipSet(ts.Parents())
+	if err != nil {
+		return xerrors.Errorf("loading parent tipset: %w", err)
+	}
+
+	msgs, err := ix.cs.MessagesForTipset(pts)
+	if err != nil {
+		return xerrors.Errorf("loading messages: %w", err)
+	}
+
+	for _, m := range msgs {
+		mi, err := ix.get(m.Cid())
+		if err != nil {
+			return err
+		}
+		if mi == nil || mi.TipSet != ts.Key() {
+			continue
+		}
+
+		if err := ix.ds.Delete(msgKey(m.Cid())); err != nil && err != datastore.ErrNotFound {
+			return xerrors.Errorf("deleting entry of %s: %w", m.Cid(), err)
+		}
+	}
+
+	return ix.setCursor(pts)
+}
+
+// index writes the entries of the messages executed in ts, returning how
+// many there were. Must be called with lk held.
+func (ix *Index) index(ts *types.TipSet) (int, error) {
+	if ts.Height() == 0 {
+		return 0, nil
+	}
+
+	pts, err := ix.cs.LoadTipSet(ts.Parents())
+	if err != nil {
+		return 0, xerrors.Errorf("loading parent tipset: %w", err)
+	}
+
+	msgs, err := ix.cs.MessagesForTipset(pts)
+	if err != nil {
+		return 0, xerrors.Errorf("loading messages: %w", err)
+	}
+
+	batch, err := ix.ds.Batch()
+	if err != nil {
+		return 0, xerrors.Errorf("creating batch: %w", err)
+	}
+
+	for i, m := range msgs {
+		rec, err := ix.cs.GetParentReceipt(ts.Blocks()[0], i)
+		if err != nil {
+			return 0, xerrors.Errorf("getting receipt of %s: %w", m.Cid(), err)
+		}
+
+		b, err := json.Marshal(&MsgInfo{
+			TipSet:  ts.Key(),
+			Height:  ts.Height(),
+			Receipt: *rec,
+		})
+		if err != nil {
+			return 0, xerrors.Errorf("marshaling entry of %s: %w", m.Cid(), err)
+		}
+
+		if err := batch.Put(msgKey(m.Cid()), b); err != nil {
+			return 0, xerrors.Errorf("storing entry of %s: %w", m.Cid(), err)
+		}
+	}
+
+	if err := batch.Commit(); err != nil {
+		return 0, xerrors.Errorf("committing entries of epoch %d: %w", ts.Height(), err)
+	}
+
+	return len(msgs), nil
+}
+
+// Lookup returns the tipset the message was executed in, and its receipt, as
+// seen from the chain of head. Nil is returned when the message isn't indexed
+// or its entry is for a tipset which isn't on that chain; the chain can still
+// hold the message when the index doesn't cover its epoch.
+func (ix *Index) Lookup(ctx context.Context, m cid.Cid, head *types.TipSet) (*types.TipSet, *types.MessageReceipt, error) {
+	mi, err := ix.get(m)
+	if err != nil || mi == nil {
+		return nil, nil, err
+	}
+
+	if mi.Height > head.Height() {
+		return nil, nil, nil
+	}
+
+	ts, err := ix.cs.GetTipsetByHeight(ctx, mi.Height, head, false)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("loading tipset at %d: %w", mi.Height, err)
+	}
+	if ts.Key() != mi.TipSet {
+		return nil, nil, nil
+	}
+
+	return ts, &mi.Receipt, nil
+}
+
+// Rebuild indexes the messages executed in the tipsets from head back to the
+// given epoch, or to genesis when it's zero, returning the number of messages
+// indexed. It's used to index the messages executed before the index was
+// enabled.
+func (ix *Index) Rebuild(ctx context.Context, head *types.TipSet, to abi.ChainEpoch) (int, error) {
+	var indexed int
+	for ts := head; ts.Height() > to; {
+		if err := ctx.Err(); err != nil {
+			return indexed, err
+		}
+
+		ix.lk.Lock()
+		n, err := ix.index(ts)
+		ix.lk.Unlock()
+		if err != nil {
+			return indexed, xerrors.Errorf("indexing epoch %d: %w", ts.Height(), err)
+		}
+		indexed += n
+
+		if ts.Height()%1000 == 0 {
+			log.Infow("rebuilding message index", "epoch", ts.Height(), "messages", indexed)
+		}
+
+		ts, err = ix.cs.LoadTipSet(ts.Parents())
+		if err != nil {
+			return indexed, xerrors.Errorf("loading parent tipset: %w", err)
+		}
+	}
+
+	return indexed, nil
+}
+
+// get returns the entry of the message, or nil if there is none
+func (ix *Index) get(m cid.Cid) (*MsgInfo, error) {
+	b, err := ix.ds.Get(msgKey(m))
+	switch {
+	case err == datastore.ErrNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, xerrors.Errorf("getting entry of %s: %w", m, err)
+	}
+
+	var mi MsgInfo
+	if err := json.Unmarshal(b, &mi); err != nil {
+		return nil, xerrors.Errorf("unmarshaling entry of %s: %w", m, err)
+	}
+	return &mi, nil
+}
+
+// cursor returns the key of the last tipset indexed, and false when the index
+// didn't start yet
+func (ix *Index) cursor() (types.TipSetKey, bool, error) {
+	b, err := ix.ds.Get(cursorKey)
+	switch {
+	case err == datastore.ErrNotFound:
+		return types.EmptyTSK, false, nil
+	case err != nil:
+		return types.EmptyTSK, false, err
+	}
+
+	var tsk types.TipSetKey
+	if err := json.Unmarshal(b, &tsk); err != nil {
+		return types.EmptyTSK, false, xerrors.Errorf("unmarshaling cursor: %w", err)
+	}
+	return tsk, true, nil
+}
+
+func (ix *Index) setCursor(ts *types.TipSet) error {
+	b, err := json.Marshal(ts.Key())
+	if err != nil {
+		return xerrors.Errorf("marshaling cursor: %w", err)
+	}
+
+	if err := ix.ds.Put(cursorKey, b); err != nil {
+		return xerrors.Errorf("storing cursor: %w", err)
+	}
+	return nil
+}
+
+func msgKey(m cid.Cid) datastore.Key {
+	return msgPrefix.ChildString(m.String())
+}
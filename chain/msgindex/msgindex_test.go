@@ -0,0 +1,186 @@
+package msgindex
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/builtin/power"
+	"github.com/filecoin-project/specs-actors/actors/builtin/verifreg"
+
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func init() {
+	miner.SupportedProofTypes = map[abi.RegisteredSealProof]struct{}{
+		abi.RegisteredSealProof_StackedDrg2KiBV1: {},
+	}
+	power.ConsensusMinerMinPower = big.NewInt(2048)
+	verifreg.MinVerifiedDealSize = big.NewInt(256)
+}
+
+func TestIndexApplyRevert(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// chain[i] includes msgs[i], which are executed in chain[i+1]
+	chain := []*types.TipSet{cg.CurTipset.TipSet()}
+	msgs := [][]*types.SignedMessage{nil}
+	for i := 0; i < 4; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, mts.TipSet.TipSet())
+		msgs = append(msgs, mts.Messages)
+	}
+
+	// a fork without messages on top of chain[2], which executes msgs[2] again
+	cg.GetMessages = func(*gen.ChainGen) ([]*types.SignedMessage, error) {
+		return nil, nil
+	}
+	fork := append([]*types.TipSet{}, chain[:3]...)
+	for i := 0; i < 2; i++ {
+		mts, err := cg.NextTipSetFromMiners(fork[len(fork)-1], cg.Miners)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fork = append(fork, mts.TipSet.TipSet())
+	}
+
+	ix := New(cg.ChainStore(), datastore.NewMapDatastore())
+
+	expect := func(m *types.SignedMessage, head, at *types.TipSet) {
+		t.Helper()
+		ts, rec, err := ix.Lookup(ctx, m.Cid(), head)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if at == nil {
+			if ts != nil {
+				t.Fatalf("expected %s not to be found, got height %d", m.Cid(), ts.Height())
+			}
+			return
+		}
+		if ts == nil || !ts.Equals(at) || rec == nil {
+			t.Fatalf("expected %s to be executed at height %d, got %v", m.Cid(), at.Height(), ts)
+		}
+	}
+	expectCursor := func(ts *types.TipSet) {
+		t.Helper()
+		b, err := ix.ds.Get(cursorKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := json.Marshal(ts.Key())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != string(expected) {
+			t.Fatalf("expected the cursor at %s, got %s", ts.Key(), b)
+		}
+	}
+
+	// the index starts at the first head it sees
+	if err := ix.cs.CatchUp(ctx, ix.follower(), chain[0]); err != nil {
+		t.Fatal(err)
+	}
+	for _, ts := range chain[1:] {
+		if err := ix.apply(ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectCursor(chain[4])
+
+	head := chain[4]
+	for i := 1; i <= 3; i++ {
+		for _, m := range msgs[i] {
+			expect(m, head, chain[i+1])
+		}
+	}
+	// included but not executed yet
+	expect(msgs[4][0], head, nil)
+	// executed above the head of the lookup
+	expect(msgs[3][0], chain[3], nil)
+	// the entry is for a tipset which isn't on the fork
+	expect(msgs[3][0], fork[4], nil)
+
+	// switching to the fork reverts chain[4] and chain[3], and applies the fork
+	if err := ix.cs.CatchUp(ctx, ix.follower(), fork[4]); err != nil {
+		t.Fatal(err)
+	}
+	expectCursor(fork[4])
+
+	head = fork[4]
+	expect(msgs[1][0], head, chain[2])
+	for _, m := range msgs[2] {
+		expect(m, head, fork[3])
+	}
+	for _, m := range msgs[3] {
+		mi, err := ix.get(m.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mi != nil {
+			t.Fatalf("expected the entry of %s to be removed by the revert, got height %d", m.Cid(), mi.Height)
+		}
+	}
+
+	// reverting a tipset keeps the entries of messages which were executed
+	// again in another tipset, as when the new chain is applied first
+	if err := ix.apply(chain[3]); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.revert(fork[3]); err != nil {
+		t.Fatal(err)
+	}
+	expect(msgs[2][0], chain[3], chain[3])
+	expectCursor(chain[2])
+}
+
+func TestIndexRebuild(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := []*types.TipSet{cg.CurTipset.TipSet()}
+	msgs := [][]*types.SignedMessage{nil}
+	for i := 0; i < 4; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, mts.TipSet.TipSet())
+		msgs = append(msgs, mts.Messages)
+	}
+
+	ix := New(cg.ChainStore(), datastore.NewMapDatastore())
+
+	// chain[4] and chain[3] are indexed, they execute msgs[3] and msgs[2]
+	n, err := ix.Rebuild(ctx, chain[4], chain[2].Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(msgs[3])+len(msgs[2]) {
+		t.Fatalf("expected %d messages to be indexed, got %d", len(msgs[3])+len(msgs[2]), n)
+	}
+	if ts, _, err := ix.Lookup(ctx, msgs[1][0].Cid(), chain[4]); err != nil || ts != nil {
+		t.Fatalf("expected the messages executed at the bound not to be indexed (%v)", err)
+	}
+	if ts, _, err := ix.Lookup(ctx, msgs[3][0].Cid(), chain[4]); err != nil || ts == nil || !ts.Equals(chain[4]) {
+		t.Fatalf("expected the messages executed at the head to be indexed (%v)", err)
+	}
+}
@@ -0,0 +1,260 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"go.opencensus.io/trace"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+
+	"github.com/filecoin-project/lotus/chain/state"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// Prefetcher loads the data the syncer is about to need into the chain store
+// caches, so that the I/O overlaps with the CPU-bound validation of the
+// current tipset.
+type Prefetcher interface {
+	// Prefetch is called with the tipset validated after the current one,
+	// and its messages if they were fetched from the network. A nil message
+	// slice means they're in the chain store. It must not block.
+	Prefetch(ctx context.Context, ts *types.TipSet, msgs []types.ChainMsg)
+}
+
+type noopPrefetcher struct{}
+
+func (noopPrefetcher) Prefetch(context.Context, *types.TipSet, []types.ChainMsg) {}
+
+// NoopPrefetcher returns a prefetcher which doesn't load anything
+func NoopPrefetcher() Prefetcher {
+	return noopPrefetcher{}
+}
+
+// statePrefetchDepth is how many tipsets back the state prefetcher looks for
+// a parent state root which is available locally
+const statePrefetchDepth = 3
+
+type prefetchJob struct {
+	ctx  context.Context
+	ts   *types.TipSet
+	msgs []types.ChainMsg
+}
+
+// prefetchActors are the actors touched when executing any tipset
+var prefetchActors = []address.Address{
+	builtin.SystemActorAddr,
+	builtin.InitActorAddr,
+	builtin.RewardActorAddr,
+	builtin.CronActorAddr,
+	builtin.StoragePowerActorAddr,
+	builtin.StorageMarketActorAddr,
+	builtin.BurntFundsActorAddr,
+}
+
+// StatePrefetcher loads the messages of the next tipset, and the state of
+// the actors its execution will likely touch into the state cache of the
+// chain store: the senders and receivers of the messages, the block miners
+// and the builtin singletons. The state of the next tipset is usually still
+// being computed, so the actors are loaded from the latest parent state root
+// available locally, which shares most nodes with it.
+type StatePrefetcher struct {
+	cs *store.ChainStore
+
+	parallelism int
+
+	jobs    chan prefetchJob
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewStatePrefetcher starts a prefetcher loading tipsets in the given number
+// of workers, each loading parallelism actors at once. Tipsets are skipped
+// while queue tipsets are waiting already.
+func NewStatePrefetcher(cs *store.ChainStore, workers int, queue int, parallelism int) *StatePrefetcher {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	p := &StatePrefetcher{
+		cs:          cs,
+		parallelism: parallelism,
+		jobs:        make(chan prefetchJob, queue),
+		closing:     make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	return p
+}
+
+func (p *StatePrefetcher) Prefetch(ctx context.Context, ts *types.TipSet, msgs []types.ChainMsg) {
+	select {
+	case p.jobs <- prefetchJob{ctx: ctx, ts: ts, msgs: msgs}:
+	default:
+		// the workers are behind, the data would arrive too late to help
+		log.Debugw("prefetch queue full, skipping tipset", "height", ts.Height())
+	}
+}
+
+func (p *StatePrefetcher) Close() error {
+	close(p.closing)
+	p.wg.Wait()
+	return nil
+}
+
+func (p *StatePrefetcher) worker() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case j := <-p.jobs:
+			if j.ctx.Err() != nil {
+				continue
+			}
+			if err := p.prefetch(j); err != nil {
+				log.Debugw("prefetching tipset failed", "height", j.ts.Height(), "error", err)
+			}
+		case <-p.closing:
+			return
+		}
+	}
+}
+
+func (p *StatePrefetcher) prefetch(j prefetchJob) error {
+	ctx, span := trace.StartSpan(j.ctx, "prefetchTipSetState")
+	defer span.End()
+
+	msgs := j.msgs
+	if msgs == nil {
+		var err error
+		msgs, err = p.cs.MessagesForTipset(j.ts)
+		if err != nil {
+			return xerrors.Errorf("loading messages: %w", err)
+		}
+	}
+
+	root, err := p.latestState(j.ts)
+	if err != nil {
+		return err
+	}
+
+	seen := map[address.Address]struct{}{}
+	var addrs []address.Address
+	add := func(a address.Address) {
+		if _, ok := seen[a]; ok {
+			return
+		}
+		seen[a] = struct{}{}
+		addrs = append(addrs, a)
+	}
+
+	for _, a := range prefetchActors {
+		add(a)
+	}
+	for _, b := range j.ts.Blocks() {
+		add(b.Miner)
+	}
+	for _, m := range msgs {
+		vm := m.VMMessage()
+		add(vm.From)
+		add(vm.To)
+	}
+	span.AddAttributes(trace.Int64Attribute("actors", int64(len(addrs))))
+
+	todo := make(chan address.Address)
+	errs := make(chan error, p.parallelism)
+	for i := 0; i < p.parallelism && i < len(addrs); i++ {
+		go func() {
+			// state trees aren't safe for concurrent use
+			st, err := state.LoadStateTree(cbor.NewCborStore(p.cs.Blockstore()), root)
+			for a := range todo {
+				if err != nil || ctx.Err() != nil {
+					continue
+				}
+				p.prefetchActor(st, a)
+			}
+			errs <- err
+		}()
+	}
+
+	for _, a := range addrs {
+		todo <- a
+	}
+	close(todo)
+
+	var loadErr error
+	for i := 0; i < p.parallelism && i < len(addrs); i++ {
+		if err := <-errs; err != nil {
+			loadErr = xerrors.Errorf("loading state tree: %w", err)
+		}
+	}
+	return loadErr
+}
+
+// prefetchActor loads the state head of the actor, and the objects it links
+// to directly, which covers the roots of the HAMTs and AMTs of the actor.
+func (p *StatePrefetcher) prefetchActor(st *state.StateTree, a address.Address) {
+	act, err := st.GetActor(a)
+	if err != nil {
+		// e.g. actors created by the tipset
+		return
+	}
+
+	if act.Head.Prefix().Codec != cid.DagCBOR {
+		return
+	}
+	head, err := p.cs.Blockstore().Get(act.Head)
+	if err != nil {
+		log.Debugw("prefetching actor head", "actor", a, "error", err)
+		return
+	}
+
+	links, err := cbg.ScanForLinks(bytes.NewReader(head.RawData()))
+	if err != nil {
+		return
+	}
+	for _, l := range links {
+		if l.Prefix().Codec != cid.DagCBOR {
+			continue
+		}
+		if _, err := p.cs.Blockstore().Get(l); err != nil {
+			log.Debugw("prefetching actor state", "actor", a, "link", l, "error", err)
+		}
+	}
+}
+
+// latestState returns the newest parent state root of the tipset or its
+// ancestors which is in the blockstore
+func (p *StatePrefetcher) latestState(ts *types.TipSet) (cid.Cid, error) {
+	for i := 0; i < statePrefetchDepth; i++ {
+		has, err := p.cs.Blockstore().Has(ts.ParentState())
+		if err != nil {
+			return cid.Undef, xerrors.Errorf("checking for state root: %w", err)
+		}
+		if has {
+			return ts.ParentState(), nil
+		}
+		if ts.Height() == 0 {
+			break
+		}
+
+		ts, err = p.cs.LoadTipSet(ts.Parents())
+		if err != nil {
+			return cid.Undef, xerrors.Errorf("loading parent tipset: %w", err)
+		}
+	}
+
+	return cid.Undef, xerrors.Errorf("no state root available within %d tipsets", statePrefetchDepth)
+}
+
+var _ Prefetcher = (*StatePrefetcher)(nil)
@@ -0,0 +1,96 @@
+package chain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/builtin/power"
+	"github.com/filecoin-project/specs-actors/actors/builtin/verifreg"
+
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func init() {
+	miner.SupportedProofTypes = map[abi.RegisteredSealProof]struct{}{
+		abi.RegisteredSealProof_StackedDrg2KiBV1: {},
+	}
+	power.ConsensusMinerMinPower = big.NewInt(2048)
+	verifreg.MinVerifiedDealSize = big.NewInt(256)
+}
+
+// slowBlockstore delays reads, like a blockstore on disk
+type slowBlockstore struct {
+	blockstore.Blockstore
+	delay time.Duration
+}
+
+func (sb *slowBlockstore) Get(c cid.Cid) (block.Block, error) {
+	time.Sleep(sb.delay)
+	return sb.Blockstore.Get(c)
+}
+
+// BenchmarkPrefetchedExecution measures the execution of a tipset with a cold
+// state cache, and after the prefetcher loaded its state, which happens while
+// the previous tipset is validated during sync.
+func BenchmarkPrefetchedExecution(b *testing.B) {
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var ts *types.TipSet
+	for i := 0; i < 5; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			b.Fatal(err)
+		}
+		ts = mts.TipSet.TipSet()
+	}
+
+	bs := &slowBlockstore{Blockstore: cg.ChainStore().Blockstore(), delay: 100 * time.Microsecond}
+	cs := store.NewChainStore(bs, datastore.NewMapDatastore(), cg.ChainStore().VMSys())
+	if err := cs.SetGenesis(cg.Genesis()); err != nil {
+		b.Fatal(err)
+	}
+
+	p := NewStatePrefetcher(cs, 0, 1, 8)
+	ctx := context.TODO()
+
+	run := func(b *testing.B, prefetch bool) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			if err := cs.SetStateCacheSize(store.DefaultStateCacheSize); err != nil {
+				b.Fatal(err)
+			}
+			if prefetch {
+				if err := p.prefetch(prefetchJob{ctx: ctx, ts: ts}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StartTimer()
+
+			if _, _, err := stmgr.NewStateManager(cs).TipSetState(ctx, ts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("cold", func(b *testing.B) {
+		run(b, false)
+	})
+	b.Run("prefetched", func(b *testing.B) {
+		run(b, true)
+	})
+}
@@ -0,0 +1,342 @@
+package rollups
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var log = logging.Logger("rollups")
+
+var (
+	cursorKey    = datastore.NewKey("/cursor")
+	rollupPrefix = datastore.NewKey("/r")
+)
+
+// MaxRange is the largest number of epochs returned by a single query
+var MaxRange = abi.ChainEpoch(2880)
+
+// Indexer maintains per-epoch aggregates of the heaviest chain, so that
+// explorers don't have to fetch every block and receipt to chart the chain.
+// It follows the chain with a store.Follower, so it continues where it stopped
+// after a restart, and retries the epochs it failed to index.
+//
+// The rollup of an epoch needs the receipts and the state after executing its
+// tipset, which are only known once the next tipset is applied. The rollup of
+// the head epoch is therefore never available.
+type Indexer struct {
+	sm *stmgr.StateManager
+	cs *store.ChainStore
+	ds datastore.Batching
+
+	lk sync.Mutex
+}
+
+func New(sm *stmgr.StateManager, ds datastore.Batching) *Indexer {
+	return &Indexer{
+		sm: sm,
+		cs: sm.ChainStore(),
+		ds: ds,
+	}
+}
+
+// Run follows the chain until the context is cancelled.
+func (ix *Indexer) Run(ctx context.Context) {
+	ix.cs.Follow(ctx, ix.follower())
+}
+
+func (ix *Indexer) follower() *store.Follower {
+	return &store.Follower{
+		Name:   "epoch rollups",
+		Cursor: ix.cursor,
+		Start: func(head *types.TipSet) error {
+			log.Infof("starting epoch rollups at height %d", head.Height())
+			return ix.setCursor(head)
+		},
+		Apply: ix.apply,
+		Revert: func(_ context.Context, ts *types.TipSet) error {
+			return ix.revert(ts)
+		},
+	}
+}
+
+// apply records the rollup of the parent of ts, which was executed in ts.
+func (ix *Indexer) apply(ctx context.Context, ts *types.TipSet) error {
+	ix.lk.Lock()
+	defer ix.lk.Unlock()
+
+	if ts.Height() == 0 {
+		return ix.setCursor(ts)
+	}
+
+	pts, err := ix.cs.LoadTipSet(ts.Parents())
+	if err != nil {
+		return xerrors.Errorf("loading parent tipset: %w", err)
+	}
+
+	r, err := ix.compute(ctx, pts, ts)
+	if err != nil {
+		return xerrors.Errorf("computing rollup of epoch %d: %w", pts.Height(), err)
+	}
+
+	if err := ix.put(r); err != nil {
+		return err
+	}
+
+	return ix.setCursor(ts)
+}
+
+// revert removes the rollup of the parent of ts, which was computed with the
+// reverted execution results.
+func (ix *Indexer) revert(ts *types.TipSet) error {
+	ix.lk.Lock()
+	defer ix.lk.Unlock()
+
+	pts, err := ix.cs.LoadTipSet(ts.Parents())
+	if err != nil {
+		return xerrors.Errorf("loading parent tipset: %w", err)
+	}
+
+	if err := ix.ds.Delete(rollupKey(pts.Height())); err != nil && err != datastore.ErrNotFound {
+		return xerrors.Errorf("deleting rollup of epoch %d: %w", pts.Height(), err)
+	}
+
+	return ix.setCursor(pts)
+}
+
+func (ix *Indexer) compute(ctx context.Context, pts, ts *types.TipSet) (*api.EpochRollup, error) {
+	r := &api.EpochRollup{
+		Height:     pts.Height(),
+		TipSet:     pts.Key(),
+		Blocks:     len(pts.Blocks()),
+		FeesBurned: types.NewInt(0),
+		GasFees:    types.NewInt(0),
+	}
+
+	msgs, err := ix.cs.MessagesForTipset(pts)
+	if err != nil {
+		return nil, xerrors.Errorf("loading messages: %w", err)
+	}
+	r.Messages = len(msgs)
+
+	codes := map[address.Address]cid.Cid{}
+	for i, m := range msgs {
+		rec, err := ix.cs.GetParentReceipt(ts.Blocks()[0], i)
+		if err != nil {
+			return nil, xerrors.Errorf("getting receipt of %s: %w", m.Cid(), err)
+		}
+
+		vmm := m.VMMessage()
+		r.GasUsed += rec.GasUsed
+		r.GasFees = types.BigAdd(r.GasFees, types.BigMul(vmm.GasPrice, types.NewInt(uint64(rec.GasUsed))))
+
+		if rec.ExitCode != 0 || vmm.Method != builtin.MethodsMiner.ProveCommitSector {
+			continue
+		}
+
+		code, ok := codes[vmm.To]
+		if !ok {
+			act, err := ix.sm.GetActor(vmm.To, ts)
+			if err != nil {
+				return nil, xerrors.Errorf("loading recipient of %s: %w", m.Cid(), err)
+			}
+			code = act.Code
+			codes[vmm.To] = code
+		}
+		if code == builtin.StorageMinerActorCodeID {
+			r.NewSectors++
+		}
+	}
+
+	before, err := ix.sm.GetActor(builtin.BurntFundsActorAddr, pts)
+	if err != nil {
+		return nil, xerrors.Errorf("loading burnt funds actor: %w", err)
+	}
+	after, err := ix.sm.GetActor(builtin.BurntFundsActorAddr, ts)
+	if err != nil {
+		return nil, xerrors.Errorf("loading burnt funds actor: %w", err)
+	}
+	r.FeesBurned = types.BigSub(after.Balance, before.Balance)
+
+	_, pbefore, err := stmgr.GetPower(ctx, ix.sm, pts, address.Undef)
+	if err != nil {
+		return nil, err
+	}
+	_, pafter, err := stmgr.GetPower(ctx, ix.sm, ts, address.Undef)
+	if err != nil {
+		return nil, err
+	}
+	r.RawPowerDelta = types.BigSub(pafter.RawBytePower, pbefore.RawBytePower)
+	r.QAPowerDelta = types.BigSub(pafter.QualityAdjPower, pbefore.QualityAdjPower)
+
+	return r, nil
+}
+
+// Range returns the rollups of the epochs from..to, inclusive. Null rounds and
+// epochs which weren't indexed yet are skipped.
+func (ix *Indexer) Range(ctx context.Context, from, to abi.ChainEpoch) ([]api.EpochRollup, error) {
+	if to < from {
+		return nil, xerrors.Errorf("invalid range %d..%d", from, to)
+	}
+	if to-from >= MaxRange {
+		return nil, xerrors.Errorf("range %d..%d too large, at most %d epochs can be queried at once", from, to, MaxRange)
+	}
+
+	out := []api.EpochRollup{}
+	for h := from; h <= to; h++ {
+		r, err := ix.get(h)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			out = append(out, *r)
+		}
+	}
+
+	return out, nil
+}
+
+// MaxHistoryRange is the largest number of epochs covered by a single fee
+// history query
+var MaxHistoryRange = abi.ChainEpoch(7 * 2880)
+
+// FeeHistory downsamples the rollups of the epochs from..to, inclusive, into
+// buckets of resolution epochs. Buckets without indexed epochs are skipped.
+func (ix *Indexer) FeeHistory(ctx context.Context, from, to, resolution abi.ChainEpoch) ([]api.FeeHistoryPoint, error) {
+	if to < from {
+		return nil, xerrors.Errorf("invalid range %d..%d", from, to)
+	}
+	if resolution <= 0 {
+		return nil, xerrors.Errorf("invalid resolution %d", resolution)
+	}
+	if to-from >= MaxHistoryRange {
+		return nil, xerrors.Errorf("range %d..%d too large, at most %d epochs can be queried at once", from, to, MaxHistoryRange)
+	}
+
+	out := []api.FeeHistoryPoint{}
+	for start := from; start <= to; start += resolution {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		end := start + resolution - 1
+		if end > to {
+			end = to
+		}
+
+		pt := api.FeeHistoryPoint{
+			From:        start,
+			To:          end,
+			AvgGasPrice: types.NewInt(0),
+		}
+		fees := types.NewInt(0)
+		var blocks int64
+		for h := start; h <= end; h++ {
+			r, err := ix.get(h)
+			if err != nil {
+				return nil, err
+			}
+			if r == nil {
+				continue
+			}
+
+			pt.Epochs++
+			pt.GasUsed += r.GasUsed
+			fees = types.BigAdd(fees, r.GasFees)
+			blocks += int64(r.Blocks)
+		}
+		if pt.Epochs == 0 {
+			continue
+		}
+
+		if pt.GasUsed > 0 {
+			pt.AvgGasPrice = types.BigDiv(fees, types.NewInt(uint64(pt.GasUsed)))
+		}
+		if blocks > 0 {
+			pt.GasUtilization = float64(pt.GasUsed) / float64(blocks*build.BlockGasLimit)
+		}
+		out = append(out, pt)
+	}
+
+	return out, nil
+}
+
+// get returns the rollup of the epoch, or nil if there is none
+func (ix *Indexer) get(h abi.ChainEpoch) (*api.EpochRollup, error) {
+	b, err := ix.ds.Get(rollupKey(h))
+	switch {
+	case err == datastore.ErrNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, xerrors.Errorf("getting rollup of epoch %d: %w", h, err)
+	}
+
+	var r api.EpochRollup
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, xerrors.Errorf("unmarshaling rollup of epoch %d: %w", h, err)
+	}
+	return &r, nil
+}
+
+func (ix *Indexer) put(r *api.EpochRollup) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return xerrors.Errorf("marshaling rollup: %w", err)
+	}
+
+	if err := ix.ds.Put(rollupKey(r.Height), b); err != nil {
+		return xerrors.Errorf("storing rollup of epoch %d: %w", r.Height, err)
+	}
+	return nil
+}
+
+// cursor returns the key of the last tipset processed, and false when the
+// indexer didn't start yet
+func (ix *Indexer) cursor() (types.TipSetKey, bool, error) {
+	b, err := ix.ds.Get(cursorKey)
+	switch {
+	case err == datastore.ErrNotFound:
+		return types.EmptyTSK, false, nil
+	case err != nil:
+		return types.EmptyTSK, false, err
+	}
+
+	var tsk types.TipSetKey
+	if err := json.Unmarshal(b, &tsk); err != nil {
+		return types.EmptyTSK, false, xerrors.Errorf("unmarshaling cursor: %w", err)
+	}
+	return tsk, true, nil
+}
+
+func (ix *Indexer) setCursor(ts *types.TipSet) error {
+	b, err := json.Marshal(ts.Key())
+	if err != nil {
+		return xerrors.Errorf("marshaling cursor: %w", err)
+	}
+
+	if err := ix.ds.Put(cursorKey, b); err != nil {
+		return xerrors.Errorf("storing cursor: %w", err)
+	}
+	return nil
+}
+
+// rollupKey zero-pads the epoch, so that keys sort by epoch
+func rollupKey(h abi.ChainEpoch) datastore.Key {
+	return rollupPrefix.ChildString(fmt.Sprintf("%020d", h))
+}
@@ -0,0 +1,219 @@
+package rollups
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func TestFeeHistory(t *testing.T) {
+	ix := &Indexer{ds: datastore.NewMapDatastore()}
+	for _, r := range []*api.EpochRollup{
+		{Height: 10, Blocks: 1, GasUsed: 100, GasFees: types.NewInt(300)},
+		{Height: 11, Blocks: 2, GasUsed: 300, GasFees: types.NewInt(1500)},
+		{Height: 13, Blocks: 1, GasFees: types.NewInt(0)},
+	} {
+		if err := ix.put(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pts, err := ix.FeeHistory(context.TODO(), 10, 14, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the bucket of epoch 14 has no indexed epochs
+	if len(pts) != 2 {
+		t.Fatalf("expected 2 buckets, got %+v", pts)
+	}
+
+	expected := []struct {
+		from, to    abi.ChainEpoch
+		epochs      int
+		gasUsed     int64
+		avgGasPrice uint64
+		utilization float64
+	}{
+		// the gas price is weighted by gas used: (300+1500)/(100+300)
+		{10, 11, 2, 400, 4, float64(400) / float64(3*build.BlockGasLimit)},
+		{12, 13, 1, 0, 0, 0},
+	}
+	for i, e := range expected {
+		pt := pts[i]
+		if pt.From != e.from || pt.To != e.to || pt.Epochs != e.epochs || pt.GasUsed != e.gasUsed {
+			t.Errorf("bucket %d: expected %d..%d with %d epochs using %d gas, got %+v", i, e.from, e.to, e.epochs, e.gasUsed, pt)
+		}
+		if !pt.AvgGasPrice.Equals(types.NewInt(e.avgGasPrice)) {
+			t.Errorf("bucket %d: expected an average gas price of %d, got %s", i, e.avgGasPrice, pt.AvgGasPrice)
+		}
+		if pt.GasUtilization != e.utilization {
+			t.Errorf("bucket %d: expected a gas utilization of %f, got %f", i, e.utilization, pt.GasUtilization)
+		}
+	}
+
+	if _, err := ix.FeeHistory(context.TODO(), 10, 14, 0); err == nil {
+		t.Error("expected a zero resolution to be refused")
+	}
+	if _, err := ix.FeeHistory(context.TODO(), 0, MaxHistoryRange, 1); err == nil {
+		t.Error("expected a range over the maximum to be refused")
+	}
+}
+
+func TestRevertReapply(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := cg.Wallet().GenerateKey(crypto.SigTypeBLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every tipset includes a transfer which pays for gas
+	var nonce uint64
+	cg.GetMessages = func(cg *gen.ChainGen) ([]*types.SignedMessage, error) {
+		msg := types.Message{
+			To:       to,
+			From:     cg.Banker(),
+			Nonce:    nonce,
+			Value:    types.NewInt(100),
+			GasLimit: 1000000,
+			GasPrice: types.NewInt(1),
+		}
+		sig, err := cg.Wallet().Sign(ctx, cg.Banker(), msg.Cid().Bytes())
+		if err != nil {
+			return nil, err
+		}
+		nonce++
+		return []*types.SignedMessage{{Message: msg, Signature: *sig}}, nil
+	}
+
+	chain := []*types.TipSet{cg.CurTipset.TipSet()}
+	for i := 0; i < 4; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, mts.TipSet.TipSet())
+	}
+
+	ix := New(stmgr.NewStateManager(cg.ChainStore()), datastore.NewMapDatastore())
+	for _, ts := range chain {
+		if err := ix.apply(ctx, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rollups := func() []api.EpochRollup {
+		t.Helper()
+		rs, err := ix.Range(ctx, chain[0].Height(), chain[4].Height())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rs
+	}
+
+	// the head epoch isn't executed yet
+	applied := rollups()
+	if len(applied) != 4 || applied[0].Height != chain[0].Height() || applied[3].Height != chain[3].Height() {
+		t.Fatalf("expected the rollups of all epochs but the head, got %+v", applied)
+	}
+	if applied[1].Messages != 1 || applied[1].GasUsed <= 0 || applied[1].GasFees.Sign() <= 0 {
+		t.Fatalf("expected the transfer to be counted, got %+v", applied[1])
+	}
+
+	// reverting removes the rollups of the epochs executed in the reverted
+	// tipsets
+	for _, ts := range []*types.TipSet{chain[4], chain[3]} {
+		if err := ix.revert(ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rs := rollups(); len(rs) != 2 || rs[1].Height != chain[1].Height() {
+		t.Fatalf("expected the reverted rollups to be removed, got %+v", rs)
+	}
+	if tsk, ok, err := ix.cursor(); err != nil || !ok || tsk != chain[2].Key() {
+		t.Fatalf("expected the cursor to be moved back to height %d (%v)", chain[2].Height(), err)
+	}
+
+	// applying the tipsets again gives the same rollups
+	for _, ts := range chain[3:] {
+		if err := ix.apply(ctx, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reapplied := rollups()
+	if len(reapplied) != len(applied) {
+		t.Fatalf("expected %d rollups after applying again, got %d", len(applied), len(reapplied))
+	}
+	for i := range applied {
+		a, err := json.Marshal(applied[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(reapplied[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Fatalf("expected the rollup of epoch %d to be the same, got %s and %s", applied[i].Height, a, b)
+		}
+	}
+}
+
+func TestRangeBounds(t *testing.T) {
+	ctx := context.TODO()
+	ix := &Indexer{ds: datastore.NewMapDatastore()}
+	for _, h := range []abi.ChainEpoch{5, 6, 8} {
+		if err := ix.put(&api.EpochRollup{Height: h}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		from, to abi.ChainEpoch
+		heights  []abi.ChainEpoch
+	}{
+		// both ends are included
+		{5, 8, []abi.ChainEpoch{5, 6, 8}},
+		{6, 6, []abi.ChainEpoch{6}},
+		// epochs without rollups are skipped
+		{7, 7, nil},
+		{0, 5, []abi.ChainEpoch{5}},
+		{8, 8 + MaxRange - 1, []abi.ChainEpoch{8}},
+	} {
+		rs, err := ix.Range(ctx, tc.from, tc.to)
+		if err != nil {
+			t.Fatalf("%d..%d: %s", tc.from, tc.to, err)
+		}
+		if len(rs) != len(tc.heights) {
+			t.Fatalf("%d..%d: expected %v, got %+v", tc.from, tc.to, tc.heights, rs)
+		}
+		for i, h := range tc.heights {
+			if rs[i].Height != h {
+				t.Fatalf("%d..%d: expected %v, got %+v", tc.from, tc.to, tc.heights, rs)
+			}
+		}
+	}
+
+	if _, err := ix.Range(ctx, 6, 5); err == nil {
+		t.Error("expected an inverted range to be refused")
+	}
+	if _, err := ix.Range(ctx, 0, MaxRange); err == nil {
+		t.Error("expected a range over the maximum to be refused")
+	}
+}
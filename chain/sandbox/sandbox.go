@@ -0,0 +1,289 @@
+package sandbox
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/state"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/vm"
+	"github.com/filecoin-project/lotus/lib/bufbstore"
+)
+
+var log = logging.Logger("sandbox")
+
+var (
+	// MaxSandboxes is the number of sandboxes that can exist at the same time
+	MaxSandboxes = 16
+	// IdleTimeout is how long a sandbox is kept after it was last used
+	IdleTimeout = time.Hour
+)
+
+// Manager keeps named forks of the chain state, in which arbitrary messages
+// can be applied without affecting the real chain. All state written by a
+// sandbox is kept in memory, reads fall through to the chain blockstore.
+type Manager struct {
+	sm *stmgr.StateManager
+
+	lk    sync.Mutex
+	boxes map[string]*sandbox
+}
+
+type sandbox struct {
+	lk sync.Mutex
+
+	base   *types.TipSet
+	height abi.ChainEpoch
+	bs     *bufbstore.BufferedBS
+	root   cid.Cid
+
+	applied  int
+	created  time.Time
+	lastUsed time.Time
+}
+
+func NewManager(sm *stmgr.StateManager) *Manager {
+	return &Manager{
+		sm:    sm,
+		boxes: map[string]*sandbox{},
+	}
+}
+
+// Create forks the state resulting from executing the given tipset. Messages
+// applied to the sandbox are executed at the height following the tipset.
+func (m *Manager) Create(ctx context.Context, name string, ts *types.TipSet) (*api.SandboxInfo, error) {
+	if name == "" {
+		return nil, xerrors.New("sandbox name must not be empty")
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	m.expireLocked()
+
+	if _, ok := m.boxes[name]; ok {
+		return nil, xerrors.Errorf("sandbox %q already exists", name)
+	}
+	if len(m.boxes) >= MaxSandboxes {
+		return nil, xerrors.Errorf("too many sandboxes (max %d), delete unused ones first", MaxSandboxes)
+	}
+
+	root, _, err := m.sm.TipSetState(ctx, ts)
+	if err != nil {
+		return nil, xerrors.Errorf("computing base state: %w", err)
+	}
+
+	now := time.Now()
+	sb := &sandbox{
+		base:   ts,
+		height: ts.Height() + 1,
+		bs:     newBuffer(m.sm.ChainStore().Blockstore()),
+		root:   root,
+
+		created:  now,
+		lastUsed: now,
+	}
+	m.boxes[name] = sb
+
+	log.Infow("created sandbox", "name", name, "height", ts.Height())
+
+	return sb.info(name), nil
+}
+
+// Apply executes messages on top of the sandbox state. Messages don't need to
+// be signed, their nonces are assigned from the sandbox state.
+func (m *Manager) Apply(ctx context.Context, name string, msgs []*types.Message) ([]*api.InvocResult, error) {
+	sb, err := m.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	r := store.NewChainRand(m.sm.ChainStore(), sb.base.Cids(), sb.height)
+	vmi, err := vm.NewVM(sb.root, sb.height, r, sb.bs, m.sm.ChainStore().VMSys())
+	if err != nil {
+		return nil, xerrors.Errorf("setting up vm: %w", err)
+	}
+
+	out := make([]*api.InvocResult, 0, len(msgs))
+	for i, msg := range msgs {
+		msg := *msg
+		if msg.GasLimit == 0 {
+			msg.GasLimit = 10000000000
+		}
+		if msg.GasPrice == types.EmptyInt {
+			msg.GasPrice = types.NewInt(0)
+		}
+		if msg.Value == types.EmptyInt {
+			msg.Value = types.NewInt(0)
+		}
+
+		from, err := vmi.StateTree().GetActor(msg.From)
+		if err != nil {
+			return nil, xerrors.Errorf("getting sender of message %d: %w", i, err)
+		}
+		msg.Nonce = from.Nonce
+
+		ret, err := vmi.ApplyMessage(ctx, &msg)
+		if err != nil {
+			return nil, xerrors.Errorf("applying message %d: %w", i, err)
+		}
+
+		ir := &api.InvocResult{
+			Msg:            &msg,
+			MethodName:     stmgr.InvokedMethodName(vmi.StateTree(), &msg),
+			MsgRct:         &ret.MessageReceipt,
+			GasBreakdown:   ret.GasBreakdown,
+			ExecutionTrace: ret.ExecutionTrace,
+			Duration:       ret.Duration,
+		}
+		if ret.ActorErr != nil {
+			ir.Error = ret.ActorErr.Error()
+		}
+		out = append(out, ir)
+	}
+
+	root, err := vmi.Flush(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("flushing sandbox state: %w", err)
+	}
+
+	sb.root = root
+	sb.applied += len(msgs)
+
+	return out, nil
+}
+
+// StateTree returns the current state of the sandbox. It can be read while
+// messages are applied to the sandbox, which doesn't change it.
+func (m *Manager) StateTree(name string) (*state.StateTree, error) {
+	sb, err := m.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	return state.LoadStateTree(cbor.NewCborStore(sb.bs), sb.root)
+}
+
+// ReadState returns the balance and decoded state of an actor in the sandbox.
+func (m *Manager) ReadState(name string, addr address.Address) (*api.ActorState, error) {
+	st, err := m.StateTree(name)
+	if err != nil {
+		return nil, err
+	}
+
+	act, err := st.GetActor(addr)
+	if err != nil {
+		return nil, xerrors.Errorf("getting actor: %w", err)
+	}
+
+	blk, err := st.Store.(*cbor.BasicIpldStore).Blocks.Get(act.Head)
+	if err != nil {
+		return nil, xerrors.Errorf("getting actor state: %w", err)
+	}
+
+	oif, err := vm.DumpActorState(act.Code, blk.RawData())
+	if err != nil {
+		return nil, xerrors.Errorf("decoding actor state: %w", err)
+	}
+
+	return &api.ActorState{
+		Balance: act.Balance,
+		State:   oif,
+	}, nil
+}
+
+func (m *Manager) List() []api.SandboxInfo {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	m.expireLocked()
+
+	out := make([]api.SandboxInfo, 0, len(m.boxes))
+	for name, sb := range m.boxes {
+		sb.lk.Lock()
+		out = append(out, *sb.info(name))
+		sb.lk.Unlock()
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+func (m *Manager) Delete(name string) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if _, ok := m.boxes[name]; !ok {
+		return xerrors.Errorf("sandbox %q not found", name)
+	}
+	delete(m.boxes, name)
+
+	return nil
+}
+
+func (m *Manager) get(name string) (*sandbox, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	m.expireLocked()
+
+	sb, ok := m.boxes[name]
+	if !ok {
+		return nil, xerrors.Errorf("sandbox %q not found", name)
+	}
+	sb.lastUsed = time.Now()
+
+	return sb, nil
+}
+
+func (m *Manager) expireLocked() {
+	for name, sb := range m.boxes {
+		if time.Since(sb.lastUsed) > IdleTimeout {
+			log.Infow("removing idle sandbox", "name", name)
+			delete(m.boxes, name)
+		}
+	}
+}
+
+// newBuffer buffers the writes of a sandbox in memory. State trees returned
+// by StateTree are read while Apply writes, so the buffer is synchronized.
+func newBuffer(base blockstore.Blockstore) *bufbstore.BufferedBS {
+	return bufbstore.NewTieredBstore(base, blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore())))
+}
+
+func (sb *sandbox) info(name string) *api.SandboxInfo {
+	return &api.SandboxInfo{
+		Name:      name,
+		Base:      sb.base.Key(),
+		Height:    sb.height,
+		StateRoot: sb.root,
+		Applied:   sb.applied,
+		Created:   sb.created,
+		LastUsed:  sb.lastUsed,
+	}
+}
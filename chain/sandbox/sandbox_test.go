@@ -0,0 +1,89 @@
+package sandbox
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/builtin/power"
+	"github.com/filecoin-project/specs-actors/actors/builtin/verifreg"
+
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func init() {
+	miner.SupportedProofTypes = map[abi.RegisteredSealProof]struct{}{
+		abi.RegisteredSealProof_StackedDrg2KiBV1: {},
+	}
+	power.ConsensusMinerMinPower = big.NewInt(2048)
+	verifreg.MinVerifiedDealSize = big.NewInt(256)
+}
+
+// TestApplyWhileReading reads the sandbox state while messages are applied to
+// it, run it with -race to check the buffer is synchronized.
+func TestApplyWhileReading(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mts, err := cg.NextTipSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(stmgr.NewStateManager(cg.ChainStore()))
+	if _, err := m.Create(ctx, "test", mts.TipSet.TipSet()); err != nil {
+		t.Fatal(err)
+	}
+
+	to, err := address.NewSecp256k1Address([]byte("sandbox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const rounds = 20
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			if _, err := m.Apply(ctx, "test", []*types.Message{{
+				From:  cg.Banker(),
+				To:    to,
+				Value: types.NewInt(1),
+			}}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < rounds; i++ {
+		if _, err := m.ReadState("test", cg.Banker()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	st, err := m.StateTree("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	act, err := st.GetActor(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !act.Balance.Equals(types.NewInt(rounds)) {
+		t.Fatalf("expected every transfer to be applied, got a balance of %s", act.Balance)
+	}
+}
@@ -0,0 +1,246 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+)
+
+var (
+	// PendingRetry is how long the client waits before asking again for the
+	// manifest of a snapshot the peer is still creating
+	PendingRetry = 30 * time.Second
+	// ChunkAttempts is how many times a chunk is requested before giving up
+	ChunkAttempts = 3
+)
+
+// Client fetches snapshots from trusted peers
+type Client struct {
+	h   host.Host
+	dir string
+}
+
+// NewClient creates a client downloading snapshots into dir
+func NewClient(h host.Host, dir string) *Client {
+	return &Client{h: h, dir: dir}
+}
+
+// Fetch downloads the snapshot served by the peer, resuming a previous
+// download of the same snapshot, and returns the path of the verified file
+// and its manifest.
+func (c *Client) Fetch(ctx context.Context, p peer.ID) (string, *Manifest, error) {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return "", nil, xerrors.Errorf("creating snapshot dir: %w", err)
+	}
+
+	m, err := c.fetchManifest(ctx, p)
+	if err != nil {
+		return "", nil, err
+	}
+	if m.ChunkSize == 0 || m.ChunkSize > ChunkSize || len(m.Digest) != sha256.Size {
+		return "", nil, xerrors.Errorf("peer sent an invalid manifest")
+	}
+
+	name := filepath.Join(c.dir, hex.EncodeToString(m.Digest)+".car")
+	if err := c.removeStale(name, name+".part"); err != nil {
+		return "", nil, err
+	}
+
+	if err := verifyFile(name, m.Digest); err == nil {
+		log.Infow("snapshot was downloaded already", "path", name)
+		return name, m, nil
+	}
+
+	if err := c.download(ctx, p, m, name+".part"); err != nil {
+		return "", nil, err
+	}
+
+	if err := verifyFile(name+".part", m.Digest); err != nil {
+		_ = os.Remove(name + ".part")
+		return "", nil, xerrors.Errorf("verifying snapshot: %w", err)
+	}
+	if err := os.Rename(name+".part", name); err != nil {
+		return "", nil, xerrors.Errorf("moving snapshot file: %w", err)
+	}
+
+	return name, m, nil
+}
+
+func (c *Client) fetchManifest(ctx context.Context, p peer.ID) (*Manifest, error) {
+	for {
+		res, err := c.request(ctx, p, &Request{Op: OpManifest})
+		if err != nil {
+			return nil, xerrors.Errorf("requesting snapshot manifest: %w", err)
+		}
+
+		switch res.Status {
+		case StatusOK:
+			if res.Manifest == nil {
+				return nil, xerrors.Errorf("peer sent no manifest")
+			}
+			return res.Manifest, nil
+		case StatusPending:
+			log.Infow("peer is creating a snapshot, waiting", "peer", p)
+		default:
+			return nil, xerrors.Errorf("requesting snapshot manifest: %s (status %d)", res.Message, res.Status)
+		}
+
+		select {
+		case <-time.After(PendingRetry):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// removeStale removes the downloads of other snapshots, complete or not
+func (c *Client) removeStale(keep ...string) error {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.car*"))
+	if err != nil {
+		return err
+	}
+	kept := map[string]bool{}
+	for _, k := range keep {
+		kept[k] = true
+	}
+	for _, f := range files {
+		if kept[f] {
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			return xerrors.Errorf("removing stale snapshot download: %w", err)
+		}
+	}
+	return nil
+}
+
+// Remove removes a snapshot downloaded with Fetch once it was imported
+func (c *Client) Remove(path string) error {
+	if filepath.Dir(path) != filepath.Clean(c.dir) {
+		return xerrors.Errorf("%s isn't a snapshot downloaded by the client", path)
+	}
+	return os.Remove(path)
+}
+
+func (c *Client) download(ctx context.Context, p peer.ID, m *Manifest, path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return xerrors.Errorf("opening snapshot file: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// resume after the last complete chunk
+	start := uint64(fi.Size()) / m.ChunkSize
+	if err := f.Truncate(int64(start * m.ChunkSize)); err != nil {
+		return xerrors.Errorf("truncating partial chunk: %w", err)
+	}
+	if _, err := f.Seek(int64(start*m.ChunkSize), io.SeekStart); err != nil {
+		return err
+	}
+	if start > 0 {
+		log.Infow("resuming snapshot download", "chunk", start, "chunks", m.Chunks())
+	}
+
+	for i := start; i < m.Chunks(); i++ {
+		data, err := c.fetchChunk(ctx, p, m, i)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return xerrors.Errorf("writing snapshot chunk: %w", err)
+		}
+
+		if i%100 == 0 {
+			log.Infow("downloading snapshot", "chunk", i, "chunks", m.Chunks())
+		}
+	}
+
+	return f.Sync()
+}
+
+func (c *Client) fetchChunk(ctx context.Context, p peer.ID, m *Manifest, i uint64) ([]byte, error) {
+	want := m.ChunkSize
+	if rest := m.Size - i*m.ChunkSize; rest < want {
+		want = rest
+	}
+
+	var err error
+	for a := 0; a < ChunkAttempts; a++ {
+		var res *Response
+		res, err = c.request(ctx, p, &Request{Op: OpChunk, Snapshot: m.Digest, Index: i})
+		switch {
+		case err != nil:
+		case res.Status == StatusNotFound:
+			return nil, xerrors.Errorf("peer no longer serves the snapshot, fetch again to download the new one")
+		case res.Status != StatusOK:
+			err = xerrors.Errorf("%s (status %d)", res.Message, res.Status)
+		case uint64(len(res.Data)) != want:
+			err = xerrors.Errorf("got %d bytes, expected %d", len(res.Data), want)
+		case !bytes.Equal(digest(res.Data), res.Digest):
+			err = xerrors.Errorf("chunk doesn't match its digest")
+		default:
+			return res.Data, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Warnw("fetching snapshot chunk failed", "chunk", i, "attempt", a+1, "error", err)
+	}
+
+	return nil, xerrors.Errorf("fetching chunk %d: %w", i, err)
+}
+
+func (c *Client) request(ctx context.Context, p peer.ID, req *Request) (*Response, error) {
+	s, err := c.h.NewStream(ctx, p, ProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close() //nolint:errcheck
+
+	_ = s.SetDeadline(time.Now().Add(StreamTimeout))
+
+	if err := cborutil.WriteCborRPC(s, req); err != nil {
+		return nil, xerrors.Errorf("writing request: %w", err)
+	}
+
+	var res Response
+	if err := cborutil.ReadCborRPC(bufio.NewReader(s), &res); err != nil {
+		return nil, xerrors.Errorf("reading response: %w", err)
+	}
+	return &res, nil
+}
+
+func verifyFile(path string, d []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return err
+	}
+	if !bytes.Equal(hasher.Sum(nil), d) {
+		return xerrors.Errorf("file doesn't match the snapshot digest")
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package snapshot
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	inet "github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/store"
+)
+
+// ExportLag is how far below the head the exported tipset is, so that
+// snapshots aren't affected by reorgs
+var ExportLag = build.Finality
+
+type served struct {
+	path     string
+	manifest *Manifest
+	created  time.Time
+}
+
+// Server serves snapshots to trusted peers. A snapshot is created when first
+// requested, and replaced by a new one once it's older than maxAge. The
+// previous snapshot is kept, so that downloads in progress can finish.
+type Server struct {
+	ctx context.Context
+	cs  *store.ChainStore
+	dir string
+
+	trusted     map[peer.ID]struct{}
+	recentRoots abi.ChainEpoch
+	maxAge      time.Duration
+
+	lk       sync.Mutex
+	current  *served
+	previous *served
+	building bool
+}
+
+// NewServer creates a server keeping its snapshots in dir. Snapshots left
+// there by a previous run are removed.
+func NewServer(ctx context.Context, cs *store.ChainStore, dir string, trusted []peer.ID, recentRoots abi.ChainEpoch, maxAge time.Duration) (*Server, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, xerrors.Errorf("creating snapshot dir: %w", err)
+	}
+
+	old, err := filepath.Glob(filepath.Join(dir, "*.car*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range old {
+		if err := os.Remove(p); err != nil {
+			return nil, xerrors.Errorf("removing old snapshot: %w", err)
+		}
+	}
+
+	s := &Server{
+		ctx:         ctx,
+		cs:          cs,
+		dir:         dir,
+		trusted:     map[peer.ID]struct{}{},
+		recentRoots: recentRoots,
+		maxAge:      maxAge,
+	}
+	for _, p := range trusted {
+		s.trusted[p] = struct{}{}
+	}
+	return s, nil
+}
+
+func (s *Server) HandleStream(st inet.Stream) {
+	defer st.Close() //nolint:errcheck
+
+	_ = st.SetDeadline(time.Now().Add(StreamTimeout))
+
+	var req Request
+	if err := cborutil.ReadCborRPC(bufio.NewReader(st), &req); err != nil {
+		log.Warnw("failed to read snapshot request", "peer", st.Conn().RemotePeer(), "error", err)
+		return
+	}
+
+	res := s.processRequest(st.Conn().RemotePeer(), &req)
+	if err := cborutil.WriteCborRPC(st, res); err != nil {
+		log.Warnw("failed to write snapshot response", "peer", st.Conn().RemotePeer(), "error", err)
+	}
+}
+
+func (s *Server) processRequest(p peer.ID, req *Request) *Response {
+	if _, ok := s.trusted[p]; !ok {
+		log.Warnw("refusing snapshot request from untrusted peer", "peer", p)
+		return &Response{Status: StatusForbidden, Message: "peer not trusted"}
+	}
+
+	switch req.Op {
+	case OpManifest:
+		m := s.manifest()
+		if m == nil {
+			return &Response{Status: StatusPending, Message: "creating snapshot"}
+		}
+		return &Response{Status: StatusOK, Manifest: m}
+	case OpChunk:
+		data, err := s.chunk(req.Snapshot, req.Index)
+		if err != nil {
+			log.Warnw("reading snapshot chunk", "peer", p, "index", req.Index, "error", err)
+			return &Response{Status: StatusInternalError, Message: err.Error()}
+		}
+		if data == nil {
+			return &Response{Status: StatusNotFound, Message: "snapshot or chunk not found"}
+		}
+		return &Response{Status: StatusOK, Data: data, Digest: digest(data)}
+	default:
+		return &Response{Status: StatusBadRequest, Message: "unknown operation"}
+	}
+}
+
+// manifest returns the manifest of the current snapshot, and starts creating
+// a new one if it's missing or too old
+func (s *Server) manifest() *Manifest {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if (s.current == nil || time.Since(s.current.created) > s.maxAge) && !s.building {
+		s.building = true
+		go s.build()
+	}
+
+	if s.current == nil {
+		return nil
+	}
+	return s.current.manifest
+}
+
+func (s *Server) chunk(snapshot []byte, index uint64) ([]byte, error) {
+	s.lk.Lock()
+	var sv *served
+	for _, c := range []*served{s.current, s.previous} {
+		if c != nil && string(c.manifest.Digest) == string(snapshot) {
+			sv = c
+		}
+	}
+	s.lk.Unlock()
+
+	if sv == nil || index >= sv.manifest.Chunks() {
+		return nil, nil
+	}
+
+	f, err := os.Open(sv.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// replaced in the meantime
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	buf := make([]byte, sv.manifest.ChunkSize)
+	n, err := f.ReadAt(buf, int64(index*sv.manifest.ChunkSize))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func (s *Server) build() {
+	defer func() {
+		s.lk.Lock()
+		s.building = false
+		s.lk.Unlock()
+	}()
+
+	start := time.Now()
+	sv, err := s.export()
+	if err != nil {
+		log.Errorw("creating snapshot failed", "error", err)
+		return
+	}
+	log.Infow("created snapshot", "height", sv.manifest.Height, "size", sv.manifest.Size, "took", time.Since(start))
+
+	s.lk.Lock()
+	old := s.previous
+	s.previous, s.current = s.current, sv
+	s.lk.Unlock()
+
+	if old != nil {
+		if err := os.Remove(old.path); err != nil {
+			log.Warnw("removing old snapshot", "path", old.path, "error", err)
+		}
+	}
+}
+
+func (s *Server) export() (*served, error) {
+	head := s.cs.GetHeaviestTipSet()
+	h := head.Height() - ExportLag
+	if h < 0 {
+		h = 0
+	}
+	ts, err := s.cs.GetTipsetByHeight(s.ctx, h, head, true)
+	if err != nil {
+		return nil, xerrors.Errorf("loading tipset to export: %w", err)
+	}
+
+	f, err := ioutil.TempFile(s.dir, "snapshot-*.car.tmp")
+	if err != nil {
+		return nil, xerrors.Errorf("creating snapshot file: %w", err)
+	}
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	hasher := sha256.New()
+	bw := bufio.NewWriter(f)
+	if err := s.cs.Export(s.ctx, ts, s.recentRoots, true, io.MultiWriter(bw, hasher)); err != nil {
+		return nil, xerrors.Errorf("exporting chain: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, xerrors.Errorf("writing snapshot: %w", err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	d := hasher.Sum(nil)
+	path := filepath.Join(s.dir, hex.EncodeToString(d)+".car")
+	if err := os.Rename(f.Name(), path); err != nil {
+		return nil, xerrors.Errorf("moving snapshot file: %w", err)
+	}
+	f = nil
+
+	return &served{
+		path: path,
+		manifest: &Manifest{
+			TipSet:    ts.Cids(),
+			Height:    ts.Height(),
+			Size:      uint64(fi.Size()),
+			ChunkSize: ChunkSize,
+			Digest:    d,
+		},
+		created: time.Now(),
+	}, nil
+}
@@ -0,0 +1,94 @@
+// Package snapshot implements a protocol for fetching recent chain snapshots
+// directly from trusted peers, e.g. other nodes of an operator's fleet, so
+// that replacement nodes don't need a snapshot file copied to them.
+//
+// Snapshots are CAR files created with ChainStore.Export, including the
+// state of recent tipsets. They're served in chunks, each with its digest,
+// and identified by the digest of the whole file, so that interrupted
+// downloads can be resumed and the result verified before it's imported.
+package snapshot
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+var log = logging.Logger("snapshot")
+
+const ProtocolID = "/fil/snapshot/0.0.1"
+
+// ChunkSize is the size of the chunks snapshots are served in
+const ChunkSize = 1 << 20
+
+// StreamTimeout bounds a single request and its response
+var StreamTimeout = time.Minute
+
+// Request operations
+const (
+	// OpManifest requests the manifest of the snapshot the peer serves
+	OpManifest = uint64(iota)
+	// OpChunk requests a chunk of a snapshot
+	OpChunk
+)
+
+// Response statuses
+const (
+	StatusOK = uint64(iota)
+	// StatusPending means that the peer is creating a snapshot, the request
+	// should be retried later
+	StatusPending
+	// StatusNotFound means that the peer no longer serves the requested
+	// snapshot, or the chunk is out of range
+	StatusNotFound
+	// StatusForbidden means that the peer doesn't trust the requesting peer
+	StatusForbidden
+	StatusInternalError
+	StatusBadRequest
+)
+
+type Request struct {
+	Op uint64
+
+	// Snapshot is the digest of the snapshot a chunk is requested from
+	Snapshot []byte
+	Index    uint64
+}
+
+type Response struct {
+	Status  uint64
+	Message string
+
+	// Manifest is set in responses to manifest requests
+	Manifest *Manifest
+
+	// Data is the requested chunk, and Digest its sha256 digest
+	Data   []byte
+	Digest []byte
+}
+
+// Manifest describes a snapshot
+type Manifest struct {
+	TipSet []cid.Cid
+	Height abi.ChainEpoch
+
+	Size      uint64
+	ChunkSize uint64
+
+	// Digest is the sha256 digest of the snapshot file
+	Digest []byte
+}
+
+// Chunks returns the number of chunks of the snapshot
+func (m *Manifest) Chunks() uint64 {
+	return (m.Size + m.ChunkSize - 1) / m.ChunkSize
+}
+
+func digest(b []byte) []byte {
+	d := sha256.Sum256(b)
+	return d[:]
+}
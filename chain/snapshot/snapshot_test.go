@@ -0,0 +1,201 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+type testSetup struct {
+	dir    string
+	data   []byte
+	server *Server
+	client *Client
+	sh     host.Host
+}
+
+// setup creates a server serving a snapshot of size bytes to the host of
+// the client, and to the untrusted hosts it returns
+func setup(ctx context.Context, t *testing.T, size int, untrusted int) (*testSetup, []host.Host) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mn := mocknet.New(ctx)
+	sh, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var others []host.Host
+	for i := 0; i < untrusted; i++ {
+		h, err := mn.GenPeer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		others = append(others, h)
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(ctx, nil, filepath.Join(dir, "server"), []peer.ID{ch.ID()}, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh.SetStreamHandler(ProtocolID, srv.HandleStream)
+
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	d := digest(data)
+	path := filepath.Join(srv.dir, hex.EncodeToString(d)+".car")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv.current = &served{
+		path: path,
+		manifest: &Manifest{
+			Height:    10,
+			Size:      uint64(size),
+			ChunkSize: ChunkSize,
+			Digest:    d,
+		},
+		created: time.Now(),
+	}
+
+	return &testSetup{
+		dir:    dir,
+		data:   data,
+		server: srv,
+		client: NewClient(ch, filepath.Join(dir, "client")),
+		sh:     sh,
+	}, others
+}
+
+func TestFetch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts, _ := setup(ctx, t, 2*ChunkSize+ChunkSize/2, 0)
+	defer os.RemoveAll(ts.dir) //nolint:errcheck
+
+	// downloads of other snapshots are cleaned up
+	if err := os.MkdirAll(ts.client.dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	stale := []string{
+		filepath.Join(ts.client.dir, "00.car"),
+		filepath.Join(ts.client.dir, "01.car.part"),
+	}
+	for _, p := range stale {
+		if err := ioutil.WriteFile(p, []byte("stale"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, m, err := ts.client.Fetch(ctx, ts.sh.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Height != 10 || m.Chunks() != 3 {
+		t.Fatalf("unexpected manifest: height %d, %d chunks", m.Height, m.Chunks())
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, ts.data) {
+		t.Fatal("fetched snapshot differs from the served one")
+	}
+	for _, p := range stale {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed", p)
+		}
+	}
+
+	if err := ts.client.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.client.Remove(filepath.Join(ts.dir, "other.car")); err == nil {
+		t.Fatal("expected files outside of the snapshot dir not to be removed")
+	}
+}
+
+func TestFetchResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts, _ := setup(ctx, t, 3*ChunkSize, 0)
+	defer os.RemoveAll(ts.dir) //nolint:errcheck
+
+	// a complete chunk, followed by part of a corrupted one
+	part := append([]byte{}, ts.data[:ChunkSize]...)
+	part = append(part, bytes.Repeat([]byte{0xff}, 100)...)
+	if err := os.MkdirAll(ts.client.dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(ts.client.dir, hex.EncodeToString(digest(ts.data))+".car")
+	if err := ioutil.WriteFile(name+".part", part, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, _, err := ts.client.Fetch(ctx, ts.sh.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != name {
+		t.Fatalf("expected the snapshot at %s, got %s", name, path)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, ts.data) {
+		t.Fatal("resumed snapshot differs from the served one")
+	}
+	if _, err := os.Stat(name + ".part"); !os.IsNotExist(err) {
+		t.Fatal("expected the partial download to be moved")
+	}
+}
+
+func TestFetchUntrusted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts, others := setup(ctx, t, ChunkSize, 1)
+	defer os.RemoveAll(ts.dir) //nolint:errcheck
+
+	c := NewClient(others[0], filepath.Join(ts.dir, "untrusted"))
+	if _, _, err := c.Fetch(ctx, ts.sh.ID()); err == nil {
+		t.Fatal("expected an untrusted peer to be refused")
+	}
+
+	// chunks of snapshots which aren't served aren't found
+	res := ts.server.processRequest(ts.client.h.ID(), &Request{Op: OpChunk, Snapshot: digest([]byte("other")), Index: 0})
+	if res.Status != StatusNotFound {
+		t.Fatalf("expected status %d, got %d", StatusNotFound, res.Status)
+	}
+	res = ts.server.processRequest(ts.client.h.ID(), &Request{Op: OpChunk, Snapshot: digest(ts.data), Index: 1})
+	if res.Status != StatusNotFound {
+		t.Fatalf("expected chunks out of range not to be found, got status %d", res.Status)
+	}
+}
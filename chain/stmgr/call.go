@@ -10,6 +10,7 @@ import (
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/chain/vm"
@@ -19,6 +20,81 @@ func (sm *StateManager) CallRaw(ctx context.Context, msg *types.Message, bstate
 	ctx, span := trace.StartSpan(ctx, "statemanager.CallRaw")
 	defer span.End()
 
+	return sm.call(ctx, msg, bstate, r, bheight, false)
+}
+
+func (sm *StateManager) Call(ctx context.Context, msg *types.Message, ts *types.TipSet) (*api.InvocResult, error) {
+	if ts == nil {
+		ts = sm.cs.GetHeaviestTipSet()
+	}
+
+	state := ts.ParentState()
+
+	r := store.NewChainRand(sm.cs, ts.Cids(), ts.Height())
+
+	return sm.CallRaw(ctx, msg, state, r, ts.Height())
+}
+
+// CallWithGas applies the message on the state of the tipset the way it
+// would be applied on chain, charging gas. The message doesn't need to be
+// signed, and isn't modified.
+func (sm *StateManager) CallWithGas(ctx context.Context, msg *types.Message, ts *types.TipSet) (*api.InvocResult, error) {
+	ctx, span := trace.StartSpan(ctx, "statemanager.CallWithGas")
+	defer span.End()
+
+	if ts == nil {
+		ts = sm.cs.GetHeaviestTipSet()
+	}
+
+	msgCopy := *msg
+	msg = &msgCopy
+	if msg.GasLimit == 0 {
+		msg.GasLimit = build.BlockGasLimit
+	}
+
+	r := store.NewChainRand(sm.cs, ts.Cids(), ts.Height())
+
+	return sm.call(ctx, msg, ts.ParentState(), r, ts.Height(), true)
+}
+
+// CallOnTipSet applies the message on the state computed by executing the
+// tipset, the way it would be applied if it was included in the tipset which
+// follows it. Unlike CallWithGas, the messages of the tipset itself are
+// applied before it. The message isn't modified.
+func (sm *StateManager) CallOnTipSet(ctx context.Context, msg *types.Message, ts *types.TipSet) (*api.InvocResult, error) {
+	ctx, span := trace.StartSpan(ctx, "statemanager.CallOnTipSet")
+	defer span.End()
+
+	if ts == nil {
+		ts = sm.cs.GetHeaviestTipSet()
+	}
+
+	st, _, err := sm.TipSetState(ctx, ts)
+	if err != nil {
+		return nil, xerrors.Errorf("computing tipset state: %w", err)
+	}
+	height := ts.Height() + 1
+	st, err = sm.handleStateForks(ctx, st, height, ts.Height())
+	if err != nil {
+		return nil, xerrors.Errorf("running forks: %w", err)
+	}
+
+	msgCopy := *msg
+	msg = &msgCopy
+	if msg.GasLimit == 0 {
+		msg.GasLimit = build.BlockGasLimit
+	}
+
+	r := store.NewChainRand(sm.cs, ts.Cids(), height)
+
+	return sm.call(ctx, msg, st, r, height, true)
+}
+
+// call applies the message on the state with the nonce of the sender, filling
+// in the fields left empty. With chargeGas it's applied the way it would be on
+// chain, and the result splits the gas used; otherwise it's applied as an
+// implicit message, which doesn't use gas.
+func (sm *StateManager) call(ctx context.Context, msg *types.Message, bstate cid.Cid, r vm.Rand, bheight abi.ChainEpoch, chargeGas bool) (*api.InvocResult, error) {
 	vmi, err := vm.NewVM(bstate, bheight, r, sm.cs.Blockstore(), sm.cs.VMSys())
 	if err != nil {
 		return nil, xerrors.Errorf("failed to set up vm: %w", err)
@@ -34,7 +110,7 @@ func (sm *StateManager) CallRaw(ctx context.Context, msg *types.Message, bstate
 		msg.Value = types.NewInt(0)
 	}
 
-	if span.IsRecordingEvents() {
+	if span := trace.FromContext(ctx); span != nil && span.IsRecordingEvents() {
 		span.AddAttributes(
 			trace.Int64Attribute("gas_limit", msg.GasLimit),
 			trace.Int64Attribute("gas_price", int64(msg.GasPrice.Uint64())),
@@ -44,13 +120,18 @@ func (sm *StateManager) CallRaw(ctx context.Context, msg *types.Message, bstate
 
 	fromActor, err := vmi.StateTree().GetActor(msg.From)
 	if err != nil {
-		return nil, xerrors.Errorf("call raw get actor: %s", err)
+		return nil, xerrors.Errorf("getting sender actor: %w", err)
 	}
 
 	msg.Nonce = fromActor.Nonce
 
-	// TODO: maybe just use the invoker directly?
-	ret, err := vmi.ApplyImplicitMessage(ctx, msg)
+	var ret *vm.ApplyRet
+	if chargeGas {
+		ret, err = vmi.ApplyMessage(ctx, msg)
+	} else {
+		// TODO: maybe just use the invoker directly?
+		ret, err = vmi.ApplyImplicitMessage(ctx, msg)
+	}
 	if err != nil {
 		return nil, xerrors.Errorf("apply message failed: %w", err)
 	}
@@ -63,47 +144,41 @@ func (sm *StateManager) CallRaw(ctx context.Context, msg *types.Message, bstate
 
 	return &api.InvocResult{
 		Msg:            msg,
+		MethodName:     InvokedMethodName(vmi.StateTree(), msg),
 		MsgRct:         &ret.MessageReceipt,
+		GasBreakdown:   ret.GasBreakdown,
 		ExecutionTrace: ret.ExecutionTrace,
 		Error:          errs,
 		Duration:       ret.Duration,
 	}, nil
-
-}
-
-func (sm *StateManager) Call(ctx context.Context, msg *types.Message, ts *types.TipSet) (*api.InvocResult, error) {
-	if ts == nil {
-		ts = sm.cs.GetHeaviestTipSet()
-	}
-
-	state := ts.ParentState()
-
-	r := store.NewChainRand(sm.cs, ts.Cids(), ts.Height())
-
-	return sm.CallRaw(ctx, msg, state, r, ts.Height())
 }
 
 var errHaltExecution = fmt.Errorf("halt")
 
-func (sm *StateManager) Replay(ctx context.Context, ts *types.TipSet, mcid cid.Cid) (*types.Message, *vm.ApplyRet, error) {
+// Replay executes the tipset up to the message, and returns its result with
+// the sends it made
+func (sm *StateManager) Replay(ctx context.Context, ts *types.TipSet, mcid cid.Cid) (*types.Message, *vm.ApplyRet, *MessageTrace, error) {
 	var outm *types.Message
 	var outr *vm.ApplyRet
+	var outt MessageTrace
 
+	tracer := &callTreeTracer{}
 	_, _, err := sm.computeTipSetState(ctx, ts.Blocks(), func(c cid.Cid, m *types.Message, ret *vm.ApplyRet) error {
 		if c == mcid {
 			outm = m
 			outr = ret
+			outt = tracer.last
 			return errHaltExecution
 		}
 		return nil
-	})
+	}, tracer)
 	if err != nil && err != errHaltExecution {
-		return nil, nil, xerrors.Errorf("unexpected error during execution: %w", err)
+		return nil, nil, nil, xerrors.Errorf("unexpected error during execution: %w", err)
 	}
 
 	if outr == nil {
-		return nil, nil, xerrors.Errorf("given message not found in tipset")
+		return nil, nil, nil, xerrors.Errorf("given message not found in tipset")
 	}
 
-	return outm, outr, nil
+	return outm, outr, &outt, nil
 }
@@ -0,0 +1,169 @@
+package stmgr_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func TestCallWithGasBreakdown(t *testing.T) {
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last *types.TipSet
+	for i := 0; i < 3; i++ {
+		ts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = ts.TipSet.TipSet()
+	}
+
+	to, err := address.NewSecp256k1Address([]byte("gas breakdown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.TODO()
+	sm := stmgr.NewStateManager(cg.ChainStore())
+
+	expectSum := func(res *api.InvocResult) {
+		t.Helper()
+		if res.GasBreakdown.ComputeGas+res.GasBreakdown.StorageGas != res.MsgRct.GasUsed {
+			t.Fatalf("expected compute gas %d and storage gas %d to add up to the gas used %d",
+				res.GasBreakdown.ComputeGas, res.GasBreakdown.StorageGas, res.MsgRct.GasUsed)
+		}
+	}
+
+	// the transfer creates an account actor, which costs both compute and
+	// storage gas
+	msg := &types.Message{
+		From:  cg.Banker(),
+		To:    to,
+		Value: types.NewInt(1000),
+	}
+	res, err := sm.CallWithGas(ctx, msg, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MsgRct.ExitCode != exitcode.Ok {
+		t.Fatalf("expected the transfer to succeed, got exit code %d: %s", res.MsgRct.ExitCode, res.Error)
+	}
+	if res.GasBreakdown.ComputeGas <= 0 || res.GasBreakdown.StorageGas <= 0 {
+		t.Fatalf("expected both compute and storage gas, got %+v", res.GasBreakdown)
+	}
+	expectSum(res)
+	if msg.GasLimit != 0 || msg.Nonce != 0 {
+		t.Fatal("expected the message not to be modified")
+	}
+
+	// calls which aren't charged gas are applied the same way
+	implicit, err := sm.Call(ctx, &types.Message{From: msg.From, To: msg.To, Value: msg.Value}, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if implicit.MethodName != res.MethodName || implicit.MsgRct.GasUsed != 0 || implicit.GasBreakdown != (types.GasBreakdown{}) {
+		t.Fatalf("expected the implicit call of %q not to use gas, got %q using %d", res.MethodName, implicit.MethodName, implicit.MsgRct.GasUsed)
+	}
+
+	// a message running out of gas uses its whole gas limit
+	limited := *msg
+	limited.GasLimit = res.MsgRct.GasUsed - 1
+	out, err := sm.CallWithGas(ctx, &limited, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.MsgRct.ExitCode != exitcode.SysErrOutOfGas {
+		t.Fatalf("expected the message to run out of gas, got exit code %d", out.MsgRct.ExitCode)
+	}
+	if out.MsgRct.GasUsed != limited.GasLimit {
+		t.Fatalf("expected the gas limit %d to be used, got %d", limited.GasLimit, out.MsgRct.GasUsed)
+	}
+	expectSum(out)
+}
+
+func TestCallOnTipSet(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := cg.Wallet().GenerateKey(crypto.SigTypeBLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the head includes a message, which funds the sender
+	var funded bool
+	cg.GetMessages = func(cg *gen.ChainGen) ([]*types.SignedMessage, error) {
+		if !funded {
+			return nil, nil
+		}
+		msg := types.Message{
+			To:       from,
+			From:     cg.Banker(),
+			Value:    types.NewInt(1000),
+			GasLimit: 1000000,
+			GasPrice: types.NewInt(0),
+		}
+		sig, err := cg.Wallet().Sign(ctx, cg.Banker(), msg.Cid().Bytes())
+		if err != nil {
+			return nil, err
+		}
+		return []*types.SignedMessage{{Message: msg, Signature: *sig}}, nil
+	}
+
+	var head *types.TipSet
+	for i := 0; i < 3; i++ {
+		funded = i == 2
+		ts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		head = ts.TipSet.TipSet()
+	}
+
+	sm := stmgr.NewStateManager(cg.ChainStore())
+	msg := &types.Message{
+		From:  from,
+		To:    cg.Banker(),
+		Value: types.NewInt(10),
+	}
+
+	// the sender doesn't exist in the parent state of the head
+	if _, err := sm.CallWithGas(ctx, msg, head); err == nil {
+		t.Fatal("expected the sender not to exist before the head is executed")
+	}
+
+	res, err := sm.CallOnTipSet(ctx, msg, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MsgRct.ExitCode != exitcode.Ok {
+		t.Fatalf("expected the transfer to succeed on the state of the head, got exit code %d: %s", res.MsgRct.ExitCode, res.Error)
+	}
+	if msg.GasLimit != 0 {
+		t.Fatal("expected the message not to be modified")
+	}
+
+	// more than the head funded
+	msg.Value = types.NewInt(2000)
+	res, err = sm.CallOnTipSet(ctx, msg, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MsgRct.ExitCode == exitcode.Ok {
+		t.Fatal("expected a transfer exceeding the balance to fail")
+	}
+}
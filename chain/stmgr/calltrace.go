@@ -0,0 +1,69 @@
+package stmgr
+
+import (
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/aerrors"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/vm"
+)
+
+// MessageTrace is the tree of sends made by an applied message, with the
+// state roots before and after it was applied
+type MessageTrace struct {
+	Calls           *api.CallTrace
+	StateRootBefore cid.Cid
+	StateRootAfter  cid.Cid
+}
+
+// callTreeTracer builds the MessageTrace of the last message applied
+type callTreeTracer struct {
+	last  MessageTrace
+	stack []*api.CallTrace
+}
+
+var _ vm.ExecutionTracer = (*callTreeTracer)(nil)
+
+func (t *callTreeTracer) StartMessage(msg *types.Message, stateRoot cid.Cid) {
+	t.last = MessageTrace{StateRootBefore: stateRoot}
+	t.stack = t.stack[:0]
+}
+
+func (t *callTreeTracer) EndMessage(ret *vm.ApplyRet, stateRoot cid.Cid) {
+	t.last.StateRootAfter = stateRoot
+}
+
+func (t *callTreeTracer) StartCall(depth int, msg *types.Message, code, head cid.Cid) {
+	ct := &api.CallTrace{
+		From:       msg.From,
+		To:         msg.To,
+		Value:      msg.Value,
+		Method:     msg.Method,
+		Params:     msg.Params,
+		HeadBefore: head,
+	}
+
+	if len(t.stack) > 0 {
+		parent := t.stack[len(t.stack)-1]
+		parent.Subcalls = append(parent.Subcalls, ct)
+	} else {
+		t.last.Calls = ct
+	}
+	t.stack = append(t.stack, ct)
+}
+
+func (t *callTreeTracer) EndCall(depth int, ret []byte, err aerrors.ActorError, gasCharged int64, head cid.Cid) {
+	ct := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+
+	ct.GasCharged = gasCharged
+	ct.ExitCode = aerrors.RetCode(err)
+	ct.Return = ret
+	if err != nil {
+		ct.Error = err.Error()
+	}
+	ct.HeadAfter = head
+}
+
+func (t *callTreeTracer) ChargeGas(name string, gas int64) {}
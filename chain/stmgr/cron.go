@@ -0,0 +1,100 @@
+package stmgr
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/ipfs/go-cid"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/vm"
+	"github.com/filecoin-project/lotus/metrics"
+)
+
+func isCronTick(msg *types.Message) bool {
+	return msg.From == builtin.SystemActorAddr &&
+		msg.To == builtin.CronActorAddr &&
+		msg.Method == builtin.MethodsCron.EpochTick
+}
+
+// CronExecution executes the tipset, and describes the cron tick run at the
+// end of its epoch
+func (sm *StateManager) CronExecution(ctx context.Context, ts *types.TipSet) (*api.CronExecution, error) {
+	if ts.Height() == 0 {
+		return nil, xerrors.Errorf("cron doesn't run at genesis")
+	}
+
+	var out *api.CronExecution
+	_, _, err := sm.computeTipSetState(ctx, ts.Blocks(), func(_ cid.Cid, msg *types.Message, ret *vm.ApplyRet) error {
+		if isCronTick(msg) {
+			out = cronExecution(ts.Height(), ret)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("executing tipset: %w", err)
+	}
+	if out == nil {
+		return nil, xerrors.Errorf("tipset execution didn't run cron")
+	}
+	return out, nil
+}
+
+// recordCron returns an ExecCallback reporting the cron tick of the epoch in
+// metrics, and logging the failed cron tasks
+func recordCron(ctx context.Context, epoch abi.ChainEpoch) ExecCallback {
+	return func(_ cid.Cid, msg *types.Message, ret *vm.ApplyRet) error {
+		if !isCronTick(msg) {
+			return nil
+		}
+
+		ce := cronExecution(epoch, ret)
+		stats.Record(ctx,
+			metrics.CronDurationMs.M(float64(ce.Duration)/float64(time.Millisecond)),
+			metrics.CronGasUsed.M(ce.GasUsed))
+
+		for _, f := range ce.Failures {
+			log.Warnw("cron task failed", "epoch", epoch, "actor", f.Actor, "method", f.Method, "exitcode", f.ExitCode, "error", f.Error)
+			_ = stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(metrics.CronActor, f.Actor.String())}, metrics.CronFailures.M(1))
+		}
+		return nil
+	}
+}
+
+func cronExecution(epoch abi.ChainEpoch, ret *vm.ApplyRet) *api.CronExecution {
+	ce := &api.CronExecution{
+		Epoch:    epoch,
+		Duration: ret.Duration,
+		ExitCode: ret.ExitCode,
+	}
+	// implicit messages don't report the gas they used in their receipt
+	if rct := ret.ExecutionTrace.MsgRct; rct != nil {
+		ce.GasUsed = rct.GasUsed
+	}
+	for i := range ret.ExecutionTrace.Subcalls {
+		ce.Failures = appendCronFailures(ce.Failures, &ret.ExecutionTrace.Subcalls[i])
+	}
+	return ce
+}
+
+func appendCronFailures(out []api.CronFailure, et *types.ExecutionTrace) []api.CronFailure {
+	if et.MsgRct != nil && et.MsgRct.ExitCode != exitcode.Ok {
+		out = append(out, api.CronFailure{
+			Actor:    et.Msg.To,
+			Method:   et.Msg.Method,
+			ExitCode: et.MsgRct.ExitCode,
+			Error:    et.Error,
+		})
+	}
+	for i := range et.Subcalls {
+		out = appendCronFailures(out, &et.Subcalls[i])
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+package stmgr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/alerting"
+)
+
+// UpgradeDryRunFailed is raised when the dry run of an upgrade fails
+const UpgradeDryRunFailed = "upgrade-dry-run-failed"
+
+// DryRunUpgrade runs the state migration scheduled at the given height on the
+// state computed for the tipset, and reports how long it took. The migrated
+// state isn't used for anything, but the objects it's made of are written to
+// the chain blockstore, like they'd be by the upgrade.
+func (sm *StateManager) DryRunUpgrade(ctx context.Context, ts *types.TipSet, height abi.ChainEpoch) (*api.UpgradeDryRun, error) {
+	migrate, ok := ForksAtHeight[height]
+	if !ok {
+		return nil, xerrors.Errorf("no upgrade scheduled at height %d", height)
+	}
+
+	st, _, err := sm.TipSetState(ctx, ts)
+	if err != nil {
+		return nil, xerrors.Errorf("computing state of tipset %s: %w", ts.Key(), err)
+	}
+
+	out := &api.UpgradeDryRun{
+		Height:    height,
+		TipSet:    ts.Key(),
+		Epoch:     ts.Height(),
+		StateRoot: st,
+		Started:   time.Now(),
+	}
+
+	nst, err := migrate(ctx, sm, st)
+	out.Duration = time.Since(out.Started)
+	if err != nil {
+		out.Error = err.Error()
+	} else {
+		out.NewStateRoot = nst
+	}
+
+	return out, nil
+}
+
+// UpgradeDryRunner dry runs every scheduled upgrade once the chain head gets
+// within EpochsBefore epochs of it, so that problems with the migration show
+// up before the upgrade is due. Failures are logged and raised as alerts.
+type UpgradeDryRunner struct {
+	sm           *StateManager
+	al           *alerting.Alerting
+	epochsBefore abi.ChainEpoch
+
+	lk      sync.Mutex
+	started map[abi.ChainEpoch]bool
+	results map[abi.ChainEpoch]*api.UpgradeDryRun
+}
+
+func NewUpgradeDryRunner(sm *StateManager, al *alerting.Alerting, epochsBefore abi.ChainEpoch) *UpgradeDryRunner {
+	return &UpgradeDryRunner{
+		sm:           sm,
+		al:           al,
+		epochsBefore: epochsBefore,
+		started:      map[abi.ChainEpoch]bool{},
+		results:      map[abi.ChainEpoch]*api.UpgradeDryRun{},
+	}
+}
+
+func (r *UpgradeDryRunner) Run(ctx context.Context) {
+	for changes := range r.sm.ChainStore().SubHeadChanges(ctx) {
+		head := changes[len(changes)-1].Val
+
+		for height := range ForksAtHeight {
+			if head.Height() >= height || head.Height()+r.epochsBefore < height {
+				continue
+			}
+
+			r.lk.Lock()
+			started := r.started[height]
+			r.started[height] = true
+			r.lk.Unlock()
+			if started {
+				continue
+			}
+
+			// migrations can take long, don't hold up the head change
+			// notifications meanwhile
+			go r.dryRun(ctx, head, height)
+		}
+	}
+}
+
+func (r *UpgradeDryRunner) dryRun(ctx context.Context, ts *types.TipSet, height abi.ChainEpoch) {
+	log.Infow("dry running upgrade", "height", height, "epoch", ts.Height())
+
+	res, err := r.sm.DryRunUpgrade(ctx, ts, height)
+	if err != nil {
+		res = &api.UpgradeDryRun{
+			Height: height,
+			TipSet: ts.Key(),
+			Epoch:  ts.Height(),
+			Error:  err.Error(),
+		}
+	}
+
+	if res.Error != "" {
+		log.Errorw("upgrade dry run failed", "height", height, "epoch", ts.Height(), "error", res.Error)
+	} else {
+		log.Infow("upgrade dry run succeeded", "height", height, "epoch", ts.Height(), "took", res.Duration)
+	}
+	if r.al != nil {
+		r.al.Set(fmt.Sprintf("%s/%d", UpgradeDryRunFailed, height), res.Error != "",
+			"dry run of the upgrade at height %d failed: %s", height, res.Error)
+	}
+
+	r.lk.Lock()
+	r.results[height] = res
+	r.lk.Unlock()
+}
+
+// Results returns the dry runs done so far, by upgrade height
+func (r *UpgradeDryRunner) Results() []api.UpgradeDryRun {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	out := make([]api.UpgradeDryRun, 0, len(r.results))
+	for _, res := range r.results {
+		out = append(out, *res)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Height < out[j].Height
+	})
+	return out
+}
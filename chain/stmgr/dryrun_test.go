@@ -0,0 +1,108 @@
+package stmgr_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func TestUpgradeDryRun(t *testing.T) {
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := []*types.TipSet{cg.CurTipset.TipSet()}
+	for i := 0; i < 4; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, mts.TipSet.TipSet())
+	}
+
+	// a synthetic migration scheduled right after the generated chain
+	forkHeight := chain[4].Height() + 1
+	var lk sync.Mutex
+	var migrated []cid.Cid
+	var fail bool
+	stmgr.ForksAtHeight[forkHeight] = func(ctx context.Context, sm *stmgr.StateManager, pstate cid.Cid) (cid.Cid, error) {
+		lk.Lock()
+		defer lk.Unlock()
+		migrated = append(migrated, pstate)
+		if fail {
+			return cid.Undef, xerrors.New("migration failed")
+		}
+		return pstate, nil
+	}
+	defer delete(stmgr.ForksAtHeight, forkHeight)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	sm := stmgr.NewStateManager(cg.ChainStore())
+
+	if _, err := sm.DryRunUpgrade(ctx, chain[3], forkHeight+1); err == nil {
+		t.Fatal("expected a dry run without an upgrade at the height to fail")
+	}
+
+	// the upgrade is dry run once the head gets within epochsBefore of it
+	r := stmgr.NewUpgradeDryRunner(sm, nil, forkHeight-chain[3].Height())
+	go r.Run(ctx)
+
+	if err := cg.ChainStore().SetHead(chain[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := cg.ChainStore().SetHead(chain[3]); err != nil {
+		t.Fatal(err)
+	}
+
+	var res []api.UpgradeDryRun
+	for i := 0; i < 100 && len(res) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		res = r.Results()
+	}
+	if len(res) != 1 {
+		t.Fatalf("expected the upgrade to be dry run, got %d results", len(res))
+	}
+
+	st, _, err := sm.TipSetState(ctx, chain[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Height != forkHeight || res[0].TipSet != chain[3].Key() || res[0].Error != "" {
+		t.Fatalf("unexpected dry run result: %+v", res[0])
+	}
+	if res[0].StateRoot != st || res[0].NewStateRoot != st {
+		t.Fatalf("expected the migration to run on the state of the head %s, got %s", st, res[0].StateRoot)
+	}
+
+	// later heads don't dry run the upgrade again
+	if err := cg.ChainStore().SetHead(chain[4]); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	lk.Lock()
+	if len(migrated) != 1 || migrated[0] != st {
+		t.Fatalf("expected the migration to run once, got %v", migrated)
+	}
+	fail = true
+	lk.Unlock()
+
+	// failures are reported in the result
+	out, err := sm.DryRunUpgrade(ctx, chain[4], forkHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Error == "" || out.NewStateRoot.Defined() {
+		t.Fatalf("expected the failure of the migration to be reported, got %+v", out)
+	}
+}
@@ -0,0 +1,154 @@
+package stmgr
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/aerrors"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/vm"
+)
+
+// Gas categories of api.GasProfile
+const (
+	GasCategoryMessage   = "message"
+	GasCategoryActor     = "actor"
+	GasCategoryIpldRead  = "ipld_read"
+	GasCategoryIpldWrite = "ipld_write"
+	GasCategorySyscall   = "syscall"
+)
+
+// gasCategories maps the names of the charges made by the VM to categories,
+// other charges are made by actors, and counted as actor execution
+var gasCategories = map[string]string{
+	"OnChainMessage":             GasCategoryMessage,
+	"OnChainReturnValue":         GasCategoryMessage,
+	"OnIpldGetStart":             GasCategoryIpldRead,
+	"OnIpldGet":                  GasCategoryIpldRead,
+	"OnIpldPut":                  GasCategoryIpldWrite,
+	"OnVerifySignature":          GasCategorySyscall,
+	"OnHashing":                  GasCategorySyscall,
+	"OnComputeUnsealedSectorCid": GasCategorySyscall,
+	"OnVerifySeal":               GasCategorySyscall,
+	"OnVerifyPost":               GasCategorySyscall,
+	"OnVerifyConsensusFault":     GasCategorySyscall,
+}
+
+func gasCategory(name string) string {
+	if c, ok := gasCategories[name]; ok {
+		return c
+	}
+	return GasCategoryActor
+}
+
+// GasTrace executes the tipset, and returns the gas profile of every message
+// it applies
+func (sm *StateManager) GasTrace(ctx context.Context, ts *types.TipSet) ([]*api.GasProfile, error) {
+	tracer := &gasProfileTracer{}
+
+	var out []*api.GasProfile
+	_, _, err := sm.computeTipSetState(ctx, ts.Blocks(), func(c cid.Cid, m *types.Message, ret *vm.ApplyRet) error {
+		p := tracer.last
+		if p == nil {
+			// implicit message
+			return nil
+		}
+		tracer.last = nil
+
+		p.Msg = c
+		p.GasUsed = ret.GasUsed
+		sort.Slice(p.Methods, func(i, j int) bool {
+			return p.Methods[i].Gas > p.Methods[j].Gas
+		})
+		out = append(out, p)
+		return nil
+	}, tracer)
+	if err != nil {
+		return nil, xerrors.Errorf("executing tipset: %w", err)
+	}
+	return out, nil
+}
+
+// gasProfileTracer aggregates the gas charged while applying a message
+type gasProfileTracer struct {
+	cur  *api.GasProfile
+	last *api.GasProfile
+
+	methods map[string]*api.MethodGas
+	// stack holds the methods of the running sends, charges are attributed
+	// to the innermost one
+	stack []*api.MethodGas
+	root  *api.MethodGas
+}
+
+var _ vm.ExecutionTracer = (*gasProfileTracer)(nil)
+
+func (t *gasProfileTracer) StartMessage(msg *types.Message, stateRoot cid.Cid) {
+	t.cur = &api.GasProfile{
+		Categories: map[string]int64{},
+		Charges:    map[string]int64{},
+	}
+	t.methods = map[string]*api.MethodGas{}
+	t.stack = t.stack[:0]
+	t.root = nil
+}
+
+func (t *gasProfileTracer) EndMessage(ret *vm.ApplyRet, stateRoot cid.Cid) {
+	for _, m := range t.methods {
+		t.cur.Methods = append(t.cur.Methods, *m)
+	}
+	t.last = t.cur
+	t.cur = nil
+}
+
+func (t *gasProfileTracer) StartCall(depth int, msg *types.Message, code, head cid.Cid) {
+	if t.cur == nil {
+		return
+	}
+
+	name := "send"
+	if code.Defined() {
+		name = MethodName(code, msg.Method)
+	}
+	m, ok := t.methods[name]
+	if !ok {
+		m = &api.MethodGas{Method: name}
+		t.methods[name] = m
+	}
+	m.Calls++
+
+	if len(t.stack) == 0 {
+		t.root = m
+	}
+	t.stack = append(t.stack, m)
+}
+
+func (t *gasProfileTracer) EndCall(depth int, ret []byte, err aerrors.ActorError, gasCharged int64, head cid.Cid) {
+	if t.cur == nil {
+		return
+	}
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *gasProfileTracer) ChargeGas(name string, gas int64) {
+	if t.cur == nil {
+		return
+	}
+
+	t.cur.Charges[name] += gas
+	t.cur.Categories[gasCategory(name)] += gas
+
+	// charges outside of sends, like for the return value, go to the method
+	// invoked by the message
+	m := t.root
+	if len(t.stack) > 0 {
+		m = t.stack[len(t.stack)-1]
+	}
+	if m != nil {
+		m.Gas += gas
+	}
+}
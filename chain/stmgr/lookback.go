@@ -0,0 +1,291 @@
+package stmgr
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// LookbackCacheEpochs is the number of most recent epochs for which the
+// lookback cache keeps tipset keys and state roots.
+var LookbackCacheEpochs = 2 * abi.ChainEpoch(build.Finality)
+
+// lookbackEntry describes the tipset the node applied at an epoch. As the
+// parent state of a tipset is the result of executing its parent, the entry
+// also records the state computed for the parent tipset.
+type lookbackEntry struct {
+	TipSet types.TipSetKey
+	Parent types.TipSetKey
+
+	ParentState    cid.Cid
+	ParentReceipts cid.Cid
+}
+
+// lookbackCache is an epoch indexed view of the recent history of the heaviest
+// chain. It's kept up to date from head changes, so lookback tipsets and their
+// states can be resolved without walking parents or executing messages.
+//
+// The entries always form a chain: every entry is the parent of the next one
+// above it, missing epochs are null rounds. Entries which don't link up, e.g.
+// persisted ones from before a reorg or a restart, are dropped.
+type lookbackCache struct {
+	lk sync.RWMutex
+	ds datastore.Batching
+
+	entries map[abi.ChainEpoch]*lookbackEntry
+	tail    abi.ChainEpoch
+	head    abi.ChainEpoch
+}
+
+// EnableLookbackCache starts tracking the heaviest chain in an epoch indexed
+// cache of tipsets and their state roots, which speeds up resolving states of
+// recent tipsets, like the ones used for election and randomness lookbacks.
+// Entries are persisted in the given datastore, so that the cache is warm
+// after a restart. Persisted entries are only used when they form the chain of
+// the current head.
+func (sm *StateManager) EnableLookbackCache(ds datastore.Batching) error {
+	lc := &lookbackCache{
+		ds:      ds,
+		entries: map[abi.ChainEpoch]*lookbackEntry{},
+		tail:    -1,
+		head:    -1,
+	}
+
+	if err := lc.load(sm.cs.GetHeaviestTipSet()); err != nil {
+		return xerrors.Errorf("loading lookback cache: %w", err)
+	}
+
+	sm.lookback = lc
+	sm.cs.SubscribeHeadChanges(lc.headChange)
+	return nil
+}
+
+// load loads the persisted entries of the chain of head, and removes the
+// others from the datastore
+func (lc *lookbackCache) load(head *types.TipSet) error {
+	res, err := lc.ds.Query(query.Query{})
+	if err != nil {
+		return err
+	}
+	defer res.Close() //nolint:errcheck
+
+	stored := map[abi.ChainEpoch]*lookbackEntry{}
+	var stale []datastore.Key
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+
+		h, err := strconv.ParseInt(strings.TrimPrefix(r.Key, "/"), 10, 64)
+		if err != nil {
+			log.Warnf("lookback cache: skipping malformed key %q", r.Key)
+			stale = append(stale, datastore.NewKey(r.Key))
+			continue
+		}
+
+		var e lookbackEntry
+		if err := json.Unmarshal(r.Value, &e); err != nil {
+			log.Warnf("lookback cache: skipping malformed entry at epoch %d: %s", h, err)
+			stale = append(stale, datastore.NewKey(r.Key))
+			continue
+		}
+
+		stored[abi.ChainEpoch(h)] = &e
+	}
+
+	if head != nil {
+		if e, ok := stored[head.Height()]; ok && e.TipSet == head.Key() {
+			lc.set(head.Height(), e)
+			delete(stored, head.Height())
+
+			for h := head.Height() - 1; h >= 0 && head.Height()-h < LookbackCacheEpochs; h-- {
+				pe, ok := stored[h]
+				if !ok {
+					continue
+				}
+				if pe.TipSet != e.Parent {
+					break
+				}
+				lc.set(h, pe)
+				delete(stored, h)
+				e = pe
+			}
+		}
+	}
+
+	for h := range stored {
+		stale = append(stale, epochKey(h))
+	}
+	for _, k := range stale {
+		if err := lc.ds.Delete(k); err != nil {
+			return xerrors.Errorf("removing stale entry %s: %w", k, err)
+		}
+	}
+	if len(stale) > 0 {
+		log.Infow("lookback cache: removed entries not on the chain of the head", "entries", len(stale))
+	}
+
+	lc.prune()
+	return nil
+}
+
+func (lc *lookbackCache) headChange(rev, app []*types.TipSet) error {
+	lc.lk.Lock()
+	defer lc.lk.Unlock()
+
+	for _, ts := range rev {
+		h := ts.Height()
+		if e, ok := lc.entries[h]; ok && e.TipSet == ts.Key() {
+			lc.remove(h)
+		}
+	}
+
+	for _, ts := range app {
+		lc.link(ts)
+
+		e := &lookbackEntry{
+			TipSet:         ts.Key(),
+			Parent:         ts.Parents(),
+			ParentState:    ts.ParentState(),
+			ParentReceipts: ts.Blocks()[0].ParentMessageReceipts,
+		}
+
+		lc.set(ts.Height(), e)
+
+		b, err := json.Marshal(e)
+		if err != nil {
+			return xerrors.Errorf("marshaling lookback entry: %w", err)
+		}
+		if err := lc.ds.Put(epochKey(ts.Height()), b); err != nil {
+			log.Warnf("lookback cache: persisting entry at epoch %d: %s", ts.Height(), err)
+		}
+	}
+
+	lc.prune()
+	return nil
+}
+
+// link removes the entries below ts, when the closest one isn't the parent
+// of ts, e.g. when the cache missed head changes
+func (lc *lookbackCache) link(ts *types.TipSet) {
+	for h := ts.Height() - 1; h >= lc.tail && h >= 0; h-- {
+		e, ok := lc.entries[h]
+		if !ok {
+			continue
+		}
+		if e.TipSet == ts.Parents() {
+			return
+		}
+
+		for ; h >= lc.tail; h-- {
+			if _, ok := lc.entries[h]; ok {
+				lc.remove(h)
+			}
+		}
+		lc.tail = -1
+		for h := range lc.entries {
+			if lc.tail < 0 || h < lc.tail {
+				lc.tail = h
+			}
+		}
+		return
+	}
+}
+
+func (lc *lookbackCache) set(h abi.ChainEpoch, e *lookbackEntry) {
+	lc.entries[h] = e
+	if h > lc.head {
+		lc.head = h
+	}
+	if lc.tail < 0 || h < lc.tail {
+		lc.tail = h
+	}
+}
+
+func (lc *lookbackCache) remove(h abi.ChainEpoch) {
+	delete(lc.entries, h)
+	if err := lc.ds.Delete(epochKey(h)); err != nil {
+		log.Warnf("lookback cache: deleting entry at epoch %d: %s", h, err)
+	}
+
+	for lc.head >= 0 && lc.entries[lc.head] == nil {
+		lc.head--
+	}
+}
+
+func (lc *lookbackCache) prune() {
+	for lc.head-lc.tail >= LookbackCacheEpochs {
+		if _, ok := lc.entries[lc.tail]; ok {
+			lc.remove(lc.tail)
+		}
+		lc.tail++
+	}
+}
+
+// tipSetAt returns the key of the tipset on the chain of ts at the given
+// height, or the closest one below it if that round was null. It only answers
+// when ts is on the tracked chain.
+func (lc *lookbackCache) tipSetAt(ts *types.TipSet, h abi.ChainEpoch) (types.TipSetKey, bool) {
+	if lc == nil {
+		return types.EmptyTSK, false
+	}
+
+	lc.lk.RLock()
+	defer lc.lk.RUnlock()
+
+	if e, ok := lc.entries[ts.Height()]; !ok || e.TipSet != ts.Key() {
+		return types.EmptyTSK, false
+	}
+
+	for ; h >= lc.tail; h-- {
+		if e, ok := lc.entries[h]; ok {
+			return e.TipSet, true
+		}
+	}
+
+	return types.EmptyTSK, false
+}
+
+// stateAfter returns the state and receipts roots resulting from executing ts,
+// as recorded in the header of its child on the tracked chain.
+func (lc *lookbackCache) stateAfter(ts *types.TipSet) (cid.Cid, cid.Cid, bool) {
+	if lc == nil {
+		return cid.Undef, cid.Undef, false
+	}
+
+	lc.lk.RLock()
+	defer lc.lk.RUnlock()
+
+	if ts.Height() < lc.tail {
+		return cid.Undef, cid.Undef, false
+	}
+
+	for h := ts.Height() + 1; h <= lc.head; h++ {
+		e, ok := lc.entries[h]
+		if !ok {
+			continue
+		}
+
+		if e.Parent != ts.Key() {
+			break
+		}
+		return e.ParentState, e.ParentReceipts, true
+	}
+
+	return cid.Undef, cid.Undef, false
+}
+
+func epochKey(h abi.ChainEpoch) datastore.Key {
+	return datastore.NewKey(strconv.FormatInt(int64(h), 10))
+}
@@ -0,0 +1,122 @@
+package stmgr
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+func newTestLookbackCache(t *testing.T, ds datastore.Batching, head *types.TipSet) *lookbackCache {
+	lc := &lookbackCache{
+		ds:      ds,
+		entries: map[abi.ChainEpoch]*lookbackEntry{},
+		tail:    -1,
+		head:    -1,
+	}
+	if err := lc.load(head); err != nil {
+		t.Fatal(err)
+	}
+	return lc
+}
+
+// testChain returns a chain of n tipsets on top of parent
+func testChain(parent *types.TipSet, n int, nonce uint64) []*types.TipSet {
+	var out []*types.TipSet
+	for i := 0; i < n; i++ {
+		parent = mock.TipSet(mock.MkBlock(parent, 1, nonce))
+		out = append(out, parent)
+	}
+	return out
+}
+
+func TestLookbackCacheRestart(t *testing.T) {
+	gen := mock.TipSet(mock.MkBlock(nil, 1, 0))
+	a := testChain(gen, 3, 1)
+	b := testChain(a[0], 3, 2)
+
+	ds := datastore.NewMapDatastore()
+	lc := newTestLookbackCache(t, ds, nil)
+	if err := lc.headChange(nil, append([]*types.TipSet{gen}, a...)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restart on the same head keeps the entries
+	lc = newTestLookbackCache(t, ds, a[2])
+	if k, ok := lc.tipSetAt(a[2], 1); !ok || k != a[0].Key() {
+		t.Fatalf("expected %s at epoch 1, got %s (%t)", a[0].Key(), k, ok)
+	}
+	if st, _, ok := lc.stateAfter(a[1]); !ok || st != a[2].ParentState() {
+		t.Fatal("expected the state after a[1] to be cached")
+	}
+
+	// the node restarted on another fork, the persisted entries are stale
+	lc = newTestLookbackCache(t, ds, b[2])
+	if len(lc.entries) != 0 {
+		t.Fatalf("expected the entries of the other fork to be dropped, got %d", len(lc.entries))
+	}
+	if _, ok := lc.tipSetAt(b[2], 1); ok {
+		t.Fatal("expected no answer for a tipset not on the cached chain")
+	}
+	res, err := ds.Query(query.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := res.Rest(); len(stored) != 0 {
+		t.Fatalf("expected the stale entries to be removed from the datastore, %d are left", len(stored))
+	}
+}
+
+func TestLookbackCacheGaps(t *testing.T) {
+	gen := mock.TipSet(mock.MkBlock(nil, 1, 0))
+	a := testChain(gen, 3, 1)
+	b := testChain(a[0], 4, 2)
+
+	ds := datastore.NewMapDatastore()
+	lc := newTestLookbackCache(t, ds, nil)
+	if err := lc.headChange(nil, append([]*types.TipSet{gen}, a...)); err != nil {
+		t.Fatal(err)
+	}
+
+	// an entry which wasn't persisted isn't taken for a null round
+	if err := ds.Delete(epochKey(a[1].Height())); err != nil {
+		t.Fatal(err)
+	}
+	lc = newTestLookbackCache(t, ds, a[2])
+	if _, ok := lc.tipSetAt(a[2], a[1].Height()); ok {
+		t.Fatal("expected no answer below a missing entry")
+	}
+
+	// the cache missed the reorg to b, applying the next tipset drops the
+	// entries it doesn't link up with
+	lc = newTestLookbackCache(t, ds, nil)
+	if err := lc.headChange(nil, append([]*types.TipSet{gen}, a...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := lc.headChange(nil, b[3:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lc.tipSetAt(b[3], a[1].Height()); ok {
+		t.Fatal("expected the entries of the other fork not to be used")
+	}
+
+	// reorgs the cache sees replace the entries
+	lc = newTestLookbackCache(t, ds, nil)
+	if err := lc.headChange(nil, append([]*types.TipSet{gen}, a...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := lc.headChange([]*types.TipSet{a[2], a[1]}, b); err != nil {
+		t.Fatal(err)
+	}
+	if k, ok := lc.tipSetAt(b[3], b[0].Height()); !ok || k != b[0].Key() {
+		t.Fatalf("expected %s, got %s (%t)", b[0].Key(), k, ok)
+	}
+	if k, ok := lc.tipSetAt(b[3], a[0].Height()); !ok || k != a[0].Key() {
+		t.Fatalf("expected the common ancestor %s, got %s (%t)", a[0].Key(), k, ok)
+	}
+}
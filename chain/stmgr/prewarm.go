@@ -0,0 +1,79 @@
+package stmgr
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// Prewarm loads the state of the given actors at the tipset into the
+// blockstore caches, so that the first state queries after sync don't have to
+// hit cold storage. Along with the state tree root, each actor's state head is
+// loaded together with the IPLD nodes up to depth links below it, which
+// covers the top levels of the HAMTs and AMTs actors keep their data in.
+//
+// It returns the number of blocks loaded.
+func (sm *StateManager) Prewarm(ctx context.Context, ts *types.TipSet, actors []address.Address, depth int) (int, error) {
+	seen := cid.NewSet()
+
+	n, err := sm.prewarmLinks(ctx, sm.parentState(ts), depth, seen)
+	if err != nil {
+		return n, xerrors.Errorf("prewarming state root: %w", err)
+	}
+
+	for _, a := range actors {
+		act, err := sm.GetActor(a, ts)
+		if err != nil {
+			log.Warnf("prewarm: loading actor %s: %s", a, err)
+			continue
+		}
+
+		an, err := sm.prewarmLinks(ctx, act.Head, depth, seen)
+		n += an
+		if err != nil {
+			return n, xerrors.Errorf("prewarming state of %s: %w", a, err)
+		}
+	}
+
+	return n, nil
+}
+
+func (sm *StateManager) prewarmLinks(ctx context.Context, c cid.Cid, depth int, seen *cid.Set) (int, error) {
+	if depth < 0 || !seen.Visit(c) {
+		return 0, nil
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	blk, err := sm.cs.Blockstore().Get(c)
+	if err != nil {
+		return 0, xerrors.Errorf("getting %s: %w", c, err)
+	}
+	n := 1
+
+	if c.Prefix().Codec != cid.DagCBOR || depth == 0 {
+		return n, nil
+	}
+
+	links, err := cbg.ScanForLinks(bytes.NewReader(blk.RawData()))
+	if err != nil {
+		return n, xerrors.Errorf("scanning %s for links: %w", c, err)
+	}
+
+	for _, l := range links {
+		ln, err := sm.prewarmLinks(ctx, l, depth-1, seen)
+		n += ln
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,68 @@
+package stmgr_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+)
+
+func TestPrewarm(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mts, err := cg.NextTipSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := mts.TipSet.TipSet()
+	sm := stmgr.NewStateManager(cg.ChainStore())
+
+	missing, err := address.NewIDAddress(9999)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prewarm := func(depth int, actors ...address.Address) int {
+		t.Helper()
+		n, err := sm.Prewarm(ctx, ts, actors, depth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// only the state root
+	if n := prewarm(0); n != 1 {
+		t.Fatalf("expected the state root to be loaded, got %d blocks", n)
+	}
+	// plus the state heads, missing actors are skipped
+	if n := prewarm(0, builtin.StoragePowerActorAddr, missing, builtin.StorageMarketActorAddr); n != 3 {
+		t.Fatalf("expected the state root and two state heads to be loaded, got %d blocks", n)
+	}
+	// blocks are only loaded once
+	if n := prewarm(0, builtin.StoragePowerActorAddr, builtin.StoragePowerActorAddr); n != 2 {
+		t.Fatalf("expected the state root and one state head to be loaded, got %d blocks", n)
+	}
+
+	shallow := prewarm(1, builtin.StoragePowerActorAddr)
+	deep := prewarm(2, builtin.StoragePowerActorAddr)
+	if shallow <= 2 || deep <= shallow {
+		t.Fatalf("expected more blocks to be loaded at each depth, got %d and %d", shallow, deep)
+	}
+
+	// prewarming stops once the node shuts down
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := sm.Prewarm(cctx, ts, []address.Address{builtin.StoragePowerActorAddr}, 2); !xerrors.Is(err, context.Canceled) {
+		t.Fatalf("expected prewarming to be cancelled, got %v", err)
+	}
+}
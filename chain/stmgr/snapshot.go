@@ -0,0 +1,143 @@
+package stmgr
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	car "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/multiformats/go-multihash"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// StateSnapshot writes the state tree of the tipset, with the state of all
+// actors, as a CAR with the state root as its only root. The state is the one
+// resulting from the execution of the tipset, which is computed if needed.
+// Objects are written in the order of a depth first walk following links in
+// order, so the output only depends on the state.
+func (sm *StateManager) StateSnapshot(ctx context.Context, tsk types.TipSetKey, w io.Writer) error {
+	ts, err := sm.cs.GetTipSetFromKey(tsk)
+	if err != nil {
+		return xerrors.Errorf("loading tipset %s: %w", tsk, err)
+	}
+	root, _, err := sm.TipSetState(ctx, ts)
+	if err != nil {
+		return xerrors.Errorf("computing tipset state: %w", err)
+	}
+
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root}, Version: 1}, w); err != nil {
+		return xerrors.Errorf("writing car header: %w", err)
+	}
+
+	bs := sm.cs.Blockstore()
+	return walkState(ctx, root, func(c cid.Cid) ([]byte, error) {
+		data, err := bs.Get(c)
+		if err != nil {
+			return nil, xerrors.Errorf("getting state object %s: %w", c, err)
+		}
+		if err := carutil.LdWrite(w, c.Bytes(), data.RawData()); err != nil {
+			return nil, xerrors.Errorf("writing state object: %w", err)
+		}
+		return data.RawData(), nil
+	})
+}
+
+// snapshotImportBatch is how many state objects are copied into the chain
+// blockstore at once
+const snapshotImportBatch = 1024
+
+// ImportStateSnapshot imports a snapshot written by StateSnapshot, and returns
+// its state root. The snapshot is loaded into tmp, and only copied into the
+// chain blockstore once the state tree was found to be complete.
+func (sm *StateManager) ImportStateSnapshot(ctx context.Context, r io.Reader, tmp blockstore.Blockstore) (cid.Cid, error) {
+	header, err := car.LoadCar(tmp, r)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("loading state snapshot: %w", err)
+	}
+	if len(header.Roots) != 1 {
+		return cid.Undef, xerrors.Errorf("expected a state snapshot with one root, got %d", len(header.Roots))
+	}
+	root := header.Roots[0]
+
+	if err := walkState(ctx, root, func(c cid.Cid) ([]byte, error) {
+		data, err := tmp.Get(c)
+		if err == blockstore.ErrNotFound {
+			return nil, xerrors.Errorf("state object %s missing from snapshot", c)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return data.RawData(), nil
+	}); err != nil {
+		return cid.Undef, xerrors.Errorf("checking imported state: %w", err)
+	}
+
+	bs := sm.cs.Blockstore()
+	batch := make([]block.Block, 0, snapshotImportBatch)
+	if err := walkState(ctx, root, func(c cid.Cid) ([]byte, error) {
+		data, err := tmp.Get(c)
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, data)
+		if len(batch) == cap(batch) {
+			if err := bs.PutMany(batch); err != nil {
+				return nil, xerrors.Errorf("writing state objects: %w", err)
+			}
+			batch = batch[:0]
+		}
+		return data.RawData(), nil
+	}); err != nil {
+		return cid.Undef, xerrors.Errorf("copying imported state: %w", err)
+	}
+	if err := bs.PutMany(batch); err != nil {
+		return cid.Undef, xerrors.Errorf("writing state objects: %w", err)
+	}
+
+	return root, nil
+}
+
+// walkState visits the objects of the dag below root, depth first, following
+// links in order. Identity hashed objects, like actor code cids, are skipped.
+// visit returns the data of the object, links of cbor objects are followed.
+func walkState(ctx context.Context, root cid.Cid, visit func(cid.Cid) ([]byte, error)) error {
+	seen := cid.NewSet()
+
+	var walk func(c cid.Cid) error
+	walk = func(c cid.Cid) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if c.Prefix().MhType == multihash.IDENTITY || !seen.Visit(c) {
+			return nil
+		}
+
+		data, err := visit(c)
+		if err != nil {
+			return err
+		}
+		if c.Prefix().Codec != cid.DagCBOR {
+			return nil
+		}
+
+		links, err := cbg.ScanForLinks(bytes.NewReader(data))
+		if err != nil {
+			return xerrors.Errorf("scanning for links failed: %w", err)
+		}
+		for _, l := range links {
+			if err := walk(l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return walk(root)
+}
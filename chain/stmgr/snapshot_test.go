@@ -0,0 +1,88 @@
+package stmgr_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/state"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func TestStateSnapshot(t *testing.T) {
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last *types.TipSet
+	for i := 0; i < 5; i++ {
+		ts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = ts.TipSet.TipSet()
+	}
+
+	ctx := context.TODO()
+	sm := stmgr.NewStateManager(cg.ChainStore())
+	root, _, err := sm.TipSetState(ctx, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var snap, again bytes.Buffer
+	if err := sm.StateSnapshot(ctx, last.Key(), &snap); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.StateSnapshot(ctx, last.Key(), &again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(snap.Bytes(), again.Bytes()) {
+		t.Fatal("snapshots of the same state differ")
+	}
+
+	newStateManager := func() (*stmgr.StateManager, blockstore.Blockstore) {
+		bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+		return stmgr.NewStateManager(store.NewChainStore(bs, datastore.NewMapDatastore(), nil)), bs
+	}
+	tmp := func() blockstore.Blockstore {
+		return blockstore.NewBlockstore(datastore.NewMapDatastore())
+	}
+
+	// incomplete snapshots aren't imported
+	ism, ibs := newStateManager()
+	truncated := snap.Bytes()[:snap.Len()/2]
+	if _, err := ism.ImportStateSnapshot(ctx, bytes.NewReader(truncated), tmp()); err == nil {
+		t.Fatal("expected a truncated snapshot to be refused")
+	}
+	if has, err := ibs.Has(root); err != nil || has {
+		t.Fatalf("expected nothing to be written to the chain blockstore (%v)", err)
+	}
+
+	imported, err := ism.ImportStateSnapshot(ctx, bytes.NewReader(snap.Bytes()), tmp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != root {
+		t.Fatalf("expected the state root of the tipset %s, got %s", root, imported)
+	}
+	if has, err := ibs.Has(root); err != nil || !has {
+		t.Fatalf("expected the state to be in the chain blockstore (%v)", err)
+	}
+
+	st, err := state.LoadStateTree(cbor.NewCborStore(ibs), imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetActor(cg.Banker()); err != nil {
+		t.Fatalf("expected the actors to be imported: %s", err)
+	}
+}
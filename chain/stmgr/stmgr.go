@@ -18,7 +18,6 @@ import (
 	"github.com/filecoin-project/specs-actors/actors/builtin"
 	"github.com/filecoin-project/specs-actors/actors/builtin/market"
 	"github.com/filecoin-project/specs-actors/actors/builtin/reward"
-	"github.com/filecoin-project/specs-actors/actors/runtime"
 	"github.com/filecoin-project/specs-actors/actors/util/adt"
 	cbg "github.com/whyrusleeping/cbor-gen"
 	"golang.org/x/xerrors"
@@ -39,7 +38,12 @@ type StateManager struct {
 	stCache  map[string][]cid.Cid
 	compWait map[string]chan struct{}
 	stlk     sync.Mutex
-	newVM    func(cid.Cid, abi.ChainEpoch, vm.Rand, blockstore.Blockstore, runtime.Syscalls) (*vm.VM, error)
+	newVM    func(cid.Cid, abi.ChainEpoch, vm.Rand, blockstore.Blockstore, vm.Syscalls) (*vm.VM, error)
+
+	lookback *lookbackCache
+
+	msgIndexLk sync.RWMutex
+	msgIndex   MsgIndex
 }
 
 func NewStateManager(cs *store.ChainStore) *StateManager {
@@ -66,6 +70,11 @@ func (sm *StateManager) TipSetState(ctx context.Context, ts *types.TipSet) (st c
 		span.AddAttributes(trace.StringAttribute("tipset", fmt.Sprint(ts.Cids())))
 	}
 
+	if st, rec, ok := sm.lookback.stateAfter(ts); ok {
+		span.AddAttributes(trace.BoolAttribute("lookbackCache", true))
+		return st, rec, nil
+	}
+
 	ck := cidsToKey(ts.Cids())
 	sm.stlk.Lock()
 	cw, cwok := sm.compWait[ck]
@@ -108,7 +117,7 @@ func (sm *StateManager) TipSetState(ctx context.Context, ts *types.TipSet) (st c
 		return ts.Blocks()[0].ParentStateRoot, ts.Blocks()[0].ParentMessageReceipts, nil
 	}
 
-	st, rec, err = sm.computeTipSetState(ctx, ts.Blocks(), nil)
+	st, rec, err = sm.computeTipSetState(ctx, ts.Blocks(), recordCron(ctx, ts.Height()), nil)
 	if err != nil {
 		return cid.Undef, cid.Undef, err
 	}
@@ -116,12 +125,18 @@ func (sm *StateManager) TipSetState(ctx context.Context, ts *types.TipSet) (st c
 	return st, rec, nil
 }
 
+// RecomputeTipSetState executes the tipset, bypassing the state caches
+func (sm *StateManager) RecomputeTipSetState(ctx context.Context, ts *types.TipSet) (cid.Cid, cid.Cid, error) {
+	return sm.computeTipSetState(ctx, ts.Blocks(), nil, nil)
+}
+
 func (sm *StateManager) ExecutionTrace(ctx context.Context, ts *types.TipSet) (cid.Cid, []*api.InvocResult, error) {
 	var trace []*api.InvocResult
 	st, _, err := sm.computeTipSetState(ctx, ts.Blocks(), func(mcid cid.Cid, msg *types.Message, ret *vm.ApplyRet) error {
 		ir := &api.InvocResult{
 			Msg:            msg,
 			MsgRct:         &ret.MessageReceipt,
+			GasBreakdown:   ret.GasBreakdown,
 			ExecutionTrace: ret.ExecutionTrace,
 			Duration:       ret.Duration,
 		}
@@ -130,7 +145,7 @@ func (sm *StateManager) ExecutionTrace(ctx context.Context, ts *types.TipSet) (c
 		}
 		trace = append(trace, ir)
 		return nil
-	})
+	}, nil)
 	if err != nil {
 		return cid.Undef, nil, err
 	}
@@ -148,10 +163,15 @@ type BlockMessages struct {
 type ExecCallback func(cid.Cid, *types.Message, *vm.ApplyRet) error
 
 func (sm *StateManager) ApplyBlocks(ctx context.Context, pstate cid.Cid, bms []BlockMessages, epoch abi.ChainEpoch, r vm.Rand, cb ExecCallback) (cid.Cid, cid.Cid, error) {
+	return sm.applyBlocks(ctx, pstate, bms, epoch, r, cb, nil)
+}
+
+func (sm *StateManager) applyBlocks(ctx context.Context, pstate cid.Cid, bms []BlockMessages, epoch abi.ChainEpoch, r vm.Rand, cb ExecCallback, tracer vm.ExecutionTracer) (cid.Cid, cid.Cid, error) {
 	vmi, err := sm.newVM(pstate, epoch, r, sm.cs.Blockstore(), sm.cs.VMSys())
 	if err != nil {
 		return cid.Undef, cid.Undef, xerrors.Errorf("instantiating VM failed: %w", err)
 	}
+	vmi.SetTracer(tracer)
 
 	var receipts []cbg.CBORMarshaler
 	processedMsgs := map[cid.Cid]bool{}
@@ -265,7 +285,8 @@ func (sm *StateManager) ApplyBlocks(ctx context.Context, pstate cid.Cid, bms []B
 	return st, rectroot, nil
 }
 
-func (sm *StateManager) computeTipSetState(ctx context.Context, blks []*types.BlockHeader, cb ExecCallback) (cid.Cid, cid.Cid, error) {
+// computeTipSetState executes the blocks, tracer is optional
+func (sm *StateManager) computeTipSetState(ctx context.Context, blks []*types.BlockHeader, cb ExecCallback, tracer vm.ExecutionTracer) (cid.Cid, cid.Cid, error) {
 	ctx, span := trace.StartSpan(ctx, "computeTipSetState")
 	defer span.End()
 
@@ -324,7 +345,7 @@ func (sm *StateManager) computeTipSetState(ctx context.Context, blks []*types.Bl
 		blkmsgs = append(blkmsgs, bm)
 	}
 
-	return sm.ApplyBlocks(ctx, pstate, blkmsgs, blks[0].Height, r, cb)
+	return sm.applyBlocks(ctx, pstate, blkmsgs, blks[0].Height, r, cb, tracer)
 }
 
 func (sm *StateManager) parentState(ts *types.TipSet) cid.Cid {
@@ -618,7 +639,33 @@ func (sm *StateManager) SearchForMessage(ctx context.Context, mcid cid.Cid) (*ty
 	return fts, r, nil
 }
 
+// MsgIndex finds the tipsets messages were executed in without walking the
+// chain, see the msgindex package
+type MsgIndex interface {
+	Lookup(ctx context.Context, m cid.Cid, head *types.TipSet) (*types.TipSet, *types.MessageReceipt, error)
+}
+
+// SetMsgIndex makes message searches consult the index before walking back
+// through the chain.
+func (sm *StateManager) SetMsgIndex(ix MsgIndex) {
+	sm.msgIndexLk.Lock()
+	defer sm.msgIndexLk.Unlock()
+	sm.msgIndex = ix
+}
+
 func (sm *StateManager) searchBackForMsg(ctx context.Context, from *types.TipSet, m types.ChainMsg) (*types.TipSet, *types.MessageReceipt, error) {
+	sm.msgIndexLk.RLock()
+	ix := sm.msgIndex
+	sm.msgIndexLk.RUnlock()
+
+	if ix != nil {
+		ts, r, err := ix.Lookup(ctx, m.Cid(), from)
+		if err != nil {
+			log.Warnf("looking up message %s in the index: %s", m.Cid(), err)
+		} else if ts != nil {
+			return ts, r, nil
+		}
+	}
 
 	cur := from
 	for {
@@ -813,6 +860,6 @@ func (sm *StateManager) ValidateChain(ctx context.Context, ts *types.TipSet) err
 	return nil
 }
 
-func (sm *StateManager) SetVMConstructor(nvm func(cid.Cid, abi.ChainEpoch, vm.Rand, blockstore.Blockstore, runtime.Syscalls) (*vm.VM, error)) {
+func (sm *StateManager) SetVMConstructor(nvm func(cid.Cid, abi.ChainEpoch, vm.Rand, blockstore.Blockstore, vm.Syscalls) (*vm.VM, error)) {
 	sm.newVM = nvm
 }
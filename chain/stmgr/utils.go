@@ -3,8 +3,10 @@ package stmgr
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"os"
 	"reflect"
+	"sort"
 
 	cid "github.com/ipfs/go-cid"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
@@ -433,44 +435,72 @@ func LoadSectorsFromSet(ctx context.Context, bs blockstore.Blockstore, ssc cid.C
 	return sset, nil
 }
 
-func ComputeState(ctx context.Context, sm *StateManager, height abi.ChainEpoch, msgs []*types.Message, ts *types.TipSet) (cid.Cid, []*api.InvocResult, error) {
+// ComputeState applies the messages, in order, on the state resulting from
+// the execution of the tipset, as though the VM were at the given height. It
+// returns the resulting state root, the execution trace of the tipset, and
+// the results of the given messages. Nothing is sent to the network, the
+// messages don't need to be signed.
+func ComputeState(ctx context.Context, sm *StateManager, height abi.ChainEpoch, msgs []*types.Message, ts *types.TipSet) (cid.Cid, []*api.InvocResult, []*api.InvocResult, error) {
 	if ts == nil {
 		ts = sm.cs.GetHeaviestTipSet()
 	}
 
 	base, trace, err := sm.ExecutionTrace(ctx, ts)
 	if err != nil {
-		return cid.Undef, nil, err
+		return cid.Undef, nil, nil, err
 	}
 
 	fstate, err := sm.handleStateForks(ctx, base, height, ts.Height())
 	if err != nil {
-		return cid.Undef, nil, err
+		return cid.Undef, nil, nil, err
 	}
 
 	r := store.NewChainRand(sm.cs, ts.Cids(), height)
 	vmi, err := vm.NewVM(fstate, height, r, sm.cs.Blockstore(), sm.cs.VMSys())
 	if err != nil {
-		return cid.Undef, nil, err
+		return cid.Undef, nil, nil, err
 	}
 
+	applied := make([]*api.InvocResult, 0, len(msgs))
 	for i, msg := range msgs {
+		if msg.GasPrice == types.EmptyInt {
+			msg.GasPrice = types.NewInt(0)
+		}
+		if msg.Value == types.EmptyInt {
+			msg.Value = types.NewInt(0)
+		}
+
+		method := InvokedMethodName(vmi.StateTree(), msg)
+
 		// TODO: Use the signed message length for secp messages
 		ret, err := vmi.ApplyMessage(ctx, msg)
 		if err != nil {
-			return cid.Undef, nil, xerrors.Errorf("applying message %s: %w", msg.Cid(), err)
+			return cid.Undef, nil, nil, xerrors.Errorf("applying message %s: %w", msg.Cid(), err)
+		}
+
+		ir := &api.InvocResult{
+			Msg:            msg,
+			MethodName:     method,
+			MsgRct:         &ret.MessageReceipt,
+			GasBreakdown:   ret.GasBreakdown,
+			ExecutionTrace: ret.ExecutionTrace,
+			Duration:       ret.Duration,
+		}
+		if ret.ActorErr != nil {
+			ir.Error = ret.ActorErr.Error()
 		}
 		if ret.ExitCode != 0 {
 			log.Infof("compute state apply message %d failed (exit: %d): %s", i, ret.ExitCode, ret.ActorErr)
 		}
+		applied = append(applied, ir)
 	}
 
 	root, err := vmi.Flush(ctx)
 	if err != nil {
-		return cid.Undef, nil, err
+		return cid.Undef, nil, nil, err
 	}
 
-	return root, trace, nil
+	return root, trace, applied, nil
 }
 
 func GetProvingSetRaw(ctx context.Context, sm *StateManager, mas miner.State) ([]*api.ChainSectorInfo, error) {
@@ -498,6 +528,14 @@ func GetLookbackTipSetForRound(ctx context.Context, sm *StateManager, ts *types.
 		return ts, nil
 	}
 
+	if tsk, ok := sm.lookback.tipSetAt(ts, lbr); ok {
+		lbts, err := sm.ChainStore().LoadTipSet(tsk)
+		if err == nil {
+			return lbts, nil
+		}
+		log.Warnf("loading cached lookback tipset: %s", err)
+	}
+
 	lbts, err := sm.ChainStore().GetTipsetByHeight(ctx, lbr, ts, true)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to get lookback tipset: %w", err)
@@ -586,14 +624,32 @@ func MinerGetBaseInfo(ctx context.Context, sm *StateManager, bcn beacon.RandomBe
 	}, nil
 }
 
-type methodMeta struct {
+type MethodMeta struct {
 	Name string
 
 	Params reflect.Type
 	Ret    reflect.Type
 }
 
-var MethodsMap = map[cid.Cid][]methodMeta{}
+// MethodsMap holds the methods of built-in actors, indexed by actor code and
+// method number
+var MethodsMap = map[cid.Cid][]MethodMeta{}
+
+// ActorNames maps built-in actor codes to short actor names, as used in
+// method names like miner.SubmitWindowedPoSt
+var ActorNames = map[cid.Cid]string{
+	builtin.SystemActorCodeID:           "system",
+	builtin.InitActorCodeID:             "init",
+	builtin.CronActorCodeID:             "cron",
+	builtin.AccountActorCodeID:          "account",
+	builtin.StoragePowerActorCodeID:     "power",
+	builtin.StorageMinerActorCodeID:     "miner",
+	builtin.StorageMarketActorCodeID:    "market",
+	builtin.PaymentChannelActorCodeID:   "paych",
+	builtin.MultisigActorCodeID:         "multisig",
+	builtin.RewardActorCodeID:           "reward",
+	builtin.VerifiedRegistryActorCodeID: "verifreg",
+}
 
 func init() {
 	cidToMethods := map[cid.Cid][2]interface{}{
@@ -614,7 +670,7 @@ func init() {
 		rt := reflect.TypeOf(m[0])
 		nf := rt.NumField()
 
-		MethodsMap[c] = append(MethodsMap[c], methodMeta{
+		MethodsMap[c] = append(MethodsMap[c], MethodMeta{
 			Name:   "Send",
 			Params: reflect.TypeOf(new(adt.EmptyValue)),
 			Ret:    reflect.TypeOf(new(adt.EmptyValue)),
@@ -624,7 +680,7 @@ func init() {
 		for i := 0; i < nf; i++ {
 			export := reflect.TypeOf(exports[i+1])
 
-			MethodsMap[c] = append(MethodsMap[c], methodMeta{
+			MethodsMap[c] = append(MethodsMap[c], MethodMeta{
 				Name:   rt.Field(i).Name,
 				Params: export.In(1),
 				Ret:    export.Out(0),
@@ -633,6 +689,99 @@ func init() {
 	}
 }
 
+// LookupMethod returns the metadata of a built-in actor method.
+func LookupMethod(code cid.Cid, method abi.MethodNum) (MethodMeta, bool) {
+	methods := MethodsMap[code]
+	if uint64(method) >= uint64(len(methods)) {
+		return MethodMeta{}, false
+	}
+
+	return methods[method], true
+}
+
+// MethodName returns a human readable name of an actor method, like
+// miner.SubmitWindowedPoSt. Methods of unknown actors are named after the
+// actor code and method number.
+func MethodName(code cid.Cid, method abi.MethodNum) string {
+	actor, ok := ActorNames[code]
+	if !ok {
+		return fmt.Sprintf("%s.%d", code, method)
+	}
+
+	m, ok := LookupMethod(code, method)
+	if !ok {
+		return fmt.Sprintf("%s.%d", actor, method)
+	}
+
+	return actor + "." + m.Name
+}
+
+// InvokedMethodName names the method invoked by a message, looking up the
+// code of the receiver in the given state tree. It returns an empty string
+// when the receiver doesn't exist in the tree.
+func InvokedMethodName(st types.StateTree, msg *types.Message) string {
+	act, err := st.GetActor(msg.To)
+	if err != nil {
+		return ""
+	}
+
+	return MethodName(act.Code, msg.Method)
+}
+
+// ActorMethodSchemas describes the methods of all built-in actors, along with
+// the types of their parameters and return values.
+func ActorMethodSchemas() []api.ActorMethods {
+	var out []api.ActorMethods
+	for code, methods := range MethodsMap {
+		am := api.ActorMethods{
+			Name: ActorNames[code],
+			Code: code,
+		}
+
+		for i, m := range methods {
+			am.Methods = append(am.Methods, api.MethodSchema{
+				Num:    abi.MethodNum(i),
+				Name:   MethodName(code, abi.MethodNum(i)),
+				Params: typeSchema(m.Params),
+				Return: typeSchema(m.Ret),
+			})
+		}
+
+		out = append(out, am)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+func typeSchema(t reflect.Type) api.TypeSchema {
+	ts := api.TypeSchema{Type: t.String()}
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return ts
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+
+		ts.Fields = append(ts.Fields, api.FieldSchema{
+			Name: f.Name,
+			Type: f.Type.String(),
+		})
+	}
+
+	return ts
+}
+
 func GetReturnType(ctx context.Context, sm *StateManager, to address.Address, method abi.MethodNum, ts *types.TipSet) (cbg.CBORUnmarshaler, error) {
 	act, err := sm.GetActor(to, ts)
 	if err != nil {
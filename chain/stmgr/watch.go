@@ -0,0 +1,138 @@
+package stmgr
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/account"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/state"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// ActorChanges returns the balance and nonce changes of the given actors
+// between the parent state of the parent of ts and the parent state of ts,
+// which are the changes caused by executing the parent tipset.
+func (sm *StateManager) ActorChanges(ctx context.Context, ts *types.TipSet, addrs []address.Address) ([]*api.ActorChange, error) {
+	if ts.Height() == 0 {
+		return nil, nil
+	}
+
+	pts, err := sm.cs.LoadTipSet(ts.Parents())
+	if err != nil {
+		return nil, xerrors.Errorf("loading parent tipset: %w", err)
+	}
+
+	cst := cbor.NewCborStore(sm.cs.Blockstore())
+	oldTree, err := state.LoadStateTree(cst, pts.ParentState())
+	if err != nil {
+		return nil, xerrors.Errorf("loading old state tree: %w", err)
+	}
+	newTree, err := state.LoadStateTree(cst, ts.ParentState())
+	if err != nil {
+		return nil, xerrors.Errorf("loading new state tree: %w", err)
+	}
+
+	var msgs []types.ChainMsg
+	var out []*api.ActorChange
+	for _, addr := range addrs {
+		oldAct, err := watchedActor(oldTree, addr)
+		if err != nil {
+			return nil, xerrors.Errorf("getting old actor %s: %w", addr, err)
+		}
+		newAct, err := watchedActor(newTree, addr)
+		if err != nil {
+			return nil, xerrors.Errorf("getting new actor %s: %w", addr, err)
+		}
+
+		if oldAct.Balance.Equals(newAct.Balance) && oldAct.Nonce == newAct.Nonce {
+			continue
+		}
+
+		if msgs == nil {
+			msgs, err = sm.cs.MessagesForTipset(pts)
+			if err != nil {
+				return nil, xerrors.Errorf("loading parent messages: %w", err)
+			}
+		}
+
+		// messages may refer to the actor by either of its addresses, and
+		// the actor may only exist in one of the states
+		match := map[address.Address]struct{}{addr: {}}
+		for _, tree := range []*state.StateTree{oldTree, newTree} {
+			if err := actorAddresses(ctx, cst, tree, addr, match); err != nil {
+				return nil, xerrors.Errorf("resolving addresses of %s: %w", addr, err)
+			}
+		}
+
+		ch := &api.ActorChange{
+			Address:    addr,
+			TipSet:     ts.Key(),
+			Height:     ts.Height(),
+			OldBalance: oldAct.Balance,
+			NewBalance: newAct.Balance,
+			OldNonce:   oldAct.Nonce,
+			NewNonce:   newAct.Nonce,
+		}
+
+		for _, m := range msgs {
+			vmm := m.VMMessage()
+			_, from := match[vmm.From]
+			_, to := match[vmm.To]
+			if from || to {
+				ch.Messages = append(ch.Messages, m.Cid())
+			}
+		}
+
+		out = append(out, ch)
+	}
+
+	return out, nil
+}
+
+// watchedActor returns the actor at addr, or an empty actor if it doesn't
+// exist (yet).
+func watchedActor(tree *state.StateTree, addr address.Address) (*types.Actor, error) {
+	act, err := tree.GetActor(addr)
+	if err != nil {
+		if xerrors.Is(err, types.ErrActorNotFound) {
+			return &types.Actor{Balance: types.NewInt(0)}, nil
+		}
+		return nil, err
+	}
+
+	return act, nil
+}
+
+// actorAddresses adds the ID address of the actor at addr to match, and the
+// key address if the actor is an account. Actors which don't exist in the
+// tree are skipped.
+func actorAddresses(ctx context.Context, cst cbor.IpldStore, tree *state.StateTree, addr address.Address, match map[address.Address]struct{}) error {
+	act, err := tree.GetActor(addr)
+	if err != nil {
+		if xerrors.Is(err, types.ErrActorNotFound) {
+			return nil
+		}
+		return xerrors.Errorf("getting actor: %w", err)
+	}
+
+	ida, err := tree.LookupID(addr)
+	if err != nil {
+		return xerrors.Errorf("resolving ID address: %w", err)
+	}
+	match[ida] = struct{}{}
+
+	if act.Code != builtin.AccountActorCodeID {
+		return nil
+	}
+	var st account.State
+	if err := cst.Get(ctx, act.Head, &st); err != nil {
+		return xerrors.Errorf("loading account state: %w", err)
+	}
+	match[st.Address] = struct{}{}
+	return nil
+}
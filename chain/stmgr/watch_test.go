@@ -0,0 +1,87 @@
+package stmgr_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func TestActorChangesAddresses(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := cg.Wallet().GenerateKey(crypto.SigTypeBLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every tipset includes a transfer from the banker to the key address of
+	// the account, the first one creates it
+	var nonce uint64
+	cg.GetMessages = func(cg *gen.ChainGen) ([]*types.SignedMessage, error) {
+		msg := types.Message{
+			To:       to,
+			From:     cg.Banker(),
+			Nonce:    nonce,
+			Value:    types.NewInt(100 + nonce),
+			GasLimit: 1000000,
+			GasPrice: types.NewInt(0),
+		}
+		sig, err := cg.Wallet().Sign(ctx, cg.Banker(), msg.Cid().Bytes())
+		if err != nil {
+			return nil, err
+		}
+		nonce++
+		return []*types.SignedMessage{{Message: msg, Signature: *sig}}, nil
+	}
+
+	// chain[i] includes msgs[i], which are executed in chain[i+1]
+	chain := []*types.TipSet{cg.CurTipset.TipSet()}
+	msgs := []*types.SignedMessage{nil}
+	for i := 0; i < 3; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, mts.TipSet.TipSet())
+		msgs = append(msgs, mts.Messages[0])
+	}
+
+	sm := stmgr.NewStateManager(cg.ChainStore())
+	ida, err := sm.LookupID(ctx, to, chain[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(ts *types.TipSet, addr address.Address, msg *types.SignedMessage) {
+		t.Helper()
+
+		changes, err := sm.ActorChanges(ctx, ts, []address.Address{addr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 1 || changes[0].Address != addr {
+			t.Fatalf("expected a change of %s at height %d, got %+v", addr, ts.Height(), changes)
+		}
+		if m := changes[0].Messages; len(m) != 1 || m[0] != msg.Cid() {
+			t.Fatalf("expected the transfer to %s at height %d, got %v", addr, ts.Height(), m)
+		}
+	}
+
+	// the messages refer to the account by its key address, the watcher by
+	// either address
+	for _, addr := range []address.Address{to, ida} {
+		// the account is created
+		expect(chain[2], addr, msgs[1])
+		expect(chain[3], addr, msgs[2])
+	}
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+
+	lru "github.com/hashicorp/golang-lru"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/metrics"
+)
+
+const (
+	// DefaultTipSetCacheSize is the number of tipsets cached by default
+	DefaultTipSetCacheSize = 4096
+	// DefaultHeaderCacheSize is the number of block headers cached by default
+	DefaultHeaderCacheSize = 8192
+)
+
+var (
+	tipsetCacheTag = []tag.Mutator{tag.Upsert(metrics.ChainCache, "tipset")}
+	headerCacheTag = []tag.Mutator{tag.Upsert(metrics.ChainCache, "header")}
+)
+
+// SetCacheSizes sets the number of tipsets and block headers cached. The
+// caches are emptied, it's meant to be called before the chain store is used,
+// but it's safe to call at any time.
+func (cs *ChainStore) SetCacheSizes(tipsets, headers int) error {
+	tsc, err := lru.NewARC(tipsets)
+	if err != nil {
+		return xerrors.Errorf("creating tipset cache: %w", err)
+	}
+	hdrc, err := lru.NewARC(headers)
+	if err != nil {
+		return xerrors.Errorf("creating block header cache: %w", err)
+	}
+
+	cs.cacheLk.Lock()
+	cs.tsCache = tsc
+	cs.hdrCache = hdrc
+	cs.cacheLk.Unlock()
+	return nil
+}
+
+// caches returns the tipset and block header caches
+func (cs *ChainStore) caches() (*lru.ARCCache, *lru.ARCCache) {
+	cs.cacheLk.RLock()
+	defer cs.cacheLk.RUnlock()
+	return cs.tsCache, cs.hdrCache
+}
+
+func recordCacheLookup(cacheTag []tag.Mutator, hit bool) {
+	m := metrics.ChainCacheMisses.M(1)
+	if hit {
+		m = metrics.ChainCacheHits.M(1)
+	}
+	_ = stats.RecordWithTags(context.Background(), cacheTag, m)
+}
+
+// evictReverted drops reverted tipsets from the caches. They stay valid, but
+// are unlikely to be loaded again, and would push out tipsets of the chain.
+func (cs *ChainStore) evictReverted(revert []*types.TipSet) {
+	tsCache, hdrCache := cs.caches()
+	for _, ts := range revert {
+		tsCache.Remove(ts.Key())
+		for _, c := range ts.Cids() {
+			hdrCache.Remove(c)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package store_test
+
+import (
+	"sync"
+	"testing"
+
+	block "github.com/ipfs/go-block-format"
+	datastore "github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+func TestSetCacheSizes(t *testing.T) {
+	nbs := blockstore.NewBlockstore(syncds.MutexWrap(datastore.NewMapDatastore()))
+	cs := store.NewChainStore(nbs, syncds.MutexWrap(datastore.NewMapDatastore()), nil)
+
+	var chain []*types.TipSet
+	var parent *types.TipSet
+	for i := 0; i < 50; i++ {
+		ts := mock.TipSet(mock.MkBlock(parent, 1, 1))
+		if err := cs.PersistBlockHeaders(ts.Blocks()...); err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, ts)
+		parent = ts
+	}
+
+	if err := cs.SetCacheSizes(0, 1); err == nil {
+		t.Fatal("expected an empty tipset cache to be refused")
+	}
+
+	// the caches can be resized while tipsets are loaded, run with -race
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				for _, ts := range chain {
+					got, err := cs.LoadTipSet(ts.Key())
+					if err != nil {
+						errs <- err
+						return
+					}
+					if !got.Equals(ts) {
+						t.Errorf("loaded the wrong tipset at height %d", ts.Height())
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := 1; i <= 20; i++ {
+		if err := cs.SetCacheSizes(i, 2*i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestStateCache(t *testing.T) {
+	nbs := blockstore.NewBlockstore(syncds.MutexWrap(datastore.NewMapDatastore()))
+	cs := store.NewChainStore(nbs, syncds.MutexWrap(datastore.NewMapDatastore()), nil)
+
+	blk := block.NewBlock([]byte("state"))
+	if err := cs.Blockstore().Put(blk); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.Blockstore().Get(blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	// reads are served from the cache, Has isn't
+	if err := nbs.DeleteBlock(blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.Blockstore().Get(blk.Cid()); err != nil {
+		t.Fatalf("expected the object to be cached: %s", err)
+	}
+	if has, err := cs.Blockstore().Has(blk.Cid()); err != nil || has {
+		t.Fatalf("expected Has to check the blockstore (%v)", err)
+	}
+
+	// deleting through the chain store drops the object from the cache
+	if err := cs.Blockstore().Put(blk); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Blockstore().DeleteBlock(blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.Blockstore().Get(blk.Cid()); err != blockstore.ErrNotFound {
+		t.Fatalf("expected the deleted object not to be found, got %v", err)
+	}
+
+	if err := cs.SetStateCacheSize(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Blockstore().Put(blk); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.Blockstore().Get(blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if err := nbs.DeleteBlock(blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.Blockstore().Get(blk.Cid()); err != blockstore.ErrNotFound {
+		t.Fatalf("expected nothing to be cached when disabled, got %v", err)
+	}
+}
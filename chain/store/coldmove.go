@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	block "github.com/ipfs/go-block-format"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+// coldMoveBatch is the number of objects written to the cold store at once
+const coldMoveBatch = 1024
+
+type ColdMoveStats struct {
+	// Boundary is the lowest height whose chain data stays in the hot store
+	Boundary abi.ChainEpoch
+
+	Moved      uint64
+	MovedBytes uint64
+	Took       time.Duration
+}
+
+// MoveToCold moves the objects of the hot store which aren't part of the last
+// hotEpochs epochs of the chain to the cold store. The chain store must be
+// backed by a blockstore reading through from the hot to the cold store, so
+// that moved objects remain available.
+//
+// Objects are written to the cold store before they're removed from the hot
+// store, so objects used while they're moved are never missing. Cold stores
+// buffering writes are flushed before objects are removed.
+func (cs *ChainStore) MoveToCold(ctx context.Context, hotEpochs abi.ChainEpoch, hot, cold bstore.Blockstore) (*ColdMoveStats, error) {
+	if hotEpochs < MinKeepStateRoots {
+		return nil, xerrors.Errorf("must keep at least %d epochs in the hot store, got %d", MinKeepStateRoots, hotEpochs)
+	}
+
+	if !cs.guard.start() {
+		return nil, xerrors.Errorf("the chain store is being pruned or moved to the cold store already")
+	}
+	defer cs.guard.stop()
+
+	start := time.Now()
+	boundary := cs.GetHeaviestTipSet().Height() - hotEpochs
+	if boundary < 0 {
+		boundary = 0
+	}
+	stats := &ColdMoveStats{Boundary: boundary}
+
+	mark, err := cs.newMarkSet()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := mark.close(); err != nil {
+			log.Warnf("closing cold store mark set: %s", err)
+		}
+	}()
+
+	if err := cs.markChain(ctx, mark, cs.recentBlocks(), boundary, boundary); err != nil {
+		return nil, xerrors.Errorf("marking hot objects: %w", err)
+	}
+
+	keys, err := hot.AllKeysChan(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("listing hot store keys: %w", err)
+	}
+
+	batch := make([]block.Block, 0, coldMoveBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := cold.PutMany(batch); err != nil {
+			return xerrors.Errorf("writing to the cold store: %w", err)
+		}
+		if f, ok := cold.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return xerrors.Errorf("flushing the cold store: %w", err)
+			}
+		}
+		for _, b := range batch {
+			if err := hot.DeleteBlock(b.Cid()); err != nil {
+				return xerrors.Errorf("removing from the hot store: %w", err)
+			}
+			stats.Moved++
+			stats.MovedBytes += uint64(len(b.RawData()))
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for c := range keys {
+		marked, err := mark.has(c)
+		if err != nil {
+			return nil, xerrors.Errorf("checking mark: %w", err)
+		}
+		if marked {
+			continue
+		}
+
+		b, err := hot.Get(c)
+		if err != nil {
+			if err == bstore.ErrNotFound {
+				continue
+			}
+			return nil, xerrors.Errorf("reading from the hot store: %w", err)
+		}
+
+		batch = append(batch, b)
+		if len(batch) == coldMoveBatch {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	stats.Took = time.Since(start)
+	log.Infow("moved chain data to the cold store", "boundary", boundary, "moved", stats.Moved, "movedBytes", stats.MovedBytes, "took", stats.Took)
+	return stats, nil
+}
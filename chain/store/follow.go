@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// FollowRetryInterval is how often followers retry catching up with the head
+// after processing a tipset failed
+var FollowRetryInterval = 30 * time.Second
+
+// Follower processes every tipset of the heaviest chain in order, persisting
+// the position it reached, see Follow.
+type Follower struct {
+	// Name describes the follower in logs
+	Name string
+
+	// Cursor returns the key of the last tipset processed, and false when
+	// the follower didn't start yet
+	Cursor func() (types.TipSetKey, bool, error)
+	// Start moves the cursor of a follower which didn't start yet to the head
+	Start func(head *types.TipSet) error
+	// Apply processes a tipset added to the chain, and moves the cursor to it
+	Apply func(ctx context.Context, ts *types.TipSet) error
+	// Revert un-does a tipset removed from the chain, and moves the cursor to
+	// its parent
+	Revert func(ctx context.Context, ts *types.TipSet) error
+}
+
+// Follow catches the follower up with the head on every head change, until the
+// context is cancelled.
+//
+// Every head change is processed by catching up from the persisted cursor to
+// the new head, so the cursor only moves past tipsets which were processed,
+// and after a restart the follower continues where it stopped. When processing
+// a tipset fails, the follower stops there, and retries every
+// FollowRetryInterval until it catches up.
+func (cs *ChainStore) Follow(ctx context.Context, f *Follower) {
+	retry := time.NewTicker(FollowRetryInterval)
+	defer retry.Stop()
+
+	changes := cs.SubHeadChanges(ctx)
+	var failed bool
+	for {
+		var head *types.TipSet
+		select {
+		case hcs, ok := <-changes:
+			if !ok {
+				return
+			}
+			head = newHead(hcs)
+		case <-retry.C:
+			if !failed {
+				continue
+			}
+			head = cs.GetHeaviestTipSet()
+		case <-ctx.Done():
+			return
+		}
+		if head == nil {
+			continue
+		}
+
+		if err := cs.CatchUp(ctx, f, head); err != nil {
+			log.Errorf("%s: processing tipsets up to height %d, retrying in %s: %s", f.Name, head.Height(), FollowRetryInterval, err)
+			failed = true
+			continue
+		}
+		failed = false
+	}
+}
+
+// newHead returns the head after the given changes
+func newHead(hcs []*api.HeadChange) *types.TipSet {
+	for i := len(hcs) - 1; i >= 0; i-- {
+		if hcs[i].Type != HCRevert {
+			return hcs[i].Val
+		}
+	}
+	return nil
+}
+
+// CatchUp processes the tipsets between the cursor of the follower and the
+// head, starting the follower at the head if it didn't start yet. It stops at
+// the first tipset which can't be processed.
+func (cs *ChainStore) CatchUp(ctx context.Context, f *Follower, head *types.TipSet) error {
+	tsk, started, err := f.Cursor()
+	if err != nil {
+		return xerrors.Errorf("getting cursor: %w", err)
+	}
+	if !started {
+		return f.Start(head)
+	}
+
+	from, err := cs.LoadTipSet(tsk)
+	if err != nil {
+		return xerrors.Errorf("loading cursor tipset: %w", err)
+	}
+
+	rev, app, err := cs.ReorgOps(from, head)
+	if err != nil {
+		return xerrors.Errorf("computing catch up path: %w", err)
+	}
+
+	for _, ts := range rev {
+		if err := f.Revert(ctx, ts); err != nil {
+			return xerrors.Errorf("reverting tipset at %d: %w", ts.Height(), err)
+		}
+	}
+	for i := len(app) - 1; i >= 0; i-- {
+		if err := f.Apply(ctx, app[i]); err != nil {
+			return xerrors.Errorf("applying tipset at %d: %w", app[i].Height(), err)
+		}
+	}
+
+	return nil
+}
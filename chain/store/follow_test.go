@@ -0,0 +1,137 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// testFollower records the tipsets it applies and reverts, failing to apply
+// fail
+type testFollower struct {
+	cs     *store.ChainStore
+	cursor *types.TipSet
+	fail   *types.TipSet
+
+	applied  []*types.TipSet
+	reverted []*types.TipSet
+}
+
+func (f *testFollower) follower() *store.Follower {
+	return &store.Follower{
+		Name: "test",
+		Cursor: func() (types.TipSetKey, bool, error) {
+			if f.cursor == nil {
+				return types.EmptyTSK, false, nil
+			}
+			return f.cursor.Key(), true, nil
+		},
+		Start: func(head *types.TipSet) error {
+			f.cursor = head
+			return nil
+		},
+		Apply: func(_ context.Context, ts *types.TipSet) error {
+			if f.fail != nil && ts.Equals(f.fail) {
+				return xerrors.New("apply failure")
+			}
+			f.applied = append(f.applied, ts)
+			f.cursor = ts
+			return nil
+		},
+		Revert: func(_ context.Context, ts *types.TipSet) error {
+			pts, err := f.cs.LoadTipSet(ts.Parents())
+			if err != nil {
+				return err
+			}
+			f.reverted = append(f.reverted, ts)
+			f.cursor = pts
+			return nil
+		},
+	}
+}
+
+func expectTipSets(t *testing.T, what string, got, expected []*types.TipSet) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d tipsets to be %s, got %d", len(expected), what, len(got))
+	}
+	for i := range got {
+		if !got[i].Equals(expected[i]) {
+			t.Fatalf("tipset %d: expected height %d to be %s, got %d", i, expected[i].Height(), what, got[i].Height())
+		}
+	}
+}
+
+func TestFollowerCatchUp(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := []*types.TipSet{cg.CurTipset.TipSet()}
+	for i := 0; i < 4; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, mts.TipSet.TipSet())
+	}
+
+	// a fork without messages on top of chain[2]
+	cg.GetMessages = func(*gen.ChainGen) ([]*types.SignedMessage, error) {
+		return nil, nil
+	}
+	fork := append([]*types.TipSet{}, chain[:3]...)
+	for i := 0; i < 3; i++ {
+		mts, err := cg.NextTipSetFromMiners(fork[len(fork)-1], cg.Miners)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fork = append(fork, mts.TipSet.TipSet())
+	}
+
+	cs := cg.ChainStore()
+	tf := &testFollower{cs: cs, fail: chain[2]}
+	f := tf.follower()
+
+	// the follower starts at the first head it sees
+	if err := cs.CatchUp(ctx, f, chain[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !tf.cursor.Equals(chain[0]) || len(tf.applied) != 0 {
+		t.Fatal("expected the follower to start at the head without applying it")
+	}
+
+	// it stops at the tipset it failed to apply
+	if err := cs.CatchUp(ctx, f, chain[4]); err == nil {
+		t.Fatal("expected catching up to fail")
+	}
+	if !tf.cursor.Equals(chain[1]) {
+		t.Fatalf("expected the cursor to stop before the failed tipset, got height %d", tf.cursor.Height())
+	}
+
+	// and continues from there once it can
+	tf.fail = nil
+	if err := cs.CatchUp(ctx, f, chain[4]); err != nil {
+		t.Fatal(err)
+	}
+	expectTipSets(t, "applied", tf.applied, chain[1:])
+
+	// switching to the fork reverts the tipsets above the common ancestor
+	tf.applied = nil
+	if err := cs.CatchUp(ctx, f, fork[5]); err != nil {
+		t.Fatal(err)
+	}
+	expectTipSets(t, "reverted", tf.reverted, []*types.TipSet{chain[4], chain[3]})
+	expectTipSets(t, "applied", tf.applied, fork[3:])
+	if !tf.cursor.Equals(fork[5]) {
+		t.Fatalf("expected the cursor at the fork head, got height %d", tf.cursor.Height())
+	}
+}
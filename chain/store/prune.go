@@ -0,0 +1,271 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+)
+
+// MinKeepStateRoots is the lowest number of state roots pruning keeps. The
+// state down to finality is needed to follow reorgs.
+var MinKeepStateRoots = build.Finality
+
+// PruneNotifee is called with the objects removed from the blockstore while
+// pruning, in batches
+type PruneNotifee func(removed []cid.Cid)
+
+// pruneNotifyBatch is the number of removed objects notifees are called with
+const pruneNotifyBatch = 1024
+
+// SubscribePruned registers f to be called with the objects removed by prunes,
+// e.g. to invalidate caches of the blockstore
+func (cs *ChainStore) SubscribePruned(f PruneNotifee) {
+	cs.pruneNotifeesLk.Lock()
+	cs.pruneNotifees = append(cs.pruneNotifees, f)
+	cs.pruneNotifeesLk.Unlock()
+}
+
+func (cs *ChainStore) notifyPruned(removed []cid.Cid) {
+	if len(removed) == 0 {
+		return
+	}
+
+	cs.pruneNotifeesLk.Lock()
+	defer cs.pruneNotifeesLk.Unlock()
+
+	for _, f := range cs.pruneNotifees {
+		f(removed)
+	}
+}
+
+// Prune removes the objects of the blockstore which aren't reachable from the
+// chain. All block headers, messages and receipts are kept, state trees only
+// for the last keepStateRoots tipsets, and for genesis.
+//
+// Pruning runs while the node syncs. Objects written to the chain blockstore
+// in the meantime, by the chain store, bitswap or graphsync, are kept until
+// the next prune.
+func (cs *ChainStore) Prune(ctx context.Context, keepStateRoots abi.ChainEpoch, dryRun bool) (*api.ChainPruneReport, error) {
+	if keepStateRoots < MinKeepStateRoots {
+		return nil, xerrors.Errorf("must keep at least %d state roots, got %d", MinKeepStateRoots, keepStateRoots)
+	}
+
+	if !cs.guard.start() {
+		return nil, xerrors.Errorf("the chain store is being pruned or moved to the cold store already")
+	}
+	defer cs.guard.stop()
+
+	start := time.Now()
+	head := cs.GetHeaviestTipSet()
+	keepFrom := head.Height() - keepStateRoots
+	if keepFrom < 0 {
+		keepFrom = 0
+	}
+
+	report := &api.ChainPruneReport{
+		DryRun:   dryRun,
+		KeptFrom: keepFrom,
+	}
+
+	mark, err := cs.newMarkSet()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := mark.close(); err != nil {
+			log.Warnf("closing prune mark set: %s", err)
+		}
+	}()
+
+	if err := cs.markChain(ctx, mark, head.Cids(), keepFrom, 0); err != nil {
+		return nil, xerrors.Errorf("marking reachable objects: %w", err)
+	}
+	log.Infow("marked reachable objects", "objects", mark.size(), "keepFrom", keepFrom, "took", time.Since(start))
+
+	if dryRun {
+		if err := cs.sweep(ctx, mark, report, nil); err != nil {
+			return nil, err
+		}
+		report.Duration = time.Since(start)
+		return report, nil
+	}
+
+	// tipsets which arrived in the meantime may reference objects written
+	// before the prune started
+	if err := cs.markChain(ctx, mark, cs.recentBlocks(), keepFrom, 0); err != nil {
+		return nil, xerrors.Errorf("marking objects of new tipsets: %w", err)
+	}
+
+	var pruned []cid.Cid
+	defer func() {
+		cs.notifyPruned(pruned)
+	}()
+
+	if err := cs.sweep(ctx, mark, report, func(c cid.Cid) (bool, error) {
+		removed, err := cs.guard.deleteUnlessWritten(c)
+		if err != nil || !removed {
+			return false, err
+		}
+		cs.stateCache.evict(c)
+
+		pruned = append(pruned, c)
+		if len(pruned) == pruneNotifyBatch {
+			cs.notifyPruned(pruned)
+			pruned = nil
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	report.Duration = time.Since(start)
+	log.Infow("pruned chain store", "removed", report.Removed, "removedBytes", report.RemovedBytes, "kept", report.Kept, "took", report.Duration)
+	return report, nil
+}
+
+// sweep counts the objects of the blockstore which aren't marked in the
+// report, and removes them with remove, unless it's nil. Keys are streamed
+// from the blockstore, so no list of candidates is held in memory.
+func (cs *ChainStore) sweep(ctx context.Context, mark markSet, report *api.ChainPruneReport, remove func(cid.Cid) (bool, error)) error {
+	keys, err := cs.bs.AllKeysChan(ctx)
+	if err != nil {
+		return xerrors.Errorf("listing blockstore keys: %w", err)
+	}
+
+	for c := range keys {
+		marked, err := mark.has(c)
+		if err != nil {
+			return xerrors.Errorf("checking mark: %w", err)
+		}
+		if marked {
+			report.Kept++
+			continue
+		}
+
+		size, err := cs.bs.GetSize(c)
+		if err != nil {
+			if err == bstore.ErrNotFound {
+				continue
+			}
+			return xerrors.Errorf("getting object size: %w", err)
+		}
+
+		if remove != nil {
+			removed, err := remove(c)
+			if err != nil {
+				return xerrors.Errorf("removing object: %w", err)
+			}
+			if !removed {
+				report.Kept++
+				continue
+			}
+		}
+		report.Removed++
+		report.RemovedBytes += uint64(size)
+	}
+	return ctx.Err()
+}
+
+// recentBlocks returns the blocks of the current head, and the blocks of
+// recent heights tracked for tipset assembly
+func (cs *ChainStore) recentBlocks() []cid.Cid {
+	out := cs.GetHeaviestTipSet().Cids()
+
+	cs.tstLk.Lock()
+	defer cs.tstLk.Unlock()
+
+	for _, cids := range cs.tipsets {
+		out = append(out, cids...)
+	}
+	return out
+}
+
+// markChain marks the block headers reachable from the given blocks down to
+// walkTo, with their messages and receipts, and the state roots of blocks at
+// keepFrom and above. Walks stop at headers which were marked already.
+func (cs *ChainStore) markChain(ctx context.Context, mark markSet, blocks []cid.Cid, keepFrom, walkTo abi.ChainEpoch) error {
+	toWalk := append([]cid.Cid{}, blocks...)
+	for len(toWalk) > 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		c := toWalk[0]
+		toWalk = toWalk[1:]
+		first, err := mark.visit(c)
+		if err != nil {
+			return xerrors.Errorf("marking block %s: %w", c, err)
+		}
+		if !first {
+			continue
+		}
+
+		b, err := cs.GetBlock(c)
+		if err != nil {
+			return xerrors.Errorf("loading block %s: %w", c, err)
+		}
+		if b.Height < walkTo {
+			continue
+		}
+		toWalk = append(toWalk, b.Parents...)
+
+		if err := cs.markDag(mark, b.Messages); err != nil {
+			return xerrors.Errorf("marking messages of block %s: %w", c, err)
+		}
+		if b.Height == 0 || b.Height >= keepFrom {
+			if err := cs.markDag(mark, b.ParentStateRoot); err != nil {
+				return xerrors.Errorf("marking state of block %s: %w", c, err)
+			}
+		}
+		if b.Height > 0 {
+			if err := cs.markDag(mark, b.ParentMessageReceipts); err != nil {
+				return xerrors.Errorf("marking receipts of block %s: %w", c, err)
+			}
+		}
+	}
+	return nil
+}
+
+// markDag marks the objects of a dag. Objects missing from the blockstore,
+// e.g. old messages not included in an imported snapshot, are skipped.
+func (cs *ChainStore) markDag(mark markSet, c cid.Cid) error {
+	first, err := mark.visit(c)
+	if err != nil {
+		return xerrors.Errorf("marking object %s: %w", c, err)
+	}
+	if !first {
+		return nil
+	}
+	if c.Prefix().Codec != cid.DagCBOR {
+		return nil
+	}
+
+	data, err := cs.bs.Get(c)
+	if err != nil {
+		if err == bstore.ErrNotFound {
+			return nil
+		}
+		return xerrors.Errorf("getting object %s: %w", c, err)
+	}
+
+	links, err := cbg.ScanForLinks(bytes.NewReader(data.RawData()))
+	if err != nil {
+		return xerrors.Errorf("scanning for links failed: %w", err)
+	}
+	for _, l := range links {
+		if err := cs.markDag(mark, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
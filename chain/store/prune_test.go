@@ -0,0 +1,116 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	datastore "github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func TestChainPrune(t *testing.T) {
+	defer func(min abi.ChainEpoch) {
+		store.MinKeepStateRoots = min
+	}(store.MinKeepStateRoots)
+	store.MinKeepStateRoots = 5
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tipsets []*types.TipSet
+	for i := 0; i < 20; i++ {
+		ts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tipsets = append(tipsets, ts.TipSet.TipSet())
+	}
+	last := tipsets[len(tipsets)-1]
+
+	buf := new(bytes.Buffer)
+	if err := cg.ChainStore().Export(context.TODO(), last, last.Height(), true, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	cs := store.NewChainStore(bs, datastore.NewMapDatastore(), nil)
+	if _, err := cs.Import(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.SetHead(last); err != nil {
+		t.Fatal(err)
+	}
+
+	garbage := blocks.NewBlock([]byte("not referenced by the chain"))
+	if err := bs.Put(garbage); err != nil {
+		t.Fatal(err)
+	}
+	old := tipsets[2].ParentState()
+
+	if _, err := cs.Prune(context.TODO(), 4, true); err == nil {
+		t.Fatal("expected keeping less than MinKeepStateRoots to be rejected")
+	}
+
+	report, err := cs.Prune(context.TODO(), 5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Removed == 0 || report.Kept == 0 {
+		t.Fatalf("expected the dry run to find objects to remove and keep, got %+v", report)
+	}
+	if has, _ := bs.Has(garbage.Cid()); !has {
+		t.Fatal("the dry run removed an object")
+	}
+
+	dir, err := ioutil.TempDir("", "lotus-prune-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+	cs.SetPruneMarkDir(dir)
+
+	pruned, err := cs.Prune(context.TODO(), 5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned.Removed != report.Removed || pruned.RemovedBytes != report.RemovedBytes {
+		t.Fatalf("expected the prune to remove what the dry run reported, %+v != %+v", pruned, report)
+	}
+
+	if has, _ := bs.Has(garbage.Cid()); has {
+		t.Fatal("expected the unreferenced object to be removed")
+	}
+	if has, _ := bs.Has(old); has {
+		t.Fatal("expected an old state root to be removed")
+	}
+	for _, b := range tipsets[0].Blocks() {
+		if has, _ := bs.Has(b.Cid()); !has {
+			t.Fatal("expected old block headers to be kept")
+		}
+	}
+
+	// the recent state is complete
+	if err := cs.Export(context.TODO(), last, 5, true, new(bytes.Buffer)); err != nil {
+		t.Fatalf("exporting the kept state: %s", err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the mark set to be removed, found %d entries", len(entries))
+	}
+}
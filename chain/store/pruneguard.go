@@ -0,0 +1,193 @@
+package store
+
+import (
+	"encoding/base32"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	levelds "github.com/ipfs/go-ds-leveldb"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"golang.org/x/xerrors"
+)
+
+// pruneGuard wraps the chain blockstore, and records the objects written
+// while the store is pruned, so that objects which aren't referenced by the
+// chain yet, e.g. the state of a tipset being validated, or blocks fetched by
+// bitswap or graphsync, aren't removed.
+type pruneGuard struct {
+	bstore.Blockstore
+
+	lk sync.Mutex
+	// written is nil while no prune runs
+	written map[string]struct{}
+}
+
+// NewPruneGuard wraps the chain blockstore shared by the node services, so
+// that all writes are seen by prunes. The chain store uses the guard when it's
+// given one, and wraps the blockstore otherwise.
+func NewPruneGuard(bs bstore.Blockstore) bstore.Blockstore {
+	if g, ok := bs.(*pruneGuard); ok {
+		return g
+	}
+	return &pruneGuard{Blockstore: bs}
+}
+
+func (g *pruneGuard) start() bool {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	if g.written != nil {
+		return false
+	}
+	g.written = map[string]struct{}{}
+	return true
+}
+
+func (g *pruneGuard) stop() {
+	g.lk.Lock()
+	g.written = nil
+	g.lk.Unlock()
+}
+
+func (g *pruneGuard) record(cids ...cid.Cid) {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	if g.written == nil {
+		return
+	}
+	for _, c := range cids {
+		g.written[string(c.Hash())] = struct{}{}
+	}
+}
+
+func (g *pruneGuard) Put(b block.Block) error {
+	g.record(b.Cid())
+	return g.Blockstore.Put(b)
+}
+
+func (g *pruneGuard) PutMany(bs []block.Block) error {
+	cids := make([]cid.Cid, len(bs))
+	for i, b := range bs {
+		cids[i] = b.Cid()
+	}
+	g.record(cids...)
+	return g.Blockstore.PutMany(bs)
+}
+
+// deleteUnlessWritten removes the object, unless it was written since the
+// prune started. Writes wait for the removal, and store the object again.
+func (g *pruneGuard) deleteUnlessWritten(c cid.Cid) (bool, error) {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	if _, ok := g.written[string(c.Hash())]; ok {
+		return false, nil
+	}
+	return true, g.Blockstore.DeleteBlock(c)
+}
+
+// markSet is the set of objects reachable from the chain. The blockstore is
+// keyed by multihash, so are the marks.
+type markSet interface {
+	// visit marks the object, it returns false when it was marked already
+	visit(c cid.Cid) (bool, error)
+	has(c cid.Cid) (bool, error)
+	size() int
+	close() error
+}
+
+// newMarkSet returns a mark set kept on disk in the prune mark directory, so
+// that marking a large chain doesn't need memory proportional to the number
+// of objects. Without a directory, marks are kept in memory.
+func (cs *ChainStore) newMarkSet() (markSet, error) {
+	if cs.pruneMarkDir == "" {
+		return memMarkSet{}, nil
+	}
+
+	if err := os.MkdirAll(cs.pruneMarkDir, 0755); err != nil {
+		return nil, xerrors.Errorf("creating prune mark directory: %w", err)
+	}
+	dir, err := ioutil.TempDir(cs.pruneMarkDir, "mark")
+	if err != nil {
+		return nil, xerrors.Errorf("creating mark set: %w", err)
+	}
+	ds, err := levelds.NewDatastore(dir, nil)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, xerrors.Errorf("opening mark set: %w", err)
+	}
+	return &diskMarkSet{ds: ds, dir: dir}, nil
+}
+
+// SetPruneMarkDir sets the directory the marks of prunes and cold store moves
+// are kept in while they run
+func (cs *ChainStore) SetPruneMarkDir(dir string) {
+	cs.pruneMarkDir = dir
+}
+
+type memMarkSet map[string]struct{}
+
+func (m memMarkSet) visit(c cid.Cid) (bool, error) {
+	k := string(c.Hash())
+	if _, ok := m[k]; ok {
+		return false, nil
+	}
+	m[k] = struct{}{}
+	return true, nil
+}
+
+func (m memMarkSet) has(c cid.Cid) (bool, error) {
+	_, ok := m[string(c.Hash())]
+	return ok, nil
+}
+
+func (m memMarkSet) size() int {
+	return len(m)
+}
+
+func (m memMarkSet) close() error {
+	return nil
+}
+
+type diskMarkSet struct {
+	ds  *levelds.Datastore
+	dir string
+	n   int
+}
+
+func markKey(c cid.Cid) datastore.Key {
+	return datastore.NewKey(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(c.Hash()))
+}
+
+func (m *diskMarkSet) visit(c cid.Cid) (bool, error) {
+	k := markKey(c)
+	has, err := m.ds.Has(k)
+	if err != nil || has {
+		return false, err
+	}
+	if err := m.ds.Put(k, nil); err != nil {
+		return false, err
+	}
+	m.n++
+	return true, nil
+}
+
+func (m *diskMarkSet) has(c cid.Cid) (bool, error) {
+	return m.ds.Has(markKey(c))
+}
+
+func (m *diskMarkSet) size() int {
+	return m.n
+}
+
+func (m *diskMarkSet) close() error {
+	if err := m.ds.Close(); err != nil {
+		return err
+	}
+	return os.RemoveAll(m.dir)
+}
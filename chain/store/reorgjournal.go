@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	dstore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var reorgJournalPrefix = dstore.NewKey("/reorgs")
+
+// ReorgJournalSize is the number of head changes kept in the reorg journal
+var ReorgJournalSize = 256
+
+const (
+	ReorgPending    = "pending"
+	ReorgDone       = "done"
+	ReorgRolledBack = "rolledback"
+)
+
+// The reorg journal records every head change before the new head is
+// persisted, and marks it done once all head change notifees processed it.
+// When the node stops in between, the notifees (mpool, events, indexes) may
+// have seen only a part of the change. On the next start the head is rolled
+// back to the head before the change, the notifees are delivered the change
+// from the stored head back to it, and sync takes the new head again and
+// delivers the whole change.
+//
+// Both the journal and the head are written by the reorg worker, ahead of
+// notifying, so that taking a new head only updates it in memory.
+
+func reorgKey(id uint64) dstore.Key {
+	return reorgJournalPrefix.ChildString(fmt.Sprintf("%020d", id))
+}
+
+// journalReorg records a head change which is about to be delivered to the
+// notifees.
+func (cs *ChainStore) journalReorg(r reorg) error {
+	e := api.ReorgJournalEntry{
+		ID:    r.id,
+		From:  r.old.Key(),
+		To:    r.new.Key(),
+		State: ReorgPending,
+		Time:  time.Now(),
+	}
+
+	if err := cs.putReorg(&e); err != nil {
+		return err
+	}
+
+	if e.ID > uint64(ReorgJournalSize) {
+		if err := cs.ds.Delete(reorgKey(e.ID - uint64(ReorgJournalSize))); err != nil {
+			log.Warnf("pruning reorg journal: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// finishReorg marks a journaled head change as delivered to all notifees.
+func (cs *ChainStore) finishReorg(id uint64, revert, apply int) error {
+	e, err := cs.getReorg(id)
+	if err != nil {
+		return err
+	}
+
+	e.State = ReorgDone
+	e.Revert = revert
+	e.Apply = apply
+	return cs.putReorg(e)
+}
+
+// recoverReorgs marks the head changes which weren't completely applied
+// before the node stopped as rolled back. It returns the head to continue
+// from, or nil if the stored head can be used.
+func (cs *ChainStore) recoverReorgs() (*types.TipSet, error) {
+	entries, err := cs.ReorgJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	var rollback *api.ReorgJournalEntry
+	for i := range entries {
+		e := &entries[i]
+		if e.ID > cs.reorgSeq {
+			cs.reorgSeq = e.ID
+		}
+		if e.State != ReorgPending {
+			continue
+		}
+
+		if rollback == nil {
+			rollback = e
+		}
+		e.State = ReorgRolledBack
+		if err := cs.putReorg(e); err != nil {
+			return nil, err
+		}
+	}
+
+	if rollback == nil {
+		return nil, nil
+	}
+
+	ts, err := cs.LoadTipSet(rollback.From)
+	if err != nil {
+		return nil, xerrors.Errorf("loading head before interrupted reorg %d: %w", rollback.ID, err)
+	}
+
+	log.Warnw("rolling back interrupted head change", "id", rollback.ID, "from", rollback.To, "to", rollback.From)
+	return ts, nil
+}
+
+// ReorgJournal returns the journaled head changes, oldest first.
+func (cs *ChainStore) ReorgJournal() ([]api.ReorgJournalEntry, error) {
+	res, err := cs.ds.Query(query.Query{Prefix: reorgJournalPrefix.String()})
+	if err != nil {
+		return nil, xerrors.Errorf("querying reorg journal: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []api.ReorgJournalEntry
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("iterating reorg journal: %w", r.Error)
+		}
+
+		var e api.ReorgJournalEntry
+		if err := json.Unmarshal(r.Value, &e); err != nil {
+			return nil, xerrors.Errorf("decoding reorg journal entry %s: %w", r.Key, err)
+		}
+		out = append(out, e)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+
+	return out, nil
+}
+
+// ReplayReorg applies the head change of a journal entry again, if its target
+// is still heavier than the current head.
+func (cs *ChainStore) ReplayReorg(ctx context.Context, id uint64) error {
+	e, err := cs.getReorg(id)
+	if err != nil {
+		return err
+	}
+
+	ts, err := cs.LoadTipSet(e.To)
+	if err != nil {
+		return xerrors.Errorf("loading reorg target: %w", err)
+	}
+
+	return cs.MaybeTakeHeavierTipSet(ctx, ts)
+}
+
+func (cs *ChainStore) getReorg(id uint64) (*api.ReorgJournalEntry, error) {
+	b, err := cs.ds.Get(reorgKey(id))
+	if err != nil {
+		return nil, xerrors.Errorf("getting reorg journal entry %d: %w", id, err)
+	}
+
+	var e api.ReorgJournalEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, xerrors.Errorf("decoding reorg journal entry %d: %w", id, err)
+	}
+	return &e, nil
+}
+
+func (cs *ChainStore) putReorg(e *api.ReorgJournalEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return xerrors.Errorf("encoding reorg journal entry: %w", err)
+	}
+
+	if err := cs.ds.Put(reorgKey(e.ID), b); err != nil {
+		return xerrors.Errorf("writing reorg journal entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package store_test
+
+import (
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type headChange struct {
+	rev, app []*types.TipSet
+}
+
+func TestReorgJournalRecovery(t *testing.T) {
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := []*types.TipSet{cg.CurTipset.TipSet()}
+	for i := 0; i < 3; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, mts.TipSet.TipSet())
+	}
+
+	// a fork on top of chain[2]
+	fork := append([]*types.TipSet{}, chain[:3]...)
+	for i := 0; i < 2; i++ {
+		mts, err := cg.NextTipSetFromMiners(fork[len(fork)-1], cg.Miners)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fork = append(fork, mts.TipSet.TipSet())
+	}
+
+	bs := cg.ChainStore().Blockstore()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	cs := store.NewChainStore(bs, ds, nil)
+	changes := make(chan headChange, 1)
+	// the notifee doesn't return from the switch to the fork, as if the node
+	// stopped while delivering it
+	stuck := make(chan struct{})
+	defer close(stuck)
+	cs.SubscribeHeadChanges(func(rev, app []*types.TipSet) error {
+		changes <- headChange{rev, app}
+		if len(app) > 0 && app[len(app)-1].Equals(fork[4]) {
+			<-stuck
+		}
+		return nil
+	})
+
+	if err := cs.SetHead(chain[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.SetHead(chain[3]); err != nil {
+		t.Fatal(err)
+	}
+	<-changes
+
+	if err := cs.SetHead(fork[4]); err != nil {
+		t.Fatal(err)
+	}
+	<-changes
+
+	ents, err := cs.ReorgJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 2 || ents[0].State != store.ReorgDone || ents[1].State != store.ReorgPending {
+		t.Fatalf("expected a done and a pending head change, got %+v", ents)
+	}
+	if ents[0].Revert != 0 || ents[0].Apply != 2 {
+		t.Fatalf("expected the done change to apply 2 tipsets, got %+v", ents[0])
+	}
+
+	// restarting rolls the head back to before the interrupted change, and
+	// delivers its reverts
+	restarted := store.NewChainStore(bs, ds, nil)
+	recovered := make(chan headChange, 1)
+	restarted.SubscribeHeadChanges(func(rev, app []*types.TipSet) error {
+		recovered <- headChange{rev, app}
+		return nil
+	})
+	if err := restarted.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.GetHeaviestTipSet().Equals(chain[3]) {
+		t.Fatalf("expected the head to be rolled back to height %d, got %d", chain[3].Height(), restarted.GetHeaviestTipSet().Height())
+	}
+
+	hc := <-recovered
+	expectTipSets(t, "reverted", hc.rev, []*types.TipSet{fork[4], fork[3]})
+	expectTipSets(t, "applied", hc.app, []*types.TipSet{chain[3]})
+
+	ents, err = restarted.ReorgJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 3 || ents[1].State != store.ReorgRolledBack {
+		t.Fatalf("expected the interrupted change to be rolled back, got %+v", ents)
+	}
+	if e := ents[2]; e.From != fork[4].Key() || e.To != chain[3].Key() {
+		t.Fatalf("expected the rollback to be journaled, got %+v", e)
+	}
+}
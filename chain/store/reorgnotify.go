@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+const reorgTopic = "reorg"
+
+// notifyReorg is a ReorgNotifee publishing head changes which revert tipsets
+// to the SubReorgs subscribers, and recording them in the reorg statistics
+func (cs *ChainStore) notifyReorg(rev, app []*types.TipSet) error {
+	if len(rev) == 0 || len(app) == 0 {
+		return nil
+	}
+
+	evt, err := cs.reorgEvent(rev, app)
+	if err != nil {
+		return xerrors.Errorf("building reorg event: %w", err)
+	}
+
+	cs.bestTips.Pub(evt, reorgTopic)
+	return cs.recordReorg(evt, rev[len(rev)-1])
+}
+
+// reorgEvent describes a head change, rev starts at the old head, app ends at
+// the new head
+func (cs *ChainStore) reorgEvent(rev, app []*types.TipSet) (*api.ReorgEvent, error) {
+	oldHead, newHead := rev[0], app[len(app)-1]
+
+	ancestor, err := cs.LoadTipSet(rev[len(rev)-1].Parents())
+	if err != nil {
+		return nil, xerrors.Errorf("loading common ancestor: %w", err)
+	}
+
+	evt := &api.ReorgEvent{
+		Depth:          oldHead.Height() - ancestor.Height(),
+		OldHead:        oldHead,
+		NewHead:        newHead,
+		CommonAncestor: ancestor.Key(),
+	}
+
+	included := map[cid.Cid]struct{}{}
+	for _, ts := range app {
+		evt.Applied = append(evt.Applied, ts.Key())
+
+		msgs, err := cs.tipsetMessageCids(ts)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range msgs {
+			included[c] = struct{}{}
+		}
+	}
+
+	dropped := map[cid.Cid]struct{}{}
+	for _, ts := range rev {
+		evt.Reverted = append(evt.Reverted, ts.Key())
+
+		msgs, err := cs.tipsetMessageCids(ts)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range msgs {
+			if _, ok := included[c]; ok {
+				continue
+			}
+			if _, ok := dropped[c]; ok {
+				continue
+			}
+			dropped[c] = struct{}{}
+			evt.DroppedMessages = append(evt.DroppedMessages, c)
+		}
+	}
+
+	return evt, nil
+}
+
+// tipsetMessageCids returns the cids of the messages of all blocks in the
+// tipset, signed messages with the cid of the signed message
+func (cs *ChainStore) tipsetMessageCids(ts *types.TipSet) ([]cid.Cid, error) {
+	var out []cid.Cid
+	for _, b := range ts.Blocks() {
+		bls, secpk, err := cs.readMsgMetaCids(b.Messages)
+		if err != nil {
+			return nil, xerrors.Errorf("loading messages of block %s: %w", b.Cid(), err)
+		}
+		out = append(out, bls...)
+		out = append(out, secpk...)
+	}
+	return out, nil
+}
+
+// SubReorgs returns a channel of the head changes which revert tipsets. Head
+// changes only applying tipsets aren't sent.
+func (cs *ChainStore) SubReorgs(ctx context.Context) <-chan *api.ReorgEvent {
+	subch := cs.bestTips.Sub(reorgTopic)
+
+	out := make(chan *api.ReorgEvent, 16)
+	go func() {
+		defer close(out)
+		var unsubOnce sync.Once
+
+		for {
+			select {
+			case val, ok := <-subch:
+				if !ok {
+					return
+				}
+				select {
+				case out <- val.(*api.ReorgEvent):
+				case <-ctx.Done():
+				}
+			case <-ctx.Done():
+				unsubOnce.Do(func() {
+					go cs.bestTips.Unsub(subch)
+				})
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/journal"
+)
+
+// RecentReorgsSize is the number of recent reorgs kept for ReorgStats
+var RecentReorgsSize = 100
+
+// reorgDepthBuckets are the upper bounds of the buckets of the reorg depth
+// histogram, the last bucket holds the deeper reorgs
+var reorgDepthBuckets = []abi.ChainEpoch{1, 2, 4, 8, 16, 32, 64}
+
+// reorgStats tracks the reorgs observed since the node started
+type reorgStats struct {
+	lk sync.Mutex
+
+	since      time.Time
+	total      uint64
+	depthSum   abi.ChainEpoch
+	maxDepth   abi.ChainEpoch
+	histogram  []uint64
+	recent     []api.ReorgRecord
+	recentNext int
+}
+
+func newReorgStats() *reorgStats {
+	return &reorgStats{
+		since:     time.Now(),
+		histogram: make([]uint64, len(reorgDepthBuckets)+1),
+	}
+}
+
+func (rs *reorgStats) add(r api.ReorgRecord) {
+	rs.lk.Lock()
+	defer rs.lk.Unlock()
+
+	rs.total++
+	rs.depthSum += r.Depth
+	if r.Depth > rs.maxDepth {
+		rs.maxDepth = r.Depth
+	}
+
+	b := len(reorgDepthBuckets)
+	for i, max := range reorgDepthBuckets {
+		if r.Depth <= max {
+			b = i
+			break
+		}
+	}
+	rs.histogram[b]++
+
+	if len(rs.recent) < RecentReorgsSize {
+		rs.recent = append(rs.recent, r)
+		return
+	}
+	rs.recent[rs.recentNext] = r
+	rs.recentNext = (rs.recentNext + 1) % len(rs.recent)
+}
+
+// recordReorg records a reorg in the reorg statistics and the journal.
+// forkStart is the first tipset of the dropped fork.
+func (cs *ChainStore) recordReorg(evt *api.ReorgEvent, forkStart *types.TipSet) error {
+	ctx := context.TODO()
+	oldWeight, err := cs.Weight(ctx, evt.OldHead)
+	if err != nil {
+		return xerrors.Errorf("computing weight of the old head: %w", err)
+	}
+	newWeight, err := cs.Weight(ctx, evt.NewHead)
+	if err != nil {
+		return xerrors.Errorf("computing weight of the new head: %w", err)
+	}
+
+	now := time.Now()
+	r := api.ReorgRecord{
+		Time:      now,
+		Depth:     evt.Depth,
+		OldHead:   evt.OldHead.Key(),
+		OldHeight: evt.OldHead.Height(),
+		OldWeight: oldWeight,
+		NewHead:   evt.NewHead.Key(),
+		NewHeight: evt.NewHead.Height(),
+		NewWeight: newWeight,
+		Reverted:  len(evt.Reverted),
+		Applied:   len(evt.Applied),
+		ForkAge:   now.Sub(time.Unix(int64(forkStart.MinTimestamp()), 0)),
+	}
+
+	cs.reorgs.add(r)
+
+	log.Infow("chain reorg", "depth", r.Depth, "oldHeight", r.OldHeight, "newHeight", r.NewHeight, "oldWeight", r.OldWeight, "newWeight", r.NewWeight, "forkAge", r.ForkAge)
+	journal.Record(journal.SysChain, journal.EvtReorg, r)
+
+	return nil
+}
+
+// ReorgStats returns statistics of the reorgs observed since the node
+// started, and the most recent reorgs, oldest first.
+func (cs *ChainStore) ReorgStats() *api.ReorgStats {
+	rs := cs.reorgs
+	rs.lk.Lock()
+	defer rs.lk.Unlock()
+
+	out := &api.ReorgStats{
+		Since:    rs.since,
+		Total:    rs.total,
+		MaxDepth: rs.maxDepth,
+		Recent:   make([]api.ReorgRecord, 0, len(rs.recent)),
+	}
+	if rs.total > 0 {
+		out.MeanDepth = float64(rs.depthSum) / float64(rs.total)
+	}
+
+	for i, n := range rs.histogram {
+		b := api.ReorgDepthBucket{Count: n}
+		if i < len(reorgDepthBuckets) {
+			b.MaxDepth = reorgDepthBuckets[i]
+		}
+		out.Histogram = append(out.Histogram, b)
+	}
+
+	out.Recent = append(out.Recent, rs.recent[rs.recentNext:]...)
+	out.Recent = append(out.Recent, rs.recent[:rs.recentNext]...)
+
+	return out
+}
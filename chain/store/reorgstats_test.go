@@ -0,0 +1,101 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func TestReorgStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := []*types.TipSet{cg.CurTipset.TipSet()}
+	for i := 0; i < 3; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, mts.TipSet.TipSet())
+	}
+
+	// a fork on top of chain[2]
+	fork := append([]*types.TipSet{}, chain[:3]...)
+	for i := 0; i < 2; i++ {
+		mts, err := cg.NextTipSetFromMiners(fork[len(fork)-1], cg.Miners)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fork = append(fork, mts.TipSet.TipSet())
+	}
+
+	defer func(size int) {
+		store.RecentReorgsSize = size
+	}(store.RecentReorgsSize)
+	store.RecentReorgsSize = 2
+
+	cs := store.NewChainStore(cg.ChainStore().Blockstore(), dssync.MutexWrap(datastore.NewMapDatastore()), nil)
+	reorgs := cs.SubReorgs(ctx)
+
+	// switch between the chain and the fork three times
+	if err := cs.SetHead(chain[3]); err != nil {
+		t.Fatal(err)
+	}
+	var events []*api.ReorgEvent
+	for _, head := range []*types.TipSet{fork[4], chain[3], fork[4]} {
+		if err := cs.SetHead(head); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, <-reorgs)
+	}
+
+	// the stats are recorded after the event is published
+	var st *api.ReorgStats
+	for i := 0; i < 100; i++ {
+		if st = cs.ReorgStats(); st.Total == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st.Total != 3 {
+		t.Fatalf("expected 3 reorgs, got %d", st.Total)
+	}
+
+	toChain, toFork := fork[4].Height()-chain[2].Height(), chain[3].Height()-chain[2].Height()
+	if max := toChain; st.MaxDepth != max {
+		t.Fatalf("expected a max depth of %d, got %d", max, st.MaxDepth)
+	}
+	if mean := float64(2*toFork+toChain) / 3; st.MeanDepth != mean {
+		t.Fatalf("expected a mean depth of %f, got %f", mean, st.MeanDepth)
+	}
+
+	// only the recent reorgs are kept, oldest first
+	if len(st.Recent) != 2 {
+		t.Fatalf("expected 2 recent reorgs, got %d", len(st.Recent))
+	}
+	for i, r := range st.Recent {
+		evt := events[i+1]
+		if r.Depth != evt.Depth || r.Reverted != len(evt.Reverted) || r.Applied != len(evt.Applied) {
+			t.Fatalf("expected reorg %d to match its event, got %+v", i, r)
+		}
+		if r.OldHead != evt.OldHead.Key() || r.NewHead != evt.NewHead.Key() {
+			t.Fatalf("expected reorg %d from %s to %s, got %+v", i, evt.OldHead.Key(), evt.NewHead.Key(), r)
+		}
+	}
+	if st.Recent[0].NewHead != chain[3].Key() || st.Recent[1].NewHead != fork[4].Key() {
+		t.Fatal("expected the recent reorgs to be ordered oldest first")
+	}
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"go.opencensus.io/tag"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/metrics"
+)
+
+// DefaultStateCacheSize is the number of objects the chain blockstore keeps
+// in memory by default
+const DefaultStateCacheSize = 16384
+
+var stateCacheTag = []tag.Mutator{tag.Upsert(metrics.ChainCache, "state")}
+
+// stateCache keeps the objects read from the chain blockstore in memory, the
+// prefetchers load the state a tipset is about to be executed on into it.
+// Has isn't answered from the cache: objects can be pruned, and bitswap
+// must not skip fetching objects which are only cached.
+type stateCache struct {
+	bstore.Blockstore
+
+	lk sync.RWMutex
+	// blocks is keyed by multihash like the blockstore, nil when disabled
+	blocks *lru.ARCCache
+}
+
+func newStateCache(bs bstore.Blockstore, size int) *stateCache {
+	sc := &stateCache{Blockstore: bs}
+	if size > 0 {
+		sc.blocks, _ = lru.NewARC(size)
+	}
+	return sc
+}
+
+func (sc *stateCache) cache() *lru.ARCCache {
+	sc.lk.RLock()
+	defer sc.lk.RUnlock()
+	return sc.blocks
+}
+
+func (sc *stateCache) Get(c cid.Cid) (block.Block, error) {
+	cache := sc.cache()
+	if cache == nil {
+		return sc.Blockstore.Get(c)
+	}
+
+	if v, ok := cache.Get(string(c.Hash())); ok {
+		recordCacheLookup(stateCacheTag, true)
+		blk := v.(block.Block)
+		if blk.Cid().Equals(c) {
+			return blk, nil
+		}
+		// same object, read with another codec
+		return block.NewBlockWithCid(blk.RawData(), c)
+	}
+	recordCacheLookup(stateCacheTag, false)
+
+	blk, err := sc.Blockstore.Get(c)
+	if err != nil {
+		return nil, err
+	}
+	cache.Add(string(c.Hash()), blk)
+	return blk, nil
+}
+
+func (sc *stateCache) GetSize(c cid.Cid) (int, error) {
+	if cache := sc.cache(); cache != nil {
+		if v, ok := cache.Get(string(c.Hash())); ok {
+			return len(v.(block.Block).RawData()), nil
+		}
+	}
+	return sc.Blockstore.GetSize(c)
+}
+
+func (sc *stateCache) DeleteBlock(c cid.Cid) error {
+	sc.evict(c)
+	return sc.Blockstore.DeleteBlock(c)
+}
+
+// evict drops the object from the cache, for objects removed from the
+// blockstore underneath it
+func (sc *stateCache) evict(c cid.Cid) {
+	if cache := sc.cache(); cache != nil {
+		cache.Remove(string(c.Hash()))
+	}
+}
+
+func (sc *stateCache) resize(size int) error {
+	var cache *lru.ARCCache
+	if size > 0 {
+		var err error
+		cache, err = lru.NewARC(size)
+		if err != nil {
+			return xerrors.Errorf("creating state cache: %w", err)
+		}
+	}
+
+	sc.lk.Lock()
+	sc.blocks = cache
+	sc.lk.Unlock()
+	return nil
+}
+
+// SetStateCacheSize sets the number of objects read from the blockstore which
+// are kept in memory, zero disables the cache. The cache is emptied.
+func (cs *ChainStore) SetStateCacheSize(objects int) error {
+	if objects < 0 {
+		return xerrors.Errorf("state cache size can't be negative: %d", objects)
+	}
+	return cs.stateCache.resize(objects)
+}
@@ -14,7 +14,6 @@ import (
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/specs-actors/actors/abi"
-	"github.com/filecoin-project/specs-actors/actors/runtime"
 	"github.com/filecoin-project/specs-actors/actors/util/adt"
 
 	"github.com/filecoin-project/lotus/api"
@@ -59,13 +58,23 @@ type ReorgNotifee func(rev, app []*types.TipSet) error
 // latest head tipset references) being tracked in the Datastore (key-value
 // store).
 //
-// To alleviate disk access, the ChainStore has two ARC caches:
+// To alleviate disk access, the ChainStore has four ARC caches:
 //   1. a tipset cache
-//   2. a block => messages references cache.
+//   2. a block header cache
+//   3. a block => messages references cache
+//   4. a cache of the objects read from the blockstore, mostly state.
 type ChainStore struct {
 	bs bstore.Blockstore
 	ds dstore.Datastore
 
+	guard      *pruneGuard
+	stateCache *stateCache
+	// pruneMarkDir is where the marks of prunes are kept, in memory if empty
+	pruneMarkDir string
+
+	pruneNotifeesLk sync.Mutex
+	pruneNotifees   []PruneNotifee
+
 	heaviestLk sync.Mutex
 	heaviest   *types.TipSet
 
@@ -79,24 +88,39 @@ type ChainStore struct {
 
 	reorgCh        chan<- reorg
 	reorgNotifeeCh chan ReorgNotifee
+	// reorgSeq is the id of the last journaled head change, guarded by
+	// heaviestLk
+	reorgSeq uint64
+	reorgs   *reorgStats
 
 	mmCache *lru.ARCCache
-	tsCache *lru.ARCCache
+	// cacheLk guards the tipset and header cache pointers, which are
+	// swapped by SetCacheSizes
+	cacheLk  sync.RWMutex
+	tsCache  *lru.ARCCache
+	hdrCache *lru.ARCCache
 
-	vmcalls runtime.Syscalls
+	vmcalls vm.Syscalls
 }
 
-func NewChainStore(bs bstore.Blockstore, ds dstore.Batching, vmcalls runtime.Syscalls) *ChainStore {
+func NewChainStore(bs bstore.Blockstore, ds dstore.Batching, vmcalls vm.Syscalls) *ChainStore {
 	c, _ := lru.NewARC(2048)
-	tsc, _ := lru.NewARC(4096)
+	tsc, _ := lru.NewARC(DefaultTipSetCacheSize)
+	hdrc, _ := lru.NewARC(DefaultHeaderCacheSize)
+	guard := NewPruneGuard(bs).(*pruneGuard)
+	sc := newStateCache(guard, DefaultStateCacheSize)
 	cs := &ChainStore{
-		bs:       bs,
-		ds:       ds,
-		bestTips: pubsub.New(64),
-		tipsets:  make(map[abi.ChainEpoch][]cid.Cid),
-		mmCache:  c,
-		tsCache:  tsc,
-		vmcalls:  vmcalls,
+		bs:         sc,
+		ds:         ds,
+		guard:      guard,
+		stateCache: sc,
+		bestTips:   pubsub.New(64),
+		tipsets:    make(map[abi.ChainEpoch][]cid.Cid),
+		mmCache:    c,
+		tsCache:    tsc,
+		hdrCache:   hdrc,
+		vmcalls:    vmcalls,
+		reorgs:     newReorgStats(),
 	}
 
 	ci := NewChainIndex(cs.LoadTipSet)
@@ -135,7 +159,7 @@ func NewChainStore(bs bstore.Blockstore, ds dstore.Batching, vmcalls runtime.Sys
 	}
 
 	cs.reorgNotifeeCh = make(chan ReorgNotifee)
-	cs.reorgCh = cs.reorgWorker(context.TODO(), []ReorgNotifee{hcnf, hcmetric})
+	cs.reorgCh = cs.reorgWorker(context.TODO(), []ReorgNotifee{hcnf, hcmetric, cs.notifyReorg})
 
 	return cs
 }
@@ -160,9 +184,20 @@ func (cs *ChainStore) Load() error {
 		return xerrors.Errorf("loading tipset: %w", err)
 	}
 
-	cs.heaviest = ts
+	rolledBack, err := cs.recoverReorgs()
+	if err != nil {
+		return xerrors.Errorf("recovering interrupted reorgs: %w", err)
+	}
+	if rolledBack == nil || rolledBack.Equals(ts) {
+		cs.heaviest = ts
+		return nil
+	}
 
-	return nil
+	// deliver the reverts of the interrupted change to the notifees
+	cs.heaviestLk.Lock()
+	defer cs.heaviestLk.Unlock()
+	cs.heaviest = ts
+	return cs.takeHeaviestTipSet(context.TODO(), rolledBack)
 }
 
 func (cs *ChainStore) writeHead(ts *types.TipSet) error {
@@ -303,6 +338,9 @@ func (cs *ChainStore) MaybeTakeHeavierTipSet(ctx context.Context, ts *types.TipS
 type reorg struct {
 	old *types.TipSet
 	new *types.TipSet
+
+	// id of the reorg journal entry, zero if it couldn't be journaled
+	id uint64
 }
 
 func (cs *ChainStore) reorgWorker(ctx context.Context, initialNotifees []ReorgNotifee) chan<- reorg {
@@ -319,14 +357,26 @@ func (cs *ChainStore) reorgWorker(ctx context.Context, initialNotifees []ReorgNo
 				notifees = append(notifees, n)
 
 			case r := <-out:
+				// the change is journaled before the new head is persisted,
+				// so that it is rolled back if the node stops before all the
+				// notifees processed it
+				if r.id != 0 {
+					if err := cs.journalReorg(r); err != nil {
+						log.Errorf("failed to journal head change: %s", err)
+						r.id = 0
+					}
+				}
+				if err := cs.writeHead(r.new); err != nil {
+					log.Errorf("failed to write chain head: %s", err)
+				}
+
 				revert, apply, err := cs.ReorgOps(r.old, r.new)
 				if err != nil {
 					log.Error("computing reorg ops failed: ", err)
 					continue
 				}
 
-				journal.Add("sync", map[string]interface{}{
-					"op":    "headChange",
+				journal.Record(journal.SysSync, journal.EvtHeadChange, map[string]interface{}{
 					"from":  r.old.Key(),
 					"to":    r.new.Key(),
 					"rev":   len(revert),
@@ -339,11 +389,19 @@ func (cs *ChainStore) reorgWorker(ctx context.Context, initialNotifees []ReorgNo
 					apply[i], apply[opp] = apply[opp], apply[i]
 				}
 
+				cs.evictReverted(revert)
+
 				for _, hcf := range notifees {
 					if err := hcf(revert, apply); err != nil {
 						log.Error("head change func errored (BAD): ", err)
 					}
 				}
+
+				if r.id != 0 {
+					if err := cs.finishReorg(r.id, len(revert), len(apply)); err != nil {
+						log.Errorf("marking reorg %d done: %s", r.id, err)
+					}
+				}
 			case <-ctx.Done():
 				return
 			}
@@ -363,12 +421,20 @@ func (cs *ChainStore) takeHeaviestTipSet(ctx context.Context, ts *types.TipSet)
 		if len(cs.reorgCh) > 0 {
 			log.Warnf("Reorg channel running behind, %d reorgs buffered", len(cs.reorgCh))
 		}
+
+		// the reorg worker journals the change and persists the head
+		cs.reorgSeq++
 		cs.reorgCh <- reorg{
 			old: cs.heaviest,
 			new: ts,
+			id:  cs.reorgSeq,
 		}
 	} else {
 		log.Warnf("no heaviest tipset found, using %s", ts.Cids())
+
+		if err := cs.writeHead(ts); err != nil {
+			log.Errorf("failed to write chain head: %s", err)
+		}
 	}
 
 	span.AddAttributes(trace.BoolAttribute("newHead", true))
@@ -376,11 +442,6 @@ func (cs *ChainStore) takeHeaviestTipSet(ctx context.Context, ts *types.TipSet)
 	log.Infof("New heaviest tipset! %s (height=%d)", ts.Cids(), ts.Height())
 	cs.heaviest = ts
 
-	if err := cs.writeHead(ts); err != nil {
-		log.Errorf("failed to write chain head: %s", err)
-		return nil
-	}
-
 	return nil
 }
 
@@ -410,16 +471,31 @@ func (cs *ChainStore) Contains(ts *types.TipSet) (bool, error) {
 // GetBlock fetches a BlockHeader with the supplied CID. It returns
 // blockstore.ErrNotFound if the block was not found in the BlockStore.
 func (cs *ChainStore) GetBlock(c cid.Cid) (*types.BlockHeader, error) {
+	_, hdrCache := cs.caches()
+	v, ok := hdrCache.Get(c)
+	recordCacheLookup(headerCacheTag, ok)
+	if ok {
+		return v.(*types.BlockHeader), nil
+	}
+
 	sb, err := cs.bs.Get(c)
 	if err != nil {
 		return nil, err
 	}
 
-	return types.DecodeBlock(sb.RawData())
+	blk, err := types.DecodeBlock(sb.RawData())
+	if err != nil {
+		return nil, err
+	}
+
+	hdrCache.Add(c, blk)
+	return blk, nil
 }
 
 func (cs *ChainStore) LoadTipSet(tsk types.TipSetKey) (*types.TipSet, error) {
-	v, ok := cs.tsCache.Get(tsk)
+	tsCache, _ := cs.caches()
+	v, ok := tsCache.Get(tsk)
+	recordCacheLookup(tipsetCacheTag, ok)
 	if ok {
 		return v.(*types.TipSet), nil
 	}
@@ -439,7 +515,7 @@ func (cs *ChainStore) LoadTipSet(tsk types.TipSetKey) (*types.TipSet, error) {
 		return nil, err
 	}
 
-	cs.tsCache.Add(tsk, ts)
+	tsCache.Add(tsk, ts)
 
 	return ts, nil
 }
@@ -921,7 +997,7 @@ func (cs *ChainStore) Store(ctx context.Context) adt.Store {
 	return ActorStore(ctx, cs.bs)
 }
 
-func (cs *ChainStore) VMSys() runtime.Syscalls {
+func (cs *ChainStore) VMSys() vm.Syscalls {
 	return cs.vmcalls
 }
 
@@ -1063,10 +1139,26 @@ func recurseLinks(bs blockstore.Blockstore, root cid.Cid, in []cid.Cid) ([]cid.C
 	return in, nil
 }
 
-func (cs *ChainStore) Export(ctx context.Context, ts *types.TipSet, w io.Writer) error {
+// Export writes a CAR file of the chain up to the given tipset, with all
+// headers from genesis, and the genesis state. The state, messages and
+// receipts of the last inclRecentRoots epochs are included as well, which
+// makes the file a snapshot nodes can continue syncing from without
+// recomputing the state of the whole chain. The messages and receipts of
+// older tipsets are only included with includeMessages.
+func (cs *ChainStore) Export(ctx context.Context, ts *types.TipSet, inclRecentRoots abi.ChainEpoch, includeMessages bool, w io.Writer) error {
+	return cs.ExportRange(ctx, ts, 0, inclRecentRoots, includeMessages, w)
+}
+
+// ExportRange is Export bounded to the headers of the last depth epochs, the
+// chain is exported from genesis when depth is 0. Bounded exports can't be
+// imported by nodes without the older part of the chain.
+func (cs *ChainStore) ExportRange(ctx context.Context, ts *types.TipSet, depth, inclRecentRoots abi.ChainEpoch, includeMessages bool, w io.Writer) error {
 	if ts == nil {
 		ts = cs.GetHeaviestTipSet()
 	}
+	if depth < 0 {
+		return xerrors.Errorf("negative export depth %d", depth)
+	}
 
 	seen := cid.NewSet()
 
@@ -1081,6 +1173,38 @@ func (cs *ChainStore) Export(ctx context.Context, ts *types.TipSet, w io.Writer)
 
 	blocksToWalk := ts.Cids()
 
+	// writeDag writes the objects of a dag which weren't written yet. State
+	// trees of neighbouring tipsets share most of their nodes, so they're
+	// only walked into where they differ.
+	var writeDag func(c cid.Cid) error
+	writeDag = func(c cid.Cid) error {
+		if !seen.Visit(c) {
+			return nil
+		}
+		if c.Prefix().Codec != cid.DagCBOR {
+			return nil
+		}
+
+		data, err := cs.bs.Get(c)
+		if err != nil {
+			return xerrors.Errorf("writing object to car (get %s): %w", c, err)
+		}
+		if err := carutil.LdWrite(w, c.Bytes(), data.RawData()); err != nil {
+			return xerrors.Errorf("failed to write out car object: %w", err)
+		}
+
+		links, err := cbg.ScanForLinks(bytes.NewReader(data.RawData()))
+		if err != nil {
+			return xerrors.Errorf("scanning for links failed: %w", err)
+		}
+		for _, l := range links {
+			if err := writeDag(l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	walkChain := func(blk cid.Cid) error {
 		if !seen.Visit(blk) {
 			return nil
@@ -1091,25 +1215,33 @@ func (cs *ChainStore) Export(ctx context.Context, ts *types.TipSet, w io.Writer)
 			return xerrors.Errorf("getting block: %w", err)
 		}
 
-		if err := carutil.LdWrite(w, blk.Bytes(), data.RawData()); err != nil {
-			return xerrors.Errorf("failed to write block to car output: %w", err)
-		}
-
 		var b types.BlockHeader
 		if err := b.UnmarshalCBOR(bytes.NewBuffer(data.RawData())); err != nil {
 			return xerrors.Errorf("unmarshaling block header (cid=%s): %w", blk, err)
 		}
+		if depth > 0 && b.Height <= ts.Height()-depth {
+			return nil
+		}
+
+		if err := carutil.LdWrite(w, blk.Bytes(), data.RawData()); err != nil {
+			return xerrors.Errorf("failed to write block to car output: %w", err)
+		}
 
 		for _, p := range b.Parents {
 			blocksToWalk = append(blocksToWalk, p)
 		}
 
-		cids, err := recurseLinks(cs.bs, b.Messages, []cid.Cid{b.Messages})
-		if err != nil {
-			return xerrors.Errorf("recursing messages failed: %w", err)
-		}
+		recent := b.Height > ts.Height()-inclRecentRoots
+
+		var out []cid.Cid
+		if includeMessages || recent {
+			cids, err := recurseLinks(cs.bs, b.Messages, []cid.Cid{b.Messages})
+			if err != nil {
+				return xerrors.Errorf("recursing messages failed: %w", err)
+			}
 
-		out := cids
+			out = cids
+		}
 
 		if b.Height == 0 {
 			cids, err := recurseLinks(cs.bs, b.ParentStateRoot, []cid.Cid{b.ParentStateRoot})
@@ -1118,6 +1250,16 @@ func (cs *ChainStore) Export(ctx context.Context, ts *types.TipSet, w io.Writer)
 			}
 
 			out = append(out, cids...)
+		} else if recent {
+			if err := writeDag(b.ParentStateRoot); err != nil {
+				return xerrors.Errorf("writing state root of block at height %d: %w", b.Height, err)
+			}
+		}
+
+		if b.Height > 0 && (includeMessages || recent) {
+			if err := writeDag(b.ParentMessageReceipts); err != nil {
+				return xerrors.Errorf("writing receipts of block at height %d: %w", b.Height, err)
+			}
 		}
 
 		for _, c := range out {
@@ -1164,6 +1306,39 @@ func (cs *ChainStore) Import(r io.Reader) (*types.TipSet, error) {
 	return root, nil
 }
 
+// CheckSnapshot checks that the headers of an imported tipset link back to the
+// genesis of the chain store, if it has one, and that the state of the tipset
+// is available, so that the chain can be synced from it without recomputing
+// its state.
+func (cs *ChainStore) CheckSnapshot(ctx context.Context, ts *types.TipSet) error {
+	root, err := cs.GetTipsetByHeight(ctx, 0, ts, false)
+	if err != nil {
+		return xerrors.Errorf("walking snapshot headers to genesis: %w", err)
+	}
+
+	gen, err := cs.GetGenesis()
+	switch {
+	case err == dstore.ErrNotFound:
+		// first run, the genesis is set up from the snapshot
+	case err != nil:
+		return xerrors.Errorf("getting genesis: %w", err)
+	case root.Cids()[0] != gen.Cid():
+		return xerrors.Errorf("snapshot genesis %s doesn't match the node genesis %s", root.Cids()[0], gen.Cid())
+	}
+
+	for _, c := range []cid.Cid{ts.ParentState(), ts.Blocks()[0].ParentMessageReceipts} {
+		has, err := cs.bs.Has(c)
+		if err != nil {
+			return xerrors.Errorf("checking for snapshot state: %w", err)
+		}
+		if !has {
+			return xerrors.Errorf("snapshot doesn't contain the state of tipset %s (missing %s)", ts.Cids(), c)
+		}
+	}
+
+	return nil
+}
+
 func (cs *ChainStore) GetLatestBeaconEntry(ts *types.TipSet) (*types.BeaconEntry, error) {
 	cur := ts
 	for i := 0; i < 20; i++ {
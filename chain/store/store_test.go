@@ -5,6 +5,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/ipfs/go-cid"
 	datastore "github.com/ipfs/go-datastore"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 
@@ -96,7 +97,7 @@ func TestChainExportImport(t *testing.T) {
 	}
 
 	buf := new(bytes.Buffer)
-	if err := cg.ChainStore().Export(context.TODO(), last, buf); err != nil {
+	if err := cg.ChainStore().Export(context.TODO(), last, 0, true, buf); err != nil {
 		t.Fatal(err)
 	}
 
@@ -112,3 +113,78 @@ func TestChainExportImport(t *testing.T) {
 		t.Fatal("imported chain differed from exported chain")
 	}
 }
+
+func TestChainExportOptions(t *testing.T) {
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last *types.TipSet
+	for i := 0; i < 20; i++ {
+		ts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		last = ts.TipSet.TipSet()
+	}
+
+	export := func(depth, nroots abi.ChainEpoch, includeMessages bool) *store.ChainStore {
+		buf := new(bytes.Buffer)
+		if err := cg.ChainStore().ExportRange(context.TODO(), last, depth, nroots, includeMessages, buf); err != nil {
+			t.Fatal(err)
+		}
+
+		cs := store.NewChainStore(blockstore.NewBlockstore(datastore.NewMapDatastore()), datastore.NewMapDatastore(), nil)
+		if _, err := cs.Import(buf); err != nil {
+			t.Fatal(err)
+		}
+		return cs
+	}
+	has := func(cs *store.ChainStore, c cid.Cid) bool {
+		ok, err := cs.Blockstore().Has(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	// old messages and receipts are left out
+	cs := export(0, 5, false)
+	for ts := last; ts.Height() > 0; {
+		recent := ts.Height() > last.Height()-5
+		b := ts.Blocks()[0]
+		if !has(cs, b.Cid()) {
+			t.Fatalf("expected the header at height %d to be exported", ts.Height())
+		}
+		// receipts of different tipsets can be the same, only the messages
+		// tell old tipsets apart
+		if has(cs, b.Messages) != recent || (recent && !has(cs, b.ParentMessageReceipts)) {
+			t.Fatalf("expected the messages and receipts at height %d to be exported: %t", ts.Height(), recent)
+		}
+
+		var err error
+		ts, err = cg.ChainStore().LoadTipSet(ts.Parents())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// bounded exports stop at the depth
+	cs = export(5, 0, true)
+	for ts := last; ts.Height() > 0; {
+		if has(cs, ts.Blocks()[0].Cid()) != (ts.Height() > last.Height()-5) {
+			t.Fatalf("expected only the headers of the last 5 epochs to be exported, height %d", ts.Height())
+		}
+
+		var err error
+		ts, err = cg.ChainStore().LoadTipSet(ts.Parents())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if has(cs, cg.Genesis().Cid()) {
+		t.Fatal("expected the genesis not to be exported")
+	}
+}
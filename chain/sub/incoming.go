@@ -60,15 +60,19 @@ func HandleIncomingBlocks(ctx context.Context, bsub *pubsub.Subscription, s *cha
 		src := msg.GetFrom()
 
 		go func() {
+			// messages fetched after the next epoch started are of no use
+			ctx, cancel := context.WithTimeout(ctx, time.Duration(build.BlockDelaySecs)*time.Second)
+			defer cancel()
+
 			start := time.Now()
 			log.Debug("about to fetch messages for block from pubsub")
-			bmsgs, err := s.Bsync.FetchMessagesByCids(context.TODO(), blk.BlsMessages)
+			bmsgs, err := s.Bsync.FetchMessagesByCids(ctx, blk.BlsMessages)
 			if err != nil {
 				log.Errorf("failed to fetch all bls messages for block received over pubusb: %s; source: %s", err, src)
 				return
 			}
 
-			smsgs, err := s.Bsync.FetchSignedMessagesByCids(context.TODO(), blk.SecpkMessages)
+			smsgs, err := s.Bsync.FetchSignedMessagesByCids(ctx, blk.SecpkMessages)
 			if err != nil {
 				log.Errorf("failed to fetch all secpk messages for block received over pubusb: %s; source: %s", err, src)
 				return
@@ -375,6 +379,9 @@ func (mv *MessageValidator) Validate(ctx context.Context, pid peer.ID, msg *pubs
 		switch {
 		case xerrors.Is(err, messagepool.ErrBroadcastAnyway):
 			return pubsub.ValidationIgnore
+		case xerrors.Is(err, messagepool.ErrPendingFundsExceeded):
+			// depends on the messages we've seen, don't penalize the peer
+			return pubsub.ValidationIgnore
 		default:
 			return pubsub.ValidationReject
 		}
@@ -108,9 +108,24 @@ type Syncer struct {
 
 	incoming *pubsub.PubSub
 
+	// state changes of the sync workers, for SyncProgress
+	stateSubs syncStateSubs
+
 	receiptTracker *blockReceiptTracker
 
 	verifier ffiwrapper.Verifier
+
+	// loads the data of the next tipset while the current one is validated
+	prefetcher Prefetcher
+
+	// blocks being validated by the sync workers
+	validations *blockValidations
+
+	// tipsets synced chains must contain
+	checkpoints *Checkpoints
+
+	// how block timestamps are checked
+	clockSkew ClockSkewPolicy
 }
 
 // NewSyncer creates a new Syncer object.
@@ -125,6 +140,11 @@ func NewSyncer(sm *stmgr.StateManager, bsync *blocksync.BlockSync, connmgr connm
 		return nil, err
 	}
 
+	cps, err := NewCheckpoints(nil)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &Syncer{
 		beacon:         beacon,
 		bad:            NewBadBlockCache(),
@@ -136,14 +156,50 @@ func NewSyncer(sm *stmgr.StateManager, bsync *blocksync.BlockSync, connmgr connm
 		receiptTracker: newBlockReceiptTracker(),
 		connmgr:        connmgr,
 		verifier:       verifier,
+		prefetcher:     NoopPrefetcher(),
+		validations:    newBlockValidations(),
+		checkpoints:    cps,
+		clockSkew:      DefaultClockSkewPolicy(),
 
 		incoming: pubsub.New(50),
 	}
 
 	s.syncmgr = NewSyncManager(s.Sync)
+	s.syncmgr.stateNotify = s.publishSyncState
 	return s, nil
 }
 
+// SetPrefetcher sets the prefetcher used while validating tipsets. It must be
+// called before the syncer is started.
+func (syncer *Syncer) SetPrefetcher(p Prefetcher) {
+	syncer.prefetcher = p
+}
+
+// SetSyncWorkers sets the number of sync targets, usually independent
+// branches, validated in parallel. It must be called before the syncer is
+// started.
+func (syncer *Syncer) SetSyncWorkers(n SyncWorkers) {
+	syncer.syncmgr.SetWorkers(n)
+}
+
+// SetSyncTargetThreshold sets the number of times a chain has to be reported
+// before it's synced. It must be called before the syncer is started.
+func (syncer *Syncer) SetSyncTargetThreshold(n SyncTargetThreshold) {
+	syncer.syncmgr.SetTargetThreshold(n)
+}
+
+// SetCheckpoints sets the checkpoints synced chains must contain. It must be
+// called before the syncer is started.
+func (syncer *Syncer) SetCheckpoints(cps *Checkpoints) {
+	syncer.checkpoints = cps
+}
+
+// SetClockSkewPolicy sets how block timestamps are checked. It must be called
+// before the syncer is started.
+func (syncer *Syncer) SetClockSkewPolicy(p ClockSkewPolicy) {
+	syncer.clockSkew = p
+}
+
 func (syncer *Syncer) Start() {
 	syncer.syncmgr.Start()
 }
@@ -417,8 +473,8 @@ func computeMsgMeta(bs cbor.IpldStore, bmsgCids, smsgCids []cbg.CBORMarshaler) (
 }
 
 // FetchTipSet tries to load the provided tipset from the store, and falls back
-// to the network (BlockSync) by querying the supplied peer if not found
-// locally.
+// to the network (BlockSync) if not found locally. The supplied peer is
+// queried first, then the other sync peers.
 //
 // {hint/usage} This is used from the HELLO protocol, to fetch the greeting
 // peer's heaviest tipset if we don't have it.
@@ -535,7 +591,7 @@ func (syncer *Syncer) ValidateTipSet(ctx context.Context, fts *store.FullTipSet)
 		b := b // rebind to a scoped variable
 
 		futures = append(futures, async.Err(func() error {
-			if err := syncer.ValidateBlock(ctx, b); err != nil {
+			if err := syncer.validations.validate(ctx, b, syncer.ValidateBlock); err != nil {
 				if isPermanent(err) {
 					syncer.bad.Add(b.Cid(), NewBadBlockReason([]cid.Cid{b.Cid()}, err.Error()))
 				}
@@ -666,19 +722,8 @@ func (syncer *Syncer) ValidateBlock(ctx context.Context, b *types.FullBlock) (er
 
 	// fast checks first
 
-	now := uint64(time.Now().Unix())
-	if h.Timestamp > now+build.AllowableClockDriftSecs {
-		return xerrors.Errorf("block was from the future (now=%d, blk=%d): %w", now, h.Timestamp, ErrTemporal)
-	}
-	if h.Timestamp > now {
-		log.Warn("Got block from the future, but within threshold", h.Timestamp, time.Now().Unix())
-	}
-
-	if h.Timestamp < baseTs.MinTimestamp()+(build.BlockDelaySecs*uint64(h.Height-baseTs.Height())) {
-		log.Warn("timestamp funtimes: ", h.Timestamp, baseTs.MinTimestamp(), h.Height, baseTs.Height())
-		diff := (baseTs.MinTimestamp() + (build.BlockDelaySecs * uint64(h.Height-baseTs.Height()))) - h.Timestamp
-
-		return xerrors.Errorf("block was generated too soon (h.ts:%d < base.mints:%d + BLOCK_DELAY:%d * deltaH:%d; diff %d)", h.Timestamp, baseTs.MinTimestamp(), build.BlockDelaySecs, h.Height-baseTs.Height(), diff)
+	if err := syncer.clockSkew.checkTimestamp(h, baseTs, uint64(time.Now().Unix())); err != nil {
+		return err
 	}
 
 	msgsCheck := async.Err(func() error {
@@ -1150,6 +1195,10 @@ func (syncer *Syncer) collectHeaders(ctx context.Context, incoming *types.TipSet
 		}
 	}
 
+	if err := syncer.checkCheckpoint(incoming, incoming, incoming.Height()+1, true); err != nil {
+		return nil, err
+	}
+
 	blockSet := []*types.TipSet{incoming}
 
 	at := incoming.Parents()
@@ -1177,6 +1226,9 @@ loop:
 		// If, for some reason, we have a suffix of the chain locally, handle that here
 		ts, err := syncer.store.LoadTipSet(at)
 		if err == nil {
+			if err := syncer.checkCheckpoint(incoming, ts, blockSet[len(blockSet)-1].Height(), false); err != nil {
+				return nil, err
+			}
 			acceptedBlocks = append(acceptedBlocks, at.Cids()...)
 
 			blockSet = append(blockSet, ts)
@@ -1194,8 +1246,14 @@ loop:
 		if gap := int(blockSet[len(blockSet)-1].Height() - untilHeight); gap < window {
 			window = gap
 		}
-		blks, err := syncer.Bsync.GetBlocks(ctx, at, window)
+
+		// Tipsets are streamed, so that they are checked while the rest of
+		// the window is still being fetched.
+		sctx, cancel := context.WithCancel(ctx)
+		blks, err := syncer.Bsync.GetBlocksStream(sctx, at, window)
 		if err != nil {
+			cancel()
+
 			// Most likely our peers aren't fully synced yet, but forwarded
 			// new block message (ideally we'd find better peers)
 
@@ -1206,14 +1264,17 @@ loop:
 			// This error will only be logged above,
 			return nil, xerrors.Errorf("failed to get blocks: %w", err)
 		}
-		log.Info("Got blocks: ", blks[0].Height(), len(blks))
 
-		for _, b := range blks {
+		var last *types.TipSet
+		got := 0
+		for b := range blks {
 			if b.Height() < untilHeight {
+				cancel()
 				break loop
 			}
 			for _, bc := range b.Cids() {
 				if reason, ok := syncer.bad.Has(bc); ok {
+					cancel()
 					newReason := reason.Linked("change contained %s", bc)
 					for _, b := range acceptedBlocks {
 						syncer.bad.Add(b, newReason)
@@ -1222,13 +1283,30 @@ loop:
 					return nil, xerrors.Errorf("chain contained block marked previously as bad (%s, %s) (reason: %s)", incoming.Cids(), bc, reason)
 				}
 			}
+			// fetched chains are checked against the checkpoints as they
+			// arrive, so that long-range forks are refused before reaching
+			// the tipsets we have
+			if err := syncer.checkCheckpoint(incoming, b, blockSet[len(blockSet)-1].Height(), true); err != nil {
+				cancel()
+				return nil, err
+			}
 			blockSet = append(blockSet, b)
+			ss.SetHeight(b.Height())
+			last = b
+			got++
+		}
+		cancel()
+
+		if last == nil {
+			span.AddAttributes(trace.StringAttribute("error", "no tipsets received"))
+			return nil, xerrors.Errorf("failed to get blocks: no tipsets received from %s", at)
 		}
+		log.Info("Got blocks: ", last.Height(), got)
 
 		acceptedBlocks = append(acceptedBlocks, at.Cids()...)
 
-		ss.SetHeight(blks[len(blks)-1].Height())
-		at = blks[len(blks)-1].Parents()
+		// a partially received window is continued from where it stopped
+		at = last.Parents()
 	}
 
 	// base is the tipset in the candidate chain at the height equal to our known tipset height.
@@ -1240,6 +1318,12 @@ loop:
 
 		// We have now ascertained that this is *not* a 'fast forward'
 
+		// the candidate chain ends below checkpoints of our chain, taking it
+		// would reorg them away
+		if h, ok := syncer.checkpoints.Between(incoming.Height(), known.Height()+1); ok {
+			return nil, xerrors.Errorf("fork at height %d ends below the checkpoint at height %d: %w", incoming.Height(), h, ErrForkBelowCheckpoint)
+		}
+
 		log.Warnf("(fork detected) synced header chain (%s - %d) does not link to our best block (%s - %d)", incoming.Cids(), incoming.Height(), known.Cids(), known.Height())
 		fork, err := syncer.syncFork(ctx, base, known)
 		if err != nil {
@@ -1253,12 +1337,51 @@ loop:
 			return nil, xerrors.Errorf("failed to sync fork: %w", err)
 		}
 
+		child := base
+		for _, ts := range fork {
+			if err := syncer.checkCheckpoint(incoming, ts, child.Height(), true); err != nil {
+				return nil, xerrors.Errorf("fork reorgs the chain below a checkpoint: %w", err)
+			}
+			child = ts
+		}
+
 		blockSet = append(blockSet, fork...)
+	} else if h, ok := syncer.checkpoints.Between(known.Height(), base.Height()); ok {
+		return nil, xerrors.Errorf("chain skips the checkpoint at height %d: %w", h, ErrCheckpointMismatch)
 	}
 
 	return blockSet, nil
 }
 
+// checkCheckpoint checks the link between a tipset of the incoming chain and
+// its child at the given height against the checkpoints. Fetched tipsets at
+// the height of a checkpoint they don't match are added to the denylist, with
+// the incoming tipset. Tipsets we have locally may be valid blocks of another
+// fork, conflicts found there are only returned.
+func (syncer *Syncer) checkCheckpoint(incoming, ts *types.TipSet, childHeight abi.ChainEpoch, fetched bool) error {
+	err := syncer.checkpoints.CheckLink(ts, childHeight)
+	if err == nil {
+		return nil
+	}
+
+	if fetched {
+		reason := NewBadBlockReason(ts.Cids(), "conflicts with checkpoint: %s", err)
+		if syncer.checkpoints.Conflicts(ts) {
+			for _, b := range ts.Cids() {
+				syncer.bad.Add(b, reason)
+			}
+		}
+		if incoming != ts {
+			linked := reason.Linked("chain contained %s", ts.Cids())
+			for _, b := range incoming.Cids() {
+				syncer.bad.Add(b, linked)
+			}
+		}
+	}
+
+	return xerrors.Errorf("chain %s: %w", incoming.Cids(), err)
+}
+
 var ErrForkTooLong = fmt.Errorf("fork longer than threshold")
 
 // syncFork tries to obtain the chain fragment that links a fork into a common
@@ -1334,6 +1457,9 @@ func (syncer *Syncer) iterFullTipsets(ctx context.Context, headers []*types.TipS
 			return err
 		}
 		if fts != nil {
+			if i > 0 {
+				syncer.prefetcher.Prefetch(ctx, headers[i-1], nil)
+			}
 			if err := cb(ctx, fts); err != nil {
 				return err
 			}
@@ -1378,6 +1504,11 @@ func (syncer *Syncer) iterFullTipsets(ctx context.Context, headers []*types.TipS
 				return xerrors.Errorf("message processing failed: %w", err)
 			}
 
+			if bsi+1 < len(bstout) {
+				next := bstout[len(bstout)-(bsi+2)]
+				syncer.prefetcher.Prefetch(ctx, headers[i-bsi-1], bsTipSetMessages(next))
+			}
+
 			if err := cb(ctx, fts); err != nil {
 				return err
 			}
@@ -1396,6 +1527,17 @@ func (syncer *Syncer) iterFullTipsets(ctx context.Context, headers []*types.TipS
 	return nil
 }
 
+func bsTipSetMessages(bst *blocksync.BSTipSet) []types.ChainMsg {
+	out := make([]types.ChainMsg, 0, len(bst.BlsMessages)+len(bst.SecpkMessages))
+	for _, m := range bst.BlsMessages {
+		out = append(out, m)
+	}
+	for _, m := range bst.SecpkMessages {
+		out = append(out, m)
+	}
+	return out
+}
+
 func persistMessages(bs bstore.Blockstore, bst *blocksync.BSTipSet) error {
 	for _, m := range bst.BlsMessages {
 		//log.Infof("putting BLS message: %s", m.Cid())
@@ -6,11 +6,20 @@ import (
 	"sync"
 
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/journal"
+	"github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
 const BootstrapPeerThreshold = 2
 
+// SyncTargetThreshold is the number of times a chain (or an equivalent head on
+// it) has to be reported before we start syncing to it. Buckets that don't
+// meet the threshold stay queued until more reports arrive.
+type SyncTargetThreshold int
+
+const DefaultSyncTargetThreshold SyncTargetThreshold = 1
+
 const (
 	BSStateInit      = 0
 	BSStateSelected  = 1
@@ -29,12 +38,21 @@ type SyncManager struct {
 
 	bspThresh int
 
+	// minimum bucket count for a bucket to be picked as a sync target
+	targetThresh int
+
 	incomingTipSets chan *types.TipSet
 	syncTargets     chan *types.TipSet
 	syncResults     chan *syncResult
 
+	// number of sync workers, which fetch and validate independent
+	// branches in parallel
+	workers    int
 	syncStates []*SyncerState
 
+	// if set, called whenever the state of a sync worker changes
+	stateNotify func(worker int, ss *SyncerState)
+
 	// Normally this handler is set to `(*Syncer).Sync()`.
 	doSync func(context.Context, *types.TipSet) error
 
@@ -53,15 +71,21 @@ type syncResult struct {
 	success bool
 }
 
-const syncWorkerCount = 3
+// SyncWorkers is the number of sync targets, usually independent branches of
+// the chain, which are fetched and validated in parallel
+type SyncWorkers int
+
+const DefaultSyncWorkers SyncWorkers = 3
 
 func NewSyncManager(sync SyncFunc) *SyncManager {
 	return &SyncManager{
 		bspThresh:       1,
+		targetThresh:    int(DefaultSyncTargetThreshold),
 		peerHeads:       make(map[peer.ID]*types.TipSet),
 		syncTargets:     make(chan *types.TipSet),
 		syncResults:     make(chan *syncResult),
-		syncStates:      make([]*SyncerState, syncWorkerCount),
+		workers:         int(DefaultSyncWorkers),
+		syncStates:      make([]*SyncerState, DefaultSyncWorkers),
 		incomingTipSets: make(chan *types.TipSet),
 		activeSyncs:     make(map[types.TipSetKey]*types.TipSet),
 		doSync:          sync,
@@ -69,9 +93,28 @@ func NewSyncManager(sync SyncFunc) *SyncManager {
 	}
 }
 
+// SetWorkers sets the number of sync workers. It must be called before the
+// sync manager is started.
+func (sm *SyncManager) SetWorkers(n SyncWorkers) {
+	if n < 1 {
+		n = 1
+	}
+	sm.workers = int(n)
+	sm.syncStates = make([]*SyncerState, n)
+}
+
+// SetTargetThreshold sets the number of reports a chain needs to become a sync
+// target. It must be called before the sync manager is started.
+func (sm *SyncManager) SetTargetThreshold(n SyncTargetThreshold) {
+	if n < 1 {
+		n = 1
+	}
+	sm.targetThresh = int(n)
+}
+
 func (sm *SyncManager) Start() {
 	go sm.syncScheduler()
-	for i := 0; i < syncWorkerCount; i++ {
+	for i := 0; i < sm.workers; i++ {
 		go sm.syncWorker(i)
 	}
 }
@@ -137,9 +180,18 @@ func (sbs *syncBucketSet) Insert(ts *types.TipSet) {
 }
 
 func (sbs *syncBucketSet) Pop() *syncTargetBucket {
+	return sbs.PopHeaviest(0)
+}
+
+// PopHeaviest removes and returns the heaviest bucket that was reported at
+// least minCount times, or nil if no bucket qualifies.
+func (sbs *syncBucketSet) PopHeaviest(minCount int) *syncTargetBucket {
 	var bestBuck *syncTargetBucket
 	var bestTs *types.TipSet
 	for _, b := range sbs.buckets {
+		if b.count < minCount {
+			continue
+		}
 		hts := b.heaviestTipSet()
 		if bestBuck == nil || bestTs.ParentWeight().LessThan(hts.ParentWeight()) {
 			bestBuck = b
@@ -147,6 +199,10 @@ func (sbs *syncBucketSet) Pop() *syncTargetBucket {
 		}
 	}
 
+	if bestBuck == nil {
+		return nil
+	}
+
 	sbs.removeBucket(bestBuck)
 
 	return bestBuck
@@ -198,6 +254,12 @@ func (stb *syncTargetBucket) sameChainAs(ts *types.TipSet) bool {
 		if ts.Equals(t) {
 			return true
 		}
+		// competing tipsets on the same parents share their history, the
+		// ones with blocks the heaviest doesn't include are synced in
+		// parallel to it, see competing
+		if ts.Height() == t.Height() && ts.Parents() == t.Parents() {
+			return true
+		}
 		if ts.Key() == t.Parents() {
 			return true
 		}
@@ -220,6 +282,43 @@ func (stb *syncTargetBucket) add(ts *types.TipSet) {
 	stb.tips = append(stb.tips, ts)
 }
 
+// competing returns the tipsets in the bucket which aren't on the chain of ts,
+// and have blocks ts and its ancestors in the bucket don't include. They are
+// independent branches, which can be validated in parallel to ts.
+func (stb *syncTargetBucket) competing(ts *types.TipSet) []*types.TipSet {
+	onChain := map[types.TipSetKey]bool{ts.Key(): true}
+	included := map[cid.Cid]bool{}
+	for cur := ts; cur != nil; {
+		for _, c := range cur.Cids() {
+			included[c] = true
+		}
+
+		var parent *types.TipSet
+		for _, t := range stb.tips {
+			if t.Key() == cur.Parents() && !onChain[t.Key()] {
+				parent = t
+				onChain[t.Key()] = true
+				break
+			}
+		}
+		cur = parent
+	}
+
+	var out []*types.TipSet
+	for _, t := range stb.tips {
+		if onChain[t.Key()] {
+			continue
+		}
+		for _, c := range t.Cids() {
+			if !included[c] {
+				out = append(out, t)
+				break
+			}
+		}
+	}
+	return out
+}
+
 func (stb *syncTargetBucket) heaviestTipSet() *types.TipSet {
 	if stb == nil {
 		return nil
@@ -322,12 +421,23 @@ func (sm *SyncManager) scheduleIncoming(ts *types.TipSet) {
 		sm.syncQueue.Insert(ts)
 
 		if sm.nextSyncTarget == nil {
-			sm.nextSyncTarget = sm.syncQueue.Pop()
-			sm.workerChan = sm.syncTargets
+			sm.popNextSyncTarget()
 		}
 	}
 }
 
+// popNextSyncTarget selects the heaviest queued bucket meeting the sync target
+// threshold as the next sync target, and arms the worker channel if there is
+// one.
+func (sm *SyncManager) popNextSyncTarget() {
+	sm.nextSyncTarget = sm.syncQueue.PopHeaviest(sm.targetThresh)
+	if sm.nextSyncTarget != nil {
+		sm.workerChan = sm.syncTargets
+	} else {
+		sm.workerChan = nil
+	}
+}
+
 func (sm *SyncManager) scheduleProcessResult(res *syncResult) {
 	if res.success && sm.getBootstrapState() != BSStateComplete {
 		sm.setBootstrapState(BSStateComplete)
@@ -336,11 +446,9 @@ func (sm *SyncManager) scheduleProcessResult(res *syncResult) {
 	relbucket := sm.activeSyncTips.PopRelated(res.ts)
 	if relbucket != nil {
 		if res.success {
+			sm.syncQueue.buckets = append(sm.syncQueue.buckets, relbucket)
 			if sm.nextSyncTarget == nil {
-				sm.nextSyncTarget = relbucket
-				sm.workerChan = sm.syncTargets
-			} else {
-				sm.syncQueue.buckets = append(sm.syncQueue.buckets, relbucket)
+				sm.popNextSyncTarget()
 			}
 			return
 		} else {
@@ -352,11 +460,7 @@ func (sm *SyncManager) scheduleProcessResult(res *syncResult) {
 	}
 
 	if sm.nextSyncTarget == nil && !sm.syncQueue.Empty() {
-		next := sm.syncQueue.Pop()
-		if next != nil {
-			sm.nextSyncTarget = next
-			sm.workerChan = sm.syncTargets
-		}
+		sm.popNextSyncTarget()
 	}
 }
 
@@ -364,16 +468,32 @@ func (sm *SyncManager) scheduleWorkSent() {
 	hts := sm.nextSyncTarget.heaviestTipSet()
 	sm.activeSyncs[hts.Key()] = hts
 
-	if !sm.syncQueue.Empty() {
-		sm.nextSyncTarget = sm.syncQueue.Pop()
-	} else {
-		sm.nextSyncTarget = nil
-		sm.workerChan = nil
+	// requeue the competing branches of the target with its report count, so
+	// that the free workers validate them in parallel instead of dropping
+	// them when the heaviest one turns out to be invalid
+	var competing []*types.TipSet
+	for _, ts := range sm.nextSyncTarget.competing(hts) {
+		if _, ok := sm.activeSyncs[ts.Key()]; !ok {
+			competing = append(competing, ts)
+		}
+	}
+	if len(competing) > 0 {
+		sm.syncQueue.buckets = append(sm.syncQueue.buckets, &syncTargetBucket{
+			tips:  competing,
+			count: sm.nextSyncTarget.count,
+		})
 	}
+
+	sm.popNextSyncTarget()
 }
 
 func (sm *SyncManager) syncWorker(id int) {
 	ss := &SyncerState{}
+	if sm.stateNotify != nil {
+		ss.notify = func(s *SyncerState) {
+			sm.stateNotify(id, s)
+		}
+	}
 	sm.syncStates[id] = ss
 	for {
 		select {
@@ -387,6 +507,11 @@ func (sm *SyncManager) syncWorker(id int) {
 			err := sm.doSync(ctx, ts)
 			if err != nil {
 				log.Errorf("sync error: %+v", err)
+				journal.Record(journal.SysSync, journal.EvtSyncError, map[string]interface{}{
+					"target": ts.Key(),
+					"height": ts.Height(),
+					"error":  err.Error(),
+				})
 			}
 
 			sm.syncResults <- &syncResult{
@@ -67,6 +67,28 @@ func assertGetSyncOp(t *testing.T, c chan *syncOp, ts *types.TipSet) {
 	}
 }
 
+// assertGetSyncOps expects the tipsets to be synced, in any order
+func assertGetSyncOps(t *testing.T, c chan *syncOp, tss ...*types.TipSet) {
+	t.Helper()
+
+	expected := map[types.TipSetKey]bool{}
+	for _, ts := range tss {
+		expected[ts.Key()] = true
+	}
+	for range tss {
+		select {
+		case <-time.After(time.Millisecond * 100):
+			t.Fatal("expected sync manager to try and sync to our targets")
+		case op := <-c:
+			op.done()
+			if !expected[op.ts.Key()] {
+				t.Fatalf("somehow got unexpected tipset from syncer (got %s)", op.ts.Cids())
+			}
+			delete(expected, op.ts.Key())
+		}
+	}
+}
+
 func TestSyncManager(t *testing.T) {
 	ctx := context.Background()
 
@@ -139,12 +161,53 @@ func TestSyncManager(t *testing.T) {
 
 		op1.done()
 
-		op2 := <-stc
-		fmt.Println("op2: ", op2.ts.Cids())
-		op2.done()
+		// c2 and c3 are competing heads on the same parent, both get synced
+		assertGetSyncOps(t, stc, c2, c3)
+		assertNoOp(t, stc)
+	})
+
+	runSyncMgrTest(t, "testCompetingBranches", 1, func(t *testing.T, sm *SyncManager, stc chan *syncOp) {
+		sm.targetThresh = 3
+
+		// e1 only includes a block of e2, validating e2 validates it
+		e2 := mock.TipSet(mock.MkBlock(b, 2, 6), mock.MkBlock(b, 2, 7))
+		e1 := mock.TipSet(e2.Blocks()[0])
+
+		sm.SetPeerHead(ctx, "peer1", e2)
+		sm.SetPeerHead(ctx, "peer2", e1)
+		sm.SetPeerHead(ctx, "peer3", c1)
+
+		// the branches of e2 and c1 are validated at the same time
+		var ops []*syncOp
+		for i := 0; i < 2; i++ {
+			select {
+			case <-time.After(time.Millisecond * 100):
+				t.Fatal("expected the competing branches to be synced in parallel")
+			case op := <-stc:
+				ops = append(ops, op)
+			}
+		}
+		if ops[0].ts.Equals(c1) {
+			ops[0], ops[1] = ops[1], ops[0]
+		}
+		assertTsEqual(t, ops[0].ts, e2)
+		assertTsEqual(t, ops[1].ts, c1)
+		for _, op := range ops {
+			op.done()
+		}
+		assertNoOp(t, stc)
+	})
+
+	runSyncMgrTest(t, "testSyncTargetThreshold", 1, func(t *testing.T, sm *SyncManager, stc chan *syncOp) {
+		sm.SetTargetThreshold(2)
+
+		sm.SetPeerHead(ctx, "peer1", a)
+		assertGetSyncOp(t, stc, a)
+
+		sm.SetPeerHead(ctx, "peer1", b)
+		assertNoOp(t, stc)
 
-		op3 := <-stc
-		fmt.Println("op3: ", op3.ts.Cids())
-		op3.done()
+		sm.SetPeerHead(ctx, "peer2", b)
+		assertGetSyncOp(t, stc, b)
 	})
 }
@@ -0,0 +1,160 @@
+package chain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type syncStateChange struct {
+	worker int
+	state  *SyncerState
+}
+
+// syncStateSubs delivers the state changes of the sync workers to the
+// SyncProgress subscribers. Changes are dropped for subscribers whose buffer
+// is full, the workers never wait for them.
+type syncStateSubs struct {
+	lk   sync.Mutex
+	subs map[chan *syncStateChange]struct{}
+}
+
+func (s *syncStateSubs) sub() chan *syncStateChange {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if s.subs == nil {
+		s.subs = map[chan *syncStateChange]struct{}{}
+	}
+	ch := make(chan *syncStateChange, 32)
+	s.subs[ch] = struct{}{}
+	return ch
+}
+
+func (s *syncStateSubs) unsub(ch chan *syncStateChange) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	delete(s.subs, ch)
+}
+
+func (s *syncStateSubs) publish(c *syncStateChange) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	for ch := range s.subs {
+		select {
+		case ch <- c:
+		default:
+			log.Debugw("dropping sync state change, subscriber too slow", "worker", c.worker)
+		}
+	}
+}
+
+func (syncer *Syncer) publishSyncState(worker int, ss *SyncerState) {
+	syncer.stateSubs.publish(&syncStateChange{worker: worker, state: ss})
+}
+
+// SyncProgress spawns a goroutine that streams candidate blocks arriving from
+// the network, along with state changes of the sync workers. State changes
+// carry an estimate of the time left until the current sync stage completes.
+//
+// Events are dropped when the consumer falls behind, so that a slow reader
+// can't stall the syncer.
+func (syncer *Syncer) SyncProgress(ctx context.Context) (<-chan api.SyncProgressEvent, error) {
+	sub := syncer.incoming.Sub(LocalIncoming)
+	states := syncer.stateSubs.sub()
+	out := make(chan api.SyncProgressEvent, 32)
+
+	go func() {
+		defer close(out)
+		defer syncer.incoming.Unsub(sub, LocalIncoming)
+		defer syncer.stateSubs.unsub(states)
+
+		stages := make(map[int]stageStart)
+
+		send := func(evt api.SyncProgressEvent) {
+			select {
+			case out <- evt:
+			default:
+				log.Debugw("dropping sync progress event, consumer too slow", "type", evt.Type)
+			}
+		}
+
+		for {
+			select {
+			case r := <-sub:
+				for _, h := range r.([]*types.BlockHeader) {
+					send(api.SyncProgressEvent{
+						Type:  api.SyncProgressBlock,
+						Block: h,
+					})
+				}
+			case v := <-states:
+				ss := v.state
+
+				st, ok := stages[v.worker]
+				if !ok || st.stage != ss.Stage {
+					st = stageStart{stage: ss.Stage, at: time.Now()}
+					stages[v.worker] = st
+				}
+
+				send(api.SyncProgressEvent{
+					Type:   api.SyncProgressState,
+					Worker: v.worker,
+					Sync: &api.ActiveSync{
+						Base:    ss.Base,
+						Target:  ss.Target,
+						Stage:   ss.Stage,
+						Height:  ss.Height,
+						Start:   ss.Start,
+						End:     ss.End,
+						Message: ss.Message,
+					},
+					ETA: st.eta(ss),
+				})
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// stageStart records when a sync worker entered its current stage.
+type stageStart struct {
+	stage api.SyncStateStage
+	at    time.Time
+}
+
+// eta extrapolates the time left in the current stage from the progress made
+// since the stage started. Zero means there isn't enough data for an estimate.
+func (st stageStart) eta(ss *SyncerState) time.Duration {
+	if ss.Base == nil || ss.Target == nil || ss.Height == 0 {
+		return 0
+	}
+
+	var done, left int64
+	switch ss.Stage {
+	case api.StageHeaders:
+		// headers are fetched backwards, from the target down to the base
+		done = int64(ss.Target.Height() - ss.Height)
+		left = int64(ss.Height - ss.Base.Height())
+	case api.StageMessages:
+		done = int64(ss.Height - ss.Base.Height())
+		left = int64(ss.Target.Height() - ss.Height)
+	default:
+		return 0
+	}
+
+	if done <= 0 || left <= 0 {
+		return 0
+	}
+
+	elapsed := time.Since(st.at)
+	return time.Duration(int64(elapsed) / done * left)
+}
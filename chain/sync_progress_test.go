@@ -0,0 +1,53 @@
+package chain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/pubsub"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+func TestSyncProgressSlowConsumer(t *testing.T) {
+	syncer := &Syncer{incoming: pubsub.New(50)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// neither the progress stream nor a subscriber which stopped reading
+	// hold up the sync workers
+	progress, err := syncer.SyncProgress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stalled := syncer.stateSubs.sub()
+	defer syncer.stateSubs.unsub(stalled)
+
+	ss := &SyncerState{notify: func(s *SyncerState) {
+		syncer.publishSyncState(1, s)
+	}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			ss.SetStage(api.StageHeaders)
+			ss.SetStage(api.StageMessages)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected publishing sync state changes not to block")
+	}
+
+	select {
+	case evt := <-progress:
+		if evt.Type != api.SyncProgressState || evt.Worker != 1 {
+			t.Fatalf("expected a state change of worker 1, got %+v", evt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the state changes to be streamed")
+	}
+}
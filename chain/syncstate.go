@@ -37,6 +37,18 @@ type SyncerState struct {
 	Message string
 	Start   time.Time
 	End     time.Time
+
+	// called with a snapshot of the state after every change
+	notify func(*SyncerState)
+}
+
+func (ss *SyncerState) emit() {
+	if ss.notify == nil {
+		return
+	}
+
+	snap := ss.Snapshot()
+	ss.notify(&snap)
 }
 
 func (ss *SyncerState) SetStage(v api.SyncStateStage) {
@@ -44,6 +56,7 @@ func (ss *SyncerState) SetStage(v api.SyncStateStage) {
 		return
 	}
 
+	defer ss.emit()
 	ss.lk.Lock()
 	defer ss.lk.Unlock()
 	ss.Stage = v
@@ -57,6 +70,7 @@ func (ss *SyncerState) Init(base, target *types.TipSet) {
 		return
 	}
 
+	defer ss.emit()
 	ss.lk.Lock()
 	defer ss.lk.Unlock()
 	ss.Target = target
@@ -73,6 +87,7 @@ func (ss *SyncerState) SetHeight(h abi.ChainEpoch) {
 		return
 	}
 
+	defer ss.emit()
 	ss.lk.Lock()
 	defer ss.lk.Unlock()
 	ss.Height = h
@@ -83,6 +98,7 @@ func (ss *SyncerState) Error(err error) {
 		return
 	}
 
+	defer ss.emit()
 	ss.lk.Lock()
 	defer ss.lk.Unlock()
 	ss.Message = err.Error()
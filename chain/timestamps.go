@@ -0,0 +1,71 @@
+package chain
+
+import (
+	"errors"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var (
+	// ErrBlockInFuture is returned for blocks whose timestamp is ahead of the
+	// local clock by more than the allowed drift. It's temporal, the block
+	// may be valid once the clock catches up.
+	ErrBlockInFuture = xerrors.Errorf("block timestamp is in the future: %w", ErrTemporal)
+
+	// ErrBlockTooEarly is returned for blocks whose timestamp is before the
+	// time of their epoch
+	ErrBlockTooEarly = errors.New("block timestamp is before the time of its epoch")
+
+	// ErrBlockMisaligned is returned for blocks whose timestamp is after the
+	// time of their epoch, if the policy rejects them
+	ErrBlockMisaligned = errors.New("block timestamp isn't the time of its epoch")
+)
+
+// ClockSkewPolicy configures how block timestamps are checked against the
+// local clock, and against the time of their epoch
+type ClockSkewPolicy struct {
+	// AllowedFutureSecs is how far ahead of the local clock block timestamps
+	// may be
+	AllowedFutureSecs uint64
+
+	// RejectMisaligned rejects blocks whose timestamp is after the time of
+	// their epoch, instead of only logging them
+	RejectMisaligned bool
+}
+
+func DefaultClockSkewPolicy() ClockSkewPolicy {
+	return ClockSkewPolicy{
+		AllowedFutureSecs: build.AllowableClockDriftSecs,
+	}
+}
+
+// checkTimestamp checks the timestamp of a block with the given parents. The
+// time of an epoch is the timestamp of the parents, plus the block delay for
+// each epoch since.
+func (p ClockSkewPolicy) checkTimestamp(h *types.BlockHeader, baseTs *types.TipSet, now uint64) error {
+	if h.Timestamp > now+p.AllowedFutureSecs {
+		return xerrors.Errorf("block was from the future (now=%d, blk=%d, allowed drift=%ds): %w", now, h.Timestamp, p.AllowedFutureSecs, ErrBlockInFuture)
+	}
+	if h.Timestamp > now {
+		log.Warnw("got block from the future, but within the allowed drift", "blk", h.Timestamp, "now", now)
+	}
+
+	deltaH := uint64(h.Height - baseTs.Height())
+	epochTime := baseTs.MinTimestamp() + build.BlockDelaySecs*deltaH
+	if h.Timestamp < epochTime {
+		return xerrors.Errorf("block was generated too soon (h.ts:%d < base.mints:%d + BLOCK_DELAY:%d * deltaH:%d; diff %d): %w",
+			h.Timestamp, baseTs.MinTimestamp(), build.BlockDelaySecs, deltaH, epochTime-h.Timestamp, ErrBlockTooEarly)
+	}
+
+	if h.Timestamp != epochTime {
+		if p.RejectMisaligned {
+			return xerrors.Errorf("block timestamp %d is %ds after the time of epoch %d: %w", h.Timestamp, h.Timestamp-epochTime, h.Height, ErrBlockMisaligned)
+		}
+		log.Warnw("block timestamp isn't the time of its epoch", "blk", h.Timestamp, "epochTime", epochTime, "height", h.Height)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package chain
+
+import (
+	"testing"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+func TestCheckTimestamp(t *testing.T) {
+	parent := mock.MkBlock(nil, 1, 1)
+	parent.Timestamp = 1000
+	base := mock.TipSet(parent)
+
+	blk := mock.MkBlock(base, 1, 2)
+	epochTime := 1000 + build.BlockDelaySecs
+	p := ClockSkewPolicy{AllowedFutureSecs: 2}
+
+	blk.Timestamp = epochTime
+	if err := p.checkTimestamp(blk, base, epochTime); err != nil {
+		t.Fatal(err)
+	}
+
+	err := p.checkTimestamp(blk, base, epochTime-3)
+	if !xerrors.Is(err, ErrBlockInFuture) || isPermanent(err) {
+		t.Fatalf("expected temporal future block error, got: %+v", err)
+	}
+
+	blk.Timestamp = epochTime - 1
+	if err := p.checkTimestamp(blk, base, epochTime); !xerrors.Is(err, ErrBlockTooEarly) {
+		t.Fatalf("expected too early error, got: %+v", err)
+	}
+
+	blk.Timestamp = epochTime + 1
+	if err := p.checkTimestamp(blk, base, epochTime+1); err != nil {
+		t.Fatal(err)
+	}
+	p.RejectMisaligned = true
+	if err := p.checkTimestamp(blk, base, epochTime+1); !xerrors.Is(err, ErrBlockMisaligned) {
+		t.Fatalf("expected misaligned error, got: %+v", err)
+	}
+}
@@ -35,6 +35,13 @@ type GasTrace struct {
 	Callers []uintptr `json:"-"`
 }
 
+// GasBreakdown splits the gas used by a message into compute gas, and storage
+// gas paid for state I/O and for storing chain data
+type GasBreakdown struct {
+	ComputeGas int64
+	StorageGas int64
+}
+
 type Loc struct {
 	File     string
 	Line     int
@@ -82,7 +89,7 @@ func (gt *GasTrace) MarshalJSON() ([]byte, error) {
 			frames := runtime.CallersFrames(gt.Callers)
 			for {
 				frame, more := frames.Next()
-				if frame.Function == "github.com/filecoin-project/lotus/chain/vm.(*VM).ApplyMessage" {
+				if frame.Function == "github.com/filecoin-project/lotus/chain/vm.(*VM).applyMessage" {
 					break
 				}
 				l := Loc{
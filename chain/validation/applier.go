@@ -24,13 +24,13 @@ import (
 // Applier applies messages to state trees and storage.
 type Applier struct {
 	stateWrapper *StateWrapper
-	syscalls     runtime.Syscalls
+	syscalls     vm.Syscalls
 }
 
 var _ vstate.Applier = &Applier{}
 
 func NewApplier(sw *StateWrapper, syscalls runtime.Syscalls) *Applier {
-	return &Applier{sw, syscalls}
+	return &Applier{sw, vm.FixedSyscalls(syscalls)}
 }
 
 func (a *Applier) ApplyMessage(epoch abi.ChainEpoch, message *vtypes.Message) (vtypes.ApplyMessageResult, error) {
@@ -0,0 +1,253 @@
+package chain
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	dstore "github.com/ipfs/go-datastore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/sigs"
+)
+
+// Checks reported by VerifyChain
+const (
+	VerifyCheckParents   = "parents"
+	VerifyCheckSignature = "signature"
+	VerifyCheckMessages  = "messages"
+	VerifyCheckState     = "state"
+)
+
+// DefaultVerifyTimeout bounds chain verifications without a timeout
+var DefaultVerifyTimeout = time.Hour
+
+type chainVerifier struct {
+	sm   *stmgr.StateManager
+	cs   *store.ChainStore
+	head *types.TipSet
+	opts api.ChainVerifyOptions
+	rep  *api.ChainVerifyReport
+}
+
+// VerifyChain walks the local chain from the given tipset towards genesis,
+// and verifies the parent links, block signatures and message roots of every
+// tipset. The state of a random sample of tipsets is recomputed and compared
+// to the state root their children commit to. Problems are collected in the
+// report, the walk only stops early when MaxErrors is reached, or when the
+// timeout expires, in which case the report covers the tipsets verified so far.
+func VerifyChain(ctx context.Context, sm *stmgr.StateManager, opts api.ChainVerifyOptions) (*api.ChainVerifyReport, error) {
+	cs := sm.ChainStore()
+	start := time.Now()
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultVerifyTimeout
+	}
+	wctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ts := cs.GetHeaviestTipSet()
+	if !opts.From.IsEmpty() {
+		var err error
+		ts, err = cs.LoadTipSet(opts.From)
+		if err != nil {
+			return nil, xerrors.Errorf("loading tipset to start from: %w", err)
+		}
+	}
+
+	v := &chainVerifier{
+		sm:   sm,
+		cs:   cs,
+		head: ts,
+		opts: opts,
+		rep:  &api.ChainVerifyReport{FromHeight: ts.Height()},
+	}
+
+	var child *types.TipSet
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, xerrors.Errorf("verifying chain at height %d: %w", ts.Height(), err)
+		}
+
+		// the checks of a tipset interrupted by the timeout are dropped, their
+		// errors come from the interruption
+		prev := *v.rep
+
+		var parent *types.TipSet
+		if ts.Height() > 0 {
+			parent = v.loadParent(ts)
+		}
+
+		v.verifyTipSet(wctx, ts, parent, child)
+		if wctx.Err() != nil && ctx.Err() == nil {
+			*v.rep = prev
+			v.rep.TimedOut = true
+			log.Warnw("stopping chain verification, timed out", "height", ts.Height(), "timeout", timeout)
+			break
+		}
+		v.rep.Tipsets++
+		v.rep.ToHeight = ts.Height()
+
+		if parent == nil || (opts.Depth > 0 && uint64(v.rep.Tipsets) >= opts.Depth) {
+			break
+		}
+		if opts.MaxErrors > 0 && len(v.rep.Errors) >= opts.MaxErrors {
+			log.Warnw("stopping chain verification, too many errors", "height", ts.Height())
+			break
+		}
+
+		child, ts = ts, parent
+	}
+
+	v.rep.Duration = time.Since(start)
+	return v.rep, nil
+}
+
+func (v *chainVerifier) fail(ts *types.TipSet, blk cid.Cid, check string, err error) {
+	v.rep.Errors = append(v.rep.Errors, api.ChainVerifyError{
+		Height: ts.Height(),
+		TipSet: ts.Key(),
+		Block:  blk,
+		Check:  check,
+		Error:  err.Error(),
+	})
+}
+
+// loadParent loads the parent of the tipset, and checks that the headers
+// weren't altered in the blockstore
+func (v *chainVerifier) loadParent(ts *types.TipSet) *types.TipSet {
+	parent, err := v.cs.LoadTipSet(ts.Parents())
+	if err != nil {
+		v.fail(ts, cid.Undef, VerifyCheckParents, xerrors.Errorf("loading parent tipset: %w", err))
+		return nil
+	}
+
+	// tipset keys are computed from the loaded headers, a different key
+	// means the stored headers don't hash to their cids
+	if parent.Key() != ts.Parents() {
+		v.fail(ts, cid.Undef, VerifyCheckParents, xerrors.Errorf("parent headers hash to %s, expected %s", parent.Key(), ts.Parents()))
+		return nil
+	}
+	if parent.Height() >= ts.Height() {
+		v.fail(ts, cid.Undef, VerifyCheckParents, xerrors.Errorf("parent height %d is not below %d", parent.Height(), ts.Height()))
+		return nil
+	}
+
+	return parent
+}
+
+func (v *chainVerifier) verifyTipSet(ctx context.Context, ts, parent, child *types.TipSet) {
+	v.rep.Blocks += len(ts.Blocks())
+
+	for _, b := range ts.Blocks() {
+		if err := v.verifyMessages(b); err != nil {
+			v.fail(ts, b.Cid(), VerifyCheckMessages, err)
+		}
+	}
+
+	if parent != nil {
+		v.verifySignatures(ctx, ts, parent)
+	}
+
+	if child != nil && ts.Height() > 0 && v.opts.StateSample > 0 && rand.Float64() < v.opts.StateSample {
+		v.rep.StatesChecked++
+		if err := v.verifyState(ctx, ts, child); err != nil {
+			v.fail(ts, cid.Undef, VerifyCheckState, err)
+		}
+	}
+}
+
+func (v *chainVerifier) verifyMessages(b *types.BlockHeader) error {
+	bmsgs, smsgs, err := v.cs.MessagesForBlock(b)
+	if err != nil {
+		return xerrors.Errorf("loading messages: %w", err)
+	}
+	v.rep.Messages += len(bmsgs) + len(smsgs)
+
+	// message cids are computed from the loaded messages, so that altered
+	// messages change the root
+	var bcids, scids []cbg.CBORMarshaler
+	for _, m := range bmsgs {
+		c := cbg.CborCid(m.Cid())
+		bcids = append(bcids, &c)
+	}
+	for _, m := range smsgs {
+		c := cbg.CborCid(m.Cid())
+		scids = append(scids, &c)
+	}
+
+	// temp storage, the meta objects are in the blockstore already
+	tmp := cbor.NewCborStore(bstore.NewBlockstore(dstore.NewMapDatastore()))
+	root, err := computeMsgMeta(tmp, bcids, scids)
+	if err != nil {
+		return xerrors.Errorf("computing message root: %w", err)
+	}
+	if root != b.Messages {
+		return xerrors.Errorf("messages hash to root %s, the header has %s", root, b.Messages)
+	}
+	return nil
+}
+
+func (v *chainVerifier) verifySignatures(ctx context.Context, ts, parent *types.TipSet) {
+	lbts, err := stmgr.GetLookbackTipSetForRound(ctx, v.sm, parent, ts.Height())
+	if err != nil {
+		v.fail(ts, cid.Undef, VerifyCheckSignature, xerrors.Errorf("getting lookback tipset: %w", err))
+		return
+	}
+
+	lbst, err := v.stateAfter(ctx, lbts)
+	if err != nil {
+		v.fail(ts, cid.Undef, VerifyCheckSignature, xerrors.Errorf("getting lookback state: %w", err))
+		return
+	}
+
+	for _, b := range ts.Blocks() {
+		waddr, err := stmgr.GetMinerWorkerRaw(ctx, v.sm, lbst, b.Miner)
+		if err != nil {
+			v.fail(ts, b.Cid(), VerifyCheckSignature, xerrors.Errorf("getting worker of %s: %w", b.Miner, err))
+			continue
+		}
+
+		if err := sigs.CheckBlockSignature(ctx, b, waddr); err != nil {
+			v.fail(ts, b.Cid(), VerifyCheckSignature, err)
+		}
+	}
+}
+
+// stateAfter returns the state after executing the tipset. It's taken from
+// the child of the tipset when possible, to avoid recomputing it.
+func (v *chainVerifier) stateAfter(ctx context.Context, ts *types.TipSet) (cid.Cid, error) {
+	if ts.Height() < v.head.Height() {
+		child, err := v.cs.GetTipsetByHeight(ctx, ts.Height()+1, v.head, false)
+		if err == nil && child.Parents() == ts.Key() {
+			return child.ParentState(), nil
+		}
+	}
+
+	st, _, err := v.sm.TipSetState(ctx, ts)
+	return st, err
+}
+
+func (v *chainVerifier) verifyState(ctx context.Context, ts, child *types.TipSet) error {
+	st, rec, err := v.sm.RecomputeTipSetState(ctx, ts)
+	if err != nil {
+		return xerrors.Errorf("recomputing state: %w", err)
+	}
+
+	if st != child.ParentState() {
+		return xerrors.Errorf("computed state root %s, the child at height %d has %s", st, child.Height(), child.ParentState())
+	}
+	if rec != child.Blocks()[0].ParentMessageReceipts {
+		return xerrors.Errorf("computed receipts root %s, the child at height %d has %s", rec, child.Height(), child.Blocks()[0].ParentMessageReceipts)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain"
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func TestVerifyChain(t *testing.T) {
+	ctx := context.TODO()
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var head *types.TipSet
+	for i := 0; i < 10; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		head = mts.TipSet.TipSet()
+	}
+	sm := stmgr.NewStateManager(cg.ChainStore())
+
+	rep, err := chain.VerifyChain(ctx, sm, api.ChainVerifyOptions{From: head.Key(), StateSample: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Errors) > 0 {
+		t.Fatalf("expected the generated chain to verify, got %+v", rep.Errors)
+	}
+	if rep.FromHeight != head.Height() || rep.ToHeight != 0 || rep.Tipsets != int(head.Height())+1 || rep.TimedOut {
+		t.Fatalf("expected the walk to cover heights %d to 0, got %+v", head.Height(), rep)
+	}
+	// the head has no child to compare to, and genesis isn't computed
+	if rep.StatesChecked != rep.Tipsets-2 {
+		t.Fatalf("expected %d states to be recomputed, got %d", rep.Tipsets-2, rep.StatesChecked)
+	}
+
+	rep, err = chain.VerifyChain(ctx, sm, api.ChainVerifyOptions{From: head.Key(), Depth: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Tipsets != 3 || rep.ToHeight != head.Height()-2 {
+		t.Fatalf("expected the walk to stop after 3 tipsets, got %+v", rep)
+	}
+
+	// the walk stops at the timeout, without reporting the interruption as
+	// a problem
+	rep, err = chain.VerifyChain(ctx, sm, api.ChainVerifyOptions{From: head.Key(), StateSample: 1, Timeout: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.TimedOut || rep.Tipsets >= int(head.Height())+1 || len(rep.Errors) > 0 {
+		t.Fatalf("expected a partial report, got %+v", rep)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := chain.VerifyChain(cctx, sm, api.ChainVerifyOptions{From: head.Key()}); err == nil {
+		t.Fatal("expected a canceled walk to fail")
+	}
+
+	// a store which only has the headers of the head misses its parents and
+	// messages
+	cs := store.NewChainStore(blockstore.NewBlockstore(datastore.NewMapDatastore()), datastore.NewMapDatastore(), nil)
+	if err := cs.PersistBlockHeaders(head.Blocks()...); err != nil {
+		t.Fatal(err)
+	}
+	rep, err = chain.VerifyChain(ctx, stmgr.NewStateManager(cs), api.ChainVerifyOptions{From: head.Key()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := map[string]bool{}
+	for _, e := range rep.Errors {
+		checks[e.Check] = true
+	}
+	if rep.Tipsets != 1 || !checks[chain.VerifyCheckParents] || !checks[chain.VerifyCheckMessages] {
+		t.Fatalf("expected the missing parents and messages to be reported, got %+v", rep)
+	}
+}
@@ -10,8 +10,13 @@ import (
 	"github.com/filecoin-project/specs-actors/actors/runtime"
 	vmr "github.com/filecoin-project/specs-actors/actors/runtime"
 	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/lotus/chain/types"
 )
 
+// Gas charges are split into compute gas, and storage gas paid for state I/O
+// and for storing chain data. Both are reported separately, but changing the
+// multipliers changes the gas used by messages, which is consensus critical.
 const (
 	GasStorageMulti = 1
 	GasComputeMulti = 1
@@ -44,6 +49,17 @@ func (g GasCharge) WithExtra(extra interface{}) GasCharge {
 	return out
 }
 
+// addGasBreakdown adds the part of the charge which was used to the breakdown.
+// Charges which run out of gas are attributed to compute gas first.
+func addGasBreakdown(b *types.GasBreakdown, gas GasCharge, used int64) {
+	compute := gas.ComputeGas * GasComputeMulti
+	if used < gas.Total() && compute > used {
+		compute = used
+	}
+	b.ComputeGas += compute
+	b.StorageGas += used - compute
+}
+
 func newGasCharge(name string, computeGas int64, storageGas int64) GasCharge {
 	return GasCharge{
 		Name:       name,
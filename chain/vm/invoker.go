@@ -66,6 +66,10 @@ func (inv *Invoker) Invoke(codeCid cid.Cid, rt runtime.Runtime, method abi.Metho
 
 	code, ok := inv.builtInCode[codeCid]
 	if !ok {
+		if ext, ok := externalRuntimeFor(codeCid, rt.CurrEpoch()); ok {
+			return ext.Invoke(codeCid, rt, method, params)
+		}
+
 		log.Errorf("no code for actor %s (Addr: %s)", codeCid, rt.Message().Receiver())
 		return nil, aerrors.Newf(exitcode.SysErrorIllegalActor, "no code for actor %s(%d)(%s)", codeCid, method, hex.EncodeToString(params))
 	}
@@ -0,0 +1,83 @@
+package vm
+
+import (
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/runtime"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/actors/aerrors"
+)
+
+// ExternalRuntime executes actors whose code isn't built into lotus, e.g. an
+// experimental WASM runtime running user-defined actors.
+type ExternalRuntime interface {
+	Invoke(code cid.Cid, rt runtime.Runtime, method abi.MethodNum, params []byte) ([]byte, aerrors.ActorError)
+}
+
+type externalRoute struct {
+	runtime    ExternalRuntime
+	activation abi.ChainEpoch
+}
+
+var (
+	externalLk       sync.RWMutex
+	externalRuntimes = map[string]ExternalRuntime{}
+	externalRoutes   = map[cid.Cid]externalRoute{}
+)
+
+// RegisterExternalRuntime makes a runtime available to RouteExternalActor
+// under the given name. Builds which link in a runtime are expected to call
+// this from an init function.
+func RegisterExternalRuntime(name string, r ExternalRuntime) {
+	externalLk.Lock()
+	defer externalLk.Unlock()
+
+	externalRuntimes[name] = r
+}
+
+// RouteExternalActor makes the invoker execute actors with the given code
+// using the named runtime, for messages executed at or after the activation
+// epoch. As this changes consensus rules, it's only allowed in devnet builds,
+// and built-in actors can't be routed.
+func RouteExternalActor(code cid.Cid, runtimeName string, activation abi.ChainEpoch) error {
+	if build.BuildType == build.BuildDefault {
+		return xerrors.New("external actor runtimes are only supported in devnet builds")
+	}
+
+	if _, ok := NewInvoker().builtInCode[code]; ok {
+		return xerrors.Errorf("can't route built-in actor code %s", code)
+	}
+
+	externalLk.Lock()
+	defer externalLk.Unlock()
+
+	r, ok := externalRuntimes[runtimeName]
+	if !ok {
+		return xerrors.Errorf("unknown actor runtime %q", runtimeName)
+	}
+
+	externalRoutes[code] = externalRoute{
+		runtime:    r,
+		activation: activation,
+	}
+
+	log.Warnw("routing actor code to external runtime", "code", code, "runtime", runtimeName, "activation", activation)
+	return nil
+}
+
+func externalRuntimeFor(code cid.Cid, epoch abi.ChainEpoch) (ExternalRuntime, bool) {
+	externalLk.RLock()
+	defer externalLk.RUnlock()
+
+	route, ok := externalRoutes[code]
+	if !ok || epoch < route.activation {
+		return nil, false
+	}
+
+	return route.runtime, true
+}
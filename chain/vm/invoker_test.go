@@ -5,12 +5,17 @@ import (
 	"io"
 	"testing"
 
+	"github.com/ipfs/go-cid"
 	cbor "github.com/ipfs/go-ipld-cbor"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/assert"
 	cbg "github.com/whyrusleeping/cbor-gen"
 
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/actors"
 	"github.com/filecoin-project/lotus/chain/actors/aerrors"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
 	"github.com/filecoin-project/specs-actors/actors/runtime"
 	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
 	"github.com/filecoin-project/specs-actors/actors/util/adt"
@@ -110,3 +115,33 @@ func TestInvokerBasic(t *testing.T) {
 	assert.Equal(t, exitcode.ExitCode(1), aerrors.RetCode(aerr), "return code should be 1")
 
 }
+
+type echoRuntime struct{}
+
+func (echoRuntime) Invoke(code cid.Cid, rt runtime.Runtime, method abi.MethodNum, params []byte) ([]byte, aerrors.ActorError) {
+	return params, nil
+}
+
+func TestExternalRuntime(t *testing.T) {
+	bt := build.BuildType
+	build.BuildType = build.BuildDebug
+	defer func() {
+		build.BuildType = bt
+	}()
+
+	code, err := cid.V1Builder{Codec: cid.Raw, MhType: mh.IDENTITY}.Sum([]byte("fil/test/echo"))
+	assert.NoError(t, err)
+
+	RegisterExternalRuntime("echo", echoRuntime{})
+
+	assert.Error(t, RouteExternalActor(code, "missing", 10))
+	assert.Error(t, RouteExternalActor(builtin.AccountActorCodeID, "echo", 10))
+	assert.NoError(t, RouteExternalActor(code, "echo", 10))
+
+	_, ok := externalRuntimeFor(code, 9)
+	assert.False(t, ok, "runtime shouldn't be used before activation")
+
+	ret, aerr := NewInvoker().Invoke(code, &Runtime{height: 10}, 2, []byte{42})
+	assert.Nil(t, aerr)
+	assert.Equal(t, []byte{42}, ret)
+}
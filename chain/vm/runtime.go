@@ -45,6 +45,7 @@ type Runtime struct {
 
 	gasAvailable int64
 	gasUsed      int64
+	gasBreakdown types.GasBreakdown
 
 	sys runtime.Syscalls
 
@@ -552,11 +553,19 @@ func (rt *Runtime) chargeGasInternal(gas GasCharge, skip int) aerrors.ActorError
 	rt.lastGasCharge = &gasTrace
 
 	if rt.gasUsed+toUse > rt.gasAvailable {
+		addGasBreakdown(&rt.gasBreakdown, gas, rt.gasAvailable-rt.gasUsed)
+		if rt.vm.tracer != nil {
+			rt.vm.tracer.ChargeGas(gas.Name, rt.gasAvailable-rt.gasUsed)
+		}
 		rt.gasUsed = rt.gasAvailable
 		return aerrors.Newf(exitcode.SysErrOutOfGas, "not enough gas: used=%d, available=%d",
 			rt.gasUsed, rt.gasAvailable)
 	}
 	rt.gasUsed += toUse
+	addGasBreakdown(&rt.gasBreakdown, gas, toUse)
+	if rt.vm.tracer != nil {
+		rt.vm.tracer.ChargeGas(gas.Name, toUse)
+	}
 	return nil
 }
 
@@ -29,17 +29,52 @@ func init() {
 	mh.Codes[0xf104] = "filecoin"
 }
 
-// Actual type is defined in chain/types/vmcontext.go because the VMContext interface is there
+// Syscalls is the syscall table of the VM. The syscalls are bound to the
+// state of every runtime, so they can resolve the addresses they're given.
+// Before build.UpgradeSyscallStateHeight runtimes bind them without a state.
+type Syscalls interface {
+	Bind(ctx context.Context, cstate *state.StateTree, cst cbor.IpldStore) runtime.Syscalls
+}
+
+// DefaultSyscalls returns the production syscall table, proofs are checked
+// with the verifier
+func DefaultSyscalls(verifier ffiwrapper.Verifier) Syscalls {
+	return &defaultSyscalls{verifier: verifier}
+}
+
+type defaultSyscalls struct {
+	verifier ffiwrapper.Verifier
+}
+
+func (ds *defaultSyscalls) Bind(ctx context.Context, cstate *state.StateTree, cst cbor.IpldStore) runtime.Syscalls {
+	return &syscallShim{
+		ctx:      ctx,
+		cstate:   cstate,
+		cst:      cst,
+		verifier: ds.verifier,
+	}
+}
 
-func Syscalls(verifier ffiwrapper.Verifier) runtime.Syscalls {
-	return &syscallShim{verifier: verifier}
+// FixedSyscalls returns a syscall table using sys in every runtime, whatever
+// the state
+func FixedSyscalls(sys runtime.Syscalls) Syscalls {
+	return &fixedSyscalls{sys: sys}
+}
+
+type fixedSyscalls struct {
+	sys runtime.Syscalls
+}
+
+func (fs *fixedSyscalls) Bind(context.Context, *state.StateTree, cbor.IpldStore) runtime.Syscalls {
+	return fs.sys
 }
 
 type syscallShim struct {
 	ctx context.Context
 
+	// cstate is nil before build.UpgradeSyscallStateHeight
 	cstate   *state.StateTree
-	cst      *cbor.BasicIpldStore
+	cst      cbor.IpldStore
 	verifier ffiwrapper.Verifier
 }
 
@@ -166,6 +201,9 @@ func (ss *syscallShim) VerifyConsensusFault(a, b, extra []byte) (*runtime.Consen
 }
 
 func (ss *syscallShim) VerifyBlockSig(blk *types.BlockHeader) error {
+	if ss.cstate == nil {
+		return xerrors.Errorf("can't resolve the worker key of miner %s without state", blk.Miner)
+	}
 
 	// get appropriate miner actor
 	act, err := ss.cstate.GetActor(blk.Miner)
@@ -233,6 +271,13 @@ func (ss *syscallShim) VerifySeal(info abi.SealVerifyInfo) error {
 func (ss *syscallShim) VerifySignature(sig crypto.Signature, addr address.Address, input []byte) error {
 	// TODO: in genesis setup, we are currently faking signatures
 
+	if ss.cstate == nil {
+		if addr.Protocol() != address.BLS && addr.Protocol() != address.SECP256K1 {
+			return xerrors.Errorf("can't resolve %s to a key address without state", addr)
+		}
+		return sigs.Verify(&sig, addr, input)
+	}
+
 	kaddr, err := ResolveToKeyAddr(ss.cstate, ss.cst, addr)
 	if err != nil {
 		return err
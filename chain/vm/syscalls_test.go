@@ -0,0 +1,156 @@
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/account"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+	"github.com/filecoin-project/specs-actors/actors/runtime"
+
+	"github.com/filecoin-project/lotus/chain/state"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/sigs"
+	_ "github.com/filecoin-project/lotus/lib/sigs/secp"
+)
+
+// testSyscalls counts the verifications it's called for
+type testSyscalls struct {
+	runtime.Syscalls
+
+	signatures, seals int
+}
+
+func (ts *testSyscalls) VerifySignature(crypto.Signature, address.Address, []byte) error {
+	ts.signatures++
+	return nil
+}
+
+func (ts *testSyscalls) VerifySeal(abi.SealVerifyInfo) error {
+	ts.seals++
+	return nil
+}
+
+func TestFixedSyscalls(t *testing.T) {
+	sys := &testSyscalls{}
+	fixed := FixedSyscalls(sys)
+
+	if fixed.Bind(context.TODO(), nil, nil) != sys {
+		t.Fatal("expected the fixed syscalls to be used without state")
+	}
+
+	st, err := state.NewStateTree(cbor.NewMemCborStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixed.Bind(context.TODO(), st, nil) != sys {
+		t.Fatal("expected the fixed syscalls to be used whatever the state")
+	}
+}
+
+func TestStubSyscalls(t *testing.T) {
+	under := &testSyscalls{}
+
+	var stubbed int
+	sys := StubSyscalls(FixedSyscalls(under), SyscallStubs{
+		VerifySeal: func(info abi.SealVerifyInfo) error {
+			stubbed++
+			if info.SectorID.Number == 1 {
+				return xerrors.New("bad seal")
+			}
+			return nil
+		},
+	}).Bind(context.TODO(), nil, nil)
+
+	// verifications which aren't stubbed are done by the table
+	if err := sys.VerifySignature(crypto.Signature{}, address.Undef, nil); err != nil {
+		t.Fatal(err)
+	}
+	if under.signatures != 1 {
+		t.Fatalf("expected the signature to be verified by the table, got %d calls", under.signatures)
+	}
+
+	if err := sys.VerifySeal(abi.SealVerifyInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := sys.BatchVerifySeals(map[address.Address][]abi.SealVerifyInfo{
+		address.Undef: {
+			{SectorID: abi.SectorID{Number: 0}},
+			{SectorID: abi.SectorID{Number: 1}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if under.seals != 0 || stubbed != 3 {
+		t.Fatalf("expected seals to be verified by the stub, table: %d, stub: %d", under.seals, stubbed)
+	}
+	if r := res[address.Undef]; len(r) != 2 || !r[0] || r[1] {
+		t.Fatalf("unexpected batch results %v", r)
+	}
+}
+
+func TestSyscallsVerifySignatureState(t *testing.T) {
+	pk, err := sigs.Generate(crypto.SigTypeSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := sigs.ToPublic(crypto.SigTypeSecp256k1, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := address.NewSecp256k1Address(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("signed data")
+	sig, err := sigs.Sign(crypto.SigTypeSecp256k1, pk, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cst := cbor.NewCborStore(blockstore.NewBlockstore(datastore.NewMapDatastore()))
+	st, err := state.NewStateTree(cst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := cst.Put(context.TODO(), &account.State{Address: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := address.NewIDAddress(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetActor(id, &types.Actor{Code: builtin.AccountActorCodeID, Head: head, Balance: types.NewInt(0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	sys := DefaultSyscalls(nil)
+
+	// without state, as before the upgrade, only key addresses are accepted
+	nostate := sys.Bind(context.TODO(), nil, cst)
+	if err := nostate.VerifySignature(*sig, key, data); err != nil {
+		t.Fatalf("expected the signature of a key address to be verified: %s", err)
+	}
+	if err := nostate.VerifySignature(*sig, id, data); err == nil {
+		t.Fatal("expected an ID address to be rejected without state")
+	}
+	if err := nostate.(*syscallShim).VerifyBlockSig(&types.BlockHeader{Miner: id}); err == nil {
+		t.Fatal("expected block signatures not to be verified without state")
+	}
+
+	// with state, ID addresses are resolved
+	if err := sys.Bind(context.TODO(), st, cst).VerifySignature(*sig, id, data); err != nil {
+		t.Fatalf("expected the ID address to be resolved: %s", err)
+	}
+}
@@ -0,0 +1,95 @@
+package vm
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/actors/aerrors"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// ExecutionTracer is notified of the messages applied to the VM, and of every
+// send they make, including the internal sends between actors. Tracing flushes
+// the state tree around every applied message, it's only meant for replays.
+type ExecutionTracer interface {
+	// StartMessage is called before a message is applied, with the state root
+	// it's applied on
+	StartMessage(msg *types.Message, stateRoot cid.Cid)
+	// EndMessage is called once the message is applied, with the resulting
+	// state root
+	EndMessage(ret *ApplyRet, stateRoot cid.Cid)
+
+	// StartCall is called when a send starts. depth is zero for the send of
+	// an applied message. code and head are the code and state of the
+	// receiving actor, cid.Undef if it doesn't exist yet.
+	StartCall(depth int, msg *types.Message, code, head cid.Cid)
+	// EndCall is called when the send returns. gasCharged is the gas charged
+	// by the send and its subcalls. head is the state of the receiving actor
+	// after the send, a failed send leaves it unchanged.
+	EndCall(depth int, ret []byte, err aerrors.ActorError, gasCharged int64, head cid.Cid)
+
+	// ChargeGas is called when gas is charged to the current send, or to the
+	// applied message outside of sends. name is the name of the GasCharge,
+	// gas the amount actually charged.
+	ChargeGas(name string, gas int64)
+}
+
+// SetTracer sets the tracer notified of the execution, nil disables tracing
+func (vm *VM) SetTracer(t ExecutionTracer) {
+	vm.tracer = t
+}
+
+func (vm *VM) actorState(addr address.Address) (code cid.Cid, head cid.Cid) {
+	act, err := vm.cstate.GetActor(addr)
+	if err != nil {
+		return cid.Undef, cid.Undef
+	}
+	return act.Code, act.Head
+}
+
+// traceCall notifies the tracer of a send starting, the returned function
+// must be called when it returns
+func (vm *VM) traceCall(msg *types.Message, rt *Runtime) func([]byte, aerrors.ActorError) {
+	if vm.tracer == nil {
+		return func([]byte, aerrors.ActorError) {}
+	}
+
+	depth := vm.callDepth
+	vm.callDepth++
+	gasBefore := rt.gasUsed
+	code, pre := vm.actorState(msg.To)
+	vm.tracer.StartCall(depth, msg, code, pre)
+
+	return func(ret []byte, err aerrors.ActorError) {
+		vm.callDepth--
+		head := pre
+		if err == nil {
+			_, head = vm.actorState(msg.To)
+		}
+		vm.tracer.EndCall(depth, ret, err, rt.gasUsed-gasBefore, head)
+	}
+}
+
+// tracedApply wraps applying a message with the tracer notifications
+func (vm *VM) tracedApply(ctx context.Context, msg *types.Message, apply func() (*ApplyRet, error)) (*ApplyRet, error) {
+	pre, err := vm.cstate.Flush(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("flushing state before message: %w", err)
+	}
+	vm.tracer.StartMessage(msg, pre)
+
+	ret, err := apply()
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := vm.cstate.Flush(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("flushing state after message: %w", err)
+	}
+	vm.tracer.EndMessage(ret, post)
+	return ret, nil
+}
@@ -25,9 +25,9 @@ import (
 	"github.com/filecoin-project/specs-actors/actors/builtin/account"
 	init_ "github.com/filecoin-project/specs-actors/actors/builtin/init"
 	"github.com/filecoin-project/specs-actors/actors/crypto"
-	"github.com/filecoin-project/specs-actors/actors/runtime"
 	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
 
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/actors/aerrors"
 	"github.com/filecoin-project/lotus/chain/state"
 	"github.com/filecoin-project/lotus/chain/types"
@@ -113,8 +113,12 @@ func (vm *VM) makeRuntime(ctx context.Context, msg *types.Message, origin addres
 		Blocks: &gasChargingBlocks{rt.chargeGasFunc(2), rt.pricelist, vm.cst.Blocks},
 		Atlas:  vm.cst.Atlas,
 	}
+	cstate := vm.cstate
+	if vm.blockHeight < build.UpgradeSyscallStateHeight {
+		cstate = nil
+	}
 	rt.sys = pricedSyscalls{
-		under:     vm.Syscalls,
+		under:     vm.Syscalls.Bind(ctx, cstate, vm.cst),
 		chargeGas: rt.chargeGasFunc(1),
 		pl:        rt.pricelist,
 	}
@@ -139,10 +143,13 @@ type VM struct {
 	inv         *Invoker
 	rand        Rand
 
-	Syscalls runtime.Syscalls
+	tracer    ExecutionTracer
+	callDepth int
+
+	Syscalls Syscalls
 }
 
-func NewVM(base cid.Cid, height abi.ChainEpoch, r Rand, cbs blockstore.Blockstore, syscalls runtime.Syscalls) (*VM, error) {
+func NewVM(base cid.Cid, height abi.ChainEpoch, r Rand, cbs blockstore.Blockstore, syscalls Syscalls) (*VM, error) {
 	buf := bufbstore.NewBufferedBstore(cbs)
 	cst := cbor.NewCborStore(buf)
 	state, err := state.LoadStateTree(cst, base)
@@ -168,6 +175,9 @@ type Rand interface {
 
 type ApplyRet struct {
 	types.MessageReceipt
+	// GasBreakdown splits GasUsed, it isn't part of the receipt stored in the
+	// chain
+	GasBreakdown   types.GasBreakdown
 	ActorErr       aerrors.ActorError
 	Penalty        types.BigInt
 	ExecutionTrace types.ExecutionTrace
@@ -192,11 +202,14 @@ func (vm *VM) send(ctx context.Context, msg *types.Message, parent *Runtime,
 
 	rt := vm.makeRuntime(ctx, msg, origin, on, gasUsed, nac)
 	rt.lastGasChargeTime = start
+	endCall := vm.traceCall(msg, rt)
 	if parent != nil {
+		rt.gasBreakdown = parent.gasBreakdown
 		rt.lastGasChargeTime = parent.lastGasChargeTime
 		rt.lastGasCharge = parent.lastGasCharge
 		defer func() {
 			parent.gasUsed = rt.gasUsed
+			parent.gasBreakdown = rt.gasBreakdown
 			parent.lastGasChargeTime = rt.lastGasChargeTime
 			parent.lastGasCharge = rt.lastGasCharge
 		}()
@@ -205,7 +218,9 @@ func (vm *VM) send(ctx context.Context, msg *types.Message, parent *Runtime,
 	if gasCharge != nil {
 		if err := rt.chargeGasSafe(*gasCharge); err != nil {
 			// this should never happen
-			return nil, aerrors.Wrap(err, "not enough gas for initial message charge, this should not happen"), rt
+			err := aerrors.Wrap(err, "not enough gas for initial message charge, this should not happen")
+			endCall(nil, err)
+			return nil, err, rt
 		}
 	}
 
@@ -253,6 +268,7 @@ func (vm *VM) send(ctx context.Context, msg *types.Message, parent *Runtime,
 	if err != nil {
 		rt.executionTrace.Error = err.Error()
 	}
+	endCall(ret, err)
 
 	return ret, err, rt
 }
@@ -294,6 +310,15 @@ func (vm *VM) ApplyImplicitMessage(ctx context.Context, msg *types.Message) (*Ap
 }
 
 func (vm *VM) ApplyMessage(ctx context.Context, cmsg types.ChainMsg) (*ApplyRet, error) {
+	if vm.tracer != nil {
+		return vm.tracedApply(ctx, cmsg.VMMessage(), func() (*ApplyRet, error) {
+			return vm.applyMessage(ctx, cmsg)
+		})
+	}
+	return vm.applyMessage(ctx, cmsg)
+}
+
+func (vm *VM) applyMessage(ctx context.Context, cmsg types.ChainMsg) (*ApplyRet, error) {
 	start := time.Now()
 	ctx, span := trace.StartSpan(ctx, "vm.ApplyMessage")
 	defer span.End()
@@ -432,8 +457,10 @@ func (vm *VM) ApplyMessage(ctx context.Context, cmsg types.ChainMsg) (*ApplyRet,
 		}
 	}
 	gasUsed = rt.gasUsed
+	gasBreakdown := rt.gasBreakdown
 	if gasUsed < 0 {
 		gasUsed = 0
+		gasBreakdown = types.GasBreakdown{}
 	}
 	// refund unused gas
 	refund := types.BigMul(types.NewInt(uint64(msg.GasLimit-gasUsed)), msg.GasPrice)
@@ -458,6 +485,7 @@ func (vm *VM) ApplyMessage(ctx context.Context, cmsg types.ChainMsg) (*ApplyRet,
 			Return:   ret,
 			GasUsed:  gasUsed,
 		},
+		GasBreakdown:   gasBreakdown,
 		ActorErr:       actorErr,
 		ExecutionTrace: rt.executionTrace,
 		Penalty:        types.NewInt(0),
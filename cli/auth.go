@@ -1,13 +1,16 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
 
+	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-jsonrpc/auth"
 
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/apistruct"
 	"github.com/filecoin-project/lotus/node/repo"
 )
@@ -29,6 +32,14 @@ var authCreateAdminToken = &cli.Command{
 			Name:  "perm",
 			Usage: "permission to assign to the token, one of: read, write, sign, admin",
 		},
+		&cli.StringSliceFlag{
+			Name:  "wallet",
+			Usage: "bind the token to a wallet address, can be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "miner",
+			Usage: "bind the token to a miner actor, can be repeated",
+		},
 	},
 
 	Action: func(cctx *cli.Context) error {
@@ -57,7 +68,7 @@ var authCreateAdminToken = &cli.Command{
 		}
 
 		// slice on [:idx] so for example: 'sign' gives you [read, write, sign]
-		token, err := napi.AuthNew(ctx, apistruct.AllPermissions[:idx])
+		token, err := newToken(ctx, cctx, napi, apistruct.AllPermissions[:idx])
 		if err != nil {
 			return err
 		}
@@ -77,6 +88,14 @@ var authApiInfoToken = &cli.Command{
 			Name:  "perm",
 			Usage: "permission to assign to the token, one of: read, write, sign, admin",
 		},
+		&cli.StringSliceFlag{
+			Name:  "wallet",
+			Usage: "bind the token to a wallet address, can be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "miner",
+			Usage: "bind the token to a miner actor, can be repeated",
+		},
 	},
 
 	Action: func(cctx *cli.Context) error {
@@ -105,7 +124,7 @@ var authApiInfoToken = &cli.Command{
 		}
 
 		// slice on [:idx] so for example: 'sign' gives you [read, write, sign]
-		token, err := napi.AuthNew(ctx, apistruct.AllPermissions[:idx])
+		token, err := newToken(ctx, cctx, napi, apistruct.AllPermissions[:idx])
 		if err != nil {
 			return err
 		}
@@ -133,3 +152,28 @@ var authApiInfoToken = &cli.Command{
 		return nil
 	},
 }
+
+// newToken creates a token with the permissions, bound to the wallets and
+// miners passed with --wallet and --miner, if any
+func newToken(ctx context.Context, cctx *cli.Context, napi api.Common, perms []auth.Permission) ([]byte, error) {
+	var ns api.TokenNamespace
+	for _, s := range cctx.StringSlice("wallet") {
+		a, err := address.NewFromString(s)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing wallet address %q: %w", s, err)
+		}
+		ns.Wallets = append(ns.Wallets, a)
+	}
+	for _, s := range cctx.StringSlice("miner") {
+		a, err := address.NewFromString(s)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing miner address %q: %w", s, err)
+		}
+		ns.Miners = append(ns.Miners, a)
+	}
+
+	if len(ns.Wallets) == 0 && len(ns.Miners) == 0 {
+		return napi.AuthNew(ctx, perms)
+	}
+	return napi.AuthNewNamespaced(ctx, perms, ns)
+}
@@ -5,11 +5,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/filecoin-project/go-address"
@@ -20,15 +25,23 @@ import (
 	"github.com/filecoin-project/specs-actors/actors/builtin/market"
 	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
 	"github.com/filecoin-project/specs-actors/actors/builtin/power"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
 	"github.com/filecoin-project/specs-actors/actors/util/adt"
 	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/urfave/cli/v2"
 	cbg "github.com/whyrusleeping/cbor-gen"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/actors"
+	"github.com/filecoin-project/lotus/chain/stmgr"
 	types "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/vm"
+	"github.com/filecoin-project/lotus/lib/addrutil"
 )
 
 var chainCmd = &cli.Command{
@@ -40,11 +53,21 @@ var chainCmd = &cli.Command{
 		chainReadObjCmd,
 		chainStatObjCmd,
 		chainGetMsgCmd,
+		chainDecodeCmd,
 		chainSetHeadCmd,
 		chainListCmd,
 		chainGetCmd,
 		chainBisectCmd,
 		chainExportCmd,
+		chainImportCmd,
+		chainFetchSnapshotCmd,
+		chainVerifyCmd,
+		chainPruneCmd,
+		chainChangefeedCmd,
+		chainEventsCmd,
+		chainNotifyAtCmd,
+		chainMulticallCmd,
+		chainReorgStatsCmd,
 		slashConsensusFault,
 	},
 }
@@ -52,6 +75,12 @@ var chainCmd = &cli.Command{
 var chainHeadCmd = &cli.Command{
 	Name:  "head",
 	Usage: "Print chain head",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "info",
+			Usage: "also print head height, weight and sync lag",
+		},
+	},
 	Action: func(cctx *cli.Context) error {
 		api, closer, err := GetFullNodeAPI(cctx)
 		if err != nil {
@@ -60,6 +89,22 @@ var chainHeadCmd = &cli.Command{
 		defer closer()
 		ctx := ReqContext(cctx)
 
+		if cctx.Bool("info") {
+			hi, err := api.ChainHeadInfo(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, c := range hi.TipSet.Cids() {
+				fmt.Println(c)
+			}
+			fmt.Printf("Height: %d\n", hi.TipSet.Height())
+			fmt.Printf("Weight: %s\n", hi.Weight)
+			fmt.Printf("Finalized: %d\n", hi.FinalizedHeight)
+			fmt.Printf("Behind: %d epochs\n", hi.EpochsBehind)
+			return nil
+		}
+
 		head, err := api.ChainHead(ctx)
 		if err != nil {
 			return err
@@ -270,9 +315,15 @@ var chainGetMsgCmd = &cli.Command{
 			if err != nil {
 				return xerrors.Errorf("failed to decode object as a message: %w", err)
 			}
-			i = sm
+			i = struct {
+				*types.SignedMessage
+				MethodName string `json:",omitempty"`
+			}{sm, messageMethodName(ctx, api, &sm.Message)}
 		} else {
-			i = m
+			i = struct {
+				*types.Message
+				MethodName string `json:",omitempty"`
+			}{m, messageMethodName(ctx, api, m)}
 		}
 
 		enc, err := json.MarshalIndent(i, "", "  ")
@@ -285,6 +336,201 @@ var chainGetMsgCmd = &cli.Command{
 	},
 }
 
+// messageMethodName names the method invoked by a message, based on the
+// receiver's code in the current head state.
+func messageMethodName(ctx context.Context, api api.FullNode, m *types.Message) string {
+	act, err := api.StateGetActor(ctx, m.To, types.EmptyTSK)
+	if err != nil {
+		return ""
+	}
+
+	return stmgr.MethodName(act.Code, m.Method)
+}
+
+var chainDecodeCmd = &cli.Command{
+	Name:      "decode",
+	Usage:     "Decode and pretty-print an on-chain object",
+	ArgsUsage: "[cid]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: "decode the object as the given type instead of inferring it",
+		},
+	},
+	Description: `Fetch an object from the chain blockstore and print it as JSON,
+   annotated with the type it was decoded as.
+
+   Unless --type is given, the type is inferred by trying block headers,
+   messages, built-in actor states and HAMT nodes, in that order. Objects
+   matching none of them are printed as generic CBOR.
+
+   List of --type types:
+   - block
+   - message
+   - smessage, signedmessage
+   - [actor]-state, e.g. miner-state, power-state
+   - hamt
+   - cbor
+   - raw
+`,
+	Action: func(cctx *cli.Context) error {
+		if !cctx.Args().Present() {
+			return fmt.Errorf("must pass a cid of an object to decode")
+		}
+
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		c, err := cid.Decode(cctx.Args().First())
+		if err != nil {
+			return xerrors.Errorf("failed to parse cid input: %w", err)
+		}
+
+		raw, err := api.ChainReadObj(ctx, c)
+		if err != nil {
+			return xerrors.Errorf("failed to read object: %w", err)
+		}
+
+		var typ string
+		var obj interface{}
+		if t := strings.ToLower(cctx.String("type")); t != "" {
+			obj, err = decodeObjectAs(t, raw)
+			if err != nil {
+				return xerrors.Errorf("failed to decode object as %q: %w", t, err)
+			}
+			typ = t
+		} else {
+			typ, obj, err = decodeObject(raw)
+			if err != nil {
+				return xerrors.Errorf("failed to decode object: %w", err)
+			}
+		}
+
+		switch o := obj.(type) {
+		case *types.Message:
+			obj = struct {
+				*types.Message
+				MethodName string `json:",omitempty"`
+			}{o, messageMethodName(ctx, api, o)}
+		case *types.SignedMessage:
+			obj = struct {
+				*types.SignedMessage
+				MethodName string `json:",omitempty"`
+			}{o, messageMethodName(ctx, api, &o.Message)}
+		}
+
+		enc, err := json.MarshalIndent(struct {
+			Cid    cid.Cid
+			Type   string
+			Size   int
+			Object interface{}
+		}{c, typ, len(raw), obj}, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(enc))
+		return nil
+	},
+}
+
+// decodeObjectTypes lists the types tried when inferring the type of an
+// object, in order. Actor states are tried after messages, and HAMT nodes
+// last, as they are the least specific.
+func decodeObjectTypes() []string {
+	out := []string{"block", "signedmessage", "message"}
+
+	states := make([]string, 0, len(stmgr.ActorNames))
+	for _, name := range stmgr.ActorNames {
+		states = append(states, name+"-state")
+	}
+	sort.Strings(states)
+
+	out = append(out, states...)
+	return append(out, "hamt")
+}
+
+func decodeObject(raw []byte) (string, interface{}, error) {
+	for _, t := range decodeObjectTypes() {
+		obj, err := decodeObjectAs(t, raw)
+		if err == nil {
+			return t, obj, nil
+		}
+	}
+
+	obj, err := decodeObjectAs("cbor", raw)
+	if err != nil {
+		return "", nil, err
+	}
+	return "cbor", obj, nil
+}
+
+// decodeObjectAs decodes raw as the named type. Decoding only succeeds if the
+// whole object is consumed, so that type inference doesn't pick a type which
+// happens to match a prefix of the object.
+func decodeObjectAs(t string, raw []byte) (interface{}, error) {
+	switch t {
+	case "raw":
+		return fmt.Sprintf("%x", raw), nil
+	case "cbor":
+		nd, err := cbor.Decode(raw, mh.SHA2_256, -1)
+		if err != nil {
+			return nil, err
+		}
+		return nd, nil
+	}
+
+	var cbu cbg.CBORUnmarshaler
+	switch {
+	case t == "block":
+		cbu = new(types.BlockHeader)
+	case t == "message":
+		cbu = new(types.Message)
+	case t == "smessage", t == "signedmessage":
+		cbu = new(types.SignedMessage)
+	case t == "hamt":
+		cbu = new(hamt.Node)
+	case strings.HasSuffix(t, "-state"):
+		name := strings.TrimSuffix(t, "-state")
+		for code, n := range stmgr.ActorNames {
+			if n != name {
+				continue
+			}
+
+			if code == builtin.AccountActorCodeID {
+				cbu = new(account.State)
+				break
+			}
+
+			st, err := vm.DumpActorState(code, raw)
+			if err != nil {
+				return nil, err
+			}
+			cbu, _ = reflect.New(reflect.TypeOf(st)).Interface().(cbg.CBORUnmarshaler)
+			break
+		}
+		if cbu == nil {
+			return nil, fmt.Errorf("unknown actor %q", name)
+		}
+	default:
+		return nil, fmt.Errorf("unknown type: %q", t)
+	}
+
+	r := bytes.NewReader(raw)
+	if err := cbu.UnmarshalCBOR(r); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes", r.Len())
+	}
+
+	return cbu, nil
+}
+
 var chainSetHeadCmd = &cli.Command{
 	Name:      "sethead",
 	Usage:     "manually set the local nodes head tipset (Caution: normally only used for recovery)",
@@ -790,9 +1036,21 @@ var chainExportCmd = &cli.Command{
 		&cli.StringFlag{
 			Name: "tipset",
 		},
+		&cli.Int64Flag{
+			Name:  "recent-stateroots",
+			Usage: "include the state of the given number of recent epochs, making the export a snapshot",
+		},
+		&cli.BoolFlag{
+			Name:  "skip-old-msgs",
+			Usage: "only include the messages and receipts of the recent epochs",
+		},
+		&cli.Int64Flag{
+			Name:  "depth",
+			Usage: "only export the given number of epochs, instead of the chain from genesis",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
-		api, closer, err := GetFullNodeAPI(cctx)
+		fapi, closer, err := GetFullNodeAPI(cctx)
 		if err != nil {
 			return err
 		}
@@ -814,19 +1072,314 @@ var chainExportCmd = &cli.Command{
 			}
 		}()
 
-		ts, err := LoadTipSet(ctx, cctx, api)
+		ts, err := LoadTipSet(ctx, cctx, fapi)
+		if err != nil {
+			return err
+		}
+
+		rsrs := abi.ChainEpoch(cctx.Int64("recent-stateroots"))
+		if rsrs < 0 {
+			return fmt.Errorf("recent-stateroots must be positive")
+		}
+		if cctx.Bool("skip-old-msgs") && rsrs == 0 {
+			return fmt.Errorf("skip-old-msgs requires recent-stateroots to be set")
+		}
+		depth := abi.ChainEpoch(cctx.Int64("depth"))
+		if depth < 0 {
+			return fmt.Errorf("depth must be positive")
+		}
+
+		stream, err := fapi.ChainExport(ctx, ts.Key(), api.ChainExportOptions{
+			RecentStateRoots: rsrs,
+			SkipOldMessages:  cctx.Bool("skip-old-msgs"),
+			Depth:            depth,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := writeExportStream(fi, stream); err != nil {
+			_ = os.Remove(fi.Name())
+			return err
+		}
+
+		return nil
+	},
+}
+
+// writeExportStream writes the chunks of an export stream, and fails if the
+// stream is closed without the empty chunk ending complete exports
+func writeExportStream(w io.Writer, stream <-chan []byte) error {
+	complete := false
+	for b := range stream {
+		if len(b) == 0 {
+			complete = true
+			continue
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	if !complete {
+		return xerrors.Errorf("export failed on the node, see its logs, the output is incomplete")
+	}
+	return nil
+}
+
+var chainImportCmd = &cli.Command{
+	Name:      "import",
+	Usage:     "import a chain car file, e.g. a snapshot, into the running node",
+	ArgsUsage: "[inputPath]",
+	Description: `The file is read by the node, and the imported tipset becomes the head if
+   it's heavier than the current one. The state of the imported chain is
+   recomputed from genesis first, unless --trusted is set. Snapshots exported
+   with --recent-stateroots let the node sync the rest of the chain from the
+   imported tipset without recomputing its state, they can only be imported
+   with --trusted, so only import snapshots you trust.`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "trusted",
+			Usage: "don't recompute the state of the imported chain, required for snapshots",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		napi, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if !cctx.Args().Present() {
+			return fmt.Errorf("must specify filename to import chain from")
+		}
+
+		absPath, err := filepath.Abs(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		tsk, err := napi.ChainImport(ctx, absPath, cctx.Bool("trusted"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Imported chain up to %s\n", tsk)
+		return nil
+	},
+}
+
+var chainFetchSnapshotCmd = &cli.Command{
+	Name:      "fetch-snapshot",
+	Usage:     "fetch a recent snapshot from a trusted peer and import it",
+	ArgsUsage: "[peerMultiaddr]",
+	Description: `The peer has to serve snapshots, and trust this node, see the SnapshotServer
+   section of its config. Interrupted downloads are resumed when the command is
+   run again, as long as the peer still serves the same snapshot.`,
+	Action: func(cctx *cli.Context) error {
+		napi, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if cctx.Args().Len() != 1 {
+			return fmt.Errorf("must specify the multiaddr of the peer to fetch the snapshot from")
+		}
+
+		pis, err := addrutil.ParseAddresses(ctx, cctx.Args().Slice())
+		if err != nil {
+			return err
+		}
+
+		tsk, err := napi.ChainFetchSnapshot(ctx, pis[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Imported snapshot up to %s\n", tsk)
+		return nil
+	},
+}
+
+var chainVerifyCmd = &cli.Command{
+	Name:  "verify",
+	Usage: "Verify the integrity of the local chain, e.g. after restoring a backup",
+	Description: `Walks the chain from the head, or the given tipset, towards genesis and
+   verifies parent links, block signatures and message roots. The state of a
+   sample of tipsets is recomputed and compared to the state roots in the
+   chain, which is slow, so only a small share is sampled by default.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "tipset",
+			Usage: "tipset to start from, the head by default",
+		},
+		&cli.Uint64Flag{
+			Name:  "depth",
+			Usage: "number of tipsets to verify, 0 walks to genesis",
+		},
+		&cli.Float64Flag{
+			Name:  "state-sample",
+			Usage: "share of tipsets whose state is recomputed, between 0 and 1",
+			Value: 0.001,
+		},
+		&cli.IntFlag{
+			Name:  "max-errors",
+			Usage: "stop after that many errors, 0 means no limit",
+			Value: 100,
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "stop verifying after this long, the node default is used when 0",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		napi, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		opts := api.ChainVerifyOptions{
+			Depth:       cctx.Uint64("depth"),
+			StateSample: cctx.Float64("state-sample"),
+			MaxErrors:   cctx.Int("max-errors"),
+			Timeout:     cctx.Duration("timeout"),
+		}
+		if cctx.IsSet("tipset") {
+			ts, err := LoadTipSet(ctx, cctx, napi)
+			if err != nil {
+				return err
+			}
+			opts.From = ts.Key()
+		}
+
+		rep, err := napi.ChainVerify(ctx, opts)
 		if err != nil {
 			return err
 		}
 
-		stream, err := api.ChainExport(ctx, ts.Key())
+		fmt.Printf("Verified heights %d to %d in %s\n", rep.FromHeight, rep.ToHeight, rep.Duration.Truncate(time.Second))
+		fmt.Printf("%d tipsets, %d blocks, %d messages, %d states recomputed\n", rep.Tipsets, rep.Blocks, rep.Messages, rep.StatesChecked)
+		if rep.TimedOut {
+			fmt.Println("Timed out, the tipsets below weren't verified")
+		}
+
+		if len(rep.Errors) == 0 {
+			fmt.Println("No problems found")
+			return nil
+		}
+
+		for _, e := range rep.Errors {
+			if e.Block.Defined() {
+				fmt.Printf("height %d, block %s: %s: %s\n", e.Height, e.Block, e.Check, e.Error)
+			} else {
+				fmt.Printf("height %d, tipset %s: %s: %s\n", e.Height, e.TipSet, e.Check, e.Error)
+			}
+		}
+		return xerrors.Errorf("found %d problems", len(rep.Errors))
+	},
+}
+
+var chainChangefeedCmd = &cli.Command{
+	Name:  "changefeed",
+	Usage: "Stream the changefeed entries as JSON, one per line",
+	Flags: []cli.Flag{
+		&cli.Uint64Flag{
+			Name:  "after",
+			Usage: "stream the entries after this sequence number",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		entries, err := api.ChainChangefeed(ctx, cctx.Uint64("after"))
+		if err != nil {
+			return err
+		}
+
+		last := cctx.Uint64("after")
+		enc := json.NewEncoder(os.Stdout)
+		for e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+			last = e.Seq
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		return xerrors.Errorf("changefeed stream closed after entry %d", last)
+	},
+}
+
+var chainEventsCmd = &cli.Command{
+	Name:  "events",
+	Usage: "Stream the executions of matching messages as JSON, one event per line",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "actor",
+			Usage: "match messages sent to the actor",
+		},
+		&cli.Int64SliceFlag{
+			Name:  "method",
+			Usage: "match messages calling the method number",
+		},
+		&cli.Int64SliceFlag{
+			Name:  "exit-code",
+			Usage: "match executions with the exit code",
+		},
+		&cli.Uint64Flag{
+			Name:  "confidence",
+			Usage: "number of epochs to wait before sending executions",
+		},
+		&cli.BoolFlag{
+			Name:  "final",
+			Usage: "send executions once they are final",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		napi, closer, err := GetFullNodeAPI(cctx)
 		if err != nil {
 			return err
 		}
+		defer closer()
+		ctx := ReqContext(cctx)
 
-		for b := range stream {
-			_, err := fi.Write(b)
+		filter := api.EventFilter{
+			Confidence: cctx.Uint64("confidence"),
+			Final:      cctx.Bool("final"),
+		}
+		for _, s := range cctx.StringSlice("actor") {
+			a, err := address.NewFromString(s)
 			if err != nil {
+				return xerrors.Errorf("parsing actor address %q: %w", s, err)
+			}
+			filter.Actors = append(filter.Actors, a)
+		}
+		for _, m := range cctx.Int64Slice("method") {
+			filter.Methods = append(filter.Methods, abi.MethodNum(m))
+		}
+		for _, c := range cctx.Int64Slice("exit-code") {
+			filter.ExitCodes = append(filter.ExitCodes, exitcode.ExitCode(c))
+		}
+
+		evs, err := napi.ChainSubscribeEvents(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		for ev := range evs {
+			if err := enc.Encode(ev); err != nil {
 				return err
 			}
 		}
@@ -835,6 +1388,217 @@ var chainExportCmd = &cli.Command{
 	},
 }
 
+var chainNotifyAtCmd = &cli.Command{
+	Name:      "notify-at",
+	Usage:     "Print an event as JSON when the chain reaches a height, and when it's reverted",
+	ArgsUsage: "<height>",
+	Flags: []cli.Flag{
+		&cli.Uint64Flag{
+			Name:  "confidence",
+			Usage: "number of epochs to wait after the height",
+		},
+		&cli.BoolFlag{
+			Name:  "once",
+			Usage: "exit after the first apply event",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return xerrors.Errorf("expected 1 argument: height")
+		}
+		h, err := strconv.ParseInt(cctx.Args().First(), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing height: %w", err)
+		}
+
+		napi, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		evs, err := napi.ChainNotifyAt(ctx, abi.ChainEpoch(h), cctx.Uint64("confidence"))
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		for ev := range evs {
+			if err := enc.Encode(ev); err != nil {
+				return err
+			}
+			if cctx.Bool("once") && ev.Type == "apply" {
+				return nil
+			}
+		}
+
+		return nil
+	},
+}
+
+var chainMulticallCmd = &cli.Command{
+	Name:      "multicall",
+	Usage:     "Execute read-only API calls against the same tipset",
+	ArgsUsage: "[calls file (reads stdin by default)]",
+	Description: `The calls are a JSON array of {"Method": "StateGetActor", "Params": [...]}
+   objects, with parameters given as in JSON-RPC requests. Empty tipset keys in
+   the parameters are replaced by the tipset the calls are executed against.
+   The result is printed as JSON.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "tipset",
+			Usage: "specify tipset to call against, the head by default",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		napi, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		in := os.Stdin
+		if cctx.Args().Present() && cctx.Args().First() != "-" {
+			f, err := os.Open(cctx.Args().First())
+			if err != nil {
+				return xerrors.Errorf("opening calls file: %w", err)
+			}
+			defer f.Close() //nolint:errcheck
+			in = f
+		}
+
+		var calls []api.Call
+		if err := json.NewDecoder(in).Decode(&calls); err != nil {
+			return xerrors.Errorf("decoding calls: %w", err)
+		}
+
+		ts, err := LoadTipSet(ctx, cctx, napi)
+		if err != nil {
+			return err
+		}
+		tsk := types.EmptyTSK
+		if ts != nil {
+			tsk = ts.Key()
+		}
+
+		res, err := napi.ChainMulticall(ctx, tsk, calls)
+		if err != nil {
+			return err
+		}
+
+		out, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	},
+}
+
+var chainReorgStatsCmd = &cli.Command{
+	Name:  "reorgs",
+	Usage: "Show statistics of the reorgs observed since the node started",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "recent",
+			Usage: "number of recent reorgs to list",
+			Value: 10,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		napi, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		st, err := napi.ChainReorgStats(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Reorgs since %s: %d\n", st.Since.Format(time.RFC3339), st.Total)
+		if st.Total == 0 {
+			return nil
+		}
+		fmt.Printf("Max depth: %d, mean depth: %.2f\n\n", st.MaxDepth, st.MeanDepth)
+
+		fmt.Println("Depth histogram:")
+		var prev abi.ChainEpoch
+		for _, b := range st.Histogram {
+			r := fmt.Sprintf("%d+", prev+1)
+			if b.MaxDepth != 0 {
+				r = fmt.Sprintf("%d-%d", prev+1, b.MaxDepth)
+				if b.MaxDepth == prev+1 {
+					r = fmt.Sprint(b.MaxDepth)
+				}
+			}
+			fmt.Printf("  %-6s %d\n", r, b.Count)
+			prev = b.MaxDepth
+		}
+
+		recent := st.Recent
+		if n := cctx.Int("recent"); len(recent) > n {
+			recent = recent[len(recent)-n:]
+		}
+		if len(recent) == 0 {
+			return nil
+		}
+
+		fmt.Println("\nRecent reorgs:")
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Time\tDepth\tOld Height\tNew Height\tWeight Diff\tFork Age\n")
+		for _, r := range recent {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", r.Time.Format(time.RFC3339), r.Depth, r.OldHeight, r.NewHeight, types.BigSub(r.NewWeight, r.OldWeight), r.ForkAge.Truncate(time.Second))
+		}
+		return w.Flush()
+	},
+}
+
+var chainPruneCmd = &cli.Command{
+	Name:  "prune",
+	Usage: "Remove objects of the chain blockstore which aren't needed anymore",
+	Description: `Removes the objects of the chain blockstore which aren't reachable from the
+   chain, including the state of tipsets older than --keep-state-roots. Block
+   headers, messages and receipts are kept. Use --dry-run to see how much
+   space would be reclaimed.`,
+	Flags: []cli.Flag{
+		&cli.Int64Flag{
+			Name:  "keep-state-roots",
+			Usage: "number of recent tipsets whose state is kept",
+			Value: int64(build.Finality),
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only report what would be removed",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		rep, err := api.ChainPrune(ctx, abi.ChainEpoch(cctx.Int64("keep-state-roots")), cctx.Bool("dry-run"))
+		if err != nil {
+			return err
+		}
+
+		verb := "Removed"
+		if rep.DryRun {
+			verb = "Would remove"
+		}
+		fmt.Printf("%s %d objects (%s), kept %d objects\n", verb, rep.Removed, types.SizeStr(types.NewInt(rep.RemovedBytes)), rep.Kept)
+		fmt.Printf("State kept from height %d, took %s\n", rep.KeptFrom, rep.Duration.Truncate(time.Second))
+		return nil
+	},
+}
+
 var slashConsensusFault = &cli.Command{
 	Name:      "slash-consensus",
 	Usage:     "Report consensus fault",
@@ -940,7 +1704,7 @@ var slashConsensusFault = &cli.Command{
 			Params:   enc,
 		}
 
-		smsg, err := api.MpoolPushMessage(ctx, msg)
+		smsg, err := api.MpoolPushMessage(ctx, msg, nil)
 		if err != nil {
 			return err
 		}
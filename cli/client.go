@@ -63,6 +63,7 @@ var clientCmd = &cli.Command{
 		clientQueryAskCmd,
 		clientListDeals,
 		clientCarGenCmd,
+		clientExtractCmd,
 	},
 }
 
@@ -75,6 +76,10 @@ var clientImportCmd = &cli.Command{
 			Name:  "car",
 			Usage: "import from a car file instead of a regular file",
 		},
+		&cli.BoolFlag{
+			Name:  "encrypt",
+			Usage: "encrypt the data with the payload encryption key of the node",
+		},
 		&CidBaseFlag,
 	},
 	Action: func(cctx *cli.Context) error {
@@ -95,8 +100,9 @@ var clientImportCmd = &cli.Command{
 		}
 
 		ref := lapi.FileRef{
-			Path:  absPath,
-			IsCAR: cctx.Bool("car"),
+			Path:    absPath,
+			IsCAR:   cctx.Bool("car"),
+			Encrypt: cctx.Bool("encrypt"),
 		}
 		c, err := api.ClientImport(ctx, ref)
 		if err != nil {
@@ -184,6 +190,55 @@ var clientCarGenCmd = &cli.Command{
 	},
 }
 
+var clientExtractCmd = &cli.Command{
+	Name:      "extract",
+	Usage:     "rebuild the files of a retrieved car, or of an unsealed piece",
+	ArgsUsage: "[inputPath outputDir]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "payload",
+			Usage: "cid of the payload to extract, defaults to the root of the car",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if cctx.Args().Len() != 2 {
+			return fmt.Errorf("usage: extract <inputPath> <outputDir>")
+		}
+
+		payload := cid.Undef
+		if p := cctx.String("payload"); p != "" {
+			payload, err = cid.Parse(p)
+			if err != nil {
+				return xerrors.Errorf("parsing payload cid: %w", err)
+			}
+		}
+
+		inpath, err := filepath.Abs(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+		outdir, err := filepath.Abs(cctx.Args().Get(1))
+		if err != nil {
+			return err
+		}
+
+		res, err := api.ClientExtract(ctx, inpath, payload, outdir)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Extracted %s to %s: %d files, %s, from %d blocks\n", res.Root, res.Path, res.Files, types.SizeStr(types.NewInt(uint64(res.Bytes))), res.Blocks)
+		return nil
+	},
+}
+
 var clientLocalCmd = &cli.Command{
 	Name:  "local",
 	Usage: "List locally imported data",
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -20,6 +21,7 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/client"
+	"github.com/filecoin-project/lotus/lib/rpctls"
 	"github.com/filecoin-project/lotus/node/repo"
 )
 
@@ -52,7 +54,11 @@ type APIInfo struct {
 }
 
 func (a APIInfo) DialArgs() (string, error) {
-	_, addr, err := manet.DialArgs(a.Addr)
+	ma, secure := rpctls.SplitAddr(a.Addr)
+	_, addr, err := manet.DialArgs(ma)
+	if secure {
+		return "wss://" + addr + "/rpc/v0", err
+	}
 
 	return "ws://" + addr + "/rpc/v0", err
 }
@@ -89,23 +95,50 @@ func envForRepo(t repo.RepoType) string {
 	}
 }
 
+// GetAPIInfo returns the API endpoint of the node of the given type. If the
+// environment lists several endpoints, the first one is returned.
 func GetAPIInfo(ctx *cli.Context, t repo.RepoType) (APIInfo, error) {
+	infos, err := GetAPIInfos(ctx, t)
+	if err != nil {
+		return APIInfo{}, err
+	}
+	return infos[0], nil
+}
+
+// GetAPIInfos returns all the API endpoints of the node of the given type. The
+// environment variable may list several 'token:multiaddr' endpoints separated
+// by commas, e.g. for failover between redundant nodes.
+func GetAPIInfos(ctx *cli.Context, t repo.RepoType) ([]APIInfo, error) {
 	if env, ok := os.LookupEnv(envForRepo(t)); ok {
-		sp := strings.SplitN(env, ":", 2)
-		if len(sp) != 2 {
-			log.Warnf("invalid env(%s) value, missing token or address", envForRepo(t))
-		} else {
+		var infos []APIInfo
+		for _, ent := range strings.Split(env, ",") {
+			sp := strings.SplitN(strings.TrimSpace(ent), ":", 2)
+			if len(sp) != 2 {
+				log.Warnf("invalid env(%s) value, missing token or address", envForRepo(t))
+				continue
+			}
 			ma, err := multiaddr.NewMultiaddr(sp[1])
 			if err != nil {
-				return APIInfo{}, xerrors.Errorf("could not parse multiaddr from env(%s): %w", envForRepo(t), err)
+				return nil, xerrors.Errorf("could not parse multiaddr from env(%s): %w", envForRepo(t), err)
 			}
-			return APIInfo{
+			infos = append(infos, APIInfo{
 				Addr:  ma,
 				Token: []byte(sp[0]),
-			}, nil
+			})
+		}
+		if len(infos) > 0 {
+			return infos, nil
 		}
 	}
 
+	info, err := getRepoAPIInfo(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	return []APIInfo{info}, nil
+}
+
+func getRepoAPIInfo(ctx *cli.Context, t repo.RepoType) (APIInfo, error) {
 	repoFlag := flagForRepo(t)
 
 	p, err := homedir.Expand(ctx.String(repoFlag))
@@ -128,6 +161,15 @@ func GetAPIInfo(ctx *cli.Context, t repo.RepoType) (APIInfo, error) {
 		log.Warnf("Couldn't load CLI token, capabilities may be limited: %v", err)
 	}
 
+	// the node serves mutual TLS, connect with the certificate in its repo
+	if _, secure := rpctls.SplitAddr(ma); secure {
+		cfg, err := rpctls.ClientConfig(filepath.Join(p, rpctls.DirName))
+		if err != nil {
+			return APIInfo{}, xerrors.Errorf("loading API client certificate: %w", err)
+		}
+		rpctls.InstallClient(cfg)
+	}
+
 	return APIInfo{
 		Addr:  ma,
 		Token: token,
@@ -168,12 +210,21 @@ func GetAPI(ctx *cli.Context) (api.Common, jsonrpc.ClientCloser, error) {
 }
 
 func GetFullNodeAPI(ctx *cli.Context) (api.FullNode, jsonrpc.ClientCloser, error) {
-	addr, headers, err := GetRawAPI(ctx, repo.FullNode)
+	infos, err := GetAPIInfos(ctx, repo.FullNode)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, xerrors.Errorf("could not get API info: %w", err)
+	}
+
+	if len(infos) > 1 {
+		return newFailoverFullNode(DaemonContext(ctx), infos)
+	}
+
+	addr, err := infos[0].DialArgs()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("could not get DialArgs: %w", err)
 	}
 
-	return client.NewFullNodeRPC(addr, headers)
+	return client.NewFullNodeRPC(addr, infos[0].AuthHeader())
 }
 
 func GetStorageMinerAPI(ctx *cli.Context) (api.StorageMiner, jsonrpc.ClientCloser, error) {
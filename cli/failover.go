@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/api/client"
+)
+
+// ProbeTimeout is how long a node may take to answer the health probe before
+// the next endpoint is tried
+var ProbeTimeout = 5 * time.Second
+
+// failoverNode keeps a connection to one of several redundant full nodes. When
+// a call fails because the connection to the current node broke, the next
+// healthy node is connected and the call is retried there.
+type failoverNode struct {
+	ctx   context.Context
+	infos []APIInfo
+
+	lk     sync.Mutex
+	cur    int
+	node   *apistruct.FullNodeStruct
+	closer jsonrpc.ClientCloser
+}
+
+func newFailoverFullNode(ctx context.Context, infos []APIInfo) (api.FullNode, jsonrpc.ClientCloser, error) {
+	f := &failoverNode{
+		ctx:   ctx,
+		infos: infos,
+		cur:   -1,
+	}
+
+	if _, err := f.current(nil); err != nil {
+		return nil, nil, err
+	}
+
+	var out apistruct.FullNodeStruct
+	f.proxy(reflect.ValueOf(&out.CommonStruct.Internal).Elem(), func(n *apistruct.FullNodeStruct) reflect.Value {
+		return reflect.ValueOf(&n.CommonStruct.Internal).Elem()
+	})
+	f.proxy(reflect.ValueOf(&out.Internal).Elem(), func(n *apistruct.FullNodeStruct) reflect.Value {
+		return reflect.ValueOf(&n.Internal).Elem()
+	})
+
+	return &out, f.close, nil
+}
+
+// proxy sets all methods of the internal struct to call the same method of
+// the current node. Calls to read methods are retried on the next node when
+// they fail on connection errors, calls which may change state aren't, as the
+// failed call may have been executed.
+func (f *failoverNode) proxy(out reflect.Value, internal func(*apistruct.FullNodeStruct) reflect.Value) {
+	for i := 0; i < out.NumField(); i++ {
+		i := i
+		sf := out.Type().Field(i)
+		ft := sf.Type
+		if ft.Kind() != reflect.Func {
+			continue
+		}
+
+		if ft.NumOut() == 0 || ft.Out(ft.NumOut()-1) != errorType {
+			// nothing to fail over on, call the current node
+			out.Field(i).Set(reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+				node, err := f.current(nil)
+				if err != nil {
+					log.Errorf("API call %s: %s", sf.Name, err)
+					return zeroResult(ft)
+				}
+				return internal(node).Field(i).Call(args)
+			}))
+			continue
+		}
+
+		retry := sf.Tag.Get("perm") == string(apistruct.PermRead)
+
+		out.Field(i).Set(reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+			var failed *apistruct.FullNodeStruct
+			for attempt := 0; ; attempt++ {
+				node, err := f.current(failed)
+				if err != nil {
+					return errorResult(ft, err)
+				}
+
+				res := internal(node).Field(i).Call(args)
+				rerr, _ := res[len(res)-1].Interface().(error)
+				if rerr == nil || !isConnectionError(rerr) {
+					return res
+				}
+
+				failed = node
+				if !retry || attempt+1 >= len(f.infos) {
+					// the call isn't retried, the next call goes to the
+					// next node
+					if _, err := f.current(failed); err != nil {
+						log.Warnf("API call %s failed, and no other node is healthy: %s", sf.Name, err)
+					}
+					return res
+				}
+
+				log.Warnf("API call %s to %s failed, trying next node: %s", sf.Name, f.infos[f.cur].Addr, rerr)
+			}
+		}))
+	}
+}
+
+// current returns the connected node. If failed is the connected node, it's
+// disconnected, and the next healthy node is connected.
+func (f *failoverNode) current(failed *apistruct.FullNodeStruct) (*apistruct.FullNodeStruct, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	if f.node != nil && f.node != failed {
+		return f.node, nil
+	}
+
+	if f.closer != nil {
+		f.closer()
+		f.node, f.closer = nil, nil
+	}
+
+	var errs []string
+	for n := 1; n <= len(f.infos); n++ {
+		i := (f.cur + n) % len(f.infos)
+
+		node, closer, err := f.connect(f.infos[i])
+		if err != nil {
+			log.Warnf("API endpoint %s is unhealthy: %s", f.infos[i].Addr, err)
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		f.cur, f.node, f.closer = i, node, closer
+		return node, nil
+	}
+
+	return nil, xerrors.Errorf("no healthy API endpoint: %s", strings.Join(errs, "; "))
+}
+
+// connect dials the endpoint, and checks that the node answers
+func (f *failoverNode) connect(info APIInfo) (*apistruct.FullNodeStruct, jsonrpc.ClientCloser, error) {
+	addr, err := info.DialArgs()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("could not get DialArgs: %w", err)
+	}
+
+	node, closer, err := client.NewFullNodeRPC(addr, info.AuthHeader())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(f.ctx, ProbeTimeout)
+	defer cancel()
+
+	if _, err := node.Version(ctx); err != nil {
+		closer()
+		return nil, nil, xerrors.Errorf("health probe: %w", err)
+	}
+
+	return node.(*apistruct.FullNodeStruct), closer, nil
+}
+
+func (f *failoverNode) close() {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	if f.closer != nil {
+		f.closer()
+		f.node, f.closer = nil, nil
+	}
+}
+
+var errorType = reflect.TypeOf(new(error)).Elem()
+
+func zeroResult(ft reflect.Type) []reflect.Value {
+	out := make([]reflect.Value, ft.NumOut())
+	for i := range out {
+		out[i] = reflect.Zero(ft.Out(i))
+	}
+	return out
+}
+
+func errorResult(ft reflect.Type, err error) []reflect.Value {
+	out := zeroResult(ft)
+	out[len(out)-1] = reflect.ValueOf(&err).Elem()
+	return out
+}
+
+// isConnectionError returns true for errors caused by a broken connection to
+// the node, as opposed to errors returned by the called method
+func isConnectionError(err error) bool {
+	var nerr net.Error
+	if xerrors.As(err, &nerr) {
+		return true
+	}
+
+	var cerr *websocket.CloseError
+	if xerrors.As(err, &cerr) {
+		return true
+	}
+
+	for _, target := range []error{io.EOF, io.ErrUnexpectedEOF, syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.EPIPE} {
+		if xerrors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
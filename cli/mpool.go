@@ -3,7 +3,11 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
@@ -11,6 +15,7 @@ import (
 	"github.com/filecoin-project/go-address"
 
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/msgaudit"
 )
 
 var mpoolCmd = &cli.Command{
@@ -20,6 +25,12 @@ var mpoolCmd = &cli.Command{
 		mpoolPending,
 		mpoolSub,
 		mpoolStat,
+		mpoolAuditExport,
+		mpoolReplace,
+		mpoolCancel,
+		mpoolLocal,
+		mpoolPurgeLocal,
+		mpoolGasPrice,
 	},
 }
 
@@ -228,3 +239,281 @@ var mpoolStat = &cli.Command{
 		return nil
 	},
 }
+
+var mpoolAuditExport = &cli.Command{
+	Name:  "audit-export",
+	Usage: "Export the audit log of messages pushed through the API",
+	Description: `Records are written to stdout, one JSON object per line, in the format
+   they're stored in. The node verifies the MACs of the records, the chain of the
+   exported records is verified again, the first record links to the last one
+   before the exported range.`,
+	Flags: []cli.Flag{
+		&cli.TimestampFlag{
+			Name:   "since",
+			Usage:  "export records made since (RFC3339)",
+			Layout: time.RFC3339,
+		},
+		&cli.TimestampFlag{
+			Name:   "until",
+			Usage:  "export records made until (RFC3339)",
+			Layout: time.RFC3339,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		var since, until time.Time
+		if t := cctx.Timestamp("since"); t != nil {
+			since = *t
+		}
+		if t := cctx.Timestamp("until"); t != nil {
+			until = *t
+		}
+
+		records, err := api.MpoolAuditExport(ctx, since, until)
+		if err != nil {
+			return err
+		}
+
+		if err := msgaudit.Verify(nil, records); err != nil {
+			return xerrors.Errorf("verifying exported records: %w", err)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+var mpoolReplace = &cli.Command{
+	Name:      "replace",
+	Usage:     "Replace a pending message with the same message paying a higher gas price",
+	ArgsUsage: "<from> <nonce>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "gas-price",
+			Usage: "gas price of the replacement, the lowest accepted price by default",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		from, nonce, err := parseFromNonce(cctx)
+		if err != nil {
+			return err
+		}
+
+		gasPrice := types.NewInt(0)
+		if cctx.IsSet("gas-price") {
+			gasPrice, err = types.BigFromString(cctx.String("gas-price"))
+			if err != nil {
+				return xerrors.Errorf("parsing gas price: %w", err)
+			}
+		}
+
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		smsg, err := api.MpoolReplace(ctx, from, nonce, gasPrice)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Replaced with %s (gas price %s)\n", smsg.Cid(), smsg.Message.GasPrice)
+		return nil
+	},
+}
+
+var mpoolCancel = &cli.Command{
+	Name:      "cancel",
+	Usage:     "Cancel a pending message by replacing it with a send to the sender",
+	ArgsUsage: "<from> <nonce>",
+	Action: func(cctx *cli.Context) error {
+		from, nonce, err := parseFromNonce(cctx)
+		if err != nil {
+			return err
+		}
+
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		smsg, err := api.MpoolCancel(ctx, from, nonce)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Replaced with %s (gas price %s)\n", smsg.Cid(), smsg.Message.GasPrice)
+		return nil
+	},
+}
+
+var mpoolLocal = &cli.Command{
+	Name:  "local",
+	Usage: "List the persisted messages pushed through this node, with their status",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		msgs, err := api.MpoolLocal(ctx)
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(msgs, func(i, j int) bool {
+			mi, mj := msgs[i].Message.Message, msgs[j].Message.Message
+			if mi.From != mj.From {
+				return mi.From.String() < mj.From.String()
+			}
+			return mi.Nonce < mj.Nonce
+		})
+
+		for _, m := range msgs {
+			fmt.Printf("%s\t%s\t%d\t%s", m.Cid, m.Message.Message.From, m.Message.Message.Nonce, m.Status)
+			if m.Error != "" {
+				fmt.Printf("\t%s", m.Error)
+			}
+			fmt.Println()
+		}
+
+		return nil
+	},
+}
+
+var mpoolPurgeLocal = &cli.Command{
+	Name:  "purge-local",
+	Usage: "Remove the persisted local messages which aren't pending anymore",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		n, err := api.MpoolPurgeLocal(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed %d messages\n", n)
+		return nil
+	},
+}
+
+var mpoolGasPrice = &cli.Command{
+	Name:  "gas-price",
+	Usage: "Estimate the gas price of a message from the prices paid in recent blocks",
+	Flags: []cli.Flag{
+		&cli.Uint64Flag{
+			Name:  "blocks",
+			Usage: "number of epochs the message should be included within",
+			Value: 3,
+		},
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "sender of the message, its pending messages are included first",
+		},
+		&cli.Int64Flag{
+			Name:  "gas-limit",
+			Usage: "gas limit of the message",
+			Value: 10000,
+		},
+		&cli.StringFlag{
+			Name:  "percentiles",
+			Usage: "also print these comma separated percentiles of the gas prices paid in recent blocks",
+		},
+		&cli.Uint64Flag{
+			Name:  "lookback",
+			Usage: "number of tipsets the percentiles are computed over",
+			Value: 20,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		var from address.Address
+		if cctx.IsSet("from") {
+			var err error
+			from, err = address.NewFromString(cctx.String("from"))
+			if err != nil {
+				return xerrors.Errorf("parsing sender address: %w", err)
+			}
+		}
+
+		var percentiles []float64
+		if ps := cctx.String("percentiles"); ps != "" {
+			for _, p := range strings.Split(ps, ",") {
+				f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+				if err != nil {
+					return xerrors.Errorf("parsing percentile %q: %w", p, err)
+				}
+				percentiles = append(percentiles, f)
+			}
+		}
+
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		price, err := api.GasEstimateGasPrice(ctx, cctx.Uint64("blocks"), from, cctx.Int64("gas-limit"), types.EmptyTSK)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Gas price for inclusion within %d epochs: %s\n", cctx.Uint64("blocks"), price)
+
+		if len(percentiles) == 0 {
+			return nil
+		}
+
+		prices, err := api.GasPricePercentiles(ctx, cctx.Uint64("lookback"), percentiles, types.EmptyTSK)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Gas prices paid in the last %d tipsets:\n", cctx.Uint64("lookback"))
+		for i, p := range percentiles {
+			fmt.Printf("  p%g:\t%s\n", p, prices[i])
+		}
+
+		return nil
+	},
+}
+
+func parseFromNonce(cctx *cli.Context) (address.Address, uint64, error) {
+	if cctx.NArg() != 2 {
+		return address.Undef, 0, xerrors.Errorf("expected 2 arguments: sender address and nonce")
+	}
+
+	from, err := address.NewFromString(cctx.Args().Get(0))
+	if err != nil {
+		return address.Undef, 0, xerrors.Errorf("parsing sender address: %w", err)
+	}
+
+	nonce, err := strconv.ParseUint(cctx.Args().Get(1), 10, 64)
+	if err != nil {
+		return address.Undef, 0, xerrors.Errorf("parsing nonce: %w", err)
+	}
+
+	return from, nonce, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/libp2p/go-libp2p-core/peer"
 
@@ -22,6 +23,8 @@ var netCmd = &cli.Command{
 		netId,
 		netFindPeer,
 		netScores,
+		netBlocksyncPeers,
+		netProtocols,
 	},
 }
 
@@ -75,6 +78,81 @@ var netScores = &cli.Command{
 	},
 }
 
+var netBlocksyncPeers = &cli.Command{
+	Name:  "blocksync",
+	Usage: "Print reputation of blocksync peers",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+		peers, err := api.NetBlocksyncPeers(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, peer := range peers {
+			state := "ok"
+			switch {
+			case time.Now().Before(peer.BannedUntil):
+				state = fmt.Sprintf("banned until %s", peer.BannedUntil.Format(time.Stamp))
+			case peer.Demoted:
+				state = "demoted"
+			case !peer.Connected:
+				state = "disconnected"
+			}
+			fmt.Printf("%s, score %d, offenses %d, %d/%d ok, avg %s, %s\n", peer.ID, peer.Score, peer.Offenses, peer.Successes, peer.Successes+peer.Failures, peer.AverageTime, state)
+		}
+
+		return nil
+	},
+}
+
+var netProtocols = &cli.Command{
+	Name:  "protocols",
+	Usage: "Print the number of peers supporting each sync and markets protocol",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "peers",
+			Usage: "also print the protocols of every peer",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+		census, err := api.NetProtocolCensus(ctx)
+		if err != nil {
+			return err
+		}
+
+		protos := make([]string, 0, len(census.Protocols))
+		for proto := range census.Protocols {
+			protos = append(protos, proto)
+		}
+		sort.Strings(protos)
+
+		fmt.Printf("%d peers, %d unidentified\n", census.Peers, census.Unidentified)
+		for _, proto := range protos {
+			fmt.Printf("%s: %d\n", proto, census.Protocols[proto])
+		}
+
+		if cctx.Bool("peers") {
+			fmt.Println()
+			for _, peer := range census.PeerProtocols {
+				fmt.Printf("%s, %s\n", peer.ID, strings.Join(peer.Protocols, " "))
+			}
+		}
+
+		return nil
+	},
+}
+
 var netListen = &cli.Command{
 	Name:  "listen",
 	Usage: "List listen addresses",
@@ -4,8 +4,10 @@ import (
 	"fmt"
 
 	"github.com/filecoin-project/go-address"
+	lapi "github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
 )
 
 var sendCmd = &cli.Command{
@@ -19,14 +21,22 @@ var sendCmd = &cli.Command{
 		},
 		&cli.StringFlag{
 			Name:  "gas-price",
-			Usage: "specify gas price to use in AttoFIL",
-			Value: "0",
+			Usage: "specify gas price to use in AttoFIL, estimated from recent blocks by default",
+		},
+		&cli.Uint64Flag{
+			Name:  "inclusion-blocks",
+			Usage: "number of epochs the message should be included within when estimating the gas price",
+			Value: 3,
 		},
 		&cli.Int64Flag{
 			Name:  "nonce",
 			Usage: "specify the nonce to use",
 			Value: -1,
 		},
+		&cli.StringFlag{
+			Name:  "idempotency-key",
+			Usage: "don't send again if a message with this key was already sent from the account recently",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		api, closer, err := GetFullNodeAPI(cctx)
@@ -68,17 +78,23 @@ var sendCmd = &cli.Command{
 			fromAddr = addr
 		}
 
-		gp, err := types.BigFromString(cctx.String("gas-price"))
-		if err != nil {
-			return err
-		}
-
 		msg := &types.Message{
 			From:     fromAddr,
 			To:       toAddr,
 			Value:    types.BigInt(val),
 			GasLimit: 10000,
-			GasPrice: gp,
+		}
+
+		if cctx.IsSet("gas-price") {
+			msg.GasPrice, err = types.BigFromString(cctx.String("gas-price"))
+			if err != nil {
+				return err
+			}
+		} else {
+			msg.GasPrice, err = api.GasEstimateGasPrice(ctx, cctx.Uint64("inclusion-blocks"), fromAddr, msg.GasLimit, types.EmptyTSK)
+			if err != nil {
+				return xerrors.Errorf("estimating gas price: %w", err)
+			}
 		}
 
 		if cctx.Int64("nonce") > 0 {
@@ -94,7 +110,12 @@ var sendCmd = &cli.Command{
 			}
 			fmt.Println(sm.Cid())
 		} else {
-			sm, err := api.MpoolPushMessage(ctx, msg)
+			var spec *lapi.MessageSendSpec
+			if key := cctx.String("idempotency-key"); key != "" {
+				spec = &lapi.MessageSendSpec{IdempotencyKey: key}
+			}
+
+			sm, err := api.MpoolPushMessage(ctx, msg, spec)
 			if err != nil {
 				return err
 			}
@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"html/template"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/ipfs/go-cid"
@@ -60,11 +62,94 @@ var stateCmd = &cli.Command{
 		stateReadStateCmd,
 		stateListMessagesCmd,
 		stateComputeStateCmd,
+		stateGasTraceCmd,
+		stateUpgradeDryRunsCmd,
 		stateCallCmd,
 		stateGetDealSetCmd,
 		stateWaitMsgCmd,
 		stateSearchMsgCmd,
+		stateRebuildMsgIndexCmd,
 		stateMinerInfo,
+		stateSnapshotCmd,
+		stateImportSnapshotCmd,
+	},
+}
+
+var stateSnapshotCmd = &cli.Command{
+	Name:      "snapshot",
+	Usage:     "export the state tree of a tipset to a car file",
+	ArgsUsage: "[outputPath]",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if !cctx.Args().Present() {
+			return fmt.Errorf("must specify filename to export state to")
+		}
+
+		ts, err := LoadTipSet(ctx, cctx, api)
+		if err != nil {
+			return err
+		}
+
+		fi, err := os.Create(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err := fi.Close()
+			if err != nil {
+				fmt.Printf("error closing output file: %+v", err)
+			}
+		}()
+
+		stream, err := api.StateSnapshot(ctx, ts.Key())
+		if err != nil {
+			return err
+		}
+
+		if err := writeExportStream(fi, stream); err != nil {
+			_ = os.Remove(fi.Name())
+			return err
+		}
+
+		fmt.Printf("Exported the state of tipset %s\n", ts.Cids())
+		return nil
+	},
+}
+
+var stateImportSnapshotCmd = &cli.Command{
+	Name:      "import-snapshot",
+	Usage:     "import a state tree exported with 'state snapshot' into the running node",
+	ArgsUsage: "[inputPath]",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if !cctx.Args().Present() {
+			return fmt.Errorf("must specify filename to import state from")
+		}
+
+		absPath, err := filepath.Abs(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		root, err := api.StateImportSnapshot(ctx, absPath)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Imported state root %s\n", root)
+		return nil
 	},
 }
 
@@ -285,6 +370,12 @@ var stateReplaySetCmd = &cli.Command{
 	Name:      "replay",
 	Usage:     "Replay a particular message within a tipset",
 	ArgsUsage: "[tipsetKey messageCid]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "show-trace",
+			Usage: "print the sends made by the message",
+		},
+	},
 	Action: func(cctx *cli.Context) error {
 		if cctx.Args().Len() < 1 {
 			fmt.Println("usage: [tipset] <message cid>")
@@ -355,17 +446,40 @@ var stateReplaySetCmd = &cli.Command{
 		}
 
 		fmt.Println("Replay receipt:")
+		if res.MethodName != "" {
+			fmt.Printf("Method: %s\n", res.MethodName)
+		}
 		fmt.Printf("Exit code: %d\n", res.MsgRct.ExitCode)
 		fmt.Printf("Return: %x\n", res.MsgRct.Return)
-		fmt.Printf("Gas Used: %d\n", res.MsgRct.GasUsed)
+		fmt.Printf("Gas Used: %d (compute %d, storage %d)\n", res.MsgRct.GasUsed, res.GasBreakdown.ComputeGas, res.GasBreakdown.StorageGas)
 		if res.MsgRct.ExitCode != 0 {
 			fmt.Printf("Error message: %q\n", res.Error)
 		}
 
+		if cctx.Bool("show-trace") && res.Calls != nil {
+			fmt.Printf("State root: %s -> %s\n", res.StateRootBefore, res.StateRootAfter)
+			fmt.Println("Calls:")
+			printCallTrace(res.Calls, 1)
+		}
+
 		return nil
 	},
 }
 
+func printCallTrace(ct *api.CallTrace, depth int) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Printf("%s%s -> %s method %d value %s: exit %d, gas %d\n", indent, ct.From, ct.To, ct.Method, types.FIL(ct.Value), ct.ExitCode, ct.GasCharged)
+	if ct.Error != "" {
+		fmt.Printf("%s  error: %s\n", indent, ct.Error)
+	}
+	if ct.HeadBefore != ct.HeadAfter {
+		fmt.Printf("%s  state: %s -> %s\n", indent, ct.HeadBefore, ct.HeadAfter)
+	}
+	for _, sub := range ct.Subcalls {
+		printCallTrace(sub, depth+1)
+	}
+}
+
 var statePledgeCollateralCmd = &cli.Command{
 	Name:  "pledge-collateral",
 	Usage: "Get minimum miner pledge collateral",
@@ -789,6 +903,85 @@ var stateListMessagesCmd = &cli.Command{
 	},
 }
 
+var stateGasTraceCmd = &cli.Command{
+	Name:  "gas-trace",
+	Usage: "Show where the gas used by the messages of a tipset went",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		ts, err := LoadTipSet(ctx, cctx, api)
+		if err != nil {
+			return err
+		}
+		tsk := types.EmptyTSK
+		if ts != nil {
+			tsk = ts.Key()
+		}
+
+		profiles, err := api.StateGasTrace(ctx, tsk)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range profiles {
+			fmt.Printf("%s: gas used %d\n", p.Msg, p.GasUsed)
+
+			categories := make([]string, 0, len(p.Categories))
+			for c := range p.Categories {
+				categories = append(categories, c)
+			}
+			sort.Strings(categories)
+			for _, c := range categories {
+				fmt.Printf("  %-12s %d\n", c, p.Categories[c])
+			}
+			for _, m := range p.Methods {
+				fmt.Printf("  %s (%d calls): %d\n", m.Method, m.Calls, m.Gas)
+			}
+		}
+		return nil
+	},
+}
+
+var stateUpgradeDryRunsCmd = &cli.Command{
+	Name:  "upgrade-dry-runs",
+	Usage: "Show the dry runs of the scheduled network upgrades",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		runs, err := api.StateUpgradeDryRuns(ctx)
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			fmt.Println("No upgrade was dry run yet")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Upgrade\tRun at\tTook\tResult\n")
+		for _, r := range runs {
+			res := "ok"
+			if r.Error != "" {
+				res = "failed: " + r.Error
+			}
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", r.Height, r.Epoch, r.Duration.Truncate(time.Millisecond), res)
+		}
+		return w.Flush()
+	},
+}
+
 var stateComputeStateCmd = &cli.Command{
 	Name:  "compute-state",
 	Usage: "Perform state computations",
@@ -884,6 +1077,15 @@ var stateComputeStateCmd = &cli.Command{
 				printInternalExecutions("\t", ir.ExecutionTrace.Subcalls)
 			}
 		}
+		if len(stout.Applied) > 0 {
+			fmt.Println("applied messages:")
+			for _, ir := range stout.Applied {
+				fmt.Printf("%s\t%s\t%s\t%d\t%x\t%d\t%d\t%x\n", ir.Msg.From, ir.Msg.To, ir.Msg.Value, ir.Msg.Method, ir.Msg.Params, ir.MsgRct.ExitCode, ir.MsgRct.GasUsed, ir.MsgRct.Return)
+				if cctx.Bool("show-trace") {
+					printInternalExecutions("\t", ir.ExecutionTrace.Subcalls)
+				}
+			}
+		}
 		return nil
 	},
 }
@@ -1143,7 +1345,7 @@ func codeStr(c cid.Cid) string {
 }
 
 func getMethod(code cid.Cid, method abi.MethodNum) string {
-	return stmgr.MethodsMap[code][method].Name
+	return stmgr.MethodName(code, method)
 }
 
 func toFil(f types.BigInt) types.FIL {
@@ -1300,6 +1502,34 @@ var stateSearchMsgCmd = &cli.Command{
 	},
 }
 
+var stateRebuildMsgIndexCmd = &cli.Command{
+	Name:  "rebuild-msg-index",
+	Usage: "Index the messages executed before the message index was enabled",
+	Flags: []cli.Flag{
+		&cli.Int64Flag{
+			Name:  "to",
+			Usage: "index back to this epoch, defaults to genesis",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		n, err := api.StateRebuildMsgIndex(ctx, abi.ChainEpoch(cctx.Int64("to")))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("indexed %d messages\n", n)
+		return nil
+	},
+}
+
 var stateCallCmd = &cli.Command{
 	Name:      "call",
 	Usage:     "Invoke a method on an actor locally",
@@ -1392,6 +1622,7 @@ var stateCallCmd = &cli.Command{
 		}
 
 		fmt.Printf("return: %s\n", s)
+		fmt.Printf("gas used: %d (compute %d, storage %d)\n", ret.MsgRct.GasUsed, ret.GasBreakdown.ComputeGas, ret.GasBreakdown.StorageGas)
 
 		return nil
 	},
@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/filecoin-project/specs-actors/actors/abi"
@@ -12,6 +13,7 @@ import (
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain"
+	"github.com/filecoin-project/lotus/chain/types"
 )
 
 var syncCmd = &cli.Command{
@@ -22,6 +24,8 @@ var syncCmd = &cli.Command{
 		syncWaitCmd,
 		syncMarkBadCmd,
 		syncCheckBadCmd,
+		syncPeerHealthCmd,
+		syncCheckpointCmd,
 	},
 }
 
@@ -154,7 +158,60 @@ var syncCheckBadCmd = &cli.Command{
 	},
 }
 
+var syncPeerHealthCmd = &cli.Command{
+	Name:  "peer-health",
+	Usage: "Print how well sync peers serve the chain this node follows",
+	Action: func(cctx *cli.Context) error {
+		napi, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		peers, err := napi.SyncPeerHealth(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range peers {
+			if p.Probes == 0 {
+				fmt.Printf("%s: not probed yet\n", p.ID)
+				continue
+			}
+
+			fmt.Printf("%s: %.0f%% available, %d served, %d missing, %d failed, last probe %s",
+				p.ID, p.Availability*100, p.Served, p.Missing, p.Failed, p.LastProbe.Format(time.Stamp))
+			if p.Missing > 0 {
+				fmt.Printf(", last missing at height %d", p.LastMissing)
+			}
+			fmt.Println()
+		}
+
+		return nil
+	},
+}
+
 func SyncWait(ctx context.Context, napi api.FullNode) error {
+	var etaLk sync.Mutex
+	etas := map[int]time.Duration{}
+
+	progress, err := napi.SyncProgress(ctx)
+	if err != nil {
+		log.Warnf("subscribing to sync progress, no ETA will be shown: %s", err)
+	} else {
+		go func() {
+			for evt := range progress {
+				if evt.Type != api.SyncProgressState {
+					continue
+				}
+				etaLk.Lock()
+				etas[evt.Worker] = evt.ETA
+				etaLk.Unlock()
+			}
+		}()
+	}
+
 	for {
 		state, err := napi.SyncState(ctx)
 		if err != nil {
@@ -184,7 +241,16 @@ func SyncWait(ctx context.Context, napi api.FullNode) error {
 			target = ss.Target.Cids()
 		}
 
-		fmt.Printf("\r\x1b[2KWorker %d: Target: %s\tState: %s\tHeight: %d", working, target, chain.SyncStageString(ss.Stage), ss.Height)
+		etaLk.Lock()
+		eta := etas[working]
+		etaLk.Unlock()
+
+		var etaStr string
+		if eta > 0 {
+			etaStr = fmt.Sprintf("\tETA: %s", eta.Round(time.Second))
+		}
+
+		fmt.Printf("\r\x1b[2KWorker %d: Target: %s\tState: %s\tHeight: %d%s", working, target, chain.SyncStageString(ss.Stage), ss.Height, etaStr)
 
 		if time.Now().Unix()-int64(head.MinTimestamp()) < int64(build.BlockDelaySecs) {
 			fmt.Println("\nDone!")
@@ -199,3 +265,32 @@ func SyncWait(ctx context.Context, napi api.FullNode) error {
 		}
 	}
 }
+
+var syncCheckpointCmd = &cli.Command{
+	Name:      "checkpoint",
+	Usage:     "Mark the given tipset as a checkpoint, will prevent syncing to a chain that doesn't contain it",
+	ArgsUsage: "[tipsetCid...]",
+	Action: func(cctx *cli.Context) error {
+		napi, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if !cctx.Args().Present() {
+			return fmt.Errorf("must specify the cids of the tipset to checkpoint")
+		}
+
+		var cids []cid.Cid
+		for _, s := range cctx.Args().Slice() {
+			c, err := cid.Decode(s)
+			if err != nil {
+				return fmt.Errorf("failed to decode input as a cid: %s", err)
+			}
+			cids = append(cids, c)
+		}
+
+		return napi.SyncCheckpoint(ctx, types.NewTipSetKey(cids...))
+	},
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/urfave/cli/v2"
+
+	lapi "github.com/filecoin-project/lotus/api"
 )
 
 var versionCmd = &cli.Command{
@@ -17,16 +19,31 @@ var versionCmd = &cli.Command{
 		defer closer()
 
 		ctx := ReqContext(cctx)
-		// TODO: print more useful things
 
 		v, err := api.Version(ctx)
 		if err != nil {
 			return err
 		}
 		fmt.Println("Daemon: ", v)
+		printBuildInfo(v)
 
 		fmt.Print("Local: ")
 		cli.VersionPrinter(cctx)
+		local := lapi.LocalVersion()
+		printBuildInfo(local)
+
+		if err := local.Compatible(v); err != nil {
+			fmt.Printf("Warning: the daemon is incompatible with this binary: %s\n", err)
+		}
 		return nil
 	},
 }
+
+func printBuildInfo(v lapi.Version) {
+	if v.BuildType == "" {
+		// older daemons don't report build info
+		return
+	}
+	fmt.Printf("  Commit: %s, Build: %s, Go: %s, Actors: %s, Params: %s\n",
+		v.Commit, v.BuildType, v.GoVersion, v.ActorsVersion, v.ParamsVersion)
+}
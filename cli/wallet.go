@@ -2,6 +2,7 @@ package cli
 
 import (
 	"bufio"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -10,12 +11,16 @@ import (
 	"strings"
 
 	"github.com/filecoin-project/go-address"
-	types "github.com/filecoin-project/lotus/chain/types"
-	"github.com/filecoin-project/lotus/chain/wallet"
 	"github.com/filecoin-project/specs-actors/actors/crypto"
+	"github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
 
-	"github.com/urfave/cli/v2"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	types "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/wallet"
+	"github.com/filecoin-project/lotus/lib/sigs"
 )
 
 var walletCmd = &cli.Command{
@@ -32,6 +37,7 @@ var walletCmd = &cli.Command{
 		walletSign,
 		walletVerify,
 		walletDelete,
+		walletInspect,
 	},
 }
 
@@ -372,6 +378,21 @@ var walletVerify = &cli.Command{
 			return err
 		}
 
+		// signatures are made by keys, look up the key of ID addresses
+		if addr.Protocol() == address.ID {
+			addr, err = api.StateAccountKey(ctx, addr, types.EmptyTSK)
+			if err != nil {
+				return xerrors.Errorf("looking up account key: %w", err)
+			}
+		}
+		if _, err := sigs.AddressSigType(addr); err != nil {
+			return err
+		}
+		if err := sigs.CheckSigType(&sig, addr); err != nil {
+			fmt.Println("invalid")
+			return NewCliError(err.Error())
+		}
+
 		if api.WalletVerify(ctx, addr, msg, &sig) {
 			fmt.Println("valid")
 			return nil
@@ -406,3 +427,142 @@ var walletDelete = &cli.Command{
 		return api.WalletDelete(ctx, addr)
 	},
 }
+
+var walletInspect = &cli.Command{
+	Name:      "inspect",
+	Usage:     "Show the protocol, actor, nonce, balance and pending messages of an address",
+	ArgsUsage: "<address>",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if cctx.NArg() != 1 {
+			return fmt.Errorf("must specify address to inspect")
+		}
+
+		addr, err := address.NewFromString(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		info, err := inspectAddress(ctx, api, addr)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Address:\t%s\n", addr)
+		fmt.Printf("Protocol:\t%s\n", sigs.ProtocolName(addr.Protocol()))
+		fmt.Printf("In wallet:\t%t\n", info.InWallet)
+		if info.ID == address.Undef {
+			// no actor has the address yet, e.g. a key which wasn't sent funds
+			fmt.Printf("Actor:\t\tnot on chain\n")
+			return nil
+		}
+
+		fmt.Printf("ID:\t\t%s\n", info.ID)
+		if info.Key != address.Undef {
+			fmt.Printf("Key:\t\t%s (%s)\n", info.Key, sigs.ProtocolName(info.Key.Protocol()))
+		}
+		fmt.Printf("Actor:\t\t%s (%s)\n", info.Actor, info.Code)
+		fmt.Printf("Balance:\t%s\n", types.FIL(info.Balance))
+		fmt.Printf("Nonce:\t\t%d\n", info.Nonce)
+		fmt.Printf("Pending:\t%d messages\n", info.Pending)
+		if info.Pending > 0 {
+			fmt.Printf("Next nonce:\t%d\n", info.NextNonce)
+		}
+
+		return nil
+	},
+}
+
+// addressInfo is what wallet inspect shows about an address
+type addressInfo struct {
+	InWallet bool
+
+	// ID is undefined when no actor has the address
+	ID address.Address
+	// Key is the key address of account actors looked up by ID
+	Key   address.Address
+	Actor string
+	Code  cid.Cid
+
+	Balance types.BigInt
+	Nonce   uint64
+	// Pending is the number of pending messages sent from the address,
+	// NextNonce is only set when there are any
+	Pending   int
+	NextNonce uint64
+}
+
+func inspectAddress(ctx context.Context, api api.FullNode, addr address.Address) (*addressInfo, error) {
+	var info addressInfo
+
+	has, err := api.WalletHas(ctx, addr)
+	if err != nil {
+		return nil, xerrors.Errorf("checking wallet: %w", err)
+	}
+	info.InWallet = has
+
+	idAddr, err := api.StateLookupID(ctx, addr, types.EmptyTSK)
+	if err != nil {
+		if isActorNotFound(err) {
+			return &info, nil
+		}
+		return nil, xerrors.Errorf("looking up actor ID: %w", err)
+	}
+
+	// ID addresses resolve to themselves, whether an actor has them or not
+	act, err := api.StateGetActor(ctx, idAddr, types.EmptyTSK)
+	if err != nil {
+		if isActorNotFound(err) {
+			return &info, nil
+		}
+		return nil, xerrors.Errorf("getting actor: %w", err)
+	}
+	info.ID = idAddr
+
+	name, ok := stmgr.ActorNames[act.Code]
+	if !ok {
+		name = "unknown"
+	}
+	info.Actor = name
+	info.Code = act.Code
+	info.Balance = act.Balance
+	info.Nonce = act.Nonce
+
+	if addr.Protocol() == address.ID && act.IsAccountActor() {
+		info.Key, err = api.StateAccountKey(ctx, idAddr, types.EmptyTSK)
+		if err != nil {
+			return nil, xerrors.Errorf("looking up account key: %w", err)
+		}
+	}
+
+	pending, err := api.MpoolPending(ctx, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting pending messages: %w", err)
+	}
+	for _, m := range pending {
+		if m.Message.From == addr || m.Message.From == idAddr {
+			info.Pending++
+		}
+	}
+
+	if info.Pending > 0 {
+		info.NextNonce, err = api.MpoolGetNonce(ctx, addr)
+		if err != nil {
+			return nil, xerrors.Errorf("getting next nonce: %w", err)
+		}
+	}
+
+	return &info, nil
+}
+
+// isActorNotFound checks for the error of looking up an address which has no
+// actor by its message, errors lose their type crossing the RPC boundary
+func isActorNotFound(err error) bool {
+	return strings.Contains(err.Error(), types.ErrActorNotFound.Error())
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// inspectAPI implements the methods wallet inspect calls
+type inspectAPI struct {
+	api.FullNode
+
+	wallet  map[address.Address]bool
+	ids     map[address.Address]address.Address
+	actors  map[address.Address]*types.Actor
+	keys    map[address.Address]address.Address
+	pending []*types.SignedMessage
+
+	// lookupErr fails address lookups, like an unreachable node
+	lookupErr error
+}
+
+func (a *inspectAPI) WalletHas(_ context.Context, addr address.Address) (bool, error) {
+	return a.wallet[addr], nil
+}
+
+func (a *inspectAPI) StateLookupID(_ context.Context, addr address.Address, _ types.TipSetKey) (address.Address, error) {
+	if a.lookupErr != nil {
+		return address.Undef, a.lookupErr
+	}
+	if addr.Protocol() == address.ID {
+		return addr, nil
+	}
+	id, ok := a.ids[addr]
+	if !ok {
+		return address.Undef, xerrors.Errorf("resolution lookup failed (%s): %w", addr, types.ErrActorNotFound)
+	}
+	return id, nil
+}
+
+func (a *inspectAPI) StateGetActor(_ context.Context, addr address.Address, _ types.TipSetKey) (*types.Actor, error) {
+	act, ok := a.actors[addr]
+	if !ok {
+		return nil, types.ErrActorNotFound
+	}
+	return act, nil
+}
+
+func (a *inspectAPI) StateAccountKey(_ context.Context, addr address.Address, _ types.TipSetKey) (address.Address, error) {
+	return a.keys[addr], nil
+}
+
+func (a *inspectAPI) MpoolPending(context.Context, types.TipSetKey) ([]*types.SignedMessage, error) {
+	return a.pending, nil
+}
+
+func (a *inspectAPI) MpoolGetNonce(_ context.Context, addr address.Address) (uint64, error) {
+	id, err := a.StateLookupID(context.TODO(), addr, types.EmptyTSK)
+	if err != nil {
+		return 0, err
+	}
+	next := a.actors[id].Nonce
+	for _, m := range a.pending {
+		from := m.Message.From
+		if (from == addr || from == id) && m.Message.Nonce >= next {
+			next = m.Message.Nonce + 1
+		}
+	}
+	return next, nil
+}
+
+func TestInspectAddress(t *testing.T) {
+	ctx := context.TODO()
+
+	key, err := address.NewSecp256k1Address([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown, err := address.NewSecp256k1Address([]byte("unknown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := address.NewIDAddress(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msig, err := address.NewIDAddress(101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unusedID, err := address.NewIDAddress(102)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fapi := &inspectAPI{
+		wallet: map[address.Address]bool{key: true, unknown: true},
+		ids:    map[address.Address]address.Address{key: id},
+		actors: map[address.Address]*types.Actor{
+			id:   {Code: builtin.AccountActorCodeID, Balance: types.NewInt(1000), Nonce: 3},
+			msig: {Code: builtin.MultisigActorCodeID, Balance: types.NewInt(5)},
+		},
+		keys: map[address.Address]address.Address{id: key},
+		pending: []*types.SignedMessage{
+			{Message: types.Message{From: key, Nonce: 3}},
+			{Message: types.Message{From: id, Nonce: 4}},
+			{Message: types.Message{From: msig}},
+		},
+	}
+
+	// keys which weren't sent funds have no actor
+	info, err := inspectAddress(ctx, fapi, unknown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.InWallet || info.ID != address.Undef {
+		t.Fatalf("expected a wallet address without actor, got %+v", info)
+	}
+	info, err = inspectAddress(ctx, fapi, unusedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != address.Undef {
+		t.Fatalf("expected an ID address without actor, got %+v", info)
+	}
+
+	// the pending messages sent from the key and its ID address are counted
+	info, err = inspectAddress(ctx, fapi, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != id || info.Actor != "account" || info.Nonce != 3 || !info.Balance.Equals(types.NewInt(1000)) {
+		t.Fatalf("unexpected account actor info: %+v", info)
+	}
+	if info.Key != address.Undef {
+		t.Fatalf("expected the key of key addresses not to be looked up, got %s", info.Key)
+	}
+	if info.Pending != 2 || info.NextNonce != 5 {
+		t.Fatalf("expected 2 pending messages and nonce 5 next, got %d, %d", info.Pending, info.NextNonce)
+	}
+
+	// account actors looked up by ID show their key
+	info, err = inspectAddress(ctx, fapi, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.InWallet || info.Key != key || info.Pending != 2 {
+		t.Fatalf("unexpected info of the ID address: %+v", info)
+	}
+
+	info, err = inspectAddress(ctx, fapi, msig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Actor != "multisig" || info.Key != address.Undef || info.Pending != 1 {
+		t.Fatalf("unexpected multisig actor info: %+v", info)
+	}
+
+	// other lookup failures aren't reported as addresses without actor
+	fapi.lookupErr = xerrors.New("connection refused")
+	if _, err := inspectAddress(ctx, fapi, key); err == nil {
+		t.Fatal("expected the lookup failure to be returned")
+	}
+}
@@ -80,7 +80,7 @@ func sendSmallFundsTxs(ctx context.Context, api api.FullNode, from address.Addre
 				GasPrice: types.NewInt(0),
 			}
 
-			smsg, err := api.MpoolPushMessage(ctx, msg)
+			smsg, err := api.MpoolPushMessage(ctx, msg, nil)
 			if err != nil {
 				return err
 			}
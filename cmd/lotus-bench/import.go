@@ -85,7 +85,7 @@ var importBenchCmd = &cli.Command{
 		}
 		bs = cbs
 		ds := datastore.NewMapDatastore()
-		cs := store.NewChainStore(bs, ds, vm.Syscalls(ffiwrapper.ProofVerifier))
+		cs := store.NewChainStore(bs, ds, vm.DefaultSyscalls(ffiwrapper.ProofVerifier))
 		stm := stmgr.NewStateManager(cs)
 
 		prof, err := os.Create("import-bench.prof")
@@ -272,7 +272,7 @@ func (h *handler) send(w http.ResponseWriter, r *http.Request) {
 
 		GasPrice: types.NewInt(0),
 		GasLimit: 10000,
-	})
+	}, nil)
 	if err != nil {
 		w.WriteHeader(400)
 		_, _ = w.Write([]byte(err.Error()))
@@ -346,7 +346,7 @@ func (h *handler) mkminer(w http.ResponseWriter, r *http.Request) {
 
 		GasPrice: types.NewInt(0),
 		GasLimit: 10000,
-	})
+	}, nil)
 	if err != nil {
 		w.WriteHeader(400)
 		w.Write([]byte("pushfunds: " + err.Error()))
@@ -385,7 +385,7 @@ func (h *handler) mkminer(w http.ResponseWriter, r *http.Request) {
 		GasPrice: types.NewInt(0),
 	}
 
-	signed, err := h.api.MpoolPushMessage(r.Context(), createStorageMinerMsg)
+	signed, err := h.api.MpoolPushMessage(r.Context(), createStorageMinerMsg, nil)
 	if err != nil {
 		w.WriteHeader(400)
 		w.Write([]byte(err.Error()))
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -15,6 +16,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/mitchellh/go-homedir"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
 
@@ -28,6 +30,7 @@ import (
 	"github.com/filecoin-project/lotus/build"
 	lcli "github.com/filecoin-project/lotus/cli"
 	"github.com/filecoin-project/lotus/lib/lotuslog"
+	"github.com/filecoin-project/lotus/lib/rpctls"
 	"github.com/filecoin-project/lotus/node/repo"
 	sectorstorage "github.com/filecoin-project/sector-storage"
 	"github.com/filecoin-project/sector-storage/sealtasks"
@@ -107,6 +110,10 @@ var runCmd = &cli.Command{
 			Usage: "enable commit (32G sectors: all cores or GPUs, 128GiB Memory + 64GiB swap)",
 			Value: true,
 		},
+		&cli.BoolFlag{
+			Name:  "tls",
+			Usage: "serve and connect to the miner over mutual TLS, with the certificate issued by 'lotus-storage-miner tls issue' in the worker repo",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		if !cctx.Bool("enable-gpu-proving") {
@@ -119,6 +126,27 @@ var runCmd = &cli.Command{
 			return xerrors.Errorf("--address flag is required")
 		}
 
+		var tlsCfg *tls.Config
+		scheme := "http"
+		if cctx.Bool("tls") {
+			p, err := homedir.Expand(cctx.String(FlagStorageRepo))
+			if err != nil {
+				return err
+			}
+			tlsDir := filepath.Join(p, rpctls.DirName)
+
+			tlsCfg, err = rpctls.ServerConfig(tlsDir)
+			if err != nil {
+				return xerrors.Errorf("loading TLS certificate: %w", err)
+			}
+			clientCfg, err := rpctls.ClientConfig(tlsDir)
+			if err != nil {
+				return err
+			}
+			rpctls.InstallClient(clientCfg)
+			scheme = rpctls.TransferScheme
+		}
+
 		// Connect to storage-miner
 		var nodeApi api.StorageMiner
 		var closer func()
@@ -145,9 +173,19 @@ var runCmd = &cli.Command{
 		if v.APIVersion != build.APIVersion {
 			return xerrors.Errorf("lotus-storage-miner API version doesn't match: local: ", api.Version{APIVersion: build.APIVersion})
 		}
+		if err := v.Compatible(api.LocalVersion()); err != nil {
+			return xerrors.Errorf("worker build is incompatible with the miner: %w", err)
+		}
 		log.Infof("Remote version %s", v)
 
-		watchMinerConn(ctx, cctx, nodeApi)
+		np, err := nodeApi.NetworkParams(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting network params: %w", err)
+		}
+		if err := build.ApplyNetworkParams(np); err != nil {
+			return xerrors.Errorf("applying the network params of the miner: %w", err)
+		}
+		build.FreezeNetworkParams()
 
 		// Check params
 
@@ -253,7 +291,7 @@ var runCmd = &cli.Command{
 
 		log.Info("Opening local storage; connecting to master")
 
-		localStore, err := stores.NewLocal(ctx, lr, nodeApi, []string{"http://" + cctx.String("address") + "/remote"})
+		localStore, err := stores.NewLocal(ctx, lr, nodeApi, []string{scheme + "://" + cctx.String("address") + "/remote"})
 		if err != nil {
 			return err
 		}
@@ -271,6 +309,16 @@ var runCmd = &cli.Command{
 
 		remote := stores.NewRemote(localStore, nodeApi, sminfo.AuthHeader())
 
+		mds, err := lr.Datastore("/metadata")
+		if err != nil {
+			return err
+		}
+
+		session, err := loadSession(mds)
+		if err != nil {
+			return err
+		}
+
 		// Create / expose the worker
 
 		workerApi := &worker{
@@ -278,8 +326,15 @@ var runCmd = &cli.Command{
 				SealProof: spt,
 				TaskTypes: taskTypes,
 			}, remote, localStore, nodeApi),
+
+			session:     session,
+			checkpoints: newCheckpoints(mds),
 		}
 
+		log.Infof("Worker session %s", session)
+
+		watchMinerConn(ctx, cctx, nodeApi, workerApi.checkpoints)
+
 		mux := mux.NewRouter()
 
 		log.Info("Setting up control endpoint at " + cctx.String("address"))
@@ -297,7 +352,8 @@ var runCmd = &cli.Command{
 		}
 
 		srv := &http.Server{
-			Handler: ah,
+			Handler:   ah,
+			TLSConfig: tlsCfg,
 			BaseContext: func(listener net.Listener) context.Context {
 				return ctx
 			},
@@ -319,19 +375,27 @@ var runCmd = &cli.Command{
 
 		log.Info("Waiting for tasks")
 
+		wsScheme := "ws"
+		if tlsCfg != nil {
+			wsScheme = "wss"
+		}
+
 		go func() {
-			if err := nodeApi.WorkerConnect(ctx, "ws://"+cctx.String("address")+"/rpc/v0"); err != nil {
+			if err := nodeApi.WorkerConnect(ctx, wsScheme+"://"+cctx.String("address")+"/rpc/v0"); err != nil {
 				log.Errorf("Registering worker failed: %+v", err)
 				cancel()
 				return
 			}
 		}()
 
+		if tlsCfg != nil {
+			return srv.ServeTLS(nl, "", "")
+		}
 		return srv.Serve(nl)
 	},
 }
 
-func watchMinerConn(ctx context.Context, cctx *cli.Context, nodeApi api.StorageMiner) {
+func watchMinerConn(ctx context.Context, cctx *cli.Context, nodeApi api.StorageMiner, cps *checkpoints) {
 	go func() {
 		closing, err := nodeApi.Closing(ctx)
 		if err != nil {
@@ -347,7 +411,13 @@ func watchMinerConn(ctx context.Context, cctx *cli.Context, nodeApi api.StorageM
 			return // graceful shutdown
 		}
 
-		log.Warnf("Connection with miner node lost, restarting")
+		log.Warnf("Connection with miner node lost, waiting for running tasks to complete before restarting")
+
+		// completed tasks are checkpointed, the miner picks up their results
+		// when it retries them after we reconnect
+		cps.wait(ctx)
+
+		log.Warnf("Restarting")
 
 		exe, err := os.Executable()
 		if err != nil {
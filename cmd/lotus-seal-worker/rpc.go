@@ -3,18 +3,82 @@ package main
 import (
 	"context"
 
+	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/filecoin-project/specs-storage/storage"
+	"github.com/google/uuid"
 
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/sector-storage"
 )
 
 type worker struct {
 	*sectorstorage.LocalWorker
+
+	session     uuid.UUID
+	checkpoints *checkpoints
 }
 
 func (w *worker) Version(context.Context) (build.Version, error) {
 	return build.APIVersion, nil
 }
 
+func (w *worker) VersionInfo(context.Context) (api.Version, error) {
+	return api.LocalVersion(), nil
+}
+
+func (w *worker) Session(context.Context) (uuid.UUID, error) {
+	return w.session, nil
+}
+
+func (w *worker) SealPreCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (out storage.PreCommit1Out, err error) {
+	err = w.checkpoints.do(sector, "precommit1", []interface{}{ticket, pieces}, &out, func() (interface{}, error) {
+		return w.LocalWorker.SealPreCommit1(ctx, sector, ticket, pieces)
+	})
+	return out, err
+}
+
+func (w *worker) SealPreCommit2(ctx context.Context, sector abi.SectorID, pc1o storage.PreCommit1Out) (out storage.SectorCids, err error) {
+	err = w.checkpoints.do(sector, "precommit2", pc1o, &out, func() (interface{}, error) {
+		return w.LocalWorker.SealPreCommit2(ctx, sector, pc1o)
+	})
+	return out, err
+}
+
+func (w *worker) SealCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, seed abi.InteractiveSealRandomness, pieces []abi.PieceInfo, cids storage.SectorCids) (out storage.Commit1Out, err error) {
+	err = w.checkpoints.do(sector, "commit1", []interface{}{ticket, seed, pieces, cids}, &out, func() (interface{}, error) {
+		return w.LocalWorker.SealCommit1(ctx, sector, ticket, seed, pieces, cids)
+	})
+	return out, err
+}
+
+func (w *worker) SealCommit2(ctx context.Context, sector abi.SectorID, c1o storage.Commit1Out) (out storage.Proof, err error) {
+	err = w.checkpoints.do(sector, "commit2", c1o, &out, func() (interface{}, error) {
+		return w.LocalWorker.SealCommit2(ctx, sector, c1o)
+	})
+	return out, err
+}
+
+func (w *worker) FinalizeSector(ctx context.Context, sector abi.SectorID, keepUnsealed []storage.Range) error {
+	if err := w.LocalWorker.FinalizeSector(ctx, sector, keepUnsealed); err != nil {
+		return err
+	}
+
+	if err := w.checkpoints.clear(sector); err != nil {
+		log.Warnw("clearing task checkpoints", "sector", sector, "error", err)
+	}
+	return nil
+}
+
+func (w *worker) Remove(ctx context.Context, sector abi.SectorID) error {
+	if err := w.LocalWorker.Remove(ctx, sector); err != nil {
+		return err
+	}
+
+	if err := w.checkpoints.clear(sector); err != nil {
+		log.Warnw("clearing task checkpoints", "sector", sector, "error", err)
+	}
+	return nil
+}
+
 var _ storage.Sealer = &worker{}
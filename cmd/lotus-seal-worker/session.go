@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+var sessionKey = datastore.NewKey("/session")
+
+// loadSession returns the session ID of this worker, creating one on first
+// start. The ID is kept across restarts, which lets the miner recognise a
+// worker reconnecting after it lost the connection.
+func loadSession(ds datastore.Batching) (uuid.UUID, error) {
+	b, err := ds.Get(sessionKey)
+	switch {
+	case err == datastore.ErrNotFound:
+		s := uuid.New()
+		if err := ds.Put(sessionKey, s[:]); err != nil {
+			return uuid.UUID{}, xerrors.Errorf("storing session: %w", err)
+		}
+		return s, nil
+	case err != nil:
+		return uuid.UUID{}, xerrors.Errorf("getting session: %w", err)
+	}
+
+	return uuid.FromBytes(b)
+}
+
+// checkpoints stores the results of completed sealing tasks. When the
+// connection to the miner is lost, the miner fails the calls it had in flight
+// and retries them with the same inputs once the worker reconnected. Tasks
+// which completed in the meantime are then answered from the checkpoint
+// instead of being computed again.
+//
+// Checkpoints are only taken at phase boundaries, the proofs library can't
+// resume a partially computed phase.
+type checkpoints struct {
+	ds datastore.Batching
+
+	// running tracks tasks in flight, so that the worker can wait for them
+	// to complete before restarting
+	running sync.WaitGroup
+}
+
+type checkpoint struct {
+	Inputs [sha256.Size]byte
+	Output json.RawMessage
+}
+
+func newCheckpoints(ds datastore.Batching) *checkpoints {
+	return &checkpoints{
+		ds: namespace.Wrap(ds, datastore.NewKey("/tasks")),
+	}
+}
+
+// do runs the task, unless a checkpoint for the task with the same inputs
+// exists, and decodes the result into out.
+func (c *checkpoints) do(sector abi.SectorID, task string, inputs interface{}, out interface{}, run func() (interface{}, error)) error {
+	c.running.Add(1)
+	defer c.running.Done()
+
+	ib, err := json.Marshal(inputs)
+	if err != nil {
+		return xerrors.Errorf("marshaling task inputs: %w", err)
+	}
+	ih := sha256.Sum256(ib)
+
+	key := checkpointKey(sector).ChildString(task)
+
+	b, err := c.ds.Get(key)
+	switch {
+	case err == nil:
+		var cp checkpoint
+		if err := json.Unmarshal(b, &cp); err != nil {
+			return xerrors.Errorf("unmarshaling checkpoint: %w", err)
+		}
+		if cp.Inputs == ih {
+			log.Infow("task already completed, returning checkpoint", "sector", sector, "task", task)
+			return json.Unmarshal(cp.Output, out)
+		}
+	case err != datastore.ErrNotFound:
+		return xerrors.Errorf("getting checkpoint: %w", err)
+	}
+
+	res, err := run()
+	if err != nil {
+		return err
+	}
+
+	ob, err := json.Marshal(res)
+	if err != nil {
+		return xerrors.Errorf("marshaling task output: %w", err)
+	}
+
+	b, err = json.Marshal(&checkpoint{Inputs: ih, Output: ob})
+	if err != nil {
+		return xerrors.Errorf("marshaling checkpoint: %w", err)
+	}
+	if err := c.ds.Put(key, b); err != nil {
+		log.Warnw("storing task checkpoint", "sector", sector, "task", task, "error", err)
+	}
+
+	return json.Unmarshal(ob, out)
+}
+
+// clear removes the checkpoints of a sector, once it's finalized or removed.
+func (c *checkpoints) clear(sector abi.SectorID) error {
+	res, err := c.ds.Query(query.Query{Prefix: checkpointKey(sector).String() + "/", KeysOnly: true})
+	if err != nil {
+		return xerrors.Errorf("querying checkpoints: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return xerrors.Errorf("iterating checkpoints: %w", r.Error)
+		}
+		if err := c.ds.Delete(datastore.NewKey(r.Key)); err != nil {
+			return xerrors.Errorf("deleting checkpoint %s: %w", r.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// wait waits for running tasks to complete, or the context to be cancelled.
+func (c *checkpoints) wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		c.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func checkpointKey(sector abi.SectorID) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("/%d/%d", sector.Miner, sector.Number))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ipfs/go-datastore"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+func TestLoadSession(t *testing.T) {
+	ds := datastore.NewMapDatastore()
+
+	s, err := loadSession(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s == uuid.Nil {
+		t.Fatal("expected a session to be created")
+	}
+
+	// a restarted worker keeps its session
+	again, err := loadSession(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != s {
+		t.Fatalf("expected session %s after a restart, got %s", s, again)
+	}
+}
+
+func TestCheckpoints(t *testing.T) {
+	cp := newCheckpoints(datastore.NewMapDatastore())
+	sector := abi.SectorID{Miner: 1000, Number: 1}
+
+	runs := 0
+	do := func(inputs string) (string, error) {
+		var out string
+		err := cp.do(sector, "precommit1", inputs, &out, func() (interface{}, error) {
+			runs++
+			if inputs == "failing" {
+				return nil, xerrors.New("task failed")
+			}
+			return "out-" + inputs, nil
+		})
+		return out, err
+	}
+
+	expect := func(inputs string, out string, expectedRuns int) {
+		t.Helper()
+		o, err := do(inputs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o != out || runs != expectedRuns {
+			t.Fatalf("inputs %s: expected output %s after %d runs, got %s after %d", inputs, out, expectedRuns, o, runs)
+		}
+	}
+
+	expect("a", "out-a", 1)
+	// the miner retries the call after a reconnect
+	expect("a", "out-a", 1)
+	// other inputs run the task again
+	expect("b", "out-b", 2)
+	expect("b", "out-b", 2)
+
+	// failures aren't checkpointed
+	if _, err := do("failing"); err == nil {
+		t.Fatal("expected the task to fail")
+	}
+	expect("b", "out-b", 3)
+
+	// clearing the sector runs its tasks again
+	if err := cp.clear(sector); err != nil {
+		t.Fatal(err)
+	}
+	expect("b", "out-b", 4)
+}
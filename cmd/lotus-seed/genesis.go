@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"io/ioutil"
 
+	"github.com/docker/go-units"
 	"github.com/google/uuid"
 	"github.com/mitchellh/go-homedir"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/filecoin-project/specs-actors/actors/abi/big"
 
 	"github.com/filecoin-project/lotus/build"
@@ -33,6 +35,14 @@ var genesisNewCmd = &cli.Command{
 		&cli.StringFlag{
 			Name: "network-name",
 		},
+		&cli.Uint64Flag{
+			Name:  "block-delay",
+			Usage: "override the block delay of the build, in seconds",
+		},
+		&cli.StringSliceFlag{
+			Name:  "sector-size",
+			Usage: "override the sector sizes supported by the build, e.g. 2KiB",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		if !cctx.Args().Present() {
@@ -48,6 +58,20 @@ var genesisNewCmd = &cli.Command{
 			out.NetworkName = "localnet-" + uuid.New().String()
 		}
 
+		if cctx.IsSet("block-delay") || cctx.IsSet("sector-size") {
+			np := &build.NetworkParams{
+				BlockDelaySecs: cctx.Uint64("block-delay"),
+			}
+			for _, s := range cctx.StringSlice("sector-size") {
+				ss, err := units.RAMInBytes(s)
+				if err != nil {
+					return xerrors.Errorf("parsing sector size: %w", err)
+				}
+				np.SectorSizes = append(np.SectorSizes, abi.SectorSize(ss))
+			}
+			out.NetworkParams = np
+		}
+
 		genb, err := json.MarshalIndent(&out, "", "  ")
 		if err != nil {
 			return err
@@ -81,7 +81,7 @@ var verifRegAddVerifierCmd = &cli.Command{
 			Params:   params,
 		}
 
-		smsg, err := api.MpoolPushMessage(ctx, msg)
+		smsg, err := api.MpoolPushMessage(ctx, msg, nil)
 		if err != nil {
 			return err
 		}
@@ -157,7 +157,7 @@ var verifRegVerifyClientCmd = &cli.Command{
 			Params:   params,
 		}
 
-		smsg, err := api.MpoolPushMessage(ctx, msg)
+		smsg, err := api.MpoolPushMessage(ctx, msg, nil)
 		if err != nil {
 			return err
 		}
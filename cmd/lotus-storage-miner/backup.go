@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var backupCmd = &cli.Command{
+	Name:      "backup",
+	Usage:     "Create a backup of the miner metadata",
+	ArgsUsage: "[backup file path]",
+	Description: `The backup contains the sector and deal states of the miner, and is written
+   by the miner process, so the path is on the machine running the miner.
+
+   A miner can be restored from the backup with 'lotus-storage-miner init restore'.
+   Private keys aren't included, the worker and owner keys are stored in the
+   full node wallet.
+`,
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return xerrors.Errorf("expected 1 argument")
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		fpath, err := homedir.Expand(cctx.Args().First())
+		if err != nil {
+			return xerrors.Errorf("expanding file path: %w", err)
+		}
+		fpath, err = filepath.Abs(fpath)
+		if err != nil {
+			return xerrors.Errorf("getting absolute path: %w", err)
+		}
+
+		if err := nodeApi.MinerBackup(ctx, fpath); err != nil {
+			return err
+		}
+
+		fmt.Println("Success")
+		return nil
+	},
+}
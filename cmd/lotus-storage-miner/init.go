@@ -51,6 +51,9 @@ import (
 var initCmd = &cli.Command{
 	Name:  "init",
 	Usage: "Initialize a lotus storage miner repo",
+	Subcommands: []*cli.Command{
+		initRestoreCmd,
+	},
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:  "actor",
@@ -176,6 +179,10 @@ var initCmd = &cli.Command{
 			return xerrors.Errorf("Remote API version didn't match (local %s, remote %s)", build.APIVersion, v.APIVersion)
 		}
 
+		if err := applyNetworkParams(ctx, api); err != nil {
+			return err
+		}
+
 		log.Info("Initializing repo")
 
 		if err := r.Init(repo.StorageMiner); err != nil {
@@ -560,7 +567,7 @@ func configureStorageMiner(ctx context.Context, api lapi.FullNode, addr address.
 		GasLimit: 99999999,
 	}
 
-	smsg, err := api.MpoolPushMessage(ctx, msg)
+	smsg, err := api.MpoolPushMessage(ctx, msg, nil)
 	if err != nil {
 		return err
 	}
@@ -640,7 +647,7 @@ func createStorageMiner(ctx context.Context, api lapi.FullNode, peerid peer.ID,
 		GasPrice: gasPrice,
 	}
 
-	signed, err := api.MpoolPushMessage(ctx, createStorageMinerMsg)
+	signed, err := api.MpoolPushMessage(ctx, createStorageMinerMsg, nil)
 	if err != nil {
 		return address.Undef, err
 	}
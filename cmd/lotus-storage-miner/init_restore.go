@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	paramfetch "github.com/filecoin-project/go-paramfetch"
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	lapi "github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/lib/backupds"
+	"github.com/filecoin-project/lotus/node/modules"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/filecoin-project/lotus/node/repo"
+	"github.com/filecoin-project/lotus/storage/sectorblocks"
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+var initRestoreCmd = &cli.Command{
+	Name:      "restore",
+	Usage:     "Initialize a lotus storage miner repo for an existing miner actor",
+	ArgsUsage: "[backupFile]",
+	Description: `Reconstruct the local metadata of an existing miner, e.g. when moving it to
+   new hardware after a disk failure.
+
+   The metadata is loaded from the backup file, if one is given. Sectors
+   proven on chain which are missing from the backup are then recreated in the
+   Proving state, and the sector number counter is moved past the highest
+   sector on chain. Proving deadlines are read from the chain at runtime, so
+   they don't need to be restored.
+
+   Sealed sectors have to be attached with 'storage attach' after the restore.
+   Sectors which were sealing when the backup was taken can only resume if
+   their sealing files are attached too.
+`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "actor",
+			Usage: "address of the miner actor to restore, required when no backup is given",
+		},
+		&cli.BoolFlag{
+			Name:  "nosync",
+			Usage: "don't check full-node sync status",
+		},
+		&cli.BoolFlag{
+			Name:  "no-local-storage",
+			Usage: "don't use storageminer repo for sector storage",
+		},
+		&cli.StringFlag{
+			Name:  "gas-price",
+			Usage: "set gas price for initialization messages in AttoFIL",
+			Value: "0",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		log.Info("Restoring lotus storage miner")
+
+		gasPrice, err := types.BigFromString(cctx.String("gas-price"))
+		if err != nil {
+			return xerrors.Errorf("failed to parse gas-price flag: %s", err)
+		}
+
+		ctx := lcli.ReqContext(cctx)
+
+		api, closer, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		if !cctx.Bool("nosync") {
+			if err := lcli.SyncWait(ctx, api); err != nil {
+				return xerrors.Errorf("sync wait: %w", err)
+			}
+		}
+
+		v, err := api.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if !v.APIVersion.EqMajorMinor(build.APIVersion) {
+			return xerrors.Errorf("Remote API version didn't match (local %s, remote %s)", build.APIVersion, v.APIVersion)
+		}
+
+		repoPath := cctx.String(FlagStorageRepo)
+		r, err := repo.NewFS(repoPath)
+		if err != nil {
+			return err
+		}
+
+		ok, err := r.Exists()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return xerrors.Errorf("repo at '%s' is already initialized", cctx.String(FlagStorageRepo))
+		}
+
+		if err := r.Init(repo.StorageMiner); err != nil {
+			return err
+		}
+
+		if err := restoreStorageMiner(ctx, cctx, api, r, gasPrice); err != nil {
+			log.Errorf("Failed to restore lotus-storage-miner: %+v", err)
+			path, err := homedir.Expand(repoPath)
+			if err != nil {
+				return err
+			}
+			log.Infof("Cleaning up %s after attempt...", path)
+			if err := os.RemoveAll(path); err != nil {
+				log.Errorf("Failed to clean up failed storage repo: %s", err)
+			}
+			return xerrors.Errorf("Storage-miner restore failed")
+		}
+
+		log.Info("Storage miner successfully restored, attach the sealed sectors with 'lotus-storage-miner storage attach' after starting it with 'lotus-storage-miner run'")
+
+		return nil
+	},
+}
+
+func restoreStorageMiner(ctx context.Context, cctx *cli.Context, api lapi.FullNode, r repo.Repo, gasPrice types.BigInt) error {
+	lr, err := r.Lock(repo.StorageMiner)
+	if err != nil {
+		return err
+	}
+	defer lr.Close() //nolint:errcheck
+
+	mds, err := lr.Datastore("/metadata")
+	if err != nil {
+		return err
+	}
+
+	if bf := cctx.Args().First(); bf != "" {
+		bf, err := homedir.Expand(bf)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Importing metadata backup %s", bf)
+
+		if err := importBackup(bf, mds); err != nil {
+			return xerrors.Errorf("importing backup: %w", err)
+		}
+	}
+
+	maddr, err := restoreMinerAddress(cctx, mds)
+	if err != nil {
+		return err
+	}
+
+	mi, err := api.StateMinerInfo(ctx, maddr, types.EmptyTSK)
+	if err != nil {
+		return xerrors.Errorf("getting miner info: %w", err)
+	}
+
+	log.Info("Checking proof parameters")
+
+	if err := paramfetch.GetParams(ctx, build.ParametersJSON(), uint64(mi.SectorSize)); err != nil {
+		return xerrors.Errorf("fetching proof parameters: %w", err)
+	}
+
+	if !cctx.Bool("no-local-storage") {
+		b, err := json.MarshalIndent(&stores.LocalStorageMeta{
+			ID:       stores.ID(uuid.New().String()),
+			Weight:   10,
+			CanSeal:  true,
+			CanStore: true,
+		}, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("marshaling storage config: %w", err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(lr.Path(), "sectorstore.json"), b, 0644); err != nil {
+			return xerrors.Errorf("persisting storage metadata (%s): %w", filepath.Join(lr.Path(), "sectorstore.json"), err)
+		}
+
+		if err := lr.SetStorage(func(sc *stores.StorageConfig) {
+			sc.StoragePaths = append(sc.StoragePaths, stores.LocalPath{Path: lr.Path()})
+		}); err != nil {
+			return xerrors.Errorf("set storage config: %w", err)
+		}
+	}
+
+	log.Info("Restoring sectors from chain")
+
+	fromChain, err := restoreSectors(ctx, api, maddr, mds)
+	if err != nil {
+		return xerrors.Errorf("restoring sectors: %w", err)
+	}
+
+	log.Info("Restoring deal links")
+
+	if err := restoreDealRefs(mds, fromChain); err != nil {
+		return xerrors.Errorf("restoring deal links: %w", err)
+	}
+
+	// the new node gets a new libp2p identity, the peer ID on chain has to
+	// point to it
+	p2pSk, err := makeHostKey(lr)
+	if err != nil {
+		return xerrors.Errorf("make host key: %w", err)
+	}
+
+	peerid, err := peer.IDFromPrivateKey(p2pSk)
+	if err != nil {
+		return xerrors.Errorf("peer ID from private key: %w", err)
+	}
+
+	if err := configureStorageMiner(ctx, api, maddr, peerid, gasPrice); err != nil {
+		return xerrors.Errorf("failed to configure storage miner: %w", err)
+	}
+
+	return nil
+}
+
+func importBackup(path string, mds dtypes.MetadataDS) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+
+	batch, err := mds.Batch()
+	if err != nil {
+		return err
+	}
+
+	if err := backupds.ReadBackup(f, func(key datastore.Key, value []byte) error {
+		return batch.Put(key, value)
+	}); err != nil {
+		return err
+	}
+
+	return batch.Commit()
+}
+
+func restoreMinerAddress(cctx *cli.Context, mds dtypes.MetadataDS) (address.Address, error) {
+	var maddr address.Address
+	if act := cctx.String("actor"); act != "" {
+		a, err := address.NewFromString(act)
+		if err != nil {
+			return address.Undef, xerrors.Errorf("failed parsing actor flag value (%q): %w", act, err)
+		}
+		maddr = a
+	}
+
+	b, err := mds.Get(datastore.NewKey("miner-address"))
+	switch {
+	case err == datastore.ErrNotFound:
+		if maddr == address.Undef {
+			return address.Undef, xerrors.Errorf("backup doesn't contain the miner address, pass it with --actor")
+		}
+	case err != nil:
+		return address.Undef, err
+	default:
+		ba, err := address.NewFromBytes(b)
+		if err != nil {
+			return address.Undef, xerrors.Errorf("parsing miner address from backup: %w", err)
+		}
+		if maddr != address.Undef && maddr != ba {
+			return address.Undef, xerrors.Errorf("backup is for miner %s, not %s", ba, maddr)
+		}
+		maddr = ba
+	}
+
+	log.Infof("Restoring miner %s", maddr)
+
+	return maddr, mds.Put(datastore.NewKey("miner-address"), maddr.Bytes())
+}
+
+// restoreSectors recreates the sectors proven on chain which are missing from
+// the local metadata, and moves the sector number counter past them. It
+// returns the recreated sectors.
+func restoreSectors(ctx context.Context, api lapi.FullNode, maddr address.Address, mds dtypes.MetadataDS) (map[abi.SectorNumber]struct{}, error) {
+	sectors, err := api.StateMinerSectors(ctx, maddr, nil, true, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting miner sectors: %w", err)
+	}
+
+	maxSectorID := abi.SectorNumber(0)
+	restored := map[abi.SectorNumber]struct{}{}
+	for _, sector := range sectors {
+		if sector.ID > maxSectorID {
+			maxSectorID = sector.ID
+		}
+
+		sectorKey := datastore.NewKey(sealing.SectorStorePrefix).ChildString(fmt.Sprint(sector.ID))
+		has, err := mds.Has(sectorKey)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			continue
+		}
+
+		commR := sector.Info.Info.SealedCID
+		info := &sealing.SectorInfo{
+			State:        sealing.Proving,
+			SectorNumber: sector.ID,
+			CommR:        &commR,
+		}
+
+		// the order of pieces within the sector, and the filler pieces
+		// between them, aren't on chain, so only the deals are restored
+		for _, dealID := range sector.Info.Info.DealIDs {
+			deal, err := api.StateMarketStorageDeal(ctx, dealID, types.EmptyTSK)
+			if err != nil {
+				return nil, xerrors.Errorf("getting deal %d of sector %d: %w", dealID, sector.ID, err)
+			}
+
+			info.Pieces = append(info.Pieces, sealing.Piece{
+				Piece: abi.PieceInfo{
+					Size:     deal.Proposal.PieceSize,
+					PieceCID: deal.Proposal.PieceCID,
+				},
+				DealInfo: &sealing.DealInfo{
+					DealID: dealID,
+					DealSchedule: sealing.DealSchedule{
+						StartEpoch: deal.Proposal.StartEpoch,
+						EndEpoch:   deal.Proposal.EndEpoch,
+					},
+				},
+			})
+		}
+		if len(info.Pieces) > 0 {
+			log.Warnf("sector %d wasn't in the backup, its %d deals won't be available for retrieval", sector.ID, len(info.Pieces))
+		}
+
+		b, err := cborutil.Dump(info)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := mds.Put(sectorKey, b); err != nil {
+			return nil, err
+		}
+		restored[sector.ID] = struct{}{}
+	}
+
+	log.Infof("Restored %d of %d on-chain sectors", len(restored), len(sectors))
+
+	counterKey := datastore.NewKey(modules.StorageCounterDSPrefix)
+	cb, err := mds.Get(counterKey)
+	switch {
+	case err == datastore.ErrNotFound:
+	case err != nil:
+		return nil, err
+	default:
+		cur, _ := binary.Uvarint(cb)
+		if abi.SectorNumber(cur) >= maxSectorID {
+			return restored, nil
+		}
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	size := binary.PutUvarint(buf, uint64(maxSectorID))
+	return restored, mds.Put(counterKey, buf[:size])
+}
+
+// restoreDealRefs recreates the links from deals to the sectors storing them,
+// used for retrieval, for the sectors in the backup whose links are missing.
+func restoreDealRefs(mds dtypes.MetadataDS, fromChain map[abi.SectorNumber]struct{}) error {
+	res, err := mds.Query(query.Query{Prefix: sealing.SectorStorePrefix})
+	if err != nil {
+		return err
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+
+		var info sealing.SectorInfo
+		if err := cborutil.ReadCborRPC(bytes.NewReader(r.Value), &info); err != nil {
+			return xerrors.Errorf("decoding sector %s: %w", r.Key, err)
+		}
+
+		// sectors restored from chain only have their deal pieces, so the
+		// piece offsets are unknown
+		if _, ok := fromChain[info.SectorNumber]; ok {
+			continue
+		}
+
+		var offset abi.UnpaddedPieceSize
+		for _, p := range info.Pieces {
+			size := p.Piece.Size.Unpadded()
+			if p.DealInfo != nil {
+				if err := restoreDealRef(mds, p.DealInfo.DealID, info.SectorNumber, uint64(offset), size); err != nil {
+					return err
+				}
+			}
+			offset += size
+		}
+	}
+
+	return nil
+}
+
+func restoreDealRef(mds dtypes.MetadataDS, dealID abi.DealID, sector abi.SectorNumber, offset uint64, size abi.UnpaddedPieceSize) error {
+	key := datastore.NewKey("/sealedblocks").Child(sectorblocks.DealIDToDsKey(dealID))
+
+	has, err := mds.Has(key)
+	if err != nil || has {
+		return err
+	}
+
+	b, err := cborutil.Dump(&lapi.SealedRefs{
+		Refs: []lapi.SealedRef{{
+			SectorID: sector,
+			Offset:   offset,
+			Size:     size,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return mds.Put(key, b)
+}
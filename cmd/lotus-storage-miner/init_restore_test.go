@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mh "github.com/multiformats/go-multihash"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	lapi "github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/backupds"
+	"github.com/filecoin-project/lotus/node/modules"
+	"github.com/filecoin-project/lotus/storage/sectorblocks"
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+type restoreTestAPI struct {
+	lapi.FullNode
+
+	sectors []*lapi.ChainSectorInfo
+	deals   map[abi.DealID]*lapi.MarketDeal
+}
+
+func (a *restoreTestAPI) StateMinerSectors(ctx context.Context, maddr address.Address, filter *abi.BitField, filterOut bool, tsk types.TipSetKey) ([]*lapi.ChainSectorInfo, error) {
+	return a.sectors, nil
+}
+
+func (a *restoreTestAPI) StateMarketStorageDeal(ctx context.Context, dealID abi.DealID, tsk types.TipSetKey) (*lapi.MarketDeal, error) {
+	d, ok := a.deals[dealID]
+	if !ok {
+		return nil, xerrors.Errorf("deal %d not found", dealID)
+	}
+	return d, nil
+}
+
+func testCid(t *testing.T, i int) cid.Cid {
+	hash, err := mh.Sum([]byte{byte(i)}, mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.Raw, hash)
+}
+
+func TestRestoreRoundtrip(t *testing.T) {
+	ctx := context.TODO()
+	dir, err := ioutil.TempDir("", "minerrestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	maddr, err := address.NewIDAddress(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sectorKey := func(n abi.SectorNumber) datastore.Key {
+		return datastore.NewKey(sealing.SectorStorePrefix).ChildString(fmt.Sprint(n))
+	}
+	counterKey := datastore.NewKey(modules.StorageCounterDSPrefix)
+	put := func(ds datastore.Datastore, key datastore.Key, v []byte) {
+		t.Helper()
+		if err := ds.Put(key, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the old node stored sector 1 with a filler piece in front of deal 10,
+	// sector 2 was committed after the backup was taken
+	old := backupds.Wrap(dssync.MutexWrap(datastore.NewMapDatastore()))
+	commR := testCid(t, 1)
+	sector1, err := cborutil.Dump(&sealing.SectorInfo{
+		State:        sealing.Proving,
+		SectorNumber: 1,
+		CommR:        &commR,
+		Pieces: []sealing.Piece{
+			{Piece: abi.PieceInfo{Size: 2048, PieceCID: testCid(t, 2)}},
+			{Piece: abi.PieceInfo{Size: 2048, PieceCID: testCid(t, 3)}, DealInfo: &sealing.DealInfo{DealID: 10}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	put(old, datastore.NewKey("miner-address"), maddr.Bytes())
+	put(old, sectorKey(1), sector1)
+	put(old, counterKey, []byte{1})
+
+	path := filepath.Join(dir, "backup.cbor")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Backup(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mds := dssync.MutexWrap(datastore.NewMapDatastore())
+	if err := importBackup(path, mds); err != nil {
+		t.Fatal(err)
+	}
+
+	api := &restoreTestAPI{
+		sectors: []*lapi.ChainSectorInfo{
+			{ID: 1, Info: miner.SectorOnChainInfo{Info: miner.SectorPreCommitInfo{SealedCID: commR, DealIDs: []abi.DealID{10}}}},
+			{ID: 2, Info: miner.SectorOnChainInfo{Info: miner.SectorPreCommitInfo{SealedCID: testCid(t, 4), DealIDs: []abi.DealID{20}}}},
+		},
+		deals: map[abi.DealID]*lapi.MarketDeal{
+			10: {Proposal: market.DealProposal{PieceCID: testCid(t, 3), PieceSize: 2048}},
+			20: {Proposal: market.DealProposal{PieceCID: testCid(t, 5), PieceSize: 1024, StartEpoch: 100, EndEpoch: 200}},
+		},
+	}
+
+	fromChain, err := restoreSectors(ctx, api, maddr, mds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreDealRefs(mds, fromChain); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fromChain[2]; len(fromChain) != 1 || !ok {
+		t.Fatalf("expected only sector 2 to be restored from chain, got %v", fromChain)
+	}
+
+	// the sector in the backup is kept as it was
+	b, err := mds.Get(sectorKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, sector1) {
+		t.Fatal("expected sector 1 to be restored from the backup")
+	}
+
+	b, err = mds.Get(sectorKey(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info sealing.SectorInfo
+	if err := cborutil.ReadCborRPC(bytes.NewReader(b), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.State != sealing.Proving || info.CommR == nil || *info.CommR != testCid(t, 4) {
+		t.Fatalf("expected sector 2 to be proving with its sealed CID, got %s, %v", info.State, info.CommR)
+	}
+	if len(info.Pieces) != 1 || info.Pieces[0].DealInfo == nil || info.Pieces[0].DealInfo.DealID != 20 ||
+		info.Pieces[0].DealInfo.DealSchedule.EndEpoch != 200 || info.Pieces[0].Piece.Size != 1024 {
+		t.Fatalf("expected sector 2 to contain deal 20, got %+v", info.Pieces)
+	}
+
+	// the counter is moved past the sectors on chain
+	b, err = mds.Get(counterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur, _ := binary.Uvarint(b); cur != 2 {
+		t.Fatalf("expected the sector counter at 2, got %d", cur)
+	}
+
+	refs := func(dealID abi.DealID) []lapi.SealedRef {
+		t.Helper()
+		b, err := mds.Get(datastore.NewKey("/sealedblocks").Child(sectorblocks.DealIDToDsKey(dealID)))
+		if err == datastore.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var refs lapi.SealedRefs
+		if err := cborutil.ReadCborRPC(bytes.NewReader(b), &refs); err != nil {
+			t.Fatal(err)
+		}
+		return refs.Refs
+	}
+
+	// the deal is found after the filler piece in front of it
+	if r := refs(10); len(r) != 1 || r[0].SectorID != 1 || r[0].Offset != 2032 || r[0].Size != 2032 {
+		t.Fatalf("expected deal 10 to be linked to sector 1 at offset 2032, got %+v", r)
+	}
+	// the offsets of the deals of sectors restored from chain are unknown
+	if r := refs(20); r != nil {
+		t.Fatalf("expected no link for deal 20, got %+v", r)
+	}
+}
@@ -27,15 +27,19 @@ func main() {
 
 	local := []*cli.Command{
 		actorCmd,
+		backupCmd,
 		storageDealsCmd,
 		retrievalDealsCmd,
 		infoCmd,
 		initCmd,
+		maintenanceCmd,
 		rewardsCmd,
 		runCmd,
 		stopCmd,
 		sectorsCmd,
 		storageCmd,
+		tlsCmd,
+		versionsCmd,
 		workersCmd,
 		provingCmd,
 	}
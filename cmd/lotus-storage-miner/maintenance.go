@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var maintenanceCmd = &cli.Command{
+	Name:  "maintenance",
+	Usage: "Prepare the miner for planned downtime",
+	Subcommands: []*cli.Command{
+		maintenanceStartCmd,
+		maintenanceStopCmd,
+		maintenanceCheckpointCmd,
+		maintenanceStatusCmd,
+	},
+}
+
+var maintenanceStartCmd = &cli.Command{
+	Name:      "start",
+	Usage:     "Stop pledging sectors and accepting storage deals, so that sealing drains",
+	ArgsUsage: "[reason]",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		if err := nodeApi.MaintenanceStart(ctx, strings.Join(cctx.Args().Slice(), " ")); err != nil {
+			return err
+		}
+
+		fmt.Println("Maintenance mode enabled, check 'lotus-storage-miner maintenance status' for when workers can be powered off")
+		return nil
+	},
+}
+
+var maintenanceStopCmd = &cli.Command{
+	Name:  "stop",
+	Usage: "Resume pledging sectors and accepting storage deals",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		return nodeApi.MaintenanceStop(ctx)
+	},
+}
+
+var maintenanceCheckpointCmd = &cli.Command{
+	Name:  "checkpoint",
+	Usage: "Abort the sealing tasks running on workers, their phases run again once maintenance mode is disabled",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		aborted, err := nodeApi.MaintenanceCheckpoint(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Aborted the tasks of %d sectors\n", len(aborted))
+		for _, s := range aborted {
+			fmt.Printf("\t%d\n", s)
+		}
+		return nil
+	},
+}
+
+var maintenanceStatusCmd = &cli.Command{
+	Name:  "status",
+	Usage: "Show whether workers can be powered off, and when the next WindowPoSt is due",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "wait",
+			Usage: "wait until the tasks in flight complete and workers can be powered off",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		st, err := nodeApi.MaintenanceStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		if cctx.Bool("wait") {
+			if !st.Enabled {
+				return xerrors.New("maintenance mode not enabled")
+			}
+			for !st.Drained {
+				fmt.Printf("Waiting for %d sectors with tasks running, %d sectors waiting for the chain and %d workers\n", len(st.Busy), len(st.Waiting), len(st.BusyWorkers))
+				select {
+				case <-time.After(30 * time.Second):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+
+				st, err = nodeApi.MaintenanceStatus(ctx)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if st.Enabled {
+			fmt.Printf("Maintenance mode: enabled since %s", st.Since.Format(time.Stamp))
+			if st.Reason != "" {
+				fmt.Printf(" (%s)", st.Reason)
+			}
+			fmt.Println()
+		} else {
+			fmt.Println("Maintenance mode: disabled")
+		}
+
+		printSectors := func(title string, sectors []api.MaintenanceSector) {
+			fmt.Printf("%s: %d\n", title, len(sectors))
+			for _, s := range sectors {
+				fmt.Printf("\t%d: %s\n", s.SectorID, s.State)
+			}
+		}
+		printSectors("Sectors with tasks running", st.Busy)
+		printSectors("Sectors waiting for the chain or a retry", st.Waiting)
+		printSectors("Sectors held", st.Held)
+		fmt.Printf("Workers with tasks running: %d\n", len(st.BusyWorkers))
+		for _, w := range st.BusyWorkers {
+			fmt.Printf("\t%d: %s\n", w.ID, w.Hostname)
+		}
+
+		switch {
+		case st.Drained:
+			fmt.Println("Workers can be powered off")
+		case st.Enabled:
+			fmt.Println("Waiting for sealing tasks to complete or be held, 'maintenance checkpoint' aborts the running ones")
+		}
+
+		if !st.HasPoSt {
+			fmt.Println("No sectors to prove")
+			return nil
+		}
+		if st.PoStIn == 0 {
+			fmt.Printf("WindowPoSt deadline %d is open, the miner must keep running\n", st.NextPoStDeadline)
+			return nil
+		}
+		fmt.Printf("Next WindowPoSt: deadline %d opens at epoch %d, in %s\n", st.NextPoStDeadline, st.NextPoStOpen, st.PoStIn.Round(time.Second))
+
+		return nil
+	},
+}
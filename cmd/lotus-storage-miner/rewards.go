@@ -76,7 +76,7 @@ var rewardsRedeemCmd = &cli.Command{
 			GasLimit: gasLimit,
 			Method:   builtin.MethodsMiner.WithdrawBalance,
 			Params:   params,
-		})
+		}, nil)
 		if err != nil {
 			return err
 		}
@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
+	"contrib.go.opencensus.io/exporter/prometheus"
 	mux "github.com/gorilla/mux"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/mitchellh/go-homedir"
 	"github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr-net"
 	"github.com/urfave/cli/v2"
@@ -21,6 +27,8 @@ import (
 	"github.com/filecoin-project/lotus/api/apistruct"
 	"github.com/filecoin-project/lotus/build"
 	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/lib/rpctls"
+	"github.com/filecoin-project/lotus/lib/sockbs"
 	"github.com/filecoin-project/lotus/lib/ulimit"
 	"github.com/filecoin-project/lotus/node"
 	"github.com/filecoin-project/lotus/node/impl"
@@ -50,6 +58,10 @@ var runCmd = &cli.Command{
 			Usage: "manage open file limit",
 			Value: true,
 		},
+		&cli.StringFlag{
+			Name:  "shared-blockstore",
+			Usage: "read chain objects from the shared blockstore socket of a full node on this machine",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		if !cctx.Bool("enable-gpu-proving") {
@@ -78,6 +90,20 @@ var runCmd = &cli.Command{
 			return xerrors.Errorf("lotus-daemon API version doesn't match: local: %s", api.Version{APIVersion: build.APIVersion})
 		}
 
+		if err := applyNetworkParams(ctx, nodeApi); err != nil {
+			return err
+		}
+
+		if p := cctx.String("shared-blockstore"); p != "" {
+			sbs, err := sockbs.Dial(p, sockbs.DefaultCacheSize)
+			if err != nil {
+				return err
+			}
+			defer sbs.Close() //nolint:errcheck
+
+			nodeApi = &sharedBlockstoreAPI{FullNode: nodeApi, bs: sbs}
+		}
+
 		log.Info("Checking full node sync status")
 
 		if !cctx.Bool("nosync") {
@@ -136,6 +162,29 @@ var runCmd = &cli.Command{
 
 		log.Infof("Remote version %s", v)
 
+		endpoint, secure := rpctls.SplitAddr(endpoint)
+
+		var tlsCfg *tls.Config
+		if secure {
+			p, err := homedir.Expand(storageRepoPath)
+			if err != nil {
+				return err
+			}
+			tlsDir := filepath.Join(p, rpctls.DirName)
+
+			tlsCfg, err = rpctls.ServerConfig(tlsDir)
+			if err != nil {
+				return xerrors.Errorf("loading TLS certificate, run 'lotus-storage-miner tls init': %w", err)
+			}
+
+			// workers serve TLS too, and are connected with the same certificate
+			clientCfg, err := rpctls.ClientConfig(tlsDir)
+			if err != nil {
+				return err
+			}
+			rpctls.InstallClient(clientCfg)
+		}
+
 		lst, err := manet.Listen(endpoint)
 		if err != nil {
 			return xerrors.Errorf("could not listen: %w", err)
@@ -148,6 +197,15 @@ var runCmd = &cli.Command{
 
 		mux.Handle("/rpc/v0", rpcServer)
 		mux.PathPrefix("/remote").HandlerFunc(minerapi.(*impl.StorageMinerAPI).ServeRemote)
+
+		exporter, err := prometheus.NewExporter(prometheus.Options{
+			Namespace: "lotus_miner",
+		})
+		if err != nil {
+			return xerrors.Errorf("creating the prometheus stats exporter: %w", err)
+		}
+		mux.Handle("/debug/metrics", exporter)
+
 		mux.PathPrefix("/").Handler(http.DefaultServeMux) // pprof
 
 		ah := &auth.Handler{
@@ -155,7 +213,7 @@ var runCmd = &cli.Command{
 			Next:   mux.ServeHTTP,
 		}
 
-		srv := &http.Server{Handler: ah}
+		srv := &http.Server{Handler: ah, TLSConfig: tlsCfg}
 
 		sigChan := make(chan os.Signal, 2)
 		go func() {
@@ -175,6 +233,52 @@ var runCmd = &cli.Command{
 		}()
 		signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
 
+		if secure {
+			log.Info("Serving the API over mutual TLS")
+			return srv.ServeTLS(manet.NetListener(lst), "", "")
+		}
 		return srv.Serve(manet.NetListener(lst))
 	},
 }
+
+// applyNetworkParams uses the network params of the full node, which custom
+// networks can override without recompiling
+func applyNetworkParams(ctx context.Context, nodeApi api.FullNode) error {
+	np, err := nodeApi.StateNetworkParams(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting network params: %w", err)
+	}
+	if err := build.ApplyNetworkParams(np); err != nil {
+		return xerrors.Errorf("applying network params: %w", err)
+	}
+	return nil
+}
+
+// sharedBlockstoreAPI reads chain objects from the shared blockstore of the
+// full node, and through the API if that fails
+type sharedBlockstoreAPI struct {
+	api.FullNode
+	bs *sockbs.Client
+}
+
+func (a *sharedBlockstoreAPI) ChainReadObj(ctx context.Context, c cid.Cid) ([]byte, error) {
+	b, err := a.bs.Get(c)
+	if err == nil {
+		return b.RawData(), nil
+	}
+	if err != bstore.ErrNotFound {
+		log.Warnf("reading from shared blockstore: %s", err)
+	}
+	return a.FullNode.ChainReadObj(ctx, c)
+}
+
+func (a *sharedBlockstoreAPI) ChainHasObj(ctx context.Context, c cid.Cid) (bool, error) {
+	has, err := a.bs.Has(c)
+	if err == nil && has {
+		return true, nil
+	}
+	if err != nil {
+		log.Warnf("reading from shared blockstore: %s", err)
+	}
+	return a.FullNode.ChainHasObj(ctx, c)
+}
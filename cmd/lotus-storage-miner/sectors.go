@@ -28,6 +28,9 @@ var sectorsCmd = &cli.Command{
 		sectorsUpdateCmd,
 		sectorsPledgeCmd,
 		sectorsRemoveCmd,
+		sectorsStuckCmd,
+		sectorsCommitDeadlinesCmd,
+		sectorsPledgePolicyCmd,
 	},
 }
 
@@ -110,6 +113,13 @@ var sectorsStatusCmd = &cli.Command{
 var sectorsListCmd = &cli.Command{
 	Name:  "list",
 	Usage: "List sectors",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "verbose",
+			Aliases: []string{"v"},
+			Usage:   "show estimated sealing completion times",
+		},
+	},
 	Action: func(cctx *cli.Context) error {
 		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
 		if err != nil {
@@ -153,6 +163,17 @@ var sectorsListCmd = &cli.Command{
 			commitedIDs[info.ID] = struct{}{}
 		}
 
+		etas := map[abi.SectorNumber]api.SectorEstimate{}
+		if cctx.Bool("verbose") {
+			ests, err := nodeApi.SectorsEstimates(ctx)
+			if err != nil {
+				return xerrors.Errorf("getting sealing estimates: %w", err)
+			}
+			for _, e := range ests {
+				etas[e.SectorID] = e
+			}
+		}
+
 		sort.Slice(list, func(i, j int) bool {
 			return list[i] < list[j]
 		})
@@ -169,7 +190,7 @@ var sectorsListCmd = &cli.Command{
 			_, inSSet := commitedIDs[s]
 			_, inPSet := provingIDs[s]
 
-			fmt.Fprintf(w, "%d: %s\tsSet: %s\tpSet: %s\ttktH: %d\tseedH: %d\tdeals: %v\n",
+			fmt.Fprintf(w, "%d: %s\tsSet: %s\tpSet: %s\ttktH: %d\tseedH: %d\tdeals: %v",
 				s,
 				st.State,
 				yesno(inSSet),
@@ -178,6 +199,17 @@ var sectorsListCmd = &cli.Command{
 				st.Seed.Epoch,
 				st.Deals,
 			)
+			if e, ok := etas[s]; ok {
+				guess := ""
+				if !e.FromHistory {
+					guess = " (default phase times)"
+				}
+				if e.WorkerClass != "" {
+					guess += " on " + e.WorkerClass
+				}
+				fmt.Fprintf(w, "\teta: %s, in %s%s", e.ETA.Format(time.Stamp), time.Until(e.ETA).Round(time.Minute), guess)
+			}
+			fmt.Fprintln(w)
 		}
 
 		return w.Flush()
@@ -243,6 +275,125 @@ var sectorsRemoveCmd = &cli.Command{
 	},
 }
 
+var sectorsStuckCmd = &cli.Command{
+	Name:  "stuck",
+	Usage: "List sectors which are stuck in a sealing phase",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		stuck, err := nodeApi.SectorsStuck(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Sector\tState\tFor\tExpected\tRetries\tAction\n")
+		for _, s := range stuck {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n", s.SectorID, s.State, time.Since(s.Since).Truncate(time.Second), s.Expected.Truncate(time.Second), s.Retries, s.Action)
+		}
+
+		return w.Flush()
+	},
+}
+
+var sectorsCommitDeadlinesCmd = &cli.Command{
+	Name:  "commit-deadlines",
+	Usage: "List the epochs by which the commitments of sectors which aren't proven yet have to land",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "at-risk",
+			Usage: "only list sectors at risk of missing a deadline",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		sectors, err := nodeApi.SectorsCommitDeadlines(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Sector\tState\tTicket\tPreCommit\tDeadline\tIn\tDeposit\tStatus\n")
+		for _, s := range sectors {
+			if cctx.Bool("at-risk") && !s.AtRisk && !s.Expired {
+				continue
+			}
+
+			precommit, msg := "-", "PreCommit"
+			if s.PreCommitEpoch != 0 {
+				precommit, msg = fmt.Sprint(s.PreCommitEpoch), "ProveCommit"
+			}
+
+			status := "ok"
+			switch {
+			case s.Expired:
+				status = "expired"
+			case s.AtRisk:
+				status = "at risk"
+			}
+			if s.Action != "" {
+				status += " (" + s.Action + ")"
+			}
+
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s %d\t%d\t%s\t%s\n", s.SectorID, s.State, s.TicketEpoch, precommit, msg, s.Deadline(), s.Deadline()-s.Height, types.FIL(s.Deposit), status)
+		}
+
+		return w.Flush()
+	},
+}
+
+var sectorsPledgePolicyCmd = &cli.Command{
+	Name:  "pledge-policy",
+	Usage: "Show the last decision of the policy pledging CC sectors",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		st, err := nodeApi.SectorsPledgePolicy(ctx)
+		if err != nil {
+			return err
+		}
+
+		if st.LastCheck.IsZero() {
+			fmt.Println("The policy hasn't run yet")
+			return nil
+		}
+
+		fmt.Printf("Last check:\t%s ago\n", time.Since(st.LastCheck).Truncate(time.Second))
+		if st.Pledged {
+			fmt.Println("Decision:\tpledged a CC sector")
+		} else {
+			fmt.Printf("Decision:\twait, %s\n", st.Reason)
+		}
+		fmt.Printf("Sealing:\t%d/%d (CC: %d/%d, deals: %d)\n", st.SealingCC+st.SealingDeals, st.MaxSealing, st.SealingCC, st.MaxSealingCC, st.SealingDeals)
+		if st.MaxSectors > 0 {
+			fmt.Printf("Sectors:\t%d/%d (proving: %d)\n", st.Proving+st.SealingCC+st.SealingDeals, st.MaxSectors, st.Proving)
+		} else {
+			fmt.Printf("Proving:\t%d\n", st.Proving)
+		}
+		if st.Budget > 0 {
+			fmt.Printf("Budget:\t%d/%d CC sectors\n", st.BudgetUsed, st.Budget)
+		}
+
+		return nil
+	},
+}
+
 var sectorsUpdateCmd = &cli.Command{
 	Name:  "update-state",
 	Usage: "ADVANCED: manually update the state of a sector, this may aid in error recovery",
@@ -58,6 +58,10 @@ var storageAttachCmd = &cli.Command{
 			Name:  "store",
 			Usage: "(for init) use path for long-term storage",
 		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "attach the path even if problems were found with sealed sectors in it",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
@@ -112,6 +116,17 @@ var storageAttachCmd = &cli.Command{
 			}
 		}
 
+		issues, err := nodeApi.StorageCheckSectors(ctx, p)
+		if err != nil {
+			return xerrors.Errorf("checking sectors: %w", err)
+		}
+		for _, issue := range issues {
+			fmt.Printf("%s (sector %d): %s\n", issue.File, issue.Sector, issue.Issue)
+		}
+		if len(issues) > 0 && !cctx.Bool("force") {
+			return xerrors.Errorf("found %d problems with sealed sectors, these will likely cause PoSt failures; fix them or pass --force", len(issues))
+		}
+
 		return nodeApi.StorageAddLocal(ctx, p)
 	},
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/lib/rpctls"
+)
+
+var tlsCmd = &cli.Command{
+	Name:  "tls",
+	Usage: "Manage the certificates securing the miner and worker APIs with mutual TLS",
+	Description: `The miner holds a certificate authority which issues certificates to the
+   miner and its workers. To serve the miner API over TLS, end its
+   API.ListenAddress with /https, e.g. /ip4/0.0.0.0/tcp/2345/https. Workers
+   started with --tls serve their API over TLS too, and connect to the miner
+   with the address in STORAGE_API_INFO, which must end with /https as well.`,
+	Subcommands: []*cli.Command{
+		tlsInitCmd,
+		tlsIssueCmd,
+	},
+}
+
+var tlsInitCmd = &cli.Command{
+	Name:  "init",
+	Usage: "Create the certificate authority, and a certificate for the miner",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "host",
+			Usage: "IP or DNS name the miner API is reached at, can be repeated",
+			Value: cli.NewStringSlice("127.0.0.1", "localhost"),
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		dir, err := minerTLSDir(cctx)
+		if err != nil {
+			return err
+		}
+
+		if err := rpctls.InitCA(dir, "lotus miner CA"); err != nil {
+			return err
+		}
+		if err := rpctls.Issue(dir, dir, "lotus miner", cctx.StringSlice("host")); err != nil {
+			return xerrors.Errorf("issuing miner certificate: %w", err)
+		}
+
+		fmt.Printf("Created certificate authority and miner certificate in %s\n", dir)
+		return nil
+	},
+}
+
+var tlsIssueCmd = &cli.Command{
+	Name:      "issue",
+	Usage:     "Issue a certificate to a worker",
+	ArgsUsage: "<output directory>",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:     "host",
+			Usage:    "IP or DNS name the worker API is reached at, can be repeated",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "name of the worker in the certificate",
+			Value: "lotus worker",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return xerrors.New("expected the output directory as the only argument")
+		}
+
+		dir, err := minerTLSDir(cctx)
+		if err != nil {
+			return err
+		}
+
+		out := cctx.Args().First()
+		if err := rpctls.Issue(dir, out, cctx.String("name"), cctx.StringSlice("host")); err != nil {
+			return err
+		}
+
+		fmt.Printf("Issued worker certificate to %s, copy it to the %s directory of the worker repo\n", out, rpctls.DirName)
+		return nil
+	},
+}
+
+func minerTLSDir(cctx *cli.Context) (string, error) {
+	p, err := homedir.Expand(cctx.String(FlagStorageRepo))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(p, rpctls.DirName), nil
+}
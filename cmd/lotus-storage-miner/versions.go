@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var versionsCmd = &cli.Command{
+	Name:  "versions",
+	Usage: "Print the versions of the miner, its full node and workers, and check they're compatible",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		vs, err := nodeApi.VersionCheck(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "Component\tVersion\tCommit\tBuild\tGo\tActors\tParams\tStatus")
+
+		var incompatible int
+		for _, c := range vs {
+			status := "ok"
+			if c.Incompatible != "" {
+				status = "incompatible: " + c.Incompatible
+				incompatible++
+			}
+
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				c.Component, c.Version, orDash(c.Version.Commit), orDash(c.Version.BuildType), orDash(c.Version.GoVersion),
+				orDash(c.Version.ActorsVersion), orDash(c.Version.ParamsVersion), status)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		if incompatible > 0 {
+			return xerrors.Errorf("%d incompatible components", incompatible)
+		}
+		return nil
+	},
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
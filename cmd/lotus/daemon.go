@@ -102,6 +102,10 @@ var DaemonCmd = &cli.Command{
 			Name:  "import-chain",
 			Usage: "on first run, load chain from given file",
 		},
+		&cli.StringFlag{
+			Name:  "import-snapshot",
+			Usage: "on first run, load a chain snapshot from given file, without recomputing the state of the chain",
+		},
 		&cli.BoolFlag{
 			Name:  "halt-after-import",
 			Usage: "halt the process after importing chain from file",
@@ -119,6 +123,14 @@ var DaemonCmd = &cli.Command{
 			Usage: "manage open file limit",
 			Value: true,
 		},
+		&cli.BoolFlag{
+			Name:  "api-read-only",
+			Usage: "only allow API methods which don't change node state, regardless of token permissions",
+		},
+		&cli.Uint64Flag{
+			Name:  "keep-state-roots",
+			Usage: "periodically prune the chain store, keeping the state of this many recent tipsets, overrides ChainPrune.KeepStateRoots of the config (0 disables pruning)",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		err := runmetrics.Enable(runmetrics.RunMetricOptions{
@@ -190,14 +202,33 @@ var DaemonCmd = &cli.Command{
 			genBytes = build.MaybeGenesis()
 		}
 
+		if len(genBytes) > 0 {
+			np, err := modules.GenesisNetworkParams(genBytes)
+			if err != nil {
+				return xerrors.Errorf("loading genesis network params: %w", err)
+			}
+			if np != nil {
+				if err := build.ApplyNetworkParams(*np); err != nil {
+					return xerrors.Errorf("applying genesis network params: %w", err)
+				}
+			}
+		}
+
 		chainfile := cctx.String("import-chain")
+		snapshot := cctx.String("import-snapshot")
+		if chainfile != "" && snapshot != "" {
+			return xerrors.Errorf("cannot specify both 'import-chain' and 'import-snapshot'")
+		}
+		if snapshot != "" {
+			chainfile = snapshot
+		}
 		if chainfile != "" {
 			chainfile, err := homedir.Expand(chainfile)
 			if err != nil {
 				return err
 			}
 
-			if err := ImportChain(r, chainfile); err != nil {
+			if err := ImportChain(r, chainfile, snapshot != ""); err != nil {
 				return err
 			}
 			if cctx.Bool("halt-after-import") {
@@ -221,6 +252,10 @@ var DaemonCmd = &cli.Command{
 
 		var api api.FullNode
 
+		// --keep-state-roots overrides the configured number of state roots
+		// pruning keeps, 0 disables pruning
+		keepStateRoots, keep := cctx.IsSet("keep-state-roots"), cctx.Uint64("keep-state-roots")
+
 		stop, err := node.New(ctx,
 			node.FullAPI(&api),
 
@@ -240,6 +275,10 @@ var DaemonCmd = &cli.Command{
 					}
 					return lr.SetAPIEndpoint(apima)
 				})),
+			node.ApplyIf(func(s *node.Settings) bool { return keepStateRoots && keep > 0 },
+				node.Override(node.RunChainPrunerKey, modules.RunChainPrunerKeep(keep))),
+			node.ApplyIf(func(s *node.Settings) bool { return keepStateRoots && keep == 0 },
+				node.Unset(node.RunChainPrunerKey)),
 			node.ApplyIf(func(s *node.Settings) bool { return !cctx.Bool("bootstrap") },
 				node.Unset(node.RunPeerMgrKey),
 				node.Unset(new(*peermgr.PeerMgr)),
@@ -271,7 +310,7 @@ var DaemonCmd = &cli.Command{
 		}
 
 		// TODO: properly parse api endpoint (or make it a URL)
-		return serveRPC(api, stop, endpoint, shutdownChan)
+		return serveRPC(api, stop, endpoint, shutdownChan, cctx.Bool("api-read-only"))
 	},
 	Subcommands: []*cli.Command{
 		daemonStopCmd,
@@ -312,7 +351,10 @@ func importKey(ctx context.Context, api api.FullNode, f string) error {
 	return nil
 }
 
-func ImportChain(r repo.Repo, fname string) error {
+// ImportChain imports a chain car file into the repo, and sets its root as the
+// head. The state of the whole chain is validated, unless the file is a
+// snapshot, which is only checked to contain the state of its root.
+func ImportChain(r repo.Repo, fname string, snapshot bool) error {
 	fi, err := os.Open(fname)
 	if err != nil {
 		return err
@@ -336,7 +378,7 @@ func ImportChain(r repo.Repo, fname string) error {
 
 	bs := blockstore.NewBlockstore(ds)
 
-	cst := store.NewChainStore(bs, mds, vm.Syscalls(ffiwrapper.ProofVerifier))
+	cst := store.NewChainStore(bs, mds, vm.DefaultSyscalls(ffiwrapper.ProofVerifier))
 
 	log.Info("importing chain from file...")
 	ts, err := cst.Import(fi)
@@ -344,11 +386,17 @@ func ImportChain(r repo.Repo, fname string) error {
 		return xerrors.Errorf("importing chain failed: %w", err)
 	}
 
-	stm := stmgr.NewStateManager(cst)
+	if snapshot {
+		if err := cst.CheckSnapshot(context.TODO(), ts); err != nil {
+			return xerrors.Errorf("checking snapshot failed: %w", err)
+		}
+	} else {
+		stm := stmgr.NewStateManager(cst)
 
-	log.Infof("validating imported chain...")
-	if err := stm.ValidateChain(context.TODO(), ts); err != nil {
-		return xerrors.Errorf("chain validation failed: %w", err)
+		log.Infof("validating imported chain...")
+		if err := stm.ValidateChain(context.TODO(), ts); err != nil {
+			return xerrors.Errorf("chain validation failed: %w", err)
+		}
 	}
 
 	log.Info("accepting %s as new head", ts.Cids())
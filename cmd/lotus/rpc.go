@@ -22,29 +22,38 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/lib/apicache"
 	"github.com/filecoin-project/lotus/node"
 	"github.com/filecoin-project/lotus/node/impl"
 )
 
 var log = logging.Logger("main")
 
-func serveRPC(a api.FullNode, stop node.StopFunc, addr multiaddr.Multiaddr, shutdownCh <-chan struct{}) error {
+func serveRPC(a api.FullNode, stop node.StopFunc, addr multiaddr.Multiaddr, shutdownCh <-chan struct{}, readOnly bool) error {
 	rpcServer := jsonrpc.NewServer()
-	rpcServer.Register("Filecoin", apistruct.PermissionedFullAPI(a))
+	rpcServer.Register("Filecoin", apistruct.PermissionedFullAPI(apistruct.NamespacedFullAPI(a)))
+
+	verify := apistruct.VerifyFunc(a.AuthVerify)
+	if readOnly {
+		log.Warn("API is read-only, only methods with the read permission can be called")
+		verify = apistruct.ReadOnlyVerify(verify)
+	}
 
 	ah := &auth.Handler{
-		Verify: a.AuthVerify,
-		Next:   rpcServer.ServeHTTP,
+		Verify: verify,
+		Next:   apistruct.NamespaceHandler(a.AuthVerifyNamespace, apicache.Handler(rpcServer.ServeHTTP)),
 	}
 
 	http.Handle("/rpc/v0", ah)
 
-	importAH := &auth.Handler{
-		Verify: a.AuthVerify,
-		Next:   handleImport(a.(*impl.FullNodeAPI)),
-	}
+	if !readOnly {
+		importAH := &auth.Handler{
+			Verify: verify,
+			Next:   apistruct.NamespaceHandler(a.AuthVerifyNamespace, handleImport(a.(*impl.FullNodeAPI))),
+		}
 
-	http.Handle("/rest/v0/import", importAH)
+		http.Handle("/rest/v0/import", importAH)
+	}
 
 	exporter, err := prometheus.NewExporter(prometheus.Options{
 		Namespace: "lotus",
@@ -102,6 +111,11 @@ func handleImport(a *impl.FullNodeAPI) func(w http.ResponseWriter, r *http.Reque
 			_ = json.NewEncoder(w).Encode(struct{ Error string }{"unauthorized: missing write permission"})
 			return
 		}
+		if apistruct.NamespaceFromContext(r.Context()) != nil {
+			w.WriteHeader(401)
+			_ = json.NewEncoder(w).Encode(struct{ Error string }{"unauthorized: imports can't be made with namespaced tokens"})
+			return
+		}
 
 		c, err := a.ClientImportLocal(r.Context(), r.Body)
 		if err != nil {
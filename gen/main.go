@@ -8,6 +8,7 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/blocksync"
+	"github.com/filecoin-project/lotus/chain/snapshot"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/node/hello"
 	"github.com/filecoin-project/lotus/paychmgr"
@@ -66,6 +67,18 @@ func main() {
 		blocksync.BlockSyncRequest{},
 		blocksync.BlockSyncResponse{},
 		blocksync.BSTipSet{},
+		blocksync.BSHandshake{},
+		blocksync.BSGoAway{},
+	)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	err = gen.WriteTupleEncodersToFile("./chain/snapshot/cbor_gen.go", "snapshot",
+		snapshot.Request{},
+		snapshot.Response{},
+		snapshot.Manifest{},
 	)
 	if err != nil {
 		fmt.Println(err)
@@ -8,6 +8,8 @@ import (
 	"github.com/filecoin-project/specs-actors/actors/builtin/market"
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/filecoin-project/lotus/build"
 )
 
 type ActorType string
@@ -67,4 +69,7 @@ type Template struct {
 
 	NetworkName string
 	Timestamp   uint64 `json:",omitempty"`
+
+	// NetworkParams override the parameters of the build for custom networks
+	NetworkParams *build.NetworkParams `json:",omitempty"`
 }
@@ -1,10 +1,14 @@
 package journal
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,11 +16,43 @@ import (
 	"golang.org/x/xerrors"
 )
 
-func InitializeSystemJournal(dir string) error {
+// Systems and events recorded in the journal
+const (
+	SysSync  = "sync"
+	SysMpool = "mpool"
+	SysMiner = "miner"
+	SysChain = "chain"
+
+	EvtHeadChange   = "head_change"
+	EvtSyncError    = "sync_error"
+	EvtMpoolReject  = "reject"
+	EvtMinerMessage = "message"
+	EvtReorg        = "reorg"
+
+	EvtMinerCommitDeadline = "commit_deadline"
+)
+
+// Retention configures how much of the journal is kept. Journal files are
+// rolled when they reach MaxFileSize, rolled files are removed when there are
+// more than MaxFiles of them, or they are older than MaxAge. Zero values mean
+// no limit.
+type Retention struct {
+	MaxFileSize int64
+	MaxFiles    int
+	MaxAge      time.Duration
+}
+
+var DefaultRetention = Retention{
+	MaxFileSize: 1 << 30,
+	MaxFiles:    8,
+	MaxAge:      30 * 24 * time.Hour,
+}
+
+func InitializeSystemJournal(dir string, ret Retention) error {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
-	j, err := OpenFSJournal(dir)
+	j, err := OpenFSJournal(dir, ret)
 	if err != nil {
 		return err
 	}
@@ -24,12 +60,27 @@ func InitializeSystemJournal(dir string) error {
 	return nil
 }
 
+// Add records an untyped entry. Prefer Record, which allows filtering by
+// event type.
 func Add(sys string, val interface{}) {
+	Record(sys, "", val)
+}
+
+// Record adds an entry of the given system and event type to the journal.
+func Record(sys string, event string, val interface{}) {
 	if currentJournal == nil {
 		log.Warn("no journal configured")
 		return
 	}
-	currentJournal.AddEntry(sys, val)
+	currentJournal.AddEntry(sys, event, val)
+}
+
+// Query reads entries matching the query from the journal.
+func Query(q EntryQuery) ([]JournalEntry, error) {
+	if currentJournal == nil {
+		return nil, xerrors.New("no journal configured")
+	}
+	return currentJournal.Query(q)
 }
 
 var log = logging.Logger("journal")
@@ -37,10 +88,38 @@ var log = logging.Logger("journal")
 var currentJournal Journal
 
 type Journal interface {
-	AddEntry(system string, obj interface{})
+	AddEntry(system string, event string, obj interface{})
+	Query(q EntryQuery) ([]JournalEntry, error)
 	Close() error
 }
 
+// EntryQuery selects journal entries. Empty fields match any entry.
+type EntryQuery struct {
+	System string
+	Event  string
+	Since  time.Time
+	Until  time.Time
+
+	// Limit returns only the latest Limit matching entries
+	Limit int
+}
+
+func (q *EntryQuery) matches(je *JournalEntry) bool {
+	switch {
+	case q.System != "" && q.System != je.System:
+		return false
+	case q.Event != "" && q.Event != je.Event:
+		return false
+	case !q.Since.IsZero() && je.Timestamp.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && je.Timestamp.After(q.Until):
+		return false
+	}
+	return true
+}
+
+const journalFilePrefix = "lotus-journal-"
+
 // fsJournal is a basic journal backed by files on a filesystem
 type fsJournal struct {
 	fi    *os.File
@@ -49,19 +128,19 @@ type fsJournal struct {
 	lk sync.Mutex
 
 	journalDir string
+	retention  Retention
 
-	incoming         chan *JournalEntry
-	journalSizeLimit int64
+	incoming chan *JournalEntry
 
 	closing chan struct{}
 }
 
-func OpenFSJournal(dir string) (*fsJournal, error) {
+func OpenFSJournal(dir string, ret Retention) (*fsJournal, error) {
 	fsj := &fsJournal{
-		journalDir:       dir,
-		incoming:         make(chan *JournalEntry, 32),
-		journalSizeLimit: 1 << 30,
-		closing:          make(chan struct{}),
+		journalDir: dir,
+		retention:  ret,
+		incoming:   make(chan *JournalEntry, 32),
+		closing:    make(chan struct{}),
 	}
 
 	if err := fsj.rollJournalFile(); err != nil {
@@ -75,6 +154,7 @@ func OpenFSJournal(dir string) (*fsJournal, error) {
 
 type JournalEntry struct {
 	System    string
+	Event     string `json:",omitempty"`
 	Timestamp time.Time
 	Val       interface{}
 }
@@ -84,6 +164,10 @@ func (fsj *fsJournal) putEntry(je *JournalEntry) error {
 	if err != nil {
 		return err
 	}
+
+	fsj.lk.Lock()
+	defer fsj.lk.Unlock()
+
 	n, err := fsj.fi.Write(append(b, '\n'))
 	if err != nil {
 		return err
@@ -91,8 +175,8 @@ func (fsj *fsJournal) putEntry(je *JournalEntry) error {
 
 	fsj.fSize += int64(n)
 
-	if fsj.fSize >= fsj.journalSizeLimit {
-		fsj.rollJournalFile()
+	if fsj.retention.MaxFileSize > 0 && fsj.fSize >= fsj.retention.MaxFileSize {
+		return fsj.rollJournalFile()
 	}
 
 	return nil
@@ -103,16 +187,146 @@ func (fsj *fsJournal) rollJournalFile() error {
 		fsj.fi.Close()
 	}
 
-	nfi, err := os.Create(filepath.Join(fsj.journalDir, fmt.Sprintf("lotus-journal-%s.ndjson", time.Now().Format(time.RFC3339))))
+	nfi, err := os.Create(filepath.Join(fsj.journalDir, fmt.Sprintf("%s%s.ndjson", journalFilePrefix, time.Now().UTC().Format(time.RFC3339Nano))))
 	if err != nil {
 		return xerrors.Errorf("failed to open journal file: %w", err)
 	}
 
 	fsj.fi = nfi
 	fsj.fSize = 0
+
+	if err := fsj.prune(); err != nil {
+		log.Warnf("pruning journal: %s", err)
+	}
+	return nil
+}
+
+// files returns the journal files, oldest first
+func (fsj *fsJournal) files() ([]os.FileInfo, error) {
+	ents, err := ioutil.ReadDir(fsj.journalDir)
+	if err != nil {
+		return nil, xerrors.Errorf("listing journal files: %w", err)
+	}
+
+	var out []os.FileInfo
+	for _, ent := range ents {
+		if !ent.IsDir() && strings.HasPrefix(ent.Name(), journalFilePrefix) {
+			out = append(out, ent)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ModTime().Before(out[j].ModTime())
+	})
+
+	return out, nil
+}
+
+// prune removes rolled journal files according to the retention policy.
+func (fsj *fsJournal) prune() error {
+	files, err := fsj.files()
+	if err != nil {
+		return err
+	}
+
+	for i, f := range files {
+		if f.Name() == filepath.Base(fsj.fi.Name()) {
+			continue
+		}
+
+		tooMany := fsj.retention.MaxFiles > 0 && len(files)-i > fsj.retention.MaxFiles
+		tooOld := fsj.retention.MaxAge > 0 && time.Since(f.ModTime()) > fsj.retention.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(fsj.journalDir, f.Name())); err != nil {
+			return xerrors.Errorf("removing journal file %s: %w", f.Name(), err)
+		}
+	}
+
 	return nil
 }
 
+func (fsj *fsJournal) Query(q EntryQuery) ([]JournalEntry, error) {
+	files, err := fsj.files()
+	if err != nil {
+		return nil, err
+	}
+
+	// files are read newest first, so that limited queries stop once they
+	// have the latest entries
+	var out []JournalEntry
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		if !q.Since.IsZero() && f.ModTime().Before(q.Since) {
+			break // nothing newer was written to this file, or older ones
+		}
+
+		limit := 0
+		if q.Limit > 0 {
+			limit = q.Limit - len(out)
+		}
+
+		ents, err := fsj.readFile(filepath.Join(fsj.journalDir, f.Name()), &q, limit)
+		if err != nil {
+			return nil, err
+		}
+		out = append(ents, out...)
+
+		if q.Limit > 0 && len(out) >= q.Limit {
+			break
+		}
+	}
+
+	return out, nil
+}
+
+// readFile returns the entries of the file matching the query, or only the
+// last limit of them if limit isn't zero
+func (fsj *fsJournal) readFile(path string, q *EntryQuery, limit int) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // pruned in the meantime
+		}
+		return nil, xerrors.Errorf("opening journal file: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	// with a limit the entries are kept in a ring, next is the oldest one
+	// once it is full
+	var ring []JournalEntry
+	next := 0
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		var je JournalEntry
+		if err := json.Unmarshal(sc.Bytes(), &je); err != nil {
+			// the last line of the active file may be partially written
+			log.Debugf("skipping bad journal line in %s: %s", path, err)
+			continue
+		}
+		if !q.matches(&je) {
+			continue
+		}
+
+		if limit > 0 && len(ring) == limit {
+			ring[next] = je
+			next = (next + 1) % limit
+			continue
+		}
+		ring = append(ring, je)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, xerrors.Errorf("reading journal file %s: %w", path, err)
+	}
+
+	out := make([]JournalEntry, 0, len(ring))
+	out = append(out, ring[next:]...)
+	return append(out, ring[:next]...), nil
+}
+
 func (fsj *fsJournal) runLoop() {
 	for {
 		select {
@@ -127,9 +341,10 @@ func (fsj *fsJournal) runLoop() {
 	}
 }
 
-func (fsj *fsJournal) AddEntry(system string, obj interface{}) {
+func (fsj *fsJournal) AddEntry(system string, event string, obj interface{}) {
 	je := &JournalEntry{
 		System:    system,
+		Event:     event,
 		Timestamp: time.Now(),
 		Val:       obj,
 	}
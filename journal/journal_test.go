@@ -0,0 +1,86 @@
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	// an unreadable journal file older than all the others, the queries
+	// reading it fail
+	if err := os.Symlink(dir, filepath.Join(dir, journalFilePrefix+"old")); err != nil {
+		t.Fatal(err)
+	}
+
+	fsj, err := OpenFSJournal(dir, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsj.Close() //nolint:errcheck
+
+	// 10 entries of alternating systems, 3 per file
+	var files []string
+	start := time.Now().Add(time.Hour)
+	for i := 0; i < 10; i++ {
+		sys := "a"
+		if i%2 == 1 {
+			sys = "b"
+		}
+		if err := fsj.putEntry(&JournalEntry{System: sys, Timestamp: start.Add(time.Duration(i) * time.Second), Val: i}); err != nil {
+			t.Fatal(err)
+		}
+		if i%3 == 2 || i == 9 {
+			files = append(files, fsj.fi.Name())
+			fsj.lk.Lock()
+			err := fsj.rollJournalFile()
+			fsj.lk.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// modification times are too coarse to order files written this fast
+	for i, f := range files {
+		mt := start.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(f, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect := func(q EntryQuery, vals ...int) {
+		t.Helper()
+		ents, err := fsj.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ents) != len(vals) {
+			t.Fatalf("%+v: expected %d entries, got %d", q, len(vals), len(ents))
+		}
+		for i, je := range ents {
+			if v := int(je.Val.(float64)); v != vals[i] {
+				t.Fatalf("%+v: entry %d: expected value %d, got %d", q, i, vals[i], v)
+			}
+		}
+	}
+
+	expect(EntryQuery{Limit: 1}, 9)
+	expect(EntryQuery{Limit: 4}, 6, 7, 8, 9)
+	expect(EntryQuery{Limit: 5}, 5, 6, 7, 8, 9)
+	expect(EntryQuery{System: "a", Limit: 4}, 2, 4, 6, 8)
+	expect(EntryQuery{System: "b", Until: start.Add(6 * time.Second), Limit: 2}, 3, 5)
+	expect(EntryQuery{Since: start.Add(7 * time.Second)}, 7, 8, 9)
+
+	// unlimited queries read every file
+	if _, err := fsj.Query(EntryQuery{}); err == nil {
+		t.Fatal("expected reading all the journal files to fail")
+	}
+}
@@ -0,0 +1,148 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("alerting")
+
+const notifyTimeout = 30 * time.Second
+
+// Alert types raised by lotus subsystems
+const (
+	SyncStalled    = "sync-stalled"
+	WindowPoStFail = "wdpost-failed"
+	LowBalance     = "low-balance"
+	DiskNearlyFull = "disk-nearly-full"
+)
+
+// Alert describes a problem condition. An alert is sent to hooks once when it
+// becomes active, and once more when it's resolved.
+type Alert struct {
+	// Type identifies the condition, optionally suffixed with the subject it
+	// concerns, e.g. 'low-balance/t01234'
+	Type    string
+	Active  bool
+	Message string
+	Time    time.Time
+}
+
+// Hook delivers alert notifications to an external system.
+type Hook interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Alerting tracks active alerts, and notifies hooks about changes.
+type Alerting struct {
+	hooks []Hook
+
+	lk     sync.Mutex
+	active map[string]Alert
+}
+
+func New(hooks ...Hook) *Alerting {
+	return &Alerting{
+		hooks:  hooks,
+		active: map[string]Alert{},
+	}
+}
+
+// Raise activates an alert. Hooks are only notified when the alert wasn't
+// already active.
+func (al *Alerting) Raise(typ string, format string, args ...interface{}) {
+	if al == nil {
+		return
+	}
+
+	a := Alert{
+		Type:    typ,
+		Active:  true,
+		Message: fmt.Sprintf(format, args...),
+		Time:    time.Now(),
+	}
+
+	al.lk.Lock()
+	_, wasActive := al.active[typ]
+	if wasActive {
+		// keep the time the alert was first raised
+		a.Time = al.active[typ].Time
+	}
+	al.active[typ] = a
+	al.lk.Unlock()
+
+	if wasActive {
+		return
+	}
+
+	log.Errorw("alert raised", "type", typ, "message", a.Message)
+	al.notify(a)
+}
+
+// Resolve deactivates an alert, notifying hooks if it was active.
+func (al *Alerting) Resolve(typ string, format string, args ...interface{}) {
+	if al == nil {
+		return
+	}
+
+	al.lk.Lock()
+	_, wasActive := al.active[typ]
+	delete(al.active, typ)
+	al.lk.Unlock()
+
+	if !wasActive {
+		return
+	}
+
+	a := Alert{
+		Type:    typ,
+		Active:  false,
+		Message: fmt.Sprintf(format, args...),
+		Time:    time.Now(),
+	}
+
+	log.Infow("alert resolved", "type", typ, "message", a.Message)
+	al.notify(a)
+}
+
+// Set raises or resolves an alert depending on the value of active.
+func (al *Alerting) Set(typ string, active bool, format string, args ...interface{}) {
+	if active {
+		al.Raise(typ, format, args...)
+		return
+	}
+	al.Resolve(typ, format, args...)
+}
+
+// Active returns the currently active alerts, sorted by type.
+func (al *Alerting) Active() []Alert {
+	al.lk.Lock()
+	defer al.lk.Unlock()
+
+	out := make([]Alert, 0, len(al.active))
+	for _, a := range al.active {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Type < out[j].Type
+	})
+	return out
+}
+
+func (al *Alerting) notify(a Alert) {
+	for _, h := range al.hooks {
+		go func(h Hook) {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+
+			if err := h.Notify(ctx, a); err != nil {
+				log.Warnw("alert hook failed", "type", a.Type, "error", err)
+			}
+		}(h)
+	}
+}
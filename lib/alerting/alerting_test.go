@@ -0,0 +1,62 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type chanHook chan Alert
+
+func (c chanHook) Notify(ctx context.Context, a Alert) error {
+	c <- a
+	return nil
+}
+
+func expectAlert(t *testing.T, c chanHook, active bool) {
+	t.Helper()
+
+	select {
+	case a := <-c:
+		if a.Active != active {
+			t.Fatalf("expected active=%t, got %+v", active, a)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected an alert notification")
+	}
+}
+
+func expectNone(t *testing.T, c chanHook) {
+	t.Helper()
+
+	select {
+	case a := <-c:
+		t.Fatalf("unexpected alert notification %+v", a)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestAlertDedup(t *testing.T) {
+	c := make(chanHook, 10)
+	al := New(c)
+
+	al.Resolve(SyncStalled, "synced")
+	expectNone(t, c)
+
+	al.Raise(SyncStalled, "behind %d", 20)
+	expectAlert(t, c, true)
+
+	al.Raise(SyncStalled, "behind %d", 25)
+	expectNone(t, c)
+
+	if act := al.Active(); len(act) != 1 || act[0].Message != "behind 25" {
+		t.Fatalf("unexpected active alerts: %+v", act)
+	}
+
+	al.Resolve(SyncStalled, "synced")
+	expectAlert(t, c, false)
+
+	if act := al.Active(); len(act) != 0 {
+		t.Fatalf("unexpected active alerts: %+v", act)
+	}
+}
@@ -0,0 +1,24 @@
+package alerting
+
+import (
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// DiskUsage returns the fraction of used space on the filesystem holding the
+// given path.
+func DiskUsage(path string) (float64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, xerrors.Errorf("statfs %s: %w", path, err)
+	}
+
+	total := stat.Blocks * uint64(stat.Bsize)
+	if total == 0 {
+		return 0, nil
+	}
+	avail := stat.Bavail * uint64(stat.Bsize)
+
+	return float64(total-avail) / float64(total), nil
+}
@@ -0,0 +1,71 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"golang.org/x/xerrors"
+)
+
+// Webhook posts alerts as JSON to an URL.
+type Webhook struct {
+	URL string
+}
+
+func (w *Webhook) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return xerrors.Errorf("webhook %s responded with status %d", w.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// Exec runs a shell command for every alert. The alert is passed as JSON on
+// stdin, and its fields are also available in the LOTUS_ALERT_TYPE,
+// LOTUS_ALERT_ACTIVE and LOTUS_ALERT_MESSAGE environment variables.
+type Exec struct {
+	Command string
+}
+
+func (e *Exec) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", e.Command) //nolint:gosec
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"LOTUS_ALERT_TYPE="+a.Type,
+		"LOTUS_ALERT_ACTIVE="+strconv.FormatBool(a.Active),
+		"LOTUS_ALERT_MESSAGE="+a.Message,
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return xerrors.Errorf("alert command failed: %w (output: %s)", err, string(out))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Package apicache caches results of API calls for a single API connection.
+//
+// Dashboards tend to issue bursts of related queries against the same head,
+// each of them resolving the same tipsets and loading the same actors. Every
+// connection gets its own short-lived cache, so that results are only shared
+// between calls of one client, and never outlive the TTL.
+package apicache
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TTL is how long cached results are used
+var TTL = 3 * time.Second
+
+// MaxEntries limits the number of results cached for a connection
+var MaxEntries = 1024
+
+type entry struct {
+	val     interface{}
+	expires time.Time
+}
+
+type Cache struct {
+	ttl time.Duration
+	max int
+
+	lk      sync.Mutex
+	entries map[interface{}]entry
+}
+
+func New(ttl time.Duration, max int) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		max:     max,
+		entries: map[interface{}]entry{},
+	}
+}
+
+// Get returns the cached value for the key, or calls load and caches its
+// result. Errors aren't cached. A nil cache always calls load.
+func (c *Cache) Get(key interface{}, load func() (interface{}, error)) (interface{}, error) {
+	if c == nil || c.ttl <= 0 {
+		return load()
+	}
+
+	now := time.Now()
+
+	c.lk.Lock()
+	e, ok := c.entries[key]
+	c.lk.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.val, nil
+	}
+
+	val, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if len(c.entries) >= c.max {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.max {
+			return val, nil
+		}
+	}
+	c.entries[key] = entry{val: val, expires: now.Add(c.ttl)}
+
+	return val, nil
+}
+
+type cacheKey struct{}
+
+func WithCache(ctx context.Context, c *Cache) context.Context {
+	return context.WithValue(ctx, cacheKey{}, c)
+}
+
+// FromContext returns the cache of the connection the call was made on, or nil
+func FromContext(ctx context.Context) *Cache {
+	c, _ := ctx.Value(cacheKey{}).(*Cache)
+	return c
+}
+
+// Handler gives every request a new cache. Websocket connections are served
+// within a single request, so all calls made on one connection share a cache.
+func Handler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := New(TTL, MaxEntries)
+		next(w, r.WithContext(WithCache(r.Context(), c)))
+	}
+}
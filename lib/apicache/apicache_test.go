@@ -0,0 +1,56 @@
+package apicache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestCacheExpiry(t *testing.T) {
+	c := New(50*time.Millisecond, 16)
+	ctx := WithCache(context.Background(), c)
+
+	loads := 0
+	load := func() (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		v, err := FromContext(ctx).Get("k", load)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.(int) != 1 {
+			t.Fatalf("expected cached value 1, got %d", v)
+		}
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	v, err := FromContext(ctx).Get("k", load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.(int) != 2 {
+		t.Fatalf("expected reloaded value 2, got %d", v)
+	}
+}
+
+func TestCacheNoErrors(t *testing.T) {
+	var nilCache *Cache
+	if _, err := nilCache.Get("k", func() (interface{}, error) { return 1, nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(time.Minute, 16)
+	if _, err := c.Get("k", func() (interface{}, error) { return nil, xerrors.New("fail") }); err == nil {
+		t.Fatal("expected error")
+	}
+	v, err := c.Get("k", func() (interface{}, error) { return 1, nil })
+	if err != nil || v.(int) != 1 {
+		t.Fatalf("errors must not be cached, got %v, %v", v, err)
+	}
+}
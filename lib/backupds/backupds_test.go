@@ -0,0 +1,47 @@
+package backupds
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+func TestBackupRoundtrip(t *testing.T) {
+	ds := Wrap(dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	entries := map[string][]byte{
+		"/miner-address":   {0, 232, 7},
+		"/sectors/1":       bytes.Repeat([]byte{1}, 300),
+		"/storage/nextid":  {1},
+		"/deals/provider/": {},
+	}
+	for k, v := range entries {
+		if err := ds.Put(datastore.NewKey(k), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ds.Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := map[string][]byte{}
+	if err := ReadBackup(&buf, func(key datastore.Key, value []byte) error {
+		restored[key.String()] = value
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(restored) != len(entries) {
+		t.Fatalf("expected %d entries, got %d", len(entries), len(restored))
+	}
+	for k, v := range entries {
+		if !bytes.Equal(restored[datastore.NewKey(k).String()], v) {
+			t.Errorf("entry %s: expected %x, got %x", k, v, restored[k])
+		}
+	}
+}
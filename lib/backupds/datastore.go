@@ -0,0 +1,163 @@
+package backupds
+
+import (
+	"io"
+	"sync"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("backupds")
+
+// Datastore wraps a datastore so that consistent backups of it can be taken
+// while it's in use. Writes are blocked while a backup is written.
+type Datastore struct {
+	child datastore.Batching
+
+	backupLk sync.RWMutex
+}
+
+func Wrap(child datastore.Batching) *Datastore {
+	return &Datastore{
+		child: child,
+	}
+}
+
+// Backup writes all entries of the datastore to out.
+func (d *Datastore) Backup(out io.Writer) error {
+	scratch := make([]byte, 9)
+
+	d.backupLk.Lock()
+	defer d.backupLk.Unlock()
+
+	log.Info("Starting datastore backup")
+
+	qr, err := d.child.Query(query.Query{})
+	if err != nil {
+		return xerrors.Errorf("query: %w", err)
+	}
+	defer qr.Close() //nolint:errcheck
+
+	// the entry count has to be known upfront, metadata datastores are small
+	// enough to be collected in memory
+	ents, err := qr.Rest()
+	if err != nil {
+		return xerrors.Errorf("listing entries: %w", err)
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, out, cbg.MajArray, 2); err != nil {
+		return xerrors.Errorf("writing header: %w", err)
+	}
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, out, cbg.MajUnsignedInt, BackupVersion); err != nil {
+		return xerrors.Errorf("writing version: %w", err)
+	}
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, out, cbg.MajArray, uint64(len(ents))); err != nil {
+		return xerrors.Errorf("writing entry count: %w", err)
+	}
+
+	for _, e := range ents {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, out, cbg.MajArray, 2); err != nil {
+			return xerrors.Errorf("writing entry header: %w", err)
+		}
+		if err := writeBytes(out, scratch, []byte(e.Key)); err != nil {
+			return xerrors.Errorf("writing key: %w", err)
+		}
+		if err := writeBytes(out, scratch, e.Value); err != nil {
+			return xerrors.Errorf("writing value: %w", err)
+		}
+	}
+
+	log.Infow("Datastore backup done", "entries", len(ents))
+
+	return nil
+}
+
+func writeBytes(w io.Writer, scratch []byte, b []byte) error {
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajByteString, uint64(len(b))); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func (d *Datastore) Get(key datastore.Key) (value []byte, err error) {
+	return d.child.Get(key)
+}
+
+func (d *Datastore) Has(key datastore.Key) (exists bool, err error) {
+	return d.child.Has(key)
+}
+
+func (d *Datastore) GetSize(key datastore.Key) (size int, err error) {
+	return d.child.GetSize(key)
+}
+
+func (d *Datastore) Query(q query.Query) (query.Results, error) {
+	return d.child.Query(q)
+}
+
+func (d *Datastore) Put(key datastore.Key, value []byte) error {
+	d.backupLk.RLock()
+	defer d.backupLk.RUnlock()
+
+	return d.child.Put(key, value)
+}
+
+func (d *Datastore) Delete(key datastore.Key) error {
+	d.backupLk.RLock()
+	defer d.backupLk.RUnlock()
+
+	return d.child.Delete(key)
+}
+
+func (d *Datastore) Sync(prefix datastore.Key) error {
+	d.backupLk.RLock()
+	defer d.backupLk.RUnlock()
+
+	return d.child.Sync(prefix)
+}
+
+func (d *Datastore) Close() error {
+	d.backupLk.RLock()
+	defer d.backupLk.RUnlock()
+
+	return d.child.Close()
+}
+
+func (d *Datastore) Batch() (datastore.Batch, error) {
+	b, err := d.child.Batch()
+	if err != nil {
+		return nil, err
+	}
+
+	return &bbatch{
+		b:  b,
+		rl: d.backupLk.RLocker(),
+	}, nil
+}
+
+type bbatch struct {
+	b  datastore.Batch
+	rl sync.Locker
+}
+
+func (b *bbatch) Put(key datastore.Key, value []byte) error {
+	return b.b.Put(key, value)
+}
+
+func (b *bbatch) Delete(key datastore.Key) error {
+	return b.b.Delete(key)
+}
+
+func (b *bbatch) Commit() error {
+	b.rl.Lock()
+	defer b.rl.Unlock()
+
+	return b.b.Commit()
+}
+
+var _ datastore.Batching = &Datastore{}
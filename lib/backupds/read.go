@@ -0,0 +1,95 @@
+package backupds
+
+import (
+	"io"
+
+	"github.com/ipfs/go-datastore"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// BackupVersion is the version of the backup format written by Backup
+const BackupVersion = 1
+
+// MaxEntrySize bounds the size of keys and values read from a backup
+const MaxEntrySize = 64 << 20
+
+// ReadBackup reads a datastore backup, calling cb for every entry.
+//
+// A backup is a CBOR array of the format version and the entries, which are
+// an array of [key, value] byte string pairs.
+func ReadBackup(r io.Reader, cb func(key datastore.Key, value []byte) error) error {
+	scratch := make([]byte, 9)
+	br := cbg.GetPeeker(r)
+
+	maj, n, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return xerrors.Errorf("reading header: %w", err)
+	}
+	if maj != cbg.MajArray || n != 2 {
+		return xerrors.New("not a datastore backup")
+	}
+
+	maj, v, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return xerrors.Errorf("reading version: %w", err)
+	}
+	if maj != cbg.MajUnsignedInt {
+		return xerrors.New("not a datastore backup")
+	}
+	if v != BackupVersion {
+		return xerrors.Errorf("unsupported backup version %d, expected %d", v, BackupVersion)
+	}
+
+	maj, n, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return xerrors.Errorf("reading entry count: %w", err)
+	}
+	if maj != cbg.MajArray {
+		return xerrors.Errorf("expected entry array, got major type %d", maj)
+	}
+
+	for i := uint64(0); i < n; i++ {
+		maj, l, err := cbg.CborReadHeaderBuf(br, scratch)
+		if err != nil {
+			return xerrors.Errorf("reading entry %d: %w", i, err)
+		}
+		if maj != cbg.MajArray || l != 2 {
+			return xerrors.Errorf("entry %d: expected key-value pair", i)
+		}
+
+		k, err := readBytes(br, scratch)
+		if err != nil {
+			return xerrors.Errorf("reading key of entry %d: %w", i, err)
+		}
+		v, err := readBytes(br, scratch)
+		if err != nil {
+			return xerrors.Errorf("reading value of entry %d: %w", i, err)
+		}
+
+		if err := cb(datastore.NewKey(string(k)), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readBytes(br io.Reader, scratch []byte) ([]byte, error) {
+	maj, l, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return nil, err
+	}
+	if maj != cbg.MajByteString {
+		return nil, xerrors.Errorf("expected byte string, got major type %d", maj)
+	}
+	if l > MaxEntrySize {
+		return nil, xerrors.Errorf("byte string too large (%d bytes)", l)
+	}
+
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
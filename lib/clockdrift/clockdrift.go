@@ -0,0 +1,200 @@
+package clockdrift
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var log = logging.Logger("clockdrift")
+
+// blockWindow is the number of recent block observations drift is estimated
+// from.
+const blockWindow = 100
+
+// Checker monitors the drift of the local clock. Drift is measured against
+// NTP servers, and additionally estimated from the timestamps of blocks
+// arriving from the network: an honest block can't be received before its
+// timestamp, so blocks that consistently arrive 'early' mean our clock is
+// behind.
+type Checker struct {
+	servers      []string
+	interval     time.Duration
+	maxDrift     time.Duration
+	refuseToMine bool
+
+	// queries a single server, queryNTP unless replaced by tests
+	query func(ctx context.Context, server string) (time.Duration, error)
+
+	lk sync.Mutex
+
+	ntpDrift time.Duration
+	ntpValid bool
+
+	// arrival time minus block timestamp, for the last blockWindow blocks
+	blockLag []time.Duration
+	next     int
+}
+
+func New(servers []string, interval, maxDrift time.Duration, refuseToMine bool) *Checker {
+	return &Checker{
+		servers:      servers,
+		interval:     interval,
+		maxDrift:     maxDrift,
+		refuseToMine: refuseToMine,
+		query:        queryNTP,
+	}
+}
+
+type ntpResult struct {
+	drift time.Duration
+	ok    bool
+}
+
+// Run periodically checks the local clock until the context is cancelled.
+// Blocks received on the passed channel are used as a secondary drift source.
+// NTP servers are queried in the background, so that unresponsive servers
+// don't hold up the blocks.
+func (c *Checker) Run(ctx context.Context, blocks <-chan *types.BlockHeader) {
+	tick := time.NewTicker(c.interval)
+	defer tick.Stop()
+
+	// buffered, so that the last query doesn't block once Run returned
+	results := make(chan ntpResult, 1)
+	querying := false
+	startNTP := func() {
+		if querying {
+			return
+		}
+		querying = true
+		go func() {
+			drift, ok := c.queryServers(ctx)
+			results <- ntpResult{drift: drift, ok: ok}
+		}()
+	}
+	startNTP()
+
+	for {
+		select {
+		case b, ok := <-blocks:
+			if !ok {
+				blocks = nil
+				continue
+			}
+			c.ObserveBlock(b.Timestamp, time.Now())
+		case r := <-results:
+			querying = false
+			c.lk.Lock()
+			c.ntpDrift = r.drift
+			c.ntpValid = r.ok
+			c.lk.Unlock()
+			c.report()
+		case <-tick.C:
+			startNTP()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// queryServers returns the drift measured against the first NTP server which
+// responds. It returns false if none did.
+func (c *Checker) queryServers(ctx context.Context) (time.Duration, bool) {
+	for _, srv := range c.servers {
+		drift, err := c.query(ctx, srv)
+		if err != nil {
+			log.Debugw("ntp query failed", "server", srv, "error", err)
+			continue
+		}
+		return drift, true
+	}
+
+	if len(c.servers) > 0 && ctx.Err() == nil {
+		log.Warnf("failed to query any of %d ntp servers, relying on block timestamps", len(c.servers))
+	}
+	return 0, false
+}
+
+// ObserveBlock records the arrival time of a block with the given timestamp.
+func (c *Checker) ObserveBlock(timestamp uint64, arrival time.Time) {
+	lag := arrival.Sub(time.Unix(int64(timestamp), 0))
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if len(c.blockLag) < blockWindow {
+		c.blockLag = append(c.blockLag, lag)
+		return
+	}
+	c.blockLag[c.next] = lag
+	c.next = (c.next + 1) % blockWindow
+}
+
+// Drift returns the current best estimate of the local clock drift, positive
+// when the local clock is ahead. The second return value is false when there
+// is no data to base an estimate on.
+func (c *Checker) Drift() (time.Duration, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if c.ntpValid {
+		return c.ntpDrift, true
+	}
+
+	if len(c.blockLag) == 0 {
+		return 0, false
+	}
+
+	// Blocks can only tell us that we're behind - late blocks are normal
+	minLag := c.blockLag[0]
+	for _, l := range c.blockLag[1:] {
+		if l < minLag {
+			minLag = l
+		}
+	}
+	if minLag >= 0 {
+		return 0, true
+	}
+	return minLag, true
+}
+
+// Exceeded checks whether the estimated drift is above the configured limit.
+func (c *Checker) Exceeded() bool {
+	d, ok := c.Drift()
+	if !ok {
+		return false
+	}
+	if d < 0 {
+		d = -d
+	}
+	return d > c.maxDrift
+}
+
+// CheckMining returns an error when mining should be suspended because of
+// clock drift.
+func (c *Checker) CheckMining() error {
+	if !c.refuseToMine || !c.Exceeded() {
+		return nil
+	}
+
+	d, _ := c.Drift()
+	return xerrors.Errorf("local clock drift %s exceeds %s, fix time synchronization", d, c.maxDrift)
+}
+
+func (c *Checker) report() {
+	d, ok := c.Drift()
+	if !ok {
+		return
+	}
+
+	if c.Exceeded() {
+		log.Errorf("local clock is off by %s (limit %s), blocks produced by this node may be invalid", d, c.maxDrift)
+		return
+	}
+	log.Debugw("clock drift", "drift", d)
+}
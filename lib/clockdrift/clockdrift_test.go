@@ -0,0 +1,96 @@
+package clockdrift
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func TestRunHangingNTP(t *testing.T) {
+	c := New([]string{"unresponsive", "ok"}, time.Hour, time.Second, true)
+
+	release := make(chan struct{})
+	c.query = func(ctx context.Context, server string) (time.Duration, error) {
+		if server == "unresponsive" {
+			return 0, xerrors.New("timeout")
+		}
+		select {
+		case <-release:
+			return 2 * time.Second, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	blocks := make(chan *types.BlockHeader)
+	go c.Run(ctx, blocks)
+
+	// blocks are observed while the ntp query hangs, one arriving 5s before
+	// its timestamp means the local clock is behind
+	early := uint64(time.Now().Add(5 * time.Second).Unix())
+	select {
+	case blocks <- &types.BlockHeader{Timestamp: early}:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected blocks to be received while the ntp query hangs")
+	}
+
+	waitDrift := func(cond func(time.Duration) bool) time.Duration {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if d, ok := c.Drift(); ok && cond(d) {
+				return d
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		d, ok := c.Drift()
+		t.Fatalf("unexpected drift %s (%t)", d, ok)
+		return 0
+	}
+
+	waitDrift(func(d time.Duration) bool { return d < -3*time.Second })
+	if err := c.CheckMining(); err == nil {
+		t.Fatal("expected mining to be refused")
+	}
+
+	// the ntp result takes precedence once it arrives
+	close(release)
+	waitDrift(func(d time.Duration) bool { return d == 2*time.Second })
+}
+
+func TestDriftFromBlocks(t *testing.T) {
+	c := New(nil, time.Hour, time.Second, false)
+	now := time.Now()
+
+	if _, ok := c.Drift(); ok {
+		t.Fatal("expected no estimate without data")
+	}
+
+	// late blocks are normal
+	c.ObserveBlock(uint64(now.Add(-10*time.Second).Unix()), now)
+	if d, ok := c.Drift(); !ok || d != 0 {
+		t.Fatalf("expected no drift, got %s", d)
+	}
+
+	c.ObserveBlock(uint64(now.Add(3*time.Second).Unix()), now)
+	if !c.Exceeded() {
+		t.Fatal("expected an early block to exceed the drift limit")
+	}
+	if err := c.CheckMining(); err != nil {
+		t.Fatal("expected mining to be allowed when not refusing to mine")
+	}
+
+	// the early block drops out of the window
+	for i := 0; i < blockWindow; i++ {
+		c.ObserveBlock(uint64(now.Unix()), now.Add(time.Second))
+	}
+	if c.Exceeded() {
+		t.Fatal("expected the early block to be forgotten")
+	}
+}
@@ -0,0 +1,84 @@
+package clockdrift
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	ntpPacketSize = 48
+
+	// seconds between the NTP epoch (1900) and the unix epoch (1970)
+	ntpEpochOffset = 2208988800
+
+	// LI = 0 (no warning), VN = 4, Mode = 3 (client)
+	ntpClientHeader = 0x23
+
+	ntpTimeout = 5 * time.Second
+)
+
+func ntpToTime(b []byte) time.Time {
+	sec := binary.BigEndian.Uint32(b[0:4])
+	frac := binary.BigEndian.Uint32(b[4:8])
+
+	nsec := (uint64(frac) * 1e9) >> 32
+	return time.Unix(int64(sec)-ntpEpochOffset, int64(nsec))
+}
+
+// queryNTP performs a single SNTP exchange with the given server, and returns
+// the offset of the local clock relative to it. A positive offset means the
+// local clock is ahead of the server.
+func queryNTP(ctx context.Context, server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, xerrors.Errorf("dialing ntp server: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	deadline := time.Now().Add(ntpTimeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	req := make([]byte, ntpPacketSize)
+	req[0] = ntpClientHeader
+
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, xerrors.Errorf("sending ntp request: %w", err)
+	}
+
+	resp := make([]byte, ntpPacketSize)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return 0, xerrors.Errorf("reading ntp response: %w", err)
+	}
+	received := time.Now()
+
+	if n < ntpPacketSize {
+		return 0, xerrors.Errorf("short ntp response (%d bytes)", n)
+	}
+	if resp[1] == 0 {
+		return 0, xerrors.Errorf("ntp server sent kiss-of-death")
+	}
+
+	srvReceived := ntpToTime(resp[32:40])
+	srvSent := ntpToTime(resp[40:48])
+
+	// clock offset as defined in RFC 4330, negated so that it describes the
+	// local clock relative to the server
+	offset := (srvReceived.Sub(sent) + srvSent.Sub(received)) / 2
+	return -offset, nil
+}
@@ -0,0 +1,386 @@
+package coldstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	levelds "github.com/ipfs/go-ds-leveldb"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"golang.org/x/xerrors"
+)
+
+// DefaultShardSize is the size at which a new shard is started
+const DefaultShardSize = 1 << 30
+
+// CarShards is an append only blockstore keeping objects in CAR files, the
+// shards, with an index of where each object is stored. Deleted objects are
+// only removed from the index, their space isn't reclaimed.
+type CarShards struct {
+	dir       string
+	shardSize int64
+	index     datastore.Batching
+
+	lk      sync.Mutex
+	cur     *os.File
+	curBuf  *bufio.Writer
+	curNum  uint64
+	curSize int64
+	roots   []cid.Cid
+	readers map[uint64]*os.File
+
+	hashOnRead bool
+}
+
+var _ bstore.Blockstore = (*CarShards)(nil)
+
+type location struct {
+	shard  uint64
+	offset int64
+	size   int
+}
+
+func (l location) bytes() []byte {
+	buf := make([]byte, 3*binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, l.shard)
+	n += binary.PutUvarint(buf[n:], uint64(l.offset))
+	n += binary.PutUvarint(buf[n:], uint64(l.size))
+	return buf[:n]
+}
+
+func parseLocation(b []byte) (location, error) {
+	var vals [3]uint64
+	for i := range vals {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return location{}, xerrors.Errorf("invalid shard index entry")
+		}
+		vals[i], b = v, b[n:]
+	}
+	return location{shard: vals[0], offset: int64(vals[1]), size: int(vals[2])}, nil
+}
+
+// OpenCarShards opens the shards in dir. Objects are appended to a new shard,
+// which is started again once it reaches shardSize.
+func OpenCarShards(dir string, shardSize int64) (*CarShards, error) {
+	if shardSize <= 0 {
+		shardSize = DefaultShardSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, xerrors.Errorf("creating cold store dir: %w", err)
+	}
+
+	index, err := levelds.NewDatastore(filepath.Join(dir, "index"), nil)
+	if err != nil {
+		return nil, xerrors.Errorf("opening shard index: %w", err)
+	}
+
+	shards, err := filepath.Glob(filepath.Join(dir, "shard-*.car"))
+	if err != nil {
+		return nil, err
+	}
+
+	// new objects go to a new shard, a shard left incomplete by a crash is
+	// never appended to
+	var next uint64
+	for _, p := range shards {
+		var n uint64
+		if _, err := fmt.Sscanf(filepath.Base(p), "shard-%d.car", &n); err != nil {
+			continue
+		}
+		if n >= next {
+			next = n + 1
+		}
+	}
+
+	return &CarShards{
+		dir:       dir,
+		shardSize: shardSize,
+		index:     index,
+		curNum:    next,
+		readers:   map[uint64]*os.File{},
+	}, nil
+}
+
+func (cs *CarShards) shardPath(n uint64) string {
+	return filepath.Join(cs.dir, fmt.Sprintf("shard-%06d.car", n))
+}
+
+// StartShard finishes the current shard. The next objects are written to a
+// new shard, whose CAR header has the given roots, e.g. the tipset below
+// which the objects were moved. Shards started without it have the first
+// object written to them as their root.
+func (cs *CarShards) StartShard(roots []cid.Cid) error {
+	cs.lk.Lock()
+	defer cs.lk.Unlock()
+
+	if err := cs.finishShard(); err != nil {
+		return err
+	}
+	return cs.startShard(roots)
+}
+
+func (cs *CarShards) startShard(roots []cid.Cid) error {
+	f, err := os.OpenFile(cs.shardPath(cs.curNum), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return xerrors.Errorf("creating shard: %w", err)
+	}
+
+	cs.cur = f
+	cs.curBuf = bufio.NewWriter(f)
+	cs.curSize = 0
+	cs.roots = roots
+
+	cw := &countWriter{w: cs.curBuf}
+	if err := car.WriteHeader(&car.CarHeader{Roots: roots, Version: 1}, cw); err != nil {
+		return xerrors.Errorf("writing shard header: %w", err)
+	}
+	cs.curSize = cw.n
+	return nil
+}
+
+func (cs *CarShards) finishShard() error {
+	if cs.cur == nil {
+		return nil
+	}
+
+	if err := cs.curBuf.Flush(); err != nil {
+		return xerrors.Errorf("writing shard: %w", err)
+	}
+	if err := cs.cur.Sync(); err != nil {
+		return xerrors.Errorf("syncing shard: %w", err)
+	}
+	if err := cs.cur.Close(); err != nil {
+		return err
+	}
+
+	cs.cur, cs.curBuf = nil, nil
+	cs.curNum++
+	return nil
+}
+
+// Flush writes the buffered objects to the current shard, and syncs it
+func (cs *CarShards) Flush() error {
+	cs.lk.Lock()
+	defer cs.lk.Unlock()
+
+	if cs.cur == nil {
+		return nil
+	}
+	if err := cs.curBuf.Flush(); err != nil {
+		return xerrors.Errorf("writing shard: %w", err)
+	}
+	return cs.cur.Sync()
+}
+
+func (cs *CarShards) Close() error {
+	cs.lk.Lock()
+	defer cs.lk.Unlock()
+
+	if err := cs.finishShard(); err != nil {
+		return err
+	}
+	for _, f := range cs.readers {
+		_ = f.Close()
+	}
+	cs.readers = map[uint64]*os.File{}
+	return cs.index.Close()
+}
+
+func (cs *CarShards) locate(c cid.Cid) (location, error) {
+	b, err := cs.index.Get(dshelp.MultihashToDsKey(c.Hash()))
+	if err == datastore.ErrNotFound {
+		return location{}, bstore.ErrNotFound
+	}
+	if err != nil {
+		return location{}, err
+	}
+	return parseLocation(b)
+}
+
+func (cs *CarShards) Get(c cid.Cid) (block.Block, error) {
+	loc, err := cs.locate(c)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.lk.Lock()
+	if loc.shard == cs.curNum && cs.cur != nil {
+		// the object may still be buffered
+		if err := cs.curBuf.Flush(); err != nil {
+			cs.lk.Unlock()
+			return nil, xerrors.Errorf("writing shard: %w", err)
+		}
+	}
+	f, ok := cs.readers[loc.shard]
+	if !ok {
+		f, err = os.Open(cs.shardPath(loc.shard))
+		if err != nil {
+			cs.lk.Unlock()
+			return nil, xerrors.Errorf("opening shard: %w", err)
+		}
+		cs.readers[loc.shard] = f
+	}
+	cs.lk.Unlock()
+
+	data := make([]byte, loc.size)
+	if _, err := f.ReadAt(data, loc.offset); err != nil {
+		return nil, xerrors.Errorf("reading object from shard %d: %w", loc.shard, err)
+	}
+
+	if cs.hashOnRead {
+		rc, err := c.Prefix().Sum(data)
+		if err != nil {
+			return nil, err
+		}
+		if !rc.Equals(c) {
+			return nil, bstore.ErrHashMismatch
+		}
+	}
+	return block.NewBlockWithCid(data, c)
+}
+
+func (cs *CarShards) GetSize(c cid.Cid) (int, error) {
+	loc, err := cs.locate(c)
+	if err != nil {
+		return -1, err
+	}
+	return loc.size, nil
+}
+
+func (cs *CarShards) Has(c cid.Cid) (bool, error) {
+	return cs.index.Has(dshelp.MultihashToDsKey(c.Hash()))
+}
+
+func (cs *CarShards) Put(b block.Block) error {
+	return cs.PutMany([]block.Block{b})
+}
+
+func (cs *CarShards) PutMany(bs []block.Block) error {
+	cs.lk.Lock()
+	defer cs.lk.Unlock()
+
+	batch, err := cs.index.Batch()
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bs {
+		key := dshelp.MultihashToDsKey(b.Cid().Hash())
+		has, err := cs.index.Has(key)
+		if err != nil {
+			return err
+		}
+		if has {
+			continue
+		}
+
+		if cs.cur != nil && cs.curSize >= cs.shardSize {
+			if err := cs.finishShard(); err != nil {
+				return err
+			}
+		}
+		if cs.cur == nil {
+			// CAR files need a root, shards started when the previous one is
+			// full keep its roots
+			roots := cs.roots
+			if len(roots) == 0 {
+				roots = []cid.Cid{b.Cid()}
+			}
+			if err := cs.startShard(roots); err != nil {
+				return err
+			}
+		}
+
+		cw := &countWriter{w: cs.curBuf}
+		if err := carutil.LdWrite(cw, b.Cid().Bytes(), b.RawData()); err != nil {
+			return xerrors.Errorf("writing object to shard: %w", err)
+		}
+
+		loc := location{
+			shard:  cs.curNum,
+			offset: cs.curSize + cw.n - int64(len(b.RawData())),
+			size:   len(b.RawData()),
+		}
+		cs.curSize += cw.n
+
+		if err := batch.Put(key, loc.bytes()); err != nil {
+			return err
+		}
+	}
+
+	// objects must be on disk before the index points to them, the mover
+	// deletes them from the hot store once they're written
+	if cs.cur != nil {
+		if err := cs.curBuf.Flush(); err != nil {
+			return xerrors.Errorf("writing shard: %w", err)
+		}
+		if err := cs.cur.Sync(); err != nil {
+			return xerrors.Errorf("syncing shard: %w", err)
+		}
+	}
+	return batch.Commit()
+}
+
+func (cs *CarShards) DeleteBlock(c cid.Cid) error {
+	return cs.index.Delete(dshelp.MultihashToDsKey(c.Hash()))
+}
+
+func (cs *CarShards) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	res, err := cs.index.Query(dsq.Query{KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		defer res.Close() //nolint:errcheck
+
+		for r := range res.Next() {
+			if r.Error != nil {
+				log.Errorw("listing cold store keys", "error", r.Error)
+				return
+			}
+			mh, err := dshelp.DsKeyToMultihash(datastore.RawKey(r.Key))
+			if err != nil {
+				log.Warnw("invalid cold store key", "key", r.Key, "error", err)
+				continue
+			}
+
+			select {
+			case out <- cid.NewCidV1(cid.Raw, mh):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (cs *CarShards) HashOnRead(enabled bool) {
+	cs.hashOnRead = enabled
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,171 @@
+package coldstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipld/go-car"
+)
+
+func testBlocks(n int, tag string) []block.Block {
+	var out []block.Block
+	for i := 0; i < n; i++ {
+		out = append(out, block.NewBlock([]byte(fmt.Sprintf("%s object %d, padded to be a little larger", tag, i))))
+	}
+	return out
+}
+
+func checkBlocks(t *testing.T, cs *CarShards, blks []block.Block) {
+	for _, b := range blks {
+		got, err := cs.Get(b.Cid())
+		if err != nil {
+			t.Fatalf("getting %s: %s", b.Cid(), err)
+		}
+		if !bytes.Equal(got.RawData(), b.RawData()) {
+			t.Fatalf("object %s differs", b.Cid())
+		}
+		size, err := cs.GetSize(b.Cid())
+		if err != nil || size != len(b.RawData()) {
+			t.Fatalf("expected the size of %s to be %d, got %d (%v)", b.Cid(), len(b.RawData()), size, err)
+		}
+	}
+}
+
+func TestCarShards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carshards")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	cs, err := OpenCarShards(dir, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := testBlocks(6, "first")
+	root := first[0].Cid()
+	if err := cs.StartShard([]cid.Cid{root}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.PutMany(first); err != nil {
+		t.Fatal(err)
+	}
+	checkBlocks(t, cs, first)
+
+	// objects which are stored already aren't appended again
+	if err := cs.Put(first[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	shards, err := filepath.Glob(filepath.Join(dir, "shard-*.car"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shards) < 2 {
+		t.Fatalf("expected the objects to be split into shards of 200 bytes, got %d shards", len(shards))
+	}
+
+	// shards are CAR files, with the roots given when they're started
+	var inShards int
+	for i, p := range shards {
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cr, err := car.NewCarReader(f)
+		if err != nil {
+			t.Fatalf("reading shard %s: %s", p, err)
+		}
+		if i == 0 && (len(cr.Header.Roots) != 1 || cr.Header.Roots[0] != root) {
+			t.Fatalf("expected the first shard to have the root %s, got %v", root, cr.Header.Roots)
+		}
+		for {
+			_, err := cr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("reading shard %s: %s", p, err)
+			}
+			inShards++
+		}
+		_ = f.Close()
+	}
+	if inShards != len(first) {
+		t.Fatalf("expected %d objects in the shards, got %d", len(first), inShards)
+	}
+
+	// after reopening, objects are still found, and new ones go to a new shard
+	cs, err = OpenCarShards(dir, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close() //nolint:errcheck
+	cs.HashOnRead(true)
+
+	second := testBlocks(2, "second")
+	if err := cs.PutMany(second); err != nil {
+		t.Fatal(err)
+	}
+	checkBlocks(t, cs, first)
+	checkBlocks(t, cs, second)
+
+	after, err := filepath.Glob(filepath.Join(dir, "shard-*.car"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(shards)+1 {
+		t.Fatalf("expected a new shard after reopening, got %d shards instead of %d", len(after), len(shards)+1)
+	}
+	if err := cs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(after[len(after)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close() //nolint:errcheck
+	cr, err := car.NewCarReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cr.Header.Roots) != 1 || cr.Header.Roots[0] != second[0].Cid() {
+		t.Fatalf("expected the first object to be the root of a shard started without roots, got %v", cr.Header.Roots)
+	}
+
+	keys, err := cs.AllKeysChan(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for range keys {
+		n++
+	}
+	if n != len(first)+len(second) {
+		t.Fatalf("expected %d keys, got %d", len(first)+len(second), n)
+	}
+
+	if err := cs.DeleteBlock(first[1].Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := cs.Has(first[1].Cid()); err != nil || has {
+		t.Fatalf("expected the deleted object to be gone (%v)", err)
+	}
+	if _, err := cs.Get(first[1].Cid()); err != bstore.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
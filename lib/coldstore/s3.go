@@ -0,0 +1,389 @@
+package coldstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	"golang.org/x/xerrors"
+)
+
+// S3Config configures a cold store in a bucket of an S3 compatible object
+// store
+type S3Config struct {
+	// Endpoint is the URL of the object store, e.g.
+	// https://s3.us-east-1.amazonaws.com. Buckets are addressed by path.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to the names of the objects
+	Prefix string
+
+	// AccessKey and SecretKey are the credentials requests are signed with,
+	// the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables
+	// are used when they're empty
+	AccessKey string
+	SecretKey string
+}
+
+// S3 is a blockstore keeping each object in an object of an S3 compatible
+// object store. Objects are durable once Put returns.
+type S3 struct {
+	cfg    S3Config
+	client *http.Client
+
+	hashOnRead bool
+}
+
+var _ bstore.Blockstore = (*S3)(nil)
+
+// S3RequestTimeout bounds the requests to the object store
+var S3RequestTimeout = time.Minute
+
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.Region == "" {
+		return nil, xerrors.Errorf("the endpoint, region and bucket of the S3 cold store must be set")
+	}
+	if cfg.AccessKey == "" {
+		cfg.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if cfg.SecretKey == "" {
+		cfg.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, xerrors.Errorf("no credentials for the S3 cold store")
+	}
+	if _, err := url.Parse(cfg.Endpoint); err != nil {
+		return nil, xerrors.Errorf("parsing S3 endpoint: %w", err)
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+
+	return &S3{
+		cfg:    cfg,
+		client: &http.Client{Timeout: S3RequestTimeout},
+	}, nil
+}
+
+func (s *S3) objectName(c cid.Cid) string {
+	// the key of the multihash, as in datastore backed blockstores
+	return s.cfg.Prefix + dshelp.MultihashToDsKey(c.Hash()).String()[1:]
+}
+
+func (s *S3) objectURL(name string) string {
+	return s.cfg.Endpoint + "/" + awsEscape(s.cfg.Bucket, true) + "/" + awsEscape(name, false)
+}
+
+func (s *S3) do(method, u string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	signS3(req, body, s.cfg.Region, s.cfg.AccessKey, s.cfg.SecretKey, time.Now())
+
+	return s.client.Do(req)
+}
+
+func s3Error(op string, resp *http.Response) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	return xerrors.Errorf("S3 %s: %s: %s", op, resp.Status, msg)
+}
+
+func (s *S3) Get(c cid.Cid) (block.Block, error) {
+	resp, err := s.do(http.MethodGet, s.objectURL(s.objectName(c)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, bstore.ErrNotFound
+	default:
+		return nil, s3Error("get", resp)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, xerrors.Errorf("reading object: %w", err)
+	}
+
+	if s.hashOnRead {
+		rc, err := c.Prefix().Sum(data)
+		if err != nil {
+			return nil, err
+		}
+		if !rc.Equals(c) {
+			return nil, bstore.ErrHashMismatch
+		}
+	}
+	return block.NewBlockWithCid(data, c)
+}
+
+func (s *S3) head(c cid.Cid) (int, error) {
+	resp, err := s.do(http.MethodHead, s.objectURL(s.objectName(c)), nil)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return strconv.Atoi(resp.Header.Get("Content-Length"))
+	case http.StatusNotFound:
+		return -1, bstore.ErrNotFound
+	default:
+		return -1, s3Error("head", resp)
+	}
+}
+
+func (s *S3) GetSize(c cid.Cid) (int, error) {
+	return s.head(c)
+}
+
+func (s *S3) Has(c cid.Cid) (bool, error) {
+	_, err := s.head(c)
+	switch err {
+	case nil:
+		return true, nil
+	case bstore.ErrNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (s *S3) Put(b block.Block) error {
+	resp, err := s.do(http.MethodPut, s.objectURL(s.objectName(b.Cid())), b.RawData())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("put", resp)
+	}
+	return nil
+}
+
+func (s *S3) PutMany(bs []block.Block) error {
+	for _, b := range bs {
+		if err := s.Put(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3) DeleteBlock(c cid.Cid) error {
+	resp, err := s.do(http.MethodDelete, s.objectURL(s.objectName(c)), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3Error("delete", resp)
+	}
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3) list(token string) (*listBucketResult, error) {
+	q := url.Values{}
+	q.Set("list-type", "2")
+	if s.cfg.Prefix != "" {
+		q.Set("prefix", s.cfg.Prefix)
+	}
+	if token != "" {
+		q.Set("continuation-token", token)
+	}
+
+	resp, err := s.do(http.MethodGet, s.cfg.Endpoint+"/"+awsEscape(s.cfg.Bucket, true)+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error("list", resp)
+	}
+
+	var res listBucketResult
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, xerrors.Errorf("decoding object list: %w", err)
+	}
+	return &res, nil
+}
+
+func (s *S3) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	first, err := s.list("")
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+
+		res := first
+		for {
+			for _, o := range res.Contents {
+				mh, err := dshelp.DsKeyToMultihash(datastore.NewKey(strings.TrimPrefix(o.Key, s.cfg.Prefix)))
+				if err != nil {
+					log.Warnw("invalid cold store object name", "name", o.Key, "error", err)
+					continue
+				}
+
+				select {
+				case out <- cid.NewCidV1(cid.Raw, mh):
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if !res.IsTruncated {
+				return
+			}
+			next, err := s.list(res.NextContinuationToken)
+			if err != nil {
+				log.Errorw("listing cold store keys", "error", err)
+				return
+			}
+			res = next
+		}
+	}()
+	return out, nil
+}
+
+func (s *S3) HashOnRead(enabled bool) {
+	s.hashOnRead = enabled
+}
+
+// signS3 signs the request with AWS signature version 4. The host and the
+// headers set on the request are signed.
+func signS3(req *http.Request, body []byte, region, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		vals := append([]string{}, query[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			params = append(params, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape escapes s as AWS signatures expect, everything but unreserved
+// characters is percent encoded, slashes only with escapeSlash
+func awsEscape(s string, escapeSlash bool) string {
+	var out strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			out.WriteByte(b)
+		case b == '/' && !escapeSlash:
+			out.WriteByte(b)
+		default:
+			fmt.Fprintf(&out, "%%%02X", b)
+		}
+	}
+	return out.String()
+}
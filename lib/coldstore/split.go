@@ -0,0 +1,113 @@
+// Package coldstore splits the chain blockstore into a fast hot store, which
+// holds recent chain data, and a cold store, which historical data is moved
+// to, e.g. on cheaper disks.
+package coldstore
+
+import (
+	"context"
+
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("coldstore")
+
+// Split is a blockstore writing to the hot store, and reading through to the
+// cold store for objects which were moved there.
+type Split struct {
+	hot  bstore.Blockstore
+	cold bstore.Blockstore
+}
+
+var _ bstore.Blockstore = (*Split)(nil)
+
+func NewSplit(hot, cold bstore.Blockstore) *Split {
+	return &Split{
+		hot:  hot,
+		cold: cold,
+	}
+}
+
+func (s *Split) Hot() bstore.Blockstore {
+	return s.hot
+}
+
+func (s *Split) Cold() bstore.Blockstore {
+	return s.cold
+}
+
+func (s *Split) Get(c cid.Cid) (block.Block, error) {
+	b, err := s.hot.Get(c)
+	if err != bstore.ErrNotFound {
+		return b, err
+	}
+	return s.cold.Get(c)
+}
+
+func (s *Split) GetSize(c cid.Cid) (int, error) {
+	size, err := s.hot.GetSize(c)
+	if err != bstore.ErrNotFound {
+		return size, err
+	}
+	return s.cold.GetSize(c)
+}
+
+func (s *Split) Has(c cid.Cid) (bool, error) {
+	has, err := s.hot.Has(c)
+	if err != nil || has {
+		return has, err
+	}
+	return s.cold.Has(c)
+}
+
+// Put writes to the hot store, also objects which are in the cold store, as
+// they're likely to be used again
+func (s *Split) Put(b block.Block) error {
+	return s.hot.Put(b)
+}
+
+func (s *Split) PutMany(bs []block.Block) error {
+	return s.hot.PutMany(bs)
+}
+
+func (s *Split) DeleteBlock(c cid.Cid) error {
+	if err := s.hot.DeleteBlock(c); err != nil {
+		return err
+	}
+	return s.cold.DeleteBlock(c)
+}
+
+// AllKeysChan lists the keys of both stores. Keys of objects which are in
+// both stores are listed twice.
+func (s *Split) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	hot, err := s.hot.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := s.cold.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		for _, ch := range []<-chan cid.Cid{hot, cold} {
+			for c := range ch {
+				select {
+				case out <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *Split) HashOnRead(enabled bool) {
+	s.hot.HashOnRead(enabled)
+	s.cold.HashOnRead(enabled)
+}
@@ -0,0 +1,292 @@
+// Package envelope encrypts deal payloads with a key held by the client, so
+// the data stored by miners can't be read without it.
+//
+// An envelope starts with a header: the magic, the format version, the id of
+// the key, the chunk size, and a random nonce prefix. The data follows in
+// chunks of ChunkSize bytes, each sealed with AES-256-GCM and prefixed with its
+// sealed length. The nonce of a chunk is the nonce prefix followed by the
+// chunk index. The header, and whether the chunk is the last one, are
+// authenticated with every chunk, so envelopes can't be truncated, and chunks
+// can't be reordered or moved between envelopes.
+package envelope
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	Version   = 1
+	Cipher    = "aes-256-gcm"
+	KeySize   = 32
+	ChunkSize = 1 << 20
+
+	// MagicSize is the length of the prefix IsEnvelope checks
+	MagicSize = 8
+
+	keyIDSize       = 8
+	noncePrefixSize = 8
+	headerSize      = MagicSize + 1 + keyIDSize + 4 + noncePrefixSize
+	// maxChunkSize bounds the chunk size read from headers
+	maxChunkSize = 16 << 20
+)
+
+var magic = []byte("LOTUSENV")
+
+// Info describes the envelope a payload was encrypted in
+type Info struct {
+	Version   int
+	Cipher    string
+	KeyID     string
+	ChunkSize int
+}
+
+// KeyID identifies a key, without revealing it
+func KeyID(key []byte) string {
+	h := sha256.Sum256(key)
+	return hex.EncodeToString(h[:keyIDSize])
+}
+
+// NewKey returns a new random key
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// IsEnvelope returns whether the data starts like an envelope
+func IsEnvelope(prefix []byte) bool {
+	return bytes.HasPrefix(prefix, magic)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, xerrors.Errorf("expected a %d byte key, got %d bytes", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type chunker struct {
+	aead   cipher.AEAD
+	header []byte
+	index  uint32
+}
+
+func (c *chunker) nonce() []byte {
+	n := make([]byte, c.aead.NonceSize())
+	copy(n, c.header[len(magic)+1+keyIDSize+4:])
+	binary.BigEndian.PutUint32(n[len(n)-4:], c.index)
+	return n
+}
+
+func (c *chunker) ad(last bool) []byte {
+	ad := append([]byte{}, c.header...)
+	if last {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+// Encrypt returns a reader of the envelope of the data read from r
+func Encrypt(r io.Reader, key []byte) (io.Reader, Info, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	info := Info{
+		Version:   Version,
+		Cipher:    Cipher,
+		KeyID:     KeyID(key),
+		ChunkSize: ChunkSize,
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, Version)
+	kid, _ := hex.DecodeString(info.KeyID)
+	header = append(header, kid...)
+	header = append(header, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(header[len(header)-4:], ChunkSize)
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, Info{}, err
+	}
+	header = append(header, prefix...)
+
+	return &encryptReader{
+		src:     bufio.NewReaderSize(r, ChunkSize),
+		chunker: chunker{aead: aead, header: header},
+		buf:     bytes.NewBuffer(append([]byte{}, header...)),
+		plain:   make([]byte, ChunkSize),
+	}, info, nil
+}
+
+type encryptReader struct {
+	src *bufio.Reader
+	chunker
+	buf   *bytes.Buffer
+	plain []byte
+	done  bool
+}
+
+func (er *encryptReader) Read(p []byte) (int, error) {
+	for er.buf.Len() == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+		if err := er.sealNext(); err != nil {
+			return 0, err
+		}
+	}
+	return er.buf.Read(p)
+}
+
+func (er *encryptReader) sealNext() error {
+	n, err := io.ReadFull(er.src, er.plain)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	last := n < len(er.plain)
+	if !last {
+		if _, err := er.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	sealed := er.aead.Seal(nil, er.nonce(), er.plain[:n], er.ad(last))
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(sealed)))
+	er.buf.Write(l[:])
+	er.buf.Write(sealed)
+
+	er.index++
+	er.done = last
+	return nil
+}
+
+// ReadInfo reads the header of an envelope
+func ReadInfo(r io.Reader) (Info, []byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Info{}, nil, xerrors.Errorf("reading envelope header: %w", err)
+	}
+	if !IsEnvelope(header) {
+		return Info{}, nil, xerrors.New("not an envelope")
+	}
+
+	off := len(magic)
+	info := Info{
+		Version:   int(header[off]),
+		Cipher:    Cipher,
+		KeyID:     hex.EncodeToString(header[off+1 : off+1+keyIDSize]),
+		ChunkSize: int(binary.BigEndian.Uint32(header[off+1+keyIDSize:])),
+	}
+	if info.Version != Version {
+		return Info{}, nil, xerrors.Errorf("unsupported envelope version %d", info.Version)
+	}
+	if info.ChunkSize <= 0 || info.ChunkSize > maxChunkSize {
+		return Info{}, nil, xerrors.Errorf("invalid envelope chunk size %d", info.ChunkSize)
+	}
+	return info, header, nil
+}
+
+// Decrypt returns a reader of the data in the envelope read from r. Reads
+// fail if the envelope was altered or truncated.
+func Decrypt(r io.Reader, key []byte) (io.Reader, error) {
+	info, header, err := ReadInfo(r)
+	if err != nil {
+		return nil, err
+	}
+	if info.KeyID != KeyID(key) {
+		return nil, xerrors.Errorf("payload was encrypted with key %s, not %s", info.KeyID, KeyID(key))
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		src:      bufio.NewReader(r),
+		chunker:  chunker{aead: aead, header: header},
+		maxChunk: info.ChunkSize + aead.Overhead(),
+	}, nil
+}
+
+type decryptReader struct {
+	src *bufio.Reader
+	chunker
+	maxChunk int
+
+	plain []byte
+	done  bool
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.openNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+func (dr *decryptReader) openNext() error {
+	var l [4]byte
+	if _, err := io.ReadFull(dr.src, l[:]); err != nil {
+		if err == io.EOF {
+			return xerrors.New("envelope is truncated")
+		}
+		return err
+	}
+	size := int(binary.BigEndian.Uint32(l[:]))
+	if size > dr.maxChunk {
+		return xerrors.Errorf("envelope chunk too large: %d bytes", size)
+	}
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(dr.src, sealed); err != nil {
+		return xerrors.Errorf("reading envelope chunk: %w", err)
+	}
+
+	_, err := dr.src.Peek(1)
+	last := err == io.EOF
+
+	plain, err := dr.aead.Open(nil, dr.nonce(), sealed, dr.ad(last))
+	if err != nil {
+		if !last {
+			return xerrors.Errorf("decrypting envelope chunk %d: %w", dr.index, err)
+		}
+		// the last chunk read wasn't sealed as the last one
+		return xerrors.New("envelope is truncated")
+	}
+
+	dr.plain = plain
+	dr.index++
+	dr.done = last
+	return nil
+}
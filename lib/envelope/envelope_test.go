@@ -0,0 +1,93 @@
+package envelope
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, 2*ChunkSize + 7} {
+		data := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(data)
+
+		er, info, err := Encrypt(bytes.NewReader(data), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.KeyID != KeyID(key) {
+			t.Fatalf("unexpected key id %s", info.KeyID)
+		}
+		sealed, err := ioutil.ReadAll(er)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEnvelope(sealed) {
+			t.Fatal("expected an envelope")
+		}
+
+		dr, err := Decrypt(bytes.NewReader(sealed), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(dr)
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("size %d: decrypted data differs", size)
+		}
+	}
+}
+
+func TestTampered(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 2*ChunkSize+7)
+	er, _, err := Encrypt(bytes.NewReader(data), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := ioutil.ReadAll(er)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypt := func(b []byte) error {
+		dr, err := Decrypt(bytes.NewReader(b), key)
+		if err != nil {
+			return err
+		}
+		_, err = ioutil.ReadAll(dr)
+		return err
+	}
+
+	flipped := append([]byte{}, sealed...)
+	flipped[len(flipped)/2] ^= 1
+	if decrypt(flipped) == nil {
+		t.Fatal("expected altered envelope to fail")
+	}
+
+	// drop the last chunk
+	truncated := sealed[:headerSize+2*(4+ChunkSize+16)]
+	if decrypt(truncated) == nil {
+		t.Fatal("expected truncated envelope to fail")
+	}
+
+	other, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(bytes.NewReader(sealed), other); err == nil {
+		t.Fatal("expected decrypting with another key to fail")
+	}
+}
@@ -1,6 +1,7 @@
 package incrt
 
 import (
+	"errors"
 	"io"
 	"time"
 
@@ -11,27 +12,86 @@ var log = logging.Logger("incrt")
 
 var now = time.Now
 
+// ErrTooLarge is returned when more than Config.MaxBytes are read
+var ErrTooLarge = errors.New("read size limit exceeded")
+
 type ReaderDeadline interface {
 	Read([]byte) (int, error)
 	SetReadDeadline(time.Time) error
 }
 
+// Config describes how slow a reader may be before reads time out.
+//
+// Every reader has a wait budget which starts at MaxWait. Time spent blocked
+// in Read is taken from the budget, and every byte read adds the time it
+// would take to transfer at MinSpeed, up to MaxWait. When the budget runs out
+// reads fail with a timeout error.
+type Config struct {
+	// MinSpeed is the minimum sustained speed in bytes per second
+	MinSpeed int64
+	// MaxWait is the longest a single read may block
+	MaxWait time.Duration
+
+	// Jitter is tolerated on top of the budget, so that a short stall, e.g.
+	// a retransmission on an otherwise fast stream, doesn't fail the read
+	// right away
+	Jitter time.Duration
+
+	// SizeHint is the expected size of the message being read, if known. For
+	// messages small enough to transfer within MaxWait at MinSpeed the speed
+	// floor is lowered, so that the whole message is always given about
+	// 2*MaxWait to arrive.
+	SizeHint int64
+
+	// MaxBytes limits the number of bytes read, reads past the limit fail
+	// with ErrTooLarge. Zero means no limit.
+	MaxBytes int64
+}
+
+// minSpeed returns the effective speed floor of the config
+func (c Config) minSpeed() int64 {
+	speed := c.MinSpeed
+	if c.SizeHint > 0 && c.MaxWait > 0 {
+		if s := int64(float64(c.SizeHint) / c.MaxWait.Seconds()); s < speed {
+			speed = s
+		}
+	}
+	if speed < 1 {
+		speed = 1
+	}
+	return speed
+}
+
 type incrt struct {
 	rd ReaderDeadline
 
 	waitPerByte time.Duration
 	wait        time.Duration
 	maxWait     time.Duration
+	jitter      time.Duration
+
+	read     int64
+	maxBytes int64
 }
 
 // New creates an Incremental Reader Timeout, with minimum sustained speed of
 // minSpeed bytes per second and with maximum wait of maxWait
 func New(rd ReaderDeadline, minSpeed int64, maxWait time.Duration) io.Reader {
+	return NewWithConfig(rd, Config{
+		MinSpeed: minSpeed,
+		MaxWait:  maxWait,
+	})
+}
+
+// NewWithConfig creates an Incremental Reader Timeout described by cfg
+func NewWithConfig(rd ReaderDeadline, cfg Config) io.Reader {
 	return &incrt{
 		rd:          rd,
-		waitPerByte: time.Second / time.Duration(minSpeed),
-		wait:        maxWait,
-		maxWait:     maxWait,
+		waitPerByte: time.Second / time.Duration(cfg.minSpeed()),
+		wait:        cfg.MaxWait,
+		maxWait:     cfg.MaxWait,
+		jitter:      cfg.Jitter,
+		maxBytes:    cfg.MaxBytes,
 	}
 }
 
@@ -46,11 +106,11 @@ func (err errNoWait) Timeout() bool {
 
 func (crt *incrt) Read(buf []byte) (int, error) {
 	start := now()
-	if crt.wait == 0 {
+	if crt.wait+crt.jitter <= 0 {
 		return 0, errNoWait{}
 	}
 
-	err := crt.rd.SetReadDeadline(start.Add(crt.wait))
+	err := crt.rd.SetReadDeadline(start.Add(crt.wait + crt.jitter))
 	if err != nil {
 		log.Debugf("unable to set deadline: %+v", err)
 	}
@@ -58,12 +118,18 @@ func (crt *incrt) Read(buf []byte) (int, error) {
 	n, err := crt.rd.Read(buf)
 
 	_ = crt.rd.SetReadDeadline(time.Time{})
+
+	crt.read += int64(n)
+	if crt.maxBytes > 0 && crt.read > crt.maxBytes {
+		return n, ErrTooLarge
+	}
+
 	if err == nil {
 		dur := now().Sub(start)
 		crt.wait -= dur
 		crt.wait += time.Duration(n) * crt.waitPerByte
-		if crt.wait < 0 {
-			crt.wait = 0
+		if crt.wait < -crt.jitter {
+			crt.wait = -crt.jitter
 		}
 		if crt.wait > crt.maxWait {
 			crt.wait = crt.maxWait
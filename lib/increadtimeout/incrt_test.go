@@ -0,0 +1,141 @@
+package incrt
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// testReader reads from a buffer, every read taking delay on the fake clock.
+// Reads which would end after the deadline fail.
+type testReader struct {
+	buf   *bytes.Buffer
+	clock *time.Time
+	delay time.Duration
+
+	deadline  time.Time
+	deadlines []time.Duration
+}
+
+func (r *testReader) Read(p []byte) (int, error) {
+	*r.clock = r.clock.Add(r.delay)
+	if !r.deadline.IsZero() && r.clock.After(r.deadline) {
+		return 0, errNoWait{}
+	}
+	return r.buf.Read(p)
+}
+
+func (r *testReader) SetReadDeadline(t time.Time) error {
+	r.deadline = t
+	if !t.IsZero() {
+		r.deadlines = append(r.deadlines, t.Sub(*r.clock))
+	}
+	return nil
+}
+
+func withClock(t *testing.T) *time.Time {
+	clock := time.Unix(0, 0)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+	return &clock
+}
+
+func TestJitter(t *testing.T) {
+	clock := withClock(t)
+
+	r := &testReader{buf: bytes.NewBuffer(make([]byte, 3)), clock: clock, delay: 1200 * time.Millisecond}
+	rd := NewWithConfig(r, Config{MinSpeed: 1000, MaxWait: time.Second, Jitter: 500 * time.Millisecond})
+
+	// a stall past the budget is tolerated within the jitter, and taken from
+	// the next reads
+	var b [1]byte
+	if _, err := rd.Read(b[:]); err != nil {
+		t.Fatal(err)
+	}
+	r.delay = 200 * time.Millisecond
+	if _, err := rd.Read(b[:]); err != nil {
+		t.Fatal(err)
+	}
+	expected := []time.Duration{1500 * time.Millisecond, 301 * time.Millisecond}
+	for i, d := range expected {
+		if r.deadlines[i] != d {
+			t.Fatalf("expected read %d to wait at most %s, got %s", i, d, r.deadlines[i])
+		}
+	}
+
+	// the budget is used up
+	r.delay = 200 * time.Millisecond
+	if _, err := rd.Read(b[:]); err == nil {
+		t.Fatal("expected the read past the budget to time out")
+	}
+
+	// without jitter, the stall fails the read
+	*clock = time.Unix(0, 0)
+	r = &testReader{buf: bytes.NewBuffer(make([]byte, 3)), clock: clock, delay: 1200 * time.Millisecond}
+	rd = NewWithConfig(r, Config{MinSpeed: 1000, MaxWait: time.Second})
+	if _, err := rd.Read(b[:]); err == nil {
+		t.Fatal("expected the stall to time out without jitter")
+	}
+}
+
+func TestSizeHint(t *testing.T) {
+	for _, tc := range []struct {
+		hint  int64
+		speed int64
+	}{
+		// no hint
+		{0, 1000},
+		// large messages are read at the configured speed
+		{1 << 20, 1000},
+		// small messages get about twice MaxWait
+		{100, 10},
+		{1, 1},
+	} {
+		cfg := Config{MinSpeed: 1000, MaxWait: 10 * time.Second, SizeHint: tc.hint}
+		if s := cfg.minSpeed(); s != tc.speed {
+			t.Errorf("hint %d: expected a speed floor of %d, got %d", tc.hint, tc.speed, s)
+		}
+	}
+
+	// a small message trickling in slower than MinSpeed is read with the
+	// hint, and times out without
+	clock := withClock(t)
+	read := func(hint int64) error {
+		r := &testReader{buf: bytes.NewBuffer(make([]byte, 100)), clock: clock, delay: 4 * time.Second}
+		rd := NewWithConfig(r, Config{MinSpeed: 1000, MaxWait: 10 * time.Second, SizeHint: hint})
+		for i := 0; i < 4; i++ {
+			if _, err := io.ReadFull(rd, make([]byte, 25)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := read(100); err != nil {
+		t.Fatal(err)
+	}
+	if err := read(0); err == nil {
+		t.Fatal("expected the slow message to time out without size hint")
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	withClock(t)
+
+	for _, tc := range []struct {
+		size int
+		err  error
+	}{
+		{10, nil},
+		{11, ErrTooLarge},
+	} {
+		r := &testReader{buf: bytes.NewBuffer(make([]byte, tc.size)), clock: new(time.Time)}
+		_, err := ioutil.ReadAll(NewWithConfig(r, Config{MinSpeed: 1000, MaxWait: time.Second, MaxBytes: 10}))
+		if !xerrors.Is(err, tc.err) {
+			t.Errorf("size %d: expected %v, got %v", tc.size, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package msgaudit keeps a tamper-evident log of the messages pushed through
+// the API of a node, for audits of custodial deployments.
+//
+// The log is an append-only file with one JSON record per line. A record
+// holds an entry and the HMAC-SHA256 of its JSON encoding, keyed with a secret
+// kept in the keystore of the node, and every entry holds the MAC of the
+// previous one, so that removed, reordered or altered entries break the chain
+// of MACs. Without the key, the log can't be rewritten with a valid chain.
+// The log is never pruned.
+package msgaudit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+var log = logging.Logger("msgaudit")
+
+// FileName is the name of the log file in the audit directory of the repo
+const FileName = "messages.ndjson"
+
+type Log struct {
+	lk sync.Mutex
+
+	key  []byte
+	f    *os.File
+	seq  uint64
+	prev string
+}
+
+// Open opens the log at path, creating it if needed. Entries are
+// authenticated with key, the chain of MACs of existing entries is verified.
+func Open(path string, key []byte) (*Log, error) {
+	if len(key) == 0 {
+		return nil, xerrors.New("no audit log key")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, xerrors.Errorf("opening audit log: %w", err)
+	}
+
+	records, end, err := read(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if fi.Size() > end {
+		// the last write was interrupted, the record was never acknowledged
+		log.Warnf("audit log %s ends with an incomplete record, removing it", path)
+		if err := f.Truncate(end); err != nil {
+			_ = f.Close()
+			return nil, xerrors.Errorf("removing incomplete record: %w", err)
+		}
+	}
+
+	if err := Verify(key, records); err != nil {
+		_ = f.Close()
+		return nil, xerrors.Errorf("audit log %s was tampered with: %w", path, err)
+	}
+
+	l := &Log{key: key, f: f}
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		e, err := decodeEntry(last)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		l.seq, l.prev = e.Seq, last.Hash
+	}
+
+	return l, nil
+}
+
+// Record appends the entry to the log. Seq and PrevHash are set by the log.
+func (l *Log) Record(e api.MessageAuditEntry) error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	e.Seq = l.seq + 1
+	e.PrevHash = l.prev
+
+	eb, err := json.Marshal(e)
+	if err != nil {
+		return xerrors.Errorf("marshaling entry: %w", err)
+	}
+	rec := api.MessageAuditRecord{Entry: eb, Hash: mac(l.key, eb)}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return xerrors.Errorf("marshaling record: %w", err)
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return xerrors.Errorf("writing record: %w", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return xerrors.Errorf("syncing audit log: %w", err)
+	}
+
+	l.seq, l.prev = e.Seq, rec.Hash
+	return nil
+}
+
+// Export returns the records of entries made between since and until, after
+// verifying the whole log. Zero times don't limit the range. Entries recorded
+// while the log is exported aren't included.
+func (l *Log) Export(since, until time.Time) ([]api.MessageAuditRecord, error) {
+	// the log is only read up to the last recorded entry, so that recording
+	// doesn't wait for the log to be verified
+	l.lk.Lock()
+	fi, err := l.f.Stat()
+	seq, head := l.seq, l.prev
+	l.lk.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(l.f.Name())
+	if err != nil {
+		return nil, xerrors.Errorf("opening audit log: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	records, _, err := read(io.LimitReader(f, fi.Size()))
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(l.key, records); err != nil {
+		return nil, xerrors.Errorf("audit log was tampered with: %w", err)
+	}
+	if (len(records) == 0 && seq != 0) || (len(records) > 0 && records[len(records)-1].Hash != head) {
+		return nil, xerrors.Errorf("audit log was tampered with: it doesn't end with entry %d", seq)
+	}
+
+	out := make([]api.MessageAuditRecord, 0, len(records))
+	for _, r := range records {
+		e, err := decodeEntry(r)
+		if err != nil {
+			return nil, err
+		}
+		if (!since.IsZero() && e.Time.Before(since)) || (!until.IsZero() && e.Time.After(until)) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// Verify checks the MACs of the records, and that they are chained. The
+// records must be consecutive, the first one may be preceded by records
+// which aren't given. Without a key, only the chain is checked.
+func Verify(key []byte, records []api.MessageAuditRecord) error {
+	for i, r := range records {
+		if len(key) > 0 && !hmac.Equal([]byte(mac(key, r.Entry)), []byte(r.Hash)) {
+			return xerrors.Errorf("record %d: the MAC of the entry doesn't match", i)
+		}
+		if i == 0 {
+			continue
+		}
+
+		e, err := decodeEntry(r)
+		if err != nil {
+			return xerrors.Errorf("record %d: %w", i, err)
+		}
+		prev, err := decodeEntry(records[i-1])
+		if err != nil {
+			return xerrors.Errorf("record %d: %w", i-1, err)
+		}
+
+		if e.Seq != prev.Seq+1 {
+			return xerrors.Errorf("record %d: entry %d follows entry %d", i, e.Seq, prev.Seq)
+		}
+		if e.PrevHash != records[i-1].Hash {
+			return xerrors.Errorf("entry %d doesn't link to entry %d", e.Seq, prev.Seq)
+		}
+	}
+	return nil
+}
+
+// read returns the records in r, and the length of the complete lines. An
+// incomplete last line, left by an interrupted write, is skipped.
+func read(r io.Reader) ([]api.MessageAuditRecord, int64, error) {
+	var out []api.MessageAuditRecord
+	var end int64
+
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return out, end, nil
+		}
+		if err != nil {
+			return nil, 0, xerrors.Errorf("reading audit log: %w", err)
+		}
+		end += int64(len(line))
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec api.MessageAuditRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, 0, xerrors.Errorf("parsing line %d of the audit log: %w", n, err)
+		}
+		out = append(out, rec)
+	}
+}
+
+func decodeEntry(r api.MessageAuditRecord) (*api.MessageAuditEntry, error) {
+	var e api.MessageAuditEntry
+	if err := json.Unmarshal(r.Entry, &e); err != nil {
+		return nil, xerrors.Errorf("parsing entry: %w", err)
+	}
+	return &e, nil
+}
+
+func mac(key, b []byte) string {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,205 @@
+package msgaudit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+func testLog(t *testing.T, dir string, key []byte, methods ...string) (string, *Log) {
+	path := filepath.Join(dir, FileName)
+	l, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range methods {
+		if err := l.Record(api.MessageAuditEntry{
+			Time:   time.Unix(int64(1000+i), 0),
+			Method: m,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path, l
+}
+
+func TestLogReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgaudit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	key := []byte("audit key")
+	path, l := testLog(t, dir, key, "MpoolPush", "MpoolPushMessage")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close() //nolint:errcheck
+
+	if err := l.Record(api.MessageAuditEntry{Time: time.Unix(1002, 0), Method: "MpoolCancel"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := l.Export(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	last, err := decodeEntry(records[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Seq != 3 || last.PrevHash != records[1].Hash {
+		t.Fatalf("entry isn't chained after reopening: seq %d", last.Seq)
+	}
+
+	// ranges are inclusive
+	records, err = l.Export(time.Unix(1001, 0), time.Unix(1001, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record in range, got %d", len(records))
+	}
+	if err := Verify(key, records); err != nil {
+		t.Fatalf("expected a range of records to verify: %s", err)
+	}
+}
+
+func TestLogTampering(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgaudit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	key := []byte("audit key")
+	path, l := testLog(t, dir, key, "MpoolPush", "MpoolPush", "MpoolPush")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path, []byte("other key")); err == nil {
+		t.Fatal("expected a log authenticated with another key to be refused")
+	}
+
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, _, err := read(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the chain is checked without the key
+	if err := Verify(nil, records); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(nil, []api.MessageAuditRecord{records[0], records[2]}); err == nil {
+		t.Fatal("expected a removed record to break the chain")
+	}
+	if err := Verify(nil, []api.MessageAuditRecord{records[1], records[0]}); err == nil {
+		t.Fatal("expected reordered records to break the chain")
+	}
+
+	altered := bytes.Replace(orig, []byte("MpoolPush"), []byte("MpoolPusH"), 1)
+	if err := ioutil.WriteFile(path, altered, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, key); err == nil {
+		t.Fatal("expected an altered entry to be detected")
+	}
+
+	// an interrupted write is removed
+	if err := ioutil.WriteFile(path, append(orig, []byte(`{"Entry":`)...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l, err = Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close() //nolint:errcheck
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(len(orig)) {
+		t.Fatalf("expected the incomplete record to be removed, the log has %d bytes instead of %d", fi.Size(), len(orig))
+	}
+}
+
+func TestExportWhileRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgaudit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	key := []byte("audit key")
+	path, l := testLog(t, dir, key, "MpoolPush")
+	defer l.Close() //nolint:errcheck
+
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 50; i++ {
+			if err := l.Record(api.MessageAuditEntry{Time: time.Unix(2000, 0), Method: "MpoolPushMessage"}); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	// exports see a consistent prefix of the log
+	prev := 1
+	for i := 0; i < 20; i++ {
+		records, err := l.Export(time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) < prev {
+			t.Fatalf("expected at least %d records, got %d", prev, len(records))
+		}
+		prev = len(records)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := l.Export(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 51 {
+		t.Fatalf("expected 51 records, got %d", len(records))
+	}
+
+	// removing the last entries is detected, even though the rest of the
+	// chain is valid
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	if err := ioutil.WriteFile(path, bytes.Join(lines[:len(lines)-2], nil), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Export(time.Time{}, time.Time{}); err == nil {
+		t.Fatal("expected the removed entries to be detected")
+	}
+}
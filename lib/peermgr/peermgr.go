@@ -2,6 +2,7 @@ package peermgr
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
 
@@ -25,6 +26,29 @@ const (
 	MinFilPeers = 12
 )
 
+const (
+	// syncTag is the connection manager tag carrying the sync quality of a
+	// peer, peers with higher values are kept longer when trimming
+	syncTag    = "fcsync"
+	syncTagMax = 50
+
+	// syncAlpha is the weight of the latest result in the moving averages
+	syncAlpha = 0.2
+	// minSyncSamples is the number of results needed before a peer can be
+	// disconnected for serving chain data poorly
+	minSyncSamples = 5
+	// poorSuccessRate is the success rate below which peers are disconnected
+	// when there are more than maxFilPeers
+	poorSuccessRate = 0.5
+)
+
+// syncQuality tracks how well a peer serves chain data
+type syncQuality struct {
+	samples     int
+	successRate float64
+	latency     time.Duration
+}
+
 type MaybePeerMgr struct {
 	fx.In
 
@@ -40,6 +64,7 @@ type PeerMgr struct {
 
 	peersLk sync.Mutex
 	peers   map[peer.ID]time.Duration
+	quality map[peer.ID]*syncQuality
 
 	maxFilPeers int
 	minFilPeers int
@@ -59,6 +84,7 @@ func NewPeerMgr(h host.Host, dht *dht.IpfsDHT, bootstrap dtypes.BootstrapPeers)
 		bootstrappers: bootstrap,
 
 		peers:     make(map[peer.ID]time.Duration),
+		quality:   make(map[peer.ID]*syncQuality),
 		expanding: make(chan struct{}, 1),
 
 		maxFilPeers: MaxFilPeers,
@@ -98,11 +124,36 @@ func (pmgr *PeerMgr) SetPeerLatency(p peer.ID, latency time.Duration) {
 
 }
 
+// ReportSyncResult records the outcome of a chain sync request to a peer. The
+// quality of peers decides which connections are kept when there are too many.
+func (pmgr *PeerMgr) ReportSyncResult(p peer.ID, success bool, latency time.Duration) {
+	pmgr.peersLk.Lock()
+	q, ok := pmgr.quality[p]
+	if !ok {
+		q = &syncQuality{successRate: 1, latency: latency}
+		pmgr.quality[p] = q
+	}
+
+	res := 0.0
+	if success {
+		res = 1
+	}
+	q.samples++
+	q.successRate += (res - q.successRate) * syncAlpha
+	q.latency += time.Duration(float64(latency-q.latency) * syncAlpha)
+
+	tag := int(q.successRate * syncTagMax)
+	pmgr.peersLk.Unlock()
+
+	pmgr.h.ConnManager().TagPeer(p, syncTag, tag)
+}
+
 func (pmgr *PeerMgr) Disconnect(p peer.ID) {
 	if pmgr.h.Network().Connectedness(p) == net.NotConnected {
 		pmgr.peersLk.Lock()
 		defer pmgr.peersLk.Unlock()
 		delete(pmgr.peers, p)
+		delete(pmgr.quality, p)
 	}
 }
 
@@ -115,7 +166,8 @@ func (pmgr *PeerMgr) Run(ctx context.Context) {
 			if pcount < pmgr.minFilPeers {
 				pmgr.expandPeers()
 			} else if pcount > pmgr.maxFilPeers {
-				log.Debug("peer count about threshold: %d > %d", pcount, pmgr.maxFilPeers)
+				log.Debugf("peer count about threshold: %d > %d", pcount, pmgr.maxFilPeers)
+				pmgr.trimPoorPeers()
 			}
 			stats.Record(ctx, metrics.PeerCount.M(int64(pmgr.getPeerCount())))
 		}
@@ -128,6 +180,40 @@ func (pmgr *PeerMgr) getPeerCount() int {
 	return len(pmgr.peers)
 }
 
+// trimPoorPeers disconnects peers which consistently fail to serve chain data,
+// worst first, until the peer count is back at maxFilPeers. Peers without
+// enough sync results are kept.
+func (pmgr *PeerMgr) trimPoorPeers() {
+	pmgr.peersLk.Lock()
+	excess := len(pmgr.peers) - pmgr.maxFilPeers
+
+	var poor []peer.ID
+	for p := range pmgr.peers {
+		q, ok := pmgr.quality[p]
+		if ok && q.samples >= minSyncSamples && q.successRate < poorSuccessRate {
+			poor = append(poor, p)
+		}
+	}
+	sort.Slice(poor, func(i, j int) bool {
+		qi, qj := pmgr.quality[poor[i]], pmgr.quality[poor[j]]
+		if qi.successRate != qj.successRate {
+			return qi.successRate < qj.successRate
+		}
+		return qi.latency > qj.latency
+	})
+	pmgr.peersLk.Unlock()
+
+	if excess < len(poor) {
+		poor = poor[:excess]
+	}
+	for _, p := range poor {
+		log.Infow("disconnecting peer serving chain data poorly", "peer", p)
+		if err := pmgr.h.Network().ClosePeer(p); err != nil {
+			log.Warnf("closing connection to %s: %s", p, err)
+		}
+	}
+}
+
 func (pmgr *PeerMgr) expandPeers() {
 	select {
 	case pmgr.expanding <- struct{}{}:
@@ -0,0 +1,131 @@
+package peermgr
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/connmgr"
+	host "github.com/libp2p/go-libp2p-core/host"
+	net "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+type testHost struct {
+	host.Host
+
+	cm  *testConnMgr
+	net *testNetwork
+}
+
+func (h *testHost) ConnManager() connmgr.ConnManager { return h.cm }
+func (h *testHost) Network() net.Network             { return h.net }
+
+type testConnMgr struct {
+	connmgr.ConnManager
+
+	tags map[peer.ID]int
+}
+
+func (cm *testConnMgr) TagPeer(p peer.ID, tag string, v int) {
+	if tag == syncTag {
+		cm.tags[p] = v
+	}
+}
+
+type testNetwork struct {
+	net.Network
+
+	closed []peer.ID
+}
+
+func (n *testNetwork) ClosePeer(p peer.ID) error {
+	n.closed = append(n.closed, p)
+	return nil
+}
+
+func newTestPeerMgr() (*PeerMgr, *testHost) {
+	h := &testHost{
+		cm:  &testConnMgr{tags: map[peer.ID]int{}},
+		net: &testNetwork{},
+	}
+	return &PeerMgr{
+		h:           h,
+		peers:       map[peer.ID]time.Duration{},
+		quality:     map[peer.ID]*syncQuality{},
+		maxFilPeers: MaxFilPeers,
+		minFilPeers: MinFilPeers,
+	}, h
+}
+
+func TestReportSyncResult(t *testing.T) {
+	pm, h := newTestPeerMgr()
+	p := peer.ID("a")
+
+	expect := func(tag int, rate float64, latency time.Duration) {
+		t.Helper()
+		q := pm.quality[p]
+		if h.cm.tags[p] != tag || math.Abs(q.successRate-rate) > 1e-9 || q.latency != latency {
+			t.Fatalf("expected tag %d, success rate %f and latency %s, got %d, %f and %s", tag, rate, latency, h.cm.tags[p], q.successRate, q.latency)
+		}
+	}
+
+	// peers start out trusted, at the latency of their first result
+	pm.ReportSyncResult(p, true, time.Second)
+	expect(syncTagMax, 1, time.Second)
+
+	pm.ReportSyncResult(p, false, 2*time.Second)
+	expect(40, 0.8, 1200*time.Millisecond)
+
+	pm.ReportSyncResult(p, true, 1200*time.Millisecond)
+	expect(42, 0.84, 1200*time.Millisecond)
+
+	if pm.quality[p].samples != 3 {
+		t.Fatalf("expected 3 samples, got %d", pm.quality[p].samples)
+	}
+}
+
+func TestTrimPoorPeers(t *testing.T) {
+	pm, h := newTestPeerMgr()
+
+	report := func(p peer.ID, success bool, n int, latency time.Duration) {
+		pm.AddFilecoinPeer(p)
+		for i := 0; i < n; i++ {
+			pm.ReportSyncResult(p, success, latency)
+		}
+	}
+	report("good", true, minSyncSamples, time.Second)
+	// too few results to tell
+	report("new", false, minSyncSamples-1, time.Second)
+	report("poor", false, minSyncSamples, time.Second)
+	report("slow", false, minSyncSamples, 2*time.Second)
+	report("worst", false, minSyncSamples+1, time.Second)
+
+	expect := func(closed ...peer.ID) {
+		t.Helper()
+		if len(h.net.closed) != len(closed) {
+			t.Fatalf("expected %v to be disconnected, got %v", closed, h.net.closed)
+		}
+		for i, p := range closed {
+			if h.net.closed[i] != p {
+				t.Fatalf("expected %v to be disconnected, got %v", closed, h.net.closed)
+			}
+		}
+	}
+
+	// nothing is trimmed below the limit
+	pm.maxFilPeers = 5
+	pm.trimPoorPeers()
+	expect()
+
+	// the worst peers go first, the slower ones at the same success rate
+	pm.maxFilPeers = 3
+	pm.trimPoorPeers()
+	expect("worst", "slow")
+
+	// only poor peers with enough results are disconnected
+	h.net.closed = nil
+	pm.maxFilPeers = 1
+	pm.trimPoorPeers()
+	expect("worst", "slow", "poor")
+}
@@ -0,0 +1,336 @@
+// Package rpctls secures the RPC links between the storage miner and its
+// workers with mutual TLS.
+//
+// The miner holds a certificate authority, and issues a certificate to itself
+// and to every worker. Both ends of a connection present their certificate and
+// only accept peers with a certificate of the same authority, so that a leaked
+// API token alone isn't enough to talk to a miner or a worker.
+//
+// The certificates of a node are kept in the DirName directory of its repo.
+// Endpoints serving TLS are announced with a trailing /https component in
+// their API multiaddr, and their sector storage URLs use TransferScheme.
+package rpctls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/multiformats/go-multiaddr"
+	"golang.org/x/xerrors"
+)
+
+// DirName is the directory in the repo holding the certificates
+const DirName = "tls"
+
+const (
+	caCertFile = "ca.crt"
+	caKeyFile  = "ca.key"
+	certFile   = "node.crt"
+	keyFile    = "node.key"
+)
+
+var (
+	CAValidity   = 10 * 365 * 24 * time.Hour
+	CertValidity = 365 * 24 * time.Hour
+)
+
+// Exists returns true if dir holds a certificate issued to the node
+func Exists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, certFile))
+	return err == nil
+}
+
+// InitCA creates a new certificate authority in dir
+func InitCA(dir string, name string) error {
+	if _, err := os.Stat(filepath.Join(dir, caKeyFile)); err == nil {
+		return xerrors.Errorf("certificate authority already exists in %s", dir)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return xerrors.Errorf("generating CA key: %w", err)
+	}
+
+	tmpl, err := template(name, CAValidity)
+	if err != nil {
+		return err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return xerrors.Errorf("creating CA certificate: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := writeKey(filepath.Join(dir, caKeyFile), key); err != nil {
+		return err
+	}
+	return writeCert(filepath.Join(dir, caCertFile), der)
+}
+
+// Issue creates a key and a certificate signed by the authority in caDir, and
+// writes them to outDir together with the certificate of the authority. The
+// certificate is valid for the given hosts, which are IPs or DNS names, and
+// can be used both to serve and to connect.
+func Issue(caDir string, outDir string, name string, hosts []string) error {
+	ca, caKey, err := loadCA(caDir)
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return xerrors.Errorf("generating key: %w", err)
+	}
+
+	tmpl, err := template(name, CertValidity)
+	if err != nil {
+		return err
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return xerrors.Errorf("creating certificate: %w", err)
+	}
+
+	if err := os.MkdirAll(outDir, 0700); err != nil {
+		return err
+	}
+	if err := writeKey(filepath.Join(outDir, keyFile), key); err != nil {
+		return err
+	}
+	if err := writeCert(filepath.Join(outDir, certFile), der); err != nil {
+		return err
+	}
+	if filepath.Clean(caDir) == filepath.Clean(outDir) {
+		return nil
+	}
+	return writeCert(filepath.Join(outDir, caCertFile), ca.Raw)
+}
+
+// ServerConfig returns the TLS config of an RPC server, which requires
+// clients to present a certificate of the authority.
+func ServerConfig(dir string) (*tls.Config, error) {
+	cert, pool, err := load(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientConfig returns the TLS config of RPC clients. It only trusts servers
+// with a certificate of the authority, and presents the certificate of the
+// node to them.
+func ClientConfig(dir string) (*tls.Config, error) {
+	cert, pool, err := load(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Dialer returns a websocket dialer connecting to RPC servers with the config
+func Dialer(cfg *tls.Config) *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	d.TLSClientConfig = cfg
+	return &d
+}
+
+// Transport returns an http transport connecting to RPC servers with the
+// config
+func Transport(cfg *tls.Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = cfg
+	return t
+}
+
+// TransferScheme is the URL scheme of the sector storage endpoints serving
+// TLS. Sector storage transfers sectors with the default http client, which
+// sends requests of this scheme over https with the transport installed by
+// InstallClient, and keeps handling plain https URLs as before.
+const TransferScheme = "lotus-https"
+
+var transfers = &transferTransport{}
+
+// InstallClient makes the jsonrpc clients and sector transfers connect with
+// the client TLS config.
+//
+// The jsonrpc client has no dialer option and always dials with the default
+// websocket dialer, which is replaced with Dialer(cfg). Only connections to
+// wss:// endpoints are affected, and the RPC servers are the only endpoints
+// the processes installing the config dial over wss. The default http
+// transport is left as is, and only gets TransferScheme registered, so other
+// HTTPS clients of the process, e.g. paramfetch and drand, keep trusting the
+// system roots.
+func InstallClient(cfg *tls.Config) {
+	websocket.DefaultDialer = Dialer(cfg)
+	transfers.set(Transport(cfg))
+}
+
+// transferTransport sends TransferScheme requests over https
+type transferTransport struct {
+	lk sync.Mutex
+	t  *http.Transport
+}
+
+func (tt *transferTransport) set(t *http.Transport) {
+	tt.lk.Lock()
+	defer tt.lk.Unlock()
+
+	if tt.t == nil {
+		http.DefaultTransport.(*http.Transport).RegisterProtocol(TransferScheme, tt)
+	}
+	tt.t = t
+}
+
+func (tt *transferTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tt.lk.Lock()
+	t := tt.t
+	tt.lk.Unlock()
+
+	r := req.Clone(req.Context())
+	r.URL.Scheme = "https"
+	return t.RoundTrip(r)
+}
+
+var httpsComponent = multiaddr.StringCast("/https")
+
+// SplitAddr strips the /https component off an API multiaddr, and returns
+// whether the endpoint serves TLS.
+func SplitAddr(ma multiaddr.Multiaddr) (multiaddr.Multiaddr, bool) {
+	protos := ma.Protocols()
+	if len(protos) == 0 || protos[len(protos)-1].Code != multiaddr.P_HTTPS {
+		return ma, false
+	}
+	return ma.Decapsulate(httpsComponent), true
+}
+
+func template(name string, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, xerrors.Errorf("generating serial number: %w", err)
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"lotus"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+	}, nil
+}
+
+func load(dir string) (tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, certFile), filepath.Join(dir, keyFile))
+	if err != nil {
+		return tls.Certificate{}, nil, xerrors.Errorf("loading certificate: %w", err)
+	}
+
+	caPEM, err := ioutil.ReadFile(filepath.Join(dir, caCertFile))
+	if err != nil {
+		return tls.Certificate{}, nil, xerrors.Errorf("reading CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return tls.Certificate{}, nil, xerrors.Errorf("no certificates in %s", filepath.Join(dir, caCertFile))
+	}
+
+	return cert, pool, nil
+}
+
+func loadCACert(dir string) (*x509.Certificate, error) {
+	certPEM, err := ioutil.ReadFile(filepath.Join(dir, caCertFile))
+	if err != nil {
+		return nil, xerrors.Errorf("reading CA certificate: %w", err)
+	}
+	b, _ := pem.Decode(certPEM)
+	if b == nil {
+		return nil, xerrors.New("CA certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(b.Bytes)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing CA certificate: %w", err)
+	}
+	return cert, nil
+}
+
+func loadCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	cert, err := loadCACert(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := ioutil.ReadFile(filepath.Join(dir, caKeyFile))
+	if err != nil {
+		return nil, nil, xerrors.Errorf("reading CA key (only the miner holds it): %w", err)
+	}
+	b, _ := pem.Decode(keyPEM)
+	if b == nil {
+		return nil, nil, xerrors.New("CA key is not PEM encoded")
+	}
+	key, err := x509.ParseECPrivateKey(b.Bytes)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("parsing CA key: %w", err)
+	}
+
+	return cert, key, nil
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return xerrors.Errorf("marshaling key: %w", err)
+	}
+	b := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return xerrors.Errorf("writing key: %w", err)
+	}
+	return nil
+}
+
+func writeCert(path string, der []byte) error {
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return xerrors.Errorf("writing certificate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package rpctls
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// issue creates a certificate authority and a certificate issued by it for
+// each of the names, returning the directory of each certificate
+func issue(t *testing.T, root string, ca string, names ...string) []string {
+	t.Helper()
+
+	caDir := filepath.Join(root, ca)
+	if err := InitCA(caDir, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	var dirs []string
+	for _, name := range names {
+		dir := filepath.Join(root, ca+"-"+name)
+		if err := Issue(caDir, dir, name, []string{"127.0.0.1"}); err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func serve(t *testing.T, dir string) *httptest.Server {
+	t.Helper()
+
+	cfg, err := ServerConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	return srv
+}
+
+func get(t *testing.T, dir string, url string) error {
+	t.Helper()
+
+	cfg, err := ClientConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &http.Client{Transport: Transport(cfg)}
+	resp, err := c.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	_, err = ioutil.ReadAll(resp.Body)
+	return err
+}
+
+func TestHandshake(t *testing.T) {
+	root, err := ioutil.TempDir("", "rpctls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root) //nolint:errcheck
+
+	dirs := issue(t, root, "ca", "server", "client")
+	foreign := issue(t, root, "foreign", "server", "client")
+
+	srv := serve(t, dirs[0])
+	defer srv.Close()
+
+	if err := get(t, dirs[1], srv.URL); err != nil {
+		t.Fatalf("expected a client of the authority to connect: %+v", err)
+	}
+
+	// the client doesn't trust servers of another authority
+	fsrv := serve(t, foreign[0])
+	defer fsrv.Close()
+	if err := get(t, dirs[1], fsrv.URL); err == nil {
+		t.Fatal("expected the client to reject a server of a foreign authority")
+	}
+
+	// the server doesn't accept clients of another authority, even trusting it
+	caPEM, err := ioutil.ReadFile(filepath.Join(dirs[1], caCertFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(foreign[1], caCertFile), caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(t, foreign[1], srv.URL); err == nil {
+		t.Fatal("expected the server to reject a client of a foreign authority")
+	}
+}
+
+func TestInstallClient(t *testing.T) {
+	root, err := ioutil.TempDir("", "rpctls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root) //nolint:errcheck
+
+	dirs := issue(t, root, "ca", "server", "client")
+
+	srv := serve(t, dirs[0])
+	defer srv.Close()
+
+	cfg, err := ClientConfig(dirs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	InstallClient(cfg)
+
+	// sector transfers connect with the certificate
+	resp, err := http.Get(strings.Replace(srv.URL, "https", TransferScheme, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	// while plain https keeps using the system roots
+	if _, err := http.Get(srv.URL); err == nil {
+		t.Fatal("expected the default client not to trust the authority")
+	}
+}
@@ -48,6 +48,48 @@ func Verify(sig *crypto.Signature, addr address.Address, msg []byte) error {
 	return sv.Verify(sig.Data, addr, msg)
 }
 
+// AddressSigType returns the type of the signatures made by the key of the
+// address. Only secp256k1 and bls addresses have keys.
+func AddressSigType(addr address.Address) (crypto.SigType, error) {
+	switch addr.Protocol() {
+	case address.SECP256K1:
+		return crypto.SigTypeSecp256k1, nil
+	case address.BLS:
+		return crypto.SigTypeBLS, nil
+	default:
+		return 0, xerrors.Errorf("%s addresses don't sign", ProtocolName(addr.Protocol()))
+	}
+}
+
+// CheckSigType checks that the signature is of the type made by the key of
+// the address. ID addresses must be resolved to their key first.
+func CheckSigType(sig *crypto.Signature, addr address.Address) error {
+	typ, err := AddressSigType(addr)
+	if err != nil {
+		return err
+	}
+	if typ != sig.Type {
+		return xerrors.Errorf("signature type %d doesn't match the %s address", sig.Type, ProtocolName(addr.Protocol()))
+	}
+	return nil
+}
+
+// ProtocolName returns a name for the address protocol
+func ProtocolName(p address.Protocol) string {
+	switch p {
+	case address.ID:
+		return "id"
+	case address.SECP256K1:
+		return "secp256k1"
+	case address.Actor:
+		return "actor"
+	case address.BLS:
+		return "bls"
+	default:
+		return fmt.Sprintf("unknown(%d)", p)
+	}
+}
+
 // Generate generates private key of given type
 func Generate(sigType crypto.SigType) ([]byte, error) {
 	sv, ok := sigs[sigType]
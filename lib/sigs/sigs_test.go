@@ -0,0 +1,63 @@
+package sigs
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+)
+
+func TestCheckSigType(t *testing.T) {
+	id, err := address.NewIDAddress(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secp, err := address.NewSecp256k1Address([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	actor, err := address.NewActorAddress([]byte("actor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bls, err := address.NewBLSAddress(make([]byte, 48)) // a public key is 48 bytes
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		addr address.Address
+		name string
+		// signs is set for the addresses of keys, typ is the type they sign
+		signs bool
+		typ   crypto.SigType
+	}{
+		{addr: id, name: "id"},
+		{addr: secp, name: "secp256k1", signs: true, typ: crypto.SigTypeSecp256k1},
+		{addr: actor, name: "actor"},
+		{addr: bls, name: "bls", signs: true, typ: crypto.SigTypeBLS},
+	} {
+		if name := ProtocolName(tc.addr.Protocol()); name != tc.name {
+			t.Errorf("%s: expected protocol name %q, got %q", tc.addr, tc.name, name)
+		}
+
+		typ, err := AddressSigType(tc.addr)
+		if tc.signs != (err == nil) {
+			t.Errorf("%s: expected the address to sign: %t, got error %v", tc.name, tc.signs, err)
+		}
+		if tc.signs && typ != tc.typ {
+			t.Errorf("%s: expected signature type %d, got %d", tc.name, tc.typ, typ)
+		}
+
+		for _, st := range []crypto.SigType{crypto.SigTypeSecp256k1, crypto.SigTypeBLS} {
+			err := CheckSigType(&crypto.Signature{Type: st}, tc.addr)
+			if ok := tc.signs && st == tc.typ; ok != (err == nil) {
+				t.Errorf("%s: signature type %d: expected it to match: %t, got error %v", tc.name, st, ok, err)
+			}
+		}
+	}
+
+	if name := ProtocolName(address.Protocol(9)); name != "unknown(9)" {
+		t.Errorf("expected unknown protocols to be named by number, got %q", name)
+	}
+}
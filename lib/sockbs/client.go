@@ -0,0 +1,288 @@
+package sockbs
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"golang.org/x/xerrors"
+)
+
+// DefaultCacheSize is the number of objects clients cache by default
+const DefaultCacheSize = 16 << 10
+
+// Client is a read only blockstore reading from a Server. Read objects are
+// cached, until the server reports them removed. The client reconnects when
+// the connection fails, and drops its cache, as it may have missed removals.
+type Client struct {
+	path  string
+	cache *lru.ARCCache
+
+	// removals counts the removal notifications, objects read while one was
+	// received aren't cached
+	removals uint64
+
+	lk   sync.Mutex
+	conn *clientConn
+}
+
+var _ bstore.Blockstore = (*Client)(nil)
+
+type clientConn struct {
+	conn net.Conn
+
+	wlk sync.Mutex
+	w   *bufio.Writer
+
+	lk      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan frame
+	err     error
+}
+
+// Dial connects to the server listening on the unix socket at path
+func Dial(path string, cacheSize int) (*Client, error) {
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+	cache, err := lru.NewARC(cacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		path:  path,
+		cache: cache,
+	}
+	if _, err := c.getConn(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) getConn() (*clientConn, error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	conn, err := net.Dial("unix", c.path)
+	if err != nil {
+		return nil, xerrors.Errorf("connecting to the shared blockstore: %w", err)
+	}
+
+	cc := &clientConn{
+		conn:    conn,
+		w:       bufio.NewWriter(conn),
+		pending: map[uint64]chan frame{},
+	}
+	c.conn = cc
+	go c.readLoop(cc)
+	return cc, nil
+}
+
+func (c *Client) readLoop(cc *clientConn) {
+	r := bufio.NewReader(cc.conn)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			c.connFailed(cc, err)
+			return
+		}
+
+		switch f.kind {
+		case kindResponse:
+			cc.lk.Lock()
+			ch, ok := cc.pending[f.id]
+			delete(cc.pending, f.id)
+			cc.lk.Unlock()
+
+			if ok {
+				ch <- f
+			}
+		case kindRemoved:
+			atomic.AddUint64(&c.removals, 1)
+			if err := c.evict(f.payload); err != nil {
+				c.connFailed(cc, err)
+				return
+			}
+		default:
+			log.Warnw("unknown shared blockstore message", "kind", f.kind)
+		}
+	}
+}
+
+func (c *Client) evict(payload []byte) error {
+	for len(payload) > 0 {
+		l, n := binary.Uvarint(payload)
+		if n <= 0 || uint64(len(payload)-n) < l {
+			return xerrors.Errorf("invalid removal notification")
+		}
+		rc, err := cid.Cast(payload[n : n+int(l)])
+		if err != nil {
+			return xerrors.Errorf("invalid removed cid: %w", err)
+		}
+		c.cache.Remove(string(rc.Hash()))
+		payload = payload[n+int(l):]
+	}
+	return nil
+}
+
+func (c *Client) connFailed(cc *clientConn, err error) {
+	c.lk.Lock()
+	if c.conn == cc {
+		c.conn = nil
+		c.cache.Purge()
+		atomic.AddUint64(&c.removals, 1)
+	}
+	c.lk.Unlock()
+
+	_ = cc.conn.Close()
+
+	cc.lk.Lock()
+	if cc.err == nil {
+		cc.err = xerrors.Errorf("shared blockstore connection failed: %w", err)
+	}
+	for id, ch := range cc.pending {
+		close(ch)
+		delete(cc.pending, id)
+	}
+	cc.lk.Unlock()
+}
+
+// request sends a request for the object, and returns the response payload
+// after the status
+func (c *Client) request(kind byte, oc cid.Cid) ([]byte, error) {
+	cc, err := c.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan frame, 1)
+	cc.lk.Lock()
+	if cc.err != nil {
+		cc.lk.Unlock()
+		return nil, cc.err
+	}
+	id := cc.nextID
+	cc.nextID++
+	cc.pending[id] = ch
+	cc.lk.Unlock()
+
+	cc.wlk.Lock()
+	err = writeFrame(cc.w, frame{kind: kind, id: id, payload: oc.Bytes()})
+	if err == nil {
+		err = cc.w.Flush()
+	}
+	cc.wlk.Unlock()
+	if err != nil {
+		c.connFailed(cc, err)
+		return nil, xerrors.Errorf("sending shared blockstore request: %w", err)
+	}
+
+	resp, ok := <-ch
+	if !ok {
+		cc.lk.Lock()
+		defer cc.lk.Unlock()
+		return nil, cc.err
+	}
+	if len(resp.payload) == 0 {
+		return nil, xerrors.Errorf("empty shared blockstore response")
+	}
+
+	switch resp.payload[0] {
+	case statusOK:
+		return resp.payload[1:], nil
+	case statusNotFound:
+		return nil, bstore.ErrNotFound
+	default:
+		return nil, xerrors.Errorf("shared blockstore: %s", string(resp.payload[1:]))
+	}
+}
+
+func (c *Client) Get(oc cid.Cid) (block.Block, error) {
+	if b, ok := c.cache.Get(string(oc.Hash())); ok {
+		return block.NewBlockWithCid(b.([]byte), oc)
+	}
+
+	removals := atomic.LoadUint64(&c.removals)
+	data, err := c.request(kindGet, oc)
+	if err != nil {
+		return nil, err
+	}
+
+	// the object may have been removed while it was read
+	if atomic.LoadUint64(&c.removals) == removals {
+		c.cache.Add(string(oc.Hash()), data)
+	}
+	return block.NewBlockWithCid(data, oc)
+}
+
+func (c *Client) GetSize(oc cid.Cid) (int, error) {
+	if b, ok := c.cache.Get(string(oc.Hash())); ok {
+		return len(b.([]byte)), nil
+	}
+
+	data, err := c.request(kindGetSize, oc)
+	if err != nil {
+		return -1, err
+	}
+	size, n := binary.Uvarint(data)
+	if n <= 0 {
+		return -1, xerrors.Errorf("invalid size response")
+	}
+	return int(size), nil
+}
+
+func (c *Client) Has(oc cid.Cid) (bool, error) {
+	if c.cache.Contains(string(oc.Hash())) {
+		return true, nil
+	}
+
+	data, err := c.request(kindHas, oc)
+	if err != nil {
+		return false, err
+	}
+	return len(data) > 0 && data[0] == 1, nil
+}
+
+func (c *Client) Put(block.Block) error {
+	return xerrors.New("the shared blockstore is read only")
+}
+
+func (c *Client) PutMany([]block.Block) error {
+	return xerrors.New("the shared blockstore is read only")
+}
+
+func (c *Client) DeleteBlock(cid.Cid) error {
+	return xerrors.New("the shared blockstore is read only")
+}
+
+func (c *Client) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	return nil, xerrors.New("not supported")
+}
+
+// HashOnRead is a noop, the server checks the objects it reads
+func (c *Client) HashOnRead(enabled bool) {
+}
+
+func (c *Client) Close() error {
+	c.lk.Lock()
+	cc := c.conn
+	c.conn = nil
+	c.lk.Unlock()
+
+	if cc == nil {
+		return nil
+	}
+	return cc.conn.Close()
+}
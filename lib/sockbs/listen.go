@@ -0,0 +1,53 @@
+package sockbs
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+)
+
+// Listen listens on a unix socket at path, which only the current user can
+// connect to. The socket is created in a private directory, and moved to path
+// once its permissions are set, so that no other user can connect in between.
+// The socket is removed when the listener is closed.
+func Listen(path string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".sockbs")
+	if err != nil {
+		return nil, xerrors.Errorf("creating socket directory: %w", err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	tmp := filepath.Join(dir, "sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmp, 0600); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = l.Close()
+		return nil, xerrors.Errorf("moving socket into place: %w", err)
+	}
+
+	return &listener{UnixListener: l, path: path}, nil
+}
+
+type listener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *listener) Close() error {
+	err := l.UnixListener.Close()
+	if rerr := os.Remove(l.path); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+// Package sockbs shares a blockstore with other processes on the same machine
+// over a unix socket, so that they can read objects without a copy of the
+// data, or a round-trip through the API.
+//
+// Messages are frames of a uvarint length, followed by the message kind, a
+// uvarint request ID, and the payload. Requests are answered in any order.
+// The server also sends the keys of removed objects, so that clients can drop
+// them from their caches.
+package sockbs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	kindGet byte = iota + 1
+	kindHas
+	kindGetSize
+
+	kindResponse = 0x80
+	kindRemoved  = 0x81
+)
+
+const (
+	statusOK byte = iota
+	statusNotFound
+	statusError
+)
+
+// maxFrameSize bounds the frames read from the socket, objects are at most a
+// few MiB
+const maxFrameSize = 32 << 20
+
+type frame struct {
+	kind    byte
+	id      uint64
+	payload []byte
+}
+
+func writeFrame(w *bufio.Writer, f frame) error {
+	var hdr [1 + binary.MaxVarintLen64]byte
+	hdr[0] = f.kind
+	n := 1 + binary.PutUvarint(hdr[1:], f.id)
+
+	var lbuf [binary.MaxVarintLen64]byte
+	ln := binary.PutUvarint(lbuf[:], uint64(n+len(f.payload)))
+
+	if _, err := w.Write(lbuf[:ln]); err != nil {
+		return err
+	}
+	if _, err := w.Write(hdr[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(f.payload)
+	return err
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return frame{}, err
+	}
+	if l < 2 || l > maxFrameSize {
+		return frame{}, xerrors.Errorf("invalid frame size %d", l)
+	}
+
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return frame{}, err
+	}
+
+	id, n := binary.Uvarint(buf[1:])
+	if n <= 0 {
+		return frame{}, xerrors.Errorf("invalid request id")
+	}
+	return frame{kind: buf[0], id: id, payload: buf[1+n:]}, nil
+}
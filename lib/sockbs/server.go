@@ -0,0 +1,292 @@
+package sockbs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("sockbs")
+
+// Limits of the server. Requests are answered by ServerWorkers goroutines,
+// and every client has a queue of ClientQueueSize frames. Clients which fill
+// it with unread removal notifications, or don't read a frame for
+// WriteTimeout, are disconnected.
+var (
+	ServerWorkers   = 16
+	ClientQueueSize = 256
+	WriteTimeout    = 10 * time.Second
+)
+
+// Server serves the objects of a blockstore to the clients connected to its
+// listeners. Clients can only read.
+type Server struct {
+	bs bstore.Blockstore
+
+	requests chan serverRequest
+	done     chan struct{}
+
+	lk        sync.Mutex
+	conns     map[*serverConn]struct{}
+	listeners []net.Listener
+	closed    bool
+}
+
+type serverRequest struct {
+	sc  *serverConn
+	req frame
+}
+
+func NewServer(bs bstore.Blockstore) *Server {
+	s := &Server{
+		bs:       bs,
+		requests: make(chan serverRequest),
+		done:     make(chan struct{}),
+		conns:    map[*serverConn]struct{}{},
+	}
+	for i := 0; i < ServerWorkers; i++ {
+		go s.worker()
+	}
+	return s
+}
+
+type serverConn struct {
+	conn net.Conn
+	out  chan frame
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (sc *serverConn) close() {
+	sc.closeOnce.Do(func() {
+		close(sc.closed)
+		_ = sc.conn.Close()
+	})
+}
+
+// respond queues a response, waiting while the queue of the client is full
+func (sc *serverConn) respond(f frame) {
+	select {
+	case sc.out <- f:
+	case <-sc.closed:
+	}
+}
+
+// notify queues a frame without waiting, it returns false if the queue of the
+// client is full
+func (sc *serverConn) notify(f frame) bool {
+	select {
+	case sc.out <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sc *serverConn) writeLoop() {
+	defer sc.close()
+
+	w := bufio.NewWriter(sc.conn)
+	for {
+		select {
+		case f := <-sc.out:
+			if err := sc.conn.SetWriteDeadline(time.Now().Add(WriteTimeout)); err != nil {
+				log.Debugw("setting shared blockstore write deadline", "error", err)
+				return
+			}
+			if err := writeFrame(w, f); err != nil {
+				log.Debugw("sending shared blockstore frame", "error", err)
+				return
+			}
+			// batch the frames which are already queued
+			if len(sc.out) > 0 {
+				continue
+			}
+			if err := w.Flush(); err != nil {
+				log.Debugw("sending shared blockstore frame", "error", err)
+				return
+			}
+		case <-sc.closed:
+			return
+		}
+	}
+}
+
+// Serve accepts clients on l until it's closed, or the server is closed
+func (s *Server) Serve(l net.Listener) error {
+	s.lk.Lock()
+	if s.closed {
+		s.lk.Unlock()
+		return l.Close()
+	}
+	s.listeners = append(s.listeners, l)
+	s.lk.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.lk.Lock()
+			closed := s.closed
+			s.lk.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		sc := &serverConn{
+			conn:   conn,
+			out:    make(chan frame, ClientQueueSize),
+			closed: make(chan struct{}),
+		}
+
+		s.lk.Lock()
+		if s.closed {
+			s.lk.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		s.conns[sc] = struct{}{}
+		s.lk.Unlock()
+
+		go sc.writeLoop()
+		go s.handle(sc)
+	}
+}
+
+func (s *Server) handle(sc *serverConn) {
+	defer func() {
+		s.lk.Lock()
+		delete(s.conns, sc)
+		s.lk.Unlock()
+
+		sc.close()
+	}()
+
+	r := bufio.NewReader(sc.conn)
+	for {
+		req, err := readFrame(r)
+		if err != nil {
+			log.Debugw("shared blockstore client disconnected", "error", err)
+			return
+		}
+
+		select {
+		case s.requests <- serverRequest{sc: sc, req: req}:
+		case <-sc.closed:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Server) worker() {
+	for {
+		select {
+		case r := <-s.requests:
+			r.sc.respond(s.respond(r.req))
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Server) respond(req frame) frame {
+	resp := frame{kind: kindResponse, id: req.id}
+
+	fail := func(err error) frame {
+		if err == bstore.ErrNotFound {
+			resp.payload = []byte{statusNotFound}
+		} else {
+			resp.payload = append([]byte{statusError}, err.Error()...)
+		}
+		return resp
+	}
+
+	c, err := cid.Cast(req.payload)
+	if err != nil {
+		return fail(err)
+	}
+
+	switch req.kind {
+	case kindGet:
+		b, err := s.bs.Get(c)
+		if err != nil {
+			return fail(err)
+		}
+		resp.payload = append([]byte{statusOK}, b.RawData()...)
+	case kindHas:
+		has, err := s.bs.Has(c)
+		if err != nil {
+			return fail(err)
+		}
+		resp.payload = []byte{statusOK, 0}
+		if has {
+			resp.payload[1] = 1
+		}
+	case kindGetSize:
+		size, err := s.bs.GetSize(c)
+		if err != nil {
+			return fail(err)
+		}
+		resp.payload = make([]byte, 1+binary.MaxVarintLen64)
+		resp.payload = resp.payload[:1+binary.PutUvarint(resp.payload[1:], uint64(size))]
+	default:
+		resp.payload = append([]byte{statusError}, "unknown request"...)
+	}
+	return resp
+}
+
+// Removed notifies the clients that the objects were removed from the
+// blockstore
+func (s *Server) Removed(cids []cid.Cid) {
+	var payload []byte
+	var lbuf [binary.MaxVarintLen64]byte
+	for _, c := range cids {
+		cb := c.Bytes()
+		payload = append(payload, lbuf[:binary.PutUvarint(lbuf[:], uint64(len(cb)))]...)
+		payload = append(payload, cb...)
+	}
+
+	s.lk.Lock()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for sc := range s.conns {
+		conns = append(conns, sc)
+	}
+	s.lk.Unlock()
+
+	for _, sc := range conns {
+		if !sc.notify(frame{kind: kindRemoved, payload: payload}) {
+			// the client would keep serving removed objects from its cache
+			log.Warnw("disconnecting shared blockstore client not reading removed objects")
+			sc.close()
+		}
+	}
+}
+
+// Close stops the listeners, and disconnects the clients
+func (s *Server) Close() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for _, l := range s.listeners {
+		_ = l.Close()
+	}
+	for sc := range s.conns {
+		sc.close()
+	}
+	return nil
+}
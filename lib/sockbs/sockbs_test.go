@@ -0,0 +1,242 @@
+package sockbs
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+func TestSharedBlockstore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sockbs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	bs := bstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	blk := block.NewBlock([]byte("shared"))
+	if err := bs.Put(blk); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "blockstore.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected a socket only the user can connect to, got %s", fi.Mode())
+	}
+	srv := NewServer(bs)
+	go srv.Serve(l)   //nolint:errcheck
+	defer srv.Close() //nolint:errcheck
+
+	c, err := Dial(path, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close() //nolint:errcheck
+
+	got, err := c.Get(blk.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.RawData()) != "shared" {
+		t.Fatalf("unexpected data %q", got.RawData())
+	}
+
+	has, err := c.Has(block.NewBlock([]byte("missing")).Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Fatal("expected missing object")
+	}
+
+	// the object is served from the cache until it's removed
+	if err := bs.DeleteBlock(blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Removed([]cid.Cid{blk.Cid()})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := c.Get(blk.Cid())
+		if err == bstore.ErrNotFound {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("removed object still served")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// blockingBlockstore counts the reads in flight, and blocks them until
+// released
+type blockingBlockstore struct {
+	bstore.Blockstore
+
+	lk       sync.Mutex
+	inFlight int
+	max      int
+	release  chan struct{}
+}
+
+func (bs *blockingBlockstore) Has(c cid.Cid) (bool, error) {
+	bs.lk.Lock()
+	bs.inFlight++
+	if bs.inFlight > bs.max {
+		bs.max = bs.inFlight
+	}
+	bs.lk.Unlock()
+
+	<-bs.release
+
+	bs.lk.Lock()
+	bs.inFlight--
+	bs.lk.Unlock()
+	return false, nil
+}
+
+func (bs *blockingBlockstore) stats() (int, int) {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	return bs.inFlight, bs.max
+}
+
+func listenTemp(t *testing.T) (string, net.Listener, func()) {
+	dir, err := ioutil.TempDir("", "sockbs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "blockstore.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, l, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestServerWorkers(t *testing.T) {
+	defer func(n int) { ServerWorkers = n }(ServerWorkers)
+	ServerWorkers = 2
+
+	path, l, cleanup := listenTemp(t)
+	defer cleanup()
+
+	bs := &blockingBlockstore{
+		Blockstore: bstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore())),
+		release:    make(chan struct{}),
+	}
+	srv := NewServer(bs)
+	go srv.Serve(l)   //nolint:errcheck
+	defer srv.Close() //nolint:errcheck
+
+	c, err := Dial(path, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close() //nolint:errcheck
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := c.Has(block.NewBlock([]byte{byte(i)}).Cid()); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for inFlight, _ := bs.stats(); inFlight < 2; inFlight, _ = bs.stats() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the requests to be served")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	close(bs.release)
+	wg.Wait()
+	if _, max := bs.stats(); max != 2 {
+		t.Fatalf("expected at most 2 requests to be served at once, got %d", max)
+	}
+}
+
+func TestRemovedSlowClient(t *testing.T) {
+	defer func(n int) { ClientQueueSize = n }(ClientQueueSize)
+	ClientQueueSize = 4
+
+	path, l, cleanup := listenTemp(t)
+	defer cleanup()
+
+	srv := NewServer(bstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore())))
+	go srv.Serve(l)   //nolint:errcheck
+	defer srv.Close() //nolint:errcheck
+
+	// a client which never reads
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	conns := func() int {
+		srv.lk.Lock()
+		defer srv.lk.Unlock()
+		return len(srv.conns)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for conns() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the client to connect")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	var removed []cid.Cid
+	for i := 0; i < 1<<14; i++ {
+		removed = append(removed, block.NewBlock([]byte{byte(i), byte(i >> 8)}).Cid())
+	}
+
+	// notifications don't wait for the client, which is dropped once its
+	// queue is full
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for conns() > 0 {
+			srv.Removed(removed)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the slow client to be disconnected")
+	}
+}
@@ -0,0 +1,211 @@
+// Package dealmetrics records metrics about the storage and retrieval markets
+// of a storage miner, so that miners can alert on the health of their markets.
+package dealmetrics
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/metrics"
+)
+
+var log = logging.Logger("dealmetrics")
+
+// DealStatesInterval is how often the number of storage deals in every state
+// is recorded
+var DealStatesInterval = time.Minute
+
+type retrievalDeal struct {
+	receiver peer.ID
+	id       retrievalmarket.DealID
+}
+
+type retrievalProgress struct {
+	sent  uint64
+	funds types.BigInt
+}
+
+// Reporter records market metrics from the events of the storage and
+// retrieval providers.
+type Reporter struct {
+	sp storagemarket.StorageProvider
+	rp retrievalmarket.RetrievalProvider
+
+	lk        sync.Mutex
+	retrieval map[retrievalDeal]retrievalProgress
+}
+
+// New registers the market metric views, and returns a reporter of the
+// events of the providers.
+func New(sp storagemarket.StorageProvider, rp retrievalmarket.RetrievalProvider) (*Reporter, error) {
+	if err := view.Register(metrics.MarketViews...); err != nil {
+		return nil, xerrors.Errorf("registering market metric views: %w", err)
+	}
+
+	return &Reporter{
+		sp:        sp,
+		rp:        rp,
+		retrieval: map[retrievalDeal]retrievalProgress{},
+	}, nil
+}
+
+// Run records metrics until the context is cancelled.
+func (r *Reporter) Run(ctx context.Context) {
+	unsubStorage := r.sp.SubscribeToEvents(func(event storagemarket.ProviderEvent, deal storagemarket.MinerDeal) {
+		r.onStorageEvent(ctx, event, deal)
+	})
+	defer unsubStorage()
+
+	unsubRetrieval := r.rp.SubscribeToEvents(func(event retrievalmarket.ProviderEvent, state retrievalmarket.ProviderDealState) {
+		r.onRetrievalEvent(ctx, state)
+	})
+	defer unsubRetrieval()
+
+	tick := time.NewTicker(DealStatesInterval)
+	defer tick.Stop()
+
+	for {
+		r.recordDealStates(ctx)
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *Reporter) onStorageEvent(ctx context.Context, event storagemarket.ProviderEvent, deal storagemarket.MinerDeal) {
+	switch event {
+	case storagemarket.ProviderEventDealAccepted:
+		stats.Record(ctx, metrics.MarketStorageDealAccepted.M(1))
+	case storagemarket.ProviderEventDealRejected:
+		ctx, _ = tag.New(ctx, tag.Upsert(metrics.RejectReason, rejectReason(deal.Message)))
+		stats.Record(ctx, metrics.MarketStorageDealRejected.M(1))
+	case storagemarket.ProviderEventDataTransferCompleted:
+		stats.Record(ctx, metrics.MarketStorageDataReceived.M(int64(deal.Proposal.PieceSize)))
+	}
+}
+
+// onRetrievalEvent records the progress of the deal since its previous event.
+// Deals are forgotten once they reach a final status.
+func (r *Reporter) onRetrievalEvent(ctx context.Context, state retrievalmarket.ProviderDealState) {
+	key := retrievalDeal{receiver: state.Receiver, id: state.ID}
+
+	r.lk.Lock()
+	prev, ok := r.retrieval[key]
+	if !ok {
+		prev.funds = types.NewInt(0)
+	}
+	switch state.Status {
+	case retrievalmarket.DealStatusCompleted, retrievalmarket.DealStatusFailed, retrievalmarket.DealStatusErrored,
+		retrievalmarket.DealStatusRejected, retrievalmarket.DealStatusDealNotFound:
+		delete(r.retrieval, key)
+	default:
+		r.retrieval[key] = retrievalProgress{sent: state.TotalSent, funds: state.FundsReceived}
+	}
+	r.lk.Unlock()
+
+	if state.TotalSent > prev.sent {
+		stats.Record(ctx, metrics.MarketRetrievalBytesSent.M(int64(state.TotalSent-prev.sent)))
+	}
+	if !state.FundsReceived.Nil() && state.FundsReceived.GreaterThan(prev.funds) {
+		received, _ := new(big.Float).SetInt(types.BigSub(state.FundsReceived, prev.funds).Int).Float64()
+		stats.Record(ctx, metrics.MarketRetrievalRevenue.M(received))
+	}
+}
+
+func (r *Reporter) recordDealStates(ctx context.Context) {
+	deals, err := r.sp.ListLocalDeals()
+	if err != nil {
+		log.Errorf("listing storage deals: %s", err)
+		return
+	}
+
+	counts := map[storagemarket.StorageDealStatus]int64{}
+	for _, d := range deals {
+		counts[d.State]++
+	}
+
+	// states without deals are recorded too, so that their gauges go to zero
+	for state, name := range storagemarket.DealStates {
+		sctx, _ := tag.New(ctx, tag.Upsert(metrics.DealState, name))
+		stats.Record(sctx, metrics.MarketStorageDeals.M(counts[state]))
+	}
+}
+
+// The reasons storage deals are rejected for, as recorded in the reject_reason
+// tag
+const (
+	RejectMaintenance  = "maintenance"
+	RejectNotAccepting = "not_accepting"
+	RejectMinerError   = "miner_error"
+	RejectSignature    = "signature"
+	RejectProvider     = "wrong_provider"
+	RejectPrice        = "price"
+	RejectPieceSize    = "piece_size"
+	RejectPieceCid     = "piece_cid"
+	RejectEpochs       = "epochs"
+	RejectClientFunds  = "client_funds"
+	RejectOther        = "other"
+)
+
+// rejectReasons maps parts of the rejection messages of the storage provider
+// and of the deal filters of the miner to reasons, first match wins
+var rejectReasons = []struct {
+	match  string
+	reason string
+}{
+	{"maintenance", RejectMaintenance},
+	{"not considering", RejectNotAccepting},
+	{"not accepting", RejectNotAccepting},
+	{"miner error", RejectMinerError},
+	{"node error", RejectMinerError},
+	{"signature", RejectSignature},
+	{"incorrect provider", RejectProvider},
+	{"price", RejectPrice},
+	{"piece size", RejectPieceSize},
+	{"piececid", RejectPieceCid},
+	{"epoch", RejectEpochs},
+	{"expired", RejectEpochs},
+	{"balance", RejectClientFunds},
+	{"available too small", RejectClientFunds},
+}
+
+// rejectReason maps a rejection message to one of a fixed set of reasons,
+// which keeps the number of distinct tag values bounded
+func rejectReason(msg string) string {
+	msg = strings.ToLower(msg)
+	for _, r := range rejectReasons {
+		if strings.Contains(msg, r.match) {
+			return r.reason
+		}
+	}
+	return RejectOther
+}
+
+var unsealing int64
+
+// UnsealStarted records a piece being unsealed for a retrieval. The returned
+// function must be called once unsealing finished.
+func UnsealStarted(ctx context.Context) func() {
+	stats.Record(ctx, metrics.MarketRetrievalUnsealQueue.M(atomic.AddInt64(&unsealing, 1)))
+	return func() {
+		stats.Record(ctx, metrics.MarketRetrievalUnsealQueue.M(atomic.AddInt64(&unsealing, -1)))
+	}
+}
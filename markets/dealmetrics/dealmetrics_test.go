@@ -0,0 +1,87 @@
+package dealmetrics
+
+import (
+	"context"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+
+	"github.com/filecoin-project/lotus/metrics"
+)
+
+func TestRejectReason(t *testing.T) {
+	for _, tc := range []struct {
+		msg    string
+		reason string
+	}{
+		{"miner is in maintenance", RejectMaintenance},
+		{"miner is not considering online storage deals", RejectNotAccepting},
+		{"miner is not accepting offline storage deals", RejectNotAccepting},
+		{"miner error", RejectMinerError},
+		{"node error getting most recent state id: timeout", RejectMinerError},
+		{"verifying StorageDealProposal: invalid signature", RejectSignature},
+		{"incorrect provider for deal", RejectProvider},
+		{"storage price per epoch less than asking price: 1 < 2", RejectPrice},
+		{"piece size less than minimum required size: 128 < 256", RejectPieceSize},
+		{"proposal PieceCID had wrong prefix", RejectPieceCid},
+		{"deal start epoch has already elapsed", RejectEpochs},
+		{"clientMarketBalance.Available too small: 1 < 2", RejectClientFunds},
+		{"", RejectOther},
+		{"something new, with details: 42", RejectOther},
+	} {
+		if r := rejectReason(tc.msg); r != tc.reason {
+			t.Errorf("expected %q to be rejected for %s, got %s", tc.msg, tc.reason, r)
+		}
+	}
+}
+
+func TestStorageDealRejected(t *testing.T) {
+	ctx := context.TODO()
+
+	if _, err := New(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the reporter can be created again, e.g. by another node in the process
+	r, err := New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(metrics.MarketViews...)
+
+	for _, msg := range []string{
+		"miner is in maintenance",
+		"miner is in maintenance",
+		"incorrect provider for deal",
+		"unexpected: 1",
+		"unexpected: 2",
+	} {
+		r.onStorageEvent(ctx, storagemarket.ProviderEventDealRejected, storagemarket.MinerDeal{Message: msg})
+	}
+	// other events aren't counted as rejections
+	r.onStorageEvent(ctx, storagemarket.ProviderEventDealAccepted, storagemarket.MinerDeal{Message: "miner error"})
+
+	rows, err := view.RetrieveData(metrics.MarketStorageDealRejectedView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int64{}
+	for _, row := range rows {
+		if len(row.Tags) != 1 || row.Tags[0].Key != metrics.RejectReason {
+			t.Fatalf("expected rejections to be tagged with the reason, got %v", row.Tags)
+		}
+		counts[row.Tags[0].Value] = row.Data.(*view.CountData).Value
+	}
+
+	expected := map[string]int64{RejectMaintenance: 2, RejectProvider: 1, RejectOther: 2}
+	if len(counts) != len(expected) {
+		t.Fatalf("expected rejections for %v, got %v", expected, counts)
+	}
+	for reason, n := range expected {
+		if counts[reason] != n {
+			t.Errorf("expected %d rejections for %s, got %d", n, reason, counts[reason])
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/markets/dealmetrics"
 	"github.com/filecoin-project/lotus/storage"
 )
 
@@ -55,8 +56,10 @@ func (rpn *retrievalProviderNode) UnsealSector(ctx context.Context, sectorID uin
 		Number: abi.SectorNumber(sectorID),
 	}
 
+	done := dealmetrics.UnsealStarted(ctx)
 	r, w := io.Pipe()
 	go func() {
+		defer done()
 		err := rpn.sealer.ReadPiece(ctx, w, sid, storiface.UnpaddedByteIndex(offset), abi.UnpaddedPieceSize(length), si.TicketValue, *si.CommD)
 		_ = w.CloseWithError(err)
 	}()
@@ -138,7 +138,7 @@ func (n *ClientNodeAdapter) AddFunds(ctx context.Context, addr address.Address,
 		GasPrice: types.NewInt(0),
 		GasLimit: 1000000,
 		Method:   builtin.MethodsMarket.AddBalance,
-	})
+	}, nil)
 	if err != nil {
 		return cid.Undef, err
 	}
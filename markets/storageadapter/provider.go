@@ -79,7 +79,7 @@ func (n *ProviderNodeAdapter) PublishDeals(ctx context.Context, deal storagemark
 		GasLimit: 1000000,
 		Method:   builtin.MethodsMarket.PublishStorageDeals,
 		Params:   params,
-	})
+	}, nil)
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -174,7 +174,7 @@ func (n *ProviderNodeAdapter) AddFunds(ctx context.Context, addr address.Address
 		GasPrice: types.NewInt(0),
 		GasLimit: 1000000,
 		Method:   builtin.MethodsMarket.AddBalance,
-	})
+	}, nil)
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -18,6 +18,14 @@ var (
 	MessageTo, _    = tag.NewKey("message_to")
 	MessageNonce, _ = tag.NewKey("message_nonce")
 	ReceivedFrom, _ = tag.NewKey("received_from")
+	DealState, _    = tag.NewKey("deal_state")
+	RejectReason, _ = tag.NewKey("reject_reason")
+
+	ChainCache, _ = tag.NewKey("chain_cache")
+	CronActor, _  = tag.NewKey("cron_actor")
+
+	BlocksyncStatus, _   = tag.NewKey("blocksync_status")
+	BlocksyncProtocol, _ = tag.NewKey("blocksync_protocol")
 )
 
 // Measures
@@ -33,6 +41,30 @@ var (
 	BlockValidationSuccess              = stats.Int64("block/success", "Counter for block validation successes", stats.UnitDimensionless)
 	BlockValidationDurationMilliseconds = stats.Float64("block/validation_ms", "Duration for Block Validation in ms", stats.UnitMilliseconds)
 	PeerCount                           = stats.Int64("peer/count", "Current number of FIL peers", stats.UnitDimensionless)
+	ChainCacheHits                      = stats.Int64("chain/cache_hits", "Counter for chain store cache hits", stats.UnitDimensionless)
+	ChainCacheMisses                    = stats.Int64("chain/cache_misses", "Counter for chain store cache misses", stats.UnitDimensionless)
+	CronDurationMs                      = stats.Float64("chain/cron_duration_ms", "Duration of the cron tick at the end of the last executed epoch in ms", stats.UnitMilliseconds)
+	CronGasUsed                         = stats.Int64("chain/cron_gas_used", "Gas used by the cron tick at the end of the last executed epoch", stats.UnitDimensionless)
+	CronFailures                        = stats.Int64("chain/cron_failures", "Counter for failed calls made by cron", stats.UnitDimensionless)
+	BlocksyncGoAway                     = stats.Int64("blocksync/goaway", "Counter for go away responses from blocksync peers", stats.UnitDimensionless)
+
+	BlocksyncClientRequests      = stats.Int64("blocksync/client_requests", "Counter for requests sent to sync peers", stats.UnitDimensionless)
+	BlocksyncClientRequestMs     = stats.Float64("blocksync/client_request_ms", "Duration of requests sent to sync peers in ms", stats.UnitMilliseconds)
+	BlocksyncClientBytesReceived = stats.Int64("blocksync/client_bytes_received", "Response bytes received from blocksync peers", stats.UnitBytes)
+	BlocksyncClientPartials      = stats.Int64("blocksync/client_partials", "Counter for partial responses from sync peers", stats.UnitDimensionless)
+	BlocksyncClientContinuations = stats.Int64("blocksync/client_continuations", "Counter for requests continuing a partially fetched chain segment", stats.UnitDimensionless)
+	BlocksyncClientStreams       = stats.Int64("blocksync/client_streams", "Number of open blocksync client streams", stats.UnitDimensionless)
+	BlocksyncServerRequests      = stats.Int64("blocksync/server_requests", "Counter for blocksync requests served", stats.UnitDimensionless)
+	BlocksyncServerBytesSent     = stats.Int64("blocksync/server_bytes_sent", "Response bytes sent to blocksync peers", stats.UnitBytes)
+	BlocksyncServerStreams       = stats.Int64("blocksync/server_streams", "Number of open blocksync server streams", stats.UnitDimensionless)
+
+	MarketStorageDeals         = stats.Int64("market/storage_deals", "Number of storage deals in a state", stats.UnitDimensionless)
+	MarketStorageDealAccepted  = stats.Int64("market/storage_deal_accepted", "Counter for accepted storage deal proposals", stats.UnitDimensionless)
+	MarketStorageDealRejected  = stats.Int64("market/storage_deal_rejected", "Counter for rejected storage deal proposals", stats.UnitDimensionless)
+	MarketStorageDataReceived  = stats.Int64("market/storage_data_received", "Piece bytes received for storage deals", stats.UnitBytes)
+	MarketRetrievalBytesSent   = stats.Int64("market/retrieval_bytes_sent", "Bytes sent for retrieval deals", stats.UnitBytes)
+	MarketRetrievalRevenue     = stats.Float64("market/retrieval_revenue", "Payments received for retrieval deals, in attoFIL", stats.UnitDimensionless)
+	MarketRetrievalUnsealQueue = stats.Int64("market/retrieval_unseal_queue", "Number of pieces being unsealed for retrieval", stats.UnitDimensionless)
 )
 
 var (
@@ -85,8 +117,123 @@ var (
 		Measure:     PeerCount,
 		Aggregation: view.LastValue(),
 	}
+	ChainCacheHitsView = &view.View{
+		Measure:     ChainCacheHits,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{ChainCache},
+	}
+	ChainCacheMissesView = &view.View{
+		Measure:     ChainCacheMisses,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{ChainCache},
+	}
+	BlocksyncGoAwayView = &view.View{
+		Measure:     BlocksyncGoAway,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{PeerID},
+	}
+	BlocksyncClientRequestsView = &view.View{
+		Measure:     BlocksyncClientRequests,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{BlocksyncStatus, BlocksyncProtocol},
+	}
+	BlocksyncClientRequestMsView = &view.View{
+		Measure:     BlocksyncClientRequestMs,
+		Aggregation: view.Distribution(10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000),
+		TagKeys:     []tag.Key{BlocksyncStatus, BlocksyncProtocol},
+	}
+	BlocksyncClientBytesReceivedView = &view.View{
+		Measure:     BlocksyncClientBytesReceived,
+		Aggregation: view.Sum(),
+	}
+	BlocksyncClientPartialsView = &view.View{
+		Measure:     BlocksyncClientPartials,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{BlocksyncProtocol},
+	}
+	BlocksyncClientContinuationsView = &view.View{
+		Measure:     BlocksyncClientContinuations,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{BlocksyncProtocol},
+	}
+	BlocksyncClientStreamsView = &view.View{
+		Measure:     BlocksyncClientStreams,
+		Aggregation: view.LastValue(),
+	}
+	CronDurationView = &view.View{
+		Measure:     CronDurationMs,
+		Aggregation: view.LastValue(),
+	}
+	CronGasUsedView = &view.View{
+		Measure:     CronGasUsed,
+		Aggregation: view.LastValue(),
+	}
+	CronFailuresView = &view.View{
+		Measure:     CronFailures,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{CronActor},
+	}
+	BlocksyncServerRequestsView = &view.View{
+		Measure:     BlocksyncServerRequests,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{BlocksyncStatus},
+	}
+	BlocksyncServerBytesSentView = &view.View{
+		Measure:     BlocksyncServerBytesSent,
+		Aggregation: view.Sum(),
+	}
+	BlocksyncServerStreamsView = &view.View{
+		Measure:     BlocksyncServerStreams,
+		Aggregation: view.LastValue(),
+	}
 )
 
+// Market views are only recorded by storage miners
+var (
+	MarketStorageDealsView = &view.View{
+		Measure:     MarketStorageDeals,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{DealState},
+	}
+	MarketStorageDealAcceptedView = &view.View{
+		Measure:     MarketStorageDealAccepted,
+		Aggregation: view.Count(),
+	}
+	MarketStorageDealRejectedView = &view.View{
+		Measure:     MarketStorageDealRejected,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{RejectReason},
+	}
+	MarketStorageDataReceivedView = &view.View{
+		Measure:     MarketStorageDataReceived,
+		Aggregation: view.Sum(),
+	}
+	MarketRetrievalBytesSentView = &view.View{
+		Measure:     MarketRetrievalBytesSent,
+		Aggregation: view.Sum(),
+	}
+	MarketRetrievalRevenueView = &view.View{
+		Measure:     MarketRetrievalRevenue,
+		Aggregation: view.Sum(),
+	}
+	MarketRetrievalUnsealQueueView = &view.View{
+		Measure:     MarketRetrievalUnsealQueue,
+		Aggregation: view.LastValue(),
+	}
+)
+
+// MarketViews is an array of OpenCensus views for storage and retrieval market
+// metrics
+var MarketViews = []*view.View{
+	MarketStorageDealsView,
+	MarketStorageDealAcceptedView,
+	MarketStorageDealRejectedView,
+	MarketStorageDataReceivedView,
+	MarketRetrievalBytesSentView,
+	MarketRetrievalRevenueView,
+	MarketRetrievalUnsealQueueView,
+}
+
 // DefaultViews is an array of OpenCensus views for metric gathering purposes
 var DefaultViews = append([]*view.View{
 	InfoView,
@@ -99,4 +246,19 @@ var DefaultViews = append([]*view.View{
 	MessageReceivedView,
 	MessageValidationFailureView,
 	MessageValidationSuccessView,
-	PeerCountView}, rpcmetrics.DefaultViews...)
+	PeerCountView,
+	ChainCacheHitsView,
+	ChainCacheMissesView,
+	CronDurationView,
+	CronGasUsedView,
+	CronFailuresView,
+	BlocksyncGoAwayView,
+	BlocksyncClientRequestsView,
+	BlocksyncClientRequestMsView,
+	BlocksyncClientBytesReceivedView,
+	BlocksyncClientPartialsView,
+	BlocksyncClientContinuationsView,
+	BlocksyncClientStreamsView,
+	BlocksyncServerRequestsView,
+	BlocksyncServerBytesSentView,
+	BlocksyncServerStreamsView}, rpcmetrics.DefaultViews...)
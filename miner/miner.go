@@ -66,6 +66,21 @@ type Miner struct {
 	lastWork *MiningBase
 
 	minedBlockHeights *lru.ARCCache
+
+	// if set, consulted before every round; mining is skipped on error
+	miningCheck func() error
+
+	timingsLk sync.Mutex
+	timings   []api.MinedBlockTimings
+}
+
+// SetMiningCheck sets a function which is called before attempting to mine
+// each round. When it returns an error, the round is skipped.
+func (m *Miner) SetMiningCheck(check func() error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	m.miningCheck = check
 }
 
 func (m *Miner) Address() address.Address {
@@ -154,7 +169,20 @@ func (m *Miner) mine(ctx context.Context) {
 			continue
 		}
 
-		b, err := m.mineOne(ctx, base)
+		m.lk.Lock()
+		check := m.miningCheck
+		m.lk.Unlock()
+		if check != nil {
+			if err := check(); err != nil {
+				log.Errorf("not mining round %d: %s", base.TipSet.Height()+base.NullRounds+1, err)
+				m.niceSleep(time.Duration(build.BlockDelaySecs) * time.Second)
+				onDone(false, err)
+				continue
+			}
+		}
+
+		var bt blockTimings
+		b, err := m.mineOne(ctx, base, &bt)
 		if err != nil {
 			log.Errorf("mining block failed: %+v", err)
 			m.niceSleep(time.Second)
@@ -187,6 +215,9 @@ func (m *Miner) mine(ctx context.Context) {
 			m.minedBlockHeights.Add(blkKey, true)
 			if err := m.api.SyncSubmitBlock(ctx, b); err != nil {
 				log.Errorf("failed to submit newly mined block: %s", err)
+			} else {
+				bt.published = time.Now()
+				m.recordTimings(b, &bt)
 			}
 		} else {
 			base.NullRounds++
@@ -266,9 +297,10 @@ func (m *Miner) hasPower(ctx context.Context, addr address.Address, ts *types.Ti
 // This method does the following:
 //
 //  1.
-func (m *Miner) mineOne(ctx context.Context, base *MiningBase) (*types.BlockMsg, error) {
+func (m *Miner) mineOne(ctx context.Context, base *MiningBase, bt *blockTimings) (*types.BlockMsg, error) {
 	log.Debugw("attempting to mine a block", "tipset", types.LogCids(base.TipSet.Cids()))
 	start := time.Now()
+	bt.start = start
 
 	round := base.TipSet.Height() + base.NullRounds + 1
 
@@ -339,6 +371,7 @@ func (m *Miner) mineOne(ctx context.Context, base *MiningBase) (*types.BlockMsg,
 	if err != nil {
 		return nil, xerrors.Errorf("failed to compute winning post proof: %w", err)
 	}
+	bt.proof = time.Now()
 
 	// get pending messages early,
 	pending, err := m.api.MpoolPending(context.TODO(), base.TipSet.Key())
@@ -349,12 +382,13 @@ func (m *Miner) mineOne(ctx context.Context, base *MiningBase) (*types.BlockMsg,
 	tPending := time.Now()
 
 	// TODO: winning post proof
-	b, err := m.createBlock(base, m.address, ticket, winner, bvals, postProof, pending)
+	b, err := m.createBlock(base, m.address, ticket, winner, bvals, postProof, pending, bt)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to create block: %w", err)
 	}
 
 	tCreateBlock := time.Now()
+	bt.created = tCreateBlock
 	dur := tCreateBlock.Sub(start)
 	log.Infow("mined new block", "cid", b.Cid(), "height", b.Header.Height, "took", dur)
 	if dur > time.Second*time.Duration(build.BlockDelaySecs) {
@@ -407,11 +441,12 @@ func (m *Miner) computeTicket(ctx context.Context, brand *types.BeaconEntry, bas
 }
 
 func (m *Miner) createBlock(base *MiningBase, addr address.Address, ticket *types.Ticket,
-	eproof *types.ElectionProof, bvals []types.BeaconEntry, wpostProof []abi.PoStProof, pending []*types.SignedMessage) (*types.BlockMsg, error) {
+	eproof *types.ElectionProof, bvals []types.BeaconEntry, wpostProof []abi.PoStProof, pending []*types.SignedMessage, bt *blockTimings) (*types.BlockMsg, error) {
 	msgs, err := SelectMessages(context.TODO(), m.api.StateGetActor, base.TipSet, pending)
 	if err != nil {
 		return nil, xerrors.Errorf("message filtering failed: %w", err)
 	}
+	bt.messages = time.Now()
 
 	if len(msgs) > build.BlockMessageLimit {
 		log.Error("SelectMessages returned too many messages: ", len(msgs))
@@ -0,0 +1,95 @@
+package miner
+
+import (
+	"time"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// propagationCutoff is how long after the start of an epoch a block can be
+// published and still be expected to make it into the tipsets other miners
+// build on.
+func propagationCutoff() time.Duration {
+	return time.Duration(build.PropagationDelaySecs) * time.Second
+}
+
+// maxTimingReports is the number of recently mined blocks timings are kept
+// for.
+const maxTimingReports = 64
+
+// blockTimings collects the wall clock times at which the stages of producing
+// a block finished.
+type blockTimings struct {
+	start     time.Time
+	proof     time.Time
+	messages  time.Time
+	created   time.Time
+	published time.Time
+}
+
+func (bt *blockTimings) report(b *types.BlockMsg) api.MinedBlockTimings {
+	epochStart := time.Unix(int64(b.Header.Timestamp), 0)
+	rel := func(t time.Time) time.Duration {
+		return t.Sub(epochStart)
+	}
+
+	return api.MinedBlockTimings{
+		Block:      b.Cid(),
+		Height:     b.Header.Height,
+		EpochStart: epochStart,
+
+		Start:     rel(bt.start),
+		Proof:     rel(bt.proof),
+		Messages:  rel(bt.messages),
+		Created:   rel(bt.created),
+		Published: rel(bt.published),
+
+		Late: rel(bt.published) > propagationCutoff(),
+	}
+}
+
+// recordTimings stores the timings of a published block, and warns about the
+// stages that ran close to, or past the propagation cutoff.
+func (m *Miner) recordTimings(b *types.BlockMsg, bt *blockTimings) {
+	r := bt.report(b)
+
+	stages := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"proof", r.Proof},
+		{"messages", r.Messages},
+		{"created", r.Created},
+		{"published", r.Published},
+	}
+	cutoff := propagationCutoff()
+	for _, s := range stages {
+		switch {
+		case s.d > cutoff:
+			log.Errorw("mined block missed the propagation cutoff", "stage", s.name, "sinceEpochStart", s.d, "cutoff", cutoff, "block", r.Block)
+		case s.d > cutoff/2:
+			log.Warnw("mined block at risk of missing the propagation cutoff", "stage", s.name, "sinceEpochStart", s.d, "cutoff", cutoff, "block", r.Block)
+		}
+	}
+
+	m.timingsLk.Lock()
+	defer m.timingsLk.Unlock()
+
+	m.timings = append(m.timings, r)
+	if len(m.timings) > maxTimingReports {
+		m.timings = m.timings[len(m.timings)-maxTimingReports:]
+	}
+}
+
+// MiningReport returns the stage timings of recently mined blocks, oldest
+// first.
+func (m *Miner) MiningReport() []api.MinedBlockTimings {
+	m.timingsLk.Lock()
+	defer m.timingsLk.Unlock()
+
+	out := make([]api.MinedBlockTimings, len(m.timings))
+	copy(out, m.timings)
+	return out
+}
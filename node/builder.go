@@ -25,23 +25,35 @@ import (
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/storedask"
 
-	"github.com/filecoin-project/specs-actors/actors/runtime"
 	storage2 "github.com/filecoin-project/specs-storage/storage"
 
 	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain"
 	"github.com/filecoin-project/lotus/chain/beacon"
 	"github.com/filecoin-project/lotus/chain/blocksync"
+	"github.com/filecoin-project/lotus/chain/changefeed"
+	"github.com/filecoin-project/lotus/chain/deposits"
+	"github.com/filecoin-project/lotus/chain/events"
 	"github.com/filecoin-project/lotus/chain/gen"
 	"github.com/filecoin-project/lotus/chain/market"
 	"github.com/filecoin-project/lotus/chain/messagepool"
 	"github.com/filecoin-project/lotus/chain/metrics"
+	"github.com/filecoin-project/lotus/chain/msgindex"
+	"github.com/filecoin-project/lotus/chain/rollups"
+	"github.com/filecoin-project/lotus/chain/sandbox"
+	"github.com/filecoin-project/lotus/chain/snapshot"
 	"github.com/filecoin-project/lotus/chain/stmgr"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/chain/vm"
 	"github.com/filecoin-project/lotus/chain/wallet"
+	"github.com/filecoin-project/lotus/lib/alerting"
+	"github.com/filecoin-project/lotus/lib/clockdrift"
+	"github.com/filecoin-project/lotus/lib/coldstore"
+	"github.com/filecoin-project/lotus/lib/msgaudit"
 	"github.com/filecoin-project/lotus/lib/peermgr"
+	"github.com/filecoin-project/lotus/lib/rpctls"
 	_ "github.com/filecoin-project/lotus/lib/sigs/bls"
 	_ "github.com/filecoin-project/lotus/lib/sigs/secp"
 	"github.com/filecoin-project/lotus/markets/storageadapter"
@@ -96,12 +108,23 @@ const (
 	BootstrapKey
 
 	// filecoin
+	RouteActorsKey
+	SetChainCacheKey
 	SetGenesisKey
 
 	RunHelloKey
 	RunBlockSyncKey
+	RunAvailabilityCheckKey
+	RunSnapshotServerKey
+	RunChainPrunerKey
+	RunColdMoverKey
+	RunSharedBlockstoreKey
 	RunChainGraphsync
 	RunPeerMgrKey
+	RunClockCheckKey
+	RunAlertsKey
+	PrewarmStateKey
+	SetMpoolConfigKey
 
 	HandleIncomingBlocksKey
 	HandleIncomingMessagesKey
@@ -112,12 +135,14 @@ const (
 	GetParamsKey
 	HandleDealsKey
 	HandleRetrievalKey
+	RunMarketMetricsKey
 	RunSectorServiceKey
 	RegisterProviderValidatorKey
 
 	// daemon
 	ExtractApiKey
 	HeadMetricsKey
+	TelemetryKey
 	RunPeerTaggerKey
 	JournalKey
 
@@ -212,6 +237,8 @@ func Online() Option {
 		libp2p(),
 
 		// common
+		Override(new(*clockdrift.Checker), modules.ClockChecker(config.DefaultFullNode().ClockCheck)),
+		Override(new(*alerting.Alerting), modules.Alerting(config.DefaultFullNode().Alerting)),
 
 		// Full node
 
@@ -225,9 +252,10 @@ func Online() Option {
 			Override(HandleIncomingMessagesKey, modules.HandleIncomingMessages),
 
 			Override(new(ffiwrapper.Verifier), ffiwrapper.ProofVerifier),
-			Override(new(runtime.Syscalls), vm.Syscalls),
+			Override(new(vm.Syscalls), vm.DefaultSyscalls),
 			Override(new(*store.ChainStore), modules.ChainStore),
-			Override(new(*stmgr.StateManager), stmgr.NewStateManager),
+			Override(new(*stmgr.StateManager), modules.StateManager),
+			Override(new(*sandbox.Manager), sandbox.NewManager),
 			Override(new(*wallet.Wallet), wallet.NewWallet),
 
 			Override(new(dtypes.ChainGCLocker), blockstore.NewGCLocker),
@@ -238,6 +266,12 @@ func Online() Option {
 
 			// Filecoin services
 			Override(new(*chain.Syncer), modules.NewSyncer),
+			Override(new(chain.Prefetcher), chain.NoopPrefetcher),
+			Override(new(chain.SyncWorkers), chain.DefaultSyncWorkers),
+			Override(new(chain.SyncTargetThreshold), chain.DefaultSyncTargetThreshold),
+			Override(new(chain.ClockSkewPolicy), chain.DefaultClockSkewPolicy),
+			Override(new(*chain.Checkpoints), modules.SyncCheckpoints(config.SyncCheckpoints{})),
+			Override(new(blocksync.ClientTimeouts), blocksync.DefaultClientTimeouts),
 			Override(new(*blocksync.BlockSync), blocksync.NewBlockSyncClient),
 			Override(new(*messagepool.MessagePool), modules.MessagePool),
 
@@ -247,14 +281,19 @@ func Online() Option {
 
 			Override(new(dtypes.NetworkName), modules.NetworkName),
 			Override(new(*hello.Service), hello.NewHelloService),
+			Override(new(blocksync.ServerLimits), blocksync.DefaultServerLimits),
 			Override(new(*blocksync.BlockSyncService), blocksync.NewBlockSyncService),
 			Override(new(*peermgr.PeerMgr), peermgr.NewPeerMgr),
+			Override(new(*snapshot.Client), modules.SnapshotClient),
+			Override(new(*events.Events), modules.ChainEvents),
 
 			Override(new(dtypes.Graphsync), modules.Graphsync),
 
 			Override(RunHelloKey, modules.RunHello),
 			Override(RunBlockSyncKey, modules.RunBlockSync),
+			Override(RunAvailabilityCheckKey, modules.RunAvailabilityChecker),
 			Override(RunPeerMgrKey, modules.RunPeerMgr),
+			Override(RunClockCheckKey, modules.RunClockCheck),
 			Override(HandleIncomingBlocksKey, modules.HandleIncomingBlocks),
 
 			Override(new(*discovery.Local), modules.NewLocalDiscovery),
@@ -295,6 +334,9 @@ func Online() Option {
 
 			Override(new(*sectorblocks.SectorBlocks), sectorblocks.NewSectorBlocks),
 			Override(new(*storage.Miner), modules.StorageMiner),
+			Override(new(*storage.SealingEstimator), modules.SealingEstimator),
+			Override(new(*storage.Maintenance), modules.Maintenance),
+			Override(new(*impl.WorkerVersions), impl.NewWorkerVersions),
 			Override(new(dtypes.NetworkName), modules.StorageNetworkName),
 
 			Override(new(dtypes.StagingBlockstore), modules.StagingBlockstore),
@@ -312,8 +354,10 @@ func Online() Option {
 			Override(HandleRetrievalKey, modules.HandleRetrieval),
 			Override(GetParamsKey, modules.GetParams),
 			Override(HandleDealsKey, modules.HandleDeals),
+			Override(RunMarketMetricsKey, modules.RunMarketMetrics),
 			Override(new(gen.WinningPoStProver), storage.NewWinningPoStProver),
 			Override(new(*miner.Miner), modules.SetupBlockProducer),
+			Override(RunClockCheckKey, modules.RunMinerClockCheck),
 
 			Override(new(dtypes.ConsiderOnlineStorageDealsConfigFunc), modules.NewConsiderOnlineStorageDealsConfigFunc),
 			Override(new(dtypes.SetConsiderOnlineStorageDealsConfigFunc), modules.NewSetConsideringOnlineStorageDealsFunc),
@@ -362,11 +406,17 @@ func ConfigCommon(cfg *config.Common) Option {
 		Override(SetApiEndpointKey, func(lr repo.LockedRepo, e dtypes.APIEndpoint) error {
 			return lr.SetAPIEndpoint(e)
 		}),
+		Override(JournalKey, modules.ConfigJournal(cfg.Journal)),
 		Override(new(sectorstorage.URLs), func(e dtypes.APIEndpoint) (sectorstorage.URLs, error) {
 			ip := cfg.API.RemoteListenAddress
 
+			scheme := "http"
+			if _, secure := rpctls.SplitAddr(e); secure {
+				scheme = rpctls.TransferScheme
+			}
+
 			var urls sectorstorage.URLs
-			urls = append(urls, "http://"+ip+"/remote") // TODO: This makes no assumptions, and probably could...
+			urls = append(urls, scheme+"://"+ip+"/remote") // TODO: This makes no assumptions, and probably could...
 			return urls, nil
 		}),
 		ApplyIf(func(s *Settings) bool { return s.Online },
@@ -383,6 +433,10 @@ func ConfigCommon(cfg *config.Common) Option {
 				Override(new(dtypes.BootstrapPeers), modules.ConfigBootstrap(cfg.Libp2p.BootstrapPeers)),
 			),
 		),
+		ApplyIf(func(s *Settings) bool { return s.Online },
+			Override(new(*clockdrift.Checker), modules.ClockChecker(cfg.ClockCheck)),
+			Override(new(*alerting.Alerting), modules.Alerting(cfg.Alerting)),
+		),
 		Override(AddrsFactoryKey, lp2p.AddrsFactory(
 			cfg.Libp2p.AnnounceAddresses,
 			cfg.Libp2p.NoAnnounceAddresses)),
@@ -395,6 +449,12 @@ func ConfigFullNode(c interface{}) Option {
 		return Error(xerrors.Errorf("invalid config from repo, got: %T", c))
 	}
 
+	// network params are read when components are constructed, so they're
+	// applied right away
+	if err := build.ApplyNetworkParams(cfg.NetworkParams); err != nil {
+		return Error(xerrors.Errorf("applying network params from config: %w", err))
+	}
+
 	ipfsMaddr := cfg.Client.IpfsMAddr
 	useForRetrieval := cfg.Client.IpfsUseForRetrieval
 	return Options(
@@ -405,6 +465,74 @@ func ConfigFullNode(c interface{}) Option {
 		If(cfg.Metrics.HeadNotifs,
 			Override(HeadMetricsKey, metrics.SendHeadNotifs(cfg.Metrics.Nickname)),
 		),
+		ApplyIf(func(s *Settings) bool { return s.Online },
+			Override(RunAlertsKey, modules.RunFullNodeAlerts(cfg.Alerting)),
+		),
+		ApplyIf(func(s *Settings) bool { return s.Online && cfg.StatePrewarm.Enable },
+			Override(PrewarmStateKey, modules.PrewarmState(cfg.StatePrewarm)),
+		),
+		Override(new(blocksync.ServerLimits), modules.BlocksyncServerLimits(cfg.BlocksyncServer)),
+		Override(new(blocksync.ClientTimeouts), modules.BlocksyncClientTimeouts(cfg.BlocksyncClient)),
+		If(cfg.MessageAudit.Enable,
+			Override(new(*msgaudit.Log), modules.MessageAuditLog),
+		),
+		If(cfg.SyncBranches.Parallel > 0,
+			Override(new(chain.SyncWorkers), chain.SyncWorkers(cfg.SyncBranches.Parallel)),
+		),
+		If(cfg.SyncBranches.TargetThreshold > 0,
+			Override(new(chain.SyncTargetThreshold), chain.SyncTargetThreshold(cfg.SyncBranches.TargetThreshold)),
+		),
+		If(cfg.SnapshotServer.Enable,
+			Override(RunSnapshotServerKey, modules.RunSnapshotServer(cfg.SnapshotServer)),
+		),
+		Override(new(chain.ClockSkewPolicy), chain.ClockSkewPolicy{
+			AllowedFutureSecs: cfg.ClockSkew.AllowedFutureSecs,
+			RejectMisaligned:  cfg.ClockSkew.RejectMisaligned,
+		}),
+		If(len(cfg.SyncCheckpoints.Tipsets) > 0,
+			Override(new(*chain.Checkpoints), modules.SyncCheckpoints(cfg.SyncCheckpoints)),
+		),
+		If(cfg.SyncPrefetch.Workers > 0,
+			Override(new(chain.Prefetcher), modules.SyncPrefetcher(cfg.SyncPrefetch)),
+		),
+		If(len(cfg.ExperimentalActors.Routes) > 0,
+			Override(RouteActorsKey, modules.RouteExperimentalActors(cfg.ExperimentalActors)),
+		),
+		ApplyIf(func(s *Settings) bool { return s.Online && len(cfg.Deposits.Addresses) > 0 },
+			Override(new(*deposits.Scanner), modules.DepositScanner(cfg.Deposits)),
+		),
+		ApplyIf(func(s *Settings) bool { return s.Online },
+			Override(SetChainCacheKey, modules.SetChainCacheSizes(cfg.ChainCache)),
+			Override(SetMpoolConfigKey, modules.SetMpoolConfig(cfg.Mpool)),
+		),
+		If(cfg.ColdStore.Type != "",
+			Override(new(*coldstore.Split), modules.ColdSplitBlockstore(cfg.ColdStore)),
+			Override(new(dtypes.ChainBlockstore), modules.SplitChainBlockstore),
+		),
+		ApplyIf(func(s *Settings) bool { return s.Online && cfg.ColdStore.Type != "" },
+			Override(RunColdMoverKey, modules.RunColdMover(cfg.ColdStore)),
+		),
+		ApplyIf(func(s *Settings) bool { return s.Online && cfg.SharedBlockstore.Enable },
+			Override(RunSharedBlockstoreKey, modules.RunSharedBlockstore(cfg.SharedBlockstore)),
+		),
+		ApplyIf(func(s *Settings) bool { return s.Online && cfg.ChainPrune.KeepStateRoots > 0 },
+			Override(RunChainPrunerKey, modules.RunChainPruner(cfg.ChainPrune)),
+		),
+		ApplyIf(func(s *Settings) bool { return s.Online && cfg.UpgradeDryRun.EpochsBefore > 0 },
+			Override(new(*stmgr.UpgradeDryRunner), modules.UpgradeDryRunner(cfg.UpgradeDryRun)),
+		),
+		ApplyIf(func(s *Settings) bool { return s.Online && cfg.EpochRollups.Enable },
+			Override(new(*rollups.Indexer), modules.RollupIndexer),
+		),
+		ApplyIf(func(s *Settings) bool { return s.Online && cfg.MsgIndex.Enable },
+			Override(new(*msgindex.Index), modules.MsgIndex),
+		),
+		ApplyIf(func(s *Settings) bool { return s.Online && cfg.Changefeed.Enable },
+			Override(new(*changefeed.Feed), modules.Changefeed(cfg.Changefeed)),
+		),
+		If(cfg.Metrics.TelemetryCollector != "",
+			Override(TelemetryKey, metrics.SendTelemetry(cfg.Metrics.Nickname, cfg.Metrics.TelemetryCollector, time.Duration(cfg.Metrics.TelemetryInterval))),
+		),
 	)
 }
 
@@ -418,6 +546,19 @@ func ConfigStorageMiner(c interface{}) Option {
 		ConfigCommon(&cfg.Common),
 
 		Override(new(sectorstorage.SealerConfig), cfg.Storage),
+		Override(new(storage.ResubmitConfig), modules.ResubmitConfig(cfg.MessageResubmit)),
+		ApplyIf(func(s *Settings) bool { return s.Online },
+			Override(RunAlertsKey, modules.RunMinerAlerts(cfg.Alerting)),
+			If(cfg.SealingWatchdog.CheckInterval > 0,
+				Override(new(*storage.Watchdog), modules.SealingWatchdog(cfg.SealingWatchdog)),
+			),
+			If(cfg.CommitDeadlines.CheckInterval > 0,
+				Override(new(*storage.CommitDeadlines), modules.CommitDeadlines(cfg.CommitDeadlines)),
+			),
+			If(cfg.PledgePolicy.CheckInterval > 0,
+				Override(new(*storage.PledgePolicy), modules.PledgePolicy(cfg.PledgePolicy)),
+			),
+		),
 	)
 }
 
@@ -480,6 +621,10 @@ func New(ctx context.Context, opts ...Option) (StopFunc, error) {
 		return nil, xerrors.Errorf("applying node options failed: %w", err)
 	}
 
+	// components read the network params without synchronization, so they
+	// can't change anymore
+	build.FreezeNetworkParams()
+
 	// gather constructors for fx.Options
 	ctors := make([]fx.Option, 0, len(settings.modules))
 	for _, opt := range settings.modules {
@@ -517,6 +662,7 @@ func Test() Option {
 	return Options(
 		Unset(RunPeerMgrKey),
 		Unset(new(*peermgr.PeerMgr)),
+		Unset(RunClockCheckKey),
 		Override(new(beacon.RandomBeacon), testing.RandomBeacon),
 	)
 }
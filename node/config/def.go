@@ -7,20 +7,51 @@ import (
 	"github.com/ipfs/go-cid"
 
 	sectorstorage "github.com/filecoin-project/sector-storage"
+
+	"github.com/filecoin-project/lotus/build"
 )
 
 // Common is common config between full node and miner
 type Common struct {
-	API    API
-	Libp2p Libp2p
-	Pubsub Pubsub
+	API        API
+	Libp2p     Libp2p
+	Pubsub     Pubsub
+	ClockCheck ClockCheck
+	Alerting   Alerting
+	Journal    Journal
 }
 
 // FullNode is a full node config
 type FullNode struct {
 	Common
-	Client  Client
-	Metrics Metrics
+	Client       Client
+	Metrics      Metrics
+	StatePrewarm StatePrewarm
+	Deposits     Deposits
+
+	BlocksyncServer  BlocksyncServer
+	BlocksyncClient  BlocksyncClient
+	SyncPrefetch     SyncPrefetch
+	SyncBranches     SyncBranches
+	SyncCheckpoints  SyncCheckpoints
+	ClockSkew        ClockSkew
+	SnapshotServer   SnapshotServer
+	ChainPrune       ChainPrune
+	ColdStore        ColdStore
+	SharedBlockstore SharedBlockstore
+	ChainCache       ChainCache
+	Mpool            Mpool
+	MessageAudit     MessageAudit
+	EpochRollups     EpochRollups
+	MsgIndex         MsgIndex
+	Changefeed       Changefeed
+	UpgradeDryRun    UpgradeDryRun
+
+	ExperimentalActors ExperimentalActors
+
+	// NetworkParams override the parameters of the build and the ones in the
+	// genesis file, for custom networks
+	NetworkParams build.NetworkParams
 }
 
 // // Common
@@ -29,8 +60,12 @@ type FullNode struct {
 type StorageMiner struct {
 	Common
 
-	Dealmaking DealmakingConfig
-	Storage    sectorstorage.SealerConfig
+	Dealmaking      DealmakingConfig
+	Storage         sectorstorage.SealerConfig
+	SealingWatchdog SealingWatchdog
+	CommitDeadlines CommitDeadlines
+	PledgePolicy    PledgePolicy
+	MessageResubmit MessageResubmit
 }
 
 type DealmakingConfig struct {
@@ -41,6 +76,90 @@ type DealmakingConfig struct {
 	PieceCidBlocklist             []cid.Cid
 }
 
+// SealingWatchdog configures detection of sectors which spend much longer in
+// a sealing phase than expected.
+type SealingWatchdog struct {
+	// CheckInterval is how often sectors are checked, zero disables the
+	// watchdog
+	CheckInterval Duration
+
+	// Multiplier of the expected phase duration after which a sector is
+	// considered stuck. PhaseMultipliers override it for single phases, e.g.
+	// {PreCommit1 = 2.0}, a multiplier of zero disables the check.
+	Multiplier       float64
+	PhaseMultipliers map[string]float64
+
+	// Action taken on stuck sectors, one of:
+	// - report: only list them in the API and raise an alert
+	// - retry: abort the running task, so that the phase is retried on any
+	//   suitable worker, up to MaxRetries times, then abort the sector
+	// - abort: move the sector to FailedUnrecoverable
+	Action     string
+	MaxRetries int
+}
+
+// CommitDeadlines configures tracking of the epochs by which the precommit
+// and ProveCommit messages of sectors have to land.
+type CommitDeadlines struct {
+	// CheckInterval is how often sectors are checked, zero disables the
+	// tracking
+	CheckInterval Duration
+
+	// WarnEpochs is how close to a deadline a sector is reported at risk
+	WarnEpochs uint64
+
+	// Action taken on sectors which missed a deadline, one of:
+	// - report: only list them in the API and raise an alert
+	// - reprecommit: seal sectors whose ticket expired before the precommit
+	//   landed again with a new ticket, abort sectors which missed their
+	//   ProveCommit deadline
+	Action string
+}
+
+// PledgePolicy configures pledging committed capacity sectors automatically,
+// when the sealing pipeline has room that isn't kept for deals.
+type PledgePolicy struct {
+	// CheckInterval is how often the policy is evaluated, at most one sector
+	// is pledged per check. Zero disables the policy.
+	CheckInterval Duration
+
+	// MaxSealingSectors is the number of sectors sealed at the same time,
+	// with and without deals
+	MaxSealingSectors int
+	// DealFillRatio is the share of MaxSealingSectors kept for sectors with
+	// deals, CC sectors are only pledged into the rest. 1 only seals deals.
+	DealFillRatio float64
+
+	// PledgeBudget is the number of CC sectors pledged in every BudgetPeriod,
+	// zero means no limit
+	PledgeBudget int
+	BudgetPeriod Duration
+
+	// MaxProvingSectors stops pledging once the miner has this many sectors,
+	// sealing and proving, e.g. what its hardware can prove in time. Zero
+	// means no limit.
+	MaxProvingSectors int
+
+	// FailedGracePeriod is how long sectors in a failed sealing state, which
+	// are retried, count against the pipeline. Sectors failed for longer are
+	// considered stuck, and don't keep new sectors from being pledged.
+	FailedGracePeriod Duration
+}
+
+// MessageResubmit configures replacement of critical messages, currently
+// WindowPoSts, which aren't included in time.
+type MessageResubmit struct {
+	// AfterEpochs is the number of epochs after which a message which wasn't
+	// included is replaced with one paying a higher gas price. Zero disables
+	// resubmission.
+	AfterEpochs uint64
+	// FeeMultiplier is applied to the gas price of every replacement. The
+	// mpool only accepts replacements paying at least 1.25x the gas price.
+	FeeMultiplier float64
+	// MaxGasPrice caps the gas price of replacements, in attoFIL
+	MaxGasPrice string
+}
+
 // API contains configs for API endpoint
 type API struct {
 	ListenAddress       string
@@ -67,11 +186,344 @@ type Pubsub struct {
 	RemoteTracer string
 }
 
+// ClockCheck configures the local clock drift checker
+type ClockCheck struct {
+	// NTPServers are queried to measure the local clock offset. When empty,
+	// drift is only estimated from the timestamps of incoming blocks.
+	NTPServers []string
+	Interval   Duration
+	MaxDrift   Duration
+
+	// RefuseToMine suspends block production while the drift exceeds
+	// MaxDrift. Only used by the storage miner.
+	RefuseToMine bool
+}
+
+// Alerting configures notifications about critical conditions. Every alert
+// is delivered once when raised, and once when resolved.
+type Alerting struct {
+	// Webhooks receive alerts as JSON POST requests
+	Webhooks []string
+	// Commands are run through 'sh -c' with the alert passed on stdin
+	Commands []string
+
+	CheckInterval Duration
+
+	// SyncStallEpochs raises an alert when the chain head falls more than
+	// this many epochs behind the wall clock. Zero disables the check. Only
+	// used by the full node.
+	SyncStallEpochs uint64
+
+	// WatchWallets are checked against MinWalletBalance (in FIL). Only used
+	// by the full node.
+	WatchWallets     []string
+	MinWalletBalance string
+
+	// MaxDiskUsage raises an alert when the filesystem holding the repo is
+	// fuller than this percentage. Zero disables the check.
+	MaxDiskUsage float64
+}
+
+// Journal configures the journal of significant node events, kept in the
+// journal directory of the repo.
+type Journal struct {
+	// MaxFileSize is the size at which a journal file is rolled
+	MaxFileSize int64
+	// MaxFiles and MaxAge limit which rolled files are kept. Zero means no
+	// limit.
+	MaxFiles int
+	MaxAge   Duration
+}
+
 // // Full Node
 
 type Metrics struct {
 	Nickname   string
 	HeadNotifs bool
+
+	// TelemetryCollector is the URL status reports are periodically posted
+	// to. Reports are signed with the node's libp2p key. Empty disables
+	// telemetry.
+	TelemetryCollector string
+	TelemetryInterval  Duration
+}
+
+// StatePrewarm configures loading frequently queried actor states into the
+// caches once the node catches up with the chain.
+type StatePrewarm struct {
+	// Enable is off by default, prewarming competes with sync for the
+	// blockstore
+	Enable bool
+	// Actors to prewarm, e.g. the power and market actors, and miners of
+	// interest
+	Actors []string
+	// Depth is the number of IPLD link levels below each actor's state head
+	// that are loaded
+	Depth int
+}
+
+// Deposits configures tracking of incoming transfers to a set of addresses,
+// e.g. the deposit wallets of an exchange.
+type Deposits struct {
+	// Addresses to track transfers to, tracking is disabled when empty
+	Addresses []string
+	// Confirmations is the number of epochs that need to be built on top of
+	// a deposit before it's reported as confirmed
+	Confirmations uint64
+}
+
+// BlocksyncServer limits the load peers can put on the blocksync server.
+// Requests over a limit are refused with a hint when to retry.
+type BlocksyncServer struct {
+	// PeerRequestRate is the number of requests per second served to a
+	// single peer, zero disables the limit
+	PeerRequestRate  float64
+	PeerRequestBurst int
+	// PeerTipSetRate is the number of tipsets per second served to a single
+	// peer, zero disables the limit
+	PeerTipSetRate  float64
+	PeerTipSetBurst int
+
+	// MaxConcurrentRequests is the number of requests processed at the same
+	// time, from all peers. Zero means no limit.
+	MaxConcurrentRequests int
+	// PeerQueueLength is the number of requests of a single peer waiting for
+	// a processing slot, waiting peers get free slots in turn
+	PeerQueueLength int
+	QueueTimeout    Duration
+	BusyRetryAfter  Duration
+
+	// PeerByteQuota is the number of response bytes sent to a single peer in
+	// every QuotaWindow, larger responses are cut short. Zero disables the
+	// quota, it can't be lower than the maximum response size of 512MiB.
+	PeerByteQuota int64
+	QuotaWindow   Duration
+}
+
+// SyncPrefetch configures loading the messages and actor states the next
+// tipset needs into the state cache (see ChainCache), while the current one
+// is validated.
+type SyncPrefetch struct {
+	// Workers is the number of tipsets prefetched in parallel, zero disables
+	// prefetching
+	Workers int
+	// Queue is the number of tipsets waiting to be prefetched, further
+	// tipsets are skipped
+	Queue int
+	// Parallelism is the number of actors each worker loads at once
+	Parallelism int
+}
+
+// SharedBlockstore configures serving the chain blockstore to other processes
+// on this machine, e.g. the storage miner, over a unix socket. Clients cache
+// the objects they read, and are notified when objects are pruned.
+type SharedBlockstore struct {
+	Enable bool
+	// Path is the path of the socket, relative to the repo unless it's
+	// absolute
+	Path string
+}
+
+// ChainCache configures the number of tipsets, block headers and state
+// objects the chain store keeps in memory
+type ChainCache struct {
+	TipSets      int
+	BlockHeaders int
+	// StateObjects is the number of objects read from the blockstore, mostly
+	// state, kept in memory. The sync prefetcher loads the state the next
+	// tipset is executed on into it, zero disables the cache.
+	StateObjects int
+}
+
+// Mpool configures the message pool
+type Mpool struct {
+	// PendingFundsTolerance is the percentage of a sender's balance by which
+	// the value and maximum fees of its pending messages may exceed the
+	// balance. Messages over the limit are rejected.
+	PendingFundsTolerance uint64
+
+	// RepublishInterval is the time between rounds of republishing pending
+	// local messages. Each message is republished with exponential backoff,
+	// starting at the interval. Zero republishes every 10 epochs.
+	RepublishInterval Duration
+	// RepublishMaxAttempts is the number of times a local message is
+	// republished before giving up on it, zero means no limit
+	RepublishMaxAttempts int
+}
+
+// MessageAudit configures the audit log of messages pushed through the API,
+// kept in the audit directory of the repo. The log is tamper-evident, its
+// entries are authenticated with a key kept in the keystore, and it's never
+// pruned. Messages are only pushed once they are recorded.
+type MessageAudit struct {
+	Enable bool
+}
+
+// ClockSkew configures how the timestamps of synced blocks are checked
+type ClockSkew struct {
+	// AllowedFutureSecs is how far ahead of the local clock block timestamps
+	// may be. Blocks further ahead are retried once the clock catches up.
+	AllowedFutureSecs uint64
+	// RejectMisaligned rejects blocks whose timestamp is after the start of
+	// their epoch, instead of logging a warning
+	RejectMisaligned bool
+}
+
+// SyncBranches configures syncing competing branches of the chain, e.g.
+// while resolving forks.
+type SyncBranches struct {
+	// Parallel is the maximum number of independent branches fetched and
+	// validated at the same time. Ancestors shared by the branches are
+	// validated once.
+	Parallel int
+	// TargetThreshold is the number of times a chain has to be reported by
+	// peers before it's synced
+	TargetThreshold int
+}
+
+// SyncCheckpoints are tipsets trusted to be part of the canonical chain, in
+// addition to the ones built into the binary and the ones added with
+// SyncCheckpoint. Chains which don't contain them are refused.
+type SyncCheckpoints struct {
+	// Tipsets are checkpoints in the `height:cid[,cid...]` format
+	Tipsets []string
+}
+
+// SnapshotServer serves recent chain snapshots to trusted peers, e.g. other
+// nodes of the same operator, which fetch them with
+// 'lotus chain fetch-snapshot'.
+type SnapshotServer struct {
+	Enable bool
+
+	// TrustedPeers are the IDs of the peers allowed to fetch snapshots
+	TrustedPeers []string
+
+	// RecentStateRoots is the number of recent epochs whose state is
+	// included in snapshots
+	RecentStateRoots int64
+
+	// MaxAge is how long a snapshot is served before a new one is created
+	MaxAge Duration
+}
+
+// BlocksyncClient configures how long the node waits for peers serving
+// blocksync requests.
+type BlocksyncClient struct {
+	// WriteTimeout is the deadline for sending a request
+	WriteTimeout Duration
+
+	// MinResponseSpeed is the minimum sustained speed of a response, in bytes
+	// per second
+	MinResponseSpeed int64
+
+	// ReadWait is the longest a read of a response may stall. It's extended
+	// by ReadWaitPerTipSet for every requested tipset, up to MaxReadWait, so
+	// that large requests on slow links don't time out.
+	ReadWait          Duration
+	ReadWaitPerTipSet Duration
+	MaxReadWait       Duration
+
+	// PreferGraphsync fetches chain segments over graphsync from peers which
+	// support it, falling back to blocksync when a traversal fails
+	PreferGraphsync bool
+}
+
+// ChainPrune configures periodically removing the objects of the chain
+// blockstore which aren't needed anymore, like the state of old tipsets. Block
+// headers, messages and receipts are kept.
+type ChainPrune struct {
+	// KeepStateRoots is the number of recent tipsets whose state is kept,
+	// at least finality. Zero disables pruning.
+	KeepStateRoots uint64
+	Interval       Duration
+}
+
+// ColdStore configures moving historical chain data out of the chain
+// blockstore, which only keeps recent data, into a cold store, e.g. on cheaper
+// disks. Moved data is read from the cold store transparently.
+type ColdStore struct {
+	// Type is the cold store backend, one of:
+	// - car: CAR files, with an index of the objects they contain
+	// - badger: a separate badger datastore
+	// - s3: a bucket of an S3 compatible object store, see S3
+	// Empty disables the cold store.
+	Type string
+	// Path is the directory of the cold store, relative to the repo unless
+	// it's absolute
+	Path string
+	S3   ColdStoreS3
+
+	// HotEpochs is the number of recent epochs whose chain data stays in the
+	// chain blockstore, at least finality
+	HotEpochs    uint64
+	MoveInterval Duration
+
+	// ShardSize is the size of CAR files, in bytes
+	ShardSize int64
+}
+
+// ColdStoreS3 configures the bucket of the s3 cold store. Buckets are
+// addressed by path, e.g. https://s3.us-east-1.amazonaws.com/<bucket>.
+type ColdStoreS3 struct {
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to the names of the objects in the bucket
+	Prefix string
+
+	// AccessKey and SecretKey are read from the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY environment variables when they're empty
+	AccessKey string
+	SecretKey string
+}
+
+// EpochRollups configures the indexer of per-epoch chain aggregates, used by
+// explorers through the Stats API.
+type EpochRollups struct {
+	Enable bool
+}
+
+// MsgIndex configures the index of the tipsets messages were executed in,
+// which message searches and receipt lookups use instead of walking the chain.
+// Messages executed before the index was enabled are indexed by rebuilding it,
+// with 'lotus state rebuild-msg-index'.
+type MsgIndex struct {
+	Enable bool
+}
+
+// Changefeed configures the persisted feed of the tipsets applied to and
+// reverted from the chain, streamed to external indexers through the
+// ChainChangefeed API.
+type Changefeed struct {
+	Enable bool
+
+	// Retention is the number of entries kept, zero keeps all of them
+	Retention uint64
+}
+
+// UpgradeDryRun configures running the state migrations of scheduled network
+// upgrades ahead of time, in the background, to find problems with them
+// before the upgrade is due.
+type UpgradeDryRun struct {
+	// EpochsBefore is how many epochs before an upgrade its migration is dry
+	// run, zero disables dry runs
+	EpochsBefore uint64
+}
+
+// ExperimentalActors routes actors to runtimes linked into the build, like an
+// experimental WASM runtime. This changes consensus rules, so it's only
+// available in devnet builds.
+type ExperimentalActors struct {
+	Routes []ActorRoute
+}
+
+type ActorRoute struct {
+	// Code is the actor code CID
+	Code string
+	// Runtime is the name the runtime was registered with
+	Runtime string
+	// ActivationHeight is the first epoch executed with the runtime
+	ActivationHeight int64
 }
 
 type Client struct {
@@ -103,6 +555,21 @@ func defCommon() Common {
 			DirectPeers:  nil,
 			RemoteTracer: "/ip4/147.75.67.199/tcp/4001/p2p/QmTd6UvR47vUidRNZ1ZKXHrAFhqTJAD27rKL9XYghEKgKX",
 		},
+		ClockCheck: ClockCheck{
+			NTPServers: []string{"pool.ntp.org"},
+			Interval:   Duration(10 * time.Minute),
+			MaxDrift:   Duration(time.Second),
+		},
+		Alerting: Alerting{
+			CheckInterval:   Duration(time.Minute),
+			SyncStallEpochs: 10,
+			MaxDiskUsage:    95,
+		},
+		Journal: Journal{
+			MaxFileSize: 1 << 30,
+			MaxFiles:    8,
+			MaxAge:      Duration(30 * 24 * time.Hour),
+		},
 	}
 
 }
@@ -111,6 +578,77 @@ func defCommon() Common {
 func DefaultFullNode() *FullNode {
 	return &FullNode{
 		Common: defCommon(),
+		Metrics: Metrics{
+			TelemetryInterval: Duration(5 * time.Minute),
+		},
+		StatePrewarm: StatePrewarm{
+			Actors: []string{"t04", "t05"},
+			Depth:  2,
+		},
+		UpgradeDryRun: UpgradeDryRun{
+			EpochsBefore: 120,
+		},
+		MsgIndex: MsgIndex{
+			Enable: true,
+		},
+		Changefeed: Changefeed{
+			Retention: 100000,
+		},
+		Deposits: Deposits{
+			Confirmations: 900,
+		},
+		BlocksyncServer: BlocksyncServer{
+			PeerRequestRate:       2,
+			PeerRequestBurst:      10,
+			PeerTipSetRate:        100,
+			PeerTipSetBurst:       1600,
+			MaxConcurrentRequests: 64,
+			PeerQueueLength:       4,
+			QueueTimeout:          Duration(5 * time.Second),
+			BusyRetryAfter:        Duration(time.Second),
+			PeerByteQuota:         1 << 30,
+			QuotaWindow:           Duration(time.Minute),
+		},
+		BlocksyncClient: BlocksyncClient{
+			WriteTimeout:      Duration(5 * time.Second),
+			MinResponseSpeed:  50 << 10,
+			ReadWait:          Duration(5 * time.Second),
+			ReadWaitPerTipSet: Duration(50 * time.Millisecond),
+			MaxReadWait:       Duration(time.Minute),
+		},
+		SyncPrefetch: SyncPrefetch{
+			Workers:     2,
+			Queue:       4,
+			Parallelism: 8,
+		},
+		SyncBranches: SyncBranches{
+			Parallel:        3,
+			TargetThreshold: 1,
+		},
+		SnapshotServer: SnapshotServer{
+			RecentStateRoots: 900,
+			MaxAge:           Duration(6 * time.Hour),
+		},
+		ChainPrune: ChainPrune{
+			Interval: Duration(24 * time.Hour),
+		},
+		ClockSkew: ClockSkew{
+			AllowedFutureSecs: build.AllowableClockDriftSecs,
+		},
+		ChainCache: ChainCache{
+			TipSets:      4096,
+			BlockHeaders: 8192,
+			StateObjects: 16384,
+		},
+		SharedBlockstore: SharedBlockstore{
+			Path: "blockstore.sock",
+		},
+		ColdStore: ColdStore{
+			Path:         "coldstore",
+			HotEpochs:    2 * 900,
+			MoveInterval: Duration(6 * time.Hour),
+			ShardSize:    1 << 30,
+		},
 	}
 }
 
@@ -132,6 +670,32 @@ func DefaultStorageMiner() *StorageMiner {
 			ConsiderOfflineRetrievalDeals: true,
 			PieceCidBlocklist:             []cid.Cid{},
 		},
+
+		SealingWatchdog: SealingWatchdog{
+			CheckInterval: Duration(5 * time.Minute),
+			Multiplier:    3,
+			Action:        "report",
+			MaxRetries:    2,
+		},
+
+		CommitDeadlines: CommitDeadlines{
+			CheckInterval: Duration(5 * time.Minute),
+			WarnEpochs:    720,
+			Action:        "report",
+		},
+
+		PledgePolicy: PledgePolicy{
+			MaxSealingSectors: 4,
+			DealFillRatio:     0.5,
+			BudgetPeriod:      Duration(24 * time.Hour),
+			FailedGracePeriod: Duration(time.Hour),
+		},
+
+		MessageResubmit: MessageResubmit{
+			AfterEpochs:   5,
+			FeeMultiplier: 1.5,
+			MaxGasPrice:   "1000",
+		},
 	}
 	cfg.Common.API.ListenAddress = "/ip4/127.0.0.1/tcp/2345/http"
 	cfg.Common.API.RemoteListenAddress = "127.0.0.1:2345"
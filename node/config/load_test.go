@@ -61,3 +61,35 @@ func TestParitalConfig(t *testing.T) {
 			"config from reader should contain changes")
 	}
 }
+
+func TestBlocksyncPreferGraphsync(t *testing.T) {
+	cfg, err := FromReader(bytes.NewReader([]byte(`
+		[BlocksyncClient]
+		PreferGraphsync = true
+		`)), DefaultFullNode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.(*FullNode).BlocksyncClient.PreferGraphsync {
+		t.Fatal("expected PreferGraphsync to be set")
+	}
+	if DefaultFullNode().BlocksyncClient.PreferGraphsync {
+		t.Fatal("expected blocksync to be preferred by default")
+	}
+}
+
+func TestSyncTargetThreshold(t *testing.T) {
+	cfg, err := FromReader(bytes.NewReader([]byte(`
+		[SyncBranches]
+		TargetThreshold = 3
+		`)), DefaultFullNode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th := cfg.(*FullNode).SyncBranches.TargetThreshold; th != 3 {
+		t.Fatalf("expected a target threshold of 3, got %d", th)
+	}
+	if th := DefaultFullNode().SyncBranches.TargetThreshold; th != 1 {
+		t.Fatalf("expected a default target threshold of 1, got %d", th)
+	}
+}
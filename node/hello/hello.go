@@ -18,6 +18,7 @@ import (
 	"github.com/filecoin-project/lotus/chain"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
+	incrt "github.com/filecoin-project/lotus/lib/increadtimeout"
 	"github.com/filecoin-project/lotus/lib/peermgr"
 )
 
@@ -25,6 +26,9 @@ const ProtocolID = "/fil/hello/1.0.0"
 
 var log = logging.Logger("hello")
 
+// ReadConfig is the read timeout of hello and latency messages, see incrt.Config
+var ReadConfig = incrt.Config{MinSpeed: 1 << 10, MaxWait: 10 * time.Second, SizeHint: 1 << 10}
+
 type HelloMessage struct {
 	HeaviestTipSet       []cid.Cid
 	HeaviestTipSetHeight abi.ChainEpoch
@@ -62,7 +66,7 @@ func NewHelloService(h host.Host, cs *store.ChainStore, syncer *chain.Syncer, pm
 func (hs *Service) HandleStream(s inet.Stream) {
 
 	var hmsg HelloMessage
-	if err := cborutil.ReadCborRPC(s, &hmsg); err != nil {
+	if err := cborutil.ReadCborRPC(incrt.NewWithConfig(s, ReadConfig), &hmsg); err != nil {
 		log.Infow("failed to read hello message, disconnecting", "error", err)
 		_ = s.Conn().Close()
 		return
@@ -79,6 +83,8 @@ func (hs *Service) HandleStream(s inet.Stream) {
 		_ = s.Conn().Close()
 		return
 	}
+	pid := s.Conn().RemotePeer()
+
 	go func() {
 		defer s.Close() //nolint:errcheck
 
@@ -92,7 +98,16 @@ func (hs *Service) HandleStream(s inet.Stream) {
 		}
 	}()
 
-	protos, err := hs.h.Peerstore().GetProtocols(s.Conn().RemotePeer())
+	// The peer is on our chain, so it is eligible for serving us chain data
+	// regardless of whether its head is interesting right now.
+	hs.admitPeer(pid)
+
+	if !hs.headIsInteresting(context.Background(), &hmsg) {
+		log.Debugw("not fetching head from hello", "peer", pid, "height", hmsg.HeaviestTipSetHeight)
+		return
+	}
+
+	protos, err := hs.h.Peerstore().GetProtocols(pid)
 	if err != nil {
 		log.Warnf("got error from peerstore.GetProtocols: %s", err)
 	}
@@ -102,23 +117,50 @@ func (hs *Service) HandleStream(s inet.Stream) {
 		time.Sleep(time.Millisecond * 300)
 	}
 
-	ts, err := hs.syncer.FetchTipSet(context.Background(), s.Conn().RemotePeer(), types.NewTipSetKey(hmsg.HeaviestTipSet...))
+	ts, err := hs.syncer.FetchTipSet(context.Background(), pid, types.NewTipSetKey(hmsg.HeaviestTipSet...))
 	if err != nil {
 		log.Errorf("failed to fetch tipset from peer during hello: %+v", err)
 		return
 	}
 
 	if ts.TipSet().Height() > 0 {
-		hs.h.ConnManager().TagPeer(s.Conn().RemotePeer(), "fcpeer", 10)
+		hs.h.ConnManager().TagPeer(pid, "fcpeer", 10)
 
 		// don't bother informing about genesis
-		log.Infof("Got new tipset through Hello: %s from %s", ts.Cids(), s.Conn().RemotePeer())
-		hs.syncer.InformNewHead(s.Conn().RemotePeer(), ts)
+		log.Infof("Got new tipset through Hello: %s from %s", ts.Cids(), pid)
+		hs.syncer.InformNewHead(pid, ts)
 	}
+}
+
+// admitPeer registers a peer that passed the genesis check with the peer
+// manager and with blocksync, so that it is used for chain sync.
+func (hs *Service) admitPeer(p peer.ID) {
 	if hs.pmgr != nil {
-		hs.pmgr.AddFilecoinPeer(s.Conn().RemotePeer())
+		hs.pmgr.AddFilecoinPeer(p)
+	}
+	hs.syncer.Bsync.AddPeer(p)
+}
+
+// headIsInteresting checks whether the head advertised in a hello message
+// could become our sync target. Heads that are impossibly high, or lighter
+// than our current head, aren't worth fetching.
+func (hs *Service) headIsInteresting(ctx context.Context, hmsg *HelloMessage) bool {
+	if hmsg.HeaviestTipSetHeight == 0 {
+		return false
+	}
+
+	if hs.syncer.IsEpochBeyondCurrMax(hmsg.HeaviestTipSetHeight) {
+		log.Warnf("peer advertised impossibly large height %d in hello", hmsg.HeaviestTipSetHeight)
+		return false
+	}
+
+	ours, err := hs.cs.Weight(ctx, hs.cs.GetHeaviestTipSet())
+	if err != nil {
+		log.Warnf("computing our head weight: %s", err)
+		return true
 	}
 
+	return !hmsg.HeaviestTipSetWeight.LessThan(ours)
 }
 
 func (hs *Service) SayHello(ctx context.Context, pid peer.ID) error {
@@ -155,8 +197,7 @@ func (hs *Service) SayHello(ctx context.Context, pid peer.ID) error {
 		defer s.Close() //nolint:errcheck
 
 		lmsg := &LatencyMessage{}
-		_ = s.SetReadDeadline(time.Now().Add(10 * time.Second))
-		err := cborutil.ReadCborRPC(s, lmsg)
+		err := cborutil.ReadCborRPC(incrt.NewWithConfig(s, ReadConfig), lmsg)
 		if err != nil {
 			log.Infow("reading latency message", "error", err)
 		}
@@ -23,6 +23,7 @@ import (
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
 	files "github.com/ipfs/go-ipfs-files"
 	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipfs/go-merkledag"
 	unixfile "github.com/ipfs/go-unixfs/file"
 	"github.com/ipfs/go-unixfs/importer/balanced"
@@ -43,12 +44,15 @@ import (
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/envelope"
 	"github.com/filecoin-project/lotus/markets/utils"
 	"github.com/filecoin-project/lotus/node/impl/full"
 	"github.com/filecoin-project/lotus/node/impl/paych"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
 
+var log = logging.Logger("client")
+
 const dealStartBuffer abi.ChainEpoch = 10000 // TODO: allow setting
 
 type API struct {
@@ -67,6 +71,9 @@ type API struct {
 	LocalDAG   dtypes.ClientDAG
 	Blockstore dtypes.ClientBlockstore
 	Filestore  dtypes.ClientFilestore `optional:"true"`
+
+	DS       dtypes.MetadataDS
+	Keystore types.KeyStore
 }
 
 func calcDealExpiration(minDuration uint64, md *miner.DeadlineInfo, startEpoch abi.ChainEpoch) abi.ChainEpoch {
@@ -166,6 +173,11 @@ func (a *API) ClientListDeals(ctx context.Context) ([]api.DealInfo, error) {
 			Duration:      uint64(v.Proposal.Duration()),
 			DealID:        v.DealID,
 		}
+		if v.DataRef != nil {
+			if out[k].Encryption, err = a.envelopeInfo(v.DataRef.Root); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return out, nil
@@ -177,7 +189,7 @@ func (a *API) ClientGetDealInfo(ctx context.Context, d cid.Cid) (*api.DealInfo,
 		return nil, err
 	}
 
-	return &api.DealInfo{
+	di := &api.DealInfo{
 		ProposalCid:   v.ProposalCid,
 		State:         v.State,
 		Message:       v.Message,
@@ -187,7 +199,13 @@ func (a *API) ClientGetDealInfo(ctx context.Context, d cid.Cid) (*api.DealInfo,
 		PricePerEpoch: v.Proposal.StoragePricePerEpoch,
 		Duration:      uint64(v.Proposal.Duration()),
 		DealID:        v.DealID,
-	}, nil
+	}
+	if v.DataRef != nil {
+		if di.Encryption, err = a.envelopeInfo(v.DataRef.Root); err != nil {
+			return nil, err
+		}
+	}
+	return di, nil
 }
 
 func (a *API) ClientHasLocal(ctx context.Context, root cid.Cid) (bool, error) {
@@ -437,7 +455,7 @@ func (a *API) ClientRetrieve(ctx context.Context, order api.RetrievalOrder, ref
 	if err != nil {
 		return xerrors.Errorf("ClientRetrieve: %w", err)
 	}
-	return files.WriteTo(file, ref.Path)
+	return a.writeFiles(order.Root, file, ref.Path)
 }
 
 func (a *API) ClientQueryAsk(ctx context.Context, p peer.ID, miner address.Address) (*storagemarket.SignedStorageAsk, error) {
@@ -527,6 +545,13 @@ func (a *API) clientImport(ref api.FileRef, bufferedDS *ipld.BufferedDAG) (cid.C
 		return cid.Undef, err
 	}
 
+	if ref.Encrypt {
+		if ref.IsCAR {
+			return cid.Undef, xerrors.New("car imports can't be encrypted")
+		}
+		return a.clientImportEncrypted(file, bufferedDS)
+	}
+
 	if ref.IsCAR {
 		var store car.Store
 		if a.Filestore == nil {
@@ -569,3 +594,42 @@ func (a *API) clientImport(ref api.FileRef, bufferedDS *ipld.BufferedDAG) (cid.C
 
 	return nd.Cid(), nil
 }
+
+// clientImportEncrypted imports the file in an envelope. The encrypted data
+// is copied into the blockstore, the filestore can't reference it.
+func (a *API) clientImportEncrypted(file io.Reader, bufferedDS *ipld.BufferedDAG) (cid.Cid, error) {
+	key, err := a.encryptionKey(true)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	er, info, err := envelope.Encrypt(file, key)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("encrypting payload: %w", err)
+	}
+
+	params := ihelper.DagBuilderParams{
+		Maxlinks:   build.UnixfsLinksPerLevel,
+		RawLeaves:  true,
+		CidBuilder: nil,
+		Dagserv:    bufferedDS,
+	}
+
+	db, err := params.New(chunker.NewSizeSplitter(er, int64(build.UnixfsChunkSize)))
+	if err != nil {
+		return cid.Undef, err
+	}
+	nd, err := balanced.Layout(db)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	if err := bufferedDS.Commit(); err != nil {
+		return cid.Undef, err
+	}
+
+	if err := a.recordEnvelope(nd.Cid(), info); err != nil {
+		return cid.Undef, xerrors.Errorf("recording payload encryption: %w", err)
+	}
+	return nd.Cid(), nil
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	files "github.com/ipfs/go-ipfs-files"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/envelope"
+)
+
+// EncryptionKeyName is the name of the payload encryption key in the keystore
+const EncryptionKeyName = "client-payload-encryption" //nolint:gosec
+
+var envelopePrefix = datastore.NewKey("/client/envelopes")
+
+func (a *API) encryptionKey(create bool) ([]byte, error) {
+	ki, err := a.Keystore.Get(EncryptionKeyName)
+	if err == nil {
+		return ki.PrivateKey, nil
+	}
+	if !errors.Is(err, types.ErrKeyInfoNotFound) || !create {
+		return nil, xerrors.Errorf("getting payload encryption key: %w", err)
+	}
+
+	log.Warn("Generating new payload encryption key")
+
+	key, err := envelope.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.Keystore.Put(EncryptionKeyName, types.KeyInfo{
+		Type:       "payload-encryption",
+		PrivateKey: key,
+	}); err != nil {
+		return nil, xerrors.Errorf("storing payload encryption key: %w", err)
+	}
+	return key, nil
+}
+
+// recordEnvelope remembers that the payload is encrypted, for the deals
+// storing it
+func (a *API) recordEnvelope(root cid.Cid, info envelope.Info) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return a.DS.Put(envelopePrefix.ChildString(root.String()), b)
+}
+
+func (a *API) envelopeInfo(root cid.Cid) (*envelope.Info, error) {
+	b, err := a.DS.Get(envelopePrefix.ChildString(root.String()))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var info envelope.Info
+	if err := json.Unmarshal(b, &info); err != nil {
+		return nil, xerrors.Errorf("decoding envelope info of %s: %w", root, err)
+	}
+	return &info, nil
+}
+
+// writeFiles writes the retrieved files of the payload root to path. Payloads
+// recorded as encrypted on import are decrypted with the local key, into a
+// temporary file which replaces path once the whole payload is decrypted and
+// authenticated. Other payloads are written as they are, whatever they start
+// with. Only payloads imported on this node are known to be encrypted.
+func (a *API) writeFiles(root cid.Cid, nd files.Node, path string) error {
+	info, err := a.envelopeInfo(root)
+	if err != nil {
+		return xerrors.Errorf("getting envelope info: %w", err)
+	}
+
+	f, ok := nd.(files.File)
+	if _, link := nd.(*files.Symlink); !ok || link {
+		if info != nil {
+			return xerrors.Errorf("encrypted payload %s isn't a file", root)
+		}
+		return writeNode(nd, path)
+	}
+	if info == nil {
+		// the output path is chosen by the caller, it may be overwritten
+		return writeFile(f, path, os.O_TRUNC)
+	}
+
+	key, err := a.encryptionKey(false)
+	if err != nil {
+		return xerrors.Errorf("payload is encrypted: %w", err)
+	}
+	src, err := envelope.Decrypt(f, key)
+	if err != nil {
+		return xerrors.Errorf("decrypting payload: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return xerrors.Errorf("decrypting payload: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	// the output path is chosen by the caller, it may be overwritten
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	files "github.com/ipfs/go-ipfs-files"
+
+	"github.com/filecoin-project/lotus/chain/wallet"
+	"github.com/filecoin-project/lotus/lib/envelope"
+)
+
+func TestWriteFilesEnvelope(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lotus-envelope-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	a := &API{
+		DS:       dssync.MutexWrap(datastore.NewMapDatastore()),
+		Keystore: wallet.NewMemKeyStore(),
+	}
+	key, err := a.encryptionKey(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := []byte("payload")
+	r, info, err := envelope.Encrypt(bytes.NewReader(plain), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted := blocks.NewBlock([]byte("encrypted")).Cid()
+	if err := a.recordEnvelope(encrypted, info); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out")
+	if err := a.writeFiles(encrypted, files.NewBytesFile(sealed), out); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(out); err != nil || !bytes.Equal(b, plain) {
+		t.Fatalf("expected the payload to be decrypted: %v", err)
+	}
+
+	// payloads which weren't encrypted are written as they are, even when they
+	// look like an envelope
+	other := blocks.NewBlock([]byte("plain")).Cid()
+	if err := a.writeFiles(other, files.NewBytesFile(sealed), out); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(out); err != nil || !bytes.Equal(b, sealed) {
+		t.Fatalf("expected the plaintext payload to be written as it is: %v", err)
+	}
+
+	// a payload which fails authentication doesn't replace the output
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if err := a.writeFiles(encrypted, files.NewBytesFile(tampered), out); err == nil {
+		t.Fatal("expected the tampered payload to be refused")
+	}
+	if b, err := ioutil.ReadFile(out); err != nil || !bytes.Equal(b, sealed) {
+		t.Fatalf("expected the output to be left as it was: %v", err)
+	}
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 1 {
+		t.Fatalf("expected no partially decrypted file to be left behind, got %d files", len(ents))
+	}
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	levelds "github.com/ipfs/go-ds-leveldb"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-merkledag"
+	unixfile "github.com/ipfs/go-unixfs/file"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+// ClientExtract rebuilds the files of a payload from a CAR file, or from an
+// unsealed piece holding one, followed by zero padding. Encrypted payloads are
+// decrypted.
+//
+// The input is untrusted: its blocks are loaded in a temporary store, which is
+// removed afterwards, and the files can't be written outside of outdir.
+func (a *API) ClientExtract(ctx context.Context, inpath string, payload cid.Cid, outdir string) (*api.ExtractResult, error) {
+	f, err := os.Open(inpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck // read only
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempDir("", "lotus-extract")
+	if err != nil {
+		return nil, xerrors.Errorf("creating temporary blockstore: %w", err)
+	}
+	defer os.RemoveAll(tmp) //nolint:errcheck
+
+	ds, err := levelds.NewDatastore(tmp, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("opening temporary blockstore: %w", err)
+	}
+	defer ds.Close() //nolint:errcheck
+	bs := blockstore.NewBlockstore(ds)
+
+	roots, blks, err := loadPaddedCar(pieceReader(f, st.Size()), bs)
+	if err != nil {
+		return nil, xerrors.Errorf("loading %s: %w", inpath, err)
+	}
+
+	if payload == cid.Undef {
+		if len(roots) != 1 {
+			return nil, xerrors.Errorf("car has %d roots, the payload cid must be given", len(roots))
+		}
+		payload = roots[0]
+	}
+
+	// every block was checked against its cid when loaded, so the files are
+	// valid if the dag below the payload cid is complete
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	if err := merkledag.FetchGraph(ctx, payload, dag); err != nil {
+		return nil, xerrors.Errorf("payload %s isn't complete: %w", payload, err)
+	}
+
+	nd, err := dag.Get(ctx, payload)
+	if err != nil {
+		return nil, xerrors.Errorf("getting payload root: %w", err)
+	}
+	file, err := unixfile.NewUnixfsFile(ctx, dag, nd)
+	if err != nil {
+		return nil, xerrors.Errorf("payload %s isn't unixfs: %w", payload, err)
+	}
+
+	out := &api.ExtractResult{
+		Root:   payload,
+		Path:   filepath.Join(outdir, payload.String()),
+		Blocks: blks,
+	}
+
+	if err := a.writeFiles(payload, file, out.Path); err != nil {
+		return nil, xerrors.Errorf("writing files: %w", err)
+	}
+
+	if err := filepath.Walk(out.Path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			out.Files++
+			out.Bytes += info.Size()
+		}
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("listing written files: %w", err)
+	}
+
+	return out, nil
+}
+
+// loadPaddedCar loads the blocks of a car into bs, after checking them against
+// their cids. A zero length prefix ends the car, pieces are padded with zeros.
+func loadPaddedCar(r io.Reader, bs blockstore.Blockstore) ([]cid.Cid, int, error) {
+	br := bufio.NewReader(r)
+
+	header, err := car.ReadHeader(br)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("reading car header: %w", err)
+	}
+
+	var n int
+	for {
+		next, err := br.Peek(1)
+		if err == io.EOF || (err == nil && next[0] == 0) {
+			return header.Roots, n, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		c, data, err := carutil.ReadNode(br)
+		if err != nil {
+			return nil, 0, xerrors.Errorf("reading block: %w", err)
+		}
+
+		sum, err := c.Prefix().Sum(data)
+		if err != nil {
+			return nil, 0, xerrors.Errorf("hashing block %s: %w", c, err)
+		}
+		if !sum.Equals(c) {
+			return nil, 0, xerrors.Errorf("block data doesn't match its cid %s", c)
+		}
+
+		blk, err := blocks.NewBlockWithCid(data, c)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := bs.Put(blk); err != nil {
+			return nil, 0, xerrors.Errorf("storing block: %w", err)
+		}
+		n++
+	}
+}
+
+// pieceReader returns a reader of the unpadded data of a piece. Unsealed
+// sector files hold pieces Fr32 padded to a power of two size, and are
+// unpadded. Other inputs, CARs and unpadded pieces, are read as is.
+func pieceReader(r io.Reader, size int64) io.Reader {
+	if size < fr32PaddedChunk || size&(size-1) != 0 {
+		return r
+	}
+	return &fr32Reader{r: r}
+}
+
+const (
+	fr32PaddedChunk   = 128
+	fr32UnpaddedChunk = 127
+)
+
+// fr32Reader removes the Fr32 padding, two zero bits after every 254 bits of
+// data, from a stream of 128 byte chunks
+type fr32Reader struct {
+	r   io.Reader
+	in  [fr32PaddedChunk]byte
+	out [fr32UnpaddedChunk]byte
+	buf []byte
+}
+
+func (fr *fr32Reader) Read(p []byte) (int, error) {
+	if len(fr.buf) == 0 {
+		if _, err := io.ReadFull(fr.r, fr.in[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return 0, xerrors.Errorf("padded piece isn't a multiple of %d bytes", fr32PaddedChunk)
+			}
+			return 0, err
+		}
+		fr32Unpad(&fr.in, &fr.out)
+		fr.buf = fr.out[:]
+	}
+
+	n := copy(p, fr.buf)
+	fr.buf = fr.buf[n:]
+	return n, nil
+}
+
+// fr32Unpad unpads 128 bytes, 4 field elements of 254 bits of data, bits are
+// little endian
+func fr32Unpad(in *[fr32PaddedChunk]byte, out *[fr32UnpaddedChunk]byte) {
+	*out = [fr32UnpaddedChunk]byte{}
+
+	var ob uint
+	for fe := uint(0); fe < 4; fe++ {
+		for b := uint(0); b < 254; b++ {
+			ib := fe*256 + b
+			bit := (in[ib/8] >> (ib % 8)) & 1
+			out[ob/8] |= bit << (ob % 8)
+			ob++
+		}
+	}
+}
+
+// writeNode writes retrieved files to path. The names of directory entries
+// come from untrusted data, they can't leave the directory, files aren't
+// written over existing files, and symlinks aren't written.
+func writeNode(nd files.Node, path string) error {
+	switch nd := nd.(type) {
+	case *files.Symlink:
+		return xerrors.Errorf("%s: symlinks aren't extracted", path)
+	case files.File:
+		return writeFile(nd, path, os.O_EXCL)
+	case files.Directory:
+		if err := os.Mkdir(path, 0755); err != nil {
+			return err
+		}
+
+		it := nd.Entries()
+		for it.Next() {
+			if !validEntryName(it.Name()) {
+				return xerrors.Errorf("%s: invalid entry name %q", path, it.Name())
+			}
+			if err := writeNode(it.Node(), filepath.Join(path, it.Name())); err != nil {
+				return err
+			}
+		}
+		return it.Err()
+	default:
+		return xerrors.Errorf("%s: unsupported file type %T", path, nd)
+	}
+}
+
+func validEntryName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// writeFile writes r to a new file at path, flag is os.O_EXCL or os.O_TRUNC.
+// The file is removed when it can't be written completely.
+func writeFile(r io.Reader, path string, flag int) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		_ = out.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+	return nil
+}
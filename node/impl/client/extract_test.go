@@ -0,0 +1,145 @@
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+)
+
+// fr32Pad is the inverse of fr32Unpad
+func fr32Pad(in []byte) []byte {
+	out := make([]byte, len(in)/fr32UnpaddedChunk*fr32PaddedChunk)
+	for c := 0; c < len(in)/fr32UnpaddedChunk; c++ {
+		var ib uint
+		for fe := uint(0); fe < 4; fe++ {
+			for b := uint(0); b < 254; b++ {
+				ob := fe*256 + b
+				bit := (in[c*fr32UnpaddedChunk+int(ib/8)] >> (ib % 8)) & 1
+				out[c*fr32PaddedChunk+int(ob/8)] |= bit << (ob % 8)
+				ib++
+			}
+		}
+	}
+	return out
+}
+
+func TestFr32Reader(t *testing.T) {
+	data := make([]byte, 4*fr32UnpaddedChunk)
+	rand.New(rand.NewSource(1)).Read(data) //nolint:gosec
+
+	padded := fr32Pad(data)
+	for i := 31; i < len(padded); i += 32 {
+		if padded[i]&0xc0 != 0 {
+			t.Fatalf("byte %d of the padded data has its top bits set", i)
+		}
+	}
+
+	out, err := ioutil.ReadAll(pieceReader(bytes.NewReader(padded), int64(len(padded))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("unpadded data doesn't match")
+	}
+
+	// not a padded piece size
+	raw := data[:300]
+	out, err = ioutil.ReadAll(pieceReader(bytes.NewReader(raw), int64(len(raw))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, raw) {
+		t.Fatal("expected the input to be read as is")
+	}
+}
+
+func TestLoadPaddedCar(t *testing.T) {
+	blk := blocks.NewBlock([]byte("some block data"))
+
+	var buf bytes.Buffer
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{blk.Cid()}, Version: 1}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := carutil.LdWrite(&buf, blk.Cid().Bytes(), blk.RawData()); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(make([]byte, 100))
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	roots, n, err := loadPaddedCar(bytes.NewReader(buf.Bytes()), bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(roots) != 1 || roots[0] != blk.Cid() {
+		t.Fatalf("expected 1 block with root %s, got %d blocks, roots %v", blk.Cid(), n, roots)
+	}
+	if has, err := bs.Has(blk.Cid()); err != nil || !has {
+		t.Fatalf("expected the block to be stored: %v", err)
+	}
+
+	// a block which doesn't match its cid is rejected
+	corrupt := buf.Bytes()
+	corrupt[bytes.Index(corrupt, blk.RawData())] ^= 1
+	bs = blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	if _, _, err := loadPaddedCar(bytes.NewReader(corrupt), bs); err == nil {
+		t.Fatal("expected a corrupted block to be rejected")
+	}
+}
+
+func TestWriteNodeStaysInDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lotus-extract-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	good := files.NewMapDirectory(map[string]files.Node{
+		"a": files.NewBytesFile([]byte("a")),
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"b": files.NewBytesFile([]byte("b")),
+		}),
+	})
+	if err := writeNode(good, filepath.Join(dir, "good")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "good", "sub", "b")); err != nil || string(b) != "b" {
+		t.Fatalf("expected sub/b to be written: %v", err)
+	}
+
+	for name, nd := range map[string]files.Node{
+		"traversal": files.NewMapDirectory(map[string]files.Node{
+			"../escaped": files.NewBytesFile([]byte("x")),
+		}),
+		"dotdot": files.NewMapDirectory(map[string]files.Node{
+			"..": files.NewMapDirectory(map[string]files.Node{
+				"escaped": files.NewBytesFile([]byte("x")),
+			}),
+		}),
+		"symlink": files.NewMapDirectory(map[string]files.Node{
+			"link": files.NewLinkFile(dir, nil),
+		}),
+	} {
+		if err := writeNode(nd, filepath.Join(dir, name)); err == nil {
+			t.Fatalf("%s: expected the directory to be rejected", name)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "escaped")); !os.IsNotExist(err) {
+		t.Fatalf("expected no file outside of the output directory: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "symlink", "link")); !os.IsNotExist(err) {
+		t.Fatalf("expected the symlink not to be written: %v", err)
+	}
+}
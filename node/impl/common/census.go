@@ -0,0 +1,90 @@
+package common
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	gsnet "github.com/ipfs/go-graphsync/network"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/blocksync"
+	"github.com/filecoin-project/lotus/chain/snapshot"
+	"github.com/filecoin-project/lotus/node/hello"
+)
+
+// censusProtocols are the protocols always checked for by the census. Other
+// protocols under the /fil/ prefix a peer advertises are counted too, so that
+// versions we don't speak show up.
+var censusProtocols = []string{
+	hello.ProtocolID,
+	blocksync.BlockSyncProtocolIDv2,
+	blocksync.BlockSyncProtocolID,
+	string(gsnet.ProtocolGraphsync),
+	snapshot.ProtocolID,
+	storagemarket.DealProtocolID,
+	storagemarket.AskProtocolID,
+	retrievalmarket.QueryProtocolID,
+	retrievalmarket.ProtocolID,
+}
+
+func (a *CommonAPI) NetProtocolCensus(ctx context.Context) (*api.ProtocolCensus, error) {
+	ps := a.Host.Peerstore()
+	peers := a.Host.Network().Peers()
+
+	out := &api.ProtocolCensus{
+		Peers:         len(peers),
+		Protocols:     map[string]int{},
+		PeerProtocols: make([]api.PeerProtocols, 0, len(peers)),
+	}
+
+	for _, p := range peers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// same check as the one sync requests are routed with
+		supp, err := ps.SupportsProtocols(p, censusProtocols...)
+		if err != nil {
+			return nil, xerrors.Errorf("getting protocols supported by %s: %w", p, err)
+		}
+
+		all, err := ps.GetProtocols(p)
+		if err != nil {
+			return nil, xerrors.Errorf("getting protocols of %s: %w", p, err)
+		}
+
+		seen := map[string]bool{}
+		for _, proto := range supp {
+			seen[proto] = true
+		}
+		for _, proto := range all {
+			if strings.HasPrefix(proto, "/fil/") && !seen[proto] {
+				seen[proto] = true
+				supp = append(supp, proto)
+			}
+		}
+
+		if len(supp) == 0 {
+			out.Unidentified++
+		}
+
+		sort.Strings(supp)
+		for _, proto := range supp {
+			out.Protocols[proto]++
+		}
+		out.PeerProtocols = append(out.PeerProtocols, api.PeerProtocols{
+			ID:        p,
+			Protocols: supp,
+		})
+	}
+
+	sort.Slice(out.PeerProtocols, func(i, j int) bool {
+		return strings.Compare(string(out.PeerProtocols[i].ID), string(out.PeerProtocols[j].ID)) > 0
+	})
+
+	return out, nil
+}
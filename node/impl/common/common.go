@@ -19,7 +19,7 @@ import (
 	"github.com/filecoin-project/go-jsonrpc/auth"
 
 	"github.com/filecoin-project/lotus/api"
-	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/journal"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/node/modules/lp2p"
 )
@@ -36,6 +36,9 @@ type CommonAPI struct {
 
 type jwtPayload struct {
 	Allow []auth.Permission
+
+	// Namespace is only set for tokens bound to wallets and miners
+	Namespace *api.TokenNamespace `json:",omitempty"`
 }
 
 func (a *CommonAPI) AuthVerify(ctx context.Context, token string) ([]auth.Permission, error) {
@@ -55,6 +58,33 @@ func (a *CommonAPI) AuthNew(ctx context.Context, perms []auth.Permission) ([]byt
 	return jwt.Sign(&p, (*jwt.HMACSHA)(a.APISecret))
 }
 
+func (a *CommonAPI) AuthNewNamespaced(ctx context.Context, perms []auth.Permission, ns api.TokenNamespace) ([]byte, error) {
+	if len(ns.Wallets) == 0 && len(ns.Miners) == 0 {
+		return nil, xerrors.New("namespace has no wallets or miners")
+	}
+	for _, p := range perms {
+		if p == "admin" {
+			return nil, xerrors.New("namespaced tokens can't have the admin permission")
+		}
+	}
+
+	p := jwtPayload{
+		Allow:     perms,
+		Namespace: &ns,
+	}
+
+	return jwt.Sign(&p, (*jwt.HMACSHA)(a.APISecret))
+}
+
+func (a *CommonAPI) AuthVerifyNamespace(ctx context.Context, token string) (*api.TokenNamespace, error) {
+	var payload jwtPayload
+	if _, err := jwt.Verify([]byte(token), (*jwt.HMACSHA)(a.APISecret), &payload); err != nil {
+		return nil, xerrors.Errorf("JWT Verification failed: %w", err)
+	}
+
+	return payload.Namespace, nil
+}
+
 func (a *CommonAPI) NetConnectedness(ctx context.Context, pid peer.ID) (network.Connectedness, error) {
 	return a.Host.Network().Connectedness(pid), nil
 }
@@ -118,12 +148,7 @@ func (a *CommonAPI) ID(context.Context) (peer.ID, error) {
 }
 
 func (a *CommonAPI) Version(context.Context) (api.Version, error) {
-	return api.Version{
-		Version:    build.UserVersion(),
-		APIVersion: build.APIVersion,
-
-		BlockDelay: build.BlockDelaySecs,
-	}, nil
+	return api.LocalVersion(), nil
 }
 
 func (a *CommonAPI) LogList(context.Context) ([]string, error) {
@@ -134,6 +159,30 @@ func (a *CommonAPI) LogSetLevel(ctx context.Context, subsystem, level string) er
 	return logging.SetLogLevel(subsystem, level)
 }
 
+func (a *CommonAPI) JournalQuery(ctx context.Context, q api.JournalQuery) ([]api.JournalEntry, error) {
+	ents, err := journal.Query(journal.EntryQuery{
+		System: q.System,
+		Event:  q.Event,
+		Since:  q.Since,
+		Until:  q.Until,
+		Limit:  q.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.JournalEntry, len(ents))
+	for i, e := range ents {
+		out[i] = api.JournalEntry{
+			System:    e.System,
+			Event:     e.Event,
+			Timestamp: e.Timestamp,
+			Val:       e.Val,
+		}
+	}
+	return out, nil
+}
+
 func (a *CommonAPI) Shutdown(ctx context.Context) error {
 	a.ShutdownChan <- struct{}{}
 	return nil
@@ -16,14 +16,19 @@ var log = logging.Logger("node")
 type FullNodeAPI struct {
 	common.CommonAPI
 	full.ChainAPI
+	full.EventsAPI
 	client.API
 	full.MpoolAPI
+	full.GasAPI
 	market.MarketAPI
 	paych.PaychAPI
 	full.StateAPI
 	full.MsigAPI
 	full.WalletAPI
 	full.SyncAPI
+	full.DepositAPI
+	full.StatsAPI
+	full.SandboxAPI
 }
 
 var _ api.FullNode = &FullNodeAPI{}
@@ -6,9 +6,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/filecoin-project/go-amt-ipld/v2"
 	commcid "github.com/filecoin-project/go-fil-commcid"
@@ -26,6 +28,8 @@ import (
 	"github.com/ipfs/go-merkledag"
 	"github.com/ipfs/go-path"
 	"github.com/ipfs/go-path/resolver"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
 	mh "github.com/multiformats/go-multihash"
 	"go.uber.org/fx"
 	"golang.org/x/xerrors"
@@ -33,9 +37,15 @@ import (
 	"github.com/filecoin-project/go-address"
 
 	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain"
+	"github.com/filecoin-project/lotus/chain/changefeed"
+	"github.com/filecoin-project/lotus/chain/snapshot"
+	"github.com/filecoin-project/lotus/chain/stmgr"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/chain/vm"
+	"github.com/filecoin-project/lotus/lib/apicache"
 )
 
 var log = logging.Logger("fullnode")
@@ -45,17 +55,78 @@ type ChainAPI struct {
 
 	WalletAPI
 
-	Chain *store.ChainStore
+	Chain        *store.ChainStore
+	StateManager *stmgr.StateManager
+	Host         host.Host
+	Snapshots    *snapshot.Client
+	Changefeed   *changefeed.Feed `optional:"true"`
+}
+
+func (a *ChainAPI) ChainVerify(ctx context.Context, opts api.ChainVerifyOptions) (*api.ChainVerifyReport, error) {
+	return chain.VerifyChain(ctx, a.StateManager, opts)
+}
+
+func (a *ChainAPI) ChainPrune(ctx context.Context, keepStateRoots abi.ChainEpoch, dryRun bool) (*api.ChainPruneReport, error) {
+	return a.Chain.Prune(ctx, keepStateRoots, dryRun)
 }
 
 func (a *ChainAPI) ChainNotify(ctx context.Context) (<-chan []*api.HeadChange, error) {
 	return a.Chain.SubHeadChanges(ctx), nil
 }
 
+func (a *ChainAPI) ChainNotifyReorgs(ctx context.Context) (<-chan *api.ReorgEvent, error) {
+	return a.Chain.SubReorgs(ctx), nil
+}
+
+func (a *ChainAPI) ChainReorgStats(ctx context.Context) (*api.ReorgStats, error) {
+	return a.Chain.ReorgStats(), nil
+}
+
+func (a *ChainAPI) ChainChangefeed(ctx context.Context, after uint64) (<-chan *api.ChangefeedEntry, error) {
+	if a.Changefeed == nil {
+		return nil, xerrors.New("the changefeed is disabled, set Changefeed.Enable in the node config")
+	}
+	return a.Changefeed.Subscribe(ctx, after)
+}
+
 func (a *ChainAPI) ChainHead(context.Context) (*types.TipSet, error) {
 	return a.Chain.GetHeaviestTipSet(), nil
 }
 
+func (a *ChainAPI) ChainHeadInfo(ctx context.Context) (*api.HeadInfo, error) {
+	head := a.Chain.GetHeaviestTipSet()
+
+	w, err := a.Chain.Weight(ctx, head)
+	if err != nil {
+		return nil, xerrors.Errorf("computing head weight: %w", err)
+	}
+
+	gen, err := a.Chain.GetGenesis()
+	if err != nil {
+		return nil, xerrors.Errorf("loading genesis: %w", err)
+	}
+
+	var behind abi.ChainEpoch
+	if now := uint64(time.Now().Unix()); now > gen.Timestamp {
+		behind = abi.ChainEpoch((now-gen.Timestamp)/build.BlockDelaySecs) - head.Height()
+		if behind < 0 {
+			behind = 0
+		}
+	}
+
+	finalized := head.Height() - build.Finality
+	if finalized < 0 {
+		finalized = 0
+	}
+
+	return &api.HeadInfo{
+		TipSet:          head,
+		Weight:          w,
+		FinalizedHeight: finalized,
+		EpochsBehind:    behind,
+	}, nil
+}
+
 func (a *ChainAPI) ChainGetRandomness(ctx context.Context, tsk types.TipSetKey, personalization crypto.DomainSeparationTag, randEpoch abi.ChainEpoch, entropy []byte) (abi.Randomness, error) {
 	pts, err := a.Chain.LoadTipSet(tsk)
 	if err != nil {
@@ -70,7 +141,13 @@ func (a *ChainAPI) ChainGetBlock(ctx context.Context, msg cid.Cid) (*types.Block
 }
 
 func (a *ChainAPI) ChainGetTipSet(ctx context.Context, key types.TipSetKey) (*types.TipSet, error) {
-	return a.Chain.LoadTipSet(key)
+	ts, err := apicache.FromContext(ctx).Get(key, func() (interface{}, error) {
+		return a.Chain.LoadTipSet(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ts.(*types.TipSet), nil
 }
 
 func (a *ChainAPI) ChainGetBlockMessages(ctx context.Context, msg cid.Cid) (*api.BlockMessages, error) {
@@ -249,6 +326,14 @@ func (a *ChainAPI) ChainSetHead(ctx context.Context, tsk types.TipSetKey) error
 	return a.Chain.SetHead(ts)
 }
 
+func (a *ChainAPI) ChainReorgJournal(ctx context.Context) ([]api.ReorgJournalEntry, error) {
+	return a.Chain.ReorgJournal()
+}
+
+func (a *ChainAPI) ChainReplayReorg(ctx context.Context, id uint64) error {
+	return a.Chain.ReplayReorg(ctx, id)
+}
+
 func (a *ChainAPI) ChainGetGenesis(ctx context.Context) (*types.TipSet, error) {
 	genb, err := a.Chain.GetGenesis()
 	if err != nil {
@@ -468,34 +553,57 @@ func (a *ChainAPI) ChainGetMessage(ctx context.Context, mc cid.Cid) (*types.Mess
 	return cm.VMMessage(), nil
 }
 
-func (a *ChainAPI) ChainExport(ctx context.Context, tsk types.TipSetKey) (<-chan []byte, error) {
+func (a *ChainAPI) ChainExport(ctx context.Context, tsk types.TipSetKey, opts api.ChainExportOptions) (<-chan []byte, error) {
+	if opts.RecentStateRoots < 0 || opts.Depth < 0 {
+		return nil, xerrors.Errorf("negative recent state roots (%d) or depth (%d)", opts.RecentStateRoots, opts.Depth)
+	}
+	if opts.SkipOldMessages && opts.RecentStateRoots == 0 {
+		return nil, xerrors.Errorf("skipping old messages requires recent state roots")
+	}
+
 	ts, err := a.Chain.GetTipSetFromKey(tsk)
 	if err != nil {
 		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
 	}
+	return exportStream(ctx, "chain", func(w io.Writer) error {
+		return a.Chain.ExportRange(ctx, ts, opts.Depth, opts.RecentStateRoots, !opts.SkipOldMessages, w)
+	}), nil
+}
+
+// exportStream streams what export writes in chunks, for export APIs. The
+// stream ends with an empty chunk once everything was written, when the
+// export fails it's closed without it, so that clients can tell a complete
+// export from one cut short.
+func exportStream(ctx context.Context, what string, export func(w io.Writer) error) <-chan []byte {
 	r, w := io.Pipe()
 	out := make(chan []byte)
 	go func() {
-		defer w.Close() //nolint:errcheck // it is a pipe
-		if err := a.Chain.Export(ctx, ts, w); err != nil {
-			log.Errorf("chain export call failed: %s", err)
-			return
+		err := export(w)
+		if err != nil {
+			log.Errorf("%s export call failed: %s", what, err)
 		}
+		_ = w.CloseWithError(err) // nil closes the pipe normally
 	}()
 
 	go func() {
 		defer close(out)
+		defer r.Close() //nolint:errcheck // stops the export if the client is gone
 		for {
 			buf := make([]byte, 4096)
 			n, err := r.Read(buf)
 			if err != nil && err != io.EOF {
-				log.Errorf("chain export pipe read failed: %s", err)
+				log.Errorf("%s export pipe read failed: %s", what, err)
 				return
 			}
+			if n == 0 && err == nil {
+				// empty chunks are only sent at the end
+				continue
+			}
 			select {
 			case out <- buf[:n]:
 			case <-ctx.Done():
 				log.Warnf("export writer failed: %s", ctx.Err())
+				return
 			}
 			if err == io.EOF {
 				return
@@ -503,5 +611,68 @@ func (a *ChainAPI) ChainExport(ctx context.Context, tsk types.TipSetKey) (<-chan
 		}
 	}()
 
-	return out, nil
+	return out
+}
+
+func (a *ChainAPI) ChainImport(ctx context.Context, path string, trusted bool) (types.TipSetKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return types.EmptyTSK, xerrors.Errorf("opening chain file: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read only
+
+	ts, err := a.Chain.Import(f)
+	if err != nil {
+		return types.EmptyTSK, xerrors.Errorf("importing chain: %w", err)
+	}
+
+	if !trusted {
+		// the imported tipset only becomes the head once the state of the
+		// chain was recomputed from genesis, which needs all of its messages
+		if err := a.StateManager.ValidateChain(ctx, ts); err != nil {
+			return types.EmptyTSK, xerrors.Errorf("validating imported chain (snapshots can only be imported as trusted): %w", err)
+		}
+	}
+
+	if err := a.Chain.CheckSnapshot(ctx, ts); err != nil {
+		return types.EmptyTSK, xerrors.Errorf("checking imported chain: %w", err)
+	}
+
+	log.Infof("imported chain at height %d (%s)", ts.Height(), ts.Cids())
+
+	// the syncer continues from the snapshot once it's the head, fetching
+	// only the tipsets above it
+	if err := a.Chain.MaybeTakeHeavierTipSet(ctx, ts); err != nil {
+		return types.EmptyTSK, xerrors.Errorf("taking imported tipset as head: %w", err)
+	}
+
+	return ts.Key(), nil
+}
+
+func (a *ChainAPI) ChainFetchSnapshot(ctx context.Context, pi peer.AddrInfo) (types.TipSetKey, error) {
+	if err := a.Host.Connect(ctx, pi); err != nil {
+		return types.EmptyTSK, xerrors.Errorf("connecting to snapshot peer: %w", err)
+	}
+
+	path, m, err := a.Snapshots.Fetch(ctx, pi.ID)
+	if err != nil {
+		return types.EmptyTSK, xerrors.Errorf("fetching snapshot: %w", err)
+	}
+	log.Infof("fetched snapshot at height %d from %s", m.Height, pi.ID)
+
+	// the snapshot peer was chosen by the caller, and is trusted
+	tsk, err := a.ChainImport(ctx, path, true)
+	if err != nil {
+		return types.EmptyTSK, err
+	}
+	if tsk != types.NewTipSetKey(m.TipSet...) {
+		return types.EmptyTSK, xerrors.Errorf("snapshot root %s doesn't match its manifest", tsk)
+	}
+
+	// the file is kept when the import fails, so that it can be retried
+	// without downloading the snapshot again
+	if err := a.Snapshots.Remove(path); err != nil {
+		log.Warnf("removing imported snapshot: %s", err)
+	}
+	return tsk, nil
 }
@@ -0,0 +1,142 @@
+package full
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/builtin/power"
+	"github.com/filecoin-project/specs-actors/actors/builtin/verifreg"
+
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func init() {
+	miner.SupportedProofTypes = map[abi.RegisteredSealProof]struct{}{
+		abi.RegisteredSealProof_StackedDrg2KiBV1: {},
+	}
+	power.ConsensusMinerMinPower = big.NewInt(2048)
+	verifreg.MinVerifiedDealSize = big.NewInt(256)
+}
+
+func TestChainImportTrusted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chain-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last *types.TipSet
+	for i := 0; i < 20; i++ {
+		ts, err := cg.NextTipSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = ts.TipSet.TipSet()
+	}
+
+	export := func(name string, nroots abi.ChainEpoch, includeMessages bool) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close() //nolint:errcheck
+		if err := cg.ChainStore().Export(context.TODO(), last, nroots, includeMessages, f); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	snapshot := export("snapshot.car", 5, false)
+	full := export("full.car", 0, true)
+
+	newAPI := func() *ChainAPI {
+		bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+		cs := store.NewChainStore(bs, datastore.NewMapDatastore(), nil)
+		return &ChainAPI{Chain: cs, StateManager: stmgr.NewStateManager(cs)}
+	}
+
+	ctx := context.TODO()
+
+	// the state of a snapshot can't be recomputed, it isn't taken as the
+	// head unless it's trusted
+	a := newAPI()
+	if _, err := a.ChainImport(ctx, snapshot, false); err == nil {
+		t.Fatal("expected an untrusted snapshot to be refused")
+	}
+	if a.Chain.GetHeaviestTipSet() != nil {
+		t.Fatal("the untrusted snapshot was taken as the head")
+	}
+
+	tsk, err := a.ChainImport(ctx, snapshot, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tsk != last.Key() || !a.Chain.GetHeaviestTipSet().Equals(last) {
+		t.Fatal("expected the trusted snapshot to be the head")
+	}
+
+	// full chains are validated
+	a = newAPI()
+	tsk, err = a.ChainImport(ctx, full, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tsk != last.Key() || !a.Chain.GetHeaviestTipSet().Equals(last) {
+		t.Fatal("expected the validated chain to be the head")
+	}
+}
+
+func TestExportStream(t *testing.T) {
+	read := func(stream <-chan []byte) ([]byte, bool) {
+		var out []byte
+		complete := false
+		for b := range stream {
+			if len(b) == 0 {
+				complete = true
+				continue
+			}
+			out = append(out, b...)
+		}
+		return out, complete
+	}
+
+	data := bytes.Repeat([]byte("snapshot"), 1000)
+	out, complete := read(exportStream(context.TODO(), "test", func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}))
+	if !complete || !bytes.Equal(out, data) {
+		t.Fatalf("expected the complete export, got %d bytes, complete: %t", len(out), complete)
+	}
+
+	// failed exports end without the empty chunk
+	_, complete = read(exportStream(context.TODO(), "test", func(w io.Writer) error {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		return xerrors.New("export failed")
+	}))
+	if complete {
+		t.Fatal("expected the failed export not to be complete")
+	}
+}
@@ -0,0 +1,36 @@
+package full
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/deposits"
+)
+
+var errDepositsDisabled = xerrors.New("deposit tracking is not enabled, configure Deposits.Addresses in the node config")
+
+type DepositAPI struct {
+	fx.In
+
+	Deposits *deposits.Scanner `optional:"true"`
+}
+
+func (a *DepositAPI) DepositList(ctx context.Context, includeAcked bool) ([]api.Deposit, error) {
+	if a.Deposits == nil {
+		return nil, errDepositsDisabled
+	}
+
+	return a.Deposits.List(ctx, includeAcked)
+}
+
+func (a *DepositAPI) DepositAck(ctx context.Context, msgs []cid.Cid) error {
+	if a.Deposits == nil {
+		return errDepositsDisabled
+	}
+
+	return a.Deposits.Ack(ctx, msgs)
+}
@@ -0,0 +1,140 @@
+package full
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/events"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type EventsAPI struct {
+	fx.In
+
+	Events *events.Events
+}
+
+func (a *EventsAPI) ChainSubscribeEvents(ctx context.Context, filter api.EventFilter) (<-chan *api.ChainEvent, error) {
+	confidence := int(filter.Confidence)
+	if filter.Final {
+		confidence = int(build.Finality)
+	}
+	if confidence < 0 || confidence > int(build.Finality) {
+		return nil, xerrors.Errorf("confidence %d out of range, at most %d epochs", filter.Confidence, build.Finality)
+	}
+
+	out := make(chan *api.ChainEvent, 16)
+	send := func(ev *api.ChainEvent) {
+		select {
+		case out <- ev:
+		case <-ctx.Done():
+		}
+	}
+
+	id, err := a.Events.Executed(func(execs []events.MsgExecution, ts *types.TipSet, curH abi.ChainEpoch) (bool, error) {
+		ev := &api.ChainEvent{
+			Type:       store.HCApply,
+			TipSet:     ts.Key(),
+			Height:     ts.Height(),
+			Executions: make([]api.MsgExecution, len(execs)),
+		}
+		for i, e := range execs {
+			ev.Executions[i] = api.MsgExecution{
+				Cid:     e.Cid,
+				Message: e.Msg,
+				Receipt: *e.Receipt,
+			}
+		}
+
+		send(ev)
+		return ctx.Err() == nil, nil
+	}, func(_ context.Context, ts *types.TipSet) error {
+		send(&api.ChainEvent{
+			Type:   store.HCRevert,
+			TipSet: ts.Key(),
+			Height: ts.Height(),
+		})
+		return nil
+	}, confidence, filter.Matches)
+	if err != nil {
+		return nil, xerrors.Errorf("subscribing to executions: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		a.Events.Unsubscribe(id)
+		// handlers don't run after unsubscribing, nothing sends anymore
+		close(out)
+	}()
+
+	return out, nil
+}
+
+func (a *EventsAPI) ChainNotifyAt(ctx context.Context, height abi.ChainEpoch, confidence uint64) (<-chan *api.HeightEvent, error) {
+	if confidence > uint64(build.Finality) {
+		return nil, xerrors.Errorf("confidence %d out of range, at most %d epochs", confidence, build.Finality)
+	}
+
+	out := make(chan *api.HeightEvent, 16)
+
+	// handlers which already started can still run after the subscription is
+	// canceled, closed guards the channel against them
+	var lk sync.Mutex
+	closed := false
+	send := func(ev *api.HeightEvent) {
+		lk.Lock()
+		defer lk.Unlock()
+		if closed {
+			return
+		}
+
+		select {
+		case out <- ev:
+		case <-ctx.Done():
+		}
+	}
+
+	event := func(typ string, ts *types.TipSet, curH abi.ChainEpoch) *api.HeightEvent {
+		ev := &api.HeightEvent{
+			Type:          typ,
+			Height:        height,
+			CurrentHeight: curH,
+		}
+		if ts != nil { // nil when the tipset isn't cached anymore
+			ev.TipSet = ts.Key()
+			ev.Height = ts.Height()
+		}
+		return ev
+	}
+
+	cancel, err := a.Events.ChainAtCancelable(func(_ context.Context, ts *types.TipSet, curH abi.ChainEpoch) error {
+		send(event(store.HCApply, ts, curH))
+		return nil
+	}, func(_ context.Context, ts *types.TipSet) error {
+		send(event(store.HCRevert, ts, ts.Height()))
+		return nil
+	}, int(confidence), height)
+	if err != nil {
+		return nil, xerrors.Errorf("registering height handler: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		cancel()
+
+		lk.Lock()
+		closed = true
+		close(out)
+		lk.Unlock()
+	}()
+
+	return out, nil
+}
@@ -0,0 +1,52 @@
+package full
+
+import (
+	"context"
+
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/messagepool"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type GasAPI struct {
+	fx.In
+
+	Mpool        *messagepool.MessagePool
+	StateManager *stmgr.StateManager
+	Chain        *store.ChainStore
+}
+
+func (a *GasAPI) GasEstimateGasPrice(ctx context.Context, nblocksincl uint64, sender address.Address, gaslimit int64, tsk types.TipSetKey) (types.BigInt, error) {
+	return a.Mpool.EstimateGasPrice(ctx, nblocksincl, sender, gaslimit, tsk)
+}
+
+func (a *GasAPI) GasPricePercentiles(ctx context.Context, lookback uint64, percentiles []float64, tsk types.TipSetKey) ([]types.BigInt, error) {
+	return a.Mpool.GasPricePercentiles(lookback, percentiles, tsk)
+}
+
+func (a *GasAPI) GasEstimateGasLimit(ctx context.Context, msg *types.Message, tsk types.TipSetKey) (*api.GasEstimate, error) {
+	ts, err := a.Chain.GetTipSetFromKey(tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
+	}
+
+	res, err := a.StateManager.CallWithGas(ctx, msg, ts)
+	if err != nil {
+		return nil, xerrors.Errorf("applying message: %w", err)
+	}
+	if res.MsgRct.ExitCode != 0 {
+		return nil, xerrors.Errorf("message execution failed (exit: %d): %s", res.MsgRct.ExitCode, res.Error)
+	}
+
+	return &api.GasEstimate{
+		GasLimit:   res.MsgRct.GasUsed,
+		ComputeGas: res.GasBreakdown.ComputeGas,
+		StorageGas: res.GasBreakdown.StorageGas,
+	}, nil
+}
@@ -1,7 +1,9 @@
 package full
 
 import (
+	"bytes"
 	"context"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"go.uber.org/fx"
@@ -9,11 +11,15 @@ import (
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
 	"github.com/filecoin-project/lotus/chain/messagepool"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/msgaudit"
 )
 
+var errAuditDisabled = xerrors.New("the message audit log is not enabled, set MessageAudit.Enable in the node config")
+
 type MpoolAPI struct {
 	fx.In
 
@@ -22,6 +28,8 @@ type MpoolAPI struct {
 	Chain *store.ChainStore
 
 	Mpool *messagepool.MessagePool
+
+	Audit *msgaudit.Log `optional:"true"`
 }
 
 func (a *MpoolAPI) MpoolPending(ctx context.Context, tsk types.TipSetKey) ([]*types.SignedMessage, error) {
@@ -83,15 +91,77 @@ func (a *MpoolAPI) MpoolPending(ctx context.Context, tsk types.TipSetKey) ([]*ty
 }
 
 func (a *MpoolAPI) MpoolPush(ctx context.Context, smsg *types.SignedMessage) (cid.Cid, error) {
-	return a.Mpool.Push(smsg)
+	if err := a.audit(ctx, "MpoolPush", smsg); err != nil {
+		return cid.Undef, err
+	}
+
+	c, err := a.Mpool.Push(smsg)
+	if err != nil {
+		a.auditFailure(ctx, "MpoolPush", smsg, err)
+	}
+	return c, err
 }
 
-func (a *MpoolAPI) MpoolPushMessage(ctx context.Context, msg *types.Message) (*types.SignedMessage, error) {
+// audit records a message in the audit log, if it's enabled, before it's
+// pushed. Messages which can't be recorded aren't pushed.
+func (a *MpoolAPI) audit(ctx context.Context, method string, smsg *types.SignedMessage) error {
+	if a.Audit == nil {
+		return nil
+	}
+
+	if err := a.Audit.Record(auditEntry(ctx, method, smsg)); err != nil {
+		return xerrors.Errorf("recording the message in the audit log: %w", err)
+	}
+	return nil
+}
+
+// auditFailure records that the push of a recorded message failed
+func (a *MpoolAPI) auditFailure(ctx context.Context, method string, smsg *types.SignedMessage, perr error) {
+	if a.Audit == nil || smsg == nil {
+		return
+	}
+
+	e := auditEntry(ctx, method, smsg)
+	e.Error = perr.Error()
+	if err := a.Audit.Record(e); err != nil {
+		log.Errorf("recording failed %s push in the audit log: %s", method, err)
+	}
+}
+
+func auditEntry(ctx context.Context, method string, smsg *types.SignedMessage) api.MessageAuditEntry {
+	c := smsg.Cid()
+	return api.MessageAuditEntry{
+		Time:      time.Now().UTC(),
+		Method:    method,
+		TokenID:   apistruct.TokenIDFromContext(ctx),
+		Message:   &smsg.Message,
+		Signature: &smsg.Signature,
+		Cid:       &c,
+	}
+}
+
+func (a *MpoolAPI) MpoolAuditExport(ctx context.Context, since, until time.Time) ([]api.MessageAuditRecord, error) {
+	if a.Audit == nil {
+		return nil, errAuditDisabled
+	}
+	return a.Audit.Export(since, until)
+}
+
+func (a *MpoolAPI) MpoolPushMessage(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (_ *types.SignedMessage, err error) {
 	if msg.Nonce != 0 {
 		return nil, xerrors.Errorf("MpoolPushMessage expects message nonce to be 0, was %d", msg.Nonce)
 	}
 
-	return a.Mpool.PushWithNonce(ctx, msg.From, func(from address.Address, nonce uint64) (*types.SignedMessage, error) {
+	// the message is recorded in the audit log once it's signed, before
+	// it's added to the pool
+	var signed *types.SignedMessage
+	defer func() {
+		if err != nil {
+			a.auditFailure(ctx, "MpoolPushMessage", signed, err)
+		}
+	}()
+
+	sign := func(from address.Address, nonce uint64) (*types.SignedMessage, error) {
 		msg.Nonce = nonce
 		if msg.From.Protocol() == address.ID {
 			log.Warnf("Push from ID address (%s), adjusting to %s", msg.From, from)
@@ -107,8 +177,44 @@ func (a *MpoolAPI) MpoolPushMessage(ctx context.Context, msg *types.Message) (*t
 			return nil, xerrors.Errorf("mpool push: not enough funds: %s < %s", b, msg.Value)
 		}
 
-		return a.WalletSignMessage(ctx, from, msg)
-	})
+		smsg, err := a.WalletSignMessage(ctx, from, msg)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.audit(ctx, "MpoolPushMessage", smsg); err != nil {
+			return nil, err
+		}
+		signed = smsg
+		return smsg, nil
+	}
+
+	if spec == nil || spec.IdempotencyKey == "" {
+		return a.Mpool.PushWithNonce(ctx, msg.From, sign)
+	}
+
+	// keys are scoped to the sender, so that callers sharing a node can't
+	// observe each other's messages
+	from := msg.From
+	if from.Protocol() == address.ID {
+		var err error
+		from, err = a.StateManager.ResolveToKeyAddress(ctx, from, nil)
+		if err != nil {
+			return nil, xerrors.Errorf("resolving sender key: %w", err)
+		}
+	}
+
+	req := *msg
+	smsg, err := a.Mpool.PushWithNonceKey(ctx, from.String()+"/"+spec.IdempotencyKey, msg.From, sign)
+	if err != nil {
+		return smsg, err
+	}
+
+	orig := smsg.Message
+	if orig.To != req.To || !orig.Value.Equals(req.Value) || orig.Method != req.Method || !bytes.Equal(orig.Params, req.Params) {
+		return nil, xerrors.Errorf("idempotency key %q was already used for a different message %s", spec.IdempotencyKey, smsg.Cid())
+	}
+
+	return smsg, nil
 }
 
 func (a *MpoolAPI) MpoolGetNonce(ctx context.Context, addr address.Address) (uint64, error) {
@@ -119,6 +225,68 @@ func (a *MpoolAPI) MpoolSub(ctx context.Context) (<-chan api.MpoolUpdate, error)
 	return a.Mpool.Updates(ctx)
 }
 
+func (a *MpoolAPI) MpoolReplace(ctx context.Context, from address.Address, nonce uint64, gasPrice types.BigInt) (*types.SignedMessage, error) {
+	var signed *types.SignedMessage
+	smsg, err := a.Mpool.Replace(ctx, from, nonce, func(old *types.SignedMessage) (*types.SignedMessage, error) {
+		msg := old.Message
+		msg.GasPrice = gasPrice
+		if gasPrice.Int == nil || gasPrice.Sign() == 0 {
+			msg.GasPrice = messagepool.MinRBFPrice(old.Message.GasPrice)
+		}
+
+		smsg, err := a.WalletSignMessage(ctx, msg.From, &msg)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.audit(ctx, "MpoolReplace", smsg); err != nil {
+			return nil, err
+		}
+		signed = smsg
+		return smsg, nil
+	})
+	if err != nil {
+		a.auditFailure(ctx, "MpoolReplace", signed, err)
+	}
+	return smsg, err
+}
+
+func (a *MpoolAPI) MpoolCancel(ctx context.Context, from address.Address, nonce uint64) (*types.SignedMessage, error) {
+	var signed *types.SignedMessage
+	smsg, err := a.Mpool.Replace(ctx, from, nonce, func(old *types.SignedMessage) (*types.SignedMessage, error) {
+		msg := &types.Message{
+			To:       old.Message.From,
+			From:     old.Message.From,
+			Nonce:    old.Message.Nonce,
+			Value:    types.NewInt(0),
+			GasPrice: messagepool.MinRBFPrice(old.Message.GasPrice),
+			// a send needs less gas than any other message
+			GasLimit: old.Message.GasLimit,
+		}
+
+		smsg, err := a.WalletSignMessage(ctx, msg.From, msg)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.audit(ctx, "MpoolCancel", smsg); err != nil {
+			return nil, err
+		}
+		signed = smsg
+		return smsg, nil
+	})
+	if err != nil {
+		a.auditFailure(ctx, "MpoolCancel", signed, err)
+	}
+	return smsg, err
+}
+
+func (a *MpoolAPI) MpoolLocal(ctx context.Context) ([]api.LocalMessage, error) {
+	return a.Mpool.LocalMessages()
+}
+
+func (a *MpoolAPI) MpoolPurgeLocal(ctx context.Context) (int, error) {
+	return a.Mpool.PurgeLocal()
+}
+
 func (a *MpoolAPI) MpoolEstimateGasPrice(ctx context.Context, nblocksincl uint64, sender address.Address, gaslimit int64, tsk types.TipSetKey) (types.BigInt, error) {
 	return a.Mpool.EstimateGasPrice(ctx, nblocksincl, sender, gaslimit, tsk)
 }
@@ -0,0 +1,102 @@
+package full
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+
+	"github.com/filecoin-project/lotus/chain/messagepool"
+	"github.com/filecoin-project/lotus/chain/messagepool/mpooltest"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/wallet"
+	"github.com/filecoin-project/lotus/lib/msgaudit"
+	_ "github.com/filecoin-project/lotus/lib/sigs/secp"
+)
+
+func TestMpoolPushAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpool-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	w, err := wallet.NewWallet(wallet.NewMemKeyStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := w.GenerateKey(crypto.SigTypeSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mp, err := messagepool.New(mpooltest.NewProvider(), datastore.NewMapDatastore(), "audittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mp.Close() //nolint:errcheck
+
+	l, err := msgaudit.Open(filepath.Join(dir, msgaudit.FileName), []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &MpoolAPI{Mpool: mp, Audit: l}
+
+	sign := func(nonce uint64) *types.SignedMessage {
+		msg := &types.Message{
+			From:     from,
+			To:       from,
+			Nonce:    nonce,
+			Value:    types.NewInt(0),
+			GasPrice: types.NewInt(100),
+			GasLimit: 10000,
+		}
+		sig, err := w.Sign(context.TODO(), from, msg.Cid().Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &types.SignedMessage{Message: *msg, Signature: *sig}
+	}
+
+	ctx := context.TODO()
+	if _, err := a.MpoolPush(ctx, sign(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same nonce at the same price isn't accepted, the push is recorded
+	// as failed
+	dup := sign(0)
+	dup.Message.Value = types.NewInt(1)
+	if _, err := a.MpoolPush(ctx, dup); err == nil {
+		t.Fatal("expected the push to fail")
+	}
+
+	records, err := a.MpoolAuditExport(ctx, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+
+	// messages which can't be recorded aren't pushed
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	unrecorded := sign(1)
+	if _, err := a.MpoolPush(ctx, unrecorded); err == nil {
+		t.Fatal("expected the push to fail when the audit log can't be written")
+	}
+	pending, _ := mp.Pending()
+	for _, m := range pending {
+		if m.Cid() == unrecorded.Cid() {
+			t.Fatal("the message was pushed without being recorded")
+		}
+	}
+}
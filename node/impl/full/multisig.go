@@ -82,7 +82,7 @@ func (a *MsigAPI) MsigCreate(ctx context.Context, req int64, addrs []address.Add
 	}
 
 	// send the message out to the network
-	smsg, err := a.MpoolAPI.MpoolPushMessage(ctx, &msg)
+	smsg, err := a.MpoolAPI.MpoolPushMessage(ctx, &msg, nil)
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -128,7 +128,7 @@ func (a *MsigAPI) MsigPropose(ctx context.Context, msig address.Address, to addr
 		GasPrice: types.NewInt(1),
 	}
 
-	smsg, err := a.MpoolAPI.MpoolPushMessage(ctx, msg)
+	smsg, err := a.MpoolAPI.MpoolPushMessage(ctx, msg, nil)
 	if err != nil {
 		return cid.Undef, nil
 	}
@@ -244,7 +244,7 @@ func (a *MsigAPI) msigApproveOrCancel(ctx context.Context, operation api.MsigPro
 		GasPrice: types.NewInt(1),
 	}
 
-	smsg, err := a.MpoolAPI.MpoolPushMessage(ctx, msg)
+	smsg, err := a.MpoolAPI.MpoolPushMessage(ctx, msg, nil)
 	if err != nil {
 		return cid.Undef, err
 	}
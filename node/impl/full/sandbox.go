@@ -0,0 +1,55 @@
+package full
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/sandbox"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type SandboxAPI struct {
+	fx.In
+
+	Chain     *store.ChainStore
+	Sandboxes *sandbox.Manager
+}
+
+func (a *SandboxAPI) SandboxCreate(ctx context.Context, name string, tsk types.TipSetKey) (*api.SandboxInfo, error) {
+	ts, err := a.Chain.GetTipSetFromKey(tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
+	}
+
+	return a.Sandboxes.Create(ctx, name, ts)
+}
+
+func (a *SandboxAPI) SandboxApply(ctx context.Context, name string, msgs []*types.Message) ([]*api.InvocResult, error) {
+	return a.Sandboxes.Apply(ctx, name, msgs)
+}
+
+func (a *SandboxAPI) SandboxGetActor(ctx context.Context, name string, addr address.Address) (*types.Actor, error) {
+	st, err := a.Sandboxes.StateTree(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return st.GetActor(addr)
+}
+
+func (a *SandboxAPI) SandboxReadState(ctx context.Context, name string, addr address.Address) (*api.ActorState, error) {
+	return a.Sandboxes.ReadState(name, addr)
+}
+
+func (a *SandboxAPI) SandboxList(ctx context.Context) ([]api.SandboxInfo, error) {
+	return a.Sandboxes.List(), nil
+}
+
+func (a *SandboxAPI) SandboxDelete(ctx context.Context, name string) error {
+	return a.Sandboxes.Delete(name)
+}
@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"strconv"
 
 	cid "github.com/ipfs/go-cid"
+	levelds "github.com/ipfs/go-ds-leveldb"
 	"github.com/ipfs/go-hamt-ipld"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	cbor "github.com/ipfs/go-ipld-cbor"
 	cbg "github.com/whyrusleeping/cbor-gen"
 	"go.uber.org/fx"
@@ -25,15 +30,18 @@ import (
 	"github.com/filecoin-project/specs-actors/actors/builtin/power"
 
 	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/actors"
 	"github.com/filecoin-project/lotus/chain/beacon"
 	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/msgindex"
 	"github.com/filecoin-project/lotus/chain/state"
 	"github.com/filecoin-project/lotus/chain/stmgr"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/chain/vm"
 	"github.com/filecoin-project/lotus/chain/wallet"
+	"github.com/filecoin-project/lotus/lib/apicache"
 	"github.com/filecoin-project/lotus/lib/bufbstore"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
@@ -49,12 +57,18 @@ type StateAPI struct {
 	StateManager  *stmgr.StateManager
 	Chain         *store.ChainStore
 	Beacon        beacon.RandomBeacon
+	DryRuns       *stmgr.UpgradeDryRunner `optional:"true"`
+	MsgIndex      *msgindex.Index         `optional:"true"`
 }
 
 func (a *StateAPI) StateNetworkName(ctx context.Context) (dtypes.NetworkName, error) {
 	return stmgr.GetNetworkName(ctx, a.StateManager, a.Chain.GetHeaviestTipSet().ParentState())
 }
 
+func (a *StateAPI) StateNetworkParams(ctx context.Context) (build.NetworkParams, error) {
+	return build.CurrentNetworkParams(), nil
+}
+
 func (a *StateAPI) StateMinerSectors(ctx context.Context, addr address.Address, filter *abi.BitField, filterOut bool, tsk types.TipSetKey) ([]*api.ChainSectorInfo, error) {
 	ts, err := a.Chain.GetTipSetFromKey(tsk)
 	if err != nil {
@@ -227,12 +241,20 @@ func (a *StateAPI) StateCall(ctx context.Context, msg *types.Message, tsk types.
 	return a.StateManager.Call(ctx, msg, ts)
 }
 
+func (a *StateAPI) StateDryRun(ctx context.Context, msg *types.Message, tsk types.TipSetKey) (*api.InvocResult, error) {
+	ts, err := a.Chain.GetTipSetFromKey(tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
+	}
+	return a.StateManager.CallOnTipSet(ctx, msg, ts)
+}
+
 func (a *StateAPI) StateReplay(ctx context.Context, tsk types.TipSetKey, mc cid.Cid) (*api.InvocResult, error) {
 	ts, err := a.Chain.GetTipSetFromKey(tsk)
 	if err != nil {
 		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
 	}
-	m, r, err := a.StateManager.Replay(ctx, ts, mc)
+	m, r, mt, err := a.StateManager.Replay(ctx, ts, mc)
 	if err != nil {
 		return nil, err
 	}
@@ -242,15 +264,30 @@ func (a *StateAPI) StateReplay(ctx context.Context, tsk types.TipSetKey, mc cid.
 		errstr = r.ActorErr.Error()
 	}
 
+	var method string
+	if act, err := a.StateManager.GetActor(m.To, ts); err == nil {
+		method = stmgr.MethodName(act.Code, m.Method)
+	}
+
 	return &api.InvocResult{
 		Msg:            m,
+		MethodName:     method,
 		MsgRct:         &r.MessageReceipt,
+		GasBreakdown:   r.GasBreakdown,
 		ExecutionTrace: r.ExecutionTrace,
 		Error:          errstr,
 		Duration:       r.Duration,
+
+		Calls:           mt.Calls,
+		StateRootBefore: mt.StateRootBefore,
+		StateRootAfter:  mt.StateRootAfter,
 	}, nil
 }
 
+func (a *StateAPI) StateActorMethods(ctx context.Context) ([]api.ActorMethods, error) {
+	return stmgr.ActorMethodSchemas(), nil
+}
+
 func (a *StateAPI) stateForTs(ctx context.Context, ts *types.TipSet) (*state.StateTree, error) {
 	if ts == nil {
 		ts = a.Chain.GetHeaviestTipSet()
@@ -266,17 +303,31 @@ func (a *StateAPI) stateForTs(ctx context.Context, ts *types.TipSet) (*state.Sta
 	return state.LoadStateTree(cst, st)
 }
 
+// actorCacheKey identifies results cached per API connection
+type actorCacheKey struct {
+	kind  string
+	actor address.Address
+	tsk   types.TipSetKey
+}
+
 func (a *StateAPI) StateGetActor(ctx context.Context, actor address.Address, tsk types.TipSetKey) (*types.Actor, error) {
 	ts, err := a.Chain.GetTipSetFromKey(tsk)
 	if err != nil {
 		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
 	}
-	state, err := a.stateForTs(ctx, ts)
+
+	act, err := apicache.FromContext(ctx).Get(actorCacheKey{"actor", actor, ts.Key()}, func() (interface{}, error) {
+		state, err := a.stateForTs(ctx, ts)
+		if err != nil {
+			return nil, xerrors.Errorf("computing tipset state failed: %w", err)
+		}
+
+		return state.GetActor(actor)
+	})
 	if err != nil {
-		return nil, xerrors.Errorf("computing tipset state failed: %w", err)
+		return nil, err
 	}
-
-	return state.GetActor(actor)
+	return act.(*types.Actor), nil
 }
 
 func (a *StateAPI) StateLookupID(ctx context.Context, addr address.Address, tsk types.TipSetKey) (address.Address, error) {
@@ -306,6 +357,17 @@ func (a *StateAPI) StateReadState(ctx context.Context, actor address.Address, ts
 	if err != nil {
 		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
 	}
+
+	st, err := apicache.FromContext(ctx).Get(actorCacheKey{"state", actor, ts.Key()}, func() (interface{}, error) {
+		return a.readState(ctx, actor, ts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return st.(*api.ActorState), nil
+}
+
+func (a *StateAPI) readState(ctx context.Context, actor address.Address, ts *types.TipSet) (*api.ActorState, error) {
 	state, err := a.stateForTs(ctx, ts)
 	if err != nil {
 		return nil, err
@@ -415,6 +477,13 @@ func (a *StateAPI) StateGetReceipt(ctx context.Context, msg cid.Cid, tsk types.T
 	return a.StateManager.GetReceipt(ctx, msg, ts)
 }
 
+func (a *StateAPI) StateRebuildMsgIndex(ctx context.Context, to abi.ChainEpoch) (int, error) {
+	if a.MsgIndex == nil {
+		return 0, xerrors.New("the message index is disabled, set MsgIndex.Enable in the node config")
+	}
+	return a.MsgIndex.Rebuild(ctx, a.Chain.GetHeaviestTipSet(), to)
+}
+
 func (a *StateAPI) StateListMiners(ctx context.Context, tsk types.TipSetKey) ([]address.Address, error) {
 	ts, err := a.Chain.GetTipSetFromKey(tsk)
 	if err != nil {
@@ -595,6 +664,51 @@ func (a *StateAPI) StateChangedActors(ctx context.Context, old cid.Cid, new cid.
 	return out, nil
 }
 
+func (a *StateAPI) StateWatchActors(ctx context.Context, addrs []address.Address) (<-chan []*api.ActorChange, error) {
+	if len(addrs) == 0 {
+		return nil, xerrors.New("no actors to watch")
+	}
+
+	sub := a.Chain.SubHeadChanges(ctx)
+	out := make(chan []*api.ActorChange, 16)
+
+	go func() {
+		defer close(out)
+
+		for hcs := range sub {
+			var changes []*api.ActorChange
+			for _, hc := range hcs {
+				if hc.Type == store.HCCurrent {
+					continue
+				}
+
+				ch, err := a.StateManager.ActorChanges(ctx, hc.Val, addrs)
+				if err != nil {
+					log.Errorf("computing actor changes at %d: %s", hc.Val.Height(), err)
+					continue
+				}
+
+				for _, c := range ch {
+					c.Reverted = hc.Type == store.HCRevert
+				}
+				changes = append(changes, ch...)
+			}
+
+			if len(changes) == 0 {
+				continue
+			}
+
+			select {
+			case out <- changes:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
 func (a *StateAPI) StateMinerSectorCount(ctx context.Context, addr address.Address, tsk types.TipSetKey) (api.MinerSectors, error) {
 	ts, err := a.Chain.GetTipSetFromKey(tsk)
 	if err != nil {
@@ -677,17 +791,81 @@ func (a *StateAPI) StateCompute(ctx context.Context, height abi.ChainEpoch, msgs
 	if err != nil {
 		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
 	}
-	st, t, err := stmgr.ComputeState(ctx, a.StateManager, height, msgs, ts)
+	st, t, applied, err := stmgr.ComputeState(ctx, a.StateManager, height, msgs, ts)
 	if err != nil {
 		return nil, err
 	}
 
 	return &api.ComputeStateOutput{
-		Root:  st,
-		Trace: t,
+		Root:    st,
+		Trace:   t,
+		Applied: applied,
 	}, nil
 }
 
+func (a *StateAPI) StateSnapshot(ctx context.Context, tsk types.TipSetKey) (<-chan []byte, error) {
+	if _, err := a.Chain.GetTipSetFromKey(tsk); err != nil {
+		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
+	}
+
+	return exportStream(ctx, "state", func(w io.Writer) error {
+		return a.StateManager.StateSnapshot(ctx, tsk, w)
+	}), nil
+}
+
+func (a *StateAPI) StateImportSnapshot(ctx context.Context, path string) (cid.Cid, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("opening state snapshot: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read only
+
+	// the snapshot is checked in a temporary blockstore before it's copied
+	// into the chain blockstore
+	tmp, err := ioutil.TempDir("", "lotus-state-import")
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("creating temporary blockstore: %w", err)
+	}
+	defer os.RemoveAll(tmp) //nolint:errcheck
+
+	ds, err := levelds.NewDatastore(tmp, nil)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("opening temporary blockstore: %w", err)
+	}
+	defer ds.Close() //nolint:errcheck
+
+	root, err := a.StateManager.ImportStateSnapshot(ctx, f, blockstore.NewBlockstore(ds))
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("importing state snapshot: %w", err)
+	}
+
+	log.Infof("imported state snapshot %s", root)
+	return root, nil
+}
+
+func (a *StateAPI) StateGasTrace(ctx context.Context, tsk types.TipSetKey) ([]*api.GasProfile, error) {
+	ts, err := a.Chain.GetTipSetFromKey(tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
+	}
+	return a.StateManager.GasTrace(ctx, ts)
+}
+
+func (a *StateAPI) StateCronExecution(ctx context.Context, tsk types.TipSetKey) (*api.CronExecution, error) {
+	ts, err := a.Chain.GetTipSetFromKey(tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
+	}
+	return a.StateManager.CronExecution(ctx, ts)
+}
+
+func (a *StateAPI) StateUpgradeDryRuns(ctx context.Context) ([]api.UpgradeDryRun, error) {
+	if a.DryRuns == nil {
+		return nil, xerrors.New("upgrade dry runs are disabled")
+	}
+	return a.DryRuns.Results(), nil
+}
+
 func (a *StateAPI) MsigGetAvailableBalance(ctx context.Context, addr address.Address, tsk types.TipSetKey) (types.BigInt, error) {
 	ts, err := a.Chain.GetTipSetFromKey(tsk)
 	if err != nil {
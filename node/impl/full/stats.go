@@ -0,0 +1,37 @@
+package full
+
+import (
+	"context"
+
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/rollups"
+)
+
+var errRollupsDisabled = xerrors.New("epoch rollups are not enabled, set EpochRollups.Enable in the node config")
+
+type StatsAPI struct {
+	fx.In
+
+	Rollups *rollups.Indexer `optional:"true"`
+}
+
+func (a *StatsAPI) StatsEpochRollups(ctx context.Context, from, to abi.ChainEpoch) ([]api.EpochRollup, error) {
+	if a.Rollups == nil {
+		return nil, errRollupsDisabled
+	}
+
+	return a.Rollups.Range(ctx, from, to)
+}
+
+func (a *StatsAPI) ChainGetBaseFeeHistory(ctx context.Context, from, to, resolution abi.ChainEpoch) ([]api.FeeHistoryPoint, error) {
+	if a.Rollups == nil {
+		return nil, errRollupsDisabled
+	}
+
+	return a.Rollups.FeeHistory(ctx, from, to, resolution)
+}
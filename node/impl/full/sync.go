@@ -86,6 +86,10 @@ func (a *SyncAPI) SyncIncomingBlocks(ctx context.Context) (<-chan *types.BlockHe
 	return a.Syncer.IncomingBlocks(ctx)
 }
 
+func (a *SyncAPI) SyncProgress(ctx context.Context) (<-chan api.SyncProgressEvent, error) {
+	return a.Syncer.SyncProgress(ctx)
+}
+
 func (a *SyncAPI) SyncMarkBad(ctx context.Context, bcid cid.Cid) error {
 	log.Warnf("Marking block %s as bad", bcid)
 	a.Syncer.MarkBad(bcid)
@@ -100,3 +104,16 @@ func (a *SyncAPI) SyncCheckBad(ctx context.Context, bcid cid.Cid) (string, error
 
 	return reason, nil
 }
+
+func (a *SyncAPI) NetBlocksyncPeers(ctx context.Context) ([]api.BlocksyncPeer, error) {
+	return a.Syncer.Bsync.PeerScores(), nil
+}
+
+func (a *SyncAPI) SyncPeerHealth(ctx context.Context) ([]api.PeerHealth, error) {
+	return a.Syncer.Bsync.PeerHealth(), nil
+}
+
+func (a *SyncAPI) SyncCheckpoint(ctx context.Context, tsk types.TipSetKey) error {
+	log.Warnf("Marking tipset %s as checkpoint", tsk)
+	return a.Syncer.SyncCheckpoint(ctx, tsk)
+}
@@ -0,0 +1,114 @@
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// MaxMulticallCalls limits the number of calls of a single multicall
+var MaxMulticallCalls = 256
+
+var (
+	contextType = reflect.TypeOf(new(context.Context)).Elem()
+	errorType   = reflect.TypeOf(new(error)).Elem()
+	tskType     = reflect.TypeOf(types.TipSetKey{})
+)
+
+func (n *FullNodeAPI) ChainMulticall(ctx context.Context, tsk types.TipSetKey, calls []api.Call) (*api.MulticallResult, error) {
+	if len(calls) > MaxMulticallCalls {
+		return nil, xerrors.Errorf("too many calls (%d), at most %d are allowed", len(calls), MaxMulticallCalls)
+	}
+
+	ts, err := n.ChainAPI.Chain.GetTipSetFromKey(tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
+	}
+
+	out := &api.MulticallResult{
+		TipSet:  ts.Key(),
+		Height:  ts.Height(),
+		Results: make([]api.CallResult, len(calls)),
+	}
+
+	self := reflect.ValueOf(api.FullNode(n))
+	for i, c := range calls {
+		res, err := n.call(ctx, self, ts.Key(), c)
+		if err != nil {
+			out.Results[i].Error = err.Error()
+			continue
+		}
+		out.Results[i].Result = res
+	}
+
+	return out, nil
+}
+
+// call executes a single call of a multicall, with empty tipset keys replaced
+// by tsk.
+func (n *FullNodeAPI) call(ctx context.Context, self reflect.Value, tsk types.TipSetKey, c api.Call) (json.RawMessage, error) {
+	// only read methods can be called, the multicall itself only requires
+	// the read permission
+	perm, ok := apistruct.FullNodeMethodPerm(c.Method)
+	if !ok {
+		return nil, xerrors.Errorf("unknown method %q", c.Method)
+	}
+	if perm != apistruct.PermRead || c.Method == "ChainMulticall" {
+		return nil, xerrors.Errorf("method %s can't be called in a multicall", c.Method)
+	}
+
+	m := self.MethodByName(c.Method)
+	if !m.IsValid() {
+		return nil, xerrors.Errorf("unknown method %q", c.Method)
+	}
+	mt := m.Type()
+
+	for i := 0; i < mt.NumOut(); i++ {
+		if mt.Out(i).Kind() == reflect.Chan {
+			return nil, xerrors.Errorf("method %s returns a channel, it can't be called in a multicall", c.Method)
+		}
+	}
+
+	if mt.NumIn() == 0 || mt.In(0) != contextType {
+		return nil, xerrors.Errorf("method %s doesn't take a context", c.Method)
+	}
+	if len(c.Params) != mt.NumIn()-1 {
+		return nil, xerrors.Errorf("method %s takes %d parameters, got %d", c.Method, mt.NumIn()-1, len(c.Params))
+	}
+
+	args := make([]reflect.Value, mt.NumIn())
+	args[0] = reflect.ValueOf(ctx)
+	for i, p := range c.Params {
+		v := reflect.New(mt.In(i + 1))
+		if err := json.Unmarshal(p, v.Interface()); err != nil {
+			return nil, xerrors.Errorf("unmarshaling parameter %d of %s: %w", i, c.Method, err)
+		}
+
+		if mt.In(i+1) == tskType && v.Elem().Interface().(types.TipSetKey).IsEmpty() {
+			v.Elem().Set(reflect.ValueOf(tsk))
+		}
+
+		args[i+1] = v.Elem()
+	}
+
+	outs := m.Call(args)
+
+	if last := outs[len(outs)-1]; mt.Out(len(outs)-1) == errorType && !last.IsNil() {
+		return nil, last.Interface().(error)
+	}
+	if len(outs) < 2 {
+		return nil, nil
+	}
+
+	res, err := json.Marshal(outs[0].Interface())
+	if err != nil {
+		return nil, xerrors.Errorf("marshaling result of %s: %w", c.Method, err)
+	}
+	return res, nil
+}
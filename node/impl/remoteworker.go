@@ -3,7 +3,10 @@ package impl
 import (
 	"context"
 	"net/http"
+	"sort"
+	"sync"
 
+	"github.com/google/uuid"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-jsonrpc"
@@ -13,12 +16,84 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/client"
+	"github.com/filecoin-project/lotus/storage"
 	"github.com/filecoin-project/sector-storage"
+	sealing "github.com/filecoin-project/storage-fsm"
 )
 
 type remoteWorker struct {
 	api.WorkerAPI
 	closer jsonrpc.ClientCloser
+
+	url string
+	// session identifies the worker across reconnects, it's nil for workers
+	// of older builds
+	session  uuid.UUID
+	versions *WorkerVersions
+
+	// the estimator is told about the tasks the worker starts
+	class     string
+	estimator *storage.SealingEstimator
+}
+
+// WorkerVersions tracks the connected remote workers and their versions. A
+// worker is identified by its session, so that a worker reconnecting, possibly
+// from another address, replaces its old connection. Workers of older builds,
+// which have no session, are identified by their url.
+type WorkerVersions struct {
+	lk      sync.Mutex
+	workers map[string]workerVersion
+}
+
+type workerVersion struct {
+	conn *remoteWorker
+	v    api.Version
+}
+
+func NewWorkerVersions() *WorkerVersions {
+	return &WorkerVersions{workers: map[string]workerVersion{}}
+}
+
+func (r *remoteWorker) key() string {
+	if r.session == uuid.Nil {
+		return r.url
+	}
+	return r.session.String()
+}
+
+// add registers the worker, and returns the connection it replaces if the
+// worker was connected already
+func (wv *WorkerVersions) add(r *remoteWorker, v api.Version) *remoteWorker {
+	wv.lk.Lock()
+	defer wv.lk.Unlock()
+
+	old := wv.workers[r.key()].conn
+	wv.workers[r.key()] = workerVersion{conn: r, v: v}
+	return old
+}
+
+// remove removes the worker, unless it reconnected already
+func (wv *WorkerVersions) remove(r *remoteWorker) {
+	wv.lk.Lock()
+	defer wv.lk.Unlock()
+	if wv.workers[r.key()].conn == r {
+		delete(wv.workers, r.key())
+	}
+}
+
+// list returns the connected workers, sorted by url
+func (wv *WorkerVersions) list() []workerVersion {
+	wv.lk.Lock()
+	defer wv.lk.Unlock()
+
+	out := make([]workerVersion, 0, len(wv.workers))
+	for _, w := range wv.workers {
+		out = append(out, w)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].conn.url < out[j].conn.url
+	})
+	return out
 }
 
 func (r *remoteWorker) NewSector(ctx context.Context, sector abi.SectorID) error {
@@ -29,6 +104,37 @@ func (r *remoteWorker) AddPiece(ctx context.Context, sector abi.SectorID, pieceS
 	return abi.PieceInfo{}, xerrors.New("unsupported")
 }
 
+func (r *remoteWorker) taskStarted(sector abi.SectorID, phase sealing.SectorState) {
+	if r.estimator != nil {
+		r.estimator.TaskStarted(sector.Number, phase, r.class)
+	}
+}
+
+func (r *remoteWorker) SealPreCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage2.PreCommit1Out, error) {
+	r.taskStarted(sector, sealing.PreCommit1)
+	return r.WorkerAPI.SealPreCommit1(ctx, sector, ticket, pieces)
+}
+
+func (r *remoteWorker) SealPreCommit2(ctx context.Context, sector abi.SectorID, pc1o storage2.PreCommit1Out) (storage2.SectorCids, error) {
+	r.taskStarted(sector, sealing.PreCommit2)
+	return r.WorkerAPI.SealPreCommit2(ctx, sector, pc1o)
+}
+
+func (r *remoteWorker) SealCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, seed abi.InteractiveSealRandomness, pieces []abi.PieceInfo, cids storage2.SectorCids) (storage2.Commit1Out, error) {
+	r.taskStarted(sector, sealing.Committing)
+	return r.WorkerAPI.SealCommit1(ctx, sector, ticket, seed, pieces, cids)
+}
+
+func (r *remoteWorker) SealCommit2(ctx context.Context, sector abi.SectorID, c1o storage2.Commit1Out) (storage2.Proof, error) {
+	r.taskStarted(sector, sealing.Committing)
+	return r.WorkerAPI.SealCommit2(ctx, sector, c1o)
+}
+
+func (r *remoteWorker) FinalizeSector(ctx context.Context, sector abi.SectorID, keepUnsealed []storage2.Range) error {
+	r.taskStarted(sector, sealing.FinalizeSector)
+	return r.WorkerAPI.FinalizeSector(ctx, sector, keepUnsealed)
+}
+
 func connectRemoteWorker(ctx context.Context, fa api.Common, url string) (*remoteWorker, error) {
 	token, err := fa.AuthNew(ctx, []auth.Permission{"admin"})
 	if err != nil {
@@ -43,10 +149,13 @@ func connectRemoteWorker(ctx context.Context, fa api.Common, url string) (*remot
 		return nil, xerrors.Errorf("creating jsonrpc client: %w", err)
 	}
 
-	return &remoteWorker{wapi, closer}, nil
+	return &remoteWorker{WorkerAPI: wapi, closer: closer, url: url}, nil
 }
 
 func (r *remoteWorker) Close() error {
+	if r.versions != nil {
+		r.versions.remove(r)
+	}
 	r.closer()
 	return nil
 }
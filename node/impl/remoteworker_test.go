@@ -0,0 +1,51 @@
+package impl
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+func TestWorkerVersionsReconnect(t *testing.T) {
+	wv := NewWorkerVersions()
+	session := uuid.New()
+
+	old := &remoteWorker{url: "http://worker-a/rpc/v0", session: session, versions: wv}
+	if r := wv.add(old, api.Version{Version: "old"}); r != nil {
+		t.Fatalf("expected a new session not to replace a connection, got %s", r.url)
+	}
+
+	// the worker reconnects from another address before the old connection
+	// is closed
+	cur := &remoteWorker{url: "http://worker-b/rpc/v0", session: session, versions: wv}
+	if r := wv.add(cur, api.Version{Version: "new"}); r != old {
+		t.Fatal("expected the reconnect to replace the old connection")
+	}
+	wv.remove(old)
+
+	ws := wv.list()
+	if len(ws) != 1 || ws[0].conn != cur || ws[0].v.Version != "new" {
+		t.Fatalf("expected only the new connection, got %+v", ws)
+	}
+
+	// workers without session are told apart by their url
+	legacy := &remoteWorker{url: "http://worker-c/rpc/v0", versions: wv}
+	if r := wv.add(legacy, api.Version{Version: "legacy"}); r != nil {
+		t.Fatalf("expected a worker without session not to replace a connection, got %s", r.url)
+	}
+	if r := wv.add(&remoteWorker{url: legacy.url, versions: wv}, api.Version{Version: "legacy"}); r != legacy {
+		t.Fatal("expected a worker without session to replace the connection from its url")
+	}
+
+	ws = wv.list()
+	if len(ws) != 2 || ws[0].conn.url != cur.url || ws[1].conn.url != legacy.url {
+		t.Fatalf("expected the workers sorted by url, got %+v", ws)
+	}
+
+	wv.remove(cur)
+	if ws := wv.list(); len(ws) != 1 {
+		t.Fatalf("expected one worker left, got %+v", ws)
+	}
+}
@@ -3,9 +3,12 @@ package impl
 import (
 	"context"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"golang.org/x/xerrors"
@@ -22,7 +25,9 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/backupds"
 	"github.com/filecoin-project/lotus/miner"
 	"github.com/filecoin-project/lotus/node/impl/common"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
@@ -40,7 +45,14 @@ type StorageMinerAPI struct {
 	Miner           *storage.Miner
 	BlockMiner      *miner.Miner
 	Full            api.FullNode
-	StorageMgr      *sectorstorage.Manager `optional:"true"`
+	StorageMgr      *sectorstorage.Manager   `optional:"true"`
+	Watchdog        *storage.Watchdog        `optional:"true"`
+	CommitDeadlines *storage.CommitDeadlines `optional:"true"`
+	PledgePolicy    *storage.PledgePolicy    `optional:"true"`
+	Estimator       *storage.SealingEstimator
+	Maintenance     *storage.Maintenance
+	WorkerVersions  *WorkerVersions
+	DS              dtypes.MetadataDS
 	*stores.Index
 
 	ConsiderOnlineStorageDealsConfigFunc       dtypes.ConsiderOnlineStorageDealsConfigFunc
@@ -81,6 +93,10 @@ func (sm *StorageMinerAPI) MiningBase(ctx context.Context) (*types.TipSet, error
 	return mb.TipSet, nil
 }
 
+func (sm *StorageMinerAPI) MiningReport(ctx context.Context) ([]api.MinedBlockTimings, error) {
+	return sm.BlockMiner.MiningReport(), nil
+}
+
 func (sm *StorageMinerAPI) ActorSectorSize(ctx context.Context, addr address.Address) (abi.SectorSize, error) {
 	mi, err := sm.Full.StateMinerInfo(ctx, addr, types.EmptyTSK)
 	if err != nil {
@@ -89,7 +105,14 @@ func (sm *StorageMinerAPI) ActorSectorSize(ctx context.Context, addr address.Add
 	return mi.SectorSize, nil
 }
 
+func (sm *StorageMinerAPI) NetworkParams(ctx context.Context) (build.NetworkParams, error) {
+	return build.CurrentNetworkParams(), nil
+}
+
 func (sm *StorageMinerAPI) PledgeSector(ctx context.Context) error {
+	if sm.Maintenance.Active() {
+		return storage.ErrMaintenance
+	}
 	return sm.Miner.PledgeSector()
 }
 
@@ -185,15 +208,130 @@ func (sm *StorageMinerAPI) SectorRemove(ctx context.Context, id abi.SectorNumber
 	return sm.Miner.RemoveSector(ctx, id)
 }
 
+func (sm *StorageMinerAPI) SectorsStuck(context.Context) ([]api.StuckSector, error) {
+	if sm.Watchdog == nil {
+		return nil, xerrors.New("sealing watchdog is disabled")
+	}
+	return sm.Watchdog.Stuck(), nil
+}
+
+func (sm *StorageMinerAPI) SectorsCommitDeadlines(context.Context) ([]api.SectorCommitDeadline, error) {
+	if sm.CommitDeadlines == nil {
+		return nil, xerrors.New("commit deadline tracking is disabled")
+	}
+	return sm.CommitDeadlines.Sectors(), nil
+}
+
+func (sm *StorageMinerAPI) SectorsPledgePolicy(context.Context) (api.PledgePolicyStatus, error) {
+	if sm.PledgePolicy == nil {
+		return api.PledgePolicyStatus{}, xerrors.New("pledge policy is disabled")
+	}
+	return sm.PledgePolicy.Status(), nil
+}
+
+func (sm *StorageMinerAPI) MaintenanceStart(ctx context.Context, reason string) error {
+	return sm.Maintenance.Start(reason)
+}
+
+func (sm *StorageMinerAPI) MaintenanceStop(ctx context.Context) error {
+	return sm.Maintenance.Stop()
+}
+
+func (sm *StorageMinerAPI) MaintenanceCheckpoint(ctx context.Context) ([]abi.SectorNumber, error) {
+	if !sm.Maintenance.Active() {
+		return nil, xerrors.New("maintenance mode not enabled")
+	}
+	return sm.Miner.CheckpointSectorTasks(), nil
+}
+
+func (sm *StorageMinerAPI) MaintenanceStatus(ctx context.Context) (api.MaintenanceStatus, error) {
+	return sm.Maintenance.Status(ctx, sm.Miner, sm.StorageMgr.WorkerStats())
+}
+
+func (sm *StorageMinerAPI) SectorsEstimates(context.Context) ([]api.SectorEstimate, error) {
+	return sm.Estimator.Estimates(time.Now()), nil
+}
+
 func (sm *StorageMinerAPI) WorkerConnect(ctx context.Context, url string) error {
 	w, err := connectRemoteWorker(ctx, sm, url)
 	if err != nil {
 		return xerrors.Errorf("connecting remote storage failed: %w", err)
 	}
 
-	log.Infof("Connected to a remote worker at %s", url)
+	// workers which don't report their version run an older build, only
+	// their API version is known
+	wv, err := w.VersionInfo(ctx)
+	if err != nil {
+		log.Warnf("getting version of the worker at %s, is it running an older build? %s", url, err)
+
+		apiv, err := w.Version(ctx)
+		if err != nil {
+			_ = w.Close()
+			return xerrors.Errorf("getting API version of the worker at %s: %w", url, err)
+		}
+		wv = api.Version{Version: "unknown", APIVersion: apiv}
+	}
+	if err := api.LocalVersion().Compatible(wv); err != nil {
+		_ = w.Close()
+		return xerrors.Errorf("refusing incompatible worker at %s: %w", url, err)
+	}
+
+	session, err := w.Session(ctx)
+	if err != nil {
+		// workers running an older version don't have sessions
+		log.Warnf("getting worker session: %s", err)
+	}
+	w.session = session
+
+	info, err := w.Info(ctx)
+	if err != nil {
+		_ = w.Close()
+		return xerrors.Errorf("getting info of the worker at %s: %w", url, err)
+	}
+	w.class = storage.WorkerClass(info)
+	w.estimator = sm.Estimator
+
+	log.Infof("Connected to a remote worker at %s (session %s, version %s, class %s)", url, session, wv, w.class)
+
+	w.versions = sm.WorkerVersions
+	if old := sm.WorkerVersions.add(w, wv); old != nil {
+		// closing the old connection fails the calls still in flight on it,
+		// which the sealing state machine retries, and removes it from the
+		// scheduler
+		log.Infof("worker session %s reconnected from %s, closing its connection from %s", session, url, old.url)
+		_ = old.Close()
+	}
 
-	return sm.StorageMgr.AddWorker(ctx, w)
+	if err := sm.StorageMgr.AddWorker(ctx, w); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return nil
+}
+
+func (sm *StorageMinerAPI) VersionCheck(ctx context.Context) ([]api.ComponentVersion, error) {
+	local := api.LocalVersion()
+	out := []api.ComponentVersion{{Component: "miner", Version: local}}
+
+	component := func(name string, v api.Version) api.ComponentVersion {
+		cv := api.ComponentVersion{Component: name, Version: v}
+		if err := local.Compatible(v); err != nil {
+			cv.Incompatible = err.Error()
+		}
+		return cv
+	}
+
+	fv, err := sm.Full.Version(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("getting full node version: %w", err)
+	}
+	out = append(out, component("full node", fv))
+
+	for _, w := range sm.WorkerVersions.list() {
+		out = append(out, component("worker "+w.conn.url, w.v))
+	}
+
+	return out, nil
 }
 
 func (sm *StorageMinerAPI) MarketImportDealData(ctx context.Context, propCid cid.Cid, path string) error {
@@ -289,4 +427,47 @@ func (sm *StorageMinerAPI) StorageAddLocal(ctx context.Context, path string) err
 	return sm.StorageMgr.AddLocalStorage(ctx, path)
 }
 
+func (sm *StorageMinerAPI) StorageCheckSectors(ctx context.Context, path string) ([]api.SectorFileIssue, error) {
+	return sm.Miner.CheckSectorFiles(ctx, path)
+}
+
+func (sm *StorageMinerAPI) MinerBackup(ctx context.Context, path string) error {
+	bds, ok := sm.DS.(*backupds.Datastore)
+	if !ok {
+		return xerrors.Errorf("expected a backup datastore, got %T", sm.DS)
+	}
+
+	// write to a temporary file first, so that an existing backup at path is
+	// only replaced by a complete one. The file has a unique name, a backup
+	// interrupted by a crash doesn't block the next ones.
+	out, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return xerrors.Errorf("creating backup file: %w", err)
+	}
+	tmp := out.Name()
+
+	if err := bds.Backup(out); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return xerrors.Errorf("backup error: %w", err)
+	}
+
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return xerrors.Errorf("syncing backup file: %w", err)
+	}
+
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return xerrors.Errorf("closing backup file: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return xerrors.Errorf("moving backup into place: %w", err)
+	}
+	return nil
+}
+
 var _ api.StorageMiner = &StorageMinerAPI{}
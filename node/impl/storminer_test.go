@@ -0,0 +1,80 @@
+package impl
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	"github.com/filecoin-project/lotus/lib/backupds"
+)
+
+func TestMinerBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "minerbackup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	ds := backupds.Wrap(dssync.MutexWrap(datastore.NewMapDatastore()))
+	sm := &StorageMinerAPI{DS: ds}
+	path := filepath.Join(dir, "backup.cbor")
+
+	// the temporary file of a backup interrupted by a crash
+	stale := path + ".tmp"
+	if err := ioutil.WriteFile(stale, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	backup := func(value string) {
+		t.Helper()
+		if err := ds.Put(datastore.NewKey("/sectors/1"), []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+		if err := sm.MinerBackup(context.TODO(), path); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close() //nolint:errcheck
+
+		var restored string
+		if err := backupds.ReadBackup(f, func(key datastore.Key, v []byte) error {
+			if key.String() == "/sectors/1" {
+				restored = string(v)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if restored != value {
+			t.Fatalf("expected the backup to contain %q, got %q", value, restored)
+		}
+	}
+
+	backup("first")
+	// an existing backup is replaced
+	backup("second")
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected only the backup and the stale file, got %d files", len(files))
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected the backup to only be readable by the user, got %s", fi.Mode())
+	}
+}
@@ -0,0 +1,134 @@
+package modules
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/alerting"
+	"github.com/filecoin-project/lotus/node/config"
+	"github.com/filecoin-project/lotus/node/impl/full"
+	"github.com/filecoin-project/lotus/node/modules/helpers"
+	"github.com/filecoin-project/lotus/node/repo"
+)
+
+func Alerting(cfg config.Alerting) func() *alerting.Alerting {
+	return func() *alerting.Alerting {
+		var hooks []alerting.Hook
+		for _, u := range cfg.Webhooks {
+			hooks = append(hooks, &alerting.Webhook{URL: u})
+		}
+		for _, c := range cfg.Commands {
+			hooks = append(hooks, &alerting.Exec{Command: c})
+		}
+
+		return alerting.New(hooks...)
+	}
+}
+
+func RunFullNodeAlerts(cfg config.Alerting) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, al *alerting.Alerting, lr repo.LockedRepo, chain full.ChainAPI, wallet full.WalletAPI) error {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, al *alerting.Alerting, lr repo.LockedRepo, chain full.ChainAPI, wallet full.WalletAPI) error {
+		var watch []address.Address
+		for _, s := range cfg.WatchWallets {
+			a, err := address.NewFromString(s)
+			if err != nil {
+				return xerrors.Errorf("parsing watched wallet address %q: %w", s, err)
+			}
+			watch = append(watch, a)
+		}
+
+		minBalance := types.NewInt(0)
+		if len(watch) > 0 {
+			fil, err := types.ParseFIL(cfg.MinWalletBalance)
+			if err != nil {
+				return xerrors.Errorf("parsing minimum wallet balance: %w", err)
+			}
+			minBalance = types.BigInt(fil)
+		}
+
+		runAlertChecks(mctx, lc, cfg, func(ctx context.Context) {
+			checkDisk(al, cfg, lr.Path())
+
+			if cfg.SyncStallEpochs > 0 {
+				hi, err := chain.ChainHeadInfo(ctx)
+				if err != nil {
+					log.Warnf("alerting: getting head info: %s", err)
+				} else {
+					al.Set(alerting.SyncStalled, uint64(hi.EpochsBehind) > cfg.SyncStallEpochs,
+						"chain head %d is %d epochs behind", hi.TipSet.Height(), hi.EpochsBehind)
+				}
+			}
+
+			for _, a := range watch {
+				bal, err := wallet.WalletBalance(ctx, a)
+				if err != nil {
+					log.Warnf("alerting: getting balance of %s: %s", a, err)
+					continue
+				}
+
+				al.Set(alerting.LowBalance+"/"+a.String(), bal.LessThan(minBalance),
+					"wallet %s balance %s, minimum %s", a, types.FIL(bal), types.FIL(minBalance))
+			}
+		})
+
+		return nil
+	}
+}
+
+func RunMinerAlerts(cfg config.Alerting) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, al *alerting.Alerting, lr repo.LockedRepo) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, al *alerting.Alerting, lr repo.LockedRepo) {
+		runAlertChecks(mctx, lc, cfg, func(ctx context.Context) {
+			checkDisk(al, cfg, lr.Path())
+		})
+	}
+}
+
+func runAlertChecks(mctx helpers.MetricsCtx, lc fx.Lifecycle, cfg config.Alerting, check func(context.Context)) {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+
+	interval := time.Duration(cfg.CheckInterval)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				tick := time.NewTicker(interval)
+				defer tick.Stop()
+
+				// the first check runs right away, so that conditions which
+				// already hold at startup don't wait a whole interval
+				for {
+					check(ctx)
+
+					select {
+					case <-tick.C:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return nil
+		},
+	})
+}
+
+func checkDisk(al *alerting.Alerting, cfg config.Alerting, path string) {
+	if cfg.MaxDiskUsage <= 0 {
+		return
+	}
+
+	usage, err := alerting.DiskUsage(path)
+	if err != nil {
+		log.Warnf("alerting: %s", err)
+		return
+	}
+
+	al.Set(alerting.DiskNearlyFull, usage*100 > cfg.MaxDiskUsage,
+		"filesystem holding %s is %.1f%% full", path, usage*100)
+}
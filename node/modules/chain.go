@@ -3,11 +3,17 @@ package modules
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"time"
 
 	"github.com/ipfs/go-bitswap"
 	"github.com/ipfs/go-bitswap/network"
 	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	"github.com/ipld/go-car"
 	"github.com/libp2p/go-libp2p-core/host"
@@ -16,16 +22,27 @@ import (
 	"go.uber.org/fx"
 	"golang.org/x/xerrors"
 
+	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/sector-storage/ffiwrapper"
-	"github.com/filecoin-project/specs-actors/actors/runtime"
+	"github.com/filecoin-project/specs-actors/actors/abi"
 
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain"
 	"github.com/filecoin-project/lotus/chain/beacon"
 	"github.com/filecoin-project/lotus/chain/blocksync"
+	"github.com/filecoin-project/lotus/chain/changefeed"
+	"github.com/filecoin-project/lotus/chain/deposits"
+	"github.com/filecoin-project/lotus/chain/events"
 	"github.com/filecoin-project/lotus/chain/messagepool"
+	"github.com/filecoin-project/lotus/chain/msgindex"
+	"github.com/filecoin-project/lotus/chain/rollups"
 	"github.com/filecoin-project/lotus/chain/stmgr"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/vm"
+	"github.com/filecoin-project/lotus/lib/alerting"
+	"github.com/filecoin-project/lotus/node/config"
+	"github.com/filecoin-project/lotus/node/impl/full"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/node/modules/helpers"
 	"github.com/filecoin-project/lotus/node/repo"
@@ -60,7 +77,31 @@ func MessagePool(lc fx.Lifecycle, sm *stmgr.StateManager, ps *pubsub.PubSub, ds
 	return mp, nil
 }
 
+func SetMpoolConfig(cfg config.Mpool) func(mp *messagepool.MessagePool) error {
+	return func(mp *messagepool.MessagePool) error {
+		mp.SetPendingFundsTolerance(cfg.PendingFundsTolerance)
+
+		rcfg := messagepool.DefaultRepublishConfig()
+		if cfg.RepublishInterval != 0 {
+			rcfg.Interval = time.Duration(cfg.RepublishInterval)
+		}
+		rcfg.MaxAttempts = cfg.RepublishMaxAttempts
+		return mp.SetRepublishConfig(rcfg)
+	}
+}
+
+// ChainBlockstore is the blockstore shared by the chain store, bitswap and
+// graphsync. Writes go through the prune guard, so that objects fetched while
+// the chain store is pruned aren't removed.
 func ChainBlockstore(lc fx.Lifecycle, mctx helpers.MetricsCtx, r repo.LockedRepo) (dtypes.ChainBlockstore, error) {
+	bs, err := chainHotBlockstore(lc, mctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return store.NewPruneGuard(bs), nil
+}
+
+func chainHotBlockstore(lc fx.Lifecycle, mctx helpers.MetricsCtx, r repo.LockedRepo) (blockstore.Blockstore, error) {
 	blocks, err := r.Datastore("/chain")
 	if err != nil {
 		return nil, err
@@ -83,8 +124,9 @@ func ChainBlockservice(bs dtypes.ChainBlockstore, rem dtypes.ChainExchange) dtyp
 	return blockservice.New(bs, rem)
 }
 
-func ChainStore(lc fx.Lifecycle, bs dtypes.ChainBlockstore, ds dtypes.MetadataDS, syscalls runtime.Syscalls) *store.ChainStore {
+func ChainStore(lc fx.Lifecycle, r repo.LockedRepo, bs dtypes.ChainBlockstore, ds dtypes.MetadataDS, syscalls vm.Syscalls) *store.ChainStore {
 	chain := store.NewChainStore(bs, ds, syscalls)
+	chain.SetPruneMarkDir(filepath.Join(r.Path(), "prune"))
 
 	if err := chain.Load(); err != nil {
 		log.Warnf("loading chain state from disk: %s", err)
@@ -93,6 +135,24 @@ func ChainStore(lc fx.Lifecycle, bs dtypes.ChainBlockstore, ds dtypes.MetadataDS
 	return chain
 }
 
+func SetChainCacheSizes(cfg config.ChainCache) func(cs *store.ChainStore) error {
+	return func(cs *store.ChainStore) error {
+		if err := cs.SetCacheSizes(cfg.TipSets, cfg.BlockHeaders); err != nil {
+			return err
+		}
+		return cs.SetStateCacheSize(cfg.StateObjects)
+	}
+}
+
+func StateManager(cs *store.ChainStore, ds dtypes.MetadataDS) (*stmgr.StateManager, error) {
+	sm := stmgr.NewStateManager(cs)
+	if err := sm.EnableLookbackCache(namespace.Wrap(ds, datastore.NewKey("/stmgr/lookback"))); err != nil {
+		return nil, xerrors.Errorf("enabling lookback cache: %w", err)
+	}
+
+	return sm, nil
+}
+
 func ErrorGenesis() Genesis {
 	return func() (header *types.BlockHeader, e error) {
 		return nil, xerrors.New("No genesis block provided, provide the file with 'lotus daemon --genesis=[genesis file]'")
@@ -106,8 +166,8 @@ func LoadGenesis(genBytes []byte) func(dtypes.ChainBlockstore) Genesis {
 			if err != nil {
 				return nil, xerrors.Errorf("loading genesis car file failed: %w", err)
 			}
-			if len(c.Roots) != 1 {
-				return nil, xerrors.New("expected genesis file to have one root")
+			if len(c.Roots) != 1 && len(c.Roots) != 2 {
+				return nil, xerrors.New("expected genesis file to have one root, and optionally network params")
 			}
 			root, err := bs.Get(c.Roots[0])
 			if err != nil {
@@ -123,6 +183,37 @@ func LoadGenesis(genBytes []byte) func(dtypes.ChainBlockstore) Genesis {
 	}
 }
 
+// GenesisNetworkParams returns the network params stored in the genesis file,
+// or nil if it has none. They must be applied before the node is constructed.
+func GenesisNetworkParams(genBytes []byte) (*build.NetworkParams, error) {
+	cr, err := car.NewCarReader(bytes.NewReader(genBytes))
+	if err != nil {
+		return nil, xerrors.Errorf("reading genesis car file: %w", err)
+	}
+	if len(cr.Header.Roots) < 2 {
+		return nil, nil
+	}
+
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			return nil, xerrors.Errorf("genesis file is missing its network params")
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("reading genesis car file: %w", err)
+		}
+		if !blk.Cid().Equals(cr.Header.Roots[1]) {
+			continue
+		}
+
+		var p build.NetworkParams
+		if err := json.Unmarshal(blk.RawData(), &p); err != nil {
+			return nil, xerrors.Errorf("decoding genesis network params: %w", err)
+		}
+		return &p, nil
+	}
+}
+
 func DoSetGenesis(_ dtypes.AfterGenesisSet) {}
 
 func SetGenesis(cs *store.ChainStore, g Genesis) (dtypes.AfterGenesisSet, error) {
@@ -149,11 +240,16 @@ func NetworkName(mctx helpers.MetricsCtx, lc fx.Lifecycle, cs *store.ChainStore,
 	return netName, err
 }
 
-func NewSyncer(lc fx.Lifecycle, sm *stmgr.StateManager, bsync *blocksync.BlockSync, h host.Host, beacon beacon.RandomBeacon, verifier ffiwrapper.Verifier) (*chain.Syncer, error) {
+func NewSyncer(lc fx.Lifecycle, sm *stmgr.StateManager, bsync *blocksync.BlockSync, h host.Host, beacon beacon.RandomBeacon, verifier ffiwrapper.Verifier, pf chain.Prefetcher, workers chain.SyncWorkers, thresh chain.SyncTargetThreshold, cps *chain.Checkpoints, skew chain.ClockSkewPolicy) (*chain.Syncer, error) {
 	syncer, err := chain.NewSyncer(sm, bsync, h.ConnManager(), h.ID(), beacon, verifier)
 	if err != nil {
 		return nil, err
 	}
+	syncer.SetPrefetcher(pf)
+	syncer.SetSyncWorkers(workers)
+	syncer.SetSyncTargetThreshold(thresh)
+	syncer.SetCheckpoints(cps)
+	syncer.SetClockSkewPolicy(skew)
 
 	lc.Append(fx.Hook{
 		OnStart: func(_ context.Context) error {
@@ -167,3 +263,328 @@ func NewSyncer(lc fx.Lifecycle, sm *stmgr.StateManager, bsync *blocksync.BlockSy
 	})
 	return syncer, nil
 }
+
+// SyncCheckpoints loads the checkpoints built into the binary, the configured
+// ones and the ones persisted in the metadata datastore
+func SyncCheckpoints(cfg config.SyncCheckpoints) func(ds dtypes.MetadataDS, cs *store.ChainStore) (*chain.Checkpoints, error) {
+	return func(ds dtypes.MetadataDS, cs *store.ChainStore) (*chain.Checkpoints, error) {
+		cps, err := chain.NewCheckpoints(ds)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range append(append([]string{}, build.Checkpoints...), cfg.Tipsets...) {
+			h, tsk, err := chain.ParseCheckpoint(s)
+			if err != nil {
+				return nil, xerrors.Errorf("parsing checkpoint %q: %w", s, err)
+			}
+			if err := cps.Add(h, tsk); err != nil {
+				return nil, err
+			}
+
+			// the local chain isn't switched, the operator has to decide
+			// whether to trust the checkpoint
+			head := cs.GetHeaviestTipSet()
+			if head == nil || head.Height() < h {
+				continue
+			}
+			ts, err := cs.GetTipsetByHeight(context.TODO(), h, head, false)
+			if err != nil {
+				return nil, xerrors.Errorf("loading tipset at checkpoint height %d: %w", h, err)
+			}
+			if ts.Key() != tsk {
+				log.Errorw("local chain conflicts with a checkpoint, use 'lotus sync checkpoint' to switch to its chain",
+					"height", h, "checkpoint", tsk, "local", ts.Key())
+			}
+		}
+
+		return cps, nil
+	}
+}
+
+func SyncPrefetcher(cfg config.SyncPrefetch) func(lc fx.Lifecycle, cs *store.ChainStore) chain.Prefetcher {
+	return func(lc fx.Lifecycle, cs *store.ChainStore) chain.Prefetcher {
+		pf := chain.NewStatePrefetcher(cs, cfg.Workers, cfg.Queue, cfg.Parallelism)
+		lc.Append(fx.Hook{
+			OnStop: func(_ context.Context) error {
+				return pf.Close()
+			},
+		})
+		return pf
+	}
+}
+
+// prewarmBehindEpochs is how far the head has to fall behind the wall clock
+// for the node to be considered out of sync, and prewarm again once it
+// catches up.
+const prewarmBehindEpochs = 10
+
+func BlocksyncServerLimits(cfg config.BlocksyncServer) blocksync.ServerLimits {
+	return blocksync.ServerLimits{
+		PeerRequestRate:       cfg.PeerRequestRate,
+		PeerRequestBurst:      cfg.PeerRequestBurst,
+		PeerTipSetRate:        cfg.PeerTipSetRate,
+		PeerTipSetBurst:       cfg.PeerTipSetBurst,
+		MaxConcurrentRequests: cfg.MaxConcurrentRequests,
+		PeerQueueLength:       cfg.PeerQueueLength,
+		QueueTimeout:          time.Duration(cfg.QueueTimeout),
+		BusyRetryAfter:        time.Duration(cfg.BusyRetryAfter),
+		PeerByteQuota:         cfg.PeerByteQuota,
+		QuotaWindow:           time.Duration(cfg.QuotaWindow),
+	}
+}
+
+func BlocksyncClientTimeouts(cfg config.BlocksyncClient) blocksync.ClientTimeouts {
+	return blocksync.ClientTimeouts{
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		MinResponseSpeed:  cfg.MinResponseSpeed,
+		ReadWait:          time.Duration(cfg.ReadWait),
+		ReadWaitPerTipSet: time.Duration(cfg.ReadWaitPerTipSet),
+		MaxReadWait:       time.Duration(cfg.MaxReadWait),
+		PreferGraphsync:   cfg.PreferGraphsync,
+	}
+}
+
+func UpgradeDryRunner(cfg config.UpgradeDryRun) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, sm *stmgr.StateManager, al *alerting.Alerting) *stmgr.UpgradeDryRunner {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, sm *stmgr.StateManager, al *alerting.Alerting) *stmgr.UpgradeDryRunner {
+		r := stmgr.NewUpgradeDryRunner(sm, al, abi.ChainEpoch(cfg.EpochsBefore))
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go r.Run(ctx)
+				return nil
+			},
+		})
+
+		return r
+	}
+}
+
+func PrewarmState(cfg config.StatePrewarm) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, sm *stmgr.StateManager) error {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, sm *stmgr.StateManager) error {
+		var actors []address.Address
+		for _, s := range cfg.Actors {
+			a, err := address.NewFromString(s)
+			if err != nil {
+				return xerrors.Errorf("parsing prewarm actor address %q: %w", s, err)
+			}
+			actors = append(actors, a)
+		}
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				gen, err := sm.ChainStore().GetGenesis()
+				if err != nil {
+					return xerrors.Errorf("loading genesis: %w", err)
+				}
+
+				go func() {
+					warm := false
+					for changes := range sm.ChainStore().SubHeadChanges(ctx) {
+						head := changes[len(changes)-1].Val
+
+						now := uint64(time.Now().Unix())
+						if now < gen.Timestamp {
+							continue
+						}
+						wallclock := abi.ChainEpoch((now - gen.Timestamp) / build.BlockDelaySecs)
+						behind := wallclock - head.Height()
+
+						if behind > prewarmBehindEpochs {
+							warm = false
+							continue
+						}
+						if warm || behind > 1 {
+							continue
+						}
+						warm = true
+
+						start := time.Now()
+						n, err := sm.Prewarm(ctx, head, actors, cfg.Depth)
+						if err != nil {
+							log.Warnf("prewarming state: %s", err)
+							continue
+						}
+						log.Infow("prewarmed state", "height", head.Height(), "blocks", n, "took", time.Since(start))
+					}
+				}()
+				return nil
+			},
+		})
+
+		return nil
+	}
+}
+
+// pruneBehindEpochs is how far the head can be behind the wall clock for
+// scheduled prunes to run, so that they don't slow down syncing
+const pruneBehindEpochs = 10
+
+func RunChainPruner(cfg config.ChainPrune) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, cs *store.ChainStore) error {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, cs *store.ChainStore) error {
+		keep := abi.ChainEpoch(cfg.KeepStateRoots)
+		if keep < store.MinKeepStateRoots {
+			return xerrors.Errorf("chain pruning must keep at least %d state roots, got %d", store.MinKeepStateRoots, keep)
+		}
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				gen, err := cs.GetGenesis()
+				if err != nil {
+					return xerrors.Errorf("loading genesis: %w", err)
+				}
+
+				go func() {
+					tick := time.NewTicker(time.Duration(cfg.Interval))
+					defer tick.Stop()
+
+					for {
+						select {
+						case <-tick.C:
+						case <-ctx.Done():
+							return
+						}
+
+						now := uint64(time.Now().Unix())
+						wallclock := abi.ChainEpoch((now - gen.Timestamp) / build.BlockDelaySecs)
+						if behind := wallclock - cs.GetHeaviestTipSet().Height(); behind > pruneBehindEpochs {
+							log.Infow("skipping chain prune while syncing", "behind", behind)
+							continue
+						}
+
+						if _, err := cs.Prune(ctx, keep, false); err != nil {
+							log.Errorf("pruning chain store: %s", err)
+						}
+					}
+				}()
+				return nil
+			},
+		})
+
+		return nil
+	}
+}
+
+// RunChainPrunerKeep runs the chain pruner configured in the repo, keeping
+// keep state roots, for the --keep-state-roots daemon flag
+func RunChainPrunerKeep(keep uint64) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, cs *store.ChainStore, r repo.LockedRepo) error {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, cs *store.ChainStore, r repo.LockedRepo) error {
+		raw, err := r.Config()
+		if err != nil {
+			return err
+		}
+		cfg, ok := raw.(*config.FullNode)
+		if !ok {
+			return xerrors.New("expected address of config.FullNode")
+		}
+
+		pcfg := cfg.ChainPrune
+		pcfg.KeepStateRoots = keep
+		return RunChainPruner(pcfg)(mctx, lc, cs)
+	}
+}
+
+func DepositScanner(cfg config.Deposits) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, sm *stmgr.StateManager, ds dtypes.MetadataDS) (*deposits.Scanner, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, sm *stmgr.StateManager, ds dtypes.MetadataDS) (*deposits.Scanner, error) {
+		var watch []address.Address
+		for _, s := range cfg.Addresses {
+			a, err := address.NewFromString(s)
+			if err != nil {
+				return nil, xerrors.Errorf("parsing deposit address %q: %w", s, err)
+			}
+			watch = append(watch, a)
+		}
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		ds = namespace.Wrap(ds, datastore.NewKey("/deposits"))
+		s := deposits.New(sm, ds, watch, abi.ChainEpoch(cfg.Confirmations))
+
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go s.Run(ctx)
+				return nil
+			},
+		})
+
+		return s, nil
+	}
+}
+
+func RollupIndexer(mctx helpers.MetricsCtx, lc fx.Lifecycle, sm *stmgr.StateManager, ds dtypes.MetadataDS) *rollups.Indexer {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	ix := rollups.New(sm, namespace.Wrap(ds, datastore.NewKey("/rollups")))
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go ix.Run(ctx)
+			return nil
+		},
+	})
+
+	return ix
+}
+
+func MsgIndex(mctx helpers.MetricsCtx, lc fx.Lifecycle, sm *stmgr.StateManager, ds dtypes.MetadataDS) *msgindex.Index {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	ix := msgindex.New(sm.ChainStore(), namespace.Wrap(ds, datastore.NewKey("/msgindex")))
+	sm.SetMsgIndex(ix)
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go ix.Run(ctx)
+			return nil
+		},
+	})
+
+	return ix
+}
+
+func Changefeed(cfg config.Changefeed) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, cs *store.ChainStore, ds dtypes.MetadataDS) (*changefeed.Feed, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, cs *store.ChainStore, ds dtypes.MetadataDS) (*changefeed.Feed, error) {
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		f, err := changefeed.New(cs, namespace.Wrap(ds, datastore.NewKey("/changefeed")), cfg.Retention)
+		if err != nil {
+			return nil, xerrors.Errorf("opening changefeed: %w", err)
+		}
+
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go f.Run(ctx)
+				return nil
+			},
+		})
+
+		return f, nil
+	}
+}
+
+type chainEventsAPI struct {
+	full.ChainAPI
+	full.StateAPI
+}
+
+func ChainEvents(mctx helpers.MetricsCtx, lc fx.Lifecycle, chain full.ChainAPI, state full.StateAPI) *events.Events {
+	return events.NewEvents(helpers.LifecycleCtx(mctx, lc), &chainEventsAPI{chain, state})
+}
+
+func RouteExperimentalActors(cfg config.ExperimentalActors) func() error {
+	return func() error {
+		for _, r := range cfg.Routes {
+			code, err := cid.Decode(r.Code)
+			if err != nil {
+				return xerrors.Errorf("parsing actor code cid %q: %w", r.Code, err)
+			}
+
+			if err := vm.RouteExternalActor(code, r.Runtime, abi.ChainEpoch(r.ActivationHeight)); err != nil {
+				return xerrors.Errorf("routing actor %s: %w", code, err)
+			}
+		}
+
+		return nil
+	}
+}
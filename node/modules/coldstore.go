@@ -0,0 +1,137 @@
+package modules
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	dgbadger "github.com/dgraph-io/badger/v2"
+	badger "github.com/ipfs/go-ds-badger2"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/lib/coldstore"
+	"github.com/filecoin-project/lotus/node/config"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/filecoin-project/lotus/node/modules/helpers"
+	"github.com/filecoin-project/lotus/node/repo"
+)
+
+// ColdSplitBlockstore keeps recent chain data in the repo's chain datastore,
+// and historical data in the configured cold store
+func ColdSplitBlockstore(cfg config.ColdStore) func(lc fx.Lifecycle, mctx helpers.MetricsCtx, r repo.LockedRepo) (*coldstore.Split, error) {
+	return func(lc fx.Lifecycle, mctx helpers.MetricsCtx, r repo.LockedRepo) (*coldstore.Split, error) {
+		hot, err := chainHotBlockstore(lc, mctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		path := cfg.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.Path(), path)
+		}
+
+		var cold blockstore.Blockstore
+		var closeCold func() error
+		switch cfg.Type {
+		case "car":
+			shards, err := coldstore.OpenCarShards(path, cfg.ShardSize)
+			if err != nil {
+				return nil, err
+			}
+			cold, closeCold = shards, shards.Close
+		case "badger":
+			opts := badger.DefaultOptions
+			opts.Options = dgbadger.DefaultOptions("").WithTruncate(true).
+				WithValueThreshold(1 << 10)
+
+			ds, err := badger.NewDatastore(path, &opts)
+			if err != nil {
+				return nil, xerrors.Errorf("opening cold store: %w", err)
+			}
+			cold, closeCold = blockstore.NewBlockstore(ds), ds.Close
+		case "s3":
+			s3, err := coldstore.NewS3(coldstore.S3Config{
+				Endpoint:  cfg.S3.Endpoint,
+				Region:    cfg.S3.Region,
+				Bucket:    cfg.S3.Bucket,
+				Prefix:    cfg.S3.Prefix,
+				AccessKey: cfg.S3.AccessKey,
+				SecretKey: cfg.S3.SecretKey,
+			})
+			if err != nil {
+				return nil, err
+			}
+			cold, closeCold = s3, func() error { return nil }
+		default:
+			return nil, xerrors.Errorf("unknown cold store type %q", cfg.Type)
+		}
+
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				return closeCold()
+			},
+		})
+
+		return coldstore.NewSplit(hot, cold), nil
+	}
+}
+
+func SplitChainBlockstore(s *coldstore.Split) dtypes.ChainBlockstore {
+	return store.NewPruneGuard(blockstore.NewIdStore(s))
+}
+
+// RunColdMover periodically moves the chain data older than cfg.HotEpochs to
+// the cold store
+func RunColdMover(cfg config.ColdStore) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, cs *store.ChainStore, s *coldstore.Split) error {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, cs *store.ChainStore, s *coldstore.Split) error {
+		hotEpochs := abi.ChainEpoch(cfg.HotEpochs)
+		if hotEpochs < store.MinKeepStateRoots {
+			return xerrors.Errorf("the cold store must keep at least %d epochs hot, got %d", store.MinKeepStateRoots, hotEpochs)
+		}
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+
+		move := func() {
+			if shards, ok := s.Cold().(*coldstore.CarShards); ok {
+				// label the shard with the tipset objects are moved below
+				head := cs.GetHeaviestTipSet()
+				if ts, err := cs.GetTipsetByHeight(ctx, head.Height()-hotEpochs, head, true); err == nil {
+					if err := shards.StartShard(ts.Cids()); err != nil {
+						log.Errorf("starting cold store shard: %s", err)
+						return
+					}
+				}
+			}
+
+			if _, err := cs.MoveToCold(ctx, hotEpochs, s.Hot(), s.Cold()); err != nil {
+				log.Errorf("moving chain data to the cold store: %s", err)
+			}
+		}
+
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					tick := time.NewTicker(time.Duration(cfg.MoveInterval))
+					defer tick.Stop()
+
+					for {
+						select {
+						case <-tick.C:
+							move()
+						case <-ctx.Done():
+							return
+						}
+					}
+				}()
+				return nil
+			},
+		})
+
+		return nil
+	}
+}
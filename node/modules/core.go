@@ -7,11 +7,13 @@ import (
 	"io"
 	"io/ioutil"
 	"path/filepath"
+	"time"
 
 	"github.com/gbrlsnchs/jwt/v3"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p-core/peerstore"
 	record "github.com/libp2p/go-libp2p-record"
+	"go.uber.org/fx"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-jsonrpc/auth"
@@ -21,6 +23,8 @@ import (
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/journal"
 	"github.com/filecoin-project/lotus/lib/addrutil"
+	"github.com/filecoin-project/lotus/lib/msgaudit"
+	"github.com/filecoin-project/lotus/node/config"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/node/repo"
 )
@@ -97,5 +101,52 @@ func DrandBootstrap() (dtypes.DrandBootstrap, error) {
 }
 
 func SetupJournal(lr repo.LockedRepo) error {
-	return journal.InitializeSystemJournal(filepath.Join(lr.Path(), "journal"))
+	return journal.InitializeSystemJournal(filepath.Join(lr.Path(), "journal"), journal.DefaultRetention)
+}
+
+// MessageAuditKeyName is the name of the key the entries of the message audit
+// log are authenticated with, in the keystore
+const MessageAuditKeyName = "msgaudit-hmac-secret" //nolint:gosec
+
+func MessageAuditLog(lc fx.Lifecycle, lr repo.LockedRepo, keystore types.KeyStore) (*msgaudit.Log, error) {
+	key, err := keystore.Get(MessageAuditKeyName)
+	if errors.Is(err, types.ErrKeyInfoNotFound) {
+		log.Info("Generating new message audit key")
+
+		sk, err := ioutil.ReadAll(io.LimitReader(rand.Reader, 32))
+		if err != nil {
+			return nil, err
+		}
+		key = types.KeyInfo{
+			Type:       "msgaudit-hmac-secret",
+			PrivateKey: sk,
+		}
+		if err := keystore.Put(MessageAuditKeyName, key); err != nil {
+			return nil, xerrors.Errorf("writing message audit key: %w", err)
+		}
+	} else if err != nil {
+		return nil, xerrors.Errorf("getting message audit key: %w", err)
+	}
+
+	l, err := msgaudit.Open(filepath.Join(lr.Path(), "audit", msgaudit.FileName), key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			return l.Close()
+		},
+	})
+	return l, nil
+}
+
+func ConfigJournal(cfg config.Journal) func(lr repo.LockedRepo) error {
+	return func(lr repo.LockedRepo) error {
+		return journal.InitializeSystemJournal(filepath.Join(lr.Path(), "journal"), journal.Retention{
+			MaxFileSize: cfg.MaxFileSize,
+			MaxFiles:    cfg.MaxFiles,
+			MaxAge:      time.Duration(cfg.MaxAge),
+		})
+	}
 }
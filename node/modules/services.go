@@ -1,6 +1,11 @@
 package modules
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/namespace"
 	eventbus "github.com/libp2p/go-eventbus"
@@ -19,13 +24,19 @@ import (
 	"github.com/filecoin-project/lotus/chain/beacon/drand"
 	"github.com/filecoin-project/lotus/chain/blocksync"
 	"github.com/filecoin-project/lotus/chain/messagepool"
+	"github.com/filecoin-project/lotus/chain/snapshot"
 	"github.com/filecoin-project/lotus/chain/stmgr"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/sub"
+	"github.com/filecoin-project/lotus/lib/clockdrift"
 	"github.com/filecoin-project/lotus/lib/peermgr"
+	"github.com/filecoin-project/lotus/lib/sockbs"
+	"github.com/filecoin-project/lotus/node/config"
 	"github.com/filecoin-project/lotus/node/hello"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/node/modules/helpers"
+	"github.com/filecoin-project/lotus/node/repo"
+	"github.com/filecoin-project/specs-actors/actors/abi"
 )
 
 func RunHello(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host, svc *hello.Service) error {
@@ -54,8 +65,95 @@ func RunPeerMgr(mctx helpers.MetricsCtx, lc fx.Lifecycle, pmgr *peermgr.PeerMgr)
 	go pmgr.Run(helpers.LifecycleCtx(mctx, lc))
 }
 
+func ClockChecker(cfg config.ClockCheck) func() *clockdrift.Checker {
+	return func() *clockdrift.Checker {
+		return clockdrift.New(cfg.NTPServers, time.Duration(cfg.Interval), time.Duration(cfg.MaxDrift), cfg.RefuseToMine)
+	}
+}
+
+func RunClockCheck(mctx helpers.MetricsCtx, lc fx.Lifecycle, c *clockdrift.Checker, s *chain.Syncer) error {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+
+	blocks, err := s.IncomingBlocks(ctx)
+	if err != nil {
+		return xerrors.Errorf("subscribing to incoming blocks: %w", err)
+	}
+
+	go c.Run(ctx, blocks)
+	return nil
+}
+
+func RunAvailabilityChecker(mctx helpers.MetricsCtx, lc fx.Lifecycle, bs *blocksync.BlockSync, cs *store.ChainStore) {
+	go bs.RunAvailabilityChecker(helpers.LifecycleCtx(mctx, lc), cs)
+}
+
 func RunBlockSync(h host.Host, svc *blocksync.BlockSyncService) {
 	h.SetStreamHandler(blocksync.BlockSyncProtocolID, svc.HandleStream)
+	h.SetStreamHandler(blocksync.BlockSyncProtocolIDv2, svc.HandleStreamV2)
+}
+
+func SnapshotClient(h host.Host, lr repo.LockedRepo) *snapshot.Client {
+	return snapshot.NewClient(h, filepath.Join(lr.Path(), "snapshots", "fetched"))
+}
+
+func RunSnapshotServer(cfg config.SnapshotServer) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host, cs *store.ChainStore, lr repo.LockedRepo) error {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host, cs *store.ChainStore, lr repo.LockedRepo) error {
+		var trusted []peer.ID
+		for _, s := range cfg.TrustedPeers {
+			p, err := peer.Decode(s)
+			if err != nil {
+				return xerrors.Errorf("parsing trusted snapshot peer %q: %w", s, err)
+			}
+			trusted = append(trusted, p)
+		}
+
+		srv, err := snapshot.NewServer(helpers.LifecycleCtx(mctx, lc), cs, filepath.Join(lr.Path(), "snapshots", "served"),
+			trusted, abi.ChainEpoch(cfg.RecentStateRoots), time.Duration(cfg.MaxAge))
+		if err != nil {
+			return err
+		}
+
+		h.SetStreamHandler(snapshot.ProtocolID, srv.HandleStream)
+		return nil
+	}
+}
+
+func RunSharedBlockstore(cfg config.SharedBlockstore) func(lc fx.Lifecycle, lr repo.LockedRepo, bs dtypes.ChainBlockstore, cs *store.ChainStore) error {
+	return func(lc fx.Lifecycle, lr repo.LockedRepo, bs dtypes.ChainBlockstore, cs *store.ChainStore) error {
+		path := cfg.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(lr.Path(), path)
+		}
+
+		// the socket of a previous run, the repo is locked
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("removing old shared blockstore socket: %w", err)
+		}
+
+		srv := sockbs.NewServer(bs)
+		cs.SubscribePruned(srv.Removed)
+
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				l, err := sockbs.Listen(path)
+				if err != nil {
+					return xerrors.Errorf("listening on shared blockstore socket: %w", err)
+				}
+
+				log.Infow("serving the chain blockstore", "socket", path)
+				go func() {
+					if err := srv.Serve(l); err != nil {
+						log.Errorf("serving shared blockstore: %s", err)
+					}
+				}()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				return srv.Close()
+			},
+		})
+		return nil
+	}
 }
 
 func HandleIncomingBlocks(mctx helpers.MetricsCtx, lc fx.Lifecycle, ps *pubsub.PubSub, s *chain.Syncer, chain *store.ChainStore, stmgr *stmgr.StateManager, h host.Host, nn dtypes.NetworkName) {
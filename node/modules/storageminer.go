@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/ipfs/go-bitswap"
 	"github.com/ipfs/go-bitswap/network"
@@ -50,6 +51,9 @@ import (
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/gen"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/alerting"
+	"github.com/filecoin-project/lotus/lib/clockdrift"
+	"github.com/filecoin-project/lotus/markets/dealmetrics"
 	"github.com/filecoin-project/lotus/markets/retrievaladapter"
 	"github.com/filecoin-project/lotus/miner"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
@@ -134,7 +138,7 @@ func SectorIDCounter(ds dtypes.MetadataDS) sealing.SectorIDCounter {
 	return &sidsc{sc}
 }
 
-func StorageMiner(mctx helpers.MetricsCtx, lc fx.Lifecycle, api lapi.FullNode, h host.Host, ds dtypes.MetadataDS, sealer sectorstorage.SectorManager, sc sealing.SectorIDCounter, verif ffiwrapper.Verifier) (*storage.Miner, error) {
+func StorageMiner(mctx helpers.MetricsCtx, lc fx.Lifecycle, api lapi.FullNode, h host.Host, ds dtypes.MetadataDS, sealer sectorstorage.SectorManager, sc sealing.SectorIDCounter, verif ffiwrapper.Verifier, al *alerting.Alerting, rcfg storage.ResubmitConfig, maint *storage.Maintenance) (*storage.Miner, error) {
 	maddr, err := minerAddrFromDS(ds)
 	if err != nil {
 		return nil, err
@@ -152,12 +156,12 @@ func StorageMiner(mctx helpers.MetricsCtx, lc fx.Lifecycle, api lapi.FullNode, h
 		return nil, err
 	}
 
-	fps, err := storage.NewWindowedPoStScheduler(api, sealer, sealer, maddr, worker)
+	fps, err := storage.NewWindowedPoStScheduler(api, sealer, sealer, maddr, worker, al, rcfg)
 	if err != nil {
 		return nil, err
 	}
 
-	sm, err := storage.NewMiner(api, maddr, worker, h, ds, sealer, sc, verif)
+	sm, err := storage.NewMiner(api, maddr, worker, h, ds, sealer, sc, verif, maint)
 	if err != nil {
 		return nil, err
 	}
@@ -173,6 +177,121 @@ func StorageMiner(mctx helpers.MetricsCtx, lc fx.Lifecycle, api lapi.FullNode, h
 	return sm, nil
 }
 
+func ResubmitConfig(cfg config.MessageResubmit) func() (storage.ResubmitConfig, error) {
+	return func() (storage.ResubmitConfig, error) {
+		rcfg := storage.ResubmitConfig{
+			After:         abi.ChainEpoch(cfg.AfterEpochs),
+			FeeMultiplier: cfg.FeeMultiplier,
+		}
+		if cfg.MaxGasPrice != "" {
+			max, err := types.BigFromString(cfg.MaxGasPrice)
+			if err != nil {
+				return storage.ResubmitConfig{}, xerrors.Errorf("parsing resubmit max gas price: %w", err)
+			}
+			rcfg.MaxGasPrice = max
+		}
+
+		if err := rcfg.Validate(); err != nil {
+			return storage.ResubmitConfig{}, err
+		}
+
+		return rcfg, nil
+	}
+}
+
+func SealingWatchdog(cfg config.SealingWatchdog) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, m *storage.Miner, al *alerting.Alerting) (*storage.Watchdog, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, m *storage.Miner, al *alerting.Alerting) (*storage.Watchdog, error) {
+		switch cfg.Action {
+		case storage.WatchdogReport, storage.WatchdogRetry, storage.WatchdogAbort:
+		default:
+			return nil, xerrors.Errorf("unknown sealing watchdog action %q", cfg.Action)
+		}
+
+		wcfg := storage.WatchdogConfig{
+			CheckInterval:    time.Duration(cfg.CheckInterval),
+			Multiplier:       cfg.Multiplier,
+			PhaseMultipliers: map[sealing.SectorState]float64{},
+			Action:           cfg.Action,
+			MaxRetries:       cfg.MaxRetries,
+		}
+		for st, mul := range cfg.PhaseMultipliers {
+			wcfg.PhaseMultipliers[sealing.SectorState(st)] = mul
+		}
+
+		w := storage.NewWatchdog(m, al, wcfg)
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go w.Run(ctx)
+				return nil
+			},
+		})
+
+		return w, nil
+	}
+}
+
+func CommitDeadlines(cfg config.CommitDeadlines) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, m *storage.Miner, al *alerting.Alerting) (*storage.CommitDeadlines, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, m *storage.Miner, al *alerting.Alerting) (*storage.CommitDeadlines, error) {
+		switch cfg.Action {
+		case storage.CommitDeadlinesReport, storage.CommitDeadlinesReprecommit:
+		default:
+			return nil, xerrors.Errorf("unknown commit deadlines action %q", cfg.Action)
+		}
+
+		cd := storage.NewCommitDeadlines(m, al, storage.CommitDeadlinesConfig{
+			CheckInterval: time.Duration(cfg.CheckInterval),
+			WarnEpochs:    abi.ChainEpoch(cfg.WarnEpochs),
+			Action:        cfg.Action,
+		})
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go cd.Run(ctx)
+				return nil
+			},
+		})
+
+		return cd, nil
+	}
+}
+
+func PledgePolicy(cfg config.PledgePolicy) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, m *storage.Miner, maint *storage.Maintenance) (*storage.PledgePolicy, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, m *storage.Miner, maint *storage.Maintenance) (*storage.PledgePolicy, error) {
+		if cfg.MaxSealingSectors <= 0 {
+			return nil, xerrors.Errorf("pledge policy needs MaxSealingSectors to be set")
+		}
+		if cfg.DealFillRatio < 0 || cfg.DealFillRatio > 1 {
+			return nil, xerrors.Errorf("pledge policy DealFillRatio must be between 0 and 1, got %f", cfg.DealFillRatio)
+		}
+		if cfg.PledgeBudget > 0 && cfg.BudgetPeriod <= 0 {
+			return nil, xerrors.Errorf("pledge policy needs a BudgetPeriod with a PledgeBudget")
+		}
+
+		p := storage.NewPledgePolicy(m, maint, storage.PledgePolicyConfig{
+			CheckInterval:     time.Duration(cfg.CheckInterval),
+			MaxSealingSectors: cfg.MaxSealingSectors,
+			DealFillRatio:     cfg.DealFillRatio,
+			PledgeBudget:      cfg.PledgeBudget,
+			BudgetPeriod:      time.Duration(cfg.BudgetPeriod),
+			MaxProvingSectors: cfg.MaxProvingSectors,
+			FailedGracePeriod: time.Duration(cfg.FailedGracePeriod),
+		})
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go p.Run(ctx)
+				return nil
+			},
+		})
+
+		return p, nil
+	}
+}
+
 func HandleRetrieval(host host.Host, lc fx.Lifecycle, m retrievalmarket.RetrievalProvider) {
 	lc.Append(fx.Hook{
 		OnStart: func(context.Context) error {
@@ -197,6 +316,45 @@ func HandleDeals(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, h sto
 	})
 }
 
+func Maintenance(ds dtypes.MetadataDS) (*storage.Maintenance, error) {
+	return storage.NewMaintenance(ds)
+}
+
+func SealingEstimator(mctx helpers.MetricsCtx, lc fx.Lifecycle, m *storage.Miner, ds dtypes.MetadataDS) (*storage.SealingEstimator, error) {
+	e, err := storage.NewSealingEstimator(m, ds)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go e.Run(ctx)
+			return nil
+		},
+	})
+
+	return e, nil
+}
+
+// RunMarketMetrics records metrics of the storage and retrieval markets
+func RunMarketMetrics(mctx helpers.MetricsCtx, lc fx.Lifecycle, sp storagemarket.StorageProvider, rp retrievalmarket.RetrievalProvider) error {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+
+	r, err := dealmetrics.New(sp, rp)
+	if err != nil {
+		return err
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go r.Run(ctx)
+			return nil
+		},
+	})
+	return nil
+}
+
 // RegisterProviderValidator is an initialization hook that registers the provider
 // request validator with the data transfer module as the validator for
 // StorageDataTransferVoucher types
@@ -268,13 +426,14 @@ func StagingGraphsync(mctx helpers.MetricsCtx, lc fx.Lifecycle, ibs dtypes.Stagi
 	return gs
 }
 
-func SetupBlockProducer(lc fx.Lifecycle, ds dtypes.MetadataDS, api lapi.FullNode, epp gen.WinningPoStProver) (*miner.Miner, error) {
+func SetupBlockProducer(lc fx.Lifecycle, ds dtypes.MetadataDS, api lapi.FullNode, epp gen.WinningPoStProver, cc *clockdrift.Checker) (*miner.Miner, error) {
 	minerAddr, err := minerAddrFromDS(ds)
 	if err != nil {
 		return nil, err
 	}
 
 	m := miner.NewMiner(api, epp, minerAddr)
+	m.SetMiningCheck(cc.CheckMining)
 
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
@@ -291,6 +450,18 @@ func SetupBlockProducer(lc fx.Lifecycle, ds dtypes.MetadataDS, api lapi.FullNode
 	return m, nil
 }
 
+func RunMinerClockCheck(mctx helpers.MetricsCtx, lc fx.Lifecycle, c *clockdrift.Checker, api lapi.FullNode) error {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+
+	blocks, err := api.SyncIncomingBlocks(ctx)
+	if err != nil {
+		return xerrors.Errorf("subscribing to incoming blocks: %w", err)
+	}
+
+	go c.Run(ctx, blocks)
+	return nil
+}
+
 func NewProviderRequestValidator(deals dtypes.ProviderDealStore) dtypes.ProviderRequestValidator {
 	return requestvalidation.NewUnifiedRequestValidator(deals, nil)
 }
@@ -315,7 +486,7 @@ func NewStorageAsk(ctx helpers.MetricsCtx, fapi lapi.FullNode, ds dtypes.Metadat
 	return storedAsk, nil
 }
 
-func StorageProvider(minerAddress dtypes.MinerAddress, ffiConfig *ffiwrapper.Config, storedAsk *storedask.StoredAsk, h host.Host, ds dtypes.MetadataDS, ibs dtypes.StagingBlockstore, r repo.LockedRepo, pieceStore dtypes.ProviderPieceStore, dataTransfer dtypes.ProviderDataTransfer, spn storagemarket.StorageProviderNode, onlineOk dtypes.ConsiderOnlineStorageDealsConfigFunc, offlineOk dtypes.ConsiderOfflineStorageDealsConfigFunc, blocklistFunc dtypes.StorageDealPieceCidBlocklistConfigFunc) (storagemarket.StorageProvider, error) {
+func StorageProvider(minerAddress dtypes.MinerAddress, ffiConfig *ffiwrapper.Config, storedAsk *storedask.StoredAsk, h host.Host, ds dtypes.MetadataDS, ibs dtypes.StagingBlockstore, r repo.LockedRepo, pieceStore dtypes.ProviderPieceStore, dataTransfer dtypes.ProviderDataTransfer, spn storagemarket.StorageProviderNode, onlineOk dtypes.ConsiderOnlineStorageDealsConfigFunc, offlineOk dtypes.ConsiderOfflineStorageDealsConfigFunc, blocklistFunc dtypes.StorageDealPieceCidBlocklistConfigFunc, maint *storage.Maintenance) (storagemarket.StorageProvider, error) {
 	net := smnet.NewFromLibp2pHost(h)
 	store, err := piecefilestore.NewLocalFileStore(piecefilestore.OsPath(r.Path()))
 	if err != nil {
@@ -323,6 +494,11 @@ func StorageProvider(minerAddress dtypes.MinerAddress, ffiConfig *ffiwrapper.Con
 	}
 
 	opt := storageimpl.CustomDealDecisionLogic(func(ctx context.Context, deal storagemarket.MinerDeal) (bool, string, error) {
+		if maint.Active() {
+			log.Warnf("miner is in maintenance mode; rejecting storage deal proposal from client: %s", deal.Client.String())
+			return false, "miner is in maintenance", nil
+		}
+
 		b, err := onlineOk()
 		if err != nil {
 			return false, "miner error", err
@@ -18,11 +18,11 @@ import (
 	"github.com/mitchellh/go-homedir"
 	"golang.org/x/xerrors"
 
-	"github.com/filecoin-project/specs-actors/actors/runtime"
-
+	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/gen"
 	genesis2 "github.com/filecoin-project/lotus/chain/gen/genesis"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/vm"
 	"github.com/filecoin-project/lotus/genesis"
 	"github.com/filecoin-project/lotus/node/modules"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
@@ -30,19 +30,20 @@ import (
 
 var glog = logging.Logger("genesis")
 
-func MakeGenesisMem(out io.Writer, template genesis.Template) func(bs dtypes.ChainBlockstore, syscalls runtime.Syscalls) modules.Genesis {
-	return func(bs dtypes.ChainBlockstore, syscalls runtime.Syscalls) modules.Genesis {
+func MakeGenesisMem(out io.Writer, template genesis.Template) func(bs dtypes.ChainBlockstore, syscalls vm.Syscalls) modules.Genesis {
+	return func(bs dtypes.ChainBlockstore, syscalls vm.Syscalls) modules.Genesis {
 		return func() (*types.BlockHeader, error) {
 			glog.Warn("Generating new random genesis block, note that this SHOULD NOT happen unless you are setting up new network")
+			if err := applyNetworkParams(template); err != nil {
+				return nil, err
+			}
+
 			b, err := genesis2.MakeGenesisBlock(context.TODO(), bs, syscalls, template)
 			if err != nil {
 				return nil, xerrors.Errorf("make genesis block failed: %w", err)
 			}
-			offl := offline.Exchange(bs)
-			blkserv := blockservice.New(bs, offl)
-			dserv := merkledag.NewDAGService(blkserv)
 
-			if err := car.WriteCarWithWalker(context.TODO(), dserv, []cid.Cid{b.Genesis.Cid()}, out, gen.CarWalkFunc); err != nil {
+			if err := writeGenesisCar(bs, b.Genesis, template, out); err != nil {
 				return nil, xerrors.Errorf("failed to write car file: %w", err)
 			}
 
@@ -51,8 +52,8 @@ func MakeGenesisMem(out io.Writer, template genesis.Template) func(bs dtypes.Cha
 	}
 }
 
-func MakeGenesis(outFile, genesisTemplate string) func(bs dtypes.ChainBlockstore, syscalls runtime.Syscalls) modules.Genesis {
-	return func(bs dtypes.ChainBlockstore, syscalls runtime.Syscalls) modules.Genesis {
+func MakeGenesis(outFile, genesisTemplate string) func(bs dtypes.ChainBlockstore, syscalls vm.Syscalls) modules.Genesis {
+	return func(bs dtypes.ChainBlockstore, syscalls vm.Syscalls) modules.Genesis {
 		return func() (*types.BlockHeader, error) {
 			glog.Warn("Generating new random genesis block, note that this SHOULD NOT happen unless you are setting up new network")
 			genesisTemplate, err := homedir.Expand(genesisTemplate)
@@ -74,6 +75,10 @@ func MakeGenesis(outFile, genesisTemplate string) func(bs dtypes.ChainBlockstore
 				template.Timestamp = uint64(time.Now().Unix())
 			}
 
+			if err := applyNetworkParams(template); err != nil {
+				return nil, err
+			}
+
 			b, err := genesis2.MakeGenesisBlock(context.TODO(), bs, syscalls, template)
 			if err != nil {
 				return nil, xerrors.Errorf("make genesis block: %w", err)
@@ -86,11 +91,7 @@ func MakeGenesis(outFile, genesisTemplate string) func(bs dtypes.ChainBlockstore
 				return nil, err
 			}
 
-			offl := offline.Exchange(bs)
-			blkserv := blockservice.New(bs, offl)
-			dserv := merkledag.NewDAGService(blkserv)
-
-			if err := car.WriteCarWithWalker(context.TODO(), dserv, []cid.Cid{b.Genesis.Cid()}, f, gen.CarWalkFunc); err != nil {
+			if err := writeGenesisCar(bs, b.Genesis, template, f); err != nil {
 				return nil, err
 			}
 
@@ -104,3 +105,37 @@ func MakeGenesis(outFile, genesisTemplate string) func(bs dtypes.ChainBlockstore
 		}
 	}
 }
+
+func applyNetworkParams(template genesis.Template) error {
+	if template.NetworkParams == nil {
+		return nil
+	}
+	if err := build.ApplyNetworkParams(*template.NetworkParams); err != nil {
+		return xerrors.Errorf("applying network params: %w", err)
+	}
+	return nil
+}
+
+// writeGenesisCar writes the genesis car file. The network params of the
+// template are stored in a second root, so that nodes joining the network can
+// apply them with modules.GenesisNetworkParams.
+func writeGenesisCar(bs dtypes.ChainBlockstore, gblk *types.BlockHeader, template genesis.Template, out io.Writer) error {
+	roots := []cid.Cid{gblk.Cid()}
+	if template.NetworkParams != nil {
+		pb, err := json.Marshal(template.NetworkParams)
+		if err != nil {
+			return xerrors.Errorf("encoding network params: %w", err)
+		}
+		blk := merkledag.NewRawNode(pb)
+		if err := bs.Put(blk); err != nil {
+			return xerrors.Errorf("storing network params: %w", err)
+		}
+		roots = append(roots, blk.Cid())
+	}
+
+	offl := offline.Exchange(bs)
+	blkserv := blockservice.New(bs, offl)
+	dserv := merkledag.NewDAGService(blkserv)
+
+	return car.WriteCarWithWalker(context.TODO(), dserv, roots, out, gen.CarWalkFunc)
+}
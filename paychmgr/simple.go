@@ -41,7 +41,7 @@ func (pm *Manager) createPaych(ctx context.Context, from, to address.Address, am
 		GasPrice: types.NewInt(0),
 	}
 
-	smsg, err := pm.mpool.MpoolPushMessage(ctx, msg)
+	smsg, err := pm.mpool.MpoolPushMessage(ctx, msg, nil)
 	if err != nil {
 		return cid.Undef, xerrors.Errorf("initializing paych actor: %w", err)
 	}
@@ -96,7 +96,7 @@ func (pm *Manager) addFunds(ctx context.Context, ch address.Address, from addres
 		GasPrice: types.NewInt(0),
 	}
 
-	smsg, err := pm.mpool.MpoolPushMessage(ctx, msg)
+	smsg, err := pm.mpool.MpoolPushMessage(ctx, msg, nil)
 	if err != nil {
 		return cid.Undef, err
 	}
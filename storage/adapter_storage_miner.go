@@ -209,7 +209,7 @@ func (s SealingAPIAdapter) SendMsg(ctx context.Context, from, to address.Address
 		Params:   params,
 	}
 
-	smsg, err := s.delegate.MpoolPushMessage(ctx, &msg)
+	smsg, err := checkAndPush(ctx, s.delegate, &msg)
 	if err != nil {
 		return cid.Undef, err
 	}
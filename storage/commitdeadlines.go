@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/journal"
+	"github.com/filecoin-project/lotus/lib/alerting"
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+const (
+	CommitDeadlinesReport      = "report"
+	CommitDeadlinesReprecommit = "reprecommit"
+)
+
+// commitmentStates are the states in which a sector has a ticket, but isn't
+// proven on chain yet
+var commitmentStates = map[sealing.SectorState]struct{}{
+	sealing.PreCommit2:           {},
+	sealing.PreCommitting:        {},
+	sealing.PreCommitWait:        {},
+	sealing.WaitSeed:             {},
+	sealing.Committing:           {},
+	sealing.CommitWait:           {},
+	sealing.SealPreCommit2Failed: {},
+	sealing.PreCommitFailed:      {},
+	sealing.ComputeProofFailed:   {},
+	sealing.CommitFailed:         {},
+}
+
+type CommitDeadlinesConfig struct {
+	CheckInterval time.Duration
+
+	// WarnEpochs is how close to a deadline a sector is reported at risk
+	WarnEpochs abi.ChainEpoch
+
+	// Action is one of CommitDeadlinesReport or CommitDeadlinesReprecommit
+	Action string
+}
+
+// CommitDeadlines tracks the tickets of sectors which aren't proven yet, and
+// the epochs by which their commitment messages have to land: the precommit
+// before its ticket is too old to be accepted, and the ProveCommit before the
+// precommit expires, which loses its deposit.
+//
+// Sectors close to a deadline are reported through the API, alerts and the
+// journal. With the reprecommit action, sectors whose ticket expired before
+// the precommit landed are sealed again with a new ticket, and sectors which
+// missed the ProveCommit deadline are moved to FailedUnrecoverable, as they
+// can't be proven anymore.
+type CommitDeadlines struct {
+	miner *Miner
+	al    *alerting.Alerting
+	cfg   CommitDeadlinesConfig
+
+	lk      sync.Mutex
+	sectors map[abi.SectorNumber]*api.SectorCommitDeadline
+}
+
+func NewCommitDeadlines(m *Miner, al *alerting.Alerting, cfg CommitDeadlinesConfig) *CommitDeadlines {
+	return &CommitDeadlines{
+		miner: m,
+		al:    al,
+		cfg:   cfg,
+
+		sectors: map[abi.SectorNumber]*api.SectorCommitDeadline{},
+	}
+}
+
+func (cd *CommitDeadlines) Run(ctx context.Context) {
+	tick := time.NewTicker(cd.cfg.CheckInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			if err := cd.check(ctx); err != nil {
+				log.Errorf("commit deadlines: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sectors returns the sectors tracked by the last check.
+func (cd *CommitDeadlines) Sectors() []api.SectorCommitDeadline {
+	cd.lk.Lock()
+	defer cd.lk.Unlock()
+
+	out := make([]api.SectorCommitDeadline, 0, len(cd.sectors))
+	for _, s := range cd.sectors {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].SectorID < out[j].SectorID
+	})
+
+	return out
+}
+
+func (cd *CommitDeadlines) check(ctx context.Context) error {
+	head, err := cd.miner.api.ChainHead(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting chain head: %w", err)
+	}
+
+	mi, err := cd.miner.api.StateMinerInfo(ctx, cd.miner.maddr, head.Key())
+	if err != nil {
+		return xerrors.Errorf("getting miner info: %w", err)
+	}
+
+	maxSeal, ok := miner.MaxSealDuration[mi.SealProofType]
+	if !ok {
+		return xerrors.Errorf("no max seal duration for proof type %d", mi.SealProofType)
+	}
+
+	sectors, err := cd.miner.ListSectors()
+	if err != nil {
+		return xerrors.Errorf("listing sectors: %w", err)
+	}
+
+	cd.lk.Lock()
+	defer cd.lk.Unlock()
+
+	tracked := map[abi.SectorNumber]*api.SectorCommitDeadline{}
+	var atRisk int
+	for _, si := range sectors {
+		if _, ok := commitmentStates[si.State]; !ok || si.TicketEpoch == 0 {
+			continue
+		}
+
+		prev, seen := cd.sectors[si.SectorNumber]
+
+		s, err := cd.deadlines(ctx, si, head, maxSeal, prev)
+		if err != nil {
+			// nothing is done on errors, the sector keeps its last known
+			// deadlines until the next check
+			log.Errorf("commit deadlines: sector %d: %s", si.SectorNumber, err)
+			if seen {
+				tracked[si.SectorNumber] = prev
+			}
+			continue
+		}
+		if s == nil {
+			continue // proven
+		}
+
+		if seen {
+			s.Action = prev.Action
+		}
+		if (s.AtRisk || s.Expired) && (!seen || prev.AtRisk != s.AtRisk || prev.Expired != s.Expired) {
+			log.Warnw("sector risks missing its commit deadline", "sector", s.SectorID, "state", s.State, "deadline", s.Deadline(), "height", head.Height(), "expired", s.Expired)
+			journal.Record(journal.SysMiner, journal.EvtMinerCommitDeadline, s)
+		}
+
+		if s.Expired {
+			if err := cd.act(ctx, si, s); err != nil {
+				log.Errorf("commit deadlines: sector %d: %s", si.SectorNumber, err)
+			}
+		}
+		if s.AtRisk || s.Expired {
+			atRisk++
+		}
+
+		tracked[si.SectorNumber] = s
+	}
+	cd.sectors = tracked
+
+	if cd.al != nil {
+		cd.al.Set("commit-deadlines", atRisk > 0, "%d sectors risk missing their commit deadlines", atRisk)
+	}
+
+	return nil
+}
+
+// deadlines computes the commitment deadlines of the sector, it returns nil
+// when the sector is already proven on chain. prev are the deadlines of the
+// last check, if the sector was tracked.
+func (cd *CommitDeadlines) deadlines(ctx context.Context, si sealing.SectorInfo, head *types.TipSet, maxSeal abi.ChainEpoch, prev *api.SectorCommitDeadline) (*api.SectorCommitDeadline, error) {
+	onChain, err := cd.miner.api.StateSectorGetInfo(ctx, cd.miner.maddr, si.SectorNumber, head.Key())
+	if err != nil {
+		return nil, xerrors.Errorf("getting sector info: %w", err)
+	}
+	if onChain != nil {
+		return nil, nil
+	}
+
+	// the adapter returns nil when the precommit isn't on chain, which the
+	// full node API only reports as an error
+	pci, err := NewSealingAPIAdapter(cd.miner.api).StateSectorPreCommitInfo(ctx, cd.miner.maddr, si.SectorNumber, head.Key().Bytes())
+	if err != nil {
+		return nil, xerrors.Errorf("getting precommit info: %w", err)
+	}
+
+	return commitDeadline(si, head.Height(), maxSeal, cd.cfg.WarnEpochs, pci, prev), nil
+}
+
+// commitDeadline computes the commitment deadlines of a sector at height.
+// pci is the precommit of the sector, nil if it isn't on chain.
+//
+// The precommit must land at most Finality+maxSeal epochs after the ticket,
+// and the ProveCommit at most maxSeal epochs after the precommit. Expired
+// precommits are removed from the chain, a precommit seen by the last check
+// which disappeared is kept, so that its deadline stays the ProveCommit one.
+func commitDeadline(si sealing.SectorInfo, height, maxSeal, warn abi.ChainEpoch, pci *miner.SectorPreCommitOnChainInfo, prev *api.SectorCommitDeadline) *api.SectorCommitDeadline {
+	s := &api.SectorCommitDeadline{
+		SectorID:          si.SectorNumber,
+		State:             api.SectorState(si.State),
+		TicketEpoch:       si.TicketEpoch,
+		PreCommitDeadline: si.TicketEpoch + build.Finality + maxSeal,
+		Height:            height,
+		Deposit:           types.NewInt(0),
+	}
+
+	switch {
+	case pci != nil:
+		s.PreCommitEpoch = pci.PreCommitEpoch
+		s.ProveCommitDeadline = pci.PreCommitEpoch + maxSeal
+		s.Deposit = pci.PreCommitDeposit
+	case prev != nil && prev.PreCommitEpoch != 0 && prev.TicketEpoch == si.TicketEpoch:
+		s.PreCommitEpoch = prev.PreCommitEpoch
+		s.ProveCommitDeadline = prev.ProveCommitDeadline
+		s.Deposit = prev.Deposit
+	}
+
+	deadline := s.Deadline()
+	s.Expired = height > deadline
+	s.AtRisk = !s.Expired && deadline-height <= warn
+
+	return s
+}
+
+func (cd *CommitDeadlines) act(ctx context.Context, si sealing.SectorInfo, s *api.SectorCommitDeadline) error {
+	if cd.cfg.Action != CommitDeadlinesReprecommit {
+		return nil
+	}
+
+	if s.PreCommitEpoch == 0 {
+		// sealing again from PreCommit1 gets a new ticket
+		if err := cd.miner.ForceSectorState(ctx, si.SectorNumber, sealing.PreCommit1); err != nil {
+			return xerrors.Errorf("re-precommitting: %w", err)
+		}
+		s.Action = CommitDeadlinesReprecommit
+		log.Warnw("ticket expired before the precommit landed, sealing with a new ticket", "sector", si.SectorNumber, "ticket", si.TicketEpoch)
+		return nil
+	}
+
+	if err := cd.miner.ForceSectorState(ctx, si.SectorNumber, sealing.FailedUnrecoverable); err != nil {
+		return xerrors.Errorf("aborting: %w", err)
+	}
+	s.Action = "abort"
+	log.Warnw("aborted sector which missed its ProveCommit deadline", "sector", si.SectorNumber, "precommit", s.PreCommitEpoch, "deposit", types.FIL(s.Deposit))
+	return nil
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	sealing "github.com/filecoin-project/storage-fsm"
+
+	"github.com/filecoin-project/lotus/build"
+)
+
+func TestCommitDeadline(t *testing.T) {
+	const (
+		ticket  = abi.ChainEpoch(1000)
+		maxSeal = abi.ChainEpoch(100)
+		warn    = abi.ChainEpoch(10)
+	)
+	si := sealing.SectorInfo{SectorNumber: 1, State: sealing.PreCommitWait, TicketEpoch: ticket}
+	pcDeadline := ticket + build.Finality + maxSeal
+
+	for _, tc := range []struct {
+		name     string
+		height   abi.ChainEpoch
+		pci      *miner.SectorPreCommitOnChainInfo
+		deadline abi.ChainEpoch
+		atRisk   bool
+		expired  bool
+	}{
+		{name: "precommit pending", height: ticket + 10, deadline: pcDeadline},
+		{name: "precommit at risk", height: pcDeadline - warn, deadline: pcDeadline, atRisk: true},
+		{name: "precommit last epoch", height: pcDeadline, deadline: pcDeadline, atRisk: true},
+		{name: "ticket expired", height: pcDeadline + 1, deadline: pcDeadline, expired: true},
+		{
+			name:     "provecommit pending",
+			height:   pcDeadline + 1,
+			pci:      &miner.SectorPreCommitOnChainInfo{PreCommitEpoch: pcDeadline - 5, PreCommitDeposit: abi.NewTokenAmount(7)},
+			deadline: pcDeadline - 5 + maxSeal,
+		},
+		{
+			name:     "provecommit expired",
+			height:   pcDeadline - 5 + maxSeal + 1,
+			pci:      &miner.SectorPreCommitOnChainInfo{PreCommitEpoch: pcDeadline - 5, PreCommitDeposit: abi.NewTokenAmount(7)},
+			deadline: pcDeadline - 5 + maxSeal,
+			expired:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := commitDeadline(si, tc.height, maxSeal, warn, tc.pci, nil)
+			if s.Deadline() != tc.deadline {
+				t.Fatalf("expected the deadline to be %d, got %d", tc.deadline, s.Deadline())
+			}
+			if s.AtRisk != tc.atRisk || s.Expired != tc.expired {
+				t.Fatalf("expected at risk %t, expired %t, got %t, %t", tc.atRisk, tc.expired, s.AtRisk, s.Expired)
+			}
+			if tc.pci != nil && !s.Deposit.Equals(tc.pci.PreCommitDeposit) {
+				t.Fatalf("expected the deposit to be %s, got %s", tc.pci.PreCommitDeposit, s.Deposit)
+			}
+		})
+	}
+}
+
+func TestCommitDeadlineRemovedPrecommit(t *testing.T) {
+	const maxSeal = abi.ChainEpoch(100)
+	si := sealing.SectorInfo{SectorNumber: 1, State: sealing.WaitSeed, TicketEpoch: 1000}
+	pci := &miner.SectorPreCommitOnChainInfo{PreCommitEpoch: 1100, PreCommitDeposit: abi.NewTokenAmount(7)}
+
+	prev := commitDeadline(si, 1150, maxSeal, 10, pci, nil)
+	if prev.Expired {
+		t.Fatal("expected the ProveCommit deadline not to be missed yet")
+	}
+
+	// the precommit expired, and was removed from the chain
+	s := commitDeadline(si, 1300, maxSeal, 10, nil, prev)
+	if s.PreCommitEpoch != 1100 || s.Deadline() != 1200 || !s.Expired {
+		t.Fatalf("expected the missed ProveCommit deadline to be kept, got precommit epoch %d, deadline %d", s.PreCommitEpoch, s.Deadline())
+	}
+
+	// a new ticket starts over
+	si.TicketEpoch = 1250
+	s = commitDeadline(si, 1300, maxSeal, 10, nil, prev)
+	if s.PreCommitEpoch != 0 || s.Expired {
+		t.Fatal("expected the sector to wait for a new precommit")
+	}
+}
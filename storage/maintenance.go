@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/sector-storage/storiface"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+var ErrMaintenance = xerrors.New("miner is in maintenance mode")
+
+var maintenanceKey = datastore.NewKey("/maintenance")
+
+// pipelineStates are the states of sectors being sealed, which run a task on
+// a worker, or will run one once the chain or a retry timer moves them on.
+// Empty sectors wait for deals, which are rejected during maintenance.
+var pipelineStates = map[sealing.SectorState]bool{
+	sealing.Packing:        true,
+	sealing.PreCommit1:     true,
+	sealing.PreCommit2:     true,
+	sealing.PreCommitting:  true,
+	sealing.PreCommitWait:  true,
+	sealing.WaitSeed:       true,
+	sealing.Committing:     true,
+	sealing.CommitWait:     true,
+	sealing.FinalizeSector: true,
+
+	sealing.PackingFailed:        true,
+	sealing.SealPreCommit1Failed: true,
+	sealing.SealPreCommit2Failed: true,
+	sealing.PreCommitFailed:      true,
+	sealing.ComputeProofFailed:   true,
+	sealing.CommitFailed:         true,
+	sealing.FinalizeFailed:       true,
+}
+
+type maintenanceState struct {
+	Since  time.Time
+	Reason string
+}
+
+// Maintenance prepares the miner for planned downtime. While maintenance mode
+// is enabled no new sectors are pledged, storage deals are rejected, and the
+// sealing tasks of sectors entering a worker phase are held at the miner until
+// it's disabled. Tasks already running are left to complete, or are aborted
+// by a checkpoint, in which case their sectors are held at the start of the
+// phase. The miner is drained once every sector being sealed is held, and the
+// scheduler has no tasks running on workers anymore.
+//
+// The mode is persisted, so that a restart during the maintenance doesn't
+// start sealing again.
+type Maintenance struct {
+	ds datastore.Datastore
+
+	lk    sync.Mutex
+	state *maintenanceState
+	// resume is closed when maintenance mode is disabled, it's nil while
+	// it's disabled
+	resume chan struct{}
+}
+
+func NewMaintenance(ds datastore.Datastore) (*Maintenance, error) {
+	m := &Maintenance{ds: ds}
+
+	b, err := ds.Get(maintenanceKey)
+	switch {
+	case err == datastore.ErrNotFound:
+	case err != nil:
+		return nil, xerrors.Errorf("getting maintenance state: %w", err)
+	default:
+		var st maintenanceState
+		if err := json.Unmarshal(b, &st); err != nil {
+			return nil, xerrors.Errorf("unmarshaling maintenance state: %w", err)
+		}
+		log.Warnw("miner is in maintenance mode", "since", st.Since, "reason", st.Reason)
+		m.state = &st
+		m.resume = make(chan struct{})
+	}
+
+	return m, nil
+}
+
+// Active returns true while maintenance mode is enabled
+func (m *Maintenance) Active() bool {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	return m.state != nil
+}
+
+func (m *Maintenance) Start(reason string) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if m.state != nil {
+		return xerrors.Errorf("maintenance mode already enabled since %s", m.state.Since)
+	}
+
+	st := &maintenanceState{Since: time.Now(), Reason: reason}
+	b, err := json.Marshal(st)
+	if err != nil {
+		return xerrors.Errorf("marshaling maintenance state: %w", err)
+	}
+	if err := m.ds.Put(maintenanceKey, b); err != nil {
+		return xerrors.Errorf("storing maintenance state: %w", err)
+	}
+
+	log.Warnw("entering maintenance mode", "reason", reason)
+	m.state = st
+	m.resume = make(chan struct{})
+	return nil
+}
+
+func (m *Maintenance) Stop() error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if m.state == nil {
+		return xerrors.New("maintenance mode not enabled")
+	}
+
+	if err := m.ds.Delete(maintenanceKey); err != nil {
+		return xerrors.Errorf("deleting maintenance state: %w", err)
+	}
+
+	log.Warnw("leaving maintenance mode", "since", m.state.Since)
+	m.state = nil
+	close(m.resume)
+	m.resume = nil
+	return nil
+}
+
+// wait blocks while maintenance mode is enabled
+func (m *Maintenance) wait(ctx context.Context) error {
+	for {
+		m.lk.Lock()
+		resume := m.resume
+		m.lk.Unlock()
+
+		if resume == nil {
+			return nil
+		}
+
+		select {
+		case <-resume:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Status reports the sectors which aren't held yet, the workers the scheduler
+// still has tasks running on, and when the next WindowPoSt deadline of the
+// miner opens. The miner itself must be running when it does.
+func (m *Maintenance) Status(ctx context.Context, sm *Miner, workers map[uint64]storiface.WorkerStats) (api.MaintenanceStatus, error) {
+	var out api.MaintenanceStatus
+
+	m.lk.Lock()
+	if m.state != nil {
+		out.Enabled = true
+		out.Since = m.state.Since
+		out.Reason = m.state.Reason
+	}
+	m.lk.Unlock()
+
+	sectors, err := sm.ListSectors()
+	if err != nil {
+		return api.MaintenanceStatus{}, xerrors.Errorf("listing sectors: %w", err)
+	}
+	running, held := sm.tasks.status()
+	out.Busy, out.Waiting, out.Held, out.BusyWorkers = inFlight(sectors, running, held, workers)
+	out.Drained = out.Enabled && len(out.Busy) == 0 && len(out.Waiting) == 0 && len(out.BusyWorkers) == 0
+
+	di, err := sm.api.StateMinerProvingDeadline(ctx, sm.maddr, types.EmptyTSK)
+	if err != nil {
+		return api.MaintenanceStatus{}, xerrors.Errorf("getting proving deadline: %w", err)
+	}
+	deadlines, err := sm.api.StateMinerDeadlines(ctx, sm.maddr, types.EmptyTSK)
+	if err != nil {
+		return api.MaintenanceStatus{}, xerrors.Errorf("getting deadlines: %w", err)
+	}
+
+	idx, open, ok, err := nextPoStDeadline(di, deadlines)
+	if err != nil {
+		return api.MaintenanceStatus{}, err
+	}
+	if ok {
+		out.HasPoSt = true
+		out.NextPoStDeadline = idx
+		out.NextPoStOpen = open
+		if open > di.CurrentEpoch {
+			out.PoStIn = time.Duration(open-di.CurrentEpoch) * time.Duration(build.BlockDelaySecs) * time.Second
+		}
+	}
+
+	return out, nil
+}
+
+// inFlight sorts the sectors being sealed into the ones with a task running,
+// the ones held at the start of a worker phase, and the others, which wait for
+// the chain or a retry before they run a task. It also returns the workers
+// which have resources in use by the scheduler. A sector can leave the
+// pipeline while its last task is still running, e.g. when it was removed, so
+// the workers must be idle too before they are powered off.
+func inFlight(sectors []sealing.SectorInfo, running, held map[abi.SectorNumber]bool, workers map[uint64]storiface.WorkerStats) (busy, waiting, heldSectors []api.MaintenanceSector, busyWorkers []api.MaintenanceWorker) {
+	busy, waiting, heldSectors = []api.MaintenanceSector{}, []api.MaintenanceSector{}, []api.MaintenanceSector{}
+	for _, si := range sectors {
+		if !pipelineStates[si.State] {
+			continue
+		}
+
+		ms := api.MaintenanceSector{
+			SectorID: si.SectorNumber,
+			State:    api.SectorState(si.State),
+		}
+		switch {
+		case held[si.SectorNumber]:
+			heldSectors = append(heldSectors, ms)
+		case running[si.SectorNumber]:
+			busy = append(busy, ms)
+		default:
+			waiting = append(waiting, ms)
+		}
+	}
+	for _, l := range [][]api.MaintenanceSector{busy, waiting, heldSectors} {
+		l := l
+		sort.Slice(l, func(i, j int) bool {
+			return l[i].SectorID < l[j].SectorID
+		})
+	}
+
+	busyWorkers = []api.MaintenanceWorker{}
+	for id, ws := range workers {
+		if ws.CpuUse > 0 || ws.MemUsedMin > 0 || ws.GpuUsed {
+			busyWorkers = append(busyWorkers, api.MaintenanceWorker{
+				ID:       id,
+				Hostname: ws.Info.Hostname,
+			})
+		}
+	}
+	sort.Slice(busyWorkers, func(i, j int) bool {
+		return busyWorkers[i].ID < busyWorkers[j].ID
+	})
+
+	return busy, waiting, heldSectors, busyWorkers
+}
+
+// nextPoStDeadline finds the first deadline with sectors to prove which didn't
+// close yet, starting at the current one. It returns false if the miner has no
+// sectors to prove.
+func nextPoStDeadline(di *miner.DeadlineInfo, deadlines *miner.Deadlines) (uint64, abi.ChainEpoch, bool, error) {
+	for i := uint64(0); i < miner.WPoStPeriodDeadlines; i++ {
+		idx := (di.Index + i) % miner.WPoStPeriodDeadlines
+
+		n, err := deadlines.Due[idx].Count()
+		if err != nil {
+			return 0, 0, false, xerrors.Errorf("counting sectors of deadline %d: %w", idx, err)
+		}
+		if n == 0 {
+			continue
+		}
+
+		open := di.PeriodStart + abi.ChainEpoch(idx)*miner.WPoStChallengeWindow
+		if idx < di.Index {
+			open += miner.WPoStProvingPeriod
+		}
+		return idx, open, true, nil
+	}
+
+	return 0, 0, false, nil
+}
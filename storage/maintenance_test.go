@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+
+	"github.com/filecoin-project/sector-storage/storiface"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+func TestMaintenancePersist(t *testing.T) {
+	ds := datastore.NewMapDatastore()
+
+	m, err := NewMaintenance(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start("disk replacement"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start("again"); err == nil {
+		t.Fatal("expected starting twice to fail")
+	}
+
+	// a restart stays in maintenance mode
+	m, err = NewMaintenance(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Active() || m.state.Reason != "disk replacement" {
+		t.Fatal("expected maintenance mode to be loaded")
+	}
+
+	if err := m.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	m, err = NewMaintenance(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Active() {
+		t.Fatal("expected maintenance mode to stay disabled")
+	}
+}
+
+func TestMaintenanceInFlight(t *testing.T) {
+	sectors := []sealing.SectorInfo{
+		{SectorNumber: 3, State: sealing.PreCommit2},
+		{SectorNumber: 1, State: sealing.Committing},
+		{SectorNumber: 2, State: sealing.WaitSeed},
+		{SectorNumber: 5, State: sealing.PreCommitWait},
+		{SectorNumber: 6, State: sealing.SealPreCommit1Failed},
+		{SectorNumber: 4, State: sealing.Proving},
+	}
+	running := map[abi.SectorNumber]bool{3: true}
+	held := map[abi.SectorNumber]bool{1: true}
+
+	idle := storiface.WorkerStats{}
+	idle.Info.Hostname = "idle"
+	working := storiface.WorkerStats{CpuUse: 1, MemUsedMin: 1 << 30}
+	working.Info.Hostname = "running"
+	gpu := storiface.WorkerStats{GpuUsed: true}
+	gpu.Info.Hostname = "gpu"
+
+	busy, waiting, heldSectors, workers := inFlight(sectors, running, held, map[uint64]storiface.WorkerStats{0: idle, 2: gpu, 1: working})
+	expectSectors(t, "busy", busy, 3)
+	// sectors waiting for the chain or a retry run a task later on
+	expectSectors(t, "waiting", waiting, 2, 5, 6)
+	expectSectors(t, "held", heldSectors, 1)
+	if len(workers) != 2 || workers[0].Hostname != "running" || workers[1].Hostname != "gpu" {
+		t.Fatalf("expected the workers with tasks running, got %v", workers)
+	}
+
+	// tasks still running on workers keep the miner from being drained, even
+	// when every sector is held
+	busy, waiting, heldSectors, workers = inFlight(sectors[1:2], nil, held, map[uint64]storiface.WorkerStats{1: working})
+	if len(busy) != 0 || len(waiting) != 0 || len(heldSectors) != 1 || len(workers) != 1 {
+		t.Fatalf("expected only the worker to be busy, got %v, %v, %v, %v", busy, waiting, heldSectors, workers)
+	}
+
+	busy, waiting, heldSectors, workers = inFlight(nil, nil, nil, map[uint64]storiface.WorkerStats{0: idle})
+	if len(busy) != 0 || len(waiting) != 0 || len(heldSectors) != 0 || len(workers) != 0 {
+		t.Fatalf("expected nothing in flight, got %v, %v, %v, %v", busy, waiting, heldSectors, workers)
+	}
+}
+
+func expectSectors(t *testing.T, what string, sectors []api.MaintenanceSector, expected ...abi.SectorNumber) {
+	t.Helper()
+
+	if len(sectors) != len(expected) {
+		t.Fatalf("expected %s sectors %v, got %v", what, expected, sectors)
+	}
+	for i, s := range sectors {
+		if s.SectorID != expected[i] {
+			t.Fatalf("expected %s sectors %v, got %v", what, expected, sectors)
+		}
+	}
+}
+
+func TestMaintenanceHoldsTasks(t *testing.T) {
+	m, err := NewMaintenance(datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := &hangingSealer{started: make(chan struct{})}
+	tasks := newSealingTasks(hs, m)
+
+	errs := make(chan error)
+	precommit1 := func() {
+		_, err := tasks.SealPreCommit1(context.TODO(), abi.SectorID{Miner: 1000, Number: 1}, nil, nil)
+		errs <- err
+	}
+	go precommit1()
+	<-hs.started
+
+	if err := m.Start("disk replacement"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the checkpoint aborts the running task, the state machine retries it
+	// and it's held
+	if aborted := tasks.Checkpoint(); len(aborted) != 1 || aborted[0] != 1 {
+		t.Fatalf("expected the task of sector 1 to be aborted, got %v", aborted)
+	}
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("expected the task to be cancelled, got %v", err)
+	}
+
+	hs.started = make(chan struct{})
+	go precommit1()
+	for {
+		running, held := tasks.status()
+		if held[1] {
+			if running[1] {
+				t.Fatal("expected the held task not to run")
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := m.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	<-hs.started
+	if running, held := tasks.status(); !running[1] || held[1] {
+		t.Fatalf("expected the task to run once maintenance mode is disabled, got running %v, held %v", running, held)
+	}
+
+	tasks.Abort(1)
+	<-errs
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/journal"
+)
+
+// ErrMessageWouldFail is returned when a message wasn't broadcast because it
+// aborted when executed against the current head
+var ErrMessageWouldFail = xerrors.New("message would fail on chain")
+
+// checkAndPush executes a message originating from the miner on the state
+// computed by executing the current head, the way it would be executed if it
+// was included in the next tipset, before pushing it to the mpool. It refuses
+// to broadcast messages which abort. This saves the fees burned on messages
+// which predictably fail, e.g. PoSts for the wrong deadline or commits of
+// expired precommits.
+//
+// If the dry-run itself can't be executed the message is pushed anyway, the
+// check must not keep the miner from submitting proofs.
+func checkAndPush(ctx context.Context, a storageMinerApi, msg *types.Message) (*types.SignedMessage, error) {
+	res, err := a.StateDryRun(ctx, msg, types.EmptyTSK)
+	switch {
+	case err != nil:
+		log.Warnw("message dry-run failed, pushing without check", "to", msg.To, "method", msg.Method, "error", err)
+	case res.MsgRct.ExitCode != exitcode.Ok:
+		log.Errorw("not broadcasting message which would fail", "to", msg.To, "method", msg.Method, "exitcode", res.MsgRct.ExitCode, "error", res.Error)
+		journalMessage(msg, nil, xerrors.Errorf("dry-run exit code %d: %s", res.MsgRct.ExitCode, res.Error))
+		return nil, xerrors.Errorf("%w: exit code %d: %s", ErrMessageWouldFail, res.MsgRct.ExitCode, res.Error)
+	}
+
+	smsg, err := a.MpoolPushMessage(ctx, msg, nil)
+	journalMessage(msg, smsg, err)
+	return smsg, err
+}
+
+func journalMessage(msg *types.Message, smsg *types.SignedMessage, err error) {
+	e := map[string]interface{}{
+		"to":     msg.To,
+		"method": msg.Method,
+		"value":  msg.Value,
+	}
+	if smsg != nil {
+		e["cid"] = smsg.Cid()
+		e["nonce"] = smsg.Message.Nonce
+	}
+	if err != nil {
+		e["error"] = err.Error()
+	}
+	journal.Record(journal.SysMiner, journal.EvtMinerMessage, e)
+}
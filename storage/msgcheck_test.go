@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type msgcheckTestAPI struct {
+	storageMinerApi
+
+	exit   exitcode.ExitCode
+	dryErr error
+
+	dryRun []types.TipSetKey
+	pushed []*types.Message
+}
+
+func (a *msgcheckTestAPI) StateDryRun(ctx context.Context, msg *types.Message, tsk types.TipSetKey) (*api.InvocResult, error) {
+	a.dryRun = append(a.dryRun, tsk)
+	if a.dryErr != nil {
+		return nil, a.dryErr
+	}
+	return &api.InvocResult{
+		Msg:    msg,
+		MsgRct: &types.MessageReceipt{ExitCode: a.exit},
+		Error:  "aborted",
+	}, nil
+}
+
+func (a *msgcheckTestAPI) MpoolPushMessage(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (*types.SignedMessage, error) {
+	a.pushed = append(a.pushed, msg)
+	return &types.SignedMessage{Message: *msg}, nil
+}
+
+func TestCheckAndPush(t *testing.T) {
+	ctx := context.TODO()
+	to, err := address.NewIDAddress(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &types.Message{To: to, From: to, Method: 5, Value: types.NewInt(0)}
+
+	// messages are dry run on the state of the current head
+	a := &msgcheckTestAPI{}
+	if _, err := checkAndPush(ctx, a, msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.dryRun) != 1 || a.dryRun[0] != types.EmptyTSK || len(a.pushed) != 1 || a.pushed[0] != msg {
+		t.Fatalf("expected the message to be dry run at the head and pushed, got %v and %v", a.dryRun, a.pushed)
+	}
+
+	// messages which would abort aren't broadcast
+	a = &msgcheckTestAPI{exit: exitcode.ErrIllegalArgument}
+	if _, err := checkAndPush(ctx, a, msg); !xerrors.Is(err, ErrMessageWouldFail) {
+		t.Fatalf("expected the message to be refused, got %v", err)
+	}
+	if len(a.pushed) != 0 {
+		t.Fatal("expected the failing message not to be pushed")
+	}
+
+	// the message is pushed when it can't be dry run
+	a = &msgcheckTestAPI{dryErr: xerrors.New("state not computed")}
+	if _, err := checkAndPush(ctx, a, msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.pushed) != 1 {
+		t.Fatal("expected the message to be pushed without check")
+	}
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+type PledgePolicyConfig struct {
+	CheckInterval time.Duration
+
+	// MaxSealingSectors is the number of sectors in the sealing pipeline,
+	// with and without deals
+	MaxSealingSectors int
+	// DealFillRatio is the share of the pipeline kept for sectors with deals
+	DealFillRatio float64
+
+	// PledgeBudget is the number of CC sectors pledged in every BudgetPeriod,
+	// zero means no limit
+	PledgeBudget int
+	BudgetPeriod time.Duration
+
+	// MaxProvingSectors is the number of sectors, sealing and proving, above
+	// which nothing is pledged. Zero means no limit.
+	MaxProvingSectors int
+
+	// FailedGracePeriod is how long sectors in failed states count as sealing
+	FailedGracePeriod time.Duration
+}
+
+// pledgeListTimeout is how long a pledged sector is counted as sealing before
+// it's listed by the sealing pipeline. Pledged sectors are listed once their
+// pieces are added, pledges which failed before are never listed.
+var pledgeListTimeout = 2 * time.Hour
+
+// provingStates are the states of sealed sectors, which count against the
+// proving capacity but not the sealing pipeline
+var provingStates = map[sealing.SectorState]bool{
+	sealing.Proving:       true,
+	sealing.Faulty:        true,
+	sealing.FaultReported: true,
+}
+
+// deadStates are the states of sectors which are neither sealed nor proven
+// anymore
+var deadStates = map[sealing.SectorState]bool{
+	sealing.FailedUnrecoverable: true,
+	sealing.FaultedFinal:        true,
+}
+
+// failedStates are the states of sectors whose sealing failed, and which are
+// retried
+var failedStates = map[sealing.SectorState]bool{
+	sealing.SealPreCommit1Failed: true,
+	sealing.SealPreCommit2Failed: true,
+	sealing.PreCommitFailed:      true,
+	sealing.ComputeProofFailed:   true,
+	sealing.CommitFailed:         true,
+	sealing.PackingFailed:        true,
+	sealing.FinalizeFailed:       true,
+}
+
+// pledgeMiner is the part of the Miner the pledge policy uses
+type pledgeMiner interface {
+	ListSectors() ([]sealing.SectorInfo, error)
+	PledgeSector() error
+}
+
+// PledgePolicy pledges committed capacity sectors when the sealing pipeline
+// has room that isn't kept for deals. The pipeline holds MaxSealingSectors
+// sectors, of which the DealFillRatio share is only used by sectors with
+// deals; CC sectors are pledged into the rest, one per check. Pledging also
+// stops when the budget of CC sectors for the current period is spent, when
+// the miner reaches its proving capacity, and during maintenance.
+//
+// Pledged sectors count as sealing from the moment they're pledged, until the
+// sealing pipeline lists them. Sectors in failed states count as sealing for
+// FailedGracePeriod, while they're retried.
+//
+// The budget is tracked in memory, restarting the miner resets it.
+type PledgePolicy struct {
+	miner pledgeMiner
+	maint *Maintenance
+	cfg   PledgePolicyConfig
+
+	lk      sync.Mutex
+	pledges []time.Time
+	status  api.PledgePolicyStatus
+
+	// known are the sectors listed by the last check, nil before the first
+	known map[abi.SectorNumber]struct{}
+	// pending are the times of the pledges which aren't listed yet
+	pending []time.Time
+	// failedSince is when sectors were first seen in a failed state
+	failedSince map[abi.SectorNumber]time.Time
+}
+
+func NewPledgePolicy(m *Miner, maint *Maintenance, cfg PledgePolicyConfig) *PledgePolicy {
+	return &PledgePolicy{
+		miner:       m,
+		maint:       maint,
+		cfg:         cfg,
+		failedSince: map[abi.SectorNumber]time.Time{},
+	}
+}
+
+func (p *PledgePolicy) Run(ctx context.Context) {
+	tick := time.NewTicker(p.cfg.CheckInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			if err := p.check(time.Now()); err != nil {
+				log.Errorf("pledge policy: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Status returns the outcome of the last check
+func (p *PledgePolicy) Status() api.PledgePolicyStatus {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	return p.status
+}
+
+func (p *PledgePolicy) check(now time.Time) error {
+	sectors, err := p.miner.ListSectors()
+	if err != nil {
+		return xerrors.Errorf("listing sectors: %w", err)
+	}
+
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	p.expireBudget(now)
+
+	st := api.PledgePolicyStatus{
+		LastCheck:    now,
+		BudgetUsed:   len(p.pledges),
+		Budget:       p.cfg.PledgeBudget,
+		MaxSealing:   p.cfg.MaxSealingSectors,
+		MaxSectors:   p.cfg.MaxProvingSectors,
+		MaxSealingCC: p.ccSlots(),
+	}
+	p.trackPending(sectors, now)
+	st.PendingPledges = len(p.pending)
+	st.SealingCC += len(p.pending)
+
+	failed := map[abi.SectorNumber]time.Time{}
+	for _, si := range sectors {
+		if failedStates[si.State] {
+			since, ok := p.failedSince[si.SectorNumber]
+			if !ok {
+				since = now
+			}
+			failed[si.SectorNumber] = since
+
+			if now.Sub(since) > p.cfg.FailedGracePeriod {
+				st.Failed++
+				continue
+			}
+		}
+
+		switch {
+		case deadStates[si.State]:
+		case provingStates[si.State]:
+			st.Proving++
+		case hasDeals(si):
+			st.SealingDeals++
+		default:
+			st.SealingCC++
+		}
+	}
+	p.failedSince = failed
+
+	st.Reason = p.waitReason(st)
+	if st.Reason == "" {
+		if err := p.miner.PledgeSector(); err != nil {
+			st.Reason = fmt.Sprintf("pledging failed: %s", err)
+		} else {
+			st.Pledged = true
+			st.BudgetUsed++
+			p.pledges = append(p.pledges, now)
+			p.pending = append(p.pending, now)
+			log.Infow("pledged CC sector", "sealingCC", st.SealingCC, "sealingDeals", st.SealingDeals, "proving", st.Proving)
+		}
+	}
+
+	p.status = st
+	return nil
+}
+
+// trackPending drops the pending pledges which the sealing pipeline lists
+// now, new CC sectors are taken for the oldest pledges, and the ones which
+// weren't listed within pledgeListTimeout
+func (p *PledgePolicy) trackPending(sectors []sealing.SectorInfo, now time.Time) {
+	first := p.known == nil
+	known := make(map[abi.SectorNumber]struct{}, len(sectors))
+	for _, si := range sectors {
+		known[si.SectorNumber] = struct{}{}
+		if first {
+			continue
+		}
+		if _, ok := p.known[si.SectorNumber]; ok || hasDeals(si) || len(p.pending) == 0 {
+			continue
+		}
+		p.pending = p.pending[1:]
+	}
+	p.known = known
+
+	for len(p.pending) > 0 && now.Sub(p.pending[0]) > pledgeListTimeout {
+		log.Warnw("pledged sector wasn't listed by the sealing pipeline", "pledged", p.pending[0])
+		p.pending = p.pending[1:]
+	}
+}
+
+// waitReason returns why no sector can be pledged, or an empty string
+func (p *PledgePolicy) waitReason(st api.PledgePolicyStatus) string {
+	inFlight := st.SealingCC + st.SealingDeals
+	switch {
+	case p.maint != nil && p.maint.Active():
+		return "maintenance mode is enabled"
+	case p.cfg.MaxProvingSectors > 0 && st.Proving+inFlight >= p.cfg.MaxProvingSectors:
+		return "proving capacity reached"
+	case p.cfg.PledgeBudget > 0 && st.BudgetUsed >= p.cfg.PledgeBudget:
+		return "pledge budget spent"
+	case inFlight >= p.cfg.MaxSealingSectors:
+		return "sealing pipeline is full"
+	case st.SealingCC >= st.MaxSealingCC:
+		return "waiting for deals"
+	}
+	return ""
+}
+
+// ccSlots is the number of pipeline slots CC sectors can use
+func (p *PledgePolicy) ccSlots() int {
+	return int(float64(p.cfg.MaxSealingSectors) * (1 - p.cfg.DealFillRatio))
+}
+
+// expireBudget drops the pledges made before the current budget period
+func (p *PledgePolicy) expireBudget(now time.Time) {
+	cutoff := now.Add(-p.cfg.BudgetPeriod)
+
+	i := 0
+	for i < len(p.pledges) && !p.pledges[i].After(cutoff) {
+		i++
+	}
+	p.pledges = p.pledges[i:]
+}
+
+func hasDeals(si sealing.SectorInfo) bool {
+	for _, piece := range si.Pieces {
+		if piece.DealInfo != nil {
+			return true
+		}
+	}
+	return false
+}
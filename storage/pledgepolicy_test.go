@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+type pledgeTestMiner struct {
+	sectors []sealing.SectorInfo
+	pledged int
+}
+
+func (m *pledgeTestMiner) ListSectors() ([]sealing.SectorInfo, error) {
+	return m.sectors, nil
+}
+
+func (m *pledgeTestMiner) PledgeSector() error {
+	m.pledged++
+	return nil
+}
+
+// list lists the sectors pledged so far
+func (m *pledgeTestMiner) list() {
+	for len(m.sectors) < m.pledged {
+		m.sectors = append(m.sectors, sealing.SectorInfo{
+			State:        sealing.PreCommit1,
+			SectorNumber: abi.SectorNumber(len(m.sectors)),
+		})
+	}
+}
+
+func newTestPledgePolicy(m pledgeMiner) *PledgePolicy {
+	return &PledgePolicy{
+		miner: m,
+		cfg: PledgePolicyConfig{
+			MaxSealingSectors: 2,
+			FailedGracePeriod: time.Hour,
+		},
+		failedSince: map[abi.SectorNumber]time.Time{},
+	}
+}
+
+func TestPledgePolicyPendingPledges(t *testing.T) {
+	m := &pledgeTestMiner{}
+	p := newTestPledgePolicy(m)
+	now := time.Now()
+
+	check := func() {
+		t.Helper()
+		if err := p.check(now); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	check()
+	check()
+	check()
+	if m.pledged != 2 {
+		t.Fatalf("expected pledges which aren't listed yet to fill the pipeline, pledged %d", m.pledged)
+	}
+	if st := p.Status(); st.PendingPledges != 2 || st.SealingCC != 2 || st.Pledged {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	// listing the sectors doesn't count them twice
+	m.list()
+	check()
+	if st := p.Status(); st.PendingPledges != 0 || st.SealingCC != 2 || m.pledged != 2 {
+		t.Fatalf("unexpected status %+v, pledged %d", st, m.pledged)
+	}
+
+	// sectors are proven, the pipeline has room again
+	for i := range m.sectors {
+		m.sectors[i].State = sealing.Proving
+	}
+	check()
+	if m.pledged != 3 {
+		t.Fatalf("expected a sector to be pledged, pledged %d", m.pledged)
+	}
+
+	// pledges which never show up expire
+	now = now.Add(pledgeListTimeout + time.Minute)
+	check()
+	if st := p.Status(); !st.Pledged || st.PendingPledges != 0 || m.pledged != 4 {
+		t.Fatalf("expected the lost pledge to be dropped, status %+v, pledged %d", st, m.pledged)
+	}
+}
+
+func TestPledgePolicyFailedSectors(t *testing.T) {
+	m := &pledgeTestMiner{
+		sectors: []sealing.SectorInfo{
+			{State: sealing.PreCommitFailed, SectorNumber: 0},
+			{State: sealing.SealPreCommit1Failed, SectorNumber: 1},
+		},
+	}
+	p := newTestPledgePolicy(m)
+	now := time.Now()
+
+	if err := p.check(now); err != nil {
+		t.Fatal(err)
+	}
+	if st := p.Status(); st.Pledged || st.SealingCC != 2 || st.Failed != 0 {
+		t.Fatalf("expected recently failed sectors to fill the pipeline, status %+v", st)
+	}
+
+	// one of the sectors recovers, the other one stays failed
+	m.sectors[0].State = sealing.Committing
+	if err := p.check(now.Add(p.cfg.FailedGracePeriod + time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	st := p.Status()
+	if !st.Pledged || st.Failed != 1 || st.SealingCC != 1 {
+		t.Fatalf("expected the stuck sector not to count as sealing, status %+v", st)
+	}
+
+	// failing again restarts the grace period, the pledged sector is pending
+	m.sectors[0].State = sealing.CommitFailed
+	if err := p.check(now.Add(p.cfg.FailedGracePeriod + 2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if st := p.Status(); st.Pledged || st.Failed != 1 || st.PendingPledges != 1 || st.SealingCC != 2 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
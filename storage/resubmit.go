@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/messagepool"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type ResubmitConfig struct {
+	// After is the number of epochs after which a message which wasn't
+	// included is replaced. Zero disables resubmission.
+	After abi.ChainEpoch
+	// FeeMultiplier is applied to the gas price of each replacement
+	FeeMultiplier float64
+	// MaxGasPrice caps the gas price of replacements
+	MaxGasPrice types.BigInt
+}
+
+// resubmitter makes sure critical messages, which have to land before a
+// deadline, don't get stuck in the mpool because of a low gas price. When a
+// message isn't included for a while, it's replaced by a message with the same
+// nonce and a higher gas price.
+type resubmitter struct {
+	api storageMinerApi
+	cfg ResubmitConfig
+}
+
+// watch waits for a message, or one of its replacements, to be executed on
+// chain before the deadline epoch. An error is returned when no version of the
+// message landed before the deadline, or it failed on chain.
+func (r *resubmitter) watch(ctx context.Context, smsg *types.SignedMessage, deadline abi.ChainEpoch) (*api.MsgLookup, error) {
+	head, err := r.api.ChainHead(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("getting chain head: %w", err)
+	}
+
+	sent := []cid.Cid{smsg.Cid()}
+	lastSent := head.Height()
+	cur := smsg
+
+	tick := time.NewTicker(time.Duration(build.BlockDelaySecs) * time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		for _, c := range sent {
+			lookup, err := r.api.StateSearchMsg(ctx, c)
+			if err != nil {
+				log.Warnw("searching for message", "cid", c, "error", err)
+				continue
+			}
+			if lookup == nil {
+				continue
+			}
+			if lookup.Receipt.ExitCode != 0 {
+				return lookup, xerrors.Errorf("message %s failed on chain: exit code %d", c, lookup.Receipt.ExitCode)
+			}
+			return lookup, nil
+		}
+
+		head, err := r.api.ChainHead(ctx)
+		if err != nil {
+			log.Warnw("getting chain head", "error", err)
+			continue
+		}
+
+		if head.Height() >= deadline {
+			return nil, xerrors.Errorf("message %s wasn't included before deadline epoch %d (%d replacements sent)", smsg.Cid(), deadline, len(sent)-1)
+		}
+
+		act, err := r.api.StateGetActor(ctx, cur.Message.From, head.Key())
+		if err == nil && act.Nonce > cur.Message.Nonce {
+			// the nonce was used, but the message may not be indexed for
+			// search yet, check again on the next epoch
+			continue
+		}
+
+		if r.cfg.After <= 0 || head.Height()-lastSent < r.cfg.After {
+			continue
+		}
+
+		next, err := r.replace(ctx, cur)
+		if err != nil {
+			log.Errorw("replacing stuck message", "cid", cur.Cid(), "error", err)
+			continue
+		}
+		if next == nil {
+			continue // already at the fee cap
+		}
+
+		log.Warnw("replaced message which wasn't included", "old", cur.Cid(), "new", next.Cid(), "gasprice", next.Message.GasPrice, "deadline", deadline)
+
+		sent = append(sent, next.Cid())
+		lastSent = head.Height()
+		cur = next
+	}
+}
+
+// replace pushes a copy of the message with a higher gas price. It returns nil
+// when the gas price can't be raised enough for the mpool to accept the
+// replacement without exceeding the configured cap.
+func (r *resubmitter) replace(ctx context.Context, smsg *types.SignedMessage) (*types.SignedMessage, error) {
+	msg := smsg.Message
+
+	price, ok := r.cfg.replacementPrice(msg.GasPrice)
+	if !ok {
+		return nil, nil
+	}
+	msg.GasPrice = price
+
+	next, err := r.api.WalletSignMessage(ctx, msg.From, &msg)
+	if err != nil {
+		return nil, xerrors.Errorf("signing replacement: %w", err)
+	}
+
+	if _, err := r.api.MpoolPush(ctx, next); err != nil {
+		return nil, xerrors.Errorf("pushing replacement: %w", err)
+	}
+
+	return next, nil
+}
+
+// replacementPrice returns the gas price of the replacement of a message with
+// the given gas price: FeeMultiplier times the price, but at least the lowest
+// price the mpool accepts for a replacement. It returns false when that price
+// exceeds MaxGasPrice.
+func (cfg ResubmitConfig) replacementPrice(old types.BigInt) (types.BigInt, bool) {
+	price := types.BigDiv(types.BigMul(old, types.NewInt(uint64(cfg.FeeMultiplier*256))), types.NewInt(256))
+	if min := messagepool.MinRBFPrice(old); price.LessThan(min) {
+		price = min
+	}
+
+	if !cfg.MaxGasPrice.Nil() && price.GreaterThan(cfg.MaxGasPrice) {
+		if messagepool.MinRBFPrice(old).GreaterThan(cfg.MaxGasPrice) {
+			return types.EmptyInt, false
+		}
+		price = cfg.MaxGasPrice
+	}
+
+	return price, true
+}
+
+// Validate checks that the replacements made with the config are accepted by
+// the mpool
+func (cfg ResubmitConfig) Validate() error {
+	if cfg.After <= 0 {
+		return nil
+	}
+
+	if cfg.FeeMultiplier < messagepool.ReplaceByFeeRatio {
+		return xerrors.Errorf("resubmit fee multiplier %f is lower than the mpool replace-by-fee ratio %f", cfg.FeeMultiplier, messagepool.ReplaceByFeeRatio)
+	}
+	if min := messagepool.MinRBFPrice(types.NewInt(0)); !cfg.MaxGasPrice.Nil() && cfg.MaxGasPrice.LessThan(min) {
+		return xerrors.Errorf("resubmit max gas price %s is lower than the lowest replacement price %s", cfg.MaxGasPrice, min)
+	}
+
+	return nil
+}
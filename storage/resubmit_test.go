@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+
+	"github.com/filecoin-project/lotus/chain/messagepool"
+	"github.com/filecoin-project/lotus/chain/messagepool/mpooltest"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/wallet"
+	_ "github.com/filecoin-project/lotus/lib/sigs/secp"
+)
+
+type resubmitTestAPI struct {
+	storageMinerApi
+
+	w  *wallet.Wallet
+	mp *messagepool.MessagePool
+}
+
+func (a *resubmitTestAPI) WalletSignMessage(ctx context.Context, from address.Address, msg *types.Message) (*types.SignedMessage, error) {
+	sig, err := a.w.Sign(ctx, from, msg.Cid().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &types.SignedMessage{Message: *msg, Signature: *sig}, nil
+}
+
+func (a *resubmitTestAPI) MpoolPush(ctx context.Context, smsg *types.SignedMessage) (cid.Cid, error) {
+	return a.mp.Push(smsg)
+}
+
+func TestResubmitReplacementAccepted(t *testing.T) {
+	w, err := wallet.NewWallet(wallet.NewMemKeyStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := w.GenerateKey(crypto.SigTypeSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mp, err := messagepool.New(mpooltest.NewProvider(), datastore.NewMapDatastore(), "resubmittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mp.Close() //nolint:errcheck
+
+	tapi := &resubmitTestAPI{w: w, mp: mp}
+	r := &resubmitter{
+		api: tapi,
+		cfg: ResubmitConfig{After: 1, FeeMultiplier: 1.5},
+	}
+
+	// low prices, where the multiplier alone doesn't reach the mpool minimum
+	for nonce, price := range []uint64{0, 1, 5, 7, 100} {
+		orig, err := tapi.WalletSignMessage(context.TODO(), from, &types.Message{
+			From:     from,
+			To:       from,
+			Nonce:    uint64(nonce),
+			Value:    types.NewInt(0),
+			GasPrice: types.NewInt(price),
+			GasLimit: 10000,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mp.Push(orig); err != nil {
+			t.Fatal(err)
+		}
+
+		next, err := r.replace(context.TODO(), orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next == nil {
+			t.Fatalf("gas price %d: expected a replacement", price)
+		}
+
+		pending, _ := mp.Pending()
+		var found bool
+		for _, m := range pending {
+			if m.Message.Nonce != uint64(nonce) {
+				continue
+			}
+			if m.Cid() != next.Cid() {
+				t.Fatalf("gas price %d: the mpool kept %s instead of the replacement %s (gas price %s)", price, m.Cid(), next.Cid(), next.Message.GasPrice)
+			}
+			found = true
+		}
+		if !found {
+			t.Fatalf("gas price %d: replacement isn't pending", price)
+		}
+	}
+}
+
+func TestResubmitConfig(t *testing.T) {
+	cfg := ResubmitConfig{After: 1, FeeMultiplier: 1.5, MaxGasPrice: types.NewInt(100)}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the mpool accepts replacements of a price of 80 from 102
+	if _, ok := cfg.replacementPrice(types.NewInt(80)); ok {
+		t.Fatal("expected no replacement above the max gas price")
+	}
+	if p, ok := cfg.replacementPrice(types.NewInt(70)); !ok || !p.Equals(types.NewInt(100)) {
+		t.Fatalf("expected the replacement price to be capped to 100, got %s", p)
+	}
+
+	cfg.FeeMultiplier = 1.1
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected a fee multiplier below the replace-by-fee ratio to be rejected")
+	}
+
+	cfg.FeeMultiplier = 1.5
+	cfg.MaxGasPrice = types.NewInt(1)
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected a max gas price below the lowest replacement price to be rejected")
+	}
+}
@@ -0,0 +1,446 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/sector-storage/storiface"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+// EstimatorInterval is how often the sealing estimator observes sector states
+var EstimatorInterval = time.Minute
+
+// phaseHistoryAlpha is the weight of a new sample in the moving average of a
+// phase duration
+const phaseHistoryAlpha = 0.2
+
+var (
+	phaseHistoryKey = datastore.NewKey("/sealing-eta/phases")
+	classHistoryKey = datastore.NewKey("/sealing-eta/classes")
+)
+
+// LocalWorkerClass is the worker class of tasks which weren't run by a remote
+// worker
+const LocalWorkerClass = "local"
+
+// WorkerClass returns the class of a worker. Workers with the same hardware
+// are expected to seal at the same speed, their phase durations are averaged
+// together.
+func WorkerClass(info storiface.WorkerInfo) string {
+	return fmt.Sprintf("%dcpu-%dgpu-%dgib", info.Resources.CPUs, len(info.Resources.GPUs), info.Resources.MemPhysical>>30)
+}
+
+// sealingPipeline lists the phases a sector goes through until it's proving,
+// in order
+var sealingPipeline = []sealing.SectorState{
+	sealing.Packing,
+	sealing.PreCommit1,
+	sealing.PreCommit2,
+	sealing.PreCommitting,
+	sealing.PreCommitWait,
+	sealing.WaitSeed,
+	sealing.Committing,
+	sealing.CommitWait,
+	sealing.FinalizeSector,
+}
+
+// chainPhaseDurations are the expected durations of phases which wait for the
+// chain, used until their durations were observed. They're computed on use,
+// as the block delay of custom networks is set at startup.
+func chainPhaseDurations() map[sealing.SectorState]time.Duration {
+	epochDuration := time.Duration(build.BlockDelaySecs) * time.Second
+
+	return map[sealing.SectorState]time.Duration{
+		sealing.PreCommitting: time.Minute,
+		sealing.PreCommitWait: 5 * epochDuration,
+		sealing.WaitSeed:      time.Duration(miner.PreCommitChallengeDelay) * epochDuration,
+		sealing.CommitWait:    5 * epochDuration,
+	}
+}
+
+// phaseEvents maps the kinds of the sector log entries of state machine events
+// to the phases the events start
+var phaseEvents = map[string]sealing.SectorState{
+	eventKind(sealing.SectorStart{}):           sealing.Packing,
+	eventKind(sealing.SectorStartCC{}):         sealing.Packing,
+	eventKind(sealing.SectorPacked{}):          sealing.PreCommit1,
+	eventKind(sealing.SectorPreCommit1{}):      sealing.PreCommit2,
+	eventKind(sealing.SectorPreCommit2{}):      sealing.PreCommitting,
+	eventKind(sealing.SectorPreCommitted{}):    sealing.PreCommitWait,
+	eventKind(sealing.SectorPreCommitLanded{}): sealing.WaitSeed,
+	eventKind(sealing.SectorSeedReady{}):       sealing.Committing,
+	eventKind(sealing.SectorCommitted{}):       sealing.CommitWait,
+	eventKind(sealing.SectorProving{}):         sealing.FinalizeSector,
+	eventKind(sealing.SectorFinalized{}):       sealing.Proving,
+}
+
+// eventKind returns the kind the state machine logs the event with
+func eventKind(evt interface{}) string {
+	return fmt.Sprintf("event;%T", evt)
+}
+
+type phaseHistory struct {
+	Average time.Duration
+	Samples int
+}
+
+type observedSector struct {
+	state sealing.SectorState
+	since time.Time
+	// logged is the number of log entries of the sector which were sampled
+	logged int
+}
+
+// sectorWorkers are the classes of the workers which ran the tasks of a sector
+type sectorWorkers struct {
+	phases map[sealing.SectorState]string
+	// last is the class of the worker which ran the latest task, the next
+	// tasks of the sector are expected to run on the same class of workers
+	last string
+}
+
+// SealingEstimator estimates when in-flight sectors finish sealing.
+//
+// It observes the sealing phases of all sectors, and keeps a moving average
+// of how long each phase took on every class of workers, and on all workers.
+// The scheduler doesn't expose which worker runs a task, remote workers report
+// the tasks they start with TaskStarted, tasks no remote worker reported ran
+// on the miner. Phases which weren't observed yet on the class of workers
+// running the sector fall back to the average of all workers, then to the
+// durations the watchdog expects.
+type SealingEstimator struct {
+	miner *Miner
+	ds    datastore.Datastore
+
+	ssize abi.SectorSize
+
+	// started is when the estimator was created, transitions logged before
+	// were sampled by a previous run
+	started time.Time
+
+	lk       sync.Mutex
+	history  map[sealing.SectorState]*phaseHistory
+	classes  map[string]map[sealing.SectorState]*phaseHistory
+	observed map[abi.SectorNumber]observedSector
+	workers  map[abi.SectorNumber]*sectorWorkers
+}
+
+func NewSealingEstimator(m *Miner, ds datastore.Datastore) (*SealingEstimator, error) {
+	e := &SealingEstimator{
+		miner:    m,
+		ds:       ds,
+		ssize:    watchdogBaseSize,
+		started:  time.Now(),
+		history:  map[sealing.SectorState]*phaseHistory{},
+		classes:  map[string]map[sealing.SectorState]*phaseHistory{},
+		observed: map[abi.SectorNumber]observedSector{},
+		workers:  map[abi.SectorNumber]*sectorWorkers{},
+	}
+
+	for k, v := range map[datastore.Key]interface{}{
+		phaseHistoryKey: &e.history,
+		classHistoryKey: &e.classes,
+	} {
+		b, err := ds.Get(k)
+		switch {
+		case err == datastore.ErrNotFound:
+		case err != nil:
+			return nil, xerrors.Errorf("loading sealing phase history: %w", err)
+		default:
+			if err := json.Unmarshal(b, v); err != nil {
+				return nil, xerrors.Errorf("unmarshaling sealing phase history: %w", err)
+			}
+		}
+	}
+
+	return e, nil
+}
+
+// TaskStarted records that a worker of the class started the task of the
+// sector in the phase.
+func (e *SealingEstimator) TaskStarted(sector abi.SectorNumber, phase sealing.SectorState, class string) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	sw, ok := e.workers[sector]
+	if !ok {
+		sw = &sectorWorkers{phases: map[sealing.SectorState]string{}}
+		e.workers[sector] = sw
+	}
+	sw.phases[phase] = class
+	sw.last = class
+}
+
+// workerClass returns the class of the worker which ran the phase of the
+// sector, or an empty string for phases which don't run on workers
+func (e *SealingEstimator) workerClass(sector abi.SectorNumber, phase sealing.SectorState) string {
+	if !workerPhases[phase] {
+		return ""
+	}
+	if sw, ok := e.workers[sector]; ok {
+		if class, ok := sw.phases[phase]; ok {
+			return class
+		}
+	}
+	return LocalWorkerClass
+}
+
+func (e *SealingEstimator) Run(ctx context.Context) {
+	mi, err := e.miner.api.StateMinerInfo(ctx, e.miner.maddr, types.EmptyTSK)
+	if err != nil {
+		log.Errorf("sealing estimator: getting miner info: %s", err)
+	} else {
+		e.lk.Lock()
+		e.ssize = mi.SectorSize
+		e.lk.Unlock()
+	}
+
+	tick := time.NewTicker(EstimatorInterval)
+	defer tick.Stop()
+
+	for {
+		if err := e.observe(); err != nil {
+			log.Errorf("sealing estimator: %s", err)
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// observe records the durations of phases sectors left since the last
+// observation.
+func (e *SealingEstimator) observe() error {
+	sectors, err := e.miner.ListSectors()
+	if err != nil {
+		return xerrors.Errorf("listing sectors: %w", err)
+	}
+	return e.observeSectors(sectors)
+}
+
+func (e *SealingEstimator) observeSectors(sectors []sealing.SectorInfo) error {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	observed := make(map[abi.SectorNumber]observedSector, len(sectors))
+	changed := false
+	for _, si := range sectors {
+		if len(si.Log) == 0 {
+			continue
+		}
+		// every state transition is logged, so the last entry tells when the
+		// sector entered its current state
+		cur := observedSector{
+			state:  si.State,
+			since:  time.Unix(int64(si.Log[len(si.Log)-1].Timestamp), 0),
+			logged: len(si.Log),
+		}
+		observed[si.SectorNumber] = cur
+
+		from, after := 0, e.started
+		if prev, ok := e.observed[si.SectorNumber]; ok && prev.logged <= len(si.Log) {
+			from, after = prev.logged, time.Time{}
+		}
+		if e.sampleLog(si.SectorNumber, si.Log, from, after) {
+			changed = true
+		}
+	}
+	e.observed = observed
+
+	// forget the workers of sectors which are done
+	for id := range e.workers {
+		if s, ok := observed[id]; !ok || pipelineIndex(s.state) < 0 {
+			delete(e.workers, id)
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	for k, v := range map[datastore.Key]interface{}{
+		phaseHistoryKey: e.history,
+		classHistoryKey: e.classes,
+	} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return xerrors.Errorf("marshaling sealing phase history: %w", err)
+		}
+		if err := e.ds.Put(k, b); err != nil {
+			return xerrors.Errorf("storing sealing phase history: %w", err)
+		}
+	}
+	return nil
+}
+
+// sampleLog adds the durations of the phases which ended in the log entries of
+// the sector from index from on, and after the given time. Phases are only
+// counted when the sector went on to the next phase, the durations of failed
+// phases would skew the average.
+func (e *SealingEstimator) sampleLog(id abi.SectorNumber, entries []sealing.Log, from int, after time.Time) bool {
+	sampled := false
+
+	// the phase the sector was in, and when it started
+	var phase sealing.SectorState
+	var start time.Time
+	for i, l := range entries {
+		at := time.Unix(int64(l.Timestamp), 0)
+		next, ok := phaseEvents[l.Kind]
+		if !ok {
+			// failures and retries start other states
+			phase = ""
+			continue
+		}
+
+		if i >= from && !at.Before(after) && phase != "" && nextPhase(phase, next) {
+			e.addSample(phase, e.workerClass(id, phase), at.Sub(start))
+			sampled = true
+		}
+		phase, start = next, at
+	}
+
+	return sampled
+}
+
+// addSample adds the duration of the phase to the history of all workers,
+// and to the history of the class of workers it ran on, if any.
+func (e *SealingEstimator) addSample(st sealing.SectorState, class string, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	add := func(history map[sealing.SectorState]*phaseHistory) {
+		h, ok := history[st]
+		if !ok {
+			history[st] = &phaseHistory{Average: d, Samples: 1}
+			return
+		}
+
+		h.Average += time.Duration(phaseHistoryAlpha * float64(d-h.Average))
+		h.Samples++
+	}
+
+	add(e.history)
+	if class == "" {
+		return
+	}
+	if _, ok := e.classes[class]; !ok {
+		e.classes[class] = map[sealing.SectorState]*phaseHistory{}
+	}
+	add(e.classes[class])
+}
+
+// Estimates returns the estimated completion time of every sector which is
+// being sealed.
+func (e *SealingEstimator) Estimates(now time.Time) []api.SectorEstimate {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	out := make([]api.SectorEstimate, 0, len(e.observed))
+	for id, s := range e.observed {
+		idx := pipelineIndex(s.state)
+		if idx < 0 {
+			continue
+		}
+
+		est := api.SectorEstimate{
+			SectorID:    id,
+			State:       api.SectorState(s.state),
+			PhaseSince:  s.since,
+			FromHistory: true,
+		}
+		if sw, ok := e.workers[id]; ok {
+			est.WorkerClass = sw.last
+		}
+
+		remaining := time.Duration(0)
+		for i, st := range sealingPipeline[idx:] {
+			d, fromHistory := e.phaseDuration(id, st)
+			if !fromHistory {
+				est.FromHistory = false
+			}
+			if i == 0 {
+				d -= now.Sub(s.since)
+				if d < 0 {
+					d = 0
+				}
+				est.PhaseRemaining = d
+			}
+			remaining += d
+		}
+		est.ETA = now.Add(remaining)
+
+		out = append(out, est)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].SectorID < out[j].SectorID
+	})
+	return out
+}
+
+// phaseDuration returns the expected duration of a phase of the sector, and
+// whether it's based on observed durations. Phases which didn't start yet are
+// expected to run on the class of workers which ran the last task of the
+// sector.
+func (e *SealingEstimator) phaseDuration(id abi.SectorNumber, st sealing.SectorState) (time.Duration, bool) {
+	if workerPhases[st] {
+		class := LocalWorkerClass
+		if sw, ok := e.workers[id]; ok {
+			class = sw.last
+			if c, ok := sw.phases[st]; ok {
+				class = c
+			}
+		}
+		if h, ok := e.classes[class][st]; ok && h.Samples > 0 {
+			return h.Average, true
+		}
+	}
+	if h, ok := e.history[st]; ok && h.Samples > 0 {
+		return h.Average, true
+	}
+	if d, ok := chainPhaseDurations()[st]; ok {
+		return d, false
+	}
+	if d, ok := ExpectedPhaseDurations[st]; ok {
+		return time.Duration(float64(d) * float64(e.ssize) / float64(watchdogBaseSize)), false
+	}
+	return 0, false
+}
+
+func pipelineIndex(st sealing.SectorState) int {
+	for i, s := range sealingPipeline {
+		if s == st {
+			return i
+		}
+	}
+	return -1
+}
+
+func nextPhase(from, to sealing.SectorState) bool {
+	i := pipelineIndex(from)
+	if i < 0 {
+		return false
+	}
+	if i == len(sealingPipeline)-1 {
+		return to == sealing.Proving
+	}
+	return sealingPipeline[i+1] == to
+}
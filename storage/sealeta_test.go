@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+func TestSealingEstimatorWorkerClasses(t *testing.T) {
+	e, err := NewSealingEstimator(nil, datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a fast and a slow worker ran precommit1 of sectors 1 and 2
+	e.TaskStarted(1, sealing.PreCommit1, "fast")
+	e.TaskStarted(2, sealing.PreCommit1, "slow")
+	e.addSample(sealing.PreCommit1, e.workerClass(1, sealing.PreCommit1), time.Hour)
+	e.addSample(sealing.PreCommit1, e.workerClass(2, sealing.PreCommit1), 4*time.Hour)
+
+	if c := e.workerClass(1, sealing.WaitSeed); c != "" {
+		t.Fatalf("expected no worker class for phases waiting for the chain, got %s", c)
+	}
+	if c := e.workerClass(5, sealing.PreCommit1); c != LocalWorkerClass {
+		t.Fatalf("expected tasks no remote worker reported to run locally, got %s", c)
+	}
+
+	now := time.Now()
+	e.TaskStarted(3, sealing.PreCommit1, "fast")
+	e.TaskStarted(4, sealing.PreCommit1, "slow")
+	for _, id := range []abi.SectorNumber{3, 4, 5} {
+		e.observed[id] = observedSector{state: sealing.PreCommit1, since: now}
+	}
+
+	expected := map[abi.SectorNumber]time.Duration{
+		3: time.Hour,
+		4: 4 * time.Hour,
+		// no class history, the average of all workers is used
+		5: time.Hour + time.Duration(phaseHistoryAlpha*float64(3*time.Hour)),
+	}
+	for _, est := range e.Estimates(now) {
+		if est.PhaseRemaining != expected[est.SectorID] {
+			t.Errorf("expected sector %d to finish precommit1 in %s, got %s", est.SectorID, expected[est.SectorID], est.PhaseRemaining)
+		}
+	}
+}
+
+// testSealingFailure stands for the events which start failure and retry
+// states
+type testSealingFailure struct{}
+
+func TestSealingEstimatorLog(t *testing.T) {
+	e, err := NewSealingEstimator(nil, datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(time.Second)
+	si := sealing.SectorInfo{SectorNumber: 1}
+	logEvent := func(evt interface{}, after time.Duration) {
+		si.Log = append(si.Log, sealing.Log{
+			Kind:      eventKind(evt),
+			Timestamp: uint64(start.Add(after).Unix()),
+		})
+	}
+	samples := func(st sealing.SectorState) (time.Duration, int) {
+		h, ok := e.history[st]
+		if !ok {
+			return 0, 0
+		}
+		return h.Average, h.Samples
+	}
+
+	// phases shorter than the observation interval are sampled
+	logEvent(sealing.SectorStart{}, 0)
+	logEvent(sealing.SectorPacked{}, 10*time.Second)
+	logEvent(sealing.SectorPreCommit1{}, 40*time.Second)
+	si.State = sealing.PreCommit2
+	if err := e.observeSectors([]sealing.SectorInfo{si}); err != nil {
+		t.Fatal(err)
+	}
+	if d, n := samples(sealing.Packing); d != 10*time.Second || n != 1 {
+		t.Fatalf("expected packing to take 10s, got %s (%d samples)", d, n)
+	}
+	if d, n := samples(sealing.PreCommit1); d != 30*time.Second || n != 1 {
+		t.Fatalf("expected precommit1 to take 30s, got %s (%d samples)", d, n)
+	}
+
+	// a failed phase isn't sampled, and observed transitions aren't sampled
+	// again
+	logEvent(testSealingFailure{}, time.Minute)
+	logEvent(sealing.SectorPreCommit2{}, 2*time.Minute)
+	logEvent(sealing.SectorPreCommitted{}, 3*time.Minute)
+	si.State = sealing.PreCommitWait
+	if err := e.observeSectors([]sealing.SectorInfo{si}); err != nil {
+		t.Fatal(err)
+	}
+	if _, n := samples(sealing.PreCommit2); n != 0 {
+		t.Fatalf("expected the failed phase not to be sampled, got %d samples", n)
+	}
+	if d, n := samples(sealing.PreCommitting); d != time.Minute || n != 1 {
+		t.Fatalf("expected precommitting to take 1m, got %s (%d samples)", d, n)
+	}
+	if _, n := samples(sealing.Packing); n != 1 {
+		t.Fatalf("expected packing to be sampled once, got %d samples", n)
+	}
+
+	// transitions logged before a restart were sampled by the previous run
+	e, err = NewSealingEstimator(nil, datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.started = start.Add(3 * time.Minute)
+	logEvent(sealing.SectorPreCommitLanded{}, 4*time.Minute)
+	si.State = sealing.WaitSeed
+	if err := e.observeSectors([]sealing.SectorInfo{si}); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.history) != 1 {
+		t.Fatalf("expected only the phase which ended after the restart to be sampled, got %v", e.history)
+	}
+	if d, n := samples(sealing.PreCommitWait); d != time.Minute || n != 1 {
+		t.Fatalf("expected precommit wait to take 1m, got %s (%d samples)", d, n)
+	}
+}
@@ -40,6 +40,19 @@ func (m *Miner) ForceSectorState(ctx context.Context, id abi.SectorNumber, state
 	return m.sealing.ForceSectorState(ctx, id, state)
 }
 
+// AbortSectorTask cancels the running sealing task of the sector. It returns
+// false if the sector has no running task.
+func (m *Miner) AbortSectorTask(id abi.SectorNumber) bool {
+	return m.tasks.Abort(id)
+}
+
+// CheckpointSectorTasks aborts the running sealing tasks, so that their
+// sectors are held at the start of their phase during maintenance. It returns
+// the sectors of the aborted tasks.
+func (m *Miner) CheckpointSectorTasks() []abi.SectorNumber {
+	return m.tasks.Checkpoint()
+}
+
 func (m *Miner) RemoveSector(ctx context.Context, id abi.SectorNumber) error {
 	return m.sealing.Remove(ctx, id)
 }
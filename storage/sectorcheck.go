@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// cacheFiles are the files in a sector cache directory which are needed to
+// generate PoSt proofs for the sector
+var cacheFiles = []string{"p_aux", "t_aux"}
+
+// CheckSectorFiles checks the sealed sectors in a storage path, e.g. one moved
+// from another machine, before it's attached. It looks for files which would
+// fail PoSt: sectors of other miners, truncated sealed files, missing cache
+// files, sectors which aren't on chain, and sectors whose sealing state
+// records a CommR other than the one on chain. The sealed data isn't read, so
+// a corrupted file of the right size isn't detected.
+func (m *Miner) CheckSectorFiles(ctx context.Context, path string) ([]api.SectorFileIssue, error) {
+	mi, err := m.api.StateMinerInfo(ctx, m.maddr, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting miner info: %w", err)
+	}
+
+	mid, err := address.IDFromAddress(m.maddr)
+	if err != nil {
+		return nil, err
+	}
+
+	sealedDir := filepath.Join(path, stores.FTSealed.String())
+	ents, err := ioutil.ReadDir(sealedDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, xerrors.Errorf("listing sealed sectors: %w", err)
+	}
+
+	var issues []api.SectorFileIssue
+	for _, ent := range ents {
+		file := filepath.Join(sealedDir, ent.Name())
+		issue := func(sector abi.SectorNumber, format string, args ...interface{}) {
+			issues = append(issues, api.SectorFileIssue{
+				File:   file,
+				Sector: sector,
+				Issue:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		sid, err := stores.ParseSectorID(ent.Name())
+		if err != nil {
+			issue(0, "not a sector file: %s", err)
+			continue
+		}
+		if uint64(sid.Miner) != mid {
+			issue(sid.Number, "sector belongs to miner t0%d", sid.Miner)
+			continue
+		}
+
+		if ent.Size() != int64(mi.SectorSize) {
+			issue(sid.Number, "sealed file has %d bytes, expected %d (truncated or wrong sector size)", ent.Size(), mi.SectorSize)
+		}
+
+		cacheDir := filepath.Join(path, stores.FTCache.String(), stores.SectorName(sid))
+		for _, cf := range cacheFiles {
+			if _, err := os.Stat(filepath.Join(cacheDir, cf)); err != nil {
+				issue(sid.Number, "cache file %s: %s", cf, err)
+			}
+		}
+
+		commR, err := m.onChainCommR(ctx, sid.Number)
+		if err != nil {
+			issue(sid.Number, "%s", err)
+			continue
+		}
+
+		// the CommR the sector was sealed with, as recorded by the sealing
+		// state machine
+		sealed, err := m.GetSectorInfo(sid.Number)
+		if err == nil && sealed.CommR != nil && *sealed.CommR != commR {
+			issue(sid.Number, "CommR %s in the sealing state doesn't match on-chain CommR %s", *sealed.CommR, commR)
+		}
+	}
+
+	return issues, nil
+}
+
+// onChainCommR returns the CommR of a committed or precommitted sector.
+func (m *Miner) onChainCommR(ctx context.Context, sector abi.SectorNumber) (cid.Cid, error) {
+	si, err := m.api.StateSectorGetInfo(ctx, m.maddr, sector, types.EmptyTSK)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("getting sector info: %w", err)
+	}
+	if si != nil {
+		return si.Info.SealedCID, nil
+	}
+
+	pci, err := m.api.StateSectorPreCommitInfo(ctx, m.maddr, sector, types.EmptyTSK)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("sector isn't committed or precommitted on chain: %w", err)
+	}
+
+	return pci.Info.SealedCID, nil
+}
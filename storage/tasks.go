@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	sectorstorage "github.com/filecoin-project/sector-storage"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-storage/storage"
+)
+
+// sealingTasks wraps the sector manager used by the sealing state machine, and
+// keeps track of the sealing task running for each sector, so that it can be
+// aborted. The context of the tasks started by the state machine is only
+// cancelled when the miner stops, a task hanging on a worker would otherwise
+// block the sector forever.
+//
+// While maintenance mode is enabled new tasks are held until it's disabled,
+// before they are handed to the scheduler.
+type sealingTasks struct {
+	sectorstorage.SectorManager
+	maint *Maintenance
+
+	lk      sync.Mutex
+	running map[abi.SectorNumber]*sealingTask
+	held    map[abi.SectorNumber]bool
+}
+
+type sealingTask struct {
+	cancel context.CancelFunc
+	// packing tasks can't be retried by the state machine once aborted
+	packing bool
+}
+
+func newSealingTasks(sm sectorstorage.SectorManager, maint *Maintenance) *sealingTasks {
+	return &sealingTasks{
+		SectorManager: sm,
+		maint:         maint,
+		running:       map[abi.SectorNumber]*sealingTask{},
+		held:          map[abi.SectorNumber]bool{},
+	}
+}
+
+// start registers a task of the sector once maintenance mode allows it to
+// run, done must be called once it returns
+func (t *sealingTasks) start(ctx context.Context, sector abi.SectorID, packing bool) (context.Context, func(), error) {
+	if t.maint != nil {
+		t.lk.Lock()
+		t.held[sector.Number] = true
+		t.lk.Unlock()
+
+		err := t.maint.wait(ctx)
+
+		t.lk.Lock()
+		delete(t.held, sector.Number)
+		t.lk.Unlock()
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	task := &sealingTask{cancel: cancel, packing: packing}
+
+	t.lk.Lock()
+	t.running[sector.Number] = task
+	t.lk.Unlock()
+
+	return ctx, func() {
+		t.lk.Lock()
+		// an aborted task may return after the next one started
+		if t.running[sector.Number] == task {
+			delete(t.running, sector.Number)
+		}
+		t.lk.Unlock()
+
+		cancel()
+	}, nil
+}
+
+// Abort cancels the running task of the sector, the sealing state machine then
+// handles it as a failure of the task. It returns false if the sector has no
+// running task.
+func (t *sealingTasks) Abort(sector abi.SectorNumber) bool {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	task, ok := t.running[sector]
+	if ok {
+		task.cancel()
+		delete(t.running, sector)
+	}
+	return ok
+}
+
+// Checkpoint aborts the running tasks, except packing ones, which are short
+// and can't be retried. The state machine retries the phase of their sectors,
+// which is held at its start during maintenance. It returns the sectors of the
+// aborted tasks.
+func (t *sealingTasks) Checkpoint() []abi.SectorNumber {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	var out []abi.SectorNumber
+	for sector, task := range t.running {
+		if task.packing {
+			continue
+		}
+		task.cancel()
+		delete(t.running, sector)
+		out = append(out, sector)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// status returns the sectors with a running task, and the ones with a task
+// held by maintenance mode
+func (t *sealingTasks) status() (running, held map[abi.SectorNumber]bool) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	running = make(map[abi.SectorNumber]bool, len(t.running))
+	for s := range t.running {
+		running[s] = true
+	}
+	held = make(map[abi.SectorNumber]bool, len(t.held))
+	for s := range t.held {
+		held[s] = true
+	}
+	return running, held
+}
+
+func (t *sealingTasks) AddPiece(ctx context.Context, sector abi.SectorID, pieceSizes []abi.UnpaddedPieceSize, newPieceSize abi.UnpaddedPieceSize, pieceData storage.Data) (abi.PieceInfo, error) {
+	ctx, done, err := t.start(ctx, sector, true)
+	if err != nil {
+		return abi.PieceInfo{}, err
+	}
+	defer done()
+	return t.SectorManager.AddPiece(ctx, sector, pieceSizes, newPieceSize, pieceData)
+}
+
+func (t *sealingTasks) SealPreCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage.PreCommit1Out, error) {
+	ctx, done, err := t.start(ctx, sector, false)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return t.SectorManager.SealPreCommit1(ctx, sector, ticket, pieces)
+}
+
+func (t *sealingTasks) SealPreCommit2(ctx context.Context, sector abi.SectorID, pc1o storage.PreCommit1Out) (storage.SectorCids, error) {
+	ctx, done, err := t.start(ctx, sector, false)
+	if err != nil {
+		return storage.SectorCids{}, err
+	}
+	defer done()
+	return t.SectorManager.SealPreCommit2(ctx, sector, pc1o)
+}
+
+func (t *sealingTasks) SealCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, seed abi.InteractiveSealRandomness, pieces []abi.PieceInfo, cids storage.SectorCids) (storage.Commit1Out, error) {
+	ctx, done, err := t.start(ctx, sector, false)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return t.SectorManager.SealCommit1(ctx, sector, ticket, seed, pieces, cids)
+}
+
+func (t *sealingTasks) SealCommit2(ctx context.Context, sector abi.SectorID, c1o storage.Commit1Out) (storage.Proof, error) {
+	ctx, done, err := t.start(ctx, sector, false)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return t.SectorManager.SealCommit2(ctx, sector, c1o)
+}
+
+func (t *sealingTasks) FinalizeSector(ctx context.Context, sector abi.SectorID, keepUnsealed []storage.Range) error {
+	ctx, done, err := t.start(ctx, sector, false)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return t.SectorManager.FinalizeSector(ctx, sector, keepUnsealed)
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/alerting"
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+const (
+	WatchdogReport = "report"
+	WatchdogRetry  = "retry"
+	WatchdogAbort  = "abort"
+)
+
+// watchdogBaseSize is the sector size the expected phase durations are given for
+var watchdogBaseSize = abi.SectorSize(32 << 30)
+
+// ExpectedPhaseDurations are rough durations of the sealing phases of a 32GiB
+// sector on reasonable hardware. For other sector sizes they are scaled
+// linearly. Phases which depend on the chain (e.g. WaitSeed) aren't watched.
+var ExpectedPhaseDurations = map[sealing.SectorState]time.Duration{
+	sealing.Packing:        30 * time.Minute,
+	sealing.PreCommit1:     5 * time.Hour,
+	sealing.PreCommit2:     time.Hour,
+	sealing.Committing:     time.Hour,
+	sealing.FinalizeSector: 30 * time.Minute,
+}
+
+// watchdogFailedStates are the states the watched phases fail into when their
+// task is aborted, and from which the sealing state machine retries them
+var watchdogFailedStates = map[sealing.SectorState]sealing.SectorState{
+	sealing.PackingFailed:        sealing.Packing,
+	sealing.SealPreCommit1Failed: sealing.PreCommit1,
+	sealing.SealPreCommit2Failed: sealing.PreCommit2,
+	sealing.ComputeProofFailed:   sealing.Committing,
+	sealing.FinalizeFailed:       sealing.FinalizeSector,
+}
+
+type WatchdogConfig struct {
+	CheckInterval time.Duration
+
+	// Multiplier of the expected phase duration after which a sector is
+	// considered stuck. PhaseMultipliers override it for single phases.
+	Multiplier       float64
+	PhaseMultipliers map[sealing.SectorState]float64
+
+	// Action is one of WatchdogReport, WatchdogRetry or WatchdogAbort
+	Action string
+	// MaxRetries is the number of times a phase is retried before the sector
+	// is aborted
+	MaxRetries int
+}
+
+// Watchdog finds sectors which spend much longer in a sealing phase than
+// expected, usually because the worker running the task died or hung.
+//
+// Stuck sectors are reported through the API and alerts. Depending on the
+// configured action, the watchdog also aborts the running task, which fails
+// the phase and lets the sealing state machine retry it through the
+// scheduler, on any suitable (possibly different) worker. Or it aborts the
+// sector by moving it to FailedUnrecoverable, where no more work is done on it
+// until the operator removes it or forces it into another state.
+type Watchdog struct {
+	miner   *Miner
+	sealing watchdogSealing
+	al      *alerting.Alerting
+	cfg     WatchdogConfig
+
+	ssize abi.SectorSize
+
+	lk      sync.Mutex
+	stuck   map[abi.SectorNumber]*api.StuckSector
+	retries map[abi.SectorNumber]watchdogRetries
+}
+
+// watchdogSealing is the part of the miner the watchdog acts on
+type watchdogSealing interface {
+	ListSectors() ([]sealing.SectorInfo, error)
+	ForceSectorState(ctx context.Context, id abi.SectorNumber, state sealing.SectorState) error
+	AbortSectorTask(id abi.SectorNumber) bool
+}
+
+type watchdogRetries struct {
+	state sealing.SectorState
+	count int
+}
+
+func NewWatchdog(m *Miner, al *alerting.Alerting, cfg WatchdogConfig) *Watchdog {
+	return &Watchdog{
+		miner:   m,
+		sealing: m,
+		al:      al,
+		cfg:     cfg,
+
+		stuck:   map[abi.SectorNumber]*api.StuckSector{},
+		retries: map[abi.SectorNumber]watchdogRetries{},
+	}
+}
+
+func (w *Watchdog) Run(ctx context.Context) {
+	mi, err := w.miner.api.StateMinerInfo(ctx, w.miner.maddr, types.EmptyTSK)
+	if err != nil {
+		log.Errorf("sealing watchdog: getting miner info: %s", err)
+		return
+	}
+	w.ssize = mi.SectorSize
+
+	tick := time.NewTicker(w.cfg.CheckInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			if err := w.check(ctx, time.Now()); err != nil {
+				log.Errorf("sealing watchdog: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stuck returns the sectors found stuck by the last check.
+func (w *Watchdog) Stuck() []api.StuckSector {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+
+	out := make([]api.StuckSector, 0, len(w.stuck))
+	for _, s := range w.stuck {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].SectorID < out[j].SectorID
+	})
+
+	return out
+}
+
+func (w *Watchdog) check(ctx context.Context, now time.Time) error {
+	sectors, err := w.sealing.ListSectors()
+	if err != nil {
+		return xerrors.Errorf("listing sectors: %w", err)
+	}
+
+	w.lk.Lock()
+	defer w.lk.Unlock()
+
+	stuck := map[abi.SectorNumber]*api.StuckSector{}
+	for _, si := range sectors {
+		// the retries of a phase are kept while the sector goes through the
+		// failed state the phase is retried from
+		phase := si.State
+		if p, ok := watchdogFailedStates[si.State]; ok {
+			phase = p
+		}
+		if r, ok := w.retries[si.SectorNumber]; ok && r.state != phase {
+			delete(w.retries, si.SectorNumber)
+		}
+
+		expected, ok := w.expected(si.State)
+		if !ok || len(si.Log) == 0 {
+			continue
+		}
+
+		// every state transition is logged, so the last entry tells when the
+		// sector entered its current state
+		since := time.Unix(int64(si.Log[len(si.Log)-1].Timestamp), 0)
+		if now.Sub(since) < expected {
+			continue
+		}
+
+		s := &api.StuckSector{
+			SectorID: si.SectorNumber,
+			State:    api.SectorState(si.State),
+			Since:    since,
+			Expected: expected,
+			Retries:  w.retries[si.SectorNumber].count,
+		}
+		if prev, ok := w.stuck[si.SectorNumber]; ok {
+			s.Action = prev.Action
+		}
+		stuck[si.SectorNumber] = s
+
+		if err := w.act(ctx, si, s); err != nil {
+			log.Errorf("sealing watchdog: sector %d: %s", si.SectorNumber, err)
+		}
+	}
+
+	for id, s := range stuck {
+		if _, ok := w.stuck[id]; !ok {
+			log.Warnw("sector stuck in sealing phase", "sector", id, "state", s.State, "since", s.Since, "expected", s.Expected)
+		}
+	}
+	w.stuck = stuck
+
+	if w.al != nil {
+		w.al.Set("sealing-stuck", len(stuck) > 0, "%d sectors stuck in sealing phases", len(stuck))
+	}
+
+	return nil
+}
+
+func (w *Watchdog) act(ctx context.Context, si sealing.SectorInfo, s *api.StuckSector) error {
+	action := w.cfg.Action
+	if action == WatchdogRetry && s.Retries >= w.cfg.MaxRetries {
+		action = WatchdogAbort
+	}
+
+	switch action {
+	case WatchdogRetry:
+		// aborting the task fails the phase, which the sealing state machine
+		// retries from the failed state. A sector without a running task,
+		// e.g. one whose task returned an error its state doesn't handle, is
+		// moved into its state again.
+		if !w.sealing.AbortSectorTask(si.SectorNumber) {
+			if err := w.sealing.ForceSectorState(ctx, si.SectorNumber, si.State); err != nil {
+				return xerrors.Errorf("retrying %s: %w", si.State, err)
+			}
+		}
+		w.retries[si.SectorNumber] = watchdogRetries{state: si.State, count: s.Retries + 1}
+		s.Retries++
+		log.Warnw("retrying stuck sealing phase", "sector", si.SectorNumber, "state", si.State, "retry", s.Retries)
+	case WatchdogAbort:
+		// the state machine only moves the sector once its running task
+		// returns
+		w.sealing.AbortSectorTask(si.SectorNumber)
+		if err := w.sealing.ForceSectorState(ctx, si.SectorNumber, sealing.FailedUnrecoverable); err != nil {
+			return xerrors.Errorf("aborting: %w", err)
+		}
+		delete(w.retries, si.SectorNumber)
+		log.Warnw("aborted stuck sector", "sector", si.SectorNumber, "state", si.State)
+	default:
+		return nil
+	}
+
+	s.Action = action
+	return nil
+}
+
+// expected returns the time after which a sector in the given state is
+// considered stuck.
+func (w *Watchdog) expected(st sealing.SectorState) (time.Duration, bool) {
+	base, ok := ExpectedPhaseDurations[st]
+	if !ok {
+		return 0, false
+	}
+
+	mul := w.cfg.Multiplier
+	if m, ok := w.cfg.PhaseMultipliers[st]; ok {
+		mul = m
+	}
+	if mul <= 0 {
+		return 0, false
+	}
+
+	d := time.Duration(float64(base) * mul * float64(w.ssize) / float64(watchdogBaseSize))
+	if d < time.Minute {
+		d = time.Minute
+	}
+	return d, true
+}
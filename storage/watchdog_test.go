@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sectorstorage "github.com/filecoin-project/sector-storage"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-storage/storage"
+
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+type fakeWatchdogSealing struct {
+	sectors map[abi.SectorNumber]sealing.SectorInfo
+	running map[abi.SectorNumber]bool
+
+	aborted []abi.SectorNumber
+	forced  map[abi.SectorNumber]sealing.SectorState
+}
+
+func (f *fakeWatchdogSealing) ListSectors() ([]sealing.SectorInfo, error) {
+	var out []sealing.SectorInfo
+	for _, si := range f.sectors {
+		out = append(out, si)
+	}
+	return out, nil
+}
+
+func (f *fakeWatchdogSealing) ForceSectorState(ctx context.Context, id abi.SectorNumber, state sealing.SectorState) error {
+	f.forced[id] = state
+	return nil
+}
+
+func (f *fakeWatchdogSealing) AbortSectorTask(id abi.SectorNumber) bool {
+	if !f.running[id] {
+		return false
+	}
+	f.aborted = append(f.aborted, id)
+	delete(f.running, id)
+	return true
+}
+
+// enter moves the sector into the state at the given time
+func (f *fakeWatchdogSealing) enter(id abi.SectorNumber, state sealing.SectorState, at time.Time) {
+	si := f.sectors[id]
+	si.SectorNumber = id
+	si.State = state
+	si.Log = append(si.Log, sealing.Log{Timestamp: uint64(at.Unix())})
+	f.sectors[id] = si
+}
+
+func TestWatchdogRetry(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now()
+
+	fs := &fakeWatchdogSealing{
+		sectors: map[abi.SectorNumber]sealing.SectorInfo{},
+		running: map[abi.SectorNumber]bool{},
+		forced:  map[abi.SectorNumber]sealing.SectorState{},
+	}
+	w := NewWatchdog(nil, nil, WatchdogConfig{Multiplier: 1, Action: WatchdogRetry, MaxRetries: 2})
+	w.sealing = fs
+	w.ssize = watchdogBaseSize
+
+	check := func() {
+		t.Helper()
+		if err := w.check(ctx, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// sector 1 hangs in precommit1 on a worker, sector 2 has no task left
+	// in packing, sector 3 waits for the chain
+	fs.enter(1, sealing.PreCommit1, now.Add(-6*time.Hour))
+	fs.running[1] = true
+	fs.enter(2, sealing.Packing, now.Add(-time.Hour))
+	fs.enter(3, sealing.WaitSeed, now.Add(-24*time.Hour))
+	check()
+
+	if len(fs.aborted) != 1 || fs.aborted[0] != 1 {
+		t.Fatalf("expected the task of sector 1 to be aborted, got %v", fs.aborted)
+	}
+	if _, ok := fs.forced[1]; ok {
+		t.Fatal("expected the sector with an aborted task not to be forced")
+	}
+	if fs.forced[2] != sealing.Packing {
+		t.Fatalf("expected the sector without a task to be moved into its state again, got %q", fs.forced[2])
+	}
+	if len(w.Stuck()) != 2 {
+		t.Fatalf("expected 2 stuck sectors, got %+v", w.Stuck())
+	}
+
+	// the aborted task fails precommit1, which is retried and hangs again
+	fs.enter(1, sealing.SealPreCommit1Failed, now.Add(-5*time.Hour))
+	check()
+	if w.retries[1].count != 1 {
+		t.Fatalf("expected the retry to be kept in the failed state, got %+v", w.retries[1])
+	}
+
+	fs.enter(1, sealing.PreCommit1, now.Add(-5*time.Hour))
+	fs.running[1] = true
+	check()
+	if len(fs.aborted) != 2 || w.retries[1].count != 2 {
+		t.Fatalf("expected a second retry, got %d aborts and %+v", len(fs.aborted), w.retries[1])
+	}
+
+	// after MaxRetries the sector is aborted
+	fs.running[1] = true
+	check()
+	if len(fs.aborted) != 3 || fs.forced[1] != sealing.FailedUnrecoverable {
+		t.Fatalf("expected the sector to be aborted, got %d aborts and state %q", len(fs.aborted), fs.forced[1])
+	}
+	if _, ok := w.retries[1]; ok {
+		t.Fatal("expected the retries of the aborted sector to be dropped")
+	}
+}
+
+type hangingSealer struct {
+	sectorstorage.SectorManager
+
+	started chan struct{}
+}
+
+func (h *hangingSealer) SealPreCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage.PreCommit1Out, error) {
+	close(h.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestSealingTasksAbort(t *testing.T) {
+	hs := &hangingSealer{started: make(chan struct{})}
+	tasks := newSealingTasks(hs, nil)
+
+	if tasks.Abort(1) {
+		t.Fatal("expected no task to abort")
+	}
+
+	errs := make(chan error)
+	go func() {
+		_, err := tasks.SealPreCommit1(context.TODO(), abi.SectorID{Miner: 1000, Number: 1}, nil, nil)
+		errs <- err
+	}()
+	<-hs.started
+
+	if !tasks.Abort(1) {
+		t.Fatal("expected the running task to be aborted")
+	}
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("expected the task to be cancelled, got %v", err)
+	}
+	if tasks.Abort(1) {
+		t.Fatal("expected the aborted task not to be running")
+	}
+}
@@ -19,17 +19,13 @@ import (
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/actors"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/alerting"
 )
 
 var errNoPartitions = errors.New("no partitions")
 
-func (s *WindowPoStScheduler) failPost(deadline *miner.DeadlineInfo) {
-	log.Errorf("TODO")
-	/*s.failLk.Lock()
-	if eps > s.failed {
-		s.failed = eps
-	}
-	s.failLk.Unlock()*/
+func (s *WindowPoStScheduler) failPost(err error, deadline *miner.DeadlineInfo) {
+	s.alerts.Raise(alerting.WindowPoStFail, "window post for deadline %d (period start %d) failed: %s", deadline.Index, deadline.PeriodStart, err)
 }
 
 func (s *WindowPoStScheduler) doPost(ctx context.Context, deadline *miner.DeadlineInfo, ts *types.TipSet) {
@@ -49,14 +45,15 @@ func (s *WindowPoStScheduler) doPost(ctx context.Context, deadline *miner.Deadli
 		case errNoPartitions:
 			return
 		case nil:
-			if err := s.submitPost(ctx, proof); err != nil {
+			if err := s.submitPost(ctx, deadline, proof); err != nil {
 				log.Errorf("submitPost failed: %+v", err)
-				s.failPost(deadline)
+				s.failPost(err, deadline)
 				return
 			}
+			s.alerts.Resolve(alerting.WindowPoStFail, "window post for deadline %d (period start %d) submitted", deadline.Index, deadline.PeriodStart)
 		default:
 			log.Errorf("runPost failed: %+v", err)
-			s.failPost(deadline)
+			s.failPost(err, deadline)
 			return
 		}
 	}()
@@ -181,7 +178,7 @@ func (s *WindowPoStScheduler) checkNextRecoveries(ctx context.Context, deadline
 		GasPrice: types.NewInt(2),
 	}
 
-	sm, err := s.api.MpoolPushMessage(ctx, msg)
+	sm, err := checkAndPush(ctx, s.api, msg)
 	if err != nil {
 		return xerrors.Errorf("pushing message to mpool: %w", err)
 	}
@@ -260,7 +257,7 @@ func (s *WindowPoStScheduler) checkNextFaults(ctx context.Context, deadline uint
 		GasPrice: types.NewInt(2),
 	}
 
-	sm, err := s.api.MpoolPushMessage(ctx, msg)
+	sm, err := checkAndPush(ctx, s.api, msg)
 	if err != nil {
 		return xerrors.Errorf("pushing message to mpool: %w", err)
 	}
@@ -482,7 +479,7 @@ func (s *WindowPoStScheduler) sortedSectorInfo(ctx context.Context, deadlineSect
 	return sbsi, nil
 }
 
-func (s *WindowPoStScheduler) submitPost(ctx context.Context, proof *miner.SubmitWindowedPoStParams) error {
+func (s *WindowPoStScheduler) submitPost(ctx context.Context, deadline *miner.DeadlineInfo, proof *miner.SubmitWindowedPoStParams) error {
 	ctx, span := trace.StartSpan(ctx, "storage.commitPost")
 	defer span.End()
 
@@ -503,7 +500,7 @@ func (s *WindowPoStScheduler) submitPost(ctx context.Context, proof *miner.Submi
 	}
 
 	// TODO: consider maybe caring about the output
-	sm, err := s.api.MpoolPushMessage(ctx, msg)
+	sm, err := checkAndPush(ctx, s.api, msg)
 	if err != nil {
 		return xerrors.Errorf("pushing message to mpool: %w", err)
 	}
@@ -511,17 +508,11 @@ func (s *WindowPoStScheduler) submitPost(ctx context.Context, proof *miner.Submi
 	log.Infof("Submitted window post: %s", sm.Cid())
 
 	go func() {
-		rec, err := s.api.StateWaitMsg(context.TODO(), sm.Cid(), build.MessageConfidence)
-		if err != nil {
-			log.Error(err)
-			return
+		// not using ctx here, it's cancelled as soon as the deadline closes
+		if _, err := s.resubmit.watch(context.TODO(), sm, deadline.Close); err != nil {
+			log.Errorf("Submitting window post %s failed: %+v", sm.Cid(), err)
+			s.failPost(err, deadline)
 		}
-
-		if rec.Receipt.ExitCode == 0 {
-			return
-		}
-
-		log.Errorf("Submitting window post %s failed: exit %d", sm.Cid(), rec.Receipt.ExitCode)
 	}()
 
 	return nil